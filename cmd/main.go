@@ -1,12 +1,28 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	_ "dental-saas/docs"
+	compliance_handlers "dental-saas/modules/compliance/handlers"
+	"dental-saas/modules/dental/calendarsync"
+	"dental-saas/modules/dental/handlers"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/modules/dental/reminders"
+	"dental-saas/modules/dental/selfservice"
+	"dental-saas/modules/dental/survey"
+	financial_handlers "dental-saas/modules/financial/handlers"
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/clinics"
 	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/notify"
+	"dental-saas/shared/retention"
 	"dental-saas/shared/router"
+	"dental-saas/shared/webhooks"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -20,9 +36,65 @@ import (
 
 // @host localhost:8080
 // @BasePath /api/v1
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from /api/v1/auth/login, as "Bearer <token>"
 func main() {
 	config.InitDynamoDB()
 
+	// Corrige periodicamente a deriva dos contadores de estatísticas
+	counters.StartReconciler(context.Background(), config.EnvDuration("COUNTERS_RECONCILE_INTERVAL", 24*time.Hour))
+
+	// Pré-carrega a agenda do dia e a lista de dentistas no cache
+	handlers.StartAgendaWarmer(context.Background(), config.EnvDuration("AGENDA_WARM_INTERVAL", 5*time.Minute))
+
+	// Aplica as mudanças de preço agendadas quando entram em vigor
+	pricing.StartPriceActivator(context.Background(), config.EnvDuration("PRICE_ACTIVATION_INTERVAL", time.Hour))
+
+	// Envia a pesquisa de satisfação após os agendamentos concluídos
+	survey.StartDispatcher(context.Background(),
+		config.EnvDuration("SURVEY_DISPATCH_INTERVAL", 15*time.Minute),
+		config.EnvDuration("SURVEY_MAX_AGE", 7*24*time.Hour))
+
+	// Envia os lembretes de consulta com o link para confirmar, cancelar ou remarcar
+	selfservice.StartReminders(context.Background(),
+		config.EnvDuration("APPOINTMENT_REMINDER_INTERVAL", 15*time.Minute),
+		config.EnvDuration("APPOINTMENT_REMINDER_LEAD", 24*time.Hour))
+
+	// Envia os lembretes de consulta por SMS ou WhatsApp das clínicas que os ativaram
+	reminders.StartScheduler(context.Background(), config.EnvDuration("TEXT_REMINDER_INTERVAL", 5*time.Minute))
+
+	// Importa os horários ocupados das agendas CalDAV dos dentistas e publica nelas os agendamentos
+	calendarsync.StartSync(context.Background(), config.EnvDuration("CALDAV_SYNC_INTERVAL", 15*time.Minute))
+
+	// Atualiza os números do painel ao vivo enquanto há telas conectadas
+	handlers.StartLiveMetrics(context.Background(), config.EnvDuration("LIVE_METRICS_INTERVAL", 30*time.Second))
+	handlers.StartLiveQueue(context.Background(), config.EnvDuration("LIVE_QUEUE_INTERVAL", time.Minute))
+
+	// Envia os lembretes das tarefas da equipe
+	handlers.StartTaskReminders(context.Background(), config.EnvDuration("TASK_REMINDER_INTERVAL", time.Minute))
+
+	// Avisa o responsável quando a manutenção de um equipamento se aproxima
+	financial_handlers.StartMaintenanceReminders(context.Background(),
+		config.EnvDuration("ASSET_REMINDER_INTERVAL", time.Hour),
+		config.EnvInt("ASSET_MAINTENANCE_LEAD_DAYS", 7))
+
+	// Alerta sobre licenças e alvarás perto do vencimento ou vencidos
+	compliance_handlers.StartExpiryAlerts(context.Background(),
+		config.EnvDuration("COMPLIANCE_ALERT_INTERVAL", 6*time.Hour),
+		config.EnvInt("COMPLIANCE_LEAD_DAYS", 30))
+
+	// Remove os registros mais antigos que a política de retenção de cada clínica
+	retention.StartPurger(context.Background(), config.EnvDuration("RETENTION_PURGE_INTERVAL", 24*time.Hour), clinics.IDs)
+
+	// Entrega as notificações enfileiradas quando NOTIFY_QUEUE está configurada
+	notify.StartDispatcher(context.Background())
+
+	// Entrega os eventos dos webhooks assinados pelas clínicas, com novas tentativas
+	webhooks.StartDispatcher(context.Background(), config.EnvDuration("WEBHOOK_POLL_INTERVAL", 10*time.Second))
+
 	r := router.NewMainRouter()
 
 	// Adiciona o Swagger na rota principal
@@ -30,5 +102,5 @@ func main() {
 
 	log.Println("Dental SaaS running on http://localhost:8080")
 	log.Println("API documentation available at http://localhost:8080/swagger/")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	log.Fatal(http.ListenAndServe(":8080", apierror.Middleware(router.StripTrailingSlash(r))))
 }
@@ -26,9 +26,9 @@ import (
 // @Produce json
 // @Param appointment body models.Appointment true "Appointment data"
 // @Success 201 {object} models.Appointment
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Appointment with this ID already exists"
-// @Failure 500 {string} string "Failed to save appointment"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Appointment with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save appointment"
 // @Router /appointment [post]
 func CreateAppointment(w http.ResponseWriter, r *http.Request) {
 	var appointment models.Appointment
@@ -87,7 +87,7 @@ func CreateAppointment(w http.ResponseWriter, r *http.Request) {
 // @Tags appointments
 // @Produce json
 // @Success 200 {array} models.Appointment
-// @Failure 500 {string} string "Failed to retrieve appointments"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointments"
 // @Router /appointments [get]
 func GetAllAppointments(w http.ResponseWriter, r *http.Request) {
 	result, err := config.DBClient.Scan(r.Context(), &dynamodb.ScanInput{
@@ -118,8 +118,8 @@ func GetAllAppointments(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Appointment ID"
 // @Success 200 {object} models.Appointment
-// @Failure 404 {string} string "Appointment not found"
-// @Failure 500 {string} string "Failed to retrieve appointment"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointment"
 // @Router /appointment/{id} [get]
 func GetAppointmentByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -163,9 +163,9 @@ func GetAppointmentByID(w http.ResponseWriter, r *http.Request) {
 // @Param id path string true "Appointment ID"
 // @Param appointment body models.Appointment true "Appointment data (ID will be ignored)"
 // @Success 200 {object} models.Appointment
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Appointment not found"
-// @Failure 500 {string} string "Failed to update appointment"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
 // @Router /appointment/{id} [put]
 func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -256,8 +256,8 @@ func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Appointment ID"
 // @Success 204 "No Content"
-// @Failure 404 {string} string "Appointment not found"
-// @Failure 500 {string} string "Failed to delete appointment"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 500 {object} apierror.Response "Failed to delete appointment"
 // @Router /appointment/{id} [delete]
 func DeleteAppointment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
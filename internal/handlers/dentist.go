@@ -27,9 +27,9 @@ import (
 // @Produce json
 // @Param dentist body models.Dentist true "Dentist data"
 // @Success 201 {object} models.Dentist
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Dentist with this ID already exists"
-// @Failure 500 {string} string "Failed to save dentist"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Dentist with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save dentist"
 // @Router /dentist [post]
 func CreateDentist(w http.ResponseWriter, r *http.Request) {
 	var dentist models.Dentist
@@ -132,7 +132,7 @@ func dynamoToModel(dd dynamoDentist) (models.Dentist, error) {
 // @Tags dentists
 // @Produce json
 // @Success 200 {array} models.Dentist
-// @Failure 500 {string} string "Failed to retrieve dentists"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentists"
 // @Router /dentists [get]
 func GetAllDentists(w http.ResponseWriter, r *http.Request) {
 	result, err := config.DBClient.Scan(r.Context(), &dynamodb.ScanInput{
@@ -174,8 +174,8 @@ func GetAllDentists(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Dentist ID"
 // @Success 200 {object} models.Dentist
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to retrieve dentist"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist"
 // @Router /dentist/{id} [get]
 func GetDentistByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -226,9 +226,9 @@ func GetDentistByID(w http.ResponseWriter, r *http.Request) {
 // @Param id path string true "Dentist ID"
 // @Param dentist body models.Dentist true "Dentist data (ID will be ignored)"
 // @Success 200 {object} models.Dentist
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to update dentist"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to update dentist"
 // @Router /dentist/{id} [put]
 func UpdateDentist(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -337,8 +337,8 @@ func UpdateDentist(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Dentist ID"
 // @Success 204 "No Content"
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to delete dentist"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to delete dentist"
 // @Router /dentist/{id} [delete]
 func DeleteDentist(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -372,8 +372,8 @@ func DeleteDentist(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param name path string true "Dentist Name"
 // @Success 200 {array} models.Dentist
-// @Failure 404 {string} string "No dentists found with this name"
-// @Failure 500 {string} string "Failed to retrieve dentists"
+// @Failure 404 {object} apierror.Response "No dentists found with this name"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentists"
 // @Router /dentist/name/{name} [get]
 func GetDentistByName(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -428,8 +428,8 @@ func GetDentistByName(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param cro path string true "Dentist CRO"
 // @Success 200 {object} models.Dentist
-// @Failure 404 {string} string "No dentist found with this CRO"
-// @Failure 500 {string} string "Failed to retrieve dentist"
+// @Failure 404 {object} apierror.Response "No dentist found with this CRO"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist"
 // @Router /dentist/cro/{cro} [get]
 func GetDentistByCRO(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
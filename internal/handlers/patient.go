@@ -27,9 +27,9 @@ import (
 // @Produce json
 // @Param patient body models.Patient true "Patient data"
 // @Success 201 {object} models.Patient
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Patient with this ID already exists"
-// @Failure 500 {string} string "Failed to save patient"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Patient with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save patient"
 // @Router /patient [post]
 func CreatePatient(w http.ResponseWriter, r *http.Request) {
 	var patient models.Patient
@@ -89,7 +89,7 @@ func CreatePatient(w http.ResponseWriter, r *http.Request) {
 // @Tags patients
 // @Produce json
 // @Success 200 {array} models.Patient
-// @Failure 500 {string} string "Failed to retrieve patients"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patients"
 // @Router /patients [get]
 func GetAllPatients(w http.ResponseWriter, r *http.Request) {
 	result, err := config.DBClient.Scan(r.Context(), &dynamodb.ScanInput{
@@ -120,8 +120,8 @@ func GetAllPatients(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Patient ID"
 // @Success 200 {object} models.Patient
-// @Failure 404 {string} string "Patient not found"
-// @Failure 500 {string} string "Failed to retrieve patient"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patient"
 // @Router /patient/{id} [get]
 func GetPatientByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -165,9 +165,9 @@ func GetPatientByID(w http.ResponseWriter, r *http.Request) {
 // @Param id path string true "Patient ID"
 // @Param patient body models.Patient true "Patient data (ID will be ignored)"
 // @Success 200 {object} models.Patient
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Patient not found"
-// @Failure 500 {string} string "Failed to update patient"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to update patient"
 // @Router /patient/{id} [put]
 func UpdatePatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -262,8 +262,8 @@ func UpdatePatient(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Patient ID"
 // @Success 204 "No Content"
-// @Failure 404 {string} string "Patient not found"
-// @Failure 500 {string} string "Failed to delete patient"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to delete patient"
 // @Router /patient/{id} [delete]
 func DeletePatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -297,8 +297,8 @@ func DeletePatient(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param name path string true "Patient Name"
 // @Success 200 {array} models.Patient
-// @Failure 404 {string} string "No patients found with this name"
-// @Failure 500 {string} string "Failed to retrieve patients"
+// @Failure 404 {object} apierror.Response "No patients found with this name"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patients"
 // @Router /patient/name/{name} [get]
 func GetPatientByName(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -27,9 +27,9 @@ import (
 // @Produce json
 // @Param procedure body models.Procedure true "Procedure data"
 // @Success 201 {object} models.Procedure
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Procedure with this ID already exists"
-// @Failure 500 {string} string "Failed to save procedure"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Procedure with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save procedure"
 // @Router /procedure [post]
 func CreateProcedure(w http.ResponseWriter, r *http.Request) {
 	var procedure models.Procedure
@@ -88,7 +88,7 @@ func CreateProcedure(w http.ResponseWriter, r *http.Request) {
 // @Tags procedures
 // @Produce json
 // @Success 200 {array} models.Procedure
-// @Failure 500 {string} string "Failed to retrieve procedures"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedures"
 // @Router /procedures [get]
 func GetAllProcedures(w http.ResponseWriter, r *http.Request) {
 	result, err := config.DBClient.Scan(r.Context(), &dynamodb.ScanInput{
@@ -119,8 +119,8 @@ func GetAllProcedures(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Procedure ID"
 // @Success 200 {object} models.Procedure
-// @Failure 404 {string} string "Procedure not found"
-// @Failure 500 {string} string "Failed to retrieve procedure"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedure"
 // @Router /procedure/{id} [get]
 func GetProcedureByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -164,9 +164,9 @@ func GetProcedureByID(w http.ResponseWriter, r *http.Request) {
 // @Param id path string true "Procedure ID"
 // @Param procedure body models.Procedure true "Procedure data (ID will be ignored)"
 // @Success 200 {object} models.Procedure
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Procedure not found"
-// @Failure 500 {string} string "Failed to update procedure"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to update procedure"
 // @Router /procedure/{id} [put]
 func UpdateProcedure(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -257,8 +257,8 @@ func UpdateProcedure(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Procedure ID"
 // @Success 204 "No Content"
-// @Failure 404 {string} string "Procedure not found"
-// @Failure 500 {string} string "Failed to delete procedure"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to delete procedure"
 // @Router /procedure/{id} [delete]
 func DeleteProcedure(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -292,8 +292,8 @@ func DeleteProcedure(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param name path string true "Procedure Name"
 // @Success 200 {array} models.Procedure
-// @Failure 404 {string} string "No procedures found with this name"
-// @Failure 500 {string} string "Failed to retrieve procedures"
+// @Failure 404 {object} apierror.Response "No procedures found with this name"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedures"
 // @Router /procedure/name/{name} [get]
 func GetProcedureByName(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -0,0 +1,88 @@
+//go:build chaos
+
+package handlers
+
+import (
+	"dental-saas/shared/auth"
+	"dental-saas/shared/chaos"
+	"encoding/json"
+	"net/http"
+)
+
+// chaosOperator checks the user is an admin of the default clinic: failures
+// are injected into the calls of every clinic of the instance, so no clinic's
+// admin may turn them on
+func chaosOperator(w http.ResponseWriter, r *http.Request) bool {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if !claims.Operator() {
+		http.Error(w, "Only admins of the default clinic can inject failures", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GetChaos godoc
+// @Summary Get failure injection settings
+// @Description Get the latency and errors currently injected into DynamoDB calls. Only available in builds tagged chaos, to operators (admins of the default clinic).
+// @Tags admin
+// @Produce json
+// @Success 200 {object} chaos.Settings
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can inject failures"
+// @Router /api/v1/admin/chaos [get]
+func GetChaos(w http.ResponseWriter, r *http.Request) {
+	if !chaosOperator(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chaos.Get())
+}
+
+// SetChaos godoc
+// @Summary Set failure injection settings
+// @Description Inject latency and/or errors (throttle, internal, network) into DynamoDB calls, optionally limited to some operations. Only available in builds tagged chaos, to operators (admins of the default clinic).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param settings body chaos.Settings true "Failure injection settings"
+// @Success 200 {object} chaos.Settings
+// @Failure 400 {object} apierror.Response "Invalid request payload"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can inject failures"
+// @Router /api/v1/admin/chaos [put]
+func SetChaos(w http.ResponseWriter, r *http.Request) {
+	if !chaosOperator(w, r) {
+		return
+	}
+	var settings chaos.Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := settings.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chaos.Set(settings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// ResetChaos godoc
+// @Summary Stop failure injection
+// @Description Stop injecting latency and errors into DynamoDB calls. Only available in builds tagged chaos, to operators (admins of the default clinic).
+// @Tags admin
+// @Success 204 "No Content"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can inject failures"
+// @Router /api/v1/admin/chaos [delete]
+func ResetChaos(w http.ResponseWriter, r *http.Request) {
+	if !chaosOperator(w, r) {
+		return
+	}
+	chaos.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
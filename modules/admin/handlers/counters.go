@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"dental-saas/shared/counters"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ReconcileCounters godoc
+// @Summary Reconcile statistics counters
+// @Description Recount the patients and appointments per day of every clinic from the source tables and correct counters that drifted
+// @Tags admin
+// @Produce json
+// @Success 200 {object} counters.ReconcileResult
+// @Failure 500 {object} apierror.Response "Failed to reconcile counters"
+// @Router /api/v1/admin/counters/reconcile [post]
+func ReconcileCounters(w http.ResponseWriter, r *http.Request) {
+	result, err := counters.Reconcile(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to reconcile counters", http.StatusInternalServerError)
+		log.Printf("Error reconciling counters: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"dental-saas/shared/config"
+	"dental-saas/shared/export"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// exportableTables lists the tables that can be exported in full
+var exportableTables = map[string]bool{
+	"Dentists":     true,
+	"Patients":     true,
+	"Procedures":   true,
+	"Appointments": true,
+	"Expenses":     true,
+	"Revenues":     true,
+	"Invoices":     true,
+}
+
+// ExportTable godoc
+// @Summary Export a whole table
+// @Description Stream every item of a table as newline-delimited JSON using a DynamoDB parallel scan. Intended for backups and warehouse sync; the rcu parameter caps the read capacity consumed by the export.
+// @Tags admin
+// @Produce application/x-ndjson
+// @Param table path string true "Table name (e.g. Patients)"
+// @Param segments query int false "Number of parallel scan workers (default 4, max 32)"
+// @Param rcu query number false "Maximum read capacity units per second (default 100, 0 for unlimited)"
+// @Success 200 {string} string "Newline-delimited JSON items"
+// @Failure 400 {object} apierror.Response "Invalid export parameters"
+// @Failure 404 {object} apierror.Response "Table not exportable"
+// @Failure 500 {object} apierror.Response "Failed to export table"
+// @Router /api/v1/admin/export/{table} [get]
+func ExportTable(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	table := vars["table"]
+	if !exportableTables[table] {
+		http.Error(w, "Table not exportable", http.StatusNotFound)
+		return
+	}
+
+	opts := export.ScanOptions{Segments: 4, ReadUnitsPerSecond: 100}
+	query := r.URL.Query()
+	if v := query.Get("segments"); v != "" {
+		segments, err := strconv.Atoi(v)
+		if err != nil || segments <= 0 || segments > export.MaxSegments {
+			http.Error(w, fmt.Sprintf("segments must be between 1 and %d", export.MaxSegments), http.StatusBadRequest)
+			return
+		}
+		opts.Segments = segments
+	}
+	if v := query.Get("rcu"); v != "" {
+		rcu, err := strconv.ParseFloat(v, 64)
+		if err != nil || rcu < 0 {
+			http.Error(w, "rcu must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		opts.ReadUnitsPerSecond = rcu
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	count := 0
+
+	err := export.ParallelScan(r.Context(), config.DBClient, table, opts, func(item map[string]types.AttributeValue) error {
+		var v map[string]interface{}
+		if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+			return err
+		}
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ndjson"`, table))
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		count++
+		if flusher != nil && count%1000 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error exporting table %s after %d items: %v", table, count, err)
+		if !started {
+			http.Error(w, "Failed to export table", http.StatusInternalServerError)
+			return
+		}
+		encoder.Encode(map[string]string{"error": "export interrupted"})
+		return
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+	log.Printf("Exported %d items from table %s", count, table)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// GetLetterhead godoc
+// @Summary Get the clinic letterhead
+// @Description Get the letterhead printed at the top of the documents handed to patients, such as invoice PDFs. Without one configured, only the clinic's name is printed.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} clinics.Letterhead
+// @Failure 500 {object} apierror.Response "Failed to retrieve letterhead"
+// @Router /api/v1/admin/letterhead [get]
+func GetLetterhead(w http.ResponseWriter, r *http.Request) {
+	letterhead, err := clinics.GetLetterhead(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve letterhead", http.StatusInternalServerError)
+		log.Printf("Error fetching letterhead: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letterhead)
+}
+
+// UpdateLetterhead godoc
+// @Summary Update the clinic letterhead
+// @Description Replace the letterhead of the clinic: name (the clinic's name when empty), legal name, tax ID, address, phone, email, website and a footer printed at the end of invoices. Each field is limited to 90 characters, one printed line.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param letterhead body clinics.Letterhead true "Letterhead"
+// @Success 200 {object} clinics.Letterhead
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 500 {object} apierror.Response "Failed to save letterhead"
+// @Router /api/v1/admin/letterhead [put]
+func UpdateLetterhead(w http.ResponseWriter, r *http.Request) {
+	var letterhead clinics.Letterhead
+	if err := json.NewDecoder(r.Body).Decode(&letterhead); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	letterhead.ClinicID = config.ClinicID(r.Context())
+	if err := letterhead.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := clinics.SaveLetterhead(r.Context(), letterhead)
+	if err != nil {
+		http.Error(w, "Failed to save letterhead", http.StatusInternalServerError)
+		log.Printf("Error saving letterhead: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"dental-saas/shared/config"
+	"dental-saas/shared/netpolicy"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// GetNetworkPolicy godoc
+// @Summary Get the network policy
+// @Description Get the networks (CIDR) and countries the staff endpoints of the clinic can be reached from
+// @Tags admin
+// @Produce json
+// @Success 200 {object} netpolicy.Policy
+// @Failure 500 {object} apierror.Response "Failed to retrieve network policy"
+// @Router /api/v1/admin/network-policy [get]
+func GetNetworkPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := netpolicy.Get(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve network policy", http.StatusInternalServerError)
+		log.Printf("Error fetching network policy: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// UpdateNetworkPolicy godoc
+// @Summary Update the network policy
+// @Description Restrict the staff endpoints of the clinic to an allowlist of networks (e.g. the office network or VPN) and, optionally, countries. Public endpoints (health checks, online booking, survey links) are never restricted. A policy that would block the request saving it is rejected, so the caller cannot lock themselves out.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param policy body netpolicy.Policy true "Network policy"
+// @Success 200 {object} netpolicy.Policy
+// @Failure 400 {object} apierror.Response "Invalid request body, networks or countries"
+// @Failure 409 {object} apierror.Response "Policy would block the current client"
+// @Failure 500 {object} apierror.Response "Failed to save network policy"
+// @Router /api/v1/admin/network-policy [put]
+func UpdateNetworkPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy netpolicy.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy.ClinicID = config.ClinicID(r.Context())
+	if policy.AllowedCIDRs == nil {
+		policy.AllowedCIDRs = []string{}
+	}
+	if policy.AllowedCountries == nil {
+		policy.AllowedCountries = []string{}
+	}
+	if err := policy.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, reason := policy.Allows(r); !ok {
+		http.Error(w, "Policy would block the current client ("+netpolicy.ClientIP(r)+": "+reason+")", http.StatusConflict)
+		return
+	}
+
+	saved, err := netpolicy.Save(r.Context(), policy)
+	if err != nil {
+		http.Error(w, "Failed to save network policy", http.StatusInternalServerError)
+		log.Printf("Error saving network policy: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
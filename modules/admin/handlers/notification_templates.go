@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"dental-saas/shared/config"
+	"dental-saas/shared/i18n"
+	"dental-saas/shared/notify"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// templateSettings is what the template editor needs: the kinds of
+// notifications with their merge fields and default text, the channels and
+// languages templates can be written for, and the templates the clinic customized
+type templateSettings struct {
+	Kinds     []notify.Kind     `json:"kinds"`
+	Channels  []string          `json:"channels"`
+	Languages []string          `json:"languages"`
+	Templates []notify.Template `json:"templates"`
+}
+
+// templatePreview is the body of a preview request. Subject and body preview
+// a draft before it is saved; without them the current template is rendered.
+// Data overrides the sample values of the merge fields.
+type templatePreview struct {
+	Subject *string           `json:"subject,omitempty"`
+	Body    *string           `json:"body,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// GetNotificationTemplates godoc
+// @Summary List notification templates
+// @Description List the notifications the clinic sends, with their merge fields (and the sample values previews use) and default text, the channels and languages templates can be written for, and the templates the clinic customized
+// @Tags admin
+// @Produce json
+// @Success 200 {object} handlers.templateSettings
+// @Failure 500 {object} apierror.Response "Failed to retrieve notification templates"
+// @Router /api/v1/admin/notifications/templates [get]
+func GetNotificationTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := notify.ListTemplates(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve notification templates", http.StatusInternalServerError)
+		log.Printf("Error listing notification templates: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templateSettings{
+		Kinds:     notify.Kinds(),
+		Channels:  notify.Channels,
+		Languages: i18n.Languages,
+		Templates: templates,
+	})
+}
+
+// GetNotificationTemplate godoc
+// @Summary Get a notification template
+// @Description Get the subject and body the clinic sends for a notification on a channel in a language: its customized template, or the default text (custom false)
+// @Tags admin
+// @Produce json
+// @Param kind path string true "Notification kind, e.g. appointment_reminder"
+// @Param channel path string true "email, sms or whatsapp"
+// @Param language path string true "pt-BR, en or es"
+// @Success 200 {object} notify.Template
+// @Failure 400 {object} apierror.Response "Unknown channel or language"
+// @Failure 404 {object} apierror.Response "Unknown notification kind"
+// @Failure 500 {object} apierror.Response "Failed to retrieve notification template"
+// @Router /api/v1/admin/notifications/templates/{kind}/{channel}/{language} [get]
+func GetNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := currentTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// UpdateNotificationTemplate godoc
+// @Summary Customize a notification template
+// @Description Set the subject and body the clinic sends for a notification on a channel in a language, replacing the default text. Merge fields are written as {{field}} and must be fields of the notification. The subject is required for email and optional for sms and whatsapp, whose body is limited to 1600 characters.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param kind path string true "Notification kind, e.g. appointment_reminder"
+// @Param channel path string true "email, sms or whatsapp"
+// @Param language path string true "pt-BR, en or es"
+// @Param template body notify.Template true "Subject and body"
+// @Success 200 {object} notify.Template
+// @Failure 400 {object} apierror.Response "Invalid request body or template"
+// @Failure 404 {object} apierror.Response "Unknown notification kind"
+// @Failure 500 {object} apierror.Response "Failed to save notification template"
+// @Router /api/v1/admin/notifications/templates/{kind}/{channel}/{language} [put]
+func UpdateNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	var template notify.Template
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	vars := mux.Vars(r)
+	template.ClinicID = config.ClinicID(r.Context())
+	template.Kind, template.Channel, template.Language = vars["kind"], vars["channel"], vars["language"]
+	if err := template.IsValid(); err != nil {
+		templateError(w, err)
+		return
+	}
+
+	saved, err := notify.SaveTemplate(r.Context(), template)
+	if err != nil {
+		http.Error(w, "Failed to save notification template", http.StatusInternalServerError)
+		log.Printf("Error saving notification template: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// DeleteNotificationTemplate godoc
+// @Summary Restore the default notification text
+// @Description Remove the clinic's template for a notification on a channel in a language, so the default text is sent again
+// @Tags admin
+// @Param kind path string true "Notification kind, e.g. appointment_reminder"
+// @Param channel path string true "email, sms or whatsapp"
+// @Param language path string true "pt-BR, en or es"
+// @Success 204
+// @Failure 404 {object} apierror.Response "Unknown notification kind"
+// @Failure 500 {object} apierror.Response "Failed to delete notification template"
+// @Router /api/v1/admin/notifications/templates/{kind}/{channel}/{language} [delete]
+func DeleteNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := notify.LookupKind(vars["kind"]); err != nil {
+		templateError(w, err)
+		return
+	}
+	if err := notify.DeleteTemplate(r.Context(), config.ClinicID(r.Context()), vars["kind"], vars["channel"], vars["language"]); err != nil {
+		http.Error(w, "Failed to delete notification template", http.StatusInternalServerError)
+		log.Printf("Error deleting notification template: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewNotificationTemplate godoc
+// @Summary Preview a notification template
+// @Description Render a notification with sample data, as the recipient would receive it. Without a body the clinic's current template is rendered; with subject and body a draft is validated and rendered before it is saved. Values in data replace the sample values of the merge fields.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param kind path string true "Notification kind, e.g. appointment_reminder"
+// @Param channel path string true "email, sms or whatsapp"
+// @Param language path string true "pt-BR, en or es"
+// @Param preview body handlers.templatePreview false "Draft and sample data"
+// @Success 200 {object} notify.Message
+// @Failure 400 {object} apierror.Response "Invalid request body or template"
+// @Failure 404 {object} apierror.Response "Unknown notification kind"
+// @Failure 500 {object} apierror.Response "Failed to preview notification template"
+// @Router /api/v1/admin/notifications/templates/{kind}/{channel}/{language}/preview [post]
+func PreviewNotificationTemplate(w http.ResponseWriter, r *http.Request) {
+	var preview templatePreview
+	if err := json.NewDecoder(r.Body).Decode(&preview); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	template, ok := currentTemplate(w, r)
+	if !ok {
+		return
+	}
+	if preview.Body != nil {
+		template.Body = *preview.Body
+		template.Subject = ""
+		if preview.Subject != nil {
+			template.Subject = *preview.Subject
+		}
+		if err := template.IsValid(); err != nil {
+			templateError(w, err)
+			return
+		}
+	}
+
+	kind, _ := notify.LookupKind(template.Kind)
+	data := make(map[string]string, len(kind.Fields))
+	for field, sample := range kind.Fields {
+		data[field] = sample
+	}
+	for field, value := range preview.Data {
+		data[field] = value
+	}
+
+	subject, body := template.Render(data)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notify.Message{
+		To:      "preview",
+		Subject: subject,
+		Body:    body,
+		Kind:    template.Kind,
+		Channel: template.Channel,
+	})
+}
+
+// currentTemplate validates the kind, channel and language of the path and
+// returns the clinic's template for them, writing the error response when
+// it cannot
+func currentTemplate(w http.ResponseWriter, r *http.Request) (notify.Template, bool) {
+	vars := mux.Vars(r)
+	lookup := notify.Template{Kind: vars["kind"], Channel: vars["channel"], Language: vars["language"], Body: "-", Subject: "-"}
+	if err := lookup.IsValid(); err != nil {
+		templateError(w, err)
+		return notify.Template{}, false
+	}
+
+	template, err := notify.GetTemplate(r.Context(), config.ClinicID(r.Context()), lookup.Kind, lookup.Channel, lookup.Language)
+	if err != nil {
+		http.Error(w, "Failed to retrieve notification template", http.StatusInternalServerError)
+		log.Printf("Error fetching notification template: %v", err)
+		return notify.Template{}, false
+	}
+	return template, true
+}
+
+// templateError answers 404 for unknown kinds and 400 for other invalid templates
+func templateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, notify.ErrUnknownKind) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"dental-saas/shared/config"
+	"dental-saas/shared/notify"
+	"dental-saas/shared/paging"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GetOutbox godoc
+// @Summary List the notification outbox
+// @Description List the clinic's notifications queued in the outbox (NOTIFY_QUEUE=outbox), the latest first, with their delivery status, attempts and the error of the last failed attempt. Sent notifications are kept for NOTIFY_OUTBOX_RETENTION.
+// @Tags admin
+// @Produce json
+// @Param status query string false "Only notifications in this status: pending, sent or failed"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Success 200 {array} notify.OutboxMessage
+// @Failure 400 {object} apierror.Response "Invalid status or page"
+// @Failure 500 {object} apierror.Response "Failed to retrieve outbox"
+// @Router /api/v1/admin/notifications/outbox [get]
+func GetOutbox(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains(notify.OutboxStatuses, status) {
+		http.Error(w, "status must be one of "+strings.Join(notify.OutboxStatuses, ", "), http.StatusBadRequest)
+		return
+	}
+	page := paging.Request(r)
+	messages, next, err := notify.OutboxMessages(r.Context(), config.ClinicID(r.Context()), status, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve outbox", http.StatusInternalServerError)
+		log.Printf("Error querying notification outbox: %v", err)
+		return
+	}
+
+	paging.Write(w, page, messages, next)
+}
+
+// GetDeadLetters godoc
+// @Summary List failed notifications
+// @Description List the queued notifications that could not be delivered within NOTIFY_MAX_ATTEMPTS attempts, with the error of the last attempt. Only filled when notifications go through a queue (NOTIFY_QUEUE).
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Success 200 {array} notify.DeadLetter
+// @Failure 400 {object} apierror.Response "Invalid page"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dead letters"
+// @Router /api/v1/admin/notifications/dead-letters [get]
+func GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	page := paging.Request(r)
+	letters, next, err := notify.DeadLetters(r.Context(), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve dead letters", http.StatusInternalServerError)
+		log.Printf("Error scanning notification dead letters: %v", err)
+		return
+	}
+
+	paging.Write(w, page, letters, next)
+}
+
+// RetryDeadLetter godoc
+// @Summary Retry a failed notification
+// @Description Send a failed notification again, through the queue when one is configured, and remove it from the dead letters
+// @Tags admin
+// @Param id path string true "Dead letter ID"
+// @Success 204
+// @Failure 404 {object} apierror.Response "Dead letter not found"
+// @Failure 500 {object} apierror.Response "Failed to retry notification"
+// @Router /api/v1/admin/notifications/dead-letters/{id}/retry [post]
+func RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := notify.RetryDeadLetter(r.Context(), id); err != nil {
+		if errors.Is(err, notify.ErrDeadLetterNotFound) {
+			http.Error(w, "Dead letter not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retry notification", http.StatusInternalServerError)
+		log.Printf("Error retrying notification dead letter %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteDeadLetter godoc
+// @Summary Discard a failed notification
+// @Description Remove a failed notification from the dead letters without sending it
+// @Tags admin
+// @Param id path string true "Dead letter ID"
+// @Success 204
+// @Failure 404 {object} apierror.Response "Dead letter not found"
+// @Failure 500 {object} apierror.Response "Failed to delete dead letter"
+// @Router /api/v1/admin/notifications/dead-letters/{id} [delete]
+func DeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := notify.DeleteDeadLetter(r.Context(), id); err != nil {
+		if errors.Is(err, notify.ErrDeadLetterNotFound) {
+			http.Error(w, "Dead letter not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete dead letter", http.StatusInternalServerError)
+		log.Printf("Error deleting notification dead letter %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSandboxNotifications godoc
+// @Summary List the notifications of a sandbox clinic
+// @Description List the notifications the clinic would have sent, the latest first. Sandbox clinics deliver no email or SMS: each message is recorded here instead, its subject marked [SANDBOX]. Always empty for other clinics.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Success 200 {array} notify.SandboxNotification
+// @Failure 400 {object} apierror.Response "Invalid page"
+// @Failure 500 {object} apierror.Response "Failed to retrieve sandbox notifications"
+// @Router /api/v1/admin/notifications/sandbox [get]
+func GetSandboxNotifications(w http.ResponseWriter, r *http.Request) {
+	page := paging.Request(r)
+	notifications, next, err := notify.SandboxNotifications(r.Context(), config.ClinicID(r.Context()), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve sandbox notifications", http.StatusInternalServerError)
+		log.Printf("Error querying sandbox notifications: %v", err)
+		return
+	}
+
+	paging.Write(w, page, notifications, next)
+}
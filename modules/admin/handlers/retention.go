@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"dental-saas/shared/config"
+	"dental-saas/shared/retention"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// retentionSettings is the retention policy of the clinic together with the purgeable targets
+type retentionSettings struct {
+	retention.Policy
+	Targets []retention.Target `json:"targets"`
+}
+
+// GetRetentionPolicy godoc
+// @Summary Get the data retention policy
+// @Description Get how many days each kind of record is kept before the scheduled purge deletes it, and the kinds of records that can be purged. Targets without a rule are kept forever.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} handlers.retentionSettings
+// @Failure 500 {object} apierror.Response "Failed to retrieve retention policy"
+// @Router /api/v1/admin/retention [get]
+func GetRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := retention.GetPolicy(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve retention policy", http.StatusInternalServerError)
+		log.Printf("Error fetching retention policy: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retentionSettings{Policy: policy, Targets: retention.Targets()})
+}
+
+// UpdateRetentionPolicy godoc
+// @Summary Update the data retention policy
+// @Description Replace the retention rules of the clinic, in days per target (e.g. {"rules":{"cancelled_appointments":730}}). A rule of 0 keeps the records forever.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param policy body retention.Policy true "Retention rules"
+// @Success 200 {object} retention.Policy
+// @Failure 400 {object} apierror.Response "Invalid request body or rules"
+// @Failure 500 {object} apierror.Response "Failed to save retention policy"
+// @Router /api/v1/admin/retention [put]
+func UpdateRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy retention.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy.ClinicID = config.ClinicID(r.Context())
+	if policy.Rules == nil {
+		policy.Rules = map[string]int{}
+	}
+	if err := policy.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := retention.SavePolicy(r.Context(), policy)
+	if err != nil {
+		http.Error(w, "Failed to save retention policy", http.StatusInternalServerError)
+		log.Printf("Error saving retention policy: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// PreviewRetentionPurge godoc
+// @Summary Preview the data retention purge
+// @Description Dry run of the purge: count, per target, the records the current policy would delete without deleting anything
+// @Tags admin
+// @Produce json
+// @Success 200 {object} retention.Report
+// @Failure 500 {object} apierror.Response "Failed to preview retention purge"
+// @Router /api/v1/admin/retention/preview [get]
+func PreviewRetentionPurge(w http.ResponseWriter, r *http.Request) {
+	runRetentionPurge(w, r, true)
+}
+
+// RunRetentionPurge godoc
+// @Summary Run the data retention purge
+// @Description Delete now the records older than the retention policy, as the scheduled purge does
+// @Tags admin
+// @Produce json
+// @Success 200 {object} retention.Report
+// @Failure 500 {object} apierror.Response "Failed to run retention purge"
+// @Router /api/v1/admin/retention/purge [post]
+func RunRetentionPurge(w http.ResponseWriter, r *http.Request) {
+	runRetentionPurge(w, r, false)
+}
+
+func runRetentionPurge(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	report, err := retention.Purge(r.Context(), config.ClinicID(r.Context()), dryRun)
+	if err != nil {
+		message := "Failed to run retention purge"
+		if dryRun {
+			message = "Failed to preview retention purge"
+		}
+		http.Error(w, message, http.StatusInternalServerError)
+		log.Printf("Error running retention purge (dry run %t): %v", dryRun, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
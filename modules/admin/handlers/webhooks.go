@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// GetWebhookEvents godoc
+// @Summary List the webhook events
+// @Description List the events webhook subscriptions can receive
+// @Tags admin
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/v1/admin/webhooks/events [get]
+func GetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks.Events)
+}
+
+// CreateWebhook godoc
+// @Summary Subscribe a URL to events
+// @Description Register a URL that receives the clinic's events (appointment.created, patient.updated, invoice.issued, revenue.paid) as signed JSON posts. The response carries the signing secret, which is not shown again. Plain http URLs are only accepted with WEBHOOK_ALLOW_HTTP.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param subscription body webhooks.Subscription true "URL, events, description and whether it is disabled"
+// @Success 201 {object} webhooks.Subscription
+// @Failure 400 {object} apierror.Response "Invalid request body, URL or events"
+// @Failure 500 {object} apierror.Response "Failed to save webhook"
+// @Router /api/v1/admin/webhooks [post]
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var subscription webhooks.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := subscription.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		http.Error(w, "Failed to save webhook", http.StatusInternalServerError)
+		log.Printf("Error generating webhook secret: %v", err)
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	subscription.ClinicID = config.ClinicID(r.Context())
+	subscription.ID = uuid.NewString()
+	subscription.Secret = secret
+	subscription.CreatedAt = now
+	subscription.UpdatedAt = now
+
+	if err := webhooks.SaveSubscription(r.Context(), subscription, true); err != nil {
+		http.Error(w, "Failed to save webhook", http.StatusInternalServerError)
+		log.Printf("Error saving webhook subscription: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// GetWebhooks godoc
+// @Summary List the webhook subscriptions
+// @Description List the clinic's webhook subscriptions, without their secrets
+// @Tags admin
+// @Produce json
+// @Success 200 {array} webhooks.Subscription
+// @Failure 500 {object} apierror.Response "Failed to retrieve webhooks"
+// @Router /api/v1/admin/webhooks [get]
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := webhooks.Subscriptions(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve webhooks", http.StatusInternalServerError)
+		log.Printf("Error querying webhook subscriptions: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook subscription
+// @Description Get one of the clinic's webhook subscriptions, without its secret
+// @Tags admin
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} webhooks.Subscription
+// @Failure 404 {object} apierror.Response "Webhook not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve webhook"
+// @Router /api/v1/admin/webhooks/{id} [get]
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := loadWebhook(w, r, "Failed to retrieve webhook")
+	if !ok {
+		return
+	}
+	subscription.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// UpdateWebhook godoc
+// @Summary Update a webhook subscription
+// @Description Replace the URL, events, description and disabled flag of a subscription; the secret is kept. Deliveries already recorded go to the URL they were recorded with.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param subscription body webhooks.Subscription true "URL, events, description and whether it is disabled"
+// @Success 200 {object} webhooks.Subscription
+// @Failure 400 {object} apierror.Response "Invalid request body, URL or events"
+// @Failure 404 {object} apierror.Response "Webhook not found"
+// @Failure 500 {object} apierror.Response "Failed to update webhook"
+// @Router /api/v1/admin/webhooks/{id} [put]
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadWebhook(w, r, "Failed to update webhook")
+	if !ok {
+		return
+	}
+
+	var subscription webhooks.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := subscription.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscription.ClinicID = current.ClinicID
+	subscription.ID = current.ID
+	subscription.Secret = current.Secret
+	subscription.CreatedAt = current.CreatedAt
+	subscription.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if !saveWebhook(w, r, subscription, "Failed to update webhook") {
+		return
+	}
+	subscription.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// RotateWebhookSecret godoc
+// @Summary Rotate the secret of a webhook subscription
+// @Description Replace the signing secret of a subscription with a new one, returned in the response. Attempts made from then on are signed with the new secret.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} webhooks.Subscription
+// @Failure 404 {object} apierror.Response "Webhook not found"
+// @Failure 500 {object} apierror.Response "Failed to rotate secret"
+// @Router /api/v1/admin/webhooks/{id}/secret [post]
+func RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := loadWebhook(w, r, "Failed to rotate secret")
+	if !ok {
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		http.Error(w, "Failed to rotate secret", http.StatusInternalServerError)
+		log.Printf("Error generating webhook secret: %v", err)
+		return
+	}
+	subscription.Secret = secret
+	subscription.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if !saveWebhook(w, r, subscription, "Failed to rotate secret") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook subscription
+// @Description Remove a subscription. Its pending deliveries fail; past deliveries stay in the log.
+// @Tags admin
+// @Param id path string true "Subscription ID"
+// @Success 204
+// @Failure 404 {object} apierror.Response "Webhook not found"
+// @Failure 500 {object} apierror.Response "Failed to delete webhook"
+// @Router /api/v1/admin/webhooks/{id} [delete]
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := webhooks.DeleteSubscription(r.Context(), config.ClinicID(r.Context()), id); err != nil {
+		if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		log.Printf("Error deleting webhook subscription %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary List the webhook deliveries
+// @Description List the clinic's webhook deliveries, the latest first, with the payload, status and every attempt with its response status, error and duration. Delivered events are kept for WEBHOOK_DELIVERY_RETENTION.
+// @Tags admin
+// @Produce json
+// @Param subscriptionId query string false "Only the deliveries to this subscription"
+// @Param status query string false "Only deliveries in this status: pending, delivered or failed"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Success 200 {array} webhooks.Delivery
+// @Failure 400 {object} apierror.Response "Invalid status or page"
+// @Failure 500 {object} apierror.Response "Failed to retrieve deliveries"
+// @Router /api/v1/admin/webhooks/deliveries [get]
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && !slices.Contains(webhooks.DeliveryStatuses, status) {
+		http.Error(w, "status must be one of "+strings.Join(webhooks.DeliveryStatuses, ", "), http.StatusBadRequest)
+		return
+	}
+	page := paging.Request(r)
+	deliveries, next, err := webhooks.Deliveries(r.Context(), config.ClinicID(r.Context()), query.Get("subscriptionId"), status, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve deliveries", http.StatusInternalServerError)
+		log.Printf("Error querying webhook deliveries: %v", err)
+		return
+	}
+
+	paging.Write(w, page, deliveries, next)
+}
+
+// GetWebhookDelivery godoc
+// @Summary Get a webhook delivery
+// @Description Get one of the clinic's webhook deliveries with its attempts
+// @Tags admin
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Success 200 {object} webhooks.Delivery
+// @Failure 404 {object} apierror.Response "Delivery not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve delivery"
+// @Router /api/v1/admin/webhooks/deliveries/{id} [get]
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	delivery, err := webhooks.GetDelivery(r.Context(), config.ClinicID(r.Context()), id)
+	if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve delivery", http.StatusInternalServerError)
+		log.Printf("Error fetching webhook delivery %s: %v", id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// RetryWebhookDelivery godoc
+// @Summary Send a webhook delivery again
+// @Description Send a failed or delivered event again to the subscription, with the same payload and event ID and a fresh count of attempts
+// @Tags admin
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Success 200 {object} webhooks.Delivery
+// @Failure 404 {object} apierror.Response "Delivery not found"
+// @Failure 500 {object} apierror.Response "Failed to retry delivery"
+// @Router /api/v1/admin/webhooks/deliveries/{id}/retry [post]
+func RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	delivery, err := webhooks.Redeliver(r.Context(), config.ClinicID(r.Context()), id)
+	if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retry delivery", http.StatusInternalServerError)
+		log.Printf("Error retrying webhook delivery %s: %v", id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// loadWebhook fetches the subscription named in the path, writing the error
+// response when it cannot be returned
+func loadWebhook(w http.ResponseWriter, r *http.Request, failure string) (webhooks.Subscription, bool) {
+	id := mux.Vars(r)["id"]
+	subscription, err := webhooks.GetSubscription(r.Context(), config.ClinicID(r.Context()), id)
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return webhooks.Subscription{}, false
+	}
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("Error fetching webhook subscription %s: %v", id, err)
+		return webhooks.Subscription{}, false
+	}
+	return subscription, true
+}
+
+// saveWebhook writes back an existing subscription, writing the error
+// response when it fails
+func saveWebhook(w http.ResponseWriter, r *http.Request, subscription webhooks.Subscription, failure string) bool {
+	err := webhooks.SaveSubscription(r.Context(), subscription, false)
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("Error saving webhook subscription %s: %v", subscription.ID, err)
+		return false
+	}
+	return true
+}
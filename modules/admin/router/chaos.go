@@ -0,0 +1,17 @@
+//go:build chaos
+
+package router
+
+import (
+	"dental-saas/modules/admin/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// registerChaosRoutes exposes the failure injection API in builds tagged
+// chaos; its handlers only serve operators
+func registerChaosRoutes(adminRouter *mux.Router) {
+	adminRouter.HandleFunc("/chaos", handlers.GetChaos).Methods("GET")
+	adminRouter.HandleFunc("/chaos", handlers.SetChaos).Methods("PUT")
+	adminRouter.HandleFunc("/chaos", handlers.ResetChaos).Methods("DELETE")
+}
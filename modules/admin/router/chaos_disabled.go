@@ -0,0 +1,8 @@
+//go:build !chaos
+
+package router
+
+import "github.com/gorilla/mux"
+
+// registerChaosRoutes registers nothing unless the binary is built with -tags chaos
+func registerChaosRoutes(adminRouter *mux.Router) {}
@@ -0,0 +1,72 @@
+package router
+
+import (
+	"dental-saas/modules/admin/handlers"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/budget"
+
+	"github.com/gorilla/mux"
+)
+
+// NewAdminRouter creates and configures routes for operator/admin endpoints
+func NewAdminRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Create a subrouter for admin module with /api/v1/admin prefix
+	adminRouter := r.PathPrefix("/api/v1/admin").Subrouter()
+	// Exports, purges, policies, queues and webhooks are for admins only
+	adminRouter.Use(auth.Require())
+
+	// Export routes
+	adminRouter.HandleFunc("/export/{table}", handlers.ExportTable).Methods("GET")
+
+	// Counter routes
+	adminRouter.HandleFunc("/counters/reconcile", handlers.ReconcileCounters).Methods("POST")
+
+	// Network policy routes
+	adminRouter.HandleFunc("/network-policy", handlers.GetNetworkPolicy).Methods("GET")
+	adminRouter.HandleFunc("/network-policy", handlers.UpdateNetworkPolicy).Methods("PUT")
+
+	// Letterhead routes
+	adminRouter.HandleFunc("/letterhead", handlers.GetLetterhead).Methods("GET")
+	adminRouter.HandleFunc("/letterhead", handlers.UpdateLetterhead).Methods("PUT")
+
+	// Data retention routes
+	adminRouter.HandleFunc("/retention", handlers.GetRetentionPolicy).Methods("GET")
+	adminRouter.HandleFunc("/retention", handlers.UpdateRetentionPolicy).Methods("PUT")
+	adminRouter.HandleFunc("/retention/preview", handlers.PreviewRetentionPurge).Methods("GET")
+	adminRouter.HandleFunc("/retention/purge", handlers.RunRetentionPurge).Methods("POST")
+
+	// Failed notification routes
+	adminRouter.Handle("/notifications/outbox", budget.ListFunc(handlers.GetOutbox)).Methods("GET")
+	adminRouter.Handle("/notifications/dead-letters", budget.ListFunc(handlers.GetDeadLetters)).Methods("GET")
+	adminRouter.HandleFunc("/notifications/dead-letters/{id}/retry", handlers.RetryDeadLetter).Methods("POST")
+	adminRouter.HandleFunc("/notifications/dead-letters/{id}", handlers.DeleteDeadLetter).Methods("DELETE")
+
+	// Sandbox notification routes
+	adminRouter.Handle("/notifications/sandbox", budget.ListFunc(handlers.GetSandboxNotifications)).Methods("GET")
+
+	// Notification template routes
+	adminRouter.HandleFunc("/notifications/templates", handlers.GetNotificationTemplates).Methods("GET")
+	adminRouter.HandleFunc("/notifications/templates/{kind}/{channel}/{language}", handlers.GetNotificationTemplate).Methods("GET")
+	adminRouter.HandleFunc("/notifications/templates/{kind}/{channel}/{language}", handlers.UpdateNotificationTemplate).Methods("PUT")
+	adminRouter.HandleFunc("/notifications/templates/{kind}/{channel}/{language}", handlers.DeleteNotificationTemplate).Methods("DELETE")
+	adminRouter.HandleFunc("/notifications/templates/{kind}/{channel}/{language}/preview", handlers.PreviewNotificationTemplate).Methods("POST")
+
+	// Webhook routes
+	adminRouter.HandleFunc("/webhooks", handlers.CreateWebhook).Methods("POST")
+	adminRouter.HandleFunc("/webhooks", handlers.GetWebhooks).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/events", handlers.GetWebhookEvents).Methods("GET")
+	adminRouter.Handle("/webhooks/deliveries", budget.ListFunc(handlers.GetWebhookDeliveries)).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/deliveries/{id}", handlers.GetWebhookDelivery).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/deliveries/{id}/retry", handlers.RetryWebhookDelivery).Methods("POST")
+	adminRouter.HandleFunc("/webhooks/{id}", handlers.GetWebhook).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/{id}", handlers.UpdateWebhook).Methods("PUT")
+	adminRouter.HandleFunc("/webhooks/{id}", handlers.DeleteWebhook).Methods("DELETE")
+	adminRouter.HandleFunc("/webhooks/{id}/secret", handlers.RotateWebhookSecret).Methods("POST")
+
+	// Failure injection routes, compiled in only with -tags chaos
+	registerChaosRoutes(adminRouter)
+
+	return r
+}
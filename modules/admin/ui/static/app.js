@@ -0,0 +1,108 @@
+// Renders every panel returned by the overview API and refreshes every 15s.
+// The API is answered to operators only: the access token of an admin of the
+// default clinic, obtained by signing in, is kept for the browser session.
+(function () {
+  var panels = document.getElementById("panels");
+  var login = document.getElementById("login");
+  var tokenKey = "dental-saas-admin-token";
+
+  function text(value) {
+    if (value === null || value === undefined) return "";
+    if (typeof value === "object") return JSON.stringify(value);
+    return String(value);
+  }
+
+  function table(rows) {
+    if (!rows.length) return '<p class="empty">Nothing to show</p>';
+    var columns = Object.keys(rows[0]);
+    var html = "<table><tr>" + columns.map(function (c) { return "<th>" + escape(c) + "</th>"; }).join("") + "</tr>";
+    rows.forEach(function (row) {
+      html += "<tr>" + columns.map(function (c) { return "<td>" + escape(text(row[c])) + "</td>"; }).join("") + "</tr>";
+    });
+    return html + "</table>";
+  }
+
+  function escape(s) {
+    return s.replace(/[&<>"]/g, function (ch) {
+      return { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;" }[ch];
+    });
+  }
+
+  function renderHealth(report) {
+    var rows = Object.keys(report.components || {}).sort().map(function (name) {
+      var c = report.components[name];
+      return { component: name, score: c.score.toFixed(2), weight: c.weight, detail: c.detail };
+    });
+    return '<p class="' + report.status + '">' + report.status + " (" + report.score + "/100)</p>" + table(rows);
+  }
+
+  function renderDeliveries(overview) {
+    return "<p>" + overview.pending + " pending, " + overview.failed + " failed</p>" +
+      table((overview.recent || []).map(function (d) {
+        return { clinic: d.clinic_id, event: d.event, url: d.url, status: d.status, attempts: d.attempts, created: d.created_at };
+      }));
+  }
+
+  function render(data) {
+    panels.innerHTML = "";
+    Object.keys(data).forEach(function (name) {
+      var value = data[name];
+      var body;
+      if (name === "health" && value.components) body = renderHealth(value);
+      else if (name === "webhook_deliveries" && value.recent) body = renderDeliveries(value);
+      else if (Array.isArray(value)) body = table(value);
+      else body = "<pre>" + escape(JSON.stringify(value, null, 2)) + "</pre>";
+
+      var section = document.createElement("section");
+      section.innerHTML = "<h2>" + escape(name) + "</h2>" + body;
+      panels.appendChild(section);
+    });
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  }
+
+  function showLogin(message) {
+    sessionStorage.removeItem(tokenKey);
+    panels.innerHTML = "";
+    document.getElementById("login-error").textContent = message || "";
+    login.hidden = false;
+  }
+
+  function refresh() {
+    var token = sessionStorage.getItem(tokenKey);
+    if (!token) return showLogin();
+    fetch("api/overview", { headers: { Authorization: "Bearer " + token } })
+      .then(function (res) {
+        if (res.status === 401) throw { login: "Your session expired, sign in again" };
+        if (res.status === 403) throw { login: "Only admins of the default clinic can use this panel" };
+        return res.json();
+      })
+      .then(render)
+      .catch(function (err) {
+        if (err.login) return showLogin(err.login);
+        panels.innerHTML = '<p class="degraded">Failed to load: ' + escape(String(err)) + "</p>";
+      });
+  }
+
+  login.addEventListener("submit", function (event) {
+    event.preventDefault();
+    fetch("/api/v1/auth/login", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ email: login.email.value, password: login.password.value })
+    })
+      .then(function (res) {
+        if (!res.ok) throw { login: "Invalid email or password" };
+        return res.json();
+      })
+      .then(function (tokens) {
+        sessionStorage.setItem(tokenKey, tokens.access_token);
+        login.hidden = true;
+        login.password.value = "";
+        refresh();
+      })
+      .catch(function (err) { showLogin(err.login || "Failed to sign in: " + String(err)); });
+  });
+
+  refresh();
+  setInterval(function () { if (login.hidden) refresh(); }, 15000);
+})();
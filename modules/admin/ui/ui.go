@@ -0,0 +1,129 @@
+package ui
+
+import (
+	"context"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/health"
+	"dental-saas/shared/webhooks"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+//go:embed static
+var static embed.FS
+
+// Section produces the data of one panel of the overview page
+type Section func(ctx context.Context) (interface{}, error)
+
+var (
+	sectionsMu sync.RWMutex
+	sections   = map[string]Section{}
+)
+
+// RegisterSection adds a panel to the admin UI overview; modules call it to
+// surface their own operational state (e.g. webhook deliveries)
+func RegisterSection(name string, section Section) {
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	sections[name] = section
+}
+
+func init() {
+	RegisterSection("tenants", func(ctx context.Context) (interface{}, error) {
+		return clinics.List(ctx)
+	})
+	RegisterSection("health", func(ctx context.Context) (interface{}, error) {
+		return health.Evaluate(ctx), nil
+	})
+	RegisterSection("queues", func(ctx context.Context) (interface{}, error) {
+		return health.Backlogs(), nil
+	})
+	RegisterSection("feature_flags", func(ctx context.Context) (interface{}, error) {
+		return config.Features(), nil
+	})
+	RegisterSection("webhook_deliveries", func(ctx context.Context) (interface{}, error) {
+		return webhooks.Overview(ctx)
+	})
+}
+
+// Handler serves the embedded UI and its overview API under /admin. The
+// assets hold no data; the overview API is only answered to operators, whose
+// access token the main router's auth middleware checks.
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		log.Fatalf("Failed to load admin UI assets: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/api/overview", overview)
+	mux.Handle("/admin/", http.StripPrefix("/admin/", http.FileServer(http.FS(assets))))
+	return mux
+}
+
+// overview godoc
+// @Summary Admin UI overview
+// @Description Get the data shown by the embedded admin UI, one entry per registered panel (operators only: admins of the default clinic)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can use the admin UI"
+// @Router /admin/api/overview [get]
+func overview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !operator(w, r) {
+		return
+	}
+
+	sectionsMu.RLock()
+	registered := make(map[string]Section, len(sections))
+	names := make([]string, 0, len(sections))
+	for name, section := range sections {
+		registered[name] = section
+		names = append(names, name)
+	}
+	sectionsMu.RUnlock()
+	sort.Strings(names)
+
+	result := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		data, err := registered[name](r.Context())
+		if err != nil {
+			log.Printf("Error loading admin UI section %s: %v", name, err)
+			result[name] = map[string]string{"error": "Failed to load " + name}
+			continue
+		}
+		result[name] = data
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// operator checks the user is an admin of the default clinic, who operates
+// the deployment
+func operator(w http.ResponseWriter, r *http.Request) bool {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if !claims.Operator() {
+		http.Error(w, "Only admins of the default clinic can use the admin UI", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+// Package checklist builds the daily report of the clinic's open and close
+// checklists, shared by the compliance endpoints and the reception dashboard.
+package checklist
+
+import (
+	"context"
+	"dental-saas/modules/compliance/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Tables holding the checklists and their daily runs, keyed by Date and ChecklistID
+const (
+	ChecklistsTable = "Checklists"
+	RunsTable       = "ChecklistRuns"
+)
+
+// Report summarizes the checklists due on a day, optionally only those of a
+// staff role. A day lists the runs recorded on it plus the checklists that
+// apply to it and existed by then but were not started, as pending.
+func Report(ctx context.Context, day time.Time, role string) (models.ChecklistReport, error) {
+	date := day.Format(models.DateLayout)
+	checklists, err := paging.ScanAll[models.Checklist](ctx, &dynamodb.ScanInput{TableName: aws.String(ChecklistsTable)})
+	if err != nil {
+		return models.ChecklistReport{}, err
+	}
+	runs, err := Runs(ctx, date)
+	if err != nil {
+		return models.ChecklistReport{}, err
+	}
+
+	byChecklist := make(map[string]models.ChecklistRun, len(runs))
+	for _, run := range runs {
+		byChecklist[run.ChecklistID] = run
+	}
+	for _, checklist := range checklists {
+		if _, started := byChecklist[checklist.ID]; started || !checklist.AppliesOn(day) {
+			continue
+		}
+		if created, err := time.Parse(time.RFC3339, checklist.CreatedAt); err == nil && created.Format(models.DateLayout) > date {
+			continue
+		}
+		byChecklist[checklist.ID] = models.NewChecklistRun(checklist, date)
+	}
+
+	report := models.ChecklistReport{Date: date, Checklists: []models.ChecklistRun{}}
+	for _, run := range byChecklist {
+		if role != "" && run.Role != role {
+			continue
+		}
+		report.Total++
+		switch run.Status {
+		case models.ChecklistStatusCompleted:
+			report.Completed++
+		case models.ChecklistStatusPartial:
+			report.Partial++
+		default:
+			report.Pending++
+		}
+		report.Checklists = append(report.Checklists, run)
+	}
+	report.Compliant = report.Completed == report.Total
+
+	// Opening checklists first, then by name
+	sort.Slice(report.Checklists, func(i, j int) bool {
+		a, b := report.Checklists[i], report.Checklists[j]
+		if a.Moment != b.Moment {
+			return a.Moment == models.ChecklistMomentOpen
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
+
+// Runs returns the checklist runs recorded on a date (YYYY-MM-DD)
+func Runs(ctx context.Context, date string) ([]models.ChecklistRun, error) {
+	var runs []models.ChecklistRun
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, &dynamodb.QueryInput{
+		TableName:                 aws.String(RunsTable),
+		KeyConditionExpression:    aws.String("#date = :date"),
+		ExpressionAttributeNames:  map[string]string{"#date": "Date"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":date": &types.AttributeValueMemberS{Value: date}},
+		ConsistentRead:            config.ConsistentRead(ctx),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var pageRuns []models.ChecklistRun
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRuns); err != nil {
+			return nil, err
+		}
+		runs = append(runs, pageRuns...)
+	}
+	return runs, nil
+}
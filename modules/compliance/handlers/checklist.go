@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/compliance/checklist"
+	"dental-saas/modules/compliance/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateChecklist godoc
+// @Summary Create a daily checklist
+// @Description Create an opening or closing routine (e.g. sterilization check, cash count) assigned to a staff role. Items without an ID get one.
+// @Tags checklists
+// @Accept json
+// @Produce json
+// @Param checklist body models.Checklist true "Checklist data"
+// @Success 201 {object} models.Checklist
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 500 {object} apierror.Response "Failed to save checklist"
+// @Router /api/v1/compliance/checklist [post]
+func CreateChecklist(w http.ResponseWriter, r *http.Request) {
+	var c models.Checklist
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	assignItemIDs(&c)
+	if err := c.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.ID = uuid.NewString()
+	c.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	c.UpdatedAt = c.CreatedAt
+
+	if err := putItem(r.Context(), checklist.ChecklistsTable, c, true); err != nil {
+		http.Error(w, "Failed to save checklist", http.StatusInternalServerError)
+		log.Printf("Error saving checklist: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// CreateDefaultChecklists godoc
+// @Summary Create the suggested daily checklists
+// @Description Create the suggested sterilization check, equipment check and cash count checklists, skipping those whose name is already in use, so it can be called again safely
+// @Tags checklists
+// @Produce json
+// @Success 200 {array} models.Checklist "Checklists created"
+// @Failure 500 {object} apierror.Response "Failed to create checklists"
+// @Router /api/v1/compliance/checklist/defaults [post]
+func CreateDefaultChecklists(w http.ResponseWriter, r *http.Request) {
+	existing, err := paging.ScanAll[models.Checklist](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String(checklist.ChecklistsTable),
+	})
+	if err != nil {
+		http.Error(w, "Failed to create checklists", http.StatusInternalServerError)
+		log.Printf("Error scanning checklists: %v", err)
+		return
+	}
+	names := make(map[string]bool, len(existing))
+	for _, c := range existing {
+		names[c.Name] = true
+	}
+
+	created := []models.Checklist{}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, c := range models.DefaultChecklists {
+		if names[c.Name] {
+			continue
+		}
+		c.ID = uuid.NewString()
+		c.Items = append([]models.ChecklistItem(nil), c.Items...)
+		c.CreatedAt = now
+		c.UpdatedAt = now
+		if err := putItem(r.Context(), checklist.ChecklistsTable, c, true); err != nil {
+			http.Error(w, "Failed to create checklists", http.StatusInternalServerError)
+			log.Printf("Error saving checklist %s: %v", c.Name, err)
+			return
+		}
+		created = append(created, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(created)
+}
+
+// GetAllChecklists godoc
+// @Summary List daily checklists
+// @Description List the configured checklists, opening ones first
+// @Tags checklists
+// @Produce json
+// @Param role query string false "Only checklists of this staff role"
+// @Param moment query string false "open or close"
+// @Success 200 {array} models.Checklist
+// @Failure 500 {object} apierror.Response "Failed to retrieve checklists"
+// @Router /api/v1/compliance/checklist [get]
+func GetAllChecklists(w http.ResponseWriter, r *http.Request) {
+	checklists, err := paging.ScanAll[models.Checklist](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String(checklist.ChecklistsTable),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve checklists", http.StatusInternalServerError)
+		log.Printf("Error scanning checklists: %v", err)
+		return
+	}
+
+	query := r.URL.Query()
+	filtered := []models.Checklist{}
+	for _, c := range checklists {
+		if v := query.Get("role"); v != "" && c.Role != v {
+			continue
+		}
+		if v := query.Get("moment"); v != "" && c.Moment != v {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].Moment != filtered[j].Moment {
+			return filtered[i].Moment == models.ChecklistMomentOpen
+		}
+		return filtered[i].Name < filtered[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filtered)
+}
+
+// GetChecklistByID godoc
+// @Summary Get a daily checklist
+// @Description Get a checklist by its ID
+// @Tags checklists
+// @Produce json
+// @Param id path string true "Checklist ID"
+// @Success 200 {object} models.Checklist
+// @Failure 404 {object} apierror.Response "Checklist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve checklist"
+// @Router /api/v1/compliance/checklist/{id} [get]
+func GetChecklistByID(w http.ResponseWriter, r *http.Request) {
+	c, ok := loadChecklist(w, r, "Failed to retrieve checklist")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// UpdateChecklist godoc
+// @Summary Update a daily checklist
+// @Description Update a checklist by its ID. Only the fields sent are changed; items sent replace the current ones. Days already started keep the items they had.
+// @Tags checklists
+// @Accept json
+// @Produce json
+// @Param id path string true "Checklist ID"
+// @Param If-Match header string false "Version of the checklist being changed; required unless the body has it"
+// @Param checklist body models.Checklist true "Checklist data"
+// @Success 200 {object} models.Checklist
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Checklist not found"
+// @Failure 409 {object} apierror.Response "Checklist was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the checklist is required"
+// @Failure 500 {object} apierror.Response "Failed to update checklist"
+// @Router /api/v1/compliance/checklist/{id} [put]
+func UpdateChecklist(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, checklist.ChecklistsTable, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	current, ok := loadChecklist(w, r, "Failed to update checklist")
+	if !ok {
+		return
+	}
+
+	var updatedData models.Checklist
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Name != "" {
+		current.Name = updatedData.Name
+	}
+	if updatedData.Moment != "" {
+		current.Moment = updatedData.Moment
+	}
+	if updatedData.Role != "" {
+		current.Role = updatedData.Role
+	}
+	if updatedData.Weekdays != nil {
+		current.Weekdays = updatedData.Weekdays
+	}
+	if len(updatedData.Items) > 0 {
+		current.Items = updatedData.Items
+		assignItemIDs(&current)
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putItem(r.Context(), checklist.ChecklistsTable, current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Checklist not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update checklist", http.StatusInternalServerError)
+		log.Printf("Error updating checklist: %v", err)
+		return
+	}
+	current.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteChecklist godoc
+// @Summary Delete a daily checklist
+// @Description Delete a checklist by its ID. Days already recorded stay in the reports.
+// @Tags checklists
+// @Param id path string true "Checklist ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Checklist not found"
+// @Failure 500 {object} apierror.Response "Failed to delete checklist"
+// @Router /api/v1/compliance/checklist/{id} [delete]
+func DeleteChecklist(w http.ResponseWriter, r *http.Request) {
+	if err := deleteItem(r.Context(), checklist.ChecklistsTable, mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Checklist not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete checklist", http.StatusInternalServerError)
+		log.Printf("Error deleting checklist: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteChecklist godoc
+// @Summary Check off a daily checklist
+// @Description Record the items of a checklist done on a day by the requesting staff member; sending no items checks them all. Items can be unchecked by sending done false. Future days are refused.
+// @Tags checklists
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string false "Staff member doing the checks"
+// @Param id path string true "Checklist ID"
+// @Param completion body models.ChecklistCompletion false "Day and items checked"
+// @Success 200 {object} models.ChecklistRun
+// @Failure 400 {object} apierror.Response "Invalid request body, date or item"
+// @Failure 404 {object} apierror.Response "Checklist not found"
+// @Failure 409 {object} apierror.Response "Checklist was changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to record checklist"
+// @Router /api/v1/compliance/checklist/{id}/complete [post]
+func CompleteChecklist(w http.ResponseWriter, r *http.Request) {
+	c, ok := loadChecklist(w, r, "Failed to record checklist")
+	if !ok {
+		return
+	}
+
+	var completion models.ChecklistCompletion
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&completion); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now().UTC()
+	date := now.Format(models.DateLayout)
+	if completion.Date != "" {
+		if _, err := time.Parse(models.DateLayout, completion.Date); err != nil {
+			http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		if completion.Date > date {
+			http.Error(w, "Checklists cannot be completed for a future day", http.StatusBadRequest)
+			return
+		}
+		date = completion.Date
+	}
+
+	run, found, err := getChecklistRun(r.Context(), date, c.ID)
+	if err != nil {
+		http.Error(w, "Failed to record checklist", http.StatusInternalServerError)
+		log.Printf("Error fetching checklist %s run of %s: %v", c.ID, date, err)
+		return
+	}
+	if !found {
+		run = models.NewChecklistRun(c, date)
+	}
+	previousUpdatedAt := run.UpdatedAt
+	if err := run.Apply(completion.Items, inbox.User(r), now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := putChecklistRun(r.Context(), run, found, previousUpdatedAt); err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Checklist was changed concurrently, retry", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to record checklist", http.StatusInternalServerError)
+		log.Printf("Error saving checklist %s run of %s: %v", c.ID, date, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetChecklistReport godoc
+// @Summary Get the daily checklist report
+// @Description Report which checklists of a day were completed, partially done or not started, with who checked each item and when. The day is compliant when every checklist due was completed.
+// @Tags checklists
+// @Produce json
+// @Param date query string false "Day (YYYY-MM-DD), defaults to today"
+// @Param role query string false "Only checklists of this staff role"
+// @Success 200 {object} models.ChecklistReport
+// @Failure 400 {object} apierror.Response "Invalid date"
+// @Failure 500 {object} apierror.Response "Failed to build checklist report"
+// @Router /api/v1/compliance/checklist/report [get]
+func GetChecklistReport(w http.ResponseWriter, r *http.Request) {
+	day := time.Now().UTC()
+	if v := r.URL.Query().Get("date"); v != "" {
+		parsed, err := time.Parse(models.DateLayout, v)
+		if err != nil {
+			http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		day = parsed
+	}
+
+	report, err := checklist.Report(r.Context(), day, r.URL.Query().Get("role"))
+	if err != nil {
+		http.Error(w, "Failed to build checklist report", http.StatusInternalServerError)
+		log.Printf("Error building checklist report: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// assignItemIDs gives an ID to the items sent without one
+func assignItemIDs(c *models.Checklist) {
+	for i := range c.Items {
+		if c.Items[i].ID == "" {
+			c.Items[i].ID = uuid.NewString()
+		}
+	}
+}
+
+// loadChecklist fetches the checklist of the request path, writing the error response when it cannot be returned
+func loadChecklist(w http.ResponseWriter, r *http.Request, failure string) (models.Checklist, bool) {
+	c, err := getItem[models.Checklist](r.Context(), checklist.ChecklistsTable, mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Checklist not found", http.StatusNotFound)
+			return c, false
+		}
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("Error fetching checklist: %v", err)
+		return c, false
+	}
+	return c, true
+}
+
+func getChecklistRun(ctx context.Context, date, checklistID string) (models.ChecklistRun, bool, error) {
+	var run models.ChecklistRun
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(checklist.RunsTable),
+		Key: map[string]types.AttributeValue{
+			"Date":        &types.AttributeValueMemberS{Value: date},
+			"ChecklistID": &types.AttributeValueMemberS{Value: checklistID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return run, false, err
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &run)
+	return run, err == nil, err
+}
+
+// putChecklistRun saves a run, failing the condition when another check was
+// recorded since it was read
+func putChecklistRun(ctx context.Context, run models.ChecklistRun, existed bool, previousUpdatedAt string) error {
+	item, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		TableName:                aws.String(checklist.RunsTable),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#date)"),
+		ExpressionAttributeNames: map[string]string{"#date": "Date"},
+	}
+	if existed {
+		input.ConditionExpression = aws.String("UpdatedAt = :previous")
+		input.ExpressionAttributeNames = nil
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":previous": &types.AttributeValueMemberS{Value: previousUpdatedAt},
+		}
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, input)
+	return err
+}
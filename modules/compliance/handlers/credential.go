@@ -0,0 +1,537 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/compliance/models"
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateCredential godoc
+// @Summary Register a license or permit
+// @Description Register a clinic or dentist credential with its expiry date (CRO annuity, sanitary license, radiology permit or other)
+// @Tags compliance
+// @Accept json
+// @Produce json
+// @Param credential body models.Credential true "Credential data"
+// @Success 201 {object} models.Credential
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to save credential"
+// @Router /api/v1/compliance/credential [post]
+func CreateCredential(w http.ResponseWriter, r *http.Request) {
+	var credential models.Credential
+	if err := json.NewDecoder(r.Body).Decode(&credential); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	credential.ID = uuid.NewString()
+	if err := credential.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkHolder(w, r, credential) {
+		return
+	}
+
+	now := time.Now().UTC()
+	credential.CreatedAt = now.Format(time.RFC3339)
+	credential.UpdatedAt = credential.CreatedAt
+
+	if err := putItem(r.Context(), "Credentials", credential, true); err != nil {
+		http.Error(w, "Failed to save credential", http.StatusInternalServerError)
+		log.Printf("Error saving credential: %v", err)
+		return
+	}
+	credential.Evaluate(now, leadDays())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(credential)
+}
+
+// GetAllCredentials godoc
+// @Summary List licenses and permits
+// @Description List the registered credentials with their expiry status, soonest expiry first
+// @Tags compliance
+// @Produce json
+// @Param holderType query string false "clinic or dentist"
+// @Param holderId query string false "Only credentials of this dentist"
+// @Param status query string false "valid, expiring or expired"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Credential
+// @Failure 500 {object} apierror.Response "Failed to retrieve credentials"
+// @Router /api/v1/compliance/credential [get]
+func GetAllCredentials(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page := paging.Request(r)
+	credentials, next, err := paging.Scan[models.Credential](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Credentials"),
+	}, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve credentials", http.StatusInternalServerError)
+		log.Printf("Error scanning credentials: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	lead := leadDays()
+	filtered := []models.Credential{}
+	for _, credential := range credentials {
+		if v := query.Get("holderType"); v != "" && credential.HolderType != v {
+			continue
+		}
+		if v := query.Get("holderId"); v != "" && credential.HolderID != v {
+			continue
+		}
+		credential.Evaluate(now, lead)
+		if v := query.Get("status"); v != "" && credential.Status != v {
+			continue
+		}
+		filtered = append(filtered, credential)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].ExpiresAt < filtered[j].ExpiresAt
+	})
+
+	paging.Write(w, page, filtered, next)
+}
+
+// GetCredentialByID godoc
+// @Summary Get a license or permit
+// @Description Get a credential by its ID with its expiry status
+// @Tags compliance
+// @Produce json
+// @Param id path string true "Credential ID"
+// @Success 200 {object} models.Credential
+// @Failure 404 {object} apierror.Response "Credential not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve credential"
+// @Router /api/v1/compliance/credential/{id} [get]
+func GetCredentialByID(w http.ResponseWriter, r *http.Request) {
+	credential, err := getItem[models.Credential](r.Context(), "Credentials", mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve credential", http.StatusInternalServerError)
+		log.Printf("Error fetching credential: %v", err)
+		return
+	}
+	credential.Evaluate(time.Now().UTC(), leadDays())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credential)
+}
+
+// UpdateCredential godoc
+// @Summary Update a license or permit
+// @Description Update a credential by its ID, e.g. to record a renewal with the new number and expiry date. Only the fields sent are changed.
+// @Tags compliance
+// @Accept json
+// @Produce json
+// @Param id path string true "Credential ID"
+// @Param If-Match header string false "Version of the credential being changed; required unless the body has it"
+// @Param credential body models.Credential true "Credential data"
+// @Success 200 {object} models.Credential
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Credential not found"
+// @Failure 409 {object} apierror.Response "Credential was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the credential is required"
+// @Failure 500 {object} apierror.Response "Failed to update credential"
+// @Router /api/v1/compliance/credential/{id} [put]
+func UpdateCredential(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Credentials", id)
+	if !ok {
+		return
+	}
+	current, err := getItem[models.Credential](r.Context(), "Credentials", id)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update credential", http.StatusInternalServerError)
+		log.Printf("Error fetching credential: %v", err)
+		return
+	}
+
+	var updatedData models.Credential
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Name != "" {
+		current.Name = updatedData.Name
+	}
+	if updatedData.Number != "" {
+		current.Number = updatedData.Number
+	}
+	if updatedData.Issuer != "" {
+		current.Issuer = updatedData.Issuer
+	}
+	if updatedData.IssuedAt != "" {
+		current.IssuedAt = updatedData.IssuedAt
+	}
+	if updatedData.ExpiresAt != "" && updatedData.ExpiresAt != current.ExpiresAt {
+		// A renewal starts a new alert cycle
+		current.ExpiresAt = updatedData.ExpiresAt
+		current.AlertSentFor = ""
+	}
+	if updatedData.Responsible != "" {
+		current.Responsible = updatedData.Responsible
+	}
+	if updatedData.Notes != "" {
+		current.Notes = updatedData.Notes
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	current.UpdatedAt = now.Format(time.RFC3339)
+
+	if err := putItem(r.Context(), "Credentials", current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update credential", http.StatusInternalServerError)
+		log.Printf("Error updating credential: %v", err)
+		return
+	}
+	current.Version = version + 1
+	current.Evaluate(now, leadDays())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteCredential godoc
+// @Summary Delete a license or permit
+// @Description Delete a credential by its ID
+// @Tags compliance
+// @Param id path string true "Credential ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Credential not found"
+// @Failure 500 {object} apierror.Response "Failed to delete credential"
+// @Router /api/v1/compliance/credential/{id} [delete]
+func DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	if err := deleteItem(r.Context(), "Credentials", mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Credential not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete credential", http.StatusInternalServerError)
+		log.Printf("Error deleting credential: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetComplianceStatus godoc
+// @Summary Get the compliance status of the clinic
+// @Description Summarize expired, expiring and missing credentials. The clinic must hold a sanitary license and a radiology permit, and every dentist a CRO annuity. When a credential was renewed only the latest expiry counts.
+// @Tags compliance
+// @Produce json
+// @Param leadDays query int false "Days before expiry a credential counts as expiring (default COMPLIANCE_LEAD_DAYS)"
+// @Success 200 {object} models.ComplianceStatus
+// @Failure 400 {object} apierror.Response "Invalid leadDays"
+// @Failure 500 {object} apierror.Response "Failed to build compliance status"
+// @Router /api/v1/compliance/status [get]
+func GetComplianceStatus(w http.ResponseWriter, r *http.Request) {
+	lead := leadDays()
+	if v := r.URL.Query().Get("leadDays"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			http.Error(w, "leadDays must be a non-negative number of days", http.StatusBadRequest)
+			return
+		}
+		lead = days
+	}
+
+	credentials, err := currentCredentials(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to build compliance status", http.StatusInternalServerError)
+		log.Printf("Error scanning credentials: %v", err)
+		return
+	}
+	dentists, err := paging.ScanAll[dentalmodels.Dentist](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Dentists"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build compliance status", http.StatusInternalServerError)
+		log.Printf("Error scanning dentists for compliance status: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	status := models.ComplianceStatus{
+		Date:        now.Format(models.DateLayout),
+		LeadDays:    lead,
+		Missing:     []models.MissingCredential{},
+		Credentials: []models.Credential{},
+	}
+
+	held := make(map[string]bool)
+	for _, credential := range credentials {
+		credential.Evaluate(now, lead)
+		switch credential.Status {
+		case models.StatusExpired:
+			status.Expired++
+		case models.StatusExpiring:
+			status.Expiring++
+		default:
+			status.Valid++
+		}
+		held[credential.HolderType+"|"+credential.HolderID+"|"+credential.Type] = true
+		status.Credentials = append(status.Credentials, credential)
+	}
+
+	for _, requirement := range models.ClinicRequirements {
+		if !held[models.HolderClinic+"||"+requirement] {
+			status.Missing = append(status.Missing, models.MissingCredential{
+				HolderType: models.HolderClinic,
+				Type:       requirement,
+			})
+		}
+	}
+	sort.Slice(dentists, func(i, j int) bool {
+		return dentists[i].Name < dentists[j].Name
+	})
+	for _, dentist := range dentists {
+		for _, requirement := range models.DentistRequirements {
+			if !held[models.HolderDentist+"|"+dentist.ID+"|"+requirement] {
+				status.Missing = append(status.Missing, models.MissingCredential{
+					HolderType: models.HolderDentist,
+					HolderID:   dentist.ID,
+					HolderName: dentist.Name,
+					Type:       requirement,
+				})
+			}
+		}
+	}
+
+	switch {
+	case status.Expired > 0 || len(status.Missing) > 0:
+		status.Status = models.ComplianceViolation
+	case status.Expiring > 0:
+		status.Status = models.ComplianceAttention
+	default:
+		status.Status = models.ComplianceOK
+	}
+	sort.SliceStable(status.Credentials, func(i, j int) bool {
+		return status.Credentials[i].ExpiresAt < status.Credentials[j].ExpiresAt
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// SendExpiryAlerts notifies, through the notification inbox, the staff member
+// responsible for each credential expiring within leadDays, and again once it
+// has expired. Credentials without a responsible member go to
+// COMPLIANCE_ALERT_RECIPIENT. Returns how many alerts were sent.
+func SendExpiryAlerts(ctx context.Context, leadDays int) (int, error) {
+	sent := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := sendClinicExpiryAlerts(ctx, leadDays)
+		sent += n
+		return err
+	})
+	return sent, err
+}
+
+// sendClinicExpiryAlerts sends the expiry alerts of the clinic of ctx
+func sendClinicExpiryAlerts(ctx context.Context, leadDays int) (int, error) {
+	credentials, err := currentCredentials(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("scanning credentials: %v", err)
+	}
+
+	fallback := os.Getenv("COMPLIANCE_ALERT_RECIPIENT")
+	now := time.Now().UTC()
+	sent := 0
+	for _, credential := range credentials {
+		credential.Evaluate(now, leadDays)
+		if credential.Status == models.StatusValid {
+			continue
+		}
+		recipient := credential.Responsible
+		if recipient == "" {
+			recipient = fallback
+		}
+		if recipient == "" {
+			continue
+		}
+		stage := credential.Status + ":" + credential.ExpiresAt
+		if credential.AlertSentFor == stage {
+			continue
+		}
+
+		// Claim the alert first so concurrent instances send it once
+		updateCtx, cancel := config.DBContext(ctx)
+		_, err := config.DBClient.UpdateItem(updateCtx, &dynamodb.UpdateItemInput{
+			TableName: aws.String("Credentials"),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: credential.ID},
+			},
+			UpdateExpression:    aws.String("SET AlertSentFor = :stage"),
+			ConditionExpression: aws.String("attribute_exists(ID) AND (attribute_not_exists(AlertSentFor) OR AlertSentFor <> :stage)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":stage": &types.AttributeValueMemberS{Value: stage},
+			},
+		})
+		cancel()
+		if err != nil {
+			var cfe *types.ConditionalCheckFailedException
+			if !errors.As(err, &cfe) {
+				log.Printf("Error marking expiry alert of credential %s: %v", credential.ID, err)
+			}
+			continue
+		}
+
+		excerpt := fmt.Sprintf("%s expires on %s", credentialLabel(credential), credential.ExpiresAt)
+		if credential.Status == models.StatusExpired {
+			excerpt = fmt.Sprintf("%s expired on %s", credentialLabel(credential), credential.ExpiresAt)
+		}
+		if err := inbox.Notify(ctx, inbox.Notification{
+			Recipient:  recipient,
+			Kind:       "credential_" + credential.Status,
+			SourceType: "credential",
+			SourceID:   credential.ID,
+			Excerpt:    excerpt,
+		}); err != nil {
+			log.Printf("Error notifying expiry of credential %s: %v", credential.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// StartExpiryAlerts sends credential expiry alerts once at startup and then every interval
+func StartExpiryAlerts(ctx context.Context, interval time.Duration, leadDays int) {
+	if interval <= 0 {
+		return
+	}
+	alert := func() {
+		n, err := SendExpiryAlerts(ctx, leadDays)
+		if err != nil {
+			log.Printf("Error sending credential expiry alerts: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Sent %d credential expiry alerts", n)
+		}
+	}
+
+	go func() {
+		alert()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				alert()
+			}
+		}
+	}()
+}
+
+// currentCredentials returns, for each holder and credential type, only the
+// credential with the latest expiry, so renewals supersede the old record
+func currentCredentials(ctx context.Context) ([]models.Credential, error) {
+	credentials, err := paging.ScanAll[models.Credential](ctx, &dynamodb.ScanInput{
+		TableName: aws.String("Credentials"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]models.Credential)
+	for _, credential := range credentials {
+		key := credential.HolderType + "|" + credential.HolderID + "|" + credential.Type
+		if credential.Type == models.CredentialOther {
+			key += "|" + credential.Name
+		}
+		if prev, ok := latest[key]; !ok || credential.ExpiresAt > prev.ExpiresAt {
+			latest[key] = credential
+		}
+	}
+
+	current := make([]models.Credential, 0, len(latest))
+	for _, credential := range latest {
+		current = append(current, credential)
+	}
+	return current, nil
+}
+
+// checkHolder verifies that the dentist of a dentist credential exists,
+// writing the error response when it does not
+func checkHolder(w http.ResponseWriter, r *http.Request, credential models.Credential) bool {
+	if credential.HolderType != models.HolderDentist {
+		return true
+	}
+	if _, err := getItem[dentalmodels.Dentist](r.Context(), "Dentists", credential.HolderID); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Dentist not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Failed to save credential", http.StatusInternalServerError)
+		log.Printf("Error fetching dentist %s: %v", credential.HolderID, err)
+		return false
+	}
+	return true
+}
+
+// credentialLabel describes a credential in alert messages
+func credentialLabel(credential models.Credential) string {
+	label := credential.Type
+	if credential.Name != "" {
+		label = credential.Name
+	}
+	if credential.Number != "" {
+		label += " " + credential.Number
+	}
+	return label
+}
+
+// leadDays is how many days before expiry a credential counts as expiring
+func leadDays() int {
+	return config.EnvInt("COMPLIANCE_LEAD_DAYS", 30)
+}
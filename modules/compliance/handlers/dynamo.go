@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// errNotFound is returned by getItem, putItem and deleteItem when the item does not exist
+var errNotFound = errors.New("item not found")
+
+// getItem fetches the item with the given ID into T
+func getItem[T any](ctx context.Context, tableName, id string) (T, error) {
+	var v T
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		return v, err
+	}
+	if result.Item == nil {
+		return v, errNotFound
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &v)
+	return v, err
+}
+
+// putItem creates (create) or replaces an item, mapping a failed condition
+// to errNotFound so updates of missing items report 404
+func putItem(ctx context.Context, tableName string, v any, create bool) error {
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	err = config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	}, create)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return errNotFound
+	}
+	return err
+}
+
+// deleteItem deletes the item with the given ID
+func deleteItem(ctx context.Context, tableName, id string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return errNotFound
+	}
+	return err
+}
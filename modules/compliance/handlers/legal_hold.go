@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/legalhold"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// releaseRequest is the body of a legal hold release
+type releaseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// PlaceLegalHold godoc
+// @Summary Place a legal hold
+// @Description Place a patient, with every record linked to them, and/or a set of records under legal hold. Held records cannot be deleted, erased or purged by retention until the hold is released. The staff member placing the hold (X-User-ID) is recorded in its history.
+// @Tags compliance
+// @Accept json
+// @Produce json
+// @Param hold body legalhold.Hold true "Patient ID and/or records, with the reason"
+// @Success 201 {object} legalhold.Hold
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 500 {object} apierror.Response "Failed to place legal hold"
+// @Router /api/v1/compliance/legal-hold [post]
+func PlaceLegalHold(w http.ResponseWriter, r *http.Request) {
+	var hold legalhold.Hold
+	if err := json.NewDecoder(r.Body).Decode(&hold); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := hold.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	placed, err := legalhold.Place(r.Context(), hold, inbox.User(r))
+	if err != nil {
+		http.Error(w, "Failed to place legal hold", http.StatusInternalServerError)
+		log.Printf("Error placing legal hold: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(placed)
+}
+
+// GetLegalHolds godoc
+// @Summary List legal holds
+// @Description List legal holds, newest first
+// @Tags compliance
+// @Produce json
+// @Param status query string false "active or released (default: all)"
+// @Success 200 {array} legalhold.Hold
+// @Failure 400 {object} apierror.Response "Invalid status"
+// @Failure 500 {object} apierror.Response "Failed to retrieve legal holds"
+// @Router /api/v1/compliance/legal-hold [get]
+func GetLegalHolds(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != legalhold.StatusActive && status != legalhold.StatusReleased {
+		http.Error(w, "status must be active or released", http.StatusBadRequest)
+		return
+	}
+
+	holds, err := legalhold.List(r.Context(), status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve legal holds", http.StatusInternalServerError)
+		log.Printf("Error scanning legal holds: %v", err)
+		return
+	}
+	if holds == nil {
+		holds = []legalhold.Hold{}
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		return holds[i].PlacedAt > holds[j].PlacedAt
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
+
+// GetLegalHoldByID godoc
+// @Summary Get a legal hold
+// @Description Get a legal hold by its ID, with the history of who placed and released it
+// @Tags compliance
+// @Produce json
+// @Param id path string true "Legal hold ID"
+// @Success 200 {object} legalhold.Hold
+// @Failure 404 {object} apierror.Response "Legal hold not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve legal hold"
+// @Router /api/v1/compliance/legal-hold/{id} [get]
+func GetLegalHoldByID(w http.ResponseWriter, r *http.Request) {
+	hold, err := legalhold.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, legalhold.ErrHoldNotFound) {
+			http.Error(w, "Legal hold not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve legal hold", http.StatusInternalServerError)
+		log.Printf("Error fetching legal hold: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// ReleaseLegalHold godoc
+// @Summary Release a legal hold
+// @Description Lift an active legal hold so its records can be deleted and purged again. The staff member releasing it (X-User-ID) and the reason are recorded in its history.
+// @Tags compliance
+// @Accept json
+// @Produce json
+// @Param id path string true "Legal hold ID"
+// @Param release body handlers.releaseRequest true "Reason for the release"
+// @Success 200 {object} legalhold.Hold
+// @Failure 400 {object} apierror.Response "Invalid request body or missing reason"
+// @Failure 404 {object} apierror.Response "Legal hold not found"
+// @Failure 409 {object} apierror.Response "Legal hold already released"
+// @Failure 500 {object} apierror.Response "Failed to release legal hold"
+// @Router /api/v1/compliance/legal-hold/{id}/release [post]
+func ReleaseLegalHold(w http.ResponseWriter, r *http.Request) {
+	var req releaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	hold, err := legalhold.Release(r.Context(), mux.Vars(r)["id"], inbox.User(r), req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, legalhold.ErrHoldNotFound):
+			http.Error(w, "Legal hold not found", http.StatusNotFound)
+		case errors.Is(err, legalhold.ErrAlreadyReleased):
+			http.Error(w, "Legal hold already released", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to release legal hold", http.StatusInternalServerError)
+			log.Printf("Error releasing legal hold: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
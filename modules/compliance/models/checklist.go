@@ -0,0 +1,242 @@
+package models
+
+import (
+	staffmodels "dental-saas/modules/staff/models"
+	"fmt"
+	"time"
+)
+
+// Momento do dia em que um checklist é feito
+const (
+	ChecklistMomentOpen  = "open"  // abertura da clínica
+	ChecklistMomentClose = "close" // fechamento da clínica
+)
+
+// Situação do checklist em um dia
+const (
+	ChecklistStatusPending   = "pending"
+	ChecklistStatusPartial   = "partial"
+	ChecklistStatusCompleted = "completed"
+)
+
+// ChecklistItem é uma verificação de um checklist
+type ChecklistItem struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// Checklist representa uma rotina diária de abertura ou fechamento atribuída a uma função da equipe
+type Checklist struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Moment   string          `json:"moment"`
+	Role     string          `json:"role"`                                       // função da equipe responsável (receptionist, assistant...)
+	Weekdays []int           `json:"weekdays,omitempty" dynamodbav:",omitempty"` // 0 = domingo; vazio = todos os dias
+	Items    []ChecklistItem `json:"items"`
+
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	Version   int64  `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica se os campos obrigatórios do checklist estão preenchidos
+func (c *Checklist) IsValid() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if c.Moment != ChecklistMomentOpen && c.Moment != ChecklistMomentClose {
+		return fmt.Errorf("moment must be open or close")
+	}
+	switch c.Role {
+	case staffmodels.RoleAssistant, staffmodels.RoleHygienist, staffmodels.RoleReceptionist, staffmodels.RoleManager, staffmodels.RoleDentist:
+	default:
+		return fmt.Errorf("role must be one of assistant, hygienist, receptionist, manager or dentist")
+	}
+	for _, day := range c.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	if len(c.Items) == 0 {
+		return fmt.Errorf("at least one item is required")
+	}
+	seen := make(map[string]bool)
+	for _, item := range c.Items {
+		if item.Label == "" {
+			return fmt.Errorf("every item needs a label")
+		}
+		if item.ID != "" && seen[item.ID] {
+			return fmt.Errorf("duplicate item ID %q", item.ID)
+		}
+		seen[item.ID] = true
+	}
+	return nil
+}
+
+// AppliesOn indica se o checklist deve ser feito no dia
+func (c *Checklist) AppliesOn(day time.Time) bool {
+	if len(c.Weekdays) == 0 {
+		return true
+	}
+	for _, weekday := range c.Weekdays {
+		if time.Weekday(weekday) == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultChecklists são as rotinas sugeridas para uma clínica nova
+var DefaultChecklists = []Checklist{
+	{
+		Name:   "Sterilization check",
+		Moment: ChecklistMomentOpen,
+		Role:   staffmodels.RoleAssistant,
+		Items: []ChecklistItem{
+			{ID: "autoclave-cycle", Label: "Autoclave test cycle passed and recorded"},
+			{ID: "indicator", Label: "Biological/chemical indicator checked"},
+			{ID: "kits-sealed", Label: "Instrument kits sealed and dated"},
+		},
+	},
+	{
+		Name:   "Equipment check",
+		Moment: ChecklistMomentOpen,
+		Role:   staffmodels.RoleAssistant,
+		Items: []ChecklistItem{
+			{ID: "chairs", Label: "Dental chairs and suction working"},
+			{ID: "compressor", Label: "Compressor drained and pressure normal"},
+			{ID: "xray", Label: "X-ray unit powered on and warmed up"},
+		},
+	},
+	{
+		Name:   "Cash count",
+		Moment: ChecklistMomentClose,
+		Role:   staffmodels.RoleReceptionist,
+		Items: []ChecklistItem{
+			{ID: "cash", Label: "Cash counted and matches the day's receipts"},
+			{ID: "card", Label: "Card terminal batch closed"},
+			{ID: "safe", Label: "Cash stored in the safe"},
+		},
+	},
+}
+
+// ChecklistRunItem é uma verificação de um checklist em um dia
+type ChecklistRunItem struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Done   bool   `json:"done"`
+	DoneBy string `json:"done_by,omitempty" dynamodbav:",omitempty"` // membro da equipe que marcou
+	DoneAt string `json:"done_at,omitempty" dynamodbav:",omitempty"`
+	Notes  string `json:"notes,omitempty" dynamodbav:",omitempty"`
+}
+
+// ChecklistRun representa a execução de um checklist em um dia. Nome,
+// função e itens são copiados do checklist quando o dia começa a ser
+// preenchido, para que mudanças posteriores não alterem o histórico.
+type ChecklistRun struct {
+	Date        string             `json:"date"` // YYYY-MM-DD
+	ChecklistID string             `json:"checklist_id"`
+	Name        string             `json:"name"`
+	Moment      string             `json:"moment"`
+	Role        string             `json:"role"`
+	Items       []ChecklistRunItem `json:"items"`
+	Status      string             `json:"status"`
+	CompletedAt string             `json:"completed_at,omitempty" dynamodbav:",omitempty"`
+	UpdatedAt   string             `json:"updated_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// NewChecklistRun cria a execução ainda não preenchida de um checklist no dia
+func NewChecklistRun(checklist Checklist, date string) ChecklistRun {
+	run := ChecklistRun{
+		Date:        date,
+		ChecklistID: checklist.ID,
+		Name:        checklist.Name,
+		Moment:      checklist.Moment,
+		Role:        checklist.Role,
+		Items:       make([]ChecklistRunItem, 0, len(checklist.Items)),
+		Status:      ChecklistStatusPending,
+	}
+	for _, item := range checklist.Items {
+		run.Items = append(run.Items, ChecklistRunItem{ID: item.ID, Label: item.Label})
+	}
+	return run
+}
+
+// ChecklistCheck marca ou desmarca uma verificação
+type ChecklistCheck struct {
+	ItemID string `json:"item_id"`
+	Done   bool   `json:"done"`
+	Notes  string `json:"notes,omitempty"`
+}
+
+// ChecklistCompletion é o preenchimento de um checklist; sem itens, todas as verificações são marcadas
+type ChecklistCompletion struct {
+	Date  string           `json:"date,omitempty"` // YYYY-MM-DD, padrão: hoje
+	Items []ChecklistCheck `json:"items,omitempty"`
+}
+
+// Apply registra as verificações feitas por user e atualiza a situação do checklist
+func (run *ChecklistRun) Apply(checks []ChecklistCheck, user string, now time.Time) error {
+	if len(checks) == 0 {
+		for _, item := range run.Items {
+			checks = append(checks, ChecklistCheck{ItemID: item.ID, Done: true})
+		}
+	}
+	stamp := now.Format(time.RFC3339)
+	for _, check := range checks {
+		found := false
+		for i := range run.Items {
+			item := &run.Items[i]
+			if item.ID != check.ItemID {
+				continue
+			}
+			found = true
+			if check.Notes != "" {
+				item.Notes = check.Notes
+			}
+			if check.Done == item.Done {
+				break
+			}
+			item.Done = check.Done
+			item.DoneBy, item.DoneAt = "", ""
+			if check.Done {
+				item.DoneBy, item.DoneAt = user, stamp
+			}
+			break
+		}
+		if !found {
+			return fmt.Errorf("unknown item %q", check.ItemID)
+		}
+	}
+
+	done := 0
+	for _, item := range run.Items {
+		if item.Done {
+			done++
+		}
+	}
+	switch {
+	case done == len(run.Items):
+		run.Status = ChecklistStatusCompleted
+		if run.CompletedAt == "" {
+			run.CompletedAt = stamp
+		}
+	case done > 0:
+		run.Status, run.CompletedAt = ChecklistStatusPartial, ""
+	default:
+		run.Status, run.CompletedAt = ChecklistStatusPending, ""
+	}
+	run.UpdatedAt = stamp
+	return nil
+}
+
+// ChecklistReport resume os checklists de um dia
+type ChecklistReport struct {
+	Date       string         `json:"date"`
+	Total      int            `json:"total"`
+	Completed  int            `json:"completed"`
+	Partial    int            `json:"partial"`
+	Pending    int            `json:"pending"`
+	Compliant  bool           `json:"compliant"` // todos os checklists do dia concluídos
+	Checklists []ChecklistRun `json:"checklists"`
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Titulares de credenciais: a própria clínica ou um dentista
+const (
+	HolderClinic  = "clinic"
+	HolderDentist = "dentist"
+)
+
+// Tipos de credenciais acompanhados
+const (
+	CredentialCROAnnuity      = "cro_annuity"      // anuidade do CRO do dentista
+	CredentialSanitaryLicense = "sanitary_license" // licença da vigilância sanitária
+	CredentialRadiologyPermit = "radiology_permit" // alvará de radiologia
+	CredentialOther           = "other"
+)
+
+// Situação de uma credencial em relação à validade
+const (
+	StatusValid    = "valid"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+)
+
+// Situação geral de conformidade da clínica
+const (
+	ComplianceOK        = "compliant"
+	ComplianceAttention = "attention"     // há credenciais perto do vencimento
+	ComplianceViolation = "non_compliant" // há credenciais vencidas ou faltando
+)
+
+// DateLayout é o formato das datas de emissão e validade
+const DateLayout = "2006-01-02"
+
+// ClinicRequirements são as credenciais que a clínica precisa manter em dia
+var ClinicRequirements = []string{CredentialSanitaryLicense, CredentialRadiologyPermit}
+
+// DentistRequirements são as credenciais que cada dentista precisa manter em dia
+var DentistRequirements = []string{CredentialCROAnnuity}
+
+// Credential representa uma licença, alvará ou registro com data de validade
+type Credential struct {
+	ID          string `json:"id"`
+	HolderType  string `json:"holder_type"`
+	HolderID    string `json:"holder_id,omitempty"` // ID do dentista, quando HolderType é dentist
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"` // descrição livre, obrigatória para o tipo other
+	Number      string `json:"number,omitempty"`
+	Issuer      string `json:"issuer,omitempty"` // órgão emissor (CRO, vigilância sanitária, CNEN...)
+	IssuedAt    string `json:"issued_at,omitempty"`
+	ExpiresAt   string `json:"expires_at"`
+	Responsible string `json:"responsible,omitempty" dynamodbav:",omitempty"` // membro da equipe avisado do vencimento
+	Notes       string `json:"notes,omitempty"`
+
+	// Último aviso enviado, no formato <situação>:<validade>, para não repetir alertas
+	AlertSentFor string `json:"-" dynamodbav:",omitempty"`
+
+	// Calculado na leitura, não persistido
+	Status          string `json:"status,omitempty" dynamodbav:"-"`
+	DaysUntilExpiry *int   `json:"days_until_expiry,omitempty" dynamodbav:"-"`
+
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	Version   int64  `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica se os campos obrigatórios da credencial estão preenchidos
+func (c *Credential) IsValid() error {
+	switch c.HolderType {
+	case HolderClinic:
+		if c.HolderID != "" {
+			return fmt.Errorf("holder ID must be empty for clinic credentials")
+		}
+	case HolderDentist:
+		if c.HolderID == "" {
+			return fmt.Errorf("holder ID is required for dentist credentials")
+		}
+	default:
+		return fmt.Errorf("holder type must be clinic or dentist")
+	}
+	switch c.Type {
+	case CredentialCROAnnuity, CredentialSanitaryLicense, CredentialRadiologyPermit:
+	case CredentialOther:
+		if c.Name == "" {
+			return fmt.Errorf("name is required for other credentials")
+		}
+	default:
+		return fmt.Errorf("type must be one of cro_annuity, sanitary_license, radiology_permit or other")
+	}
+	if c.Type == CredentialCROAnnuity && c.HolderType != HolderDentist {
+		return fmt.Errorf("CRO annuity must belong to a dentist")
+	}
+	expires, err := time.Parse(DateLayout, c.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("expires at must be in YYYY-MM-DD format")
+	}
+	if c.IssuedAt != "" {
+		issued, err := time.Parse(DateLayout, c.IssuedAt)
+		if err != nil {
+			return fmt.Errorf("issued at must be in YYYY-MM-DD format")
+		}
+		if !expires.After(issued) {
+			return fmt.Errorf("expires at must be after issued at")
+		}
+	}
+	return nil
+}
+
+// Evaluate preenche Status e DaysUntilExpiry na data informada; credenciais que
+// vencem em até leadDays dias ficam como expiring
+func (c *Credential) Evaluate(today time.Time, leadDays int) {
+	expires, err := time.Parse(DateLayout, c.ExpiresAt)
+	if err != nil {
+		return
+	}
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(expires.Sub(today).Hours() / 24)
+	c.DaysUntilExpiry = &days
+
+	switch {
+	case days < 0:
+		c.Status = StatusExpired
+	case days <= leadDays:
+		c.Status = StatusExpiring
+	default:
+		c.Status = StatusValid
+	}
+}
+
+// MissingCredential aponta uma credencial exigida que não está cadastrada
+type MissingCredential struct {
+	HolderType string `json:"holder_type"`
+	HolderID   string `json:"holder_id,omitempty"`
+	HolderName string `json:"holder_name,omitempty"`
+	Type       string `json:"type"`
+}
+
+// ComplianceStatus resume a conformidade da clínica e de seus dentistas
+type ComplianceStatus struct {
+	Status      string              `json:"status"`
+	Date        string              `json:"date"`
+	LeadDays    int                 `json:"lead_days"`
+	Valid       int                 `json:"valid"`
+	Expiring    int                 `json:"expiring"`
+	Expired     int                 `json:"expired"`
+	Missing     []MissingCredential `json:"missing"`
+	Credentials []Credential        `json:"credentials"` // expiradas e a vencer primeiro
+}
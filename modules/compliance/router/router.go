@@ -0,0 +1,49 @@
+package router
+
+import (
+	"dental-saas/modules/compliance/handlers"
+	"dental-saas/modules/compliance/models"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/budget"
+	"dental-saas/shared/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// NewComplianceRouter creates and configures routes for the compliance module
+func NewComplianceRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Create a subrouter for compliance module with /api/v1/compliance prefix
+	complianceRouter := r.PathPrefix("/api/v1/compliance").Subrouter()
+
+	// Credential routes
+	complianceRouter.Handle("/credential", auth.RequireFunc(handlers.CreateCredential, auth.RoleAdmin)).Methods("POST")
+	complianceRouter.Handle("/credential", budget.ListFunc(handlers.GetAllCredentials)).Methods("GET")
+	complianceRouter.HandleFunc("/credential/$schema", schema.Handler("Credential", models.Credential{}, "holder_type", "type", "expires_at")).Methods("GET")
+	complianceRouter.HandleFunc("/credential/{id}", handlers.GetCredentialByID).Methods("GET")
+	complianceRouter.Handle("/credential/{id}", auth.RequireFunc(handlers.UpdateCredential, auth.RoleAdmin)).Methods("PUT")
+	complianceRouter.Handle("/credential/{id}", auth.RequireFunc(handlers.DeleteCredential, auth.RoleAdmin)).Methods("DELETE")
+
+	// Legal hold routes
+	complianceRouter.Handle("/legal-hold", auth.RequireFunc(handlers.PlaceLegalHold, auth.RoleAdmin)).Methods("POST")
+	complianceRouter.HandleFunc("/legal-hold", handlers.GetLegalHolds).Methods("GET")
+	complianceRouter.HandleFunc("/legal-hold/{id}", handlers.GetLegalHoldByID).Methods("GET")
+	complianceRouter.Handle("/legal-hold/{id}/release", auth.RequireFunc(handlers.ReleaseLegalHold, auth.RoleAdmin)).Methods("POST")
+
+	// Daily checklist routes
+	complianceRouter.Handle("/checklist", auth.RequireFunc(handlers.CreateChecklist, auth.RoleAdmin)).Methods("POST")
+	complianceRouter.HandleFunc("/checklist", handlers.GetAllChecklists).Methods("GET")
+	complianceRouter.HandleFunc("/checklist/$schema", schema.Handler("Checklist", models.Checklist{}, "name", "moment", "role", "items")).Methods("GET")
+	complianceRouter.Handle("/checklist/defaults", auth.RequireFunc(handlers.CreateDefaultChecklists, auth.RoleAdmin)).Methods("POST")
+	complianceRouter.HandleFunc("/checklist/report", handlers.GetChecklistReport).Methods("GET")
+	complianceRouter.HandleFunc("/checklist/{id}", handlers.GetChecklistByID).Methods("GET")
+	complianceRouter.Handle("/checklist/{id}", auth.RequireFunc(handlers.UpdateChecklist, auth.RoleAdmin)).Methods("PUT")
+	complianceRouter.Handle("/checklist/{id}", auth.RequireFunc(handlers.DeleteChecklist, auth.RoleAdmin)).Methods("DELETE")
+	complianceRouter.HandleFunc("/checklist/{id}/complete", handlers.CompleteChecklist).Methods("POST")
+
+	// Status routes
+	complianceRouter.HandleFunc("/status", handlers.GetComplianceStatus).Methods("GET")
+
+	return r
+}
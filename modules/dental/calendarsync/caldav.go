@@ -0,0 +1,294 @@
+package calendarsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to a single CalDAV calendar collection
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	HTTP     *http.Client
+}
+
+// Event is a busy period read from the calendar
+type Event struct {
+	UID   string
+	Start time.Time
+	End   time.Time
+}
+
+const icalUTC = "20060102T150405Z"
+
+// multistatus is the part of a REPORT response the client reads
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Events returns the busy events overlapping [from, to). Recurring events are
+// expanded by the server into their occurrences.
+func (c *Client) Events(ctx context.Context, from, to time.Time) ([]Event, error) {
+	start, end := from.UTC().Format(icalUTC), to.UTC().Format(icalUTC)
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data><C:expand start="` + start + `" end="` + end + `"/></C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="` + start + `" end="` + end + `"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+	resp, err := c.do(ctx, "REPORT", c.URL, "application/xml; charset=utf-8", []byte(body), map[string]string{"Depth": "1"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("calendar query returned %s", resp.Status)
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding calendar query response: %v", err)
+	}
+	var events []Event
+	for _, response := range result.Responses {
+		for _, propstat := range response.Propstat {
+			if propstat.Prop.CalendarData == "" {
+				continue
+			}
+			for _, event := range parseEvents(propstat.Prop.CalendarData) {
+				if event.End.After(from) && event.Start.Before(to) {
+					events = append(events, event)
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// Put creates or replaces the event stored under name in the calendar
+func (c *Client) Put(ctx context.Context, name, calendar string) error {
+	resp, err := c.do(ctx, http.MethodPut, c.resource(name), "text/calendar; charset=utf-8", []byte(calendar), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("saving event %s returned %s", name, resp.Status)
+	}
+	return nil
+}
+
+// Delete removes the event stored under name; a missing event is not an error
+func (c *Client) Delete(ctx context.Context, name string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.resource(name), "", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		return fmt.Errorf("deleting event %s returned %s", name, resp.Status)
+	}
+	return nil
+}
+
+func (c *Client) resource(name string) string {
+	return strings.TrimSuffix(c.URL, "/") + "/" + name
+}
+
+func (c *Client) do(ctx context.Context, method, url, contentType string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("calendar refused the credentials (%s)", resp.Status)
+	}
+	return resp, nil
+}
+
+// parseEvents reads the VEVENTs of an iCalendar document, leaving out events
+// marked as free or cancelled
+func parseEvents(data string) []Event {
+	// Long lines are folded by starting the continuation with a space or tab
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	var events []Event
+	var props map[string]icalProp
+	for _, line := range strings.Split(data, "\n") {
+		switch {
+		case line == "BEGIN:VEVENT":
+			props = map[string]icalProp{}
+		case line == "END:VEVENT":
+			if event, ok := eventFromProps(props); ok {
+				events = append(events, event)
+			}
+			props = nil
+		case props != nil:
+			name, prop, ok := parseProp(line)
+			if ok {
+				if _, seen := props[name]; !seen {
+					props[name] = prop
+				}
+			}
+		}
+	}
+	return events
+}
+
+type icalProp struct {
+	params map[string]string
+	value  string
+}
+
+func parseProp(line string) (string, icalProp, bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", icalProp{}, false
+	}
+	parts := strings.Split(head, ";")
+	prop := icalProp{params: map[string]string{}, value: value}
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), prop, true
+}
+
+func eventFromProps(props map[string]icalProp) (Event, bool) {
+	if strings.EqualFold(props["TRANSP"].value, "TRANSPARENT") || strings.EqualFold(props["STATUS"].value, "CANCELLED") {
+		return Event{}, false
+	}
+	dtstart, ok := props["DTSTART"]
+	if !ok {
+		return Event{}, false
+	}
+	start, allDay, err := parseICalTime(dtstart)
+	if err != nil {
+		return Event{}, false
+	}
+
+	var end time.Time
+	if dtend, ok := props["DTEND"]; ok {
+		if end, _, err = parseICalTime(dtend); err != nil {
+			return Event{}, false
+		}
+	} else if duration, ok := props["DURATION"]; ok {
+		d, err := parseICalDuration(duration.value)
+		if err != nil {
+			return Event{}, false
+		}
+		end = start.Add(d)
+	} else if allDay {
+		end = start.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return Event{}, false
+	}
+	return Event{UID: props["UID"].value, Start: start.UTC(), End: end.UTC()}, true
+}
+
+// parseICalTime reads a DATE or DATE-TIME value, in UTC, in its TZID zone or
+// floating (taken as UTC, like the clinic agenda)
+func parseICalTime(prop icalProp) (time.Time, bool, error) {
+	if prop.params["VALUE"] == "DATE" || len(prop.value) == len("20060102") {
+		t, err := time.Parse("20060102", prop.value)
+		return t, true, err
+	}
+	if strings.HasSuffix(prop.value, "Z") {
+		t, err := time.Parse(icalUTC, prop.value)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", prop.value, loc)
+	return t, false, err
+}
+
+// parseICalDuration reads durations such as PT1H30M, P1D or P1W
+func parseICalDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	if s == value || s == "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	n := 0
+	inTime := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		case c == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		n = 0
+	}
+	return d, nil
+}
+
+// escapeText escapes a value for an iCalendar TEXT property
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,84 @@
+package calendarsync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"dental-saas/shared/config"
+	"dental-saas/shared/egress"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// secret is the key the calendar passwords are sealed with
+var secret = config.EnvSecret("CALDAV_SECRET", "the stored CalDAV passwords")
+
+// allowPrivate lets calendars on loopback and private networks be synced,
+// such as a CalDAV server on a development machine. Off in production, where
+// such URLs would let a dentist reach the deployment's internal services and
+// the cloud metadata endpoint.
+func allowPrivate() bool {
+	return config.Feature("CALDAV_ALLOW_PRIVATE_NETWORKS")
+}
+
+var httpClient = egress.NewClient(30*time.Second, allowPrivate)
+
+// CheckURL refuses calendar URLs whose host has an address that is not
+// public, unless CALDAV_ALLOW_PRIVATE_NETWORKS is set. The address is
+// checked again on every connection of a sync.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	return egress.CheckHost(u.Hostname(), allowPrivate())
+}
+
+// SealPassword encrypts a calendar password to be stored
+func SealPassword(password string) (string, error) {
+	gcm, err := sealer()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(password), nil)), nil
+}
+
+// openPassword decrypts a stored calendar password
+func openPassword(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("decoding the calendar password: %v", err)
+	}
+	gcm, err := sealer()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("calendar password is malformed")
+	}
+	password, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("calendar password cannot be decrypted, was CALDAV_SECRET changed? Save the password again")
+	}
+	return string(password), nil
+}
+
+func sealer() (cipher.AEAD, error) {
+	key := sha256.Sum256(secret())
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
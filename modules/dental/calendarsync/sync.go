@@ -0,0 +1,330 @@
+// Package calendarsync keeps the agenda in step with each dentist's personal
+// CalDAV calendar: busy times there become unavailability blocks in the
+// scheduler, and the dentist's appointments are published there.
+package calendarsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// uidSuffix marks the events published from the agenda, so they are not read
+// back as busy times
+const uidSuffix = "@dental-saas"
+
+// busyReason is the reason of the blocks imported from a calendar
+const busyReason = "Busy in personal calendar"
+
+// Window returns how far ahead calendars are synchronized (CALDAV_SYNC_DAYS, 60 by default)
+func Window() int {
+	return config.EnvInt("CALDAV_SYNC_DAYS", 60)
+}
+
+// SyncAll synchronizes every configured calendar and returns how many
+// succeeded. Failures are recorded on each calendar's LastError.
+func SyncAll(ctx context.Context) (int, error) {
+	synced := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := syncClinic(ctx)
+		synced += n
+		return err
+	})
+	return synced, err
+}
+
+// syncClinic synchronizes the calendars of the clinic of ctx
+func syncClinic(ctx context.Context) (int, error) {
+	syncs, err := paging.ScanAll[models.CalendarSync](ctx, &dynamodb.ScanInput{TableName: aws.String("CalendarSyncs")})
+	if err != nil {
+		return 0, fmt.Errorf("scanning calendar syncs: %v", err)
+	}
+	synced := 0
+	for _, cs := range syncs {
+		if err := Sync(ctx, cs); err != nil {
+			log.Printf("Error syncing calendar of dentist %s: %v", cs.DentistID, err)
+			continue
+		}
+		synced++
+	}
+	return synced, nil
+}
+
+// Sync replaces the dentist's imported blocks with the busy events of the
+// calendar in the sync window and publishes the appointments changed since
+// the last sync, removing cancelled ones. The outcome is recorded on the
+// calendar sync.
+func Sync(ctx context.Context, cs models.CalendarSync) error {
+	err := syncCalendar(ctx, cs)
+	if recordErr := record(ctx, cs.DentistID, err); recordErr != nil {
+		log.Printf("Error recording calendar sync of dentist %s: %v", cs.DentistID, recordErr)
+	}
+	return err
+}
+
+func syncCalendar(ctx context.Context, cs models.CalendarSync) error {
+	password, err := openPassword(cs.SealedPassword)
+	if err != nil {
+		return err
+	}
+	client := &Client{URL: cs.URL, Username: cs.Username, Password: password, HTTP: httpClient}
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, Window())
+
+	events, err := client.Events(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if err := importBlocks(ctx, cs.DentistID, events, now); err != nil {
+		return err
+	}
+	return publishAppointments(ctx, client, cs, from)
+}
+
+// importBlocks saves a block per busy event and removes the imported blocks
+// whose event is gone. Block IDs derive from the event, so unchanged events
+// keep their block.
+func importBlocks(ctx context.Context, dentistID string, events []Event, now time.Time) error {
+	keep := map[string]bool{}
+	for _, event := range events {
+		if strings.HasSuffix(event.UID, uidSuffix) {
+			continue
+		}
+		block := models.Unavailability{
+			ID:         blockID(dentistID, event),
+			DentistID:  dentistID,
+			Start:      event.Start.Format(models.UnavailabilityLayout),
+			End:        event.End.Format(models.UnavailabilityLayout),
+			Reason:     busyReason,
+			Source:     models.UnavailabilitySourceCalDAV,
+			ExternalID: event.UID,
+			CreatedAt:  now.Format(time.RFC3339),
+			UpdatedAt:  now.Format(time.RFC3339),
+		}
+		if keep[block.ID] {
+			continue
+		}
+		keep[block.ID] = true
+		item, err := attributevalue.MarshalMap(block)
+		if err != nil {
+			return err
+		}
+		putCtx, cancel := config.DBContext(ctx)
+		_, err = config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+			TableName: aws.String("Unavailability"),
+			Item:      item,
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("saving block %s: %v", block.ID, err)
+		}
+	}
+
+	existing, err := Blocks(ctx, dentistID)
+	if err != nil {
+		return err
+	}
+	for _, block := range existing {
+		if keep[block.ID] {
+			continue
+		}
+		if err := deleteBlock(ctx, block.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishAppointments writes the dentist's upcoming appointments changed
+// since the last sync to the calendar, all of them on the first sync
+func publishAppointments(ctx context.Context, client *Client, cs models.CalendarSync, from time.Time) error {
+	filter := "DentistID = :dentistId AND #dt >= :from"
+	values := map[string]types.AttributeValue{
+		":dentistId": &types.AttributeValueMemberS{Value: cs.DentistID},
+		":from":      &types.AttributeValueMemberS{Value: from.Format("2006-01-02")},
+	}
+	if cs.LastSyncAt != "" {
+		filter += " AND UpdatedAt >= :since"
+		values[":since"] = &types.AttributeValueMemberS{Value: cs.LastSyncAt}
+	}
+	appointments, err := paging.ScanAll[models.Appointment](ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String("Appointments"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  map[string]string{"#dt": "DateTime"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("scanning appointments: %v", err)
+	}
+
+	for _, appointment := range appointments {
+		name := "appointment-" + appointment.ID + ".ics"
+		if appointment.IsCancelled() {
+			if err := client.Delete(ctx, name); err != nil {
+				return err
+			}
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		end := start.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+		if err := client.Put(ctx, name, appointmentEvent(appointment, start, end)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appointmentEvent renders an appointment as an iCalendar document. The
+// summary leaves out the patient, since the calendar is outside the clinic.
+func appointmentEvent(appointment models.Appointment, start, end time.Time) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//dental-saas//agenda//EN",
+		"BEGIN:VEVENT",
+		"UID:appointment-" + appointment.ID + uidSuffix,
+		"DTSTAMP:" + time.Now().UTC().Format(icalUTC),
+		"DTSTART:" + start.UTC().Format(icalUTC),
+		"DTEND:" + end.UTC().Format(icalUTC),
+		"SUMMARY:" + escapeText("Dental appointment"),
+		"STATUS:CONFIRMED",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func blockID(dentistID string, event Event) string {
+	sum := sha256.Sum256([]byte(dentistID + "|" + event.UID + "|" + event.Start.Format(time.RFC3339)))
+	return "caldav-" + hex.EncodeToString(sum[:12])
+}
+
+// Blocks returns the blocks imported from the dentist's calendar
+func Blocks(ctx context.Context, dentistID string) ([]models.Unavailability, error) {
+	blocks, err := paging.ScanAll[models.Unavailability](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Unavailability"),
+		FilterExpression: aws.String("DentistID = :dentistId AND #source = :source"),
+		ExpressionAttributeNames: map[string]string{
+			"#source": "Source",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dentistId": &types.AttributeValueMemberS{Value: dentistID},
+			":source":    &types.AttributeValueMemberS{Value: models.UnavailabilitySourceCalDAV},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning imported blocks: %v", err)
+	}
+	return blocks, nil
+}
+
+// RemoveBlocks deletes the blocks imported from the dentist's calendar, once
+// the calendar is disconnected
+func RemoveBlocks(ctx context.Context, dentistID string) error {
+	blocks, err := Blocks(ctx, dentistID)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err := deleteBlock(ctx, block.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteBlock(ctx context.Context, id string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Unavailability"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("deleting block %s: %v", id, err)
+	}
+	return nil
+}
+
+// record stores the outcome of a sync. LastSyncAt only moves on success, so
+// appointments changed during a failed sync are published on the next one.
+// A calendar disconnected meanwhile is not recreated.
+func record(ctx context.Context, dentistID string, syncErr error) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	update := "SET LastSyncAt = :value REMOVE LastError"
+	value := time.Now().UTC().Format(time.RFC3339)
+	if syncErr != nil {
+		update = "SET LastError = :value"
+		value = syncErr.Error()
+	}
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("CalendarSyncs"),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: dentistID},
+		},
+		UpdateExpression:    aws.String(update),
+		ConditionExpression: aws.String("attribute_exists(DentistID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": &types.AttributeValueMemberS{Value: value},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return nil
+	}
+	return err
+}
+
+// StartSync synchronizes the calendars once at startup and then every interval
+func StartSync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	run := func() {
+		n, err := SyncAll(ctx)
+		if err != nil {
+			log.Printf("Error syncing calendars: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Synced %d dentist calendars", n)
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package catalog
+
+import (
+	"dental-saas/modules/dental/models"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+//go:embed templates/*.json
+var files embed.FS
+
+var templates = load()
+
+func load() map[string]models.CatalogTemplate {
+	entries, err := files.ReadDir("templates")
+	if err != nil {
+		log.Fatalf("Failed to read procedure catalogs: %v", err)
+	}
+
+	loaded := make(map[string]models.CatalogTemplate, len(entries))
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("templates", entry.Name()))
+		if err != nil {
+			log.Fatalf("Failed to read procedure catalog %s: %v", entry.Name(), err)
+		}
+		var template models.CatalogTemplate
+		if err := json.Unmarshal(data, &template); err != nil {
+			log.Fatalf("Failed to parse procedure catalog %s: %v", entry.Name(), err)
+		}
+		template.ID = strings.TrimSuffix(entry.Name(), ".json")
+		loaded[template.ID] = template
+	}
+	return loaded
+}
+
+// Templates returns the bundled catalogs sorted by ID
+func Templates() []models.CatalogTemplate {
+	list := make([]models.CatalogTemplate, 0, len(templates))
+	for _, template := range templates {
+		list = append(list, template)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Template returns a bundled catalog by ID
+func Template(id string) (models.CatalogTemplate, error) {
+	template, ok := templates[id]
+	if !ok {
+		return models.CatalogTemplate{}, fmt.Errorf("unknown catalog template %q", id)
+	}
+	return template, nil
+}
+
+// procedureNamespace seeds the deterministic IDs of catalog procedures
+var procedureNamespace = uuid.MustParse("6f1d3c1e-8a4b-4e57-9a2f-3c0d5b7e9a41")
+
+// ProcedureID derives the procedure ID of a catalog item, so applying the
+// same catalog again updates the procedures it created instead of duplicating them
+func ProcedureID(templateID, code string) string {
+	return uuid.NewSHA1(procedureNamespace, []byte(templateID+":"+code)).String()
+}
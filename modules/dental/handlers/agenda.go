@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/cache"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/live"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// agendaCacheTTL bounds staleness for entries that are not refreshed by the warmer
+const agendaCacheTTL = 10 * time.Minute
+
+func agendaCacheKey(clinicID, day string) string {
+	return fmt.Sprintf("clinic:%s:agenda:%s", clinicID, day)
+}
+
+func dentistsCacheKey(clinicID string) string {
+	return fmt.Sprintf("clinic:%s:dentists", clinicID)
+}
+
+// invalidateAgenda drops the clinic's cached agenda of a day after an
+// appointment write and has the live queue checked again
+func invalidateAgenda(ctx context.Context, day string) {
+	cache.Default.Delete(agendaCacheKey(config.ClinicID(ctx), day))
+	live.Queue.Touch()
+}
+
+// invalidateAgendas drops every cached agenda of the clinic, used when an
+// embedded patient, dentist or procedure changes
+func invalidateAgendas(ctx context.Context) {
+	cache.Default.DeletePrefix(agendaCacheKey(config.ClinicID(ctx), ""))
+}
+
+// invalidateDentists drops the clinic's cached dentist list and the agendas embedding dentists
+func invalidateDentists(ctx context.Context) {
+	cache.Default.Delete(dentistsCacheKey(config.ClinicID(ctx)))
+	invalidateAgendas(ctx)
+}
+
+// loadAgenda reads the appointments of a day sorted by time, with patient,
+// dentist and procedure embedded
+func loadAgenda(ctx context.Context, day time.Time) ([]models.Appointment, error) {
+	appointments, err := scanAppointmentsInRange(ctx, day, day)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(appointments, func(i, j int) bool {
+		return appointments[i].DateTime < appointments[j].DateTime
+	})
+	if err := expandAppointments(ctx, appointments, appointmentExpansions); err != nil {
+		return nil, err
+	}
+	if appointments == nil {
+		appointments = []models.Appointment{}
+	}
+	return appointments, nil
+}
+
+// WarmAgendaCache preloads the clinic's agenda of today and its dentist list
+// into the cache
+func WarmAgendaCache(ctx context.Context, ttl time.Duration) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	agenda, err := loadAgenda(ctx, today)
+	if err != nil {
+		return fmt.Errorf("loading agenda: %v", err)
+	}
+	cache.Default.Set(agendaCacheKey(config.ClinicID(ctx), today.Format("2006-01-02")), agenda, ttl)
+
+	dentists, err := paging.ScanAll[models.Dentist](ctx, &dynamodb.ScanInput{
+		TableName: aws.String("Dentists"),
+	})
+	if err != nil {
+		return fmt.Errorf("loading dentists: %v", err)
+	}
+	cache.Default.Set(dentistsCacheKey(config.ClinicID(ctx)), dentists, ttl)
+
+	return nil
+}
+
+// StartAgendaWarmer warms the cache of every clinic immediately and then
+// every interval. Entries live for twice the interval so a slow refresh
+// never leaves a gap.
+func StartAgendaWarmer(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	warm := func() {
+		cache.Default.Purge()
+		ids, err := clinics.IDs(ctx)
+		if err != nil {
+			log.Printf("Error listing clinics to warm agenda cache: %v", err)
+			return
+		}
+		for _, id := range ids {
+			if err := WarmAgendaCache(config.WithClinic(ctx, id), 2*interval); err != nil {
+				log.Printf("Error warming agenda cache of clinic %s: %v", id, err)
+			}
+		}
+	}
+
+	warm()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				warm()
+			}
+		}
+	}()
+}
+
+// GetAgenda godoc
+// @Summary Get the agenda of a day
+// @Description Get the appointments of a day sorted by time, with patient, dentist and procedure embedded. Today's agenda is kept warm in the cache; the X-Cache header tells whether the response came from it.
+// @Tags appointments
+// @Produce json
+// @Param date query string false "Day (YYYY-MM-DD), defaults to today"
+// @Param dentistId query string false "Only appointments of this dentist"
+// @Success 200 {array} models.Appointment
+// @Failure 400 {object} apierror.Response "Invalid date"
+// @Failure 500 {object} apierror.Response "Failed to retrieve agenda"
+// @Router /api/v1/dental/agenda [get]
+func GetAgenda(w http.ResponseWriter, r *http.Request) {
+	_, agenda, ok := dayAgenda(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agenda)
+}
+
+// dayAgenda reads the agenda of the day in the date parameter, from the
+// cache when it holds it, narrowed to the dentist in the dentistId
+// parameter. It returns false when the error response was written.
+func dayAgenda(w http.ResponseWriter, r *http.Request) (time.Time, []models.Appointment, bool) {
+	query := r.URL.Query()
+
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := query.Get("date"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return time.Time{}, nil, false
+		}
+		day = parsed
+	}
+
+	key := agendaCacheKey(config.ClinicID(r.Context()), day.Format("2006-01-02"))
+	var agenda []models.Appointment
+	// The cached agendas hold no deleted appointments
+	includeDeleted := config.IncludesDeleted(r.Context())
+	if cached, ok := cache.Default.Get(key); ok && !includeDeleted {
+		agenda = cached.([]models.Appointment)
+		w.Header().Set("X-Cache", "HIT")
+	} else if includeDeleted {
+		var err error
+		agenda, err = loadAgenda(r.Context(), day)
+		if err != nil {
+			http.Error(w, "Failed to retrieve agenda", http.StatusInternalServerError)
+			log.Printf("Error loading agenda for %s: %v", day.Format("2006-01-02"), err)
+			return time.Time{}, nil, false
+		}
+	} else {
+		var err error
+		agenda, err = loadAgenda(r.Context(), day)
+		if err != nil {
+			http.Error(w, "Failed to retrieve agenda", http.StatusInternalServerError)
+			log.Printf("Error loading agenda for %s: %v", day.Format("2006-01-02"), err)
+			return time.Time{}, nil, false
+		}
+		cache.Default.Set(key, agenda, agendaCacheTTL)
+		w.Header().Set("X-Cache", "MISS")
+	}
+
+	if dentistID := query.Get("dentistId"); dentistID != "" {
+		filtered := []models.Appointment{}
+		for _, appointment := range agenda {
+			if appointment.DentistID == dentistID {
+				filtered = append(filtered, appointment)
+			}
+		}
+		agenda = filtered
+	}
+	return day, agenda, true
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/pdf"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// agendaSheet is the printable agenda of a day, one group per dentist
+type agendaSheet struct {
+	Clinic  string
+	Date    string
+	Printed string
+	Groups  []agendaSheetGroup
+}
+
+type agendaSheetGroup struct {
+	Dentist string
+	Rows    []agendaSheetRow
+}
+
+type agendaSheetRow struct {
+	Time      string
+	Minutes   int
+	Patient   string
+	Phone     string
+	Procedure string
+	Status    string
+	Notes     string
+}
+
+// PrintAgenda godoc
+// @Summary Print the agenda of a day
+// @Description Get the appointments of a day as a compact sheet to print and keep at the front desk, grouped by dentist and sorted by time, with each patient's phone and the appointment notes. Cancelled appointments are left out. The sheet is a PDF unless format=html or an Accept header asking for text/html.
+// @Tags appointments
+// @Produce application/pdf
+// @Produce text/html
+// @Param date query string false "Day (YYYY-MM-DD), defaults to today"
+// @Param dentistId query string false "Only appointments of this dentist"
+// @Param format query string false "Sheet format: pdf (default) or html"
+// @Success 200 {file} file "Agenda sheet"
+// @Failure 400 {object} apierror.Response "Invalid date or format"
+// @Failure 500 {object} apierror.Response "Failed to retrieve agenda"
+// @Router /api/v1/dental/agenda/print [get]
+func PrintAgenda(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			format = "html"
+		}
+	}
+	if format != "pdf" && format != "html" {
+		http.Error(w, "format must be pdf or html", http.StatusBadRequest)
+		return
+	}
+
+	day, agenda, ok := dayAgenda(w, r)
+	if !ok {
+		return
+	}
+
+	clinicID := config.ClinicID(r.Context())
+	clinic, err := clinics.Get(r.Context(), clinicID)
+	if err != nil {
+		log.Printf("Error loading clinic %s for the agenda sheet: %v", clinicID, err)
+		clinic.Name = clinicID
+	}
+	sheet := newAgendaSheet(clinic.Name, day, agenda)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if format == "html" {
+		writeAgendaHTML(w, sheet)
+		return
+	}
+	writeAgendaPDF(w, sheet)
+}
+
+// newAgendaSheet groups the appointments of a day by dentist, leaving out
+// the cancelled ones
+func newAgendaSheet(clinic string, day time.Time, agenda []models.Appointment) agendaSheet {
+	sheet := agendaSheet{
+		Clinic:  clinic,
+		Date:    day.Format("2006-01-02"),
+		Printed: time.Now().UTC().Format("2006-01-02 15:04 UTC"),
+	}
+	groups := map[string]int{}
+	for _, appointment := range agenda {
+		if appointment.IsCancelled() {
+			continue
+		}
+		dentist := appointment.DentistID
+		if appointment.Dentist != nil {
+			dentist = appointment.Dentist.Name
+		}
+		i, ok := groups[dentist]
+		if !ok {
+			i = len(sheet.Groups)
+			groups[dentist] = i
+			sheet.Groups = append(sheet.Groups, agendaSheetGroup{Dentist: dentist})
+		}
+
+		row := agendaSheetRow{
+			Time:    appointment.DateTime,
+			Minutes: appointment.DurationMinutes(),
+			Patient: appointment.PatientID,
+			Status:  appointment.Status,
+			Notes:   strings.TrimSpace(appointment.Notes),
+		}
+		if start, err := appointment.StartTime(); err == nil {
+			row.Time = start.Format("15:04")
+		}
+		if appointment.Patient != nil {
+			row.Patient = appointment.Patient.Name
+			row.Phone = appointment.Patient.Phone
+		}
+		if appointment.Procedure != nil {
+			row.Procedure = appointment.Procedure.Name
+		}
+		sheet.Groups[i].Rows = append(sheet.Groups[i].Rows, row)
+	}
+	sort.SliceStable(sheet.Groups, func(i, j int) bool {
+		return sheet.Groups[i].Dentist < sheet.Groups[j].Dentist
+	})
+	return sheet
+}
+
+func writeAgendaPDF(w http.ResponseWriter, sheet agendaSheet) {
+	cut := func(s string, n int) string {
+		if runes := []rune(s); len(runes) > n {
+			return string(runes[:n-1]) + "~"
+		}
+		return s
+	}
+
+	lines := []string{
+		"Clinic:  " + sheet.Clinic,
+		"Printed: " + sheet.Printed,
+	}
+	if len(sheet.Groups) == 0 {
+		lines = append(lines, "", "No appointments.")
+	}
+	for _, group := range sheet.Groups {
+		lines = append(lines,
+			"",
+			cut(group.Dentist, pdf.MaxColumns),
+			fmt.Sprintf("%-5s %4s %-26s %-16s %-22s %-10s", "Time", "Min", "Patient", "Phone", "Procedure", "Status"),
+			strings.Repeat("-", 88),
+		)
+		for _, row := range group.Rows {
+			lines = append(lines, fmt.Sprintf("%-5s %4d %-26s %-16s %-22s %-10s",
+				cut(row.Time, 5), row.Minutes, cut(row.Patient, 26), cut(row.Phone, 16), cut(row.Procedure, 22), cut(row.Status, 10)))
+			for _, note := range wrapText(row.Notes, pdf.MaxColumns-11) {
+				lines = append(lines, "           "+note)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="agenda-%s.pdf"`, sheet.Date))
+	if err := pdf.Render(w, "Agenda "+sheet.Date, lines); err != nil {
+		log.Printf("Error writing agenda PDF: %v", err)
+	}
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces
+// when it can, keeping the line breaks it already has
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, string([]rune(word)[:width]))
+				word = string([]rune(word)[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+var agendaTemplate = template.Must(template.New("agenda").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Agenda {{.Date}}</title>
+<style>
+body { font: 11px sans-serif; margin: 1cm; }
+h1 { font-size: 16px; margin: 0 0 4px; }
+h2 { font-size: 13px; margin: 14px 0 4px; }
+p { margin: 0; color: #555; }
+table { width: 100%; border-collapse: collapse; page-break-inside: auto; }
+th, td { border-bottom: 1px solid #ccc; padding: 3px 4px; text-align: left; vertical-align: top; }
+tr { page-break-inside: avoid; }
+td.notes { white-space: pre-wrap; }
+@page { margin: 1cm; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Agenda {{.Date}}</h1>
+<p>{{.Clinic}} &middot; printed {{.Printed}}</p>
+{{range .Groups}}
+<h2>{{.Dentist}}</h2>
+<table>
+<tr><th>Time</th><th>Min</th><th>Patient</th><th>Phone</th><th>Procedure</th><th>Status</th><th>Notes</th></tr>
+{{range .Rows}}<tr><td>{{.Time}}</td><td>{{.Minutes}}</td><td>{{.Patient}}</td><td>{{.Phone}}</td><td>{{.Procedure}}</td><td>{{.Status}}</td><td class="notes">{{.Notes}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No appointments.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func writeAgendaHTML(w http.ResponseWriter, sheet agendaSheet) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := agendaTemplate.Execute(w, sheet); err != nil {
+		log.Printf("Error writing agenda HTML: %v", err)
+	}
+}
@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateAnamnesisTemplate godoc
+// @Summary Create an anamnesis template
+// @Description Create a medical questionnaire of the clinic. Each question is yes_no, text, choice, multiple_choice or list, and may feed the patient's allergies, medications or conditions (field). Questions without an ID get one.
+// @Tags anamnesis
+// @Accept json
+// @Produce json
+// @Param template body models.AnamnesisTemplate true "Template name and questions"
+// @Success 201 {object} models.AnamnesisTemplate
+// @Failure 400 {object} apierror.Response "Invalid request body or questions"
+// @Failure 500 {object} apierror.Response "Failed to save template"
+// @Router /api/v1/dental/anamnesis-template [post]
+func CreateAnamnesisTemplate(w http.ResponseWriter, r *http.Request) {
+	var template models.AnamnesisTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := template.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range template.Questions {
+		if template.Questions[i].ID == "" {
+			template.Questions[i].ID = uuid.NewString()
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	template.ID = uuid.NewString()
+	template.ClinicID = ""
+	template.CreatedAt = now
+	template.UpdatedAt = now
+	template.Version = 0
+
+	if err := putAnamnesisTemplate(r.Context(), template, true); err != nil {
+		http.Error(w, "Failed to save template", http.StatusInternalServerError)
+		log.Printf("Error saving anamnesis template: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+// GetAllAnamnesisTemplates godoc
+// @Summary Get the anamnesis templates
+// @Description Get the clinic's anamnesis templates by name, optionally only the active ones
+// @Tags anamnesis
+// @Produce json
+// @Param active query bool false "Only active templates"
+// @Success 200 {array} models.AnamnesisTemplate
+// @Failure 500 {object} apierror.Response "Failed to retrieve templates"
+// @Router /api/v1/dental/anamnesis-template [get]
+func GetAllAnamnesisTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := paging.ScanAll[models.AnamnesisTemplate](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("AnamnesisTemplates"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve templates", http.StatusInternalServerError)
+		log.Printf("Error scanning anamnesis templates: %v", err)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active") == "true"
+	result := []models.AnamnesisTemplate{}
+	for _, template := range templates {
+		if !activeOnly || template.Active {
+			result = append(result, template)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetAnamnesisTemplateByID godoc
+// @Summary Get an anamnesis template by ID
+// @Description Get an anamnesis template with its questions
+// @Tags anamnesis
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.AnamnesisTemplate
+// @Failure 404 {object} apierror.Response "Template not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve template"
+// @Router /api/v1/dental/anamnesis-template/{id} [get]
+func GetAnamnesisTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template, ok := loadAnamnesisTemplate(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// UpdateAnamnesisTemplate godoc
+// @Summary Update an anamnesis template
+// @Description Replace the name, questions and state of an anamnesis template. Anamneses already filled keep the questions as they were answered.
+// @Tags anamnesis
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param If-Match header string false "Version of the template being changed; required unless the body has it"
+// @Param template body models.AnamnesisTemplate true "Template name and questions"
+// @Success 200 {object} models.AnamnesisTemplate
+// @Failure 400 {object} apierror.Response "Invalid request body or questions"
+// @Failure 404 {object} apierror.Response "Template not found"
+// @Failure 409 {object} apierror.Response "Template was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the template is required"
+// @Failure 500 {object} apierror.Response "Failed to update template"
+// @Router /api/v1/dental/anamnesis-template/{id} [put]
+func UpdateAnamnesisTemplate(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "AnamnesisTemplates", id)
+	if !ok {
+		return
+	}
+	current, ok := loadAnamnesisTemplate(w, r, id)
+	if !ok {
+		return
+	}
+
+	var template models.AnamnesisTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := template.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range template.Questions {
+		if template.Questions[i].ID == "" {
+			template.Questions[i].ID = uuid.NewString()
+		}
+	}
+	template.ID = current.ID
+	template.ClinicID = current.ClinicID
+	template.CreatedAt = current.CreatedAt
+	template.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putAnamnesisTemplate(r.Context(), template, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update template", http.StatusInternalServerError)
+		log.Printf("Error updating anamnesis template %s: %v", id, err)
+		return
+	}
+	template.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// DeleteAnamnesisTemplate godoc
+// @Summary Delete an anamnesis template
+// @Description Delete an anamnesis template; anamneses already filled keep its questions and answers
+// @Tags anamnesis
+// @Param id path string true "Template ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Template not found"
+// @Failure 500 {object} apierror.Response "Failed to delete template"
+// @Router /api/v1/dental/anamnesis-template/{id} [delete]
+func DeleteAnamnesisTemplate(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("AnamnesisTemplates"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete template", http.StatusInternalServerError)
+		log.Printf("Error deleting anamnesis template %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RecordAnamnesis godoc
+// @Summary Fill in a patient's anamnesis
+// @Description Record the answers of the patient to an active anamnesis template as a new version of the patient's anamnesis; the previous versions are kept. The answers of the questions with a field fill the allergies, medications and conditions, added to those sent. The medications become the patient's medications, checked in prescriptions.
+// @Tags anamnesis
+// @Accept json
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param anamnesis body models.Anamnesis true "Template and answers"
+// @Success 201 {object} models.Anamnesis
+// @Failure 400 {object} apierror.Response "Invalid request body, inactive template or answers not matching its questions"
+// @Failure 404 {object} apierror.Response "Patient or template not found"
+// @Failure 409 {object} apierror.Response "The anamnesis was filled in concurrently"
+// @Failure 500 {object} apierror.Response "Failed to save anamnesis"
+// @Router /api/v1/dental/patient/{id}/anamnesis [post]
+func RecordAnamnesis(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+
+	var anamnesis models.Anamnesis
+	if err := json.NewDecoder(r.Body).Decode(&anamnesis); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if anamnesis.TemplateID == "" {
+		http.Error(w, "template ID is required", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := itemExists(r.Context(), "Patients", patientID)
+	if err != nil {
+		http.Error(w, "Failed to save anamnesis", http.StatusInternalServerError)
+		log.Printf("Error checking patient %s: %v", patientID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+	template, ok := loadAnamnesisTemplate(w, r, anamnesis.TemplateID)
+	if !ok {
+		return
+	}
+	if !template.Active {
+		http.Error(w, "The template is not active", http.StatusBadRequest)
+		return
+	}
+	if err := anamnesis.Answer(template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	latest, err := latestAnamnesis(r.Context(), patientID)
+	if err != nil {
+		http.Error(w, "Failed to save anamnesis", http.StatusInternalServerError)
+		log.Printf("Error fetching anamnesis of patient %s: %v", patientID, err)
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	anamnesis.PatientID = patientID
+	anamnesis.Version = 1
+	if latest != nil {
+		anamnesis.Version = latest.Version + 1
+	}
+	anamnesis.ClinicID = ""
+	anamnesis.RecordedAt = now
+	anamnesis.RecordedBy = config.ActorFrom(r.Context()).User
+
+	item, err := attributevalue.MarshalMap(anamnesis)
+	if err != nil {
+		http.Error(w, "Failed to save anamnesis", http.StatusInternalServerError)
+		log.Printf("Error marshaling anamnesis: %v", err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Anamneses"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PatientID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "The anamnesis was filled in concurrently; reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save anamnesis", http.StatusInternalServerError)
+		log.Printf("Error saving anamnesis of patient %s: %v", patientID, err)
+		return
+	}
+
+	// Templates that do not ask for medications leave the patient's list alone
+	asked := len(anamnesis.Medications) > 0
+	for _, question := range template.Questions {
+		asked = asked || question.Field == models.AnamnesisMedications
+	}
+	if asked {
+		if err := setPatientMedications(r.Context(), patientID, anamnesis.Medications, now); err != nil {
+			log.Printf("Error updating medications of patient %s from anamnesis %d: %v", patientID, anamnesis.Version, err)
+			w.Header().Add("Warning", `299 - "The patient's medications could not be updated"`)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(anamnesis)
+}
+
+// GetAnamnesis godoc
+// @Summary Get a patient's anamnesis
+// @Description Get the latest version of the patient's anamnesis, with the answers
+// @Tags anamnesis
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {object} models.Anamnesis
+// @Failure 404 {object} apierror.Response "The patient has no anamnesis"
+// @Failure 500 {object} apierror.Response "Failed to retrieve anamnesis"
+// @Router /api/v1/dental/patient/{id}/anamnesis [get]
+func GetAnamnesis(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+
+	anamnesis, err := latestAnamnesis(r.Context(), patientID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve anamnesis", http.StatusInternalServerError)
+		log.Printf("Error fetching anamnesis of patient %s: %v", patientID, err)
+		return
+	}
+	if anamnesis == nil {
+		http.Error(w, "The patient has no anamnesis", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anamnesis)
+}
+
+// GetAnamnesisVersions godoc
+// @Summary List the versions of a patient's anamnesis
+// @Description List the versions of the patient's anamnesis, most recent first, with the allergies, medications and conditions of each, without the answers
+// @Tags anamnesis
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {array} models.Anamnesis
+// @Failure 500 {object} apierror.Response "Failed to retrieve anamnesis versions"
+// @Router /api/v1/dental/patient/{id}/anamnesis/versions [get]
+func GetAnamnesisVersions(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+
+	versions, err := queryItems[models.Anamnesis](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String("Anamneses"),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve anamnesis versions", http.StatusInternalServerError)
+		log.Printf("Error querying anamnesis versions of patient %s: %v", patientID, err)
+		return
+	}
+	for i := range versions {
+		versions[i].Answers = nil
+	}
+	if versions == nil {
+		versions = []models.Anamnesis{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GetAnamnesisVersion godoc
+// @Summary Get a version of a patient's anamnesis
+// @Description Get the patient's anamnesis as it was filled in that time, with the answers
+// @Tags anamnesis
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param version path int true "Anamnesis version"
+// @Success 200 {object} models.Anamnesis
+// @Failure 400 {object} apierror.Response "Invalid version"
+// @Failure 404 {object} apierror.Response "Anamnesis version not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve anamnesis"
+// @Router /api/v1/dental/patient/{id}/anamnesis/versions/{version} [get]
+func GetAnamnesisVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	version, err := strconv.ParseInt(vars["version"], 10, 64)
+	if err != nil || version < 1 {
+		http.Error(w, "version must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Anamneses"),
+		Key: map[string]types.AttributeValue{
+			"PatientID": &types.AttributeValueMemberS{Value: vars["id"]},
+			"Version":   &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve anamnesis", http.StatusInternalServerError)
+		log.Printf("Error fetching anamnesis %d of patient %s: %v", version, vars["id"], err)
+		return
+	}
+	if result.Item == nil {
+		http.Error(w, "Anamnesis version not found", http.StatusNotFound)
+		return
+	}
+	var anamnesis models.Anamnesis
+	if err := attributevalue.UnmarshalMap(result.Item, &anamnesis); err != nil {
+		http.Error(w, "Failed to retrieve anamnesis", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling anamnesis: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(anamnesis)
+}
+
+// latestAnamnesis returns the latest version of the patient's anamnesis, nil
+// when it was never filled in
+func latestAnamnesis(ctx context.Context, patientID string) (*models.Anamnesis, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("Anamneses"),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(1),
+		ConsistentRead:   aws.Bool(true),
+	})
+	if err != nil || len(result.Items) == 0 {
+		return nil, err
+	}
+	var anamnesis models.Anamnesis
+	if err := attributevalue.UnmarshalMap(result.Items[0], &anamnesis); err != nil {
+		return nil, err
+	}
+	return &anamnesis, nil
+}
+
+// setPatientMedications replaces the patient's medications with those of the
+// anamnesis
+func setPatientMedications(ctx context.Context, patientID string, medications []string, now string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: patientID},
+		},
+		UpdateExpression:    aws.String("SET UpdatedAt = :now REMOVE Medications"),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: now},
+		},
+	}
+	if len(medications) > 0 {
+		list, err := attributevalue.Marshal(medications)
+		if err != nil {
+			return err
+		}
+		input.UpdateExpression = aws.String("SET UpdatedAt = :now, Medications = :medications")
+		input.ExpressionAttributeValues[":medications"] = list
+	}
+	_, err := config.DBClient.UpdateItem(ctx, input)
+	return err
+}
+
+// loadAnamnesisTemplate fetches an anamnesis template, writing the error
+// response when it fails
+func loadAnamnesisTemplate(w http.ResponseWriter, r *http.Request, id string) (models.AnamnesisTemplate, bool) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("AnamnesisTemplates"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve template", http.StatusInternalServerError)
+		log.Printf("Error fetching anamnesis template %s: %v", id, err)
+		return models.AnamnesisTemplate{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return models.AnamnesisTemplate{}, false
+	}
+	var template models.AnamnesisTemplate
+	if err := attributevalue.UnmarshalMap(result.Item, &template); err != nil {
+		http.Error(w, "Failed to retrieve template", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling anamnesis template: %v", err)
+		return models.AnamnesisTemplate{}, false
+	}
+	return template, true
+}
+
+func putAnamnesisTemplate(ctx context.Context, template models.AnamnesisTemplate, create bool) error {
+	item, err := attributevalue.MarshalMap(template)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("AnamnesisTemplates"),
+		Item:      item,
+	}, create)
+}
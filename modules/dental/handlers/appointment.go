@@ -2,33 +2,39 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/selfservice"
+	"dental-saas/modules/financial/billing"
 	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/live"
+	"dental-saas/shared/mergepatch"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 // CreateAppointment godoc
 // @Summary Create a new appointment
-// @Description Create a new appointment by providing the details
+// @Description Create a new appointment by providing the details. Procedures requiring carrier pre-authorization without an approved one valid on the appointment day get a Warning header, or a 409 when PREAUTH_ENFORCEMENT=block. Completed appointments of procedures requiring consent need the patient's signed consent form.
 // @Tags appointments
 // @Accept json
 // @Produce json
 // @Param appointment body models.Appointment true "Appointment data"
 // @Success 201 {object} models.Appointment
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Appointment with this ID already exists"
-// @Failure 500 {string} string "Failed to save appointment"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Appointment with this ID already exists or pre-authorization missing"
+// @Failure 422 {object} apierror.Response "Dentist not credentialed for the procedure or not available at the time, or signed consent required with the consent flow in the Link header"
+// @Failure 500 {object} apierror.Response "Failed to save appointment"
 // @Router /api/v1/dental/appointment [post]
 func CreateAppointment(w http.ResponseWriter, r *http.Request) {
 	var appointment models.Appointment
@@ -37,58 +43,40 @@ func CreateAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if appointment.ID == "" {
-		appointment.ID = uuid.NewString()
-	}
-
+	// The checks below need a valid appointment; the service validates it again
 	if err := appointment.IsValid(); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	if appointment.CreatedAt == "" {
-		appointment.CreatedAt = time.Now().UTC().Format(time.RFC3339)
-	}
-	if appointment.UpdatedAt == "" {
-		appointment.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
-	}
-
-	item := map[string]types.AttributeValue{
-		"ID":        &types.AttributeValueMemberS{Value: appointment.ID},
-		"PatientID": &types.AttributeValueMemberS{Value: appointment.PatientID},
-		"DentistID": &types.AttributeValueMemberS{Value: appointment.DentistID},
-		"DateTime":  &types.AttributeValueMemberS{Value: appointment.DateTime},
-		"Status":    &types.AttributeValueMemberS{Value: appointment.Status},
-		"CreatedAt": &types.AttributeValueMemberS{Value: appointment.CreatedAt},
-		"UpdatedAt": &types.AttributeValueMemberS{Value: appointment.UpdatedAt},
+	if !checkDentistPerforms(w, r, appointment) {
+		return
 	}
-
-	if appointment.ProcedureID != "" {
-		item["ProcedureID"] = &types.AttributeValueMemberS{Value: appointment.ProcedureID}
+	if !checkDentistAvailability(w, r, appointment) {
+		return
 	}
-	if appointment.Notes != "" {
-		item["Notes"] = &types.AttributeValueMemberS{Value: appointment.Notes}
+	if !checkPreAuth(w, r, appointment) {
+		return
 	}
-	if appointment.Duration != "" {
-		item["Duration"] = &types.AttributeValueMemberS{Value: appointment.Duration}
+	if !checkConsent(w, r, appointment) {
+		return
 	}
 
-	_, err := config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName:           aws.String("Appointments"),
-		Item:                item,
-		ConditionExpression: aws.String("attribute_not_exists(ID)"),
-	})
+	appointment, err := Appointments.Create(r.Context(), appointment)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Appointment with this ID already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to save appointment", http.StatusInternalServerError)
-		log.Printf("Error saving appointment: %v", err)
+		writeServiceError(w, err, "Appointment", "Failed to save appointment")
 		return
 	}
 
+	if day, ok := appointmentDay(appointment.DateTime); ok {
+		counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), day), 1)
+		invalidateAgenda(r.Context(), day)
+	}
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "appointment", ID: appointment.ID}, inbox.User(r), "", appointment.Notes)
+	if !appointment.IsCancelled() {
+		emailAppointmentUpdate(r.Context(), selfservice.KindConfirmation, appointment, "")
+	}
+	webhooks.Publish(r.Context(), webhooks.EventAppointmentCreated, appointment)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(appointment)
 }
@@ -98,31 +86,48 @@ func CreateAppointment(w http.ResponseWriter, r *http.Request) {
 // @Description Get a list of all appointments
 // @Tags appointments
 // @Produce json
+// @Param expand query string false "Comma-separated related entities to embed: patient, dentist, procedure"
+// @Param stream query bool false "Stream the list as newline-delimited JSON"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
 // @Success 200 {array} models.Appointment
-// @Failure 500 {string} string "Failed to retrieve appointments"
+// @Failure 400 {object} apierror.Response "Invalid expand parameter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointments"
 // @Router /api/v1/dental/appointment [get]
 func GetAllAppointments(w http.ResponseWriter, r *http.Request) {
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String("Appointments"),
-	})
+	expand, err := parseExpand(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if wantsStream(r) {
+		streamList(w, r, "appointments", Appointments.List, func(ctx context.Context, page []models.Appointment) error {
+			return expandAppointments(ctx, page, expand)
+		})
+		return
+	}
+
+	page := paging.Request(r)
+	appointments, next, err := Appointments.List(r.Context(), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to retrieve appointments", http.StatusInternalServerError)
 		log.Printf("Error scanning appointments: %v", err)
 		return
 	}
 
-	var appointments []models.Appointment
-	for _, item := range result.Items {
-		var appointment models.Appointment
-		if err := attributevalue.UnmarshalMap(item, &appointment); err != nil {
-			log.Printf("Error unmarshaling appointment: %v", err)
-			continue
-		}
-		appointments = append(appointments, appointment)
+	if err := expandAppointments(r.Context(), appointments, expand); err != nil {
+		http.Error(w, "Failed to expand appointments", http.StatusInternalServerError)
+		log.Printf("Error expanding appointments: %v", err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(appointments)
+	paging.Write(w, page, appointments, next)
 }
 
 // GetAppointmentByID godoc
@@ -131,39 +136,38 @@ func GetAllAppointments(w http.ResponseWriter, r *http.Request) {
 // @Tags appointments
 // @Produce json
 // @Param id path string true "Appointment ID"
+// @Param expand query string false "Comma-separated related entities to embed: patient, dentist, procedure"
+// @Param consistent query bool false "Strongly consistent read, e.g. right after creating the appointment"
 // @Success 200 {object} models.Appointment
-// @Failure 404 {string} string "Appointment not found"
-// @Failure 500 {string} string "Failed to retrieve appointment"
+// @Failure 400 {object} apierror.Response "Invalid expand parameter"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointment"
 // @Router /api/v1/dental/appointment/{id} [get]
 func GetAppointmentByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Appointments"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
+	expand, err := parseExpand(r)
 	if err != nil {
-		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
-		log.Printf("Error fetching appointment with ID %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if result.Item == nil {
-		http.Error(w, "Appointment not found", http.StatusNotFound)
+
+	appointment, err := Appointments.Get(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err, "Appointment", "Failed to retrieve appointment")
 		return
 	}
 
-	var appointment models.Appointment
-	if err = attributevalue.UnmarshalMap(result.Item, &appointment); err != nil {
-		http.Error(w, "Failed to unmarshal appointment data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling appointment data: %v", err)
+	appointments := []models.Appointment{appointment}
+	if err := expandAppointments(r.Context(), appointments, expand); err != nil {
+		http.Error(w, "Failed to expand appointment", http.StatusInternalServerError)
+		log.Printf("Error expanding appointment: %v", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(appointment)
+	json.NewEncoder(w).Encode(appointments[0])
 }
 
 // GetAppointmentsByPatient godoc
@@ -172,34 +176,32 @@ func GetAppointmentByID(w http.ResponseWriter, r *http.Request) {
 // @Tags appointments
 // @Produce json
 // @Param patientId path string true "Patient ID"
+// @Param expand query string false "Comma-separated related entities to embed: patient, dentist, procedure"
 // @Success 200 {array} models.Appointment
-// @Failure 500 {string} string "Failed to retrieve appointments"
+// @Failure 400 {object} apierror.Response "Invalid expand parameter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointments"
 // @Router /api/v1/dental/appointment/patient/{patientId} [get]
 func GetAppointmentsByPatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	patientID := vars["patientId"]
 
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:        aws.String("Appointments"),
-		FilterExpression: aws.String("PatientID = :patientId"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":patientId": &types.AttributeValueMemberS{Value: patientID},
-		},
-	})
+	expand, err := parseExpand(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	appointments, err := Appointments.FindByPatient(r.Context(), patientID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve appointments", http.StatusInternalServerError)
-		log.Printf("Error scanning appointments by patient: %v", err)
+		log.Printf("Error querying appointments by patient: %v", err)
 		return
 	}
 
-	var appointments []models.Appointment
-	for _, item := range result.Items {
-		var appointment models.Appointment
-		if err := attributevalue.UnmarshalMap(item, &appointment); err != nil {
-			log.Printf("Error unmarshaling appointment: %v", err)
-			continue
-		}
-		appointments = append(appointments, appointment)
+	if err := expandAppointments(r.Context(), appointments, expand); err != nil {
+		http.Error(w, "Failed to expand appointments", http.StatusInternalServerError)
+		log.Printf("Error expanding appointments: %v", err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -212,34 +214,32 @@ func GetAppointmentsByPatient(w http.ResponseWriter, r *http.Request) {
 // @Tags appointments
 // @Produce json
 // @Param dentistId path string true "Dentist ID"
+// @Param expand query string false "Comma-separated related entities to embed: patient, dentist, procedure"
 // @Success 200 {array} models.Appointment
-// @Failure 500 {string} string "Failed to retrieve appointments"
+// @Failure 400 {object} apierror.Response "Invalid expand parameter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointments"
 // @Router /api/v1/dental/appointment/dentist/{dentistId} [get]
 func GetAppointmentsByDentist(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	dentistID := vars["dentistId"]
 
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:        aws.String("Appointments"),
-		FilterExpression: aws.String("DentistID = :dentistId"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":dentistId": &types.AttributeValueMemberS{Value: dentistID},
-		},
-	})
+	expand, err := parseExpand(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	appointments, err := Appointments.FindByDentist(r.Context(), dentistID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve appointments", http.StatusInternalServerError)
-		log.Printf("Error scanning appointments by dentist: %v", err)
+		log.Printf("Error querying appointments by dentist: %v", err)
 		return
 	}
 
-	var appointments []models.Appointment
-	for _, item := range result.Items {
-		var appointment models.Appointment
-		if err := attributevalue.UnmarshalMap(item, &appointment); err != nil {
-			log.Printf("Error unmarshaling appointment: %v", err)
-			continue
-		}
-		appointments = append(appointments, appointment)
+	if err := expandAppointments(r.Context(), appointments, expand); err != nil {
+		http.Error(w, "Failed to expand appointments", http.StatusInternalServerError)
+		log.Printf("Error expanding appointments: %v", err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -247,113 +247,96 @@ func GetAppointmentsByDentist(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateAppointment godoc
-// @Summary Update an existing appointment
-// @Description Update fields of an existing appointment by providing its ID
+// @Summary Replace an existing appointment
+// @Description Replace an existing appointment with the appointment sent: fields left out are cleared. The ID, clinic, timestamps, bundle series, campaign and reminder are kept. Use PATCH to change only some fields. Completing an appointment of a procedure that requires consent needs the patient's signed consent form. With AUTO_REVENUE_FROM_APPOINTMENTS on, completing an appointment with a procedure books a pending revenue for it.
 // @Tags appointments
 // @Accept json
 // @Produce json
 // @Param id path string true "Appointment ID"
+// @Param If-Match header string false "Version of the appointment being replaced; required unless the body has it"
 // @Param appointment body models.Appointment true "Appointment data (ID will be ignored)"
 // @Success 200 {object} models.Appointment
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Appointment not found"
-// @Failure 500 {string} string "Failed to update appointment"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 409 {object} apierror.Response "Pre-authorization missing, or appointment changed since the version sent"
+// @Failure 422 {object} apierror.Response "Dentist not credentialed for the procedure or not available at the time, or signed consent required with the consent flow in the Link header"
+// @Failure 428 {object} apierror.Response "Version of the appointment is required"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
 // @Router /api/v1/dental/appointment/{id} [put]
 func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Appointments"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
-	if err != nil {
-		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
-		log.Printf("Error fetching appointment with ID %s: %v", id, err)
-		return
-	}
-	if result.Item == nil {
-		http.Error(w, "Appointment not found", http.StatusNotFound)
-		return
-	}
-
-	var currentAppointment models.Appointment
-	if err = attributevalue.UnmarshalMap(result.Item, &currentAppointment); err != nil {
-		http.Error(w, "Failed to unmarshal appointment data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling appointment data: %v", err)
+	r, version, ok := versioning.Require(w, r, "Appointments", mux.Vars(r)["id"])
+	if !ok {
 		return
 	}
 
-	var updatedData models.Appointment
-	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+	var appointment models.Appointment
+	if err := json.NewDecoder(r.Body).Decode(&appointment); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if updatedData.PatientID != "" {
-		currentAppointment.PatientID = updatedData.PatientID
-	}
-	if updatedData.DentistID != "" {
-		currentAppointment.DentistID = updatedData.DentistID
-	}
-	if updatedData.ProcedureID != "" {
-		currentAppointment.ProcedureID = updatedData.ProcedureID
-	}
-	if updatedData.DateTime != "" {
-		currentAppointment.DateTime = updatedData.DateTime
-	}
-	if updatedData.Duration != "" {
-		currentAppointment.Duration = updatedData.Duration
-	}
-	if updatedData.Status != "" {
-		currentAppointment.Status = updatedData.Status
-	}
-	if updatedData.Notes != "" {
-		currentAppointment.Notes = updatedData.Notes
-	}
+	updateAppointment(w, r, version, func(current models.Appointment) (models.Appointment, error) {
+		appointment.KeepServerFields(current)
+		return appointment, nil
+	})
+}
 
-	if err := currentAppointment.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// PatchAppointment godoc
+// @Summary Update fields of an appointment
+// @Description Change some fields of an existing appointment with a JSON Merge Patch (RFC 7386): only the fields sent change, and null clears an optional field such as notes. The same checks as a full update apply to the result.
+// @Tags appointments
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Appointment ID"
+// @Param If-Match header string false "Version of the appointment being changed; required unless the patch has it"
+// @Param patch body object true "Fields to change, null to clear"
+// @Success 200 {object} models.Appointment
+// @Failure 400 {object} apierror.Response "Invalid patch or missing required fields"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 409 {object} apierror.Response "Pre-authorization missing, or appointment changed since the version sent"
+// @Failure 415 {object} apierror.Response "Content-Type must be application/merge-patch+json"
+// @Failure 422 {object} apierror.Response "Dentist not credentialed for the procedure or not available at the time, or signed consent required with the consent flow in the Link header"
+// @Failure 428 {object} apierror.Response "Version of the appointment is required"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
+// @Router /api/v1/dental/appointment/{id} [patch]
+func PatchAppointment(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Appointments", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	patch, ok := readMergePatch(w, r)
+	if !ok {
 		return
 	}
 
-	currentAppointment.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	updateAppointment(w, r, version, func(current models.Appointment) (models.Appointment, error) {
+		appointment, err := mergepatch.Apply(current, patch)
+		if err != nil {
+			return models.Appointment{}, err
+		}
+		appointment.KeepServerFields(current)
+		return appointment, nil
+	})
+}
 
-	item := map[string]types.AttributeValue{
-		"ID":        &types.AttributeValueMemberS{Value: currentAppointment.ID},
-		"PatientID": &types.AttributeValueMemberS{Value: currentAppointment.PatientID},
-		"DentistID": &types.AttributeValueMemberS{Value: currentAppointment.DentistID},
-		"DateTime":  &types.AttributeValueMemberS{Value: currentAppointment.DateTime},
-		"Status":    &types.AttributeValueMemberS{Value: currentAppointment.Status},
-		"CreatedAt": &types.AttributeValueMemberS{Value: currentAppointment.CreatedAt},
-		"UpdatedAt": &types.AttributeValueMemberS{Value: currentAppointment.UpdatedAt},
+// updateAppointment replaces the appointment of the request, at version,
+// with the one change makes of it, after the checks of saveAppointmentChange
+func updateAppointment(w http.ResponseWriter, r *http.Request, version int64, change func(current models.Appointment) (models.Appointment, error)) {
+	previousAppointment, err := Appointments.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err, "Appointment", "Failed to retrieve appointment")
+		return
 	}
 
-	if currentAppointment.ProcedureID != "" {
-		item["ProcedureID"] = &types.AttributeValueMemberS{Value: currentAppointment.ProcedureID}
-	}
-	if currentAppointment.Notes != "" {
-		item["Notes"] = &types.AttributeValueMemberS{Value: currentAppointment.Notes}
-	}
-	if currentAppointment.Duration != "" {
-		item["Duration"] = &types.AttributeValueMemberS{Value: currentAppointment.Duration}
+	currentAppointment, err := change(previousAppointment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	currentAppointment.Version = version
 
-	_, err = config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName:           aws.String("Appointments"),
-		Item:                item,
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
-	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Appointment not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Failed to update appointment", http.StatusInternalServerError)
-		log.Printf("Error updating appointment: %v", err)
+	if !saveAppointmentChange(w, r, previousAppointment, &currentAppointment) {
 		return
 	}
 
@@ -363,34 +346,190 @@ func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
 
 // DeleteAppointment godoc
 // @Summary Delete an appointment
-// @Description Delete an appointment by its ID
+// @Description Soft delete an appointment by its ID: the appointment is hidden from lists, lookups and the agenda, unless ?include_deleted=true, until restored. Appointments under legal hold, or of a patient under legal hold, cannot be deleted.
 // @Tags appointments
 // @Param id path string true "Appointment ID"
 // @Success 204 "Appointment deleted successfully"
-// @Failure 404 {string} string "Appointment not found"
-// @Failure 500 {string} string "Failed to delete appointment"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 409 {object} apierror.Response "Record is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete appointment"
 // @Router /api/v1/dental/appointment/{id} [delete]
 func DeleteAppointment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	_, err := config.DBClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-		TableName: aws.String("Appointments"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
+	patientID, err := appointmentPatient(r, id)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Appointment not found", http.StatusNotFound)
-			return
-		}
 		http.Error(w, "Failed to delete appointment", http.StatusInternalServerError)
-		log.Printf("Error deleting appointment: %v", err)
+		log.Printf("Error fetching appointment %s: %v", id, err)
+		return
+	}
+	if !checkLegalHold(w, r, legalhold.RecordAppointment, id, patientID) {
 		return
 	}
 
+	appointment, err := Appointments.Delete(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err, "Appointment", "Failed to delete appointment")
+		return
+	}
+
+	if day, ok := appointmentDay(appointment.DateTime); ok {
+		counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), day), -1)
+		invalidateAgenda(r.Context(), day)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// RestoreAppointment godoc
+// @Summary Restore a deleted appointment
+// @Description Bring back a soft-deleted appointment as it was. Its slot is not checked again, so it may now overlap other appointments.
+// @Tags appointments
+// @Produce json
+// @Param id path string true "Appointment ID"
+// @Success 200 {object} models.Appointment
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 500 {object} apierror.Response "Failed to restore appointment"
+// @Router /api/v1/dental/appointment/{id}/restore [post]
+func RestoreAppointment(w http.ResponseWriter, r *http.Request) {
+	appointment, err := Appointments.Restore(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err, "Appointment", "Failed to restore appointment")
+		return
+	}
+
+	if day, ok := appointmentDay(appointment.DateTime); ok {
+		counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), day), 1)
+		invalidateAgenda(r.Context(), day)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appointment)
+}
+
+// saveAppointmentChange validates and writes a change to an existing
+// appointment, keeping the per-day counters, cached agendas and mentions in
+// sync. Staff edits and patient self-service links both go through it. The
+// write requires the appointment to still be at current's version, which it
+// raises. It returns false when the error response was written.
+func saveAppointmentChange(w http.ResponseWriter, r *http.Request, previous models.Appointment, current *models.Appointment) bool {
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if current.DentistID != previous.DentistID || current.ProcedureID != previous.ProcedureID {
+		if !checkDentistPerforms(w, r, *current) {
+			return false
+		}
+	}
+	if current.DentistID != previous.DentistID ||
+		current.DateTime != previous.DateTime ||
+		current.Duration != previous.Duration ||
+		(previous.IsCancelled() && !current.IsCancelled()) {
+		if !checkDentistAvailability(w, r, *current) {
+			return false
+		}
+	}
+	if current.PatientID != previous.PatientID ||
+		current.ProcedureID != previous.ProcedureID ||
+		current.DateTime != previous.DateTime ||
+		(previous.IsCancelled() && !current.IsCancelled()) {
+		if !checkPreAuth(w, r, *current) {
+			return false
+		}
+	}
+	if current.Status != previous.Status ||
+		current.PatientID != previous.PatientID ||
+		current.ProcedureID != previous.ProcedureID {
+		if !checkConsent(w, r, *current) {
+			return false
+		}
+	}
+
+	saved, err := Appointments.Save(r.Context(), previous, *current)
+	if err != nil {
+		if !versioning.Conflict(w, r, err) {
+			writeServiceError(w, err, "Appointment", "Failed to update appointment")
+		}
+		return false
+	}
+	*current = saved
+	current.Version++
+
+	oldDay, oldOK := appointmentDay(previous.DateTime)
+	newDay, newOK := appointmentDay(current.DateTime)
+	if oldDay != newDay {
+		if oldOK {
+			counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), oldDay), -1)
+		}
+		if newOK {
+			counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), newDay), 1)
+		}
+	}
+	if oldOK {
+		invalidateAgenda(r.Context(), oldDay)
+	}
+	if newOK {
+		invalidateAgenda(r.Context(), newDay)
+	}
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "appointment", ID: current.ID}, inbox.User(r), previous.Notes, current.Notes)
+	if previous.Status != models.AppointmentStatusCompleted && current.Status == models.AppointmentStatusCompleted {
+		bookAppointmentRevenue(r.Context(), *current)
+	}
+	if current.TreatmentPlanID != "" && current.Status != previous.Status {
+		progressTreatmentPlan(r.Context(), *current)
+	}
+	switch {
+	case current.IsCancelled() && !previous.IsCancelled():
+		emailAppointmentUpdate(r.Context(), selfservice.KindCancelled, *current, "")
+	case current.DateTime != previous.DateTime && !current.IsCancelled():
+		emailAppointmentUpdate(r.Context(), selfservice.KindRescheduled, *current, previous.DateTime)
+	}
+	return true
+}
+
+// emailAppointmentUpdate emails the patient that an appointment was booked,
+// rescheduled or cancelled, unless APPOINTMENT_EMAILS is off. It runs after
+// the response, as the appointment is already saved, so failures are only
+// logged.
+func emailAppointmentUpdate(ctx context.Context, kind string, appointment models.Appointment, previousTime string) {
+	if !config.Feature("APPOINTMENT_EMAILS") {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		if _, err := selfservice.SendUpdate(ctx, kind, appointment, previousTime); err != nil {
+			log.Printf("Error sending %s email of appointment %s: %v", kind, appointment.ID, err)
+		}
+	}()
+}
+
+// bookAppointmentRevenue creates the pending revenue of an appointment just
+// completed, when AUTO_REVENUE_FROM_APPOINTMENTS is on. The appointment is
+// already saved, so failures are only logged and the revenue is left to be
+// recorded by hand.
+func bookAppointmentRevenue(ctx context.Context, appointment models.Appointment) {
+	if !billing.Enabled() {
+		return
+	}
+	revenue, err := billing.BookAppointment(ctx, appointment)
+	if err != nil {
+		log.Printf("Error booking revenue of completed appointment %s: %v", appointment.ID, err)
+		return
+	}
+	if revenue != nil {
+		live.Metrics.Touch()
+		log.Printf("Booked revenue %s of %.2f for completed appointment %s", revenue.ID, revenue.Amount, appointment.ID)
+	}
+}
+
+// appointmentDay extracts the YYYY-MM-DD day an appointment DateTime falls on
+func appointmentDay(dateTime string) (string, bool) {
+	if len(dateTime) < 10 {
+		return "", false
+	}
+	return dateTime[:10], true
+}
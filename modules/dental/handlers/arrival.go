@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/live"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// arrivalLead is how long before the appointment check-ins are accepted
+const arrivalLead = 2 * time.Hour
+
+// Kinds of the notifications sent to dentists when their patients check in
+const (
+	kindPatientNearby  = "patient_nearby"
+	kindPatientArrived = "patient_arrived"
+)
+
+// CheckIn godoc
+// @Summary Record that a patient is nearby or arrived
+// @Description Webhook for mobile apps (geofencing), check-in kiosks and the front desk. Send the appointment or, without it, the patient, whose appointment happening now is used. Check-ins are accepted from 2 hours before the appointment until its end; repeated ones change nothing. The queue view is updated and the dentist is notified in the notification center.
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param arrival body models.ArrivalRequest true "Arrival data"
+// @Success 200 {object} models.Appointment
+// @Failure 400 {object} apierror.Response "Invalid request body, event or time"
+// @Failure 404 {object} apierror.Response "Appointment not found or no appointment of the patient now"
+// @Failure 409 {object} apierror.Response "Appointment cancelled, started or not happening now"
+// @Failure 500 {object} apierror.Response "Failed to record arrival"
+// @Router /api/v1/dental/check-in [post]
+func CheckIn(w http.ResponseWriter, r *http.Request) {
+	var request models.ArrivalRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	at, err := request.Time(time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var appointment models.Appointment
+	switch {
+	case request.AppointmentID != "":
+		var ok bool
+		if appointment, ok = loadAppointment(w, r, request.AppointmentID); !ok {
+			return
+		}
+	case request.PatientID != "":
+		found, err := patientAppointmentAt(r.Context(), request.PatientID, at)
+		if err != nil {
+			http.Error(w, "Failed to record arrival", http.StatusInternalServerError)
+			log.Printf("Error querying appointments of patient %s: %v", request.PatientID, err)
+			return
+		}
+		if found == nil {
+			http.Error(w, "No appointment of the patient now", http.StatusNotFound)
+			return
+		}
+		appointment = *found
+	default:
+		http.Error(w, "appointment_id or patient_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if !recordArrival(w, r, &appointment, request.Event, request.Source, at) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appointment)
+}
+
+// SelfServiceArrival godoc
+// @Summary Tell the clinic the patient is nearby or arrived from a reminder link
+// @Description Public endpoint the patient app calls from the reminder link, e.g. when entering the clinic's geofence, with the same rules as the check-in webhook
+// @Tags self-service
+// @Accept json
+// @Produce json
+// @Param token path string true "Token from the reminder link"
+// @Param arrival body models.ArrivalRequest false "Event and source (default arrived)"
+// @Success 200 {object} models.SelfServiceAppointment
+// @Failure 400 {object} apierror.Response "Invalid request body or event"
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 409 {object} apierror.Response "Appointment cancelled, started or not happening now"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Failure 500 {object} apierror.Response "Failed to record arrival"
+// @Router /api/v1/dental/self-service/{token}/arrival [post]
+func SelfServiceArrival(w http.ResponseWriter, r *http.Request) {
+	var request models.ArrivalRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Source == "" {
+		request.Source = "app"
+	}
+
+	appointment, ok := selfServiceAppointment(w, r)
+	if !ok {
+		return
+	}
+	// The patient reports the present, not a time of their choosing
+	if !recordArrival(w, r, &appointment, request.Event, request.Source, time.Now().UTC().Truncate(time.Second)) {
+		return
+	}
+
+	public, err := publicAppointment(r, appointment)
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error describing appointment %s: %v", appointment.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
+
+// recordArrival stores that the patient of an appointment is nearby or
+// arrived and notifies the dentist. Repeated events change nothing. It
+// returns false when the error response was written.
+func recordArrival(w http.ResponseWriter, r *http.Request, appointment *models.Appointment, event, source string, at time.Time) bool {
+	if appointment.Status != models.AppointmentStatusScheduled && appointment.Status != models.AppointmentStatusConfirmed {
+		http.Error(w, "The appointment was cancelled, missed or completed", http.StatusConflict)
+		return false
+	}
+	if appointment.StartedAt != "" {
+		http.Error(w, "The appointment already started", http.StatusConflict)
+		return false
+	}
+	if !arrivalWindow(*appointment, at) {
+		http.Error(w, "Check-ins are accepted from 2 hours before the appointment until its end", http.StatusConflict)
+		return false
+	}
+
+	previous := *appointment
+	stamp := at.Format(time.RFC3339)
+	switch event {
+	case models.ArrivalNearby:
+		if appointment.NearbyAt != "" || appointment.ArrivedAt != "" {
+			return true
+		}
+		appointment.NearbyAt = stamp
+	default:
+		if appointment.ArrivedAt != "" {
+			return true
+		}
+		appointment.ArrivedAt = stamp
+	}
+	if source != "" {
+		appointment.ArrivalSource = source
+	}
+	if !saveAppointmentChange(w, r, previous, appointment) {
+		return false
+	}
+
+	if err := notifyArrival(r.Context(), *appointment, event); err != nil {
+		log.Printf("Error notifying arrival of appointment %s: %v", appointment.ID, err)
+	}
+	return true
+}
+
+// arrivalWindow reports whether at falls between arrivalLead before the
+// appointment and its end
+func arrivalWindow(appointment models.Appointment, at time.Time) bool {
+	start, err := appointment.StartTime()
+	if err != nil {
+		return false
+	}
+	end := start.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+	return !at.Before(start.Add(-arrivalLead)) && at.Before(end)
+}
+
+// patientAppointmentAt finds the patient's open appointment whose check-in
+// window contains at, the earliest one when several do
+func patientAppointmentAt(ctx context.Context, patientID string, at time.Time) (*models.Appointment, error) {
+	appointments, err := queryItems[models.Appointment](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("Appointments"),
+		IndexName:              aws.String(config.AppointmentsByPatientIndex),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found *models.Appointment
+	for i, appointment := range appointments {
+		if appointment.Status != models.AppointmentStatusScheduled && appointment.Status != models.AppointmentStatusConfirmed {
+			continue
+		}
+		if appointment.StartedAt != "" || !arrivalWindow(appointment, at) {
+			continue
+		}
+		if found == nil || appointment.DateTime < found.DateTime {
+			found = &appointments[i]
+		}
+	}
+	return found, nil
+}
+
+// notifyArrival tells the appointment's dentist, in the notification center,
+// that the patient is nearby or arrived. Dentists without a username are
+// notified by their email.
+func notifyArrival(ctx context.Context, appointment models.Appointment, event string) error {
+	dentists, err := batchGetItems[models.Dentist](ctx, "Dentists", []string{appointment.DentistID})
+	if err != nil {
+		return err
+	}
+	if len(dentists) == 0 {
+		return nil
+	}
+	recipient := dentists[0].Username
+	if recipient == "" {
+		recipient = dentists[0].Email
+	}
+	if recipient == "" {
+		return nil
+	}
+
+	patientName := appointment.PatientID
+	patients, err := batchGetItems[models.Patient](ctx, "Patients", []string{appointment.PatientID})
+	if err != nil {
+		return err
+	}
+	if len(patients) > 0 {
+		patientName = patients[0].Name
+	}
+
+	kind, excerpt := kindPatientArrived, fmt.Sprintf("%s arrived for the appointment at %s", patientName, appointment.DateTime)
+	if event == models.ArrivalNearby {
+		kind, excerpt = kindPatientNearby, fmt.Sprintf("%s is nearby for the appointment at %s", patientName, appointment.DateTime)
+	}
+	return inbox.Notify(ctx, inbox.Notification{
+		Recipient:  recipient,
+		Kind:       kind,
+		SourceType: "appointment",
+		SourceID:   appointment.ID,
+		Excerpt:    excerpt,
+	})
+}
+
+// GetQueue godoc
+// @Summary Get the patient queue of a day
+// @Description Get the day's appointments as the reception queue: in progress, then patients waiting (by arrival, with minutes waited), on their way, expected (late ones flagged) and done. Cancelled and missed appointments are left out.
+// @Tags appointments
+// @Produce json
+// @Param date query string false "Day (YYYY-MM-DD), default today"
+// @Param dentistId query string false "Only the queue of this dentist"
+// @Success 200 {object} models.Queue
+// @Failure 400 {object} apierror.Response "Invalid date"
+// @Failure 500 {object} apierror.Response "Failed to retrieve queue"
+// @Router /api/v1/dental/appointment/queue [get]
+func GetQueue(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	if query.Get("date") != "" {
+		var err error
+		if day, err = time.Parse("2006-01-02", query.Get("date")); err != nil {
+			http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	queue, err := clinicQueue(r.Context(), day, now)
+	if err != nil {
+		http.Error(w, "Failed to retrieve queue", http.StatusInternalServerError)
+		log.Printf("Error building queue: %v", err)
+		return
+	}
+	if dentistID := query.Get("dentistId"); dentistID != "" {
+		entries := []models.QueueEntry{}
+		for _, entry := range queue.Entries {
+			if entry.DentistID == dentistID {
+				entries = append(entries, entry)
+			}
+		}
+		queue.Entries = entries
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queue)
+}
+
+// StreamQueue godoc
+// @Summary Stream the patient queue of today
+// @Description Stream the clinic's queue of today as server-sent "queue" events, sent on connect and whenever a patient checks in, is seated or leaves, for reception and operatory displays
+// @Tags appointments
+// @Produce text/event-stream
+// @Param access_token query string false "Access token, for clients that cannot send the Authorization header"
+// @Success 200 {object} models.Queue "Event stream of queues"
+// @Failure 500 {object} apierror.Response "Streaming is not supported"
+// @Router /api/v1/dental/appointment/queue/live [get]
+func StreamQueue(w http.ResponseWriter, r *http.Request) {
+	live.Queue.ServeHTTP(w, r)
+}
+
+// StartLiveQueue publishes the queue of today of each clinic when it
+// changes, checking every interval, so waiting times and late patients move
+// on, and right after appointments are written. Only clinics with a display
+// connected are read.
+func StartLiveQueue(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	last := make(map[string][]models.QueueEntry)
+	refresh := func() {
+		now := time.Now().UTC()
+		for _, clinicID := range live.Queue.Watched() {
+			queue, err := clinicQueue(config.WithClinic(ctx, clinicID), now.Truncate(24*time.Hour), now)
+			if err != nil {
+				log.Printf("Error building live queue of clinic %s: %v", clinicID, err)
+				continue
+			}
+			if previous, ok := last[clinicID]; ok && reflect.DeepEqual(previous, queue.Entries) {
+				continue
+			}
+			if err := live.Queue.Hub(clinicID).Publish(queue); err != nil {
+				log.Printf("Error publishing live queue of clinic %s: %v", clinicID, err)
+				continue
+			}
+			last[clinicID] = queue.Entries
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			case <-live.Queue.Changed():
+				refresh()
+			}
+		}
+	}()
+}
+
+// queueOrder ranks the queue states, in the order the queue lists them
+var queueOrder = map[string]int{
+	models.QueueInProgress: 0,
+	models.QueueArrived:    1,
+	models.QueueNearby:     2,
+	models.QueueExpected:   3,
+	models.QueueDone:       4,
+}
+
+// clinicQueue builds the queue of the clinic's appointments of day as seen at now
+func clinicQueue(ctx context.Context, day, now time.Time) (models.Queue, error) {
+	queue := models.Queue{Date: day.Format("2006-01-02"), Entries: []models.QueueEntry{}, UpdatedAt: now}
+
+	appointments, err := scanAppointmentsInRange(ctx, day, day)
+	if err != nil {
+		return queue, err
+	}
+	open := appointments[:0]
+	for _, appointment := range appointments {
+		if appointment.IsCancelled() || appointment.Status == models.AppointmentStatusNoShow {
+			continue
+		}
+		open = append(open, appointment)
+	}
+
+	patients, err := batchGetByID[models.Patient](ctx, "Patients", open, func(a models.Appointment) string { return a.PatientID }, func(p models.Patient) string { return p.ID })
+	if err != nil {
+		return queue, err
+	}
+	dentists, err := batchGetByID[models.Dentist](ctx, "Dentists", open, func(a models.Appointment) string { return a.DentistID }, func(d models.Dentist) string { return d.ID })
+	if err != nil {
+		return queue, err
+	}
+
+	for _, appointment := range open {
+		entry := models.QueueEntry{
+			AppointmentID: appointment.ID,
+			PatientID:     appointment.PatientID,
+			DentistID:     appointment.DentistID,
+			DateTime:      appointment.DateTime,
+			NearbyAt:      appointment.NearbyAt,
+			ArrivedAt:     appointment.ArrivedAt,
+			StartedAt:     appointment.StartedAt,
+		}
+		if patient := patients[appointment.PatientID]; patient != nil {
+			entry.PatientName = patient.Name
+		}
+		if dentist := dentists[appointment.DentistID]; dentist != nil {
+			entry.DentistName = dentist.Name
+		}
+
+		switch {
+		case appointment.FinishedAt != "" || appointment.Status == models.AppointmentStatusCompleted:
+			entry.State = models.QueueDone
+		case appointment.StartedAt != "":
+			entry.State = models.QueueInProgress
+		case appointment.ArrivedAt != "":
+			entry.State = models.QueueArrived
+			if arrived, err := time.Parse(time.RFC3339, appointment.ArrivedAt); err == nil && now.After(arrived) {
+				entry.WaitingMinutes = int(now.Sub(arrived).Minutes())
+			}
+		case appointment.NearbyAt != "":
+			entry.State = models.QueueNearby
+		default:
+			entry.State = models.QueueExpected
+		}
+		if entry.State == models.QueueNearby || entry.State == models.QueueExpected {
+			start, err := appointment.StartTime()
+			entry.Late = err == nil && now.After(start)
+		}
+		queue.Entries = append(queue.Entries, entry)
+	}
+
+	sort.SliceStable(queue.Entries, func(i, j int) bool {
+		a, b := queue.Entries[i], queue.Entries[j]
+		if queueOrder[a.State] != queueOrder[b.State] {
+			return queueOrder[a.State] < queueOrder[b.State]
+		}
+		if a.State == models.QueueArrived && a.ArrivedAt != b.ArrivedAt {
+			return a.ArrivedAt < b.ArrivedAt
+		}
+		return a.DateTime < b.DateTime
+	})
+	return queue, nil
+}
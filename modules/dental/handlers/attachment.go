@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/blob"
+	"dental-saas/shared/config"
+	"dental-saas/shared/legalhold"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxAttachmentSize is the largest file accepted as a patient attachment
+const maxAttachmentSize = 25 << 20
+
+// UploadPatientAttachment godoc
+// @Summary Upload a patient attachment
+// @Description Upload a file of the patient, such as a radiograph, a signed consent form or a lab report, up to 25 MB. The file is kept in the file storage and its details in the patient's record.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param file formData file true "File to attach"
+// @Param category formData string false "radiograph, consent, lab_report, photo or other (default)"
+// @Param description formData string false "Description of the file"
+// @Success 201 {object} models.Attachment
+// @Failure 400 {object} apierror.Response "Missing or invalid file or category"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 413 {object} apierror.Response "File too large"
+// @Failure 500 {object} apierror.Response "Failed to save attachment"
+// @Failure 503 {object} apierror.Response "File storage not available"
+// @Router /api/v1/dental/patient/{id}/attachments [post]
+func UploadPatientAttachment(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	upload, ok := readUpload(w, r, maxAttachmentSize)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	attachment := models.Attachment{
+		PatientID:   patientID,
+		ID:          config.ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		Name:        upload.Name,
+		ContentType: upload.ContentType,
+		Size:        int64(len(upload.Data)),
+		Category:    r.FormValue("category"),
+		Description: r.FormValue("description"),
+		UploadedAt:  now.Format(time.RFC3339),
+		UploadedBy:  config.ActorFrom(r.Context()).User,
+	}
+	if err := attachment.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := itemExists(r.Context(), "Patients", patientID)
+	if err != nil {
+		http.Error(w, "Failed to save attachment", http.StatusInternalServerError)
+		log.Printf("Error checking patient %s: %v", patientID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+
+	store, err := blob.Default()
+	if err != nil {
+		http.Error(w, "File storage not available", http.StatusServiceUnavailable)
+		log.Printf("Error initializing file storage: %v", err)
+		return
+	}
+	attachment.StorageKey = patientBlobKey(r.Context(), patientID, "attachments", attachment.ID)
+	if err := store.Put(r.Context(), attachment.StorageKey, attachment.ContentType, upload.Data); err != nil {
+		http.Error(w, "Failed to save attachment", http.StatusInternalServerError)
+		log.Printf("Error storing attachment of patient %s: %v", patientID, err)
+		return
+	}
+
+	item, err := attributevalue.MarshalMap(attachment)
+	if err == nil {
+		ctx, cancel := config.DBContext(r.Context())
+		defer cancel()
+		_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String("Attachments"),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(PatientID)"),
+		})
+	}
+	if err != nil {
+		http.Error(w, "Failed to save attachment", http.StatusInternalServerError)
+		log.Printf("Error saving attachment of patient %s: %v", patientID, err)
+		if err := store.Delete(r.Context(), attachment.StorageKey); err != nil {
+			log.Printf("Error removing orphaned attachment file %s: %v", attachment.StorageKey, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// GetPatientAttachments godoc
+// @Summary List a patient's attachments
+// @Description List the files attached to a patient, newest first, without their contents
+// @Tags attachments
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param category query string false "Only attachments of this category"
+// @Success 200 {array} models.Attachment
+// @Failure 500 {object} apierror.Response "Failed to retrieve attachments"
+// @Router /api/v1/dental/patient/{id}/attachments [get]
+func GetPatientAttachments(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("Attachments"),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	if category := r.URL.Query().Get("category"); category != "" {
+		input.FilterExpression = aws.String("Category = :category")
+		input.ExpressionAttributeValues[":category"] = &types.AttributeValueMemberS{Value: category}
+	}
+
+	attachments, err := queryItems[models.Attachment](r.Context(), input)
+	if err != nil {
+		http.Error(w, "Failed to retrieve attachments", http.StatusInternalServerError)
+		log.Printf("Error querying attachments of patient %s: %v", patientID, err)
+		return
+	}
+	if attachments == nil {
+		attachments = []models.Attachment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// GetPatientAttachment godoc
+// @Summary Get a patient attachment
+// @Description Get the details of a file attached to a patient
+// @Tags attachments
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Success 200 {object} models.Attachment
+// @Failure 404 {object} apierror.Response "Attachment not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve attachment"
+// @Router /api/v1/dental/patient/{id}/attachments/{attachmentId} [get]
+func GetPatientAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := loadAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// DownloadPatientAttachment godoc
+// @Summary Download a patient attachment
+// @Description Download the file attached to a patient, with its original name and type
+// @Tags attachments
+// @Produce octet-stream
+// @Param id path string true "Patient ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 404 {object} apierror.Response "Attachment not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve attachment"
+// @Failure 503 {object} apierror.Response "File storage not available"
+// @Router /api/v1/dental/patient/{id}/attachments/{attachmentId}/download [get]
+func DownloadPatientAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := loadAttachment(w, r)
+	if !ok {
+		return
+	}
+	store, err := blob.Default()
+	if err != nil {
+		http.Error(w, "File storage not available", http.StatusServiceUnavailable)
+		log.Printf("Error initializing file storage: %v", err)
+		return
+	}
+	data, err := store.Get(r.Context(), attachment.StorageKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.Error(w, "Attachment file not found", http.StatusNotFound)
+		log.Printf("Attachment %s of patient %s has no file at %s", attachment.ID, attachment.PatientID, attachment.StorageKey)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve attachment", http.StatusInternalServerError)
+		log.Printf("Error reading attachment file %s: %v", attachment.StorageKey, err)
+		return
+	}
+
+	writeFile(w, "attachment", attachment.Name, attachment.ContentType, data)
+}
+
+// DeletePatientAttachment godoc
+// @Summary Delete a patient attachment
+// @Description Delete a file attached to a patient, from the patient's record and the file storage. Attachments of a patient under legal hold are kept.
+// @Tags attachments
+// @Param id path string true "Patient ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Attachment not found"
+// @Failure 409 {object} apierror.Response "Patient is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete attachment"
+// @Router /api/v1/dental/patient/{id}/attachments/{attachmentId} [delete]
+func DeletePatientAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := loadAttachment(w, r)
+	if !ok {
+		return
+	}
+	if !checkLegalHold(w, r, legalhold.RecordAttachment, attachment.ID, attachment.PatientID) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String("Attachments"),
+		Key:                 patientRecordKey(attachment.PatientID, attachment.ID),
+		ConditionExpression: aws.String("attribute_exists(PatientID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete attachment", http.StatusInternalServerError)
+		log.Printf("Error deleting attachment %s: %v", attachment.ID, err)
+		return
+	}
+
+	// The record is gone, so a file left behind is only logged
+	store, err := blob.Default()
+	if err == nil {
+		err = store.Delete(r.Context(), attachment.StorageKey)
+	}
+	if err != nil {
+		log.Printf("Error removing attachment file %s: %v", attachment.StorageKey, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload is a file received in a multipart request
+type upload struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// readUpload reads the multipart "file" field of the request, of up to max
+// bytes, writing the error response when it is missing, empty or too large.
+// The content type is detected when the client sent none.
+func readUpload(w http.ResponseWriter, r *http.Request, max int64) (upload, bool) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		http.Error(w, "Files are uploaded as multipart/form-data", http.StatusBadRequest)
+		return upload{}, false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return upload{}, false
+		}
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return upload{}, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, max+1))
+	if err != nil {
+		http.Error(w, "Invalid file", http.StatusBadRequest)
+		return upload{}, false
+	}
+	if int64(len(data)) > max {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return upload{}, false
+	}
+	if len(data) == 0 {
+		http.Error(w, "File is empty", http.StatusBadRequest)
+		return upload{}, false
+	}
+
+	received := upload{
+		Name:        filepath.Base(filepath.Clean("/" + header.Filename)),
+		ContentType: header.Header.Get("Content-Type"),
+		Data:        data,
+	}
+	if received.ContentType == "" || received.ContentType == "application/octet-stream" {
+		received.ContentType = http.DetectContentType(data)
+	}
+	return received, true
+}
+
+// patientBlobKey returns the storage key of a file of a patient. Files are
+// kept under the clinic, so they can be told apart in a shared bucket.
+func patientBlobKey(ctx context.Context, patientID, kind, id string) string {
+	return strings.Join([]string{config.ClinicID(ctx), "patients", patientID, kind, id}, "/")
+}
+
+// writeFile sends a stored file, as a download with the "attachment"
+// disposition or shown in the browser with "inline"
+func writeFile(w http.ResponseWriter, disposition, name, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// loadAttachment fetches the attachment of the request, writing the error
+// response when it fails
+func loadAttachment(w http.ResponseWriter, r *http.Request) (models.Attachment, bool) {
+	vars := mux.Vars(r)
+	attachment, err := getAttachment(r.Context(), vars["id"], vars["attachmentId"])
+	if err != nil {
+		http.Error(w, "Failed to retrieve attachment", http.StatusInternalServerError)
+		log.Printf("Error fetching attachment %s: %v", vars["attachmentId"], err)
+		return models.Attachment{}, false
+	}
+	if attachment == nil {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return models.Attachment{}, false
+	}
+	return *attachment, true
+}
+
+func getAttachment(ctx context.Context, patientID, id string) (*models.Attachment, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Attachments"),
+		Key:       patientRecordKey(patientID, id),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var attachment models.Attachment
+	if err := attributevalue.UnmarshalMap(result.Item, &attachment); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// patientRecordKey is the key of the tables holding a patient's records by
+// PatientID and ID
+func patientRecordKey(patientID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PatientID": &types.AttributeValueMemberS{Value: patientID},
+		"ID":        &types.AttributeValueMemberS{Value: id},
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// slotStep is the interval between the start times offered to patients
+const slotStep = 30 * time.Minute
+
+// slotLayout is the format of the start times offered to patients, in clinic time
+const slotLayout = "2006-01-02T15:04"
+
+// maxSlotDays caps how far ahead a patient can look for a slot
+const maxSlotDays = 30
+
+// availableSlots lists the start times between from and to (inclusive dates)
+// at which the dentist is free for an appointment of the given duration.
+// Slots fall within the dentist's working hours (clinic hours for dentists
+// without a schedule), start after now and do not overlap the dentist's other
+// appointments or unavailability blocks, including those at the other clinics
+// linked to the dentist's identity; ignoreID leaves out the appointment
+// being rescheduled.
+func availableSlots(ctx context.Context, dentistID string, from, to time.Time, duration int, ignoreID string) ([]string, error) {
+	appointments, err := scanAppointmentsInRange(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return freeSlots(ctx, dentistID, appointments, from, to, duration, ignoreID, slotRules{})
+}
+
+// slotRules are the checks slot suggestions add to availableSlots: the time
+// kept free after each appointment, and whether a room is free
+type slotRules struct {
+	buffer   func(appointment models.Appointment) time.Duration // kept free after an existing appointment
+	after    time.Duration                                      // kept free after the new appointment
+	roomFree func(start, end time.Time) bool
+}
+
+// freeSlots lists the slots of availableSlots among the given appointments,
+// which must cover from to to, applying rules
+func freeSlots(ctx context.Context, dentistID string, appointments []models.Appointment, from, to time.Time, duration int, ignoreID string, rules slotRules) ([]string, error) {
+	var taken []busyPeriod
+	for _, appointment := range appointments {
+		if appointment.DentistID != dentistID || appointment.ID == ignoreID || appointment.IsCancelled() {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		end := start.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+		if rules.buffer != nil {
+			end = end.Add(rules.buffer(appointment))
+		}
+		taken = append(taken, busyPeriod{start, end})
+	}
+	blocks, err := scanUnavailability(ctx, dentistID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		start, end, err := block.Period()
+		if err != nil {
+			continue
+		}
+		taken = append(taken, busyPeriod{start, end})
+	}
+	elsewhere, err := busyElsewhere(ctx, dentistID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	taken = append(taken, elsewhere...)
+
+	schedule, err := dentistSchedule(ctx, dentistID)
+	if err != nil {
+		return nil, err
+	}
+	length := time.Duration(duration) * time.Minute
+	now := time.Now().UTC()
+
+	slots := []string{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, period := range schedule.PeriodsOn(day) {
+			for start := period.Start; !start.Add(length).After(period.End); start = start.Add(slotStep) {
+				if !start.After(now) {
+					continue
+				}
+				end := start.Add(length + rules.after)
+				free := true
+				for _, b := range taken {
+					if start.Before(b.end) && b.start.Before(end) {
+						free = false
+						break
+					}
+				}
+				if free && rules.roomFree != nil {
+					free = rules.roomFree(start, end)
+				}
+				if free {
+					slots = append(slots, start.Format(slotLayout))
+				}
+			}
+		}
+	}
+	return slots, nil
+}
+
+// slotAvailable reports whether an appointment can be moved to dateTime
+// without leaving the dentist's working hours or overlapping the dentist's agenda
+func slotAvailable(ctx context.Context, appointment models.Appointment, dateTime string) (bool, error) {
+	moved := appointment
+	moved.DateTime = dateTime
+	start, err := moved.StartTime()
+	if err != nil {
+		return false, err
+	}
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	slots, err := availableSlots(ctx, appointment.DentistID, day, day, appointment.DurationMinutes(), appointment.ID)
+	if err != nil {
+		return false, err
+	}
+	want := start.UTC().Format(slotLayout)
+	for _, slot := range slots {
+		if slot == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// slotRange reads the days a slot search covers from the from (YYYY-MM-DD,
+// today or later) and days (1 to maxSlotDays, default 7) parameters. It
+// returns false when the error response was written.
+func slotRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if s := query.Get("from"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			http.Error(w, "from must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		if parsed.After(from) {
+			from = parsed
+		}
+	}
+	days := 7
+	if s := query.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSlotDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxSlotDays), http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		days = n
+	}
+	return from, from.AddDate(0, 0, days-1), true
+}
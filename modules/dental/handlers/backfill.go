@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	// defaultBackfillCandidates and maxBackfillCandidates bound how many
+	// candidates are ranked for a slot
+	defaultBackfillCandidates = 20
+	maxBackfillCandidates     = 100
+	// defaultRecallDays is how long after the last completed visit a
+	// patient is due for a recall, unless RECALL_INTERVAL_DAYS says otherwise
+	defaultRecallDays = 180
+)
+
+// Points each criterion adds to a backfill candidate's score. Waitlist
+// entries can reach 100, patients moved forward 75 and recalls 50, so the
+// ones asking for a time come first.
+const (
+	waitlistPoints      = 50
+	waitedPoints        = 15 // after 45 days on the waitlist
+	entryPeriodPoints   = 10
+	entryDayPoints      = 5
+	laterPoints         = 35
+	gainedPoints        = 20 // for appointments a month or more later
+	recallPoints        = 20
+	overduePoints       = 20 // for recalls overdue by six months or more
+	sameDentistPoints   = 10
+	sameProcedurePoints = 10
+)
+
+// GetBackfillCandidates godoc
+// @Summary Rank candidates to fill an open slot
+// @Description Rank the patients who could take a slot left open, given by a cancelled appointment or by dentistId, dateTime and duration. Candidates are waiting waitlist entries the slot suits (procedure no longer than the slot and performed by the dentist, dentist and dates accepted), patients with a later scheduled or confirmed appointment that fits the slot, and patients due for a recall (last completed visit RECALL_INTERVAL_DAYS or more before the slot, 180 by default) with nothing booked. Waitlist entries rank first, by time waited and preferences met; appointments by how much sooner they would be; recalls by how overdue they are; matching the dentist or procedure of the slot adds to all. Each patient is listed once, with the best option, and patients booked at the time of the slot are left out.
+// @Tags appointments
+// @Produce json
+// @Param appointmentId query string false "Cancelled appointment whose slot is open"
+// @Param dentistId query string false "Dentist of the open slot, without appointmentId"
+// @Param dateTime query string false "Start of the open slot (YYYY-MM-DDTHH:MM), without appointmentId"
+// @Param duration query int false "Length of the open slot in minutes, without appointmentId (default 30)"
+// @Param max query int false "Number of candidates, up to 100 (default 20)"
+// @Success 200 {object} models.BackfillCandidates
+// @Failure 400 {object} apierror.Response "Missing or invalid slot, or invalid max"
+// @Failure 404 {object} apierror.Response "Appointment or dentist not found"
+// @Failure 409 {object} apierror.Response "Appointment not cancelled or slot taken by another appointment"
+// @Failure 500 {object} apierror.Response "Failed to rank candidates"
+// @Router /api/v1/dental/appointment/backfill [get]
+func GetBackfillCandidates(w http.ResponseWriter, r *http.Request) {
+	max := defaultBackfillCandidates
+	if s := r.URL.Query().Get("max"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxBackfillCandidates {
+			http.Error(w, fmt.Sprintf("max must be between 1 and %d", maxBackfillCandidates), http.StatusBadRequest)
+			return
+		}
+		max = n
+	}
+	slot, start, excluded, ok := backfillSlot(w, r)
+	if !ok {
+		return
+	}
+	end := start.Add(time.Duration(slot.Duration) * time.Minute)
+	now := time.Now().UTC()
+	if !start.After(now) {
+		http.Error(w, "The slot has already started", http.StatusBadRequest)
+		return
+	}
+
+	dentists, err := batchGetItems[models.Dentist](r.Context(), "Dentists", []string{slot.DentistID})
+	if err != nil {
+		http.Error(w, "Failed to rank candidates", http.StatusInternalServerError)
+		log.Printf("Error fetching dentist %s: %v", slot.DentistID, err)
+		return
+	}
+	if len(dentists) == 0 {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+	dentist := dentists[0]
+
+	appointments, err := paging.ScanAll[models.Appointment](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Appointments"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to rank candidates", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments: %v", err)
+		return
+	}
+	busy := map[string]bool{}     // patients booked at the time of the slot
+	upcoming := map[string]bool{} // patients with an appointment ahead
+	for _, appointment := range appointments {
+		if appointment.IsCancelled() || appointment.ID == slot.AppointmentID {
+			continue
+		}
+		begin, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		finish := begin.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+		if begin.After(now) {
+			upcoming[appointment.PatientID] = true
+		}
+		if !start.Before(finish) || !begin.Before(end) {
+			continue
+		}
+		if appointment.DentistID == slot.DentistID {
+			http.Error(w, "The slot is taken by another appointment", http.StatusConflict)
+			return
+		}
+		busy[appointment.PatientID] = true
+	}
+
+	catalog, err := paging.ScanAll[models.Procedure](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Procedures"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to rank candidates", http.StatusInternalServerError)
+		log.Printf("Error scanning procedures: %v", err)
+		return
+	}
+	procedures := make(map[string]models.Procedure, len(catalog))
+	for _, procedure := range catalog {
+		procedures[procedure.ID] = procedure
+	}
+	fits := func(procedureID string) bool {
+		procedure, ok := procedures[procedureID]
+		if !ok || !dentist.Performs(procedureID) {
+			return false
+		}
+		return (&models.Appointment{Duration: procedure.Duration}).DurationMinutes() <= slot.Duration
+	}
+
+	patients, err := paging.ScanAll[models.Patient](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Patients"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to rank candidates", http.StatusInternalServerError)
+		log.Printf("Error scanning patients: %v", err)
+		return
+	}
+	active := make(map[string]models.Patient, len(patients))
+	for _, patient := range patients {
+		if patient.DeletedAt == "" {
+			active[patient.ID] = patient
+		}
+	}
+
+	best := map[string]models.BackfillCandidate{}
+	offer := func(candidate models.BackfillCandidate) {
+		patient, ok := active[candidate.PatientID]
+		if !ok || candidate.PatientID == excluded || busy[candidate.PatientID] {
+			return
+		}
+		if current, ok := best[candidate.PatientID]; ok && current.Score >= candidate.Score {
+			return
+		}
+		candidate.PatientName = patient.Name
+		candidate.Phone = patient.Phone
+		candidate.Email = patient.Email
+		candidate.Score = math.Round(candidate.Score*10) / 10
+		best[candidate.PatientID] = candidate
+	}
+
+	entries, err := scanWaitlist(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to rank candidates", http.StatusInternalServerError)
+		log.Printf("Error scanning waitlist: %v", err)
+		return
+	}
+	day := start.Format("2006-01-02")
+	for _, entry := range entries {
+		if entry.Status != models.WaitlistWaiting || !entry.Accepts(day) || !fits(entry.ProcedureID) {
+			continue
+		}
+		if entry.DentistID != "" && entry.DentistID != slot.DentistID {
+			continue
+		}
+		offer(scoreWaitlistEntry(entry, slot, start, now))
+	}
+
+	type visit struct {
+		at      time.Time
+		dentist string
+	}
+	last := map[string]visit{}
+	for _, appointment := range appointments {
+		begin, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		switch appointment.Status {
+		case models.AppointmentStatusCompleted:
+			if begin.After(last[appointment.PatientID].at) {
+				last[appointment.PatientID] = visit{begin, appointment.DentistID}
+			}
+		case models.AppointmentStatusScheduled, models.AppointmentStatusConfirmed:
+			if !begin.After(start) || appointment.DurationMinutes() > slot.Duration {
+				continue
+			}
+			if appointment.ProcedureID != "" && !fits(appointment.ProcedureID) {
+				continue
+			}
+			offer(scoreLaterAppointment(appointment, slot, start, begin))
+		}
+	}
+
+	interval := config.EnvInt("RECALL_INTERVAL_DAYS", defaultRecallDays)
+	for patientID, v := range last {
+		due := v.at.AddDate(0, 0, interval)
+		if upcoming[patientID] || due.After(start) {
+			continue
+		}
+		overdue := start.Sub(due).Hours() / 24
+		candidate := models.BackfillCandidate{
+			Source:    models.BackfillRecall,
+			PatientID: patientID,
+			LastVisit: v.at.Format(slotLayout),
+			Score:     recallPoints + overduePoints*math.Min(1, overdue/180),
+			Reasons:   []string{fmt.Sprintf("due for a recall, last visit %s", v.at.Format("2006-01-02"))},
+		}
+		if v.dentist == slot.DentistID {
+			candidate.Score += sameDentistPoints
+			candidate.Reasons = append(candidate.Reasons, "last seen by this dentist")
+		}
+		offer(candidate)
+	}
+
+	candidates := make([]models.BackfillCandidate, 0, len(best))
+	for _, candidate := range best {
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].PatientName < candidates[j].PatientName
+	})
+	if len(candidates) > max {
+		candidates = candidates[:max]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.BackfillCandidates{Slot: slot, Candidates: candidates})
+}
+
+// backfillSlot reads the open slot from the appointmentId parameter, or from
+// dentistId, dateTime and duration, along with its start and the patient
+// who left it. It returns false when the error response was written.
+func backfillSlot(w http.ResponseWriter, r *http.Request) (models.BackfillSlot, time.Time, string, bool) {
+	query := r.URL.Query()
+	if id := query.Get("appointmentId"); id != "" {
+		appointment, ok := loadAppointment(w, r, id)
+		if !ok {
+			return models.BackfillSlot{}, time.Time{}, "", false
+		}
+		if !appointment.IsCancelled() {
+			http.Error(w, "Only cancelled appointments leave a slot open", http.StatusConflict)
+			return models.BackfillSlot{}, time.Time{}, "", false
+		}
+		start, err := appointment.StartTime()
+		if err != nil {
+			http.Error(w, "The appointment has an invalid date and time", http.StatusBadRequest)
+			return models.BackfillSlot{}, time.Time{}, "", false
+		}
+		slot := models.BackfillSlot{
+			DentistID:     appointment.DentistID,
+			DateTime:      start.Format(slotLayout),
+			Duration:      appointment.DurationMinutes(),
+			ProcedureID:   appointment.ProcedureID,
+			AppointmentID: appointment.ID,
+		}
+		return slot, start, appointment.PatientID, true
+	}
+
+	dentistID := query.Get("dentistId")
+	if dentistID == "" || query.Get("dateTime") == "" {
+		http.Error(w, "appointmentId, or dentistId and dateTime, are required", http.StatusBadRequest)
+		return models.BackfillSlot{}, time.Time{}, "", false
+	}
+	start, err := (&models.Appointment{DateTime: query.Get("dateTime")}).StartTime()
+	if err != nil {
+		http.Error(w, "dateTime must be in YYYY-MM-DDTHH:MM format", http.StatusBadRequest)
+		return models.BackfillSlot{}, time.Time{}, "", false
+	}
+	duration := models.DefaultAppointmentDuration
+	if s := query.Get("duration"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 24*60 {
+			http.Error(w, "duration must be a positive number of minutes", http.StatusBadRequest)
+			return models.BackfillSlot{}, time.Time{}, "", false
+		}
+		duration = n
+	}
+	slot := models.BackfillSlot{
+		DentistID: dentistID,
+		DateTime:  start.Format(slotLayout),
+		Duration:  duration,
+	}
+	return slot, start, "", true
+}
+
+// scoreWaitlistEntry builds the candidate of a waitlist entry the slot
+// starting at start suits
+func scoreWaitlistEntry(entry models.WaitlistEntry, slot models.BackfillSlot, start, now time.Time) models.BackfillCandidate {
+	candidate := models.BackfillCandidate{
+		Source:      models.BackfillWaitlist,
+		PatientID:   entry.PatientID,
+		ProcedureID: entry.ProcedureID,
+		EntryID:     entry.ID,
+		Score:       waitlistPoints,
+		Reasons:     []string{"on the waitlist"},
+	}
+	if created, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+		waited := now.Sub(created).Hours() / 24
+		candidate.Score += waitedPoints * math.Min(1, waited/45)
+		if waited >= 1 {
+			candidate.Reasons = append(candidate.Reasons, fmt.Sprintf("waiting for %d days", int(waited)))
+		}
+	}
+
+	period := models.DayPeriod(start)
+	if entry.Preferences.Empty() {
+		candidate.Score += entryPeriodPoints + entryDayPoints
+		candidate.Reasons = append(candidate.Reasons, "accepts any time")
+	} else {
+		if entry.Preferences.HasPeriod(period) {
+			candidate.Score += entryPeriodPoints
+			candidate.Reasons = append(candidate.Reasons, "in the preferred "+period)
+		}
+		if entry.Preferences.HasWeekday(start.Weekday()) {
+			candidate.Score += entryDayPoints
+			candidate.Reasons = append(candidate.Reasons, "on a preferred day")
+		}
+	}
+	if entry.DentistID == slot.DentistID {
+		candidate.Score += sameDentistPoints
+		candidate.Reasons = append(candidate.Reasons, "with the requested dentist")
+	}
+	if slot.ProcedureID != "" && entry.ProcedureID == slot.ProcedureID {
+		candidate.Score += sameProcedurePoints
+		candidate.Reasons = append(candidate.Reasons, "waiting for the same procedure")
+	}
+	return candidate
+}
+
+// scoreLaterAppointment builds the candidate of an appointment starting at
+// begin that could be moved forward to the slot starting at start
+func scoreLaterAppointment(appointment models.Appointment, slot models.BackfillSlot, start, begin time.Time) models.BackfillCandidate {
+	gained := begin.Sub(start).Hours() / 24
+	candidate := models.BackfillCandidate{
+		Source:        models.BackfillEarlier,
+		PatientID:     appointment.PatientID,
+		ProcedureID:   appointment.ProcedureID,
+		AppointmentID: appointment.ID,
+		CurrentTime:   begin.Format(slotLayout),
+		Score:         laterPoints + gainedPoints*math.Min(1, gained/30),
+		Reasons:       []string{fmt.Sprintf("would be seen %s sooner", sooner(begin.Sub(start)))},
+	}
+	if appointment.DentistID == slot.DentistID {
+		candidate.Score += sameDentistPoints
+		candidate.Reasons = append(candidate.Reasons, "already booked with this dentist")
+	}
+	if slot.ProcedureID != "" && appointment.ProcedureID == slot.ProcedureID {
+		candidate.Score += sameProcedurePoints
+		candidate.Reasons = append(candidate.Reasons, "booked for the same procedure")
+	}
+	return candidate
+}
+
+// sooner describes how much sooner a patient would be seen
+func sooner(d time.Duration) string {
+	if days := int(d.Hours() / 24); days > 0 {
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	if hours := int(d.Hours()); hours > 1 {
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return "1 hour"
+}
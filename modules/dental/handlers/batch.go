@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const batchGetMaxAttempts = 5
+
+// BatchGetPatients godoc
+// @Summary Get patients by ID list
+// @Description Get up to 100 patients in a single request. IDs that do not exist are omitted from the response.
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param request body models.BatchGetRequest true "Patient IDs"
+// @Success 200 {array} models.Patient
+// @Failure 400 {object} apierror.Response "Invalid request body or ID list"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patients"
+// @Router /api/v1/dental/patient/batch-get [post]
+func BatchGetPatients(w http.ResponseWriter, r *http.Request) {
+	handleBatchGet[models.Patient](w, r, "Patients", "patients")
+}
+
+// BatchGetDentists godoc
+// @Summary Get dentists by ID list
+// @Description Get up to 100 dentists in a single request. IDs that do not exist are omitted from the response.
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param request body models.BatchGetRequest true "Dentist IDs"
+// @Success 200 {array} models.Dentist
+// @Failure 400 {object} apierror.Response "Invalid request body or ID list"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentists"
+// @Router /api/v1/dental/dentist/batch-get [post]
+func BatchGetDentists(w http.ResponseWriter, r *http.Request) {
+	handleBatchGet[models.Dentist](w, r, "Dentists", "dentists")
+}
+
+// BatchGetProcedures godoc
+// @Summary Get procedures by ID list
+// @Description Get up to 100 procedures in a single request. IDs that do not exist are omitted from the response.
+// @Tags procedures
+// @Accept json
+// @Produce json
+// @Param request body models.BatchGetRequest true "Procedure IDs"
+// @Success 200 {array} models.Procedure
+// @Failure 400 {object} apierror.Response "Invalid request body or ID list"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedures"
+// @Router /api/v1/dental/procedure/batch-get [post]
+func BatchGetProcedures(w http.ResponseWriter, r *http.Request) {
+	handleBatchGet[models.Procedure](w, r, "Procedures", "procedures")
+}
+
+func handleBatchGet[T any](w http.ResponseWriter, r *http.Request, tableName, entity string) {
+	var request models.BatchGetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := batchGetItems[T](r.Context(), tableName, request.IDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve %s", entity), http.StatusInternalServerError)
+		log.Printf("Error batch getting %s: %v", entity, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// batchGetItems fetches items by ID with BatchGetItem, retrying unprocessed
+// keys with exponential backoff. Results follow the order of ids; duplicate
+// ids are requested once.
+func batchGetItems[T any](ctx context.Context, tableName string, ids []string) ([]T, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	requested := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if requested[id] {
+			continue
+		}
+		requested[id] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		})
+	}
+
+	found := make(map[string]map[string]types.AttributeValue, len(ids))
+	request := map[string]types.KeysAndAttributes{tableName: {Keys: keys, ConsistentRead: config.ConsistentRead(ctx)}}
+	backoff := 50 * time.Millisecond
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt == batchGetMaxAttempts {
+			return nil, fmt.Errorf("unprocessed keys remain after %d attempts", batchGetMaxAttempts)
+		}
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		opCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.BatchGetItem(opCtx, &dynamodb.BatchGetItemInput{
+			RequestItems: request,
+		})
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Responses[tableName] {
+			if id, ok := item["ID"].(*types.AttributeValueMemberS); ok {
+				found[id.Value] = item
+			}
+		}
+		request = result.UnprocessedKeys
+	}
+
+	items := make([]T, 0, len(found))
+	for _, id := range ids {
+		item, ok := found[id]
+		if !ok {
+			continue
+		}
+		var v T
+		if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+			log.Printf("Error unmarshaling %s item: %v", tableName, err)
+			continue
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
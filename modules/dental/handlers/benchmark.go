@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"dental-saas/modules/dental/models"
+	financialmodels "dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// minBenchmarkGroupSize is the smallest k accepted; BENCHMARK_MIN_GROUP_SIZE can only raise it
+const minBenchmarkGroupSize = 5
+
+// benchmarkSettingsTable holds the benchmarking opt-in of each clinic, keyed by ClinicID
+const benchmarkSettingsTable = "BenchmarkSettings"
+
+// otherProcedures pools the procedures seen by too few patients to be published
+const otherProcedures = "other"
+
+// GetBenchmarkExport godoc
+// @Summary Export de-identified practice metrics
+// @Description Opt-in export (opt_in in the clinic's benchmark settings) of monthly visit volumes, procedure mix and average ticket for cross-clinic benchmarking. No identifiers leave the clinic: every published group covers at least k distinct patients, smaller months are suppressed and left out of the totals, and rare procedures are pooled into "other".
+// @Tags reports
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Success 200 {object} models.BenchmarkExport
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 403 {object} apierror.Response "Role not allowed or benchmarking export disabled for the clinic"
+// @Failure 500 {object} apierror.Response "Failed to build benchmark export"
+// @Router /api/v1/dental/reports/benchmark [get]
+func GetBenchmarkExport(w http.ResponseWriter, r *http.Request) {
+	settings, err := getBenchmarkSettings(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to build benchmark export", http.StatusInternalServerError)
+		log.Printf("Error fetching benchmark settings: %v", err)
+		return
+	}
+	if !settings.OptIn {
+		http.Error(w, "Benchmarking export is disabled; an admin can opt the clinic in at /api/v1/dental/reports/benchmark/settings", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := parseReportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	k := config.EnvInt("BENCHMARK_MIN_GROUP_SIZE", minBenchmarkGroupSize)
+	if k < minBenchmarkGroupSize {
+		k = minBenchmarkGroupSize
+	}
+
+	appointments, err := scanAppointmentsInRange(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to build benchmark export", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments for benchmark export: %v", err)
+		return
+	}
+
+	revenues, err := paging.ScanAll[financialmodels.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("attribute_exists(AppointmentID) AND PaymentStatus = :paid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":paid": &types.AttributeValueMemberS{Value: string(financialmodels.PaymentStatusPaid)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to build benchmark export", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues for benchmark export: %v", err)
+		return
+	}
+	revenueByAppointment := make(map[string]float64)
+	for _, revenue := range revenues {
+		revenueByAppointment[revenue.AppointmentID] += revenue.Amount
+	}
+
+	months := make(map[string]*benchmarkGroup)
+	monthOf := make(map[string]string)
+	var completed []models.Appointment
+	for _, appointment := range appointments {
+		if appointment.Status != models.AppointmentStatusCompleted {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		month := start.Format("2006-01")
+		if months[month] == nil {
+			months[month] = newBenchmarkGroup()
+		}
+		months[month].addVisit(appointment.PatientID)
+		if amount, ok := revenueByAppointment[appointment.ID]; ok {
+			months[month].addTicket(appointment.PatientID, amount)
+		}
+		monthOf[appointment.ID] = month
+		completed = append(completed, appointment)
+	}
+
+	// The mix only covers published months, so suppressed months cannot be recovered from it
+	procedures := make(map[string]*benchmarkGroup)
+	var procedureIDs []string
+	for _, appointment := range completed {
+		if len(months[monthOf[appointment.ID]].patients) < k {
+			continue
+		}
+		if procedures[appointment.ProcedureID] == nil {
+			procedures[appointment.ProcedureID] = newBenchmarkGroup()
+			if appointment.ProcedureID != "" {
+				procedureIDs = append(procedureIDs, appointment.ProcedureID)
+			}
+		}
+		procedures[appointment.ProcedureID].addVisit(appointment.PatientID)
+	}
+
+	names := make(map[string]string)
+	if len(procedureIDs) > 0 {
+		found, err := batchGetItems[models.Procedure](r.Context(), "Procedures", procedureIDs)
+		if err != nil {
+			http.Error(w, "Failed to build benchmark export", http.StatusInternalServerError)
+			log.Printf("Error fetching procedures for benchmark export: %v", err)
+			return
+		}
+		for _, procedure := range found {
+			names[procedure.ID] = strings.ToLower(strings.TrimSpace(procedure.Name))
+		}
+	}
+
+	export := models.BenchmarkExport{
+		ClinicToken:  clinicToken(config.ClinicID(r.Context())),
+		From:         from.Format("2006-01-02"),
+		To:           to.Format("2006-01-02"),
+		MinGroupSize: k,
+		Periods:      []models.BenchmarkPeriod{},
+	}
+
+	total := newBenchmarkGroup()
+	for month, group := range months {
+		period := models.BenchmarkPeriod{Period: month}
+		if len(group.patients) < k {
+			period.Suppressed = true
+			export.Periods = append(export.Periods, period)
+			continue
+		}
+		visits := group.visits
+		period.Visits = &visits
+		if len(group.payingPatients) >= k {
+			ticket := group.averageTicket()
+			period.AverageTicket = &ticket
+			total.merge(group, true)
+		} else {
+			total.merge(group, false)
+		}
+		export.Periods = append(export.Periods, period)
+	}
+	sort.Slice(export.Periods, func(i, j int) bool {
+		return export.Periods[i].Period < export.Periods[j].Period
+	})
+
+	export.Totals.Visits = total.visits
+	if len(total.payingPatients) >= k {
+		ticket := total.averageTicket()
+		export.Totals.AverageTicket = &ticket
+	}
+
+	export.ProcedureMix = procedureMix(procedures, names, k)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
+// procedureMix returns the share of visits per procedure name. Procedures
+// seen by fewer than k patients are pooled into "other"; when "other" itself
+// stays below k the smallest published procedures join it, so no published
+// figure, including the pool, rests on fewer than k patients.
+func procedureMix(procedures map[string]*benchmarkGroup, names map[string]string, k int) []models.BenchmarkProcedureShare {
+	byName := make(map[string]*benchmarkGroup)
+	for id, group := range procedures {
+		name := names[id]
+		if name == "" {
+			name = otherProcedures
+		}
+		if byName[name] == nil {
+			byName[name] = newBenchmarkGroup()
+		}
+		byName[name].merge(group, false)
+	}
+
+	other := newBenchmarkGroup()
+	var published []string
+	for name, group := range byName {
+		if name == otherProcedures || len(group.patients) < k {
+			other.merge(group, false)
+			continue
+		}
+		published = append(published, name)
+	}
+	sort.Slice(published, func(i, j int) bool {
+		return byName[published[i]].visits > byName[published[j]].visits
+	})
+	for other.visits > 0 && len(other.patients) < k && len(published) > 0 {
+		smallest := published[len(published)-1]
+		published = published[:len(published)-1]
+		other.merge(byName[smallest], false)
+	}
+
+	visits := other.visits
+	for _, name := range published {
+		visits += byName[name].visits
+	}
+
+	mix := []models.BenchmarkProcedureShare{}
+	if visits == 0 || (other.visits > 0 && len(other.patients) < k) {
+		return mix
+	}
+	for _, name := range published {
+		mix = append(mix, models.BenchmarkProcedureShare{
+			Procedure: name,
+			Share:     utilization(byName[name].visits, visits),
+		})
+	}
+	if other.visits > 0 {
+		mix = append(mix, models.BenchmarkProcedureShare{
+			Procedure: otherProcedures,
+			Share:     utilization(other.visits, visits),
+		})
+	}
+	return mix
+}
+
+// clinicToken returns a stable pseudonym of the clinic derived from
+// BENCHMARK_SALT, so the receiver can tell exports of the same clinic apart
+// without learning which clinic it is. Without a salt no token is sent.
+func clinicToken(clinicID string) string {
+	salt := os.Getenv("BENCHMARK_SALT")
+	if salt == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + ":" + clinicID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// benchmarkGroup tallies visits and paid tickets of a group together with the
+// distinct patients behind them, which decide whether the group may be published
+type benchmarkGroup struct {
+	visits         int
+	patients       map[string]bool
+	tickets        int
+	revenue        float64
+	payingPatients map[string]bool
+}
+
+func newBenchmarkGroup() *benchmarkGroup {
+	return &benchmarkGroup{patients: make(map[string]bool), payingPatients: make(map[string]bool)}
+}
+
+func (g *benchmarkGroup) addVisit(patientID string) {
+	g.visits++
+	g.patients[patientID] = true
+}
+
+func (g *benchmarkGroup) addTicket(patientID string, amount float64) {
+	g.tickets++
+	g.revenue += amount
+	g.payingPatients[patientID] = true
+}
+
+// merge adds other's visits and, when withTickets is set, its paid tickets
+func (g *benchmarkGroup) merge(other *benchmarkGroup, withTickets bool) {
+	g.visits += other.visits
+	for id := range other.patients {
+		g.patients[id] = true
+	}
+	if !withTickets {
+		return
+	}
+	g.tickets += other.tickets
+	g.revenue += other.revenue
+	for id := range other.payingPatients {
+		g.payingPatients[id] = true
+	}
+}
+
+func (g *benchmarkGroup) averageTicket() float64 {
+	if g.tickets == 0 {
+		return 0
+	}
+	return math.Round(g.revenue/float64(g.tickets)*100) / 100
+}
+
+// GetBenchmarkSettings godoc
+// @Summary Get the benchmarking opt-in
+// @Description Get whether the clinic opted in to export its de-identified practice metrics. Clinics that never configured it do not export them.
+// @Tags reports
+// @Produce json
+// @Success 200 {object} models.BenchmarkSettings
+// @Failure 500 {object} apierror.Response "Failed to retrieve benchmark settings"
+// @Router /api/v1/dental/reports/benchmark/settings [get]
+func GetBenchmarkSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := getBenchmarkSettings(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve benchmark settings", http.StatusInternalServerError)
+		log.Printf("Error fetching benchmark settings: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateBenchmarkSettings godoc
+// @Summary Opt in or out of benchmarking
+// @Description Opt the clinic in or out of the export of de-identified practice metrics for cross-clinic benchmarking
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param settings body models.BenchmarkSettings true "Benchmark settings"
+// @Success 200 {object} models.BenchmarkSettings
+// @Failure 400 {object} apierror.Response "Invalid request body"
+// @Failure 500 {object} apierror.Response "Failed to save benchmark settings"
+// @Router /api/v1/dental/reports/benchmark/settings [put]
+func UpdateBenchmarkSettings(w http.ResponseWriter, r *http.Request) {
+	var settings models.BenchmarkSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings.ClinicID = config.ClinicID(r.Context())
+	settings.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		http.Error(w, "Failed to save benchmark settings", http.StatusInternalServerError)
+		log.Printf("Error marshaling benchmark settings: %v", err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(benchmarkSettingsTable),
+		Item:      item,
+	})
+	if err != nil {
+		http.Error(w, "Failed to save benchmark settings", http.StatusInternalServerError)
+		log.Printf("Error saving benchmark settings: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// getBenchmarkSettings returns the benchmark settings of a clinic, opted out
+// when it has none
+func getBenchmarkSettings(ctx context.Context, clinicID string) (models.BenchmarkSettings, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(benchmarkSettingsTable),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	if err != nil {
+		return models.BenchmarkSettings{}, err
+	}
+	settings := models.BenchmarkSettings{ClinicID: clinicID}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+			return models.BenchmarkSettings{}, err
+		}
+	}
+	return settings, nil
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/modules/dental/selfservice"
+	financialmodels "dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// CreateBooking godoc
+// @Summary Book an appointment online
+// @Description Public booking endpoint used by the clinic website and landing pages. The patient is matched by email or created, and the utm_source, utm_medium and utm_campaign parameters (from the body or the query string) are recorded on the appointment and, on the first booking, on the patient.
+// @Tags bookings
+// @Accept json
+// @Produce json
+// @Param X-Clinic-ID header string false "Clinic being booked, the default clinic when absent"
+// @Param booking body models.BookingRequest true "Patient contact, dentist, date and optional UTM parameters"
+// @Param utm_source query string false "Campaign source, used when absent from the body"
+// @Param utm_medium query string false "Campaign medium, used when absent from the body"
+// @Param utm_campaign query string false "Campaign name, used when absent from the body"
+// @Success 201 {object} models.Appointment
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 409 {object} apierror.Response "Pre-authorization missing"
+// @Failure 422 {object} apierror.Response "Dentist not credentialed for the procedure"
+// @Failure 500 {object} apierror.Response "Failed to book appointment"
+// @Router /api/v1/dental/booking [post]
+func CreateBooking(w http.ResponseWriter, r *http.Request) {
+	var booking models.BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	booking.Email = strings.ToLower(strings.TrimSpace(booking.Email))
+	if err := booking.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Landing pages usually forward the UTM parameters of their own URL
+	query := r.URL.Query()
+	if booking.UTMSource == "" {
+		booking.UTMSource = query.Get("utm_source")
+	}
+	if booking.UTMMedium == "" {
+		booking.UTMMedium = query.Get("utm_medium")
+	}
+	if booking.UTMCampaign == "" {
+		booking.UTMCampaign = query.Get("utm_campaign")
+	}
+
+	exists, err := itemExists(r.Context(), "Dentists", booking.DentistID)
+	if err != nil {
+		http.Error(w, "Failed to book appointment", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", booking.DentistID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+
+	patient, err := bookingPatient(r.Context(), booking)
+	if err != nil {
+		http.Error(w, "Failed to book appointment", http.StatusInternalServerError)
+		log.Printf("Error resolving patient for online booking: %v", err)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	appointment := models.Appointment{
+		ID:                  uuid.NewString(),
+		DentistID:           booking.DentistID,
+		PatientID:           patient.ID,
+		ProcedureID:         booking.ProcedureID,
+		DateTime:            booking.DateTime,
+		Status:              models.AppointmentStatusScheduled,
+		Notes:               booking.Notes,
+		CreatedAt:           now,
+		UpdatedAt:           now,
+		CampaignAttribution: booking.CampaignAttribution,
+	}
+	if !checkDentistPerforms(w, r, appointment) {
+		return
+	}
+	if !checkPreAuth(w, r, appointment) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Appointments"),
+		Item:                repository.AppointmentItem(appointment),
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}); err != nil {
+		http.Error(w, "Failed to book appointment", http.StatusInternalServerError)
+		log.Printf("Error saving online booking: %v", err)
+		return
+	}
+
+	if day, ok := appointmentDay(appointment.DateTime); ok {
+		counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), day), 1)
+		invalidateAgenda(r.Context(), day)
+	}
+
+	emailAppointmentUpdate(r.Context(), selfservice.KindConfirmation, appointment, "")
+	webhooks.Publish(r.Context(), webhooks.EventAppointmentCreated, appointment)
+	appointment.Patient = &patient
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(appointment)
+}
+
+// GetBookingSlots godoc
+// @Summary Search free slots for online booking
+// @Description Public endpoint listing the free start times, within clinic hours, of the dentists credentialed to perform a procedure, for an appointment of the procedure's duration. Without procedureId every dentist is listed with the default duration.
+// @Tags bookings
+// @Produce json
+// @Param X-Clinic-ID header string false "Clinic being booked, the default clinic when absent"
+// @Param procedureId query string false "Procedure to book"
+// @Param dentistId query string false "Only this dentist"
+// @Param from query string false "First day (YYYY-MM-DD), defaults to today"
+// @Param days query int false "Number of days to list, up to 30 (default 7)"
+// @Success 200 {object} models.BookingSlots
+// @Failure 400 {object} apierror.Response "Invalid from or days"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to list slots"
+// @Router /api/v1/dental/booking/slots [get]
+func GetBookingSlots(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := slotRange(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	result := models.BookingSlots{
+		ProcedureID: query.Get("procedureId"),
+		Duration:    models.DefaultAppointmentDuration,
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Dentists:    []models.DentistSlots{},
+	}
+
+	if result.ProcedureID != "" {
+		procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", []string{result.ProcedureID})
+		if err != nil {
+			http.Error(w, "Failed to list slots", http.StatusInternalServerError)
+			log.Printf("Error fetching procedure %s: %v", result.ProcedureID, err)
+			return
+		}
+		if len(procedures) == 0 {
+			http.Error(w, "Procedure not found", http.StatusNotFound)
+			return
+		}
+		result.Duration = (&models.Appointment{Duration: procedures[0].Duration}).DurationMinutes()
+	}
+
+	dentists, err := paging.ScanAll[models.Dentist](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Dentists"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to list slots", http.StatusInternalServerError)
+		log.Printf("Error scanning dentists: %v", err)
+		return
+	}
+	sort.Slice(dentists, func(i, j int) bool {
+		return dentists[i].Name < dentists[j].Name
+	})
+	for _, dentist := range dentists {
+		if id := query.Get("dentistId"); id != "" && dentist.ID != id {
+			continue
+		}
+		if result.ProcedureID != "" && !dentist.Performs(result.ProcedureID) {
+			continue
+		}
+		slots, err := availableSlots(r.Context(), dentist.ID, from, to, result.Duration, "")
+		if err != nil {
+			http.Error(w, "Failed to list slots", http.StatusInternalServerError)
+			log.Printf("Error listing slots of dentist %s: %v", dentist.ID, err)
+			return
+		}
+		result.Dentists = append(result.Dentists, models.DentistSlots{
+			DentistID:   dentist.ID,
+			DentistName: dentist.Name,
+			Slots:       slots,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// bookingPatient finds the patient of an online booking by email or creates
+// it. Attribution is first-touch: an existing patient only receives the UTM
+// parameters when none were recorded before.
+func bookingPatient(ctx context.Context, booking models.BookingRequest) (models.Patient, error) {
+	patients, err := Patients.FindByEmail(ctx, booking.Email)
+	if err != nil {
+		return models.Patient{}, err
+	}
+
+	if len(patients) > 0 {
+		patient := patients[0]
+		if patient.HasCampaign() || !booking.HasCampaign() {
+			return patient, nil
+		}
+
+		patient.CampaignAttribution = booking.CampaignAttribution
+		return Patients.Save(ctx, patient)
+	}
+
+	patient, err := Patients.Create(ctx, models.Patient{
+		Name:                booking.Name,
+		Email:               booking.Email,
+		Phone:               booking.Phone,
+		CampaignAttribution: booking.CampaignAttribution,
+	})
+	if err != nil {
+		return models.Patient{}, err
+	}
+
+	counters.IncrementAsync(ctx, counters.PatientsCounter(config.ClinicID(ctx)), 1)
+	return patient, nil
+}
+
+// GetCampaignReport godoc
+// @Summary Get marketing campaign performance
+// @Description Get bookings, show rate and paid revenue per UTM campaign for appointments scheduled in a date range. Show rate is completed appointments over completed plus no-shows; revenue sums paid revenues linked to the campaign's appointments.
+// @Tags reports
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Success 200 {object} models.CampaignReport
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 500 {object} apierror.Response "Failed to build campaign report"
+// @Router /api/v1/dental/reports/campaigns [get]
+func GetCampaignReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, to, err := parseReportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	appointments, err := scanAppointmentsInRange(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to build campaign report", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments for campaign report: %v", err)
+		return
+	}
+
+	revenues, err := paging.ScanAll[financialmodels.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("attribute_exists(AppointmentID) AND PaymentStatus = :paid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":paid": &types.AttributeValueMemberS{Value: string(financialmodels.PaymentStatusPaid)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to build campaign report", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues for campaign report: %v", err)
+		return
+	}
+	revenueByAppointment := make(map[string]float64)
+	for _, revenue := range revenues {
+		revenueByAppointment[revenue.AppointmentID] += revenue.Amount
+	}
+
+	campaigns := make(map[models.CampaignAttribution]*models.CampaignPerformance)
+	for _, appointment := range appointments {
+		if !appointment.HasCampaign() {
+			continue
+		}
+		performance, ok := campaigns[appointment.CampaignAttribution]
+		if !ok {
+			performance = &models.CampaignPerformance{CampaignAttribution: appointment.CampaignAttribution}
+			campaigns[appointment.CampaignAttribution] = performance
+		}
+
+		performance.Bookings++
+		switch {
+		case appointment.Status == models.AppointmentStatusCompleted:
+			performance.Completed++
+		case appointment.Status == models.AppointmentStatusNoShow:
+			performance.NoShows++
+		case appointment.IsCancelled():
+			performance.Cancelled++
+		}
+		performance.Revenue += revenueByAppointment[appointment.ID]
+	}
+
+	report := models.CampaignReport{
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		Campaigns: []models.CampaignPerformance{},
+	}
+	for _, performance := range campaigns {
+		performance.ShowRate = utilization(performance.Completed, performance.Completed+performance.NoShows)
+		performance.Revenue = math.Round(performance.Revenue*100) / 100
+		report.Campaigns = append(report.Campaigns, *performance)
+	}
+
+	sort.Slice(report.Campaigns, func(i, j int) bool {
+		if report.Campaigns[i].Bookings != report.Campaigns[j].Bookings {
+			return report.Campaigns[i].Bookings > report.Campaigns[j].Bookings
+		}
+		return report.Campaigns[i].UTMCampaign < report.Campaigns[j].UTMCampaign
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxSeriesAppointments is bounded by the 100 items of a DynamoDB transaction
+const maxSeriesAppointments = 100
+
+// CreateBundle godoc
+// @Summary Create a procedure bundle
+// @Description Create a package of catalog procedures sold at a combined price (e.g. whitening + cleaning)
+// @Tags bundles
+// @Accept json
+// @Produce json
+// @Param bundle body models.Bundle true "Bundle data"
+// @Success 201 {object} models.Bundle
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or unknown procedures"
+// @Failure 500 {object} apierror.Response "Failed to save bundle"
+// @Router /api/v1/dental/bundle [post]
+func CreateBundle(w http.ResponseWriter, r *http.Request) {
+	var bundle models.Bundle
+	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	bundle.ID = uuid.NewString()
+	if err := bundle.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !bundleProceduresExist(w, r, bundle) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	bundle.CreatedAt = now
+	bundle.UpdatedAt = now
+
+	if err := putBundle(r, bundle, true); err != nil {
+		http.Error(w, "Failed to save bundle", http.StatusInternalServerError)
+		log.Printf("Error saving bundle: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bundle)
+}
+
+// GetAllBundles godoc
+// @Summary Get all procedure bundles
+// @Description Get a list of all procedure bundles
+// @Tags bundles
+// @Produce json
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Bundle
+// @Failure 500 {object} apierror.Response "Failed to retrieve bundles"
+// @Router /api/v1/dental/bundle [get]
+func GetAllBundles(w http.ResponseWriter, r *http.Request) {
+	page := paging.Request(r)
+	bundles, next, err := paging.Scan[models.Bundle](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Bundles"),
+	}, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve bundles", http.StatusInternalServerError)
+		log.Printf("Error scanning bundles: %v", err)
+		return
+	}
+
+	paging.Write(w, page, bundles, next)
+}
+
+// GetBundleByID godoc
+// @Summary Get procedure bundle by ID
+// @Description Get a procedure bundle by its ID
+// @Tags bundles
+// @Produce json
+// @Param id path string true "Bundle ID"
+// @Success 200 {object} models.Bundle
+// @Failure 404 {object} apierror.Response "Bundle not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve bundle"
+// @Router /api/v1/dental/bundle/{id} [get]
+func GetBundleByID(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := loadBundle(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundle)
+}
+
+// UpdateBundle godoc
+// @Summary Update a procedure bundle
+// @Description Update the name, description, price or procedures of a bundle. Series already booked keep their prices.
+// @Tags bundles
+// @Accept json
+// @Produce json
+// @Param id path string true "Bundle ID"
+// @Param If-Match header string false "Version of the bundle being replaced; required unless the body has it"
+// @Param bundle body models.Bundle true "Updated bundle data"
+// @Success 200 {object} models.Bundle
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or unknown procedures"
+// @Failure 404 {object} apierror.Response "Bundle not found"
+// @Failure 409 {object} apierror.Response "Bundle was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the bundle is required"
+// @Failure 500 {object} apierror.Response "Failed to update bundle"
+// @Router /api/v1/dental/bundle/{id} [put]
+func UpdateBundle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Bundles", id)
+	if !ok {
+		return
+	}
+	current, ok := loadBundle(w, r, id)
+	if !ok {
+		return
+	}
+
+	var updatedData models.Bundle
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Name != "" {
+		current.Name = updatedData.Name
+	}
+	if updatedData.Description != "" {
+		current.Description = updatedData.Description
+	}
+	if updatedData.Price != "" {
+		current.Price = updatedData.Price
+	}
+	if len(updatedData.Items) > 0 {
+		current.Items = updatedData.Items
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !bundleProceduresExist(w, r, current) {
+		return
+	}
+	current.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putBundle(r, current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Bundle not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update bundle", http.StatusInternalServerError)
+		log.Printf("Error updating bundle: %v", err)
+		return
+	}
+	current.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteBundle godoc
+// @Summary Delete a procedure bundle
+// @Description Delete a procedure bundle by its ID. Series already booked are kept.
+// @Tags bundles
+// @Param id path string true "Bundle ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Bundle not found"
+// @Failure 500 {object} apierror.Response "Failed to delete bundle"
+// @Router /api/v1/dental/bundle/{id} [delete]
+func DeleteBundle(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Bundles"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: mux.Vars(r)["id"]},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Bundle not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete bundle", http.StatusInternalServerError)
+		log.Printf("Error deleting bundle: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BookBundle godoc
+// @Summary Book a bundle as an appointment series
+// @Description Create one appointment per procedure of the bundle, sharing a series ID. Procedures are booked back to back from start, or days_apart days from each other. The bundle price is split across the appointments in proportion to each procedure's effective price, so every performed procedure is recorded individually.
+// @Tags bundles
+// @Accept json
+// @Produce json
+// @Param id path string true "Bundle ID"
+// @Param booking body models.BundleBookingRequest true "Patient, dentist and start of the series"
+// @Success 201 {object} models.BundleSeries
+// @Failure 400 {object} apierror.Response "Invalid request body or missing fields"
+// @Failure 404 {object} apierror.Response "Bundle not found"
+// @Failure 409 {object} apierror.Response "Pre-authorization missing"
+// @Failure 422 {object} apierror.Response "Dentist not credentialed for the procedure"
+// @Failure 500 {object} apierror.Response "Failed to book bundle"
+// @Router /api/v1/dental/bundle/{id}/book [post]
+func BookBundle(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := loadBundle(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var booking models.BundleBookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := booking.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, _ := (&models.Appointment{DateTime: booking.Start}).StartTime()
+
+	var procedureIDs []string
+	for _, item := range bundle.Items {
+		for i := 0; i < item.Quantity; i++ {
+			procedureIDs = append(procedureIDs, item.ProcedureID)
+		}
+	}
+	if len(procedureIDs) > maxSeriesAppointments {
+		http.Error(w, "Bundle has too many procedures to book at once", http.StatusBadRequest)
+		return
+	}
+
+	procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", procedureIDs)
+	if err != nil {
+		http.Error(w, "Failed to book bundle", http.StatusInternalServerError)
+		log.Printf("Error loading procedures of bundle %s: %v", bundle.ID, err)
+		return
+	}
+	byID := make(map[string]models.Procedure, len(procedures))
+	for _, procedure := range procedures {
+		byID[procedure.ID] = procedure
+	}
+
+	// Weight each appointment by the price the dentist would charge on its own
+	weights := make([]float64, len(procedureIDs))
+	for i, procedureID := range procedureIDs {
+		price, err := pricing.Resolve(r.Context(), procedureID, booking.DentistID, start)
+		if err != nil && !errors.Is(err, pricing.ErrProcedureNotFound) {
+			http.Error(w, "Failed to book bundle", http.StatusInternalServerError)
+			log.Printf("Error resolving price of procedure %s: %v", procedureID, err)
+			return
+		}
+		weights[i] = price.Amount
+	}
+	bundlePrice, _ := bundle.PriceValue()
+	shares := splitPrice(bundlePrice, weights)
+
+	series := models.BundleSeries{
+		SeriesID: uuid.NewString(),
+		BundleID: bundle.ID,
+		Price:    bundle.Price,
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	at := start
+	var writes []types.TransactWriteItem
+	for i, procedureID := range procedureIDs {
+		appointment := models.Appointment{
+			ID:          uuid.NewString(),
+			DentistID:   booking.DentistID,
+			PatientID:   booking.PatientID,
+			ProcedureID: procedureID,
+			DateTime:    at.Format("2006-01-02T15:04:05"),
+			Duration:    byID[procedureID].Duration,
+			Status:      models.AppointmentStatusScheduled,
+			Notes:       booking.Notes,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			BundleID:    bundle.ID,
+			SeriesID:    series.SeriesID,
+			Price:       models.FormatPrice(shares[i]),
+		}
+		series.Appointments = append(series.Appointments, appointment)
+		writes = append(writes, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String("Appointments"),
+				Item:                repository.AppointmentItem(appointment),
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
+			},
+		})
+
+		if booking.DaysApart > 0 {
+			at = at.AddDate(0, 0, booking.DaysApart)
+		} else {
+			at = at.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+		}
+	}
+
+	if !checkDentistPerforms(w, r, series.Appointments...) {
+		return
+	}
+	if !checkPreAuth(w, r, series.Appointments...) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	if _, err := config.DBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	}); err != nil {
+		http.Error(w, "Failed to book bundle", http.StatusInternalServerError)
+		log.Printf("Error saving appointment series of bundle %s: %v", bundle.ID, err)
+		return
+	}
+
+	for _, appointment := range series.Appointments {
+		if day, ok := appointmentDay(appointment.DateTime); ok {
+			counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), day), 1)
+			invalidateAgenda(r.Context(), day)
+		}
+		webhooks.Publish(r.Context(), webhooks.EventAppointmentCreated, appointment)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(series)
+}
+
+// GetAppointmentSeries godoc
+// @Summary Get an appointment series
+// @Description Get the appointments booked together from a bundle
+// @Tags appointments
+// @Produce json
+// @Param seriesId path string true "Series ID"
+// @Success 200 {array} models.Appointment
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointment series"
+// @Router /api/v1/dental/appointment/series/{seriesId} [get]
+func GetAppointmentSeries(w http.ResponseWriter, r *http.Request) {
+	seriesID := mux.Vars(r)["seriesId"]
+
+	appointments, err := paging.ScanAll[models.Appointment](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Appointments"),
+		FilterExpression: aws.String("SeriesID = :seriesId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":seriesId": &types.AttributeValueMemberS{Value: seriesID},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment series", http.StatusInternalServerError)
+		log.Printf("Error scanning appointment series %s: %v", seriesID, err)
+		return
+	}
+	if appointments == nil {
+		appointments = []models.Appointment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appointments)
+}
+
+// splitPrice divides total across weights in proportion, rounding to cents
+// and giving the rounding remainder to the last share. Equal shares are used
+// when no weight is positive.
+func splitPrice(total float64, weights []float64) []float64 {
+	shares := make([]float64, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	sum := 0.0
+	for _, weight := range weights {
+		if weight > 0 {
+			sum += weight
+		}
+	}
+
+	allocated := 0.0
+	for i, weight := range weights {
+		if i == len(weights)-1 {
+			shares[i] = math.Round((total-allocated)*100) / 100
+			break
+		}
+		share := total / float64(len(weights))
+		if sum > 0 {
+			share = total * math.Max(weight, 0) / sum
+		}
+		shares[i] = math.Round(share*100) / 100
+		allocated += shares[i]
+	}
+	return shares
+}
+
+// loadBundle fetches a bundle, writing the error response when it fails
+func loadBundle(w http.ResponseWriter, r *http.Request, id string) (models.Bundle, bool) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Bundles"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve bundle", http.StatusInternalServerError)
+		log.Printf("Error fetching bundle with ID %s: %v", id, err)
+		return models.Bundle{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Bundle not found", http.StatusNotFound)
+		return models.Bundle{}, false
+	}
+
+	var bundle models.Bundle
+	if err := attributevalue.UnmarshalMap(result.Item, &bundle); err != nil {
+		http.Error(w, "Failed to unmarshal bundle data", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling bundle data: %v", err)
+		return models.Bundle{}, false
+	}
+	return bundle, true
+}
+
+// bundleProceduresExist checks every procedure of the bundle is in the catalog,
+// writing the error response when one is missing
+func bundleProceduresExist(w http.ResponseWriter, r *http.Request, bundle models.Bundle) bool {
+	ids := make([]string, len(bundle.Items))
+	for i, item := range bundle.Items {
+		ids[i] = item.ProcedureID
+	}
+	procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", ids)
+	if err != nil {
+		http.Error(w, "Failed to retrieve procedures", http.StatusInternalServerError)
+		log.Printf("Error loading bundle procedures: %v", err)
+		return false
+	}
+	found := make(map[string]bool, len(procedures))
+	for _, procedure := range procedures {
+		found[procedure.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			http.Error(w, "Procedure "+strconv.Quote(id)+" not found", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+func putBundle(r *http.Request, bundle models.Bundle, create bool) error {
+	item, err := attributevalue.MarshalMap(bundle)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Bundles"),
+		Item:      item,
+	}, create)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxCalendarDays bounds the range of a calendar request, about two months
+// so a month view with the surrounding weeks fits in one request
+const maxCalendarDays = 62
+
+// GetAppointmentCalendar godoc
+// @Summary Get the appointment calendar of a date range
+// @Description Get the appointments between two dates grouped by day, every day of the range included, with each day's appointments sorted by time. Appointments are read from the DateTime index of each dentist instead of scanning the whole table.
+// @Tags appointments
+// @Produce json
+// @Param from query string true "First day (YYYY-MM-DD)"
+// @Param to query string true "Last day (YYYY-MM-DD), inclusive, at most 62 days after from"
+// @Param dentistId query string false "Only appointments of this dentist"
+// @Param expand query string false "Comma-separated related entities to embed: patient, dentist, procedure"
+// @Success 200 {array} models.CalendarDay
+// @Failure 400 {object} apierror.Response "Invalid date range or expand parameter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve calendar"
+// @Router /api/v1/dental/appointment/calendar [get]
+// @Router /api/v1/dental/appointments/calendar [get]
+func GetAppointmentCalendar(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, to, err := parseReportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxCalendarDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("date range must not exceed %d days", maxCalendarDays), http.StatusBadRequest)
+		return
+	}
+	expand, err := parseExpand(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dentistIDs := []string{query.Get("dentistId")}
+	if dentistIDs[0] == "" {
+		if dentistIDs, err = calendarDentists(r.Context()); err != nil {
+			http.Error(w, "Failed to retrieve calendar", http.StatusInternalServerError)
+			log.Printf("Error scanning dentists for calendar: %v", err)
+			return
+		}
+	}
+
+	var appointments []models.Appointment
+	for _, dentistID := range dentistIDs {
+		found, err := queryAppointmentsInRange(r.Context(), dentistID, from, to)
+		if err != nil {
+			http.Error(w, "Failed to retrieve calendar", http.StatusInternalServerError)
+			log.Printf("Error querying calendar of dentist %s: %v", dentistID, err)
+			return
+		}
+		appointments = append(appointments, found...)
+	}
+	if err := expandAppointments(r.Context(), appointments, expand); err != nil {
+		http.Error(w, "Failed to expand appointments", http.StatusInternalServerError)
+		log.Printf("Error expanding appointments: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendarDays(appointments, from, to))
+}
+
+// calendarDentists returns the IDs of the clinic's dentists, those removed
+// included so their appointments still show
+func calendarDentists(ctx context.Context) ([]string, error) {
+	dentists, err := paging.ScanAll[models.Dentist](config.WithDeleted(ctx, true), &dynamodb.ScanInput{
+		TableName:            aws.String("Dentists"),
+		ProjectionExpression: aws.String("ID"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(dentists))
+	for _, dentist := range dentists {
+		ids = append(ids, dentist.ID)
+	}
+	return ids, nil
+}
+
+// queryAppointmentsInRange reads a dentist's appointments whose DateTime
+// falls between from and to (both inclusive dates)
+func queryAppointmentsInRange(ctx context.Context, dentistID string, from, to time.Time) ([]models.Appointment, error) {
+	return queryItems[models.Appointment](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("Appointments"),
+		IndexName:              aws.String(config.AppointmentsByDentistTimeIndex),
+		KeyConditionExpression: aws.String("DentistID = :dentistId AND #dt BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]string{
+			"#dt": "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dentistId": &types.AttributeValueMemberS{Value: dentistID},
+			":from":      &types.AttributeValueMemberS{Value: from.Format("2006-01-02")},
+			// The next day sorts after every time of the last one
+			":to": &types.AttributeValueMemberS{Value: to.AddDate(0, 0, 1).Format("2006-01-02")},
+		},
+	})
+}
+
+// calendarDays groups appointments by day, one entry per day from from to
+// to, each day sorted by time
+func calendarDays(appointments []models.Appointment, from, to time.Time) []models.CalendarDay {
+	byDay := map[string][]models.Appointment{}
+	for _, appointment := range appointments {
+		day := appointment.Day()
+		byDay[day] = append(byDay[day], appointment)
+	}
+
+	days := []models.CalendarDay{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		dayAppointments := byDay[date]
+		if dayAppointments == nil {
+			dayAppointments = []models.Appointment{}
+		}
+		sort.Slice(dayAppointments, func(i, j int) bool {
+			return dayAppointments[i].DateTime < dayAppointments[j].DateTime
+		})
+		days = append(days, models.CalendarDay{Date: date, Appointments: dayAppointments})
+	}
+	return days
+}
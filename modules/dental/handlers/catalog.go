@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/catalog"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+)
+
+// GetCatalogTemplates godoc
+// @Summary List procedure catalog templates
+// @Description List the bundled standard procedure catalogs (general dentistry, orthodontics, implants) that can be applied to the clinic
+// @Tags procedures
+// @Produce json
+// @Success 200 {array} models.CatalogTemplate
+// @Router /api/v1/dental/procedure/catalog/templates [get]
+func GetCatalogTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(catalog.Templates())
+}
+
+// ApplyCatalogTemplate godoc
+// @Summary Apply a procedure catalog template
+// @Description Create or update the procedures of a bundled catalog. Applying the same template again is idempotent: procedures already matching the template (with the given price overrides) are left unchanged. Translations, tags and the pre-authorization and consent requirements set by the clinic are kept. With dry_run=true the planned changes are returned without writing.
+// @Tags procedures
+// @Accept json
+// @Produce json
+// @Param template query string true "Template ID (e.g. general, orthodontics, implants)"
+// @Param dry_run query bool false "Only compute the changes"
+// @Param overrides body models.CatalogApplyRequest false "Local price overrides by item code"
+// @Success 200 {object} models.CatalogApplyResult
+// @Failure 400 {object} apierror.Response "Invalid template or overrides"
+// @Failure 500 {object} apierror.Response "Failed to apply catalog"
+// @Router /api/v1/dental/procedure/catalog/apply [post]
+func ApplyCatalogTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := catalog.Template(r.URL.Query().Get("template"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	var request models.CatalogApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]string, len(template.Items))
+	for i, item := range template.Items {
+		ids[i] = catalog.ProcedureID(template.ID, item.Code)
+	}
+	existing, err := batchGetItems[models.Procedure](r.Context(), "Procedures", ids)
+	if err != nil {
+		http.Error(w, "Failed to apply catalog", http.StatusInternalServerError)
+		log.Printf("Error loading procedures of catalog %s: %v", template.ID, err)
+		return
+	}
+	current := make(map[string]models.Procedure, len(existing))
+	for _, procedure := range existing {
+		current[procedure.ID] = procedure
+	}
+
+	result := models.CatalogApplyResult{Template: template.ID, DryRun: dryRun, Changes: []models.CatalogChange{}}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for i, item := range template.Items {
+		desired := models.Procedure{
+			ID:          ids[i],
+			Name:        item.Name,
+			Description: item.Description,
+			Price:       item.Price,
+			Duration:    item.Duration,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if price, ok := request.PriceOverrides[item.Code]; ok {
+			desired.Price = price
+		}
+
+		change := models.CatalogChange{Code: item.Code, ProcedureID: desired.ID, Action: models.CatalogActionCreate}
+		if procedure, ok := current[desired.ID]; ok {
+			if procedure.Name == desired.Name && procedure.Description == desired.Description &&
+				procedure.Price == desired.Price && procedure.Duration == desired.Duration {
+				change.Action = models.CatalogActionUnchanged
+			} else {
+				change.Action = models.CatalogActionUpdate
+				desired.CreatedAt = procedure.CreatedAt
+				// The clinic's own settings are not part of the template
+				desired.Translations = procedure.Translations
+				desired.RequiresPreAuth = procedure.RequiresPreAuth
+				desired.RequiresConsent = procedure.RequiresConsent
+				desired.Tags = procedure.Tags
+				desired.RoomFeatures = procedure.RoomFeatures
+				desired.BufferMinutes = procedure.BufferMinutes
+			}
+		}
+
+		switch change.Action {
+		case models.CatalogActionCreate:
+			result.Created++
+		case models.CatalogActionUpdate:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+		result.Changes = append(result.Changes, change)
+
+		if dryRun || change.Action == models.CatalogActionUnchanged {
+			continue
+		}
+		if err := putCatalogProcedure(r, desired); err != nil {
+			http.Error(w, "Failed to apply catalog", http.StatusInternalServerError)
+			log.Printf("Error saving procedure %s of catalog %s: %v", item.Code, template.ID, err)
+			return
+		}
+	}
+	if !dryRun && result.Updated > 0 {
+		invalidateAgendas(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func putCatalogProcedure(r *http.Request, procedure models.Procedure) error {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Procedures"),
+		Item:      repository.ProcedureItem(procedure),
+	})
+	return err
+}
+
+// AdjustCatalogPrices godoc
+// @Summary Adjust catalog prices in bulk
+// @Description Raise or lower by a percentage or a fixed amount the prices of the procedures of a catalog template, with any of the given tags or in procedure_ids (every procedure without filters), from effective_from on (today by default). The adjustment applies to the price in force on that date and is recorded with its changes for auditing. With dry_run=true the changes are returned without writing.
+// @Tags procedures
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string false "Staff member adjusting the prices"
+// @Param dry_run query bool false "Only compute the changes"
+// @Param adjustment body models.PriceAdjustmentRequest true "Mode (percent or fixed), value, effective date and filters"
+// @Success 200 {object} models.PriceAdjustment
+// @Failure 400 {object} apierror.Response "Invalid request body, fields or resulting price"
+// @Failure 500 {object} apierror.Response "Failed to adjust prices"
+// @Router /api/v1/dental/procedure/catalog/adjust [post]
+func AdjustCatalogPrices(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	var request models.PriceAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if request.EffectiveFrom == "" {
+		request.EffectiveFrom = today
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.EffectiveFrom < today {
+		http.Error(w, "effective_from must not be in the past", http.StatusBadRequest)
+		return
+	}
+	var inTemplate map[string]bool
+	if request.Template != "" {
+		template, err := catalog.Template(request.Template)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inTemplate = make(map[string]bool, len(template.Items))
+		for _, item := range template.Items {
+			inTemplate[catalog.ProcedureID(template.ID, item.Code)] = true
+		}
+	}
+
+	procedures, err := paging.ScanAll[models.Procedure](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Procedures"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to adjust prices", http.StatusInternalServerError)
+		log.Printf("Error scanning procedures: %v", err)
+		return
+	}
+	history, err := pricing.LoadHistory(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to adjust prices", http.StatusInternalServerError)
+		log.Printf("Error loading price history: %v", err)
+		return
+	}
+	effectiveFrom, _ := time.Parse("2006-01-02", request.EffectiveFrom)
+
+	adjustment := models.PriceAdjustment{
+		ID:                     uuid.NewString(),
+		PriceAdjustmentRequest: request,
+		DryRun:                 dryRun,
+		Changes:                []models.PriceAdjustmentChange{},
+		CreatedBy:              inbox.User(r),
+		CreatedAt:              time.Now().UTC().Format(time.RFC3339),
+	}
+	selected := make(map[string]models.Procedure)
+	for _, procedure := range procedures {
+		if inTemplate != nil && !inTemplate[procedure.ID] {
+			continue
+		}
+		if len(request.Tags) > 0 && !procedure.HasAnyTag(request.Tags) {
+			continue
+		}
+		if len(request.ProcedureIDs) > 0 && !slices.Contains(request.ProcedureIDs, procedure.ID) {
+			continue
+		}
+
+		current, err := procedure.PriceValue()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Procedure %s has an invalid price", procedure.Name), http.StatusBadRequest)
+			return
+		}
+		current = history.PriceAt(procedure.ID, effectiveFrom, current)
+		adjusted := request.Apply(current)
+		if adjusted < 0 {
+			http.Error(w, fmt.Sprintf("Adjusted price of %s would be negative", procedure.Name), http.StatusBadRequest)
+			return
+		}
+		if adjusted == current {
+			continue
+		}
+		selected[procedure.ID] = procedure
+		adjustment.Changes = append(adjustment.Changes, models.PriceAdjustmentChange{
+			ProcedureID: procedure.ID,
+			Name:        procedure.Name,
+			OldPrice:    models.FormatPrice(current),
+			NewPrice:    models.FormatPrice(adjusted),
+		})
+	}
+	sort.Slice(adjustment.Changes, func(i, j int) bool {
+		return adjustment.Changes[i].Name < adjustment.Changes[j].Name
+	})
+
+	if !dryRun && len(adjustment.Changes) > 0 {
+		for i, change := range adjustment.Changes {
+			if _, err := pricing.SchedulePrice(r.Context(), selected[change.ProcedureID], change.NewPrice, request.EffectiveFrom); err != nil {
+				// What was already scheduled stays on record
+				adjustment.Changes = adjustment.Changes[:i]
+				if len(adjustment.Changes) > 0 {
+					if err := putPriceAdjustment(r, adjustment); err != nil {
+						log.Printf("Error saving price adjustment %s: %v", adjustment.ID, err)
+					}
+					invalidateAgendas(r.Context())
+				}
+				http.Error(w, "Failed to adjust prices", http.StatusInternalServerError)
+				log.Printf("Error scheduling price of procedure %s: %v", change.ProcedureID, err)
+				return
+			}
+		}
+		if err := putPriceAdjustment(r, adjustment); err != nil {
+			http.Error(w, "Failed to adjust prices", http.StatusInternalServerError)
+			log.Printf("Error saving price adjustment %s: %v", adjustment.ID, err)
+			return
+		}
+		invalidateAgendas(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adjustment)
+}
+
+// GetPriceAdjustments godoc
+// @Summary List catalog price adjustments
+// @Description List the bulk price adjustments applied to the catalog, newest first, with who applied them and the price changes
+// @Tags procedures
+// @Produce json
+// @Success 200 {array} models.PriceAdjustment
+// @Failure 500 {object} apierror.Response "Failed to retrieve price adjustments"
+// @Router /api/v1/dental/procedure/catalog/adjustments [get]
+func GetPriceAdjustments(w http.ResponseWriter, r *http.Request) {
+	adjustments, err := paging.ScanAll[models.PriceAdjustment](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("PriceAdjustments"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve price adjustments", http.StatusInternalServerError)
+		log.Printf("Error scanning price adjustments: %v", err)
+		return
+	}
+	sort.Slice(adjustments, func(i, j int) bool {
+		return adjustments[i].CreatedAt > adjustments[j].CreatedAt
+	})
+	if adjustments == nil {
+		adjustments = []models.PriceAdjustment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adjustments)
+}
+
+func putPriceAdjustment(r *http.Request, adjustment models.PriceAdjustment) error {
+	item, err := attributevalue.MarshalMap(adjustment)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("PriceAdjustments"),
+		Item:      item,
+	})
+	return err
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateClinicalNote godoc
+// @Summary Add a clinical note
+// @Description Add a note to the patient's clinical record, written by a dentist and optionally tied to an appointment, with attachments. Notes are never deleted: the author may correct a note until signing it, and a signed note is corrected by a new note that amends it.
+// @Tags clinical-notes
+// @Accept json
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param note body models.ClinicalNote true "Author, body, appointment and attachments of the note"
+// @Success 201 {object} models.ClinicalNote
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or appointment of another patient"
+// @Failure 404 {object} apierror.Response "Patient, dentist, appointment or amended note not found"
+// @Failure 409 {object} apierror.Response "Amended note not signed yet"
+// @Failure 500 {object} apierror.Response "Failed to save clinical note"
+// @Router /api/v1/dental/patient/{id}/notes [post]
+func CreateClinicalNote(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	var note models.ClinicalNote
+	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := note.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !clinicalNoteReferencesExist(w, r, patientID, note) {
+		return
+	}
+	if note.Amends != "" {
+		amended, err := ClinicalNotes.Get(r.Context(), patientID, note.Amends)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Amended note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to save clinical note", http.StatusInternalServerError)
+			log.Printf("Error fetching clinical note %s: %v", note.Amends, err)
+			return
+		}
+		if !amended.Signed() {
+			http.Error(w, "The amended note is not signed yet; correct it instead", http.StatusConflict)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	note.PatientID = patientID
+	note.ID = config.ChangeSeq(now) + "-" + uuid.NewString()[:8]
+	note.ClinicID = ""
+	note.CreatedAt = now.Format(time.RFC3339)
+	note.CreatedBy = config.ActorFrom(r.Context()).User
+	note.UpdatedAt = ""
+	note.SignedAt, note.SignedBy = "", ""
+
+	if err := ClinicalNotes.Create(r.Context(), note); err != nil {
+		http.Error(w, "Failed to save clinical note", http.StatusInternalServerError)
+		log.Printf("Error saving clinical note: %v", err)
+		return
+	}
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "clinical_note", ID: note.ID}, inbox.User(r), "", note.Body)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+// GetClinicalNotes godoc
+// @Summary List a patient's clinical notes
+// @Description List the clinical notes of a patient in the order they were written, oldest first unless order is desc
+// @Tags clinical-notes
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param order query string false "asc (default) or desc"
+// @Success 200 {array} models.ClinicalNote
+// @Failure 400 {object} apierror.Response "Invalid order"
+// @Failure 500 {object} apierror.Response "Failed to retrieve clinical notes"
+// @Router /api/v1/dental/patient/{id}/notes [get]
+func GetClinicalNotes(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	order := r.URL.Query().Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	notes, err := ClinicalNotes.ListByPatient(r.Context(), patientID, order == "desc")
+	if err != nil {
+		http.Error(w, "Failed to retrieve clinical notes", http.StatusInternalServerError)
+		log.Printf("Error querying clinical notes of patient %s: %v", patientID, err)
+		return
+	}
+	if notes == nil {
+		notes = []models.ClinicalNote{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+// GetClinicalNote godoc
+// @Summary Get a clinical note
+// @Description Get a clinical note of a patient by its ID
+// @Tags clinical-notes
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param noteId path string true "Note ID"
+// @Success 200 {object} models.ClinicalNote
+// @Failure 404 {object} apierror.Response "Clinical note not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve clinical note"
+// @Router /api/v1/dental/patient/{id}/notes/{noteId} [get]
+func GetClinicalNote(w http.ResponseWriter, r *http.Request) {
+	note, ok := loadClinicalNote(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// UpdateClinicalNote godoc
+// @Summary Correct an unsigned clinical note
+// @Description Replace the body, appointment and attachments of a clinical note not signed yet. Only the note's author can change it.
+// @Tags clinical-notes
+// @Accept json
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param noteId path string true "Note ID"
+// @Param note body models.ClinicalNote true "Body, appointment and attachments of the note"
+// @Success 200 {object} models.ClinicalNote
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or appointment of another patient"
+// @Failure 403 {object} apierror.Response "Only the note's author can change it"
+// @Failure 404 {object} apierror.Response "Clinical note or appointment not found"
+// @Failure 409 {object} apierror.Response "Clinical note already signed"
+// @Failure 500 {object} apierror.Response "Failed to update clinical note"
+// @Router /api/v1/dental/patient/{id}/notes/{noteId} [put]
+func UpdateClinicalNote(w http.ResponseWriter, r *http.Request) {
+	note, ok := loadClinicalNote(w, r)
+	if !ok {
+		return
+	}
+	if !clinicalNoteWritable(w, r, note) {
+		return
+	}
+
+	var updatedData models.ClinicalNote
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	previousBody := note.Body
+	note.Body = updatedData.Body
+	note.AppointmentID = updatedData.AppointmentID
+	note.Attachments = updatedData.Attachments
+	if err := note.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !clinicalNoteReferencesExist(w, r, note.PatientID, note) {
+		return
+	}
+	note.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	err := ClinicalNotes.Update(r.Context(), note)
+	if errors.Is(err, repository.ErrNoteSigned) {
+		http.Error(w, "Clinical note was signed and can no longer be changed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update clinical note", http.StatusInternalServerError)
+		log.Printf("Error updating clinical note %s: %v", note.ID, err)
+		return
+	}
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "clinical_note", ID: note.ID}, inbox.User(r), previousBody, note.Body)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// SignClinicalNote godoc
+// @Summary Sign a clinical note
+// @Description Sign a clinical note, after which it can no longer be changed. Only the note's author can sign it.
+// @Tags clinical-notes
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param noteId path string true "Note ID"
+// @Success 200 {object} models.ClinicalNote
+// @Failure 403 {object} apierror.Response "Only the note's author can sign it"
+// @Failure 404 {object} apierror.Response "Clinical note not found"
+// @Failure 409 {object} apierror.Response "Clinical note already signed"
+// @Failure 500 {object} apierror.Response "Failed to sign clinical note"
+// @Router /api/v1/dental/patient/{id}/notes/{noteId}/sign [post]
+func SignClinicalNote(w http.ResponseWriter, r *http.Request) {
+	note, ok := loadClinicalNote(w, r)
+	if !ok {
+		return
+	}
+	if !clinicalNoteWritable(w, r, note) {
+		return
+	}
+
+	note.SignedAt = time.Now().UTC().Format(time.RFC3339)
+	note.SignedBy = config.ActorFrom(r.Context()).User
+
+	err := ClinicalNotes.Sign(r.Context(), note.PatientID, note.ID, note.SignedAt, note.SignedBy)
+	if errors.Is(err, repository.ErrNoteSigned) {
+		http.Error(w, "Clinical note is already signed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to sign clinical note", http.StatusInternalServerError)
+		log.Printf("Error signing clinical note %s: %v", note.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// clinicalNoteWritable rejects changes to signed notes with 409 and changes
+// by anyone but the note's author with 403. It returns false when the
+// response was written.
+func clinicalNoteWritable(w http.ResponseWriter, r *http.Request, note models.ClinicalNote) bool {
+	if note.Signed() {
+		http.Error(w, "Clinical note is signed and can no longer be changed", http.StatusConflict)
+		return false
+	}
+	if note.CreatedBy != config.ActorFrom(r.Context()).User {
+		http.Error(w, "Only the note's author can change or sign it", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// clinicalNoteReferencesExist checks the patient, the author and the
+// appointment of a note exist, and that the appointment is the patient's,
+// writing the error response when they do not
+func clinicalNoteReferencesExist(w http.ResponseWriter, r *http.Request, patientID string, note models.ClinicalNote) bool {
+	for table, id := range map[string]string{"Patients": patientID, "Dentists": note.DentistID} {
+		exists, err := itemExists(r.Context(), table, id)
+		if err != nil {
+			http.Error(w, "Failed to save clinical note", http.StatusInternalServerError)
+			log.Printf("Error checking %s item %s: %v", table, id, err)
+			return false
+		}
+		if !exists {
+			http.Error(w, "Patient or dentist not found", http.StatusNotFound)
+			return false
+		}
+	}
+	if note.AppointmentID == "" {
+		return true
+	}
+	appointments, err := batchGetItems[models.Appointment](r.Context(), "Appointments", []string{note.AppointmentID})
+	if err != nil {
+		http.Error(w, "Failed to save clinical note", http.StatusInternalServerError)
+		log.Printf("Error fetching appointment %s: %v", note.AppointmentID, err)
+		return false
+	}
+	if len(appointments) == 0 {
+		http.Error(w, "Appointment not found", http.StatusNotFound)
+		return false
+	}
+	if appointments[0].PatientID != patientID {
+		http.Error(w, "The appointment is of another patient", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// loadClinicalNote fetches the clinical note of the request, writing the
+// error response when it fails
+func loadClinicalNote(w http.ResponseWriter, r *http.Request) (models.ClinicalNote, bool) {
+	vars := mux.Vars(r)
+	note, err := ClinicalNotes.Get(r.Context(), vars["id"], vars["noteId"])
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Clinical note not found", http.StatusNotFound)
+		return models.ClinicalNote{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve clinical note", http.StatusInternalServerError)
+		log.Printf("Error fetching clinical note %s: %v", vars["noteId"], err)
+		return models.ClinicalNote{}, false
+	}
+	return note, true
+}
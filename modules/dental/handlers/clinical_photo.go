@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/blob"
+	"dental-saas/shared/config"
+	"dental-saas/shared/legalhold"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxPhotoSize is the largest image accepted as a clinical photo
+const maxPhotoSize = 15 << 20
+
+// UploadClinicalPhoto godoc
+// @Summary Upload a clinical photo
+// @Description Upload an intraoral or extraoral photo of the patient, up to 15 MB. Photos of the same day and procedure form a session of the patient's photo timeline; the view pairs them across sessions for before/after comparisons. With an appointment, the procedure and day default to the appointment's.
+// @Tags clinical-photos
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param file formData file true "Image (JPEG, PNG or WebP)"
+// @Param type formData string true "intraoral or extraoral"
+// @Param view formData string true "frontal, right_lateral, left_lateral, upper_occlusal, lower_occlusal, smile, face, profile or detail"
+// @Param stage formData string false "before, progress or after"
+// @Param tooth formData int false "FDI tooth number, for detail photos"
+// @Param procedure_id formData string false "Procedure the photo documents"
+// @Param appointment_id formData string false "Appointment the photo was taken at"
+// @Param taken_on formData string false "Day of the session (YYYY-MM-DD); defaults to the appointment's day or today"
+// @Param notes formData string false "Notes"
+// @Success 201 {object} models.ClinicalPhoto
+// @Failure 400 {object} apierror.Response "Missing or invalid image or fields, or appointment of another patient"
+// @Failure 404 {object} apierror.Response "Patient, procedure or appointment not found"
+// @Failure 413 {object} apierror.Response "Image too large"
+// @Failure 500 {object} apierror.Response "Failed to save photo"
+// @Failure 503 {object} apierror.Response "File storage not available"
+// @Router /api/v1/dental/patient/{id}/photos [post]
+func UploadClinicalPhoto(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	upload, ok := readUpload(w, r, maxPhotoSize)
+	if !ok {
+		return
+	}
+	if contentType := http.DetectContentType(upload.Data); !strings.HasPrefix(contentType, "image/") {
+		http.Error(w, "Clinical photos must be images", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	photo := models.ClinicalPhoto{
+		PatientID:     patientID,
+		ID:            config.ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		Type:          r.FormValue("type"),
+		View:          r.FormValue("view"),
+		Stage:         r.FormValue("stage"),
+		ProcedureID:   r.FormValue("procedure_id"),
+		AppointmentID: r.FormValue("appointment_id"),
+		TakenOn:       r.FormValue("taken_on"),
+		Notes:         r.FormValue("notes"),
+		ContentType:   http.DetectContentType(upload.Data),
+		Size:          int64(len(upload.Data)),
+		UploadedAt:    now.Format(time.RFC3339),
+		UploadedBy:    config.ActorFrom(r.Context()).User,
+	}
+	if tooth := r.FormValue("tooth"); tooth != "" {
+		number, err := strconv.Atoi(tooth)
+		if err != nil {
+			http.Error(w, "tooth must be a number", http.StatusBadRequest)
+			return
+		}
+		photo.Tooth = number
+	}
+	if !clinicalPhotoReferencesExist(w, r, &photo) {
+		return
+	}
+	if photo.TakenOn == "" {
+		photo.TakenOn = now.Format("2006-01-02")
+	}
+	if err := photo.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store, err := blob.Default()
+	if err != nil {
+		http.Error(w, "File storage not available", http.StatusServiceUnavailable)
+		log.Printf("Error initializing file storage: %v", err)
+		return
+	}
+	photo.StorageKey = patientBlobKey(r.Context(), patientID, "photos", photo.ID)
+	if err := store.Put(r.Context(), photo.StorageKey, photo.ContentType, upload.Data); err != nil {
+		http.Error(w, "Failed to save photo", http.StatusInternalServerError)
+		log.Printf("Error storing photo of patient %s: %v", patientID, err)
+		return
+	}
+
+	item, err := attributevalue.MarshalMap(photo)
+	if err == nil {
+		ctx, cancel := config.DBContext(r.Context())
+		defer cancel()
+		_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String("ClinicalPhotos"),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(PatientID)"),
+		})
+	}
+	if err != nil {
+		http.Error(w, "Failed to save photo", http.StatusInternalServerError)
+		log.Printf("Error saving photo of patient %s: %v", patientID, err)
+		if err := store.Delete(r.Context(), photo.StorageKey); err != nil {
+			log.Printf("Error removing orphaned photo file %s: %v", photo.StorageKey, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(photo)
+}
+
+// GetClinicalPhotoTimeline godoc
+// @Summary Get a patient's photo timeline
+// @Description Get the clinical photos of a patient grouped in sessions, one per day and procedure, oldest first
+// @Tags clinical-photos
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param procedureId query string false "Only photos of this procedure"
+// @Param type query string false "intraoral or extraoral"
+// @Success 200 {array} models.PhotoSession
+// @Failure 500 {object} apierror.Response "Failed to retrieve photos"
+// @Router /api/v1/dental/patient/{id}/photos [get]
+func GetClinicalPhotoTimeline(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	photos, err := patientPhotos(r.Context(), patientID, query.Get("procedureId"), query.Get("type"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve photos", http.StatusInternalServerError)
+		log.Printf("Error querying photos of patient %s: %v", patientID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photoSessions(photos))
+}
+
+// CompareClinicalPhotos godoc
+// @Summary Compare clinical photos before and after
+// @Description Pair the photos of two sessions by type, view and tooth. By default the before session is the earliest with photos staged before (or the earliest) and the after session the latest with photos staged after (or the latest). On the same day, only photos staged before and after are paired.
+// @Tags clinical-photos
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param procedureId query string false "Only photos of this procedure"
+// @Param before query string false "Day of the before session (YYYY-MM-DD)"
+// @Param after query string false "Day of the after session (YYYY-MM-DD)"
+// @Success 200 {object} models.PhotoComparison
+// @Failure 404 {object} apierror.Response "No photos to compare"
+// @Failure 500 {object} apierror.Response "Failed to compare photos"
+// @Router /api/v1/dental/patient/{id}/photos/compare [get]
+func CompareClinicalPhotos(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	procedureID := query.Get("procedureId")
+	photos, err := patientPhotos(r.Context(), patientID, procedureID, "")
+	if err != nil {
+		http.Error(w, "Failed to compare photos", http.StatusInternalServerError)
+		log.Printf("Error querying photos of patient %s: %v", patientID, err)
+		return
+	}
+	if len(photos) == 0 {
+		http.Error(w, "No photos to compare", http.StatusNotFound)
+		return
+	}
+
+	before, after := query.Get("before"), query.Get("after")
+	if before == "" {
+		before = comparisonDay(photos, models.PhotoStageBefore, false)
+	}
+	if after == "" {
+		after = comparisonDay(photos, models.PhotoStageAfter, true)
+	}
+
+	comparison := models.PhotoComparison{ProcedureID: procedureID, Before: before, After: after, Pairs: []models.PhotoPair{}}
+	pairs := make(map[string]*models.PhotoPair)
+	var keys []string
+	for i := range photos {
+		photo := &photos[i]
+		// On the same day, the stage tells the sides apart
+		isBefore := photo.TakenOn == before && photo.Stage != models.PhotoStageAfter && (before != after || photo.Stage == models.PhotoStageBefore)
+		isAfter := photo.TakenOn == after && photo.Stage != models.PhotoStageBefore && (before != after || photo.Stage == models.PhotoStageAfter)
+		if !isBefore && !isAfter {
+			continue
+		}
+		key := photo.PairKey()
+		if pairs[key] == nil {
+			pairs[key] = &models.PhotoPair{Type: photo.Type, View: photo.View, Tooth: photo.Tooth}
+			keys = append(keys, key)
+		}
+		// Photos come oldest first, so the latest of each view is kept
+		if isBefore {
+			pairs[key].Before = photo
+		} else {
+			pairs[key].After = photo
+		}
+	}
+	if len(keys) == 0 {
+		http.Error(w, "No photos to compare", http.StatusNotFound)
+		return
+	}
+	for _, key := range keys {
+		comparison.Pairs = append(comparison.Pairs, *pairs[key])
+	}
+	sort.SliceStable(comparison.Pairs, func(i, j int) bool {
+		a, b := comparison.Pairs[i], comparison.Pairs[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.View != b.View {
+			return viewRank(a.View) < viewRank(b.View)
+		}
+		return a.Tooth < b.Tooth
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// GetClinicalPhoto godoc
+// @Summary Get a clinical photo
+// @Description Get the details of a clinical photo of a patient
+// @Tags clinical-photos
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param photoId path string true "Photo ID"
+// @Success 200 {object} models.ClinicalPhoto
+// @Failure 404 {object} apierror.Response "Photo not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve photo"
+// @Router /api/v1/dental/patient/{id}/photos/{photoId} [get]
+func GetClinicalPhoto(w http.ResponseWriter, r *http.Request) {
+	photo, ok := loadClinicalPhoto(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photo)
+}
+
+// GetClinicalPhotoImage godoc
+// @Summary Get the image of a clinical photo
+// @Description Get the image of a clinical photo, to be shown in the browser
+// @Tags clinical-photos
+// @Produce image/jpeg
+// @Produce image/png
+// @Param id path string true "Patient ID"
+// @Param photoId path string true "Photo ID"
+// @Success 200 {file} file
+// @Failure 404 {object} apierror.Response "Photo not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve photo"
+// @Failure 503 {object} apierror.Response "File storage not available"
+// @Router /api/v1/dental/patient/{id}/photos/{photoId}/image [get]
+func GetClinicalPhotoImage(w http.ResponseWriter, r *http.Request) {
+	photo, ok := loadClinicalPhoto(w, r)
+	if !ok {
+		return
+	}
+	store, err := blob.Default()
+	if err != nil {
+		http.Error(w, "File storage not available", http.StatusServiceUnavailable)
+		log.Printf("Error initializing file storage: %v", err)
+		return
+	}
+	data, err := store.Get(r.Context(), photo.StorageKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.Error(w, "Photo image not found", http.StatusNotFound)
+		log.Printf("Photo %s of patient %s has no file at %s", photo.ID, photo.PatientID, photo.StorageKey)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve photo", http.StatusInternalServerError)
+		log.Printf("Error reading photo file %s: %v", photo.StorageKey, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	writeFile(w, "inline", photo.ID, photo.ContentType, data)
+}
+
+// DeleteClinicalPhoto godoc
+// @Summary Delete a clinical photo
+// @Description Delete a clinical photo of a patient, from the timeline and the file storage. Photos of a patient under legal hold are kept.
+// @Tags clinical-photos
+// @Param id path string true "Patient ID"
+// @Param photoId path string true "Photo ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Photo not found"
+// @Failure 409 {object} apierror.Response "Patient is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete photo"
+// @Router /api/v1/dental/patient/{id}/photos/{photoId} [delete]
+func DeleteClinicalPhoto(w http.ResponseWriter, r *http.Request) {
+	photo, ok := loadClinicalPhoto(w, r)
+	if !ok {
+		return
+	}
+	if !checkLegalHold(w, r, legalhold.RecordClinicalPhoto, photo.ID, photo.PatientID) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String("ClinicalPhotos"),
+		Key:                 patientRecordKey(photo.PatientID, photo.ID),
+		ConditionExpression: aws.String("attribute_exists(PatientID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+		log.Printf("Error deleting photo %s: %v", photo.ID, err)
+		return
+	}
+
+	// The record is gone, so an image left behind is only logged
+	store, err := blob.Default()
+	if err == nil {
+		err = store.Delete(r.Context(), photo.StorageKey)
+	}
+	if err != nil {
+		log.Printf("Error removing photo file %s: %v", photo.StorageKey, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clinicalPhotoReferencesExist checks the patient, procedure and appointment
+// of a photo exist and that the appointment is the patient's, filling the
+// procedure and day from the appointment. It writes the error response when
+// they do not.
+func clinicalPhotoReferencesExist(w http.ResponseWriter, r *http.Request, photo *models.ClinicalPhoto) bool {
+	exists, err := itemExists(r.Context(), "Patients", photo.PatientID)
+	if err != nil {
+		http.Error(w, "Failed to save photo", http.StatusInternalServerError)
+		log.Printf("Error checking patient %s: %v", photo.PatientID, err)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return false
+	}
+
+	if photo.AppointmentID != "" {
+		appointments, err := batchGetItems[models.Appointment](r.Context(), "Appointments", []string{photo.AppointmentID})
+		if err != nil {
+			http.Error(w, "Failed to save photo", http.StatusInternalServerError)
+			log.Printf("Error fetching appointment %s: %v", photo.AppointmentID, err)
+			return false
+		}
+		if len(appointments) == 0 {
+			http.Error(w, "Appointment not found", http.StatusNotFound)
+			return false
+		}
+		appointment := appointments[0]
+		if appointment.PatientID != photo.PatientID {
+			http.Error(w, "The appointment is of another patient", http.StatusBadRequest)
+			return false
+		}
+		if photo.ProcedureID == "" {
+			photo.ProcedureID = appointment.ProcedureID
+		}
+		if day, ok := appointmentDay(appointment.DateTime); ok && photo.TakenOn == "" {
+			photo.TakenOn = day
+		}
+	}
+
+	if photo.ProcedureID != "" {
+		exists, err := itemExists(r.Context(), "Procedures", photo.ProcedureID)
+		if err != nil {
+			http.Error(w, "Failed to save photo", http.StatusInternalServerError)
+			log.Printf("Error checking procedure %s: %v", photo.ProcedureID, err)
+			return false
+		}
+		if !exists {
+			http.Error(w, "Procedure not found", http.StatusNotFound)
+			return false
+		}
+	}
+	return true
+}
+
+// patientPhotos returns the photos of a patient in upload order, only of the
+// procedure and type given
+func patientPhotos(ctx context.Context, patientID, procedureID, photoType string) ([]models.ClinicalPhoto, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("ClinicalPhotos"),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	}
+	var filters []string
+	if procedureID != "" {
+		filters = append(filters, "ProcedureID = :procedureId")
+		input.ExpressionAttributeValues[":procedureId"] = &types.AttributeValueMemberS{Value: procedureID}
+	}
+	if photoType != "" {
+		filters = append(filters, "#type = :type")
+		input.ExpressionAttributeNames = map[string]string{"#type": "Type"}
+		input.ExpressionAttributeValues[":type"] = &types.AttributeValueMemberS{Value: photoType}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	return queryItems[models.ClinicalPhoto](ctx, input)
+}
+
+// photoSessions groups photos by day and procedure, oldest first
+func photoSessions(photos []models.ClinicalPhoto) []models.PhotoSession {
+	sessions := []models.PhotoSession{}
+	index := make(map[string]int)
+	for _, photo := range photos {
+		key := photo.TakenOn + "/" + photo.ProcedureID
+		i, ok := index[key]
+		if !ok {
+			i = len(sessions)
+			index[key] = i
+			sessions = append(sessions, models.PhotoSession{TakenOn: photo.TakenOn, ProcedureID: photo.ProcedureID, Stage: photo.Stage})
+		}
+		session := &sessions[i]
+		if session.AppointmentID == "" {
+			session.AppointmentID = photo.AppointmentID
+		}
+		if session.Stage != photo.Stage {
+			session.Stage = ""
+		}
+		session.Photos = append(session.Photos, photo)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].TakenOn != sessions[j].TakenOn {
+			return sessions[i].TakenOn < sessions[j].TakenOn
+		}
+		return sessions[i].ProcedureID < sessions[j].ProcedureID
+	})
+	return sessions
+}
+
+// comparisonDay returns the earliest (or, with latest, the latest) day with a
+// photo of the stage, or of any stage when none has it
+func comparisonDay(photos []models.ClinicalPhoto, stage string, latest bool) string {
+	pick := func(day, candidate string) string {
+		if day == "" || (latest && candidate > day) || (!latest && candidate < day) {
+			return candidate
+		}
+		return day
+	}
+	staged, unstaged := "", ""
+	for _, photo := range photos {
+		if photo.Stage == stage {
+			staged = pick(staged, photo.TakenOn)
+		}
+		unstaged = pick(unstaged, photo.TakenOn)
+	}
+	if staged != "" {
+		return staged
+	}
+	return unstaged
+}
+
+func viewRank(view string) int {
+	for i, v := range models.PhotoViews {
+		if v == view {
+			return i
+		}
+	}
+	return len(models.PhotoViews)
+}
+
+// loadClinicalPhoto fetches the clinical photo of the request, writing the
+// error response when it fails
+func loadClinicalPhoto(w http.ResponseWriter, r *http.Request) (models.ClinicalPhoto, bool) {
+	vars := mux.Vars(r)
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("ClinicalPhotos"),
+		Key:       patientRecordKey(vars["id"], vars["photoId"]),
+	})
+	var photo models.ClinicalPhoto
+	if err == nil && result.Item != nil {
+		err = attributevalue.UnmarshalMap(result.Item, &photo)
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve photo", http.StatusInternalServerError)
+		log.Printf("Error fetching photo %s: %v", vars["photoId"], err)
+		return models.ClinicalPhoto{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return models.ClinicalPhoto{}, false
+	}
+	return photo, true
+}
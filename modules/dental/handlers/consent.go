@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/legalhold"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetPatientConsents godoc
+// @Summary List a patient's signed consents
+// @Description List the consent forms a patient signed, one per procedure, without the signed documents
+// @Tags consents
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {array} models.Consent
+// @Failure 500 {object} apierror.Response "Failed to retrieve consents"
+// @Router /api/v1/dental/patient/{id}/consents [get]
+func GetPatientConsents(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+
+	consents, err := queryItems[models.Consent](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String("Consents"),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve consents", http.StatusInternalServerError)
+		log.Printf("Error querying consents of patient %s: %v", patientID, err)
+		return
+	}
+	for i := range consents {
+		consents[i].Document = ""
+	}
+	if consents == nil {
+		consents = []models.Consent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// GetPatientConsent godoc
+// @Summary Get a patient's signed consent for a procedure
+// @Description Get the consent form a patient signed for a procedure, with the signed document
+// @Tags consents
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param procedureId path string true "Procedure ID"
+// @Success 200 {object} models.Consent
+// @Failure 404 {object} apierror.Response "Consent not signed"
+// @Failure 500 {object} apierror.Response "Failed to retrieve consent"
+// @Router /api/v1/dental/patient/{id}/consents/{procedureId} [get]
+func GetPatientConsent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	consent, err := getConsent(r.Context(), vars["id"], vars["procedureId"])
+	if err != nil {
+		http.Error(w, "Failed to retrieve consent", http.StatusInternalServerError)
+		log.Printf("Error fetching consent of patient %s for procedure %s: %v", vars["id"], vars["procedureId"], err)
+		return
+	}
+	if consent == nil {
+		http.Error(w, "Consent not signed", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consent)
+}
+
+// SetPatientConsent godoc
+// @Summary Record a patient's signed consent for a procedure
+// @Description Store the consent form a patient, or their legal guardian, signed for a procedure, as a base64 PDF or image of up to 300 KB. Procedures requiring consent can only be performed once it is stored. Signing again replaces the stored form.
+// @Tags consents
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string false "Staff member recording the consent"
+// @Param id path string true "Patient ID"
+// @Param procedureId path string true "Procedure ID"
+// @Param consent body models.Consent true "Signer, signing time (defaults to now), content type and base64 document"
+// @Success 200 {object} models.Consent
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Patient or procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to save consent"
+// @Router /api/v1/dental/patient/{id}/consents/{procedureId} [put]
+func SetPatientConsent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var consent models.Consent
+	if err := json.NewDecoder(r.Body).Decode(&consent); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	consent.PatientID = vars["id"]
+	consent.ProcedureID = vars["procedureId"]
+	now := time.Now().UTC().Format(time.RFC3339)
+	if consent.SignedAt == "" {
+		consent.SignedAt = now
+	}
+	if _, err := time.Parse(time.RFC3339, consent.SignedAt); err != nil {
+		http.Error(w, "signed at must be in RFC3339 format", http.StatusBadRequest)
+		return
+	}
+	if err := consent.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for table, id := range map[string]string{"Patients": consent.PatientID, "Procedures": consent.ProcedureID} {
+		exists, err := itemExists(r.Context(), table, id)
+		if err != nil {
+			http.Error(w, "Failed to save consent", http.StatusInternalServerError)
+			log.Printf("Error checking %s item %s: %v", table, id, err)
+			return
+		}
+		if !exists {
+			http.Error(w, "Patient or procedure not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	existing, err := getConsent(r.Context(), consent.PatientID, consent.ProcedureID)
+	if err != nil {
+		http.Error(w, "Failed to save consent", http.StatusInternalServerError)
+		log.Printf("Error fetching consent: %v", err)
+		return
+	}
+	consent.CreatedAt = now
+	if existing != nil {
+		consent.CreatedAt = existing.CreatedAt
+	}
+	consent.UpdatedAt = now
+	consent.RecordedBy = inbox.User(r)
+
+	item, err := attributevalue.MarshalMap(consent)
+	if err != nil {
+		http.Error(w, "Failed to save consent", http.StatusInternalServerError)
+		log.Printf("Error marshaling consent: %v", err)
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Consents"),
+		Item:      item,
+	}); err != nil {
+		http.Error(w, "Failed to save consent", http.StatusInternalServerError)
+		log.Printf("Error saving consent: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consent)
+}
+
+// DeletePatientConsent godoc
+// @Summary Revoke a patient's consent for a procedure
+// @Description Remove the consent form a patient signed for a procedure, for instance when the patient withdraws it. The procedure cannot be performed again until a new form is signed. Consents of a patient under legal hold are kept.
+// @Tags consents
+// @Param id path string true "Patient ID"
+// @Param procedureId path string true "Procedure ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Consent not signed"
+// @Failure 409 {object} apierror.Response "Patient is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete consent"
+// @Router /api/v1/dental/patient/{id}/consents/{procedureId} [delete]
+func DeletePatientConsent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !checkLegalHold(w, r, legalhold.RecordConsent, vars["procedureId"], vars["id"]) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String("Consents"),
+		Key:                 consentKey(vars["id"], vars["procedureId"]),
+		ConditionExpression: aws.String("attribute_exists(PatientID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Consent not signed", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete consent", http.StatusInternalServerError)
+		log.Printf("Error deleting consent: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkConsent rejects completing appointments of procedures that require a
+// signed consent form when the patient's form is not stored, answering 422
+// with the link of the consent flow. It returns false when the response was
+// written.
+func checkConsent(w http.ResponseWriter, r *http.Request, appointment models.Appointment) bool {
+	if appointment.Status != models.AppointmentStatusCompleted || appointment.ProcedureID == "" {
+		return true
+	}
+
+	procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", []string{appointment.ProcedureID})
+	if err != nil {
+		http.Error(w, "Failed to check consent", http.StatusInternalServerError)
+		log.Printf("Error fetching procedure %s: %v", appointment.ProcedureID, err)
+		return false
+	}
+	if len(procedures) == 0 || !procedures[0].NeedsConsent() {
+		return true
+	}
+
+	consent, err := getConsent(r.Context(), appointment.PatientID, appointment.ProcedureID)
+	if err != nil {
+		http.Error(w, "Failed to check consent", http.StatusInternalServerError)
+		log.Printf("Error fetching consent of patient %s for procedure %s: %v", appointment.PatientID, appointment.ProcedureID, err)
+		return false
+	}
+	if consent != nil {
+		return true
+	}
+
+	link := consentLink(appointment.PatientID, appointment.ProcedureID)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="consent"`, link))
+	http.Error(w, fmt.Sprintf("Signed consent required for %s: record the patient's signed form at %s", procedures[0].Name, link), http.StatusUnprocessableEntity)
+	return false
+}
+
+// consentLink returns the endpoint where a patient's signed consent for a procedure is recorded
+func consentLink(patientID, procedureID string) string {
+	return fmt.Sprintf("/api/v1/dental/patient/%s/consents/%s", patientID, procedureID)
+}
+
+// getConsent returns a patient's signed consent for a procedure, or nil when there is none
+func getConsent(ctx context.Context, patientID, procedureID string) (*models.Consent, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String("Consents"),
+		Key:            consentKey(patientID, procedureID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var consent models.Consent
+	if err := attributevalue.UnmarshalMap(result.Item, &consent); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func consentKey(patientID, procedureID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PatientID":   &types.AttributeValueMemberS{Value: patientID},
+		"ProcedureID": &types.AttributeValueMemberS{Value: procedureID},
+	}
+}
@@ -1,34 +1,31 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
-	"errors"
 	"dental-saas/modules/dental/models"
+	"dental-saas/shared/cache"
 	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 // CreateDentist godoc
 // @Summary Create a new dentist
-// @Description Create a new dentist by providing the details
+// @Description Create a new dentist by providing the details. procedure_ids lists the catalog procedures the dentist is credentialed to perform; without it the dentist can perform any procedure.
 // @Tags dentists
 // @Accept json
 // @Produce json
 // @Param dentist body models.Dentist true "Dentist data"
 // @Success 201 {object} models.Dentist
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Dentist with this ID already exists"
-// @Failure 500 {string} string "Failed to save dentist"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Dentist with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save dentist"
 // @Router /api/v1/dental/dentist [post]
 func CreateDentist(w http.ResponseWriter, r *http.Request) {
 	var dentist models.Dentist
@@ -36,52 +33,16 @@ func CreateDentist(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	if dentist.ID == "" {
-		dentist.ID = uuid.NewString()
-	}
-
-	if err := dentist.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !dentistProceduresExist(w, r, dentist.ProcedureIDs) {
 		return
 	}
 
-	if dentist.CreatedAt.IsZero() {
-		dentist.CreatedAt = time.Now().UTC()
-	}
-	if dentist.UpdatedAt.IsZero() {
-		dentist.UpdatedAt = time.Now().UTC()
-	}
-
-	createdAtStr := dentist.CreatedAt.Format(time.RFC3339)
-	updatedAtStr := dentist.UpdatedAt.Format(time.RFC3339)
-
-	_, err := config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName: aws.String("Dentists"),
-		Item: map[string]types.AttributeValue{
-			"ID":        &types.AttributeValueMemberS{Value: dentist.ID},
-			"Name":      &types.AttributeValueMemberS{Value: dentist.Name},
-			"Email":     &types.AttributeValueMemberS{Value: dentist.Email},
-			"Phone":     &types.AttributeValueMemberS{Value: dentist.Phone},
-			"CRO":       &types.AttributeValueMemberS{Value: dentist.CRO},
-			"Country":   &types.AttributeValueMemberS{Value: dentist.Country},
-			"Specialty": &types.AttributeValueMemberS{Value: dentist.Specialty},
-			"CreatedAt": &types.AttributeValueMemberS{Value: createdAtStr},
-			"UpdatedAt": &types.AttributeValueMemberS{Value: updatedAtStr},
-		},
-		ConditionExpression: aws.String("attribute_not_exists(ID)"),
-	})
-
+	dentist, err := Dentists.Create(r.Context(), dentist)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Dentist with this ID already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to save dentist", http.StatusInternalServerError)
-		log.Printf("Error saving dentist: %v", err)
+		writeServiceError(w, err, "Dentist", "Failed to save dentist")
 		return
 	}
+	invalidateDentists(r.Context())
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(dentist)
@@ -92,31 +53,40 @@ func CreateDentist(w http.ResponseWriter, r *http.Request) {
 // @Description Get a list of all dentists
 // @Tags dentists
 // @Produce json
+// @Param stream query bool false "Stream the list as newline-delimited JSON"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
 // @Success 200 {array} models.Dentist
-// @Failure 500 {string} string "Failed to retrieve dentists"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentists"
 // @Router /api/v1/dental/dentist [get]
 func GetAllDentists(w http.ResponseWriter, r *http.Request) {
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String("Dentists"),
-	})
+	if wantsStream(r) {
+		streamList(w, r, "dentists", Dentists.List, nil)
+		return
+	}
+
+	// The cached list is complete, so it only answers first pages within the
+	// cap; it holds no deleted dentists
+	page := paging.Request(r)
+	if cached, ok := cache.Default.Get(dentistsCacheKey(config.ClinicID(r.Context()))); ok && page.Token == "" && page.Err() == nil && len(cached.([]models.Dentist)) <= page.Max() && !config.IncludesDeleted(r.Context()) {
+		w.Header().Set("X-Cache", "HIT")
+		paging.Write(w, page, cached.([]models.Dentist), "")
+		return
+	}
+
+	dentists, next, err := Dentists.List(r.Context(), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to retrieve dentists", http.StatusInternalServerError)
 		log.Printf("Error scanning dentists: %v", err)
 		return
 	}
 
-	var dentists []models.Dentist
-	for _, item := range result.Items {
-		var dentist models.Dentist
-		if err := attributevalue.UnmarshalMap(item, &dentist); err != nil {
-			log.Printf("Error unmarshaling dentist: %v", err)
-			continue
-		}
-		dentists = append(dentists, dentist)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dentists)
+	paging.Write(w, page, dentists, next)
 }
 
 // GetDentistByID godoc
@@ -126,33 +96,13 @@ func GetAllDentists(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Dentist ID"
 // @Success 200 {object} models.Dentist
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to retrieve dentist"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist"
 // @Router /api/v1/dental/dentist/{id} [get]
 func GetDentistByID(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Dentists"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
+	dentist, err := Dentists.Get(r.Context(), mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Failed to retrieve dentist", http.StatusInternalServerError)
-		log.Printf("Error fetching dentist with ID %s: %v", id, err)
-		return
-	}
-	if result.Item == nil {
-		http.Error(w, "Dentist not found", http.StatusNotFound)
-		return
-	}
-
-	var dentist models.Dentist
-	if err = attributevalue.UnmarshalMap(result.Item, &dentist); err != nil {
-		http.Error(w, "Failed to unmarshal dentist data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling dentist data: %v", err)
+		writeServiceError(w, err, "Dentist", "Failed to retrieve dentist")
 		return
 	}
 
@@ -167,38 +117,16 @@ func GetDentistByID(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param name path string true "Dentist Name"
 // @Success 200 {array} models.Dentist
-// @Failure 500 {string} string "Failed to retrieve dentists"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentists"
 // @Router /api/v1/dental/dentist/name/{name} [get]
 func GetDentistByName(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:        aws.String("Dentists"),
-		FilterExpression: aws.String("contains(#name, :name)"),
-		ExpressionAttributeNames: map[string]string{
-			"#name": "Name",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":name": &types.AttributeValueMemberS{Value: name},
-		},
-	})
+	dentists, err := Dentists.FindByName(r.Context(), mux.Vars(r)["name"])
 	if err != nil {
 		http.Error(w, "Failed to retrieve dentists", http.StatusInternalServerError)
 		log.Printf("Error scanning dentists by name: %v", err)
 		return
 	}
 
-	var dentists []models.Dentist
-	for _, item := range result.Items {
-		var dentist models.Dentist
-		if err := attributevalue.UnmarshalMap(item, &dentist); err != nil {
-			log.Printf("Error unmarshaling dentist: %v", err)
-			continue
-		}
-		dentists = append(dentists, dentist)
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(dentists)
 }
@@ -210,35 +138,13 @@ func GetDentistByName(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param cro path string true "Dentist CRO"
 // @Success 200 {object} models.Dentist
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to retrieve dentist"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist"
 // @Router /api/v1/dental/dentist/cro/{cro} [get]
 func GetDentistByCRO(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cro := vars["cro"]
-
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:        aws.String("Dentists"),
-		FilterExpression: aws.String("CRO = :cro"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":cro": &types.AttributeValueMemberS{Value: cro},
-		},
-	})
+	dentist, err := Dentists.FindByCRO(r.Context(), mux.Vars(r)["cro"])
 	if err != nil {
-		http.Error(w, "Failed to retrieve dentist", http.StatusInternalServerError)
-		log.Printf("Error scanning dentist by CRO: %v", err)
-		return
-	}
-
-	if len(result.Items) == 0 {
-		http.Error(w, "Dentist not found", http.StatusNotFound)
-		return
-	}
-
-	var dentist models.Dentist
-	if err = attributevalue.UnmarshalMap(result.Items[0], &dentist); err != nil {
-		http.Error(w, "Failed to unmarshal dentist data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling dentist data: %v", err)
+		writeServiceError(w, err, "Dentist", "Failed to retrieve dentist")
 		return
 	}
 
@@ -247,139 +153,199 @@ func GetDentistByCRO(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateDentist godoc
-// @Summary Update dentist
-// @Description Update an existing dentist
+// @Summary Replace dentist
+// @Description Replace an existing dentist with the dentist sent: fields left out are cleared, so leaving out procedure_ids allows any procedure again. The ID, clinic and timestamps are kept. Use PATCH to change only some fields.
 // @Tags dentists
 // @Accept json
 // @Produce json
 // @Param id path string true "Dentist ID"
-// @Param dentist body models.Dentist true "Updated dentist data"
+// @Param If-Match header string false "Version of the dentist being replaced; required unless the body has it"
+// @Param dentist body models.Dentist true "Dentist data (ID will be ignored)"
 // @Success 200 {object} models.Dentist
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to update dentist"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 409 {object} apierror.Response "Dentist was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the dentist is required"
+// @Failure 500 {object} apierror.Response "Failed to update dentist"
 // @Router /api/v1/dental/dentist/{id} [put]
 func UpdateDentist(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Dentists", id)
+	if !ok {
+		return
+	}
 
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Dentists"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
-	if err != nil {
-		http.Error(w, "Failed to retrieve dentist", http.StatusInternalServerError)
-		log.Printf("Error fetching dentist with ID %s: %v", id, err)
+	var updatedData models.Dentist
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if result.Item == nil {
-		http.Error(w, "Dentist not found", http.StatusNotFound)
+	if !dentistProceduresExist(w, r, updatedData.ProcedureIDs) {
 		return
 	}
 
-	var currentDentist models.Dentist
-	if err = attributevalue.UnmarshalMap(result.Item, &currentDentist); err != nil {
-		http.Error(w, "Failed to unmarshal dentist data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling dentist data: %v", err)
+	dentist, err := Dentists.Update(r.Context(), id, updatedData)
+	if err != nil {
+		if !versioning.Conflict(w, r, err) {
+			writeServiceError(w, err, "Dentist", "Failed to update dentist")
+		}
 		return
 	}
+	dentist.Version = version + 1
+	invalidateDentists(r.Context())
 
-	var updatedData models.Dentist
-	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dentist)
+}
+
+// PatchDentist godoc
+// @Summary Update dentist fields
+// @Description Change some fields of an existing dentist with a JSON Merge Patch (RFC 7386): only the fields sent change, and null clears an optional field such as specialty. procedure_ids is replaced as a whole.
+// @Tags dentists
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param If-Match header string false "Version of the dentist being changed; required unless the patch has it"
+// @Param patch body object true "Fields to change, null to clear"
+// @Success 200 {object} models.Dentist
+// @Failure 400 {object} apierror.Response "Invalid patch or missing required fields"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 409 {object} apierror.Response "Dentist was changed since the version sent"
+// @Failure 415 {object} apierror.Response "Content-Type must be application/merge-patch+json"
+// @Failure 428 {object} apierror.Response "Version of the dentist is required"
+// @Failure 500 {object} apierror.Response "Failed to update dentist"
+// @Router /api/v1/dental/dentist/{id} [patch]
+func PatchDentist(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Dentists", id)
+	if !ok {
 		return
 	}
 
-	if updatedData.Name != "" {
-		currentDentist.Name = updatedData.Name
-	}
-	if updatedData.Email != "" {
-		currentDentist.Email = updatedData.Email
-	}
-	if updatedData.Phone != "" {
-		currentDentist.Phone = updatedData.Phone
-	}
-	if updatedData.CRO != "" {
-		currentDentist.CRO = updatedData.CRO
-	}
-	if updatedData.Country != "" {
-		currentDentist.Country = updatedData.Country
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
 	}
-	if updatedData.Specialty != "" {
-		currentDentist.Specialty = updatedData.Specialty
+	// Lists are replaced as a whole, so the patched procedures are those sent
+	var procedures struct {
+		ProcedureIDs []string `json:"procedure_ids"`
 	}
-
-	if err := currentDentist.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := json.Unmarshal(patch, &procedures); err == nil && !dentistProceduresExist(w, r, procedures.ProcedureIDs) {
 		return
 	}
 
-	currentDentist.UpdatedAt = time.Now().UTC()
-	updatedAtStr := currentDentist.UpdatedAt.Format(time.RFC3339)
-	createdAtStr := currentDentist.CreatedAt.Format(time.RFC3339)
-
-	_, err = config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName: aws.String("Dentists"),
-		Item: map[string]types.AttributeValue{
-			"ID":        &types.AttributeValueMemberS{Value: currentDentist.ID},
-			"Name":      &types.AttributeValueMemberS{Value: currentDentist.Name},
-			"Email":     &types.AttributeValueMemberS{Value: currentDentist.Email},
-			"Phone":     &types.AttributeValueMemberS{Value: currentDentist.Phone},
-			"CRO":       &types.AttributeValueMemberS{Value: currentDentist.CRO},
-			"Country":   &types.AttributeValueMemberS{Value: currentDentist.Country},
-			"Specialty": &types.AttributeValueMemberS{Value: currentDentist.Specialty},
-			"CreatedAt": &types.AttributeValueMemberS{Value: createdAtStr},
-			"UpdatedAt": &types.AttributeValueMemberS{Value: updatedAtStr},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
+	dentist, err := Dentists.Patch(r.Context(), id, patch)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Dentist not found", http.StatusNotFound)
-			return
+		if !versioning.Conflict(w, r, err) {
+			writeServiceError(w, err, "Dentist", "Failed to update dentist")
 		}
-		http.Error(w, "Failed to update dentist", http.StatusInternalServerError)
-		log.Printf("Error updating dentist: %v", err)
 		return
 	}
+	dentist.Version = version + 1
+	invalidateDentists(r.Context())
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(currentDentist)
+	json.NewEncoder(w).Encode(dentist)
 }
 
 // DeleteDentist godoc
 // @Summary Delete dentist
-// @Description Delete a dentist by ID
+// @Description Soft delete a dentist by ID: the dentist is hidden from lists and lookups, unless ?include_deleted=true, until restored
 // @Tags dentists
 // @Param id path string true "Dentist ID"
 // @Success 204 "No Content"
-// @Failure 404 {string} string "Dentist not found"
-// @Failure 500 {string} string "Failed to delete dentist"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to delete dentist"
 // @Router /api/v1/dental/dentist/{id} [delete]
 func DeleteDentist(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	if err := Dentists.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeServiceError(w, err, "Dentist", "Failed to delete dentist")
+		return
+	}
+	invalidateDentists(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreDentist godoc
+// @Summary Restore a deleted dentist
+// @Description Bring back a soft-deleted dentist
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 200 {object} models.Dentist
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to restore dentist"
+// @Router /api/v1/dental/dentist/{id}/restore [post]
+func RestoreDentist(w http.ResponseWriter, r *http.Request) {
+	dentist, err := Dentists.Restore(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err, "Dentist", "Failed to restore dentist")
+		return
+	}
+	invalidateDentists(r.Context())
 
-	_, err := config.DBClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-		TableName: aws.String("Dentists"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dentist)
+}
+
+// dentistProceduresExist checks the procedures a dentist is credentialed for
+// exist, writing the error response when one does not
+func dentistProceduresExist(w http.ResponseWriter, r *http.Request, procedureIDs []string) bool {
+	if len(procedureIDs) == 0 {
+		return true
+	}
+	procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", procedureIDs)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Dentist not found", http.StatusNotFound)
-			return
+		http.Error(w, "Failed to check procedures", http.StatusInternalServerError)
+		log.Printf("Error fetching procedures %v: %v", procedureIDs, err)
+		return false
+	}
+	found := make(map[string]bool, len(procedures))
+	for _, procedure := range procedures {
+		found[procedure.ID] = true
+	}
+	for _, id := range procedureIDs {
+		if !found[id] {
+			http.Error(w, fmt.Sprintf("Procedure %s not found", id), http.StatusBadRequest)
+			return false
 		}
-		http.Error(w, "Failed to delete dentist", http.StatusInternalServerError)
-		log.Printf("Error deleting dentist: %v", err)
-		return
 	}
+	return true
+}
 
-	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+// checkDentistPerforms rejects appointments whose dentist is not credentialed
+// to perform their procedure with a 422. It returns false when the response
+// was written.
+func checkDentistPerforms(w http.ResponseWriter, r *http.Request, appointments ...models.Appointment) bool {
+	var dentistIDs []string
+	for _, appointment := range appointments {
+		if appointment.ProcedureID != "" && !appointment.IsCancelled() {
+			dentistIDs = append(dentistIDs, appointment.DentistID)
+		}
+	}
+	if len(dentistIDs) == 0 {
+		return true
+	}
+
+	dentists, err := batchGetItems[models.Dentist](r.Context(), "Dentists", dentistIDs)
+	if err != nil {
+		http.Error(w, "Failed to check dentist procedures", http.StatusInternalServerError)
+		log.Printf("Error fetching dentists %v: %v", dentistIDs, err)
+		return false
+	}
+	byID := make(map[string]models.Dentist, len(dentists))
+	for _, dentist := range dentists {
+		byID[dentist.ID] = dentist
+	}
+	for _, appointment := range appointments {
+		dentist, ok := byID[appointment.DentistID]
+		if !ok || appointment.ProcedureID == "" || appointment.IsCancelled() || dentist.Performs(appointment.ProcedureID) {
+			continue
+		}
+		http.Error(w, fmt.Sprintf("Dentist %s is not credentialed to perform procedure %s", dentist.Name, appointment.ProcedureID), http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
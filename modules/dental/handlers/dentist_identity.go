@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Tables of the identities of dentists working at several clinics, kept in
+// the home region as they are read across clinics
+const (
+	dentistIdentitiesTable = "DentistIdentities"
+	dentistLinksTable      = "DentistLinks"
+)
+
+// dentistLinkCodeTTL is how long a link code can be used
+const dentistLinkCodeTTL = 7 * 24 * time.Hour
+
+// maxAgendaDays caps the days of the unified agenda
+const maxAgendaDays = 31
+
+// busyPeriod is a time the dentist cannot be booked
+type busyPeriod struct{ start, end time.Time }
+
+// GetDentistIdentity godoc
+// @Summary Get the clinics a dentist works at
+// @Description Get the identity a dentist record is linked to, with the dentist records of every clinic linked to it
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 200 {object} models.DentistIdentity
+// @Failure 404 {object} apierror.Response "Dentist not linked to other clinics"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist identity"
+// @Router /api/v1/dental/dentist/{id}/identity [get]
+func GetDentistIdentity(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	identity, err := dentistIdentity(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve dentist identity", http.StatusInternalServerError)
+		log.Printf("Error fetching identity of dentist %s: %v", id, err)
+		return
+	}
+	if identity == nil {
+		http.Error(w, "Dentist not linked to other clinics", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identity)
+}
+
+// CreateDentistLinkCode godoc
+// @Summary Create a code linking a dentist's records
+// @Description Create the single-use code with which another clinic links its record of the same dentist, valid for 7 days. The dentist record gets an identity the first time; a new code replaces the previous one.
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 201 {object} models.DentistLinkCode
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to create link code"
+// @Router /api/v1/dental/dentist/{id}/identity/code [post]
+func CreateDentistLinkCode(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	dentist, ok := loadLinkedDentist(w, r, id, "Failed to create link code")
+	if !ok {
+		return
+	}
+
+	link, err := getDentistLink(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to create link code", http.StatusInternalServerError)
+		log.Printf("Error fetching link of dentist %s: %v", id, err)
+		return
+	}
+	now := time.Now().UTC()
+	if link == nil {
+		identity := models.DentistIdentity{
+			ID:        uuid.NewString(),
+			CRO:       dentist.CRO,
+			Country:   dentist.Country,
+			CreatedAt: now.Format(time.RFC3339),
+		}
+		if err := putDentistIdentity(r.Context(), identity); err != nil {
+			http.Error(w, "Failed to create link code", http.StatusInternalServerError)
+			log.Printf("Error creating identity of dentist %s: %v", id, err)
+			return
+		}
+		link = &models.DentistLink{
+			DentistID:  id,
+			ClinicID:   config.ClinicID(r.Context()),
+			IdentityID: identity.ID,
+			LinkedAt:   now.Format(time.RFC3339),
+		}
+		if err := putDentistLink(r.Context(), *link); err != nil {
+			http.Error(w, "Failed to create link code", http.StatusInternalServerError)
+			log.Printf("Error linking dentist %s: %v", id, err)
+			return
+		}
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, "Failed to create link code", http.StatusInternalServerError)
+		log.Printf("Error generating link code: %v", err)
+		return
+	}
+	code := models.DentistLinkCode{
+		IdentityID: link.IdentityID,
+		Code:       link.IdentityID + "." + base64.RawURLEncoding.EncodeToString(secret),
+		ExpiresAt:  now.Add(dentistLinkCodeTTL).Format(time.RFC3339),
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(dentistIdentitiesTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: link.IdentityID},
+		},
+		UpdateExpression:    aws.String("SET JoinCodeHash = :hash, JoinCodeExpiresAt = :expires"),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hash":    &types.AttributeValueMemberS{Value: hashLinkCode(code.Code)},
+			":expires": &types.AttributeValueMemberS{Value: code.ExpiresAt},
+		},
+	}); err != nil {
+		http.Error(w, "Failed to create link code", http.StatusInternalServerError)
+		log.Printf("Error saving link code of identity %s: %v", link.IdentityID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(code)
+}
+
+// JoinDentistIdentity godoc
+// @Summary Link a dentist record to the same dentist at another clinic
+// @Description Link the clinic's record of a dentist to the identity of the code created by another clinic, so that the times the dentist is booked at either are no longer offered at the other. The records must have the same CRO and country. The code is used up.
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param code body models.DentistJoinRequest true "Link code"
+// @Success 200 {object} models.DentistIdentity
+// @Failure 400 {object} apierror.Response "Invalid request body or link code"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 409 {object} apierror.Response "Dentist already linked, or CRO and country differ"
+// @Failure 500 {object} apierror.Response "Failed to link dentist"
+// @Router /api/v1/dental/dentist/{id}/identity/join [post]
+func JoinDentistIdentity(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req models.DentistJoinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	dentist, ok := loadLinkedDentist(w, r, id, "Failed to link dentist")
+	if !ok {
+		return
+	}
+
+	identityID, _, _ := strings.Cut(req.Code, ".")
+	identity, err := getDentistIdentityByID(r.Context(), identityID)
+	if err != nil {
+		http.Error(w, "Failed to link dentist", http.StatusInternalServerError)
+		log.Printf("Error fetching dentist identity %s: %v", identityID, err)
+		return
+	}
+	if identity == nil || identity.JoinCodeHash == "" ||
+		subtle.ConstantTimeCompare([]byte(identity.JoinCodeHash), []byte(hashLinkCode(req.Code))) != 1 ||
+		identity.JoinCodeExpiresAt <= time.Now().UTC().Format(time.RFC3339) {
+		http.Error(w, "Invalid or expired link code", http.StatusBadRequest)
+		return
+	}
+	if !strings.EqualFold(identity.CRO, dentist.CRO) || !strings.EqualFold(identity.Country, dentist.Country) {
+		http.Error(w, "The dentist's CRO and country differ from those of the linked records", http.StatusConflict)
+		return
+	}
+
+	clinicID := config.ClinicID(r.Context())
+	links, err := identityLinks(r.Context(), identity.ID)
+	if err != nil {
+		http.Error(w, "Failed to link dentist", http.StatusInternalServerError)
+		log.Printf("Error listing links of dentist identity %s: %v", identity.ID, err)
+		return
+	}
+	for _, link := range links {
+		if link.ClinicID == clinicID {
+			http.Error(w, "Another record of the clinic is already linked to the dentist", http.StatusConflict)
+			return
+		}
+	}
+
+	link := models.DentistLink{
+		DentistID:  id,
+		ClinicID:   clinicID,
+		IdentityID: identity.ID,
+		LinkedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	err = putDentistLink(r.Context(), link)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Dentist is already linked; unlink it first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to link dentist", http.StatusInternalServerError)
+		log.Printf("Error linking dentist %s: %v", id, err)
+		return
+	}
+
+	// The code is used up
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(dentistIdentitiesTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: identity.ID},
+		},
+		UpdateExpression: aws.String("REMOVE JoinCodeHash, JoinCodeExpiresAt"),
+	}); err != nil {
+		log.Printf("Error clearing link code of dentist identity %s: %v", identity.ID, err)
+	}
+
+	identity.Links = append(links, link)
+	nameClinics(r.Context(), identity.Links)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identity)
+}
+
+// UnlinkDentistIdentity godoc
+// @Summary Unlink a dentist record from the dentist's other clinics
+// @Description Remove the link of the clinic's dentist record, whose agenda no longer takes the dentist's other clinics into account
+// @Tags dentists
+// @Param id path string true "Dentist ID"
+// @Success 204 "Dentist unlinked"
+// @Failure 404 {object} apierror.Response "Dentist not linked to other clinics"
+// @Failure 500 {object} apierror.Response "Failed to unlink dentist"
+// @Router /api/v1/dental/dentist/{id}/identity [delete]
+func UnlinkDentistIdentity(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(dentistLinksTable),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: config.ClinicID(r.Context())},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Dentist not linked to other clinics", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to unlink dentist", http.StatusInternalServerError)
+		log.Printf("Error unlinking dentist %s: %v", id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDentistAgenda godoc
+// @Summary Get a dentist's agenda across clinics
+// @Description Get the appointments and agenda blocks of a dentist at every clinic linked to the dentist's identity, by time. Appointments of other clinics show only their time, duration and status.
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param from query string false "First day (YYYY-MM-DD), default today"
+// @Param days query int false "Number of days, 1 to 31 (default 7)"
+// @Success 200 {object} models.DentistAgenda
+// @Failure 400 {object} apierror.Response "Invalid from or days"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve agenda"
+// @Router /api/v1/dental/dentist/{id}/agenda [get]
+func GetDentistAgenda(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if s := query.Get("from"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			http.Error(w, "from must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	days := 7
+	if s := query.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAgendaDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxAgendaDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	to := from.AddDate(0, 0, days-1)
+
+	if _, ok := loadLinkedDentist(w, r, id, "Failed to retrieve agenda"); !ok {
+		return
+	}
+	clinicID := config.ClinicID(r.Context())
+	links := []models.DentistLink{{DentistID: id, ClinicID: clinicID}}
+	agenda := models.DentistAgenda{DentistID: id, From: from.Format("2006-01-02"), To: to.Format("2006-01-02"), Entries: []models.DentistAgendaEntry{}}
+	identity, err := dentistIdentity(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve agenda", http.StatusInternalServerError)
+		log.Printf("Error fetching identity of dentist %s: %v", id, err)
+		return
+	}
+	if identity != nil {
+		agenda.IdentityID = identity.ID
+		links = identity.Links
+	}
+
+	for _, link := range links {
+		own := link.ClinicID == clinicID
+		ctx := config.WithClinic(r.Context(), link.ClinicID)
+		appointments, err := queryAppointmentsInRange(ctx, link.DentistID, from, to)
+		if err == nil && own {
+			err = expandAppointments(ctx, appointments, map[string]bool{"patient": true, "procedure": true})
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve agenda", http.StatusInternalServerError)
+			log.Printf("Error reading appointments of dentist %s at clinic %s: %v", link.DentistID, link.ClinicID, err)
+			return
+		}
+		for _, appointment := range appointments {
+			start, err := appointment.StartTime()
+			if err != nil {
+				continue
+			}
+			entry := models.DentistAgendaEntry{
+				ClinicID:        link.ClinicID,
+				ClinicName:      link.ClinicName,
+				Type:            "appointment",
+				ID:              appointment.ID,
+				Start:           start.UTC().Format(slotLayout),
+				DurationMinutes: appointment.DurationMinutes(),
+				Status:          appointment.Status,
+			}
+			if own {
+				if appointment.Patient != nil {
+					entry.PatientName = appointment.Patient.Name
+				}
+				if appointment.Procedure != nil {
+					entry.ProcedureName = appointment.Procedure.Name
+				}
+			} else {
+				entry.ID = ""
+			}
+			agenda.Entries = append(agenda.Entries, entry)
+		}
+
+		blocks, err := scanUnavailability(ctx, link.DentistID, from, to.AddDate(0, 0, 1))
+		if err != nil {
+			http.Error(w, "Failed to retrieve agenda", http.StatusInternalServerError)
+			log.Printf("Error reading agenda blocks of dentist %s at clinic %s: %v", link.DentistID, link.ClinicID, err)
+			return
+		}
+		for _, block := range blocks {
+			start, end, err := block.Period()
+			if err != nil {
+				continue
+			}
+			entry := models.DentistAgendaEntry{
+				ClinicID:        link.ClinicID,
+				ClinicName:      link.ClinicName,
+				Type:            "unavailable",
+				Start:           start.UTC().Format(slotLayout),
+				DurationMinutes: int(end.Sub(start).Minutes()),
+			}
+			if own {
+				entry.ID = block.ID
+			}
+			agenda.Entries = append(agenda.Entries, entry)
+		}
+	}
+	sort.SliceStable(agenda.Entries, func(i, j int) bool {
+		return agenda.Entries[i].Start < agenda.Entries[j].Start
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agenda)
+}
+
+// busyElsewhere returns the times between from and to the dentist is booked
+// or blocked at the other clinics linked to the dentist's identity
+func busyElsewhere(ctx context.Context, dentistID string, from, to time.Time) ([]busyPeriod, error) {
+	link, err := getDentistLink(ctx, dentistID)
+	if err != nil || link == nil {
+		return nil, err
+	}
+	links, err := identityLinks(ctx, link.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	var busy []busyPeriod
+	for _, other := range links {
+		if other.DentistID == dentistID {
+			continue
+		}
+		clinicCtx := config.WithClinic(ctx, other.ClinicID)
+		// Appointments starting the day before may run into from
+		appointments, err := queryAppointmentsInRange(clinicCtx, other.DentistID, from.AddDate(0, 0, -1), to)
+		if err != nil {
+			return nil, err
+		}
+		for _, appointment := range appointments {
+			if appointment.IsCancelled() {
+				continue
+			}
+			start, err := appointment.StartTime()
+			if err != nil {
+				continue
+			}
+			end := start.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+			if start.Before(to) && end.After(from) {
+				busy = append(busy, busyPeriod{start, end})
+			}
+		}
+		blocks, err := scanUnavailability(clinicCtx, other.DentistID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			if start, end, err := block.Period(); err == nil {
+				busy = append(busy, busyPeriod{start, end})
+			}
+		}
+	}
+	return busy, nil
+}
+
+// dentistIdentity returns the identity a dentist record is linked to, with
+// the links of every clinic, or nil when it is not linked
+func dentistIdentity(ctx context.Context, dentistID string) (*models.DentistIdentity, error) {
+	link, err := getDentistLink(ctx, dentistID)
+	if err != nil || link == nil {
+		return nil, err
+	}
+	identity, err := getDentistIdentityByID(ctx, link.IdentityID)
+	if err != nil || identity == nil {
+		return nil, err
+	}
+	if identity.Links, err = identityLinks(ctx, identity.ID); err != nil {
+		return nil, err
+	}
+	nameClinics(ctx, identity.Links)
+	return identity, nil
+}
+
+// loadLinkedDentist fetches a dentist of the clinic, writing the error
+// response when there is none
+func loadLinkedDentist(w http.ResponseWriter, r *http.Request, id, failure string) (models.Dentist, bool) {
+	dentists, err := batchGetItems[models.Dentist](r.Context(), "Dentists", []string{id})
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("Error fetching dentist %s: %v", id, err)
+		return models.Dentist{}, false
+	}
+	if len(dentists) == 0 {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return models.Dentist{}, false
+	}
+	return dentists[0], true
+}
+
+// nameClinics fills the clinic names of links, leaving those that cannot be
+// read unnamed
+func nameClinics(ctx context.Context, links []models.DentistLink) {
+	for i := range links {
+		if clinic, err := clinics.Get(ctx, links[i].ClinicID); err == nil {
+			links[i].ClinicName = clinic.Name
+		}
+	}
+}
+
+func getDentistLink(ctx context.Context, dentistID string) (*models.DentistLink, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(dentistLinksTable),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: dentistID},
+		},
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var link models.DentistLink
+	if err := attributevalue.UnmarshalMap(result.Item, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func identityLinks(ctx context.Context, identityID string) ([]models.DentistLink, error) {
+	return paging.ScanAll[models.DentistLink](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(dentistLinksTable),
+		FilterExpression: aws.String("IdentityID = :identity"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":identity": &types.AttributeValueMemberS{Value: identityID},
+		},
+	})
+}
+
+func getDentistIdentityByID(ctx context.Context, id string) (*models.DentistIdentity, error) {
+	if id == "" {
+		return nil, nil
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(dentistIdentitiesTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var identity models.DentistIdentity
+	if err := attributevalue.UnmarshalMap(result.Item, &identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func putDentistIdentity(ctx context.Context, identity models.DentistIdentity) error {
+	item, err := attributevalue.MarshalMap(identity)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(dentistIdentitiesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	return err
+}
+
+// putDentistLink links a dentist record not linked yet
+func putDentistLink(ctx context.Context, link models.DentistLink) error {
+	item, err := attributevalue.MarshalMap(link)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(dentistLinksTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(DentistID)"),
+	})
+	return err
+}
+
+func hashLinkCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
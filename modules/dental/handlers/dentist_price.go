@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetDentistPrices godoc
+// @Summary List a dentist's price overrides
+// @Description List the procedures for which a dentist charges a specific price instead of the catalog price
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 200 {array} models.DentistPrice
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist prices"
+// @Router /api/v1/dental/dentist/{id}/prices [get]
+func GetDentistPrices(w http.ResponseWriter, r *http.Request) {
+	dentistID := mux.Vars(r)["id"]
+
+	prices, err := queryItems[models.DentistPrice](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String(pricing.TableName),
+		KeyConditionExpression: aws.String("DentistID = :dentistId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dentistId": &types.AttributeValueMemberS{Value: dentistID},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve dentist prices", http.StatusInternalServerError)
+		log.Printf("Error querying prices of dentist %s: %v", dentistID, err)
+		return
+	}
+	if prices == nil {
+		prices = []models.DentistPrice{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prices)
+}
+
+// SetDentistPrice godoc
+// @Summary Set a dentist's price for a procedure
+// @Description Define the price a dentist charges for a catalog procedure, overriding the catalog price in quotes, revenues and forecasts
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param procedureId path string true "Procedure ID"
+// @Param price body models.DentistPrice true "Price (only the price field is used)"
+// @Success 200 {object} models.DentistPrice
+// @Failure 400 {object} apierror.Response "Invalid request body or price"
+// @Failure 404 {object} apierror.Response "Dentist or procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to save dentist price"
+// @Router /api/v1/dental/dentist/{id}/prices/{procedureId} [put]
+func SetDentistPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var price models.DentistPrice
+	if err := json.NewDecoder(r.Body).Decode(&price); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	price.DentistID = vars["id"]
+	price.ProcedureID = vars["procedureId"]
+	if err := price.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for table, id := range map[string]string{"Dentists": price.DentistID, "Procedures": price.ProcedureID} {
+		exists, err := itemExists(r.Context(), table, id)
+		if err != nil {
+			http.Error(w, "Failed to save dentist price", http.StatusInternalServerError)
+			log.Printf("Error checking %s item %s: %v", table, id, err)
+			return
+		}
+		if !exists {
+			http.Error(w, "Dentist or procedure not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	existing, err := pricing.GetOverride(r.Context(), price.DentistID, price.ProcedureID)
+	if err != nil {
+		http.Error(w, "Failed to save dentist price", http.StatusInternalServerError)
+		log.Printf("Error fetching dentist price: %v", err)
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	price.CreatedAt = now
+	if existing != nil {
+		price.CreatedAt = existing.CreatedAt
+	}
+	price.UpdatedAt = now
+
+	item, err := attributevalue.MarshalMap(price)
+	if err != nil {
+		http.Error(w, "Failed to save dentist price", http.StatusInternalServerError)
+		log.Printf("Error marshaling dentist price: %v", err)
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(pricing.TableName),
+		Item:      item,
+	}); err != nil {
+		http.Error(w, "Failed to save dentist price", http.StatusInternalServerError)
+		log.Printf("Error saving dentist price: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(price)
+}
+
+// DeleteDentistPrice godoc
+// @Summary Remove a dentist's price for a procedure
+// @Description Remove a dentist's price override so the catalog price applies again
+// @Tags dentists
+// @Param id path string true "Dentist ID"
+// @Param procedureId path string true "Procedure ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Dentist price not found"
+// @Failure 500 {object} apierror.Response "Failed to delete dentist price"
+// @Router /api/v1/dental/dentist/{id}/prices/{procedureId} [delete]
+func DeleteDentistPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(pricing.TableName),
+		Key: map[string]types.AttributeValue{
+			"DentistID":   &types.AttributeValueMemberS{Value: vars["id"]},
+			"ProcedureID": &types.AttributeValueMemberS{Value: vars["procedureId"]},
+		},
+		ConditionExpression: aws.String("attribute_exists(DentistID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Dentist price not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete dentist price", http.StatusInternalServerError)
+		log.Printf("Error deleting dentist price: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEffectivePrice godoc
+// @Summary Resolve the effective price of a procedure
+// @Description Resolve the price charged for a procedure on a date: the dentist's own price when dentistId is given and an override exists, otherwise the catalog price in force on that date
+// @Tags procedures
+// @Produce json
+// @Param id path string true "Procedure ID"
+// @Param dentistId query string false "Dentist ID"
+// @Param at query string false "Date (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} models.EffectivePrice
+// @Failure 400 {object} apierror.Response "Invalid date"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to resolve price"
+// @Router /api/v1/dental/procedure/{id}/price [get]
+func GetEffectivePrice(w http.ResponseWriter, r *http.Request) {
+	procedureID := mux.Vars(r)["id"]
+
+	at := time.Now().UTC()
+	if v := r.URL.Query().Get("at"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "at must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		at = parsed
+	}
+
+	price, err := pricing.Resolve(r.Context(), procedureID, r.URL.Query().Get("dentistId"), at)
+	if err != nil {
+		if errors.Is(err, pricing.ErrProcedureNotFound) {
+			http.Error(w, "Procedure not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to resolve price", http.StatusInternalServerError)
+		log.Printf("Error resolving price of procedure %s: %v", procedureID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(price)
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// durationHistoryDays is how far back duration suggestions look by default
+const durationHistoryDays = 180
+
+// StartAppointment godoc
+// @Summary Record the start of an appointment
+// @Description Record when the patient was seated, now or at the time sent, to learn how long procedures actually take
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param id path string true "Appointment ID"
+// @Param time body models.AppointmentTimeRequest false "When the appointment started (default now)"
+// @Success 200 {object} models.Appointment
+// @Failure 400 {object} apierror.Response "Invalid time"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 409 {object} apierror.Response "Appointment cancelled, missed or already finished"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
+// @Router /api/v1/dental/appointment/{id}/start [post]
+func StartAppointment(w http.ResponseWriter, r *http.Request) {
+	at, ok := appointmentTime(w, r)
+	if !ok {
+		return
+	}
+	appointment, ok := loadAppointment(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if appointment.IsCancelled() || appointment.Status == models.AppointmentStatusNoShow {
+		http.Error(w, "The appointment was cancelled or missed", http.StatusConflict)
+		return
+	}
+	if appointment.FinishedAt != "" {
+		http.Error(w, "The appointment already finished", http.StatusConflict)
+		return
+	}
+
+	previous := appointment
+	appointment.StartedAt = at.Format(time.RFC3339)
+	if !saveAppointmentChange(w, r, previous, &appointment) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appointment)
+}
+
+// FinishAppointment godoc
+// @Summary Record the end of an appointment
+// @Description Record when the appointment ended, now or at the time sent, and complete it, with the same checks and effects as completing it by an update
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param id path string true "Appointment ID"
+// @Param time body models.AppointmentTimeRequest false "When the appointment finished (default now)"
+// @Success 200 {object} models.Appointment
+// @Failure 400 {object} apierror.Response "Invalid time or before the start"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 409 {object} apierror.Response "Appointment not started, cancelled or missed"
+// @Failure 422 {object} apierror.Response "Signed consent required with the consent flow in the Link header"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
+// @Router /api/v1/dental/appointment/{id}/finish [post]
+func FinishAppointment(w http.ResponseWriter, r *http.Request) {
+	at, ok := appointmentTime(w, r)
+	if !ok {
+		return
+	}
+	appointment, ok := loadAppointment(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if appointment.IsCancelled() || appointment.Status == models.AppointmentStatusNoShow {
+		http.Error(w, "The appointment was cancelled or missed", http.StatusConflict)
+		return
+	}
+	started, err := time.Parse(time.RFC3339, appointment.StartedAt)
+	if err != nil {
+		http.Error(w, "The appointment was not started", http.StatusConflict)
+		return
+	}
+	if !at.After(started) {
+		http.Error(w, "The end must be after the start", http.StatusBadRequest)
+		return
+	}
+
+	previous := appointment
+	appointment.FinishedAt = at.Format(time.RFC3339)
+	appointment.Status = models.AppointmentStatusCompleted
+	if !saveAppointmentChange(w, r, previous, &appointment) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appointment)
+}
+
+// GetDurationSuggestions godoc
+// @Summary Suggest procedure durations
+// @Description Suggest default durations for the procedures of the catalog from how long the completed appointments with recorded start and end actually took, for each procedure across dentists and for each dentist. The suggestion is the average rounded to 5 minutes; procedures and dentists with fewer appointments than minSamples are left out.
+// @Tags procedures
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD), default 180 days ago"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive, default today"
+// @Param minSamples query int false "Fewest appointments to suggest a duration (default 5)"
+// @Param dentistId query string false "Only the suggestions of this dentist in the per-dentist list"
+// @Success 200 {object} models.DurationSuggestions
+// @Failure 400 {object} apierror.Response "Invalid date range or minSamples"
+// @Failure 500 {object} apierror.Response "Failed to suggest durations"
+// @Router /api/v1/dental/procedure/durations [get]
+func GetDurationSuggestions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -durationHistoryDays), today
+	if query.Get("from") != "" || query.Get("to") != "" {
+		var err error
+		if from, to, err = parseReportRange(query.Get("from"), query.Get("to")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	minSamples := 5
+	if v := query.Get("minSamples"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "minSamples must be a positive number", http.StatusBadRequest)
+			return
+		}
+		minSamples = n
+	}
+	dentistID := query.Get("dentistId")
+
+	appointments, err := scanAppointmentsInRange(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to suggest durations", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments for duration suggestions: %v", err)
+		return
+	}
+
+	type key struct{ procedureID, dentistID string }
+	minutes := map[key][]float64{}
+	for _, appointment := range appointments {
+		if appointment.Status != models.AppointmentStatusCompleted || appointment.ProcedureID == "" {
+			continue
+		}
+		actual, ok := appointment.ActualMinutes()
+		if !ok || actual > models.MaxProcedureDuration {
+			continue
+		}
+		minutes[key{appointment.ProcedureID, ""}] = append(minutes[key{appointment.ProcedureID, ""}], actual)
+		if dentistID == "" || appointment.DentistID == dentistID {
+			k := key{appointment.ProcedureID, appointment.DentistID}
+			minutes[k] = append(minutes[k], actual)
+		}
+	}
+
+	var ids []string
+	for k := range minutes {
+		if k.dentistID == "" && len(minutes[k]) >= minSamples {
+			ids = append(ids, k.procedureID)
+		}
+	}
+	byID := make(map[string]models.Procedure, len(ids))
+	if len(ids) > 0 {
+		procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", ids)
+		if err != nil {
+			http.Error(w, "Failed to suggest durations", http.StatusInternalServerError)
+			log.Printf("Error fetching procedures for duration suggestions: %v", err)
+			return
+		}
+		for _, procedure := range procedures {
+			byID[procedure.ID] = procedure
+		}
+	}
+
+	result := models.DurationSuggestions{
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		MinSamples: minSamples,
+		Procedures: []models.DurationSuggestion{},
+		Dentists:   []models.DurationSuggestion{},
+	}
+	for k, samples := range minutes {
+		procedure, ok := byID[k.procedureID]
+		if !ok || len(samples) < minSamples {
+			continue
+		}
+		suggestion := durationSuggestion(procedure, samples)
+		if k.dentistID == "" {
+			result.Procedures = append(result.Procedures, suggestion)
+		} else {
+			suggestion.DentistID = k.dentistID
+			result.Dentists = append(result.Dentists, suggestion)
+		}
+	}
+	sort.Slice(result.Procedures, func(i, j int) bool {
+		a, b := result.Procedures[i], result.Procedures[j]
+		if da, db := math.Abs(float64(a.Change)), math.Abs(float64(b.Change)); da != db {
+			return da > db
+		}
+		return a.ProcedureName < b.ProcedureName
+	})
+	sort.Slice(result.Dentists, func(i, j int) bool {
+		a, b := result.Dentists[i], result.Dentists[j]
+		if a.ProcedureName != b.ProcedureName {
+			return a.ProcedureName < b.ProcedureName
+		}
+		return a.DentistID < b.DentistID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ApplyDurationSuggestions godoc
+// @Summary Apply approved procedure durations
+// @Description Set the catalog duration of the procedures to the durations approved, usually taken from the suggestions. Appointments already booked keep their duration.
+// @Tags procedures
+// @Accept json
+// @Produce json
+// @Param changes body models.DurationApplyRequest true "Procedures and their new durations"
+// @Success 200 {array} models.Procedure
+// @Failure 400 {object} apierror.Response "Invalid request body or durations"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to apply durations"
+// @Router /api/v1/dental/procedure/durations/apply [post]
+func ApplyDurationSuggestions(w http.ResponseWriter, r *http.Request) {
+	var request models.DurationApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	updated := make([]models.Procedure, 0, len(request.Changes))
+	for _, change := range request.Changes {
+		result, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String("Procedures"),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: change.ProcedureID},
+			},
+			UpdateExpression:         aws.String("SET #duration = :duration, UpdatedAt = :now"),
+			ConditionExpression:      aws.String("attribute_exists(ID)"),
+			ExpressionAttributeNames: map[string]string{"#duration": "Duration"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":duration": &types.AttributeValueMemberS{Value: strconv.Itoa(change.Duration)},
+				":now":      &types.AttributeValueMemberS{Value: now},
+			},
+			ReturnValues: types.ReturnValueAllNew,
+		})
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Procedure "+change.ProcedureID+" not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to apply durations", http.StatusInternalServerError)
+			log.Printf("Error updating duration of procedure %s: %v", change.ProcedureID, err)
+			return
+		}
+		var procedure models.Procedure
+		if err := attributevalue.UnmarshalMap(result.Attributes, &procedure); err != nil {
+			log.Printf("Error unmarshaling procedure %s: %v", change.ProcedureID, err)
+			procedure = models.Procedure{ID: change.ProcedureID, Duration: strconv.Itoa(change.Duration), UpdatedAt: now}
+		}
+		updated = append(updated, procedure)
+	}
+	invalidateAgendas(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// durationSuggestion averages the minutes a procedure took
+func durationSuggestion(procedure models.Procedure, samples []float64) models.DurationSuggestion {
+	total := 0.0
+	for _, minutes := range samples {
+		total += minutes
+	}
+	average := total / float64(len(samples))
+	suggested := int(math.Round(average/5)) * 5
+	if suggested < 5 {
+		suggested = 5
+	}
+	current, _ := strconv.Atoi(procedure.Duration)
+	return models.DurationSuggestion{
+		ProcedureID:       procedure.ID,
+		ProcedureName:     procedure.Name,
+		Samples:           len(samples),
+		CurrentDuration:   current,
+		AverageDuration:   math.Round(average*10) / 10,
+		SuggestedDuration: suggested,
+		Change:            suggested - current,
+	}
+}
+
+// appointmentTime reads the optional time of a start or finish, writing the
+// error response when it is invalid
+func appointmentTime(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	var request models.AppointmentTimeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	at, err := request.Time(time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// loadAppointment fetches an appointment, writing the error response when it
+// fails
+func loadAppointment(w http.ResponseWriter, r *http.Request, id string) (models.Appointment, bool) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Appointments"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error fetching appointment with ID %s: %v", id, err)
+		return models.Appointment{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Appointment not found", http.StatusNotFound)
+		return models.Appointment{}, false
+	}
+	var appointment models.Appointment
+	if err := attributevalue.UnmarshalMap(result.Item, &appointment); err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling appointment data: %v", err)
+		return models.Appointment{}, false
+	}
+	return appointment, true
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// queryItems runs a paginated query and unmarshals every item into T, with
+// the same per-page timeout and error handling as paging.ScanAll
+func queryItems[T any](ctx context.Context, input *dynamodb.QueryInput) ([]T, error) {
+	var items []T
+	if input.IndexName == nil && input.ConsistentRead == nil {
+		input.ConsistentRead = config.ConsistentRead(ctx)
+	}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var v T
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				log.Printf("Error unmarshaling %s item: %v", *input.TableName, err)
+				continue
+			}
+			items = append(items, v)
+		}
+	}
+	return items, nil
+}
+
+// itemExists reports whether an item with the given ID exists in the table
+func itemExists(ctx context.Context, tableName, id string) (bool, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ProjectionExpression: aws.String("ID"),
+		ConsistentRead:       config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// appointmentExpansions lists the related entities that can be embedded in appointment responses
+var appointmentExpansions = map[string]bool{
+	"patient":   true,
+	"dentist":   true,
+	"procedure": true,
+}
+
+// parseExpand reads the comma-separated ?expand= parameter
+func parseExpand(r *http.Request) (map[string]bool, error) {
+	expand := make(map[string]bool)
+	for _, value := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !appointmentExpansions[value] {
+			return nil, fmt.Errorf("cannot expand %q, allowed values are patient, dentist and procedure", value)
+		}
+		expand[value] = true
+	}
+	return expand, nil
+}
+
+// expandAppointments embeds the requested related entities into each
+// appointment, resolving every entity type with batched lookups, and fills
+// the label and color each appointment is displayed with
+func expandAppointments(ctx context.Context, appointments []models.Appointment, expand map[string]bool) error {
+	if len(appointments) == 0 {
+		return nil
+	}
+
+	if expand["patient"] {
+		patients, err := batchGetByID[models.Patient](ctx, "Patients", appointments, func(a models.Appointment) string { return a.PatientID }, func(p models.Patient) string { return p.ID })
+		if err != nil {
+			return err
+		}
+		for i := range appointments {
+			appointments[i].Patient = patients[appointments[i].PatientID]
+		}
+	}
+	if expand["dentist"] {
+		dentists, err := batchGetByID[models.Dentist](ctx, "Dentists", appointments, func(a models.Appointment) string { return a.DentistID }, func(d models.Dentist) string { return d.ID })
+		if err != nil {
+			return err
+		}
+		for i := range appointments {
+			appointments[i].Dentist = dentists[appointments[i].DentistID]
+		}
+	}
+	if expand["procedure"] {
+		procedures, err := batchGetByID[models.Procedure](ctx, "Procedures", appointments, func(a models.Appointment) string { return a.ProcedureID }, func(p models.Procedure) string { return p.ID })
+		if err != nil {
+			return err
+		}
+		for i := range appointments {
+			appointments[i].Procedure = procedures[appointments[i].ProcedureID]
+		}
+	}
+
+	return displayAppointments(ctx, appointments, expand["procedure"])
+}
+
+// displayAppointments fills the label and color of each appointment, looking
+// up the procedures of those that do not set both unless they were expanded
+func displayAppointments(ctx context.Context, appointments []models.Appointment, expanded bool) error {
+	procedures := map[string]*models.Procedure{}
+	if expanded {
+		for _, appointment := range appointments {
+			procedures[appointment.ProcedureID] = appointment.Procedure
+		}
+	} else {
+		var inherit []models.Appointment
+		for _, appointment := range appointments {
+			if appointment.Label == "" || appointment.Color == "" {
+				inherit = append(inherit, appointment)
+			}
+		}
+		var err error
+		procedures, err = batchGetByID[models.Procedure](ctx, "Procedures", inherit, func(a models.Appointment) string { return a.ProcedureID }, func(p models.Procedure) string { return p.ID })
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range appointments {
+		appointments[i].Display = appointments[i].DisplayFor(procedures[appointments[i].ProcedureID])
+	}
+	return nil
+}
+
+// batchGetByID collects the distinct referenced IDs and fetches them in
+// chunks of models.MaxBatchGetIDs, returning the entities keyed by ID
+func batchGetByID[T any](ctx context.Context, tableName string, appointments []models.Appointment, ref func(models.Appointment) string, id func(T) string) (map[string]*T, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, appointment := range appointments {
+		if v := ref(appointment); v != "" && !seen[v] {
+			seen[v] = true
+			ids = append(ids, v)
+		}
+	}
+
+	byID := make(map[string]*T, len(ids))
+	for start := 0; start < len(ids); start += models.MaxBatchGetIDs {
+		end := start + models.MaxBatchGetIDs
+		if end > len(ids) {
+			end = len(ids)
+		}
+		items, err := batchGetItems[T](ctx, tableName, ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			byID[id(items[i])] = &items[i]
+		}
+	}
+	return byID, nil
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/service"
+	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetPatientByExternalID godoc
+// @Summary Get a patient by external ID
+// @Description Get the patient imported with the given ID from a source system, such as the clinic's previous software
+// @Tags patients
+// @Produce json
+// @Param source path string true "Source system"
+// @Param externalId path string true "ID of the patient in the source system"
+// @Success 200 {object} models.Patient
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patient"
+// @Router /api/v1/dental/patient/external/{source}/{externalId} [get]
+func GetPatientByExternalID(w http.ResponseWriter, r *http.Request) {
+	handleExternalLookup[models.Patient](w, r, "Patients", "Patient")
+}
+
+// GetDentistByExternalID godoc
+// @Summary Get a dentist by external ID
+// @Description Get the dentist imported with the given ID from a source system, such as the clinic's previous software
+// @Tags dentists
+// @Produce json
+// @Param source path string true "Source system"
+// @Param externalId path string true "ID of the dentist in the source system"
+// @Success 200 {object} models.Dentist
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dentist"
+// @Router /api/v1/dental/dentist/external/{source}/{externalId} [get]
+func GetDentistByExternalID(w http.ResponseWriter, r *http.Request) {
+	handleExternalLookup[models.Dentist](w, r, "Dentists", "Dentist")
+}
+
+// GetProcedureByExternalID godoc
+// @Summary Get a procedure by external ID
+// @Description Get the procedure imported with the given ID from a source system, such as the clinic's previous software
+// @Tags procedures
+// @Produce json
+// @Param source path string true "Source system"
+// @Param externalId path string true "ID of the procedure in the source system"
+// @Success 200 {object} models.Procedure
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedure"
+// @Router /api/v1/dental/procedure/external/{source}/{externalId} [get]
+func GetProcedureByExternalID(w http.ResponseWriter, r *http.Request) {
+	handleExternalLookup[models.Procedure](w, r, "Procedures", "Procedure")
+}
+
+// GetAppointmentByExternalID godoc
+// @Summary Get an appointment by external ID
+// @Description Get the appointment imported with the given ID from a source system, such as the clinic's previous software
+// @Tags appointments
+// @Produce json
+// @Param source path string true "Source system"
+// @Param externalId path string true "ID of the appointment in the source system"
+// @Success 200 {object} models.Appointment
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointment"
+// @Router /api/v1/dental/appointment/external/{source}/{externalId} [get]
+func GetAppointmentByExternalID(w http.ResponseWriter, r *http.Request) {
+	handleExternalLookup[models.Appointment](w, r, "Appointments", "Appointment")
+}
+
+// ImportPatients godoc
+// @Summary Import patients from another system
+// @Description Create up to 500 patients migrated from a source system, each with its original ID in external_ids[source]. Patients already imported with the same external ID are left as they are, so an interrupted import can be sent again.
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param import body models.ImportRequest[models.Patient] true "Source system and patients"
+// @Success 200 {object} models.ImportResult
+// @Failure 400 {object} apierror.Response "Invalid request body, source or number of records"
+// @Failure 500 {object} apierror.Response "Failed to import patients"
+// @Router /api/v1/dental/patient/import [post]
+func ImportPatients(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, "Patients", "patients",
+		func(p *models.Patient) models.ExternalIDs { return p.ExternalIDs },
+		func(ctx context.Context, patient models.Patient, _ string) (string, error) {
+			patient, err := Patients.Create(ctx, patient)
+			if err != nil {
+				return "", err
+			}
+			counters.IncrementAsync(ctx, counters.PatientsCounter(config.ClinicID(ctx)), 1)
+			return patient.ID, nil
+		})
+}
+
+// ImportDentists godoc
+// @Summary Import dentists from another system
+// @Description Create up to 500 dentists migrated from a source system, each with its original ID in external_ids[source]. Dentists already imported with the same external ID are left as they are, so an interrupted import can be sent again.
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param import body models.ImportRequest[models.Dentist] true "Source system and dentists"
+// @Success 200 {object} models.ImportResult
+// @Failure 400 {object} apierror.Response "Invalid request body, source or number of records"
+// @Failure 500 {object} apierror.Response "Failed to import dentists"
+// @Router /api/v1/dental/dentist/import [post]
+func ImportDentists(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, "Dentists", "dentists",
+		func(d *models.Dentist) models.ExternalIDs { return d.ExternalIDs },
+		func(ctx context.Context, dentist models.Dentist, _ string) (string, error) {
+			dentist, err := Dentists.Create(ctx, dentist)
+			if err != nil {
+				return "", err
+			}
+			invalidateDentists(ctx)
+			return dentist.ID, nil
+		})
+}
+
+// ImportProcedures godoc
+// @Summary Import procedures from another system
+// @Description Create up to 500 procedures migrated from a source system, each with its original ID in external_ids[source]. Procedures already imported with the same external ID are left as they are, so an interrupted import can be sent again.
+// @Tags procedures
+// @Accept json
+// @Produce json
+// @Param import body models.ImportRequest[models.Procedure] true "Source system and procedures"
+// @Success 200 {object} models.ImportResult
+// @Failure 400 {object} apierror.Response "Invalid request body, source or number of records"
+// @Failure 500 {object} apierror.Response "Failed to import procedures"
+// @Router /api/v1/dental/procedure/import [post]
+func ImportProcedures(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, "Procedures", "procedures",
+		func(p *models.Procedure) models.ExternalIDs { return p.ExternalIDs },
+		func(ctx context.Context, procedure models.Procedure, _ string) (string, error) {
+			procedure, err := Procedures.Create(ctx, procedure)
+			if err != nil {
+				return "", err
+			}
+			return procedure.ID, nil
+		})
+}
+
+// ImportAppointments godoc
+// @Summary Import appointments from another system
+// @Description Create up to 500 appointments migrated from a source system, each with its original ID in external_ids[source]. patient_id, dentist_id and procedure_id may be the IDs of the source system, which are replaced by the records imported from it, so patients, dentists and procedures are imported first. The appointments are history: they are not checked against the dentist's working hours, credentials or pre-authorizations. Appointments already imported with the same external ID are left as they are.
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param import body models.ImportRequest[models.Appointment] true "Source system and appointments"
+// @Success 200 {object} models.ImportResult
+// @Failure 400 {object} apierror.Response "Invalid request body, source or number of records"
+// @Failure 500 {object} apierror.Response "Failed to import appointments"
+// @Router /api/v1/dental/appointment/import [post]
+func ImportAppointments(w http.ResponseWriter, r *http.Request) {
+	references := make(map[string]map[string]string)
+	handleImport(w, r, "Appointments", "appointments",
+		func(a *models.Appointment) models.ExternalIDs { return a.ExternalIDs },
+		func(ctx context.Context, appointment models.Appointment, source string) (string, error) {
+			for _, table := range []string{"Patients", "Dentists", "Procedures"} {
+				if _, ok := references[table]; ok {
+					continue
+				}
+				index, err := externalIndex(ctx, table, source)
+				if err != nil {
+					return "", err
+				}
+				references[table] = index
+			}
+			if id, ok := references["Patients"][appointment.PatientID]; ok {
+				appointment.PatientID = id
+			}
+			if id, ok := references["Dentists"][appointment.DentistID]; ok {
+				appointment.DentistID = id
+			}
+			if id, ok := references["Procedures"][appointment.ProcedureID]; ok {
+				appointment.ProcedureID = id
+			}
+
+			appointment, err := Appointments.Create(ctx, appointment)
+			if err != nil {
+				return "", err
+			}
+			if day, ok := appointmentDay(appointment.DateTime); ok {
+				counters.IncrementAsync(ctx, counters.AppointmentsPerDayCounter(config.ClinicID(ctx), day), 1)
+				invalidateAgenda(ctx, day)
+			}
+			webhooks.Publish(ctx, webhooks.EventAppointmentCreated, appointment)
+			return appointment.ID, nil
+		})
+}
+
+// handleImport creates the records of an import request that were not
+// imported from the same source before, reporting the outcome of each one.
+// A record that cannot be created does not stop the others.
+func handleImport[T any](w http.ResponseWriter, r *http.Request, tableName, entity string,
+	externalIDs func(*T) models.ExternalIDs,
+	create func(ctx context.Context, record T, source string) (string, error)) {
+	var request models.ImportRequest[T]
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imported, err := externalIndex(r.Context(), tableName, request.Source)
+	if err != nil {
+		http.Error(w, "Failed to import "+entity, http.StatusInternalServerError)
+		log.Printf("Error indexing %s imported from %s: %v", entity, request.Source, err)
+		return
+	}
+
+	result := models.ImportResult{Source: request.Source, Records: make([]models.ImportRecordResult, 0, len(request.Records))}
+	for i := range request.Records {
+		record := &request.Records[i]
+		externalID := externalIDs(record)[request.Source]
+		outcome := models.ImportRecordResult{ExternalID: externalID}
+		switch id, ok := imported[externalID]; {
+		case externalID == "":
+			outcome.Status = models.ImportStatusFailed
+			outcome.Error = fmt.Sprintf("external_ids.%s is required", request.Source)
+		case ok:
+			outcome.ID = id
+			outcome.Status = models.ImportStatusExisting
+		default:
+			id, err := create(r.Context(), *record, request.Source)
+			if err != nil {
+				outcome.Status = models.ImportStatusFailed
+				outcome.Error = importError(err)
+				if outcome.Error == "" {
+					outcome.Error = "failed to save record"
+					log.Printf("Error importing %s %s from %s: %v", entity, externalID, request.Source, err)
+				}
+				break
+			}
+			imported[externalID] = id
+			outcome.ID = id
+			outcome.Status = models.ImportStatusCreated
+		}
+
+		switch outcome.Status {
+		case models.ImportStatusCreated:
+			result.Created++
+		case models.ImportStatusExisting:
+			result.Existing++
+		default:
+			result.Failed++
+		}
+		result.Records = append(result.Records, outcome)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// importError returns the message reported for a record that failed on its
+// own data, or "" for failures that are logged instead
+func importError(err error) string {
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		return validation.Error()
+	case errors.Is(err, service.ErrAlreadyExists):
+		return "a record with this ID already exists"
+	default:
+		return ""
+	}
+}
+
+// handleExternalLookup writes the record of a table imported with the
+// external ID in the request path
+func handleExternalLookup[T any](w http.ResponseWriter, r *http.Request, tableName, entity string) {
+	vars := mux.Vars(r)
+	items, err := paging.ScanAll[T](r.Context(), externalIDScan(tableName, vars["source"], "ExternalIDs.#source = :externalId", vars["externalId"]))
+	if err != nil {
+		http.Error(w, "Failed to retrieve "+strings.ToLower(entity), http.StatusInternalServerError)
+		log.Printf("Error looking up %s %s/%s: %v", entity, vars["source"], vars["externalId"], err)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, entity+" not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items[0])
+}
+
+// externalIndex maps the IDs the records of a table had in a source system
+// to their IDs here
+func externalIndex(ctx context.Context, tableName, source string) (map[string]string, error) {
+	type imported struct {
+		ID          string
+		ExternalIDs models.ExternalIDs
+	}
+	items, err := paging.ScanAll[imported](ctx, externalIDScan(tableName, source, "attribute_exists(ExternalIDs.#source)", ""))
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]string, len(items))
+	for _, item := range items {
+		index[item.ExternalIDs[source]] = item.ID
+	}
+	return index, nil
+}
+
+func externalIDScan(tableName, source, filter, externalID string) *dynamodb.ScanInput {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		FilterExpression:         aws.String(filter),
+		ExpressionAttributeNames: map[string]string{"#source": source},
+	}
+	if externalID != "" {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":externalId": &types.AttributeValueMemberS{Value: externalID},
+		}
+	}
+	return input
+}
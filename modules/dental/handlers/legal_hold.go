@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/legalhold"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// checkLegalHold verifies that a record about to be deleted is not under legal
+// hold, itself or through its patient, writing the error response when it is
+func checkLegalHold(w http.ResponseWriter, r *http.Request, recordType, id, patientID string) bool {
+	err := legalhold.Check(r.Context(), recordType, id, patientID)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, legalhold.ErrHeld) {
+		http.Error(w, "Record is under legal hold and cannot be deleted", http.StatusConflict)
+		return false
+	}
+	http.Error(w, "Failed to check legal holds", http.StatusInternalServerError)
+	log.Printf("Error checking legal hold of %s %s: %v", recordType, id, err)
+	return false
+}
+
+// appointmentPatient returns the patient of an appointment, empty when the appointment does not exist
+func appointmentPatient(r *http.Request, id string) (string, error) {
+	appointments, err := batchGetItems[models.Appointment](r.Context(), "Appointments", []string{id})
+	if err != nil || len(appointments) == 0 {
+		return "", err
+	}
+	return appointments[0].PatientID, nil
+}
+
+// taskPatient returns the patient a task is linked to, empty when there is none
+func taskPatient(r *http.Request, id string) (string, error) {
+	tasks, err := batchGetItems[models.Task](r.Context(), "Tasks", []string{id})
+	if err != nil || len(tasks) == 0 {
+		return "", err
+	}
+	return tasks[0].PatientID, nil
+}
+
+// prescriptionPatient returns the patient of a prescription, empty when the prescription does not exist
+func prescriptionPatient(r *http.Request, id string) (string, error) {
+	prescriptions, err := batchGetItems[models.Prescription](r.Context(), "Prescriptions", []string{id})
+	if err != nil || len(prescriptions) == 0 {
+		return "", err
+	}
+	return prescriptions[0].PatientID, nil
+}
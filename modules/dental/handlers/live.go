@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	financialmodels "dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/live"
+	"dental-saas/shared/paging"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LiveMetrics reads the clinic's bookings of today from the sharded counters
+// and sums the payments it received today
+func LiveMetrics(ctx context.Context) (models.LiveMetrics, error) {
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	metrics := models.LiveMetrics{Date: today.Format("2006-01-02"), UpdatedAt: now}
+
+	var err error
+	metrics.Patients, err = counters.Get(ctx, counters.PatientsCounter(config.ClinicID(ctx)))
+	if err != nil {
+		return metrics, err
+	}
+	metrics.AppointmentsToday, err = counters.Get(ctx, counters.AppointmentsPerDayCounter(config.ClinicID(ctx), metrics.Date))
+	if err != nil {
+		return metrics, err
+	}
+
+	// Any payment made today also touched the revenue today
+	revenues, err := paging.ScanAll[financialmodels.Revenue](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("UpdatedAt >= :today"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":today": &types.AttributeValueMemberS{Value: metrics.Date},
+		},
+	})
+	if err != nil {
+		return metrics, err
+	}
+	for _, revenue := range revenues {
+		for _, payment := range revenue.Payments() {
+			if !payment.Date.Before(today) {
+				metrics.RevenueCollected += payment.Amount
+			}
+		}
+	}
+	metrics.RevenueCollected = math.Round(metrics.RevenueCollected*100) / 100
+	return metrics, nil
+}
+
+// StartLiveMetrics publishes the dashboard metrics of each clinic when they
+// change, checking every interval and right after bookings, patients or
+// payments are written. Only clinics with a display connected are read.
+func StartLiveMetrics(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	last := make(map[string]models.LiveMetrics)
+	refresh := func() {
+		for _, clinicID := range live.Metrics.Watched() {
+			metrics, err := LiveMetrics(config.WithClinic(ctx, clinicID))
+			if err != nil {
+				log.Printf("Error computing live metrics of clinic %s: %v", clinicID, err)
+				continue
+			}
+			previous := last[clinicID]
+			previous.UpdatedAt = metrics.UpdatedAt
+			if previous == metrics {
+				continue
+			}
+			if err := live.Metrics.Hub(clinicID).Publish(metrics); err != nil {
+				log.Printf("Error publishing live metrics of clinic %s: %v", clinicID, err)
+				continue
+			}
+			last[clinicID] = metrics
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			case <-live.Metrics.Changed():
+				refresh()
+			}
+		}
+	}()
+}
+
+// StreamLiveMetrics godoc
+// @Summary Stream live dashboard metrics
+// @Description Stream the clinic's bookings of today, registered patients and revenue collected today as server-sent "metrics" events, sent on connect and whenever they change, for wall-mounted clinic displays
+// @Tags reports
+// @Produce text/event-stream
+// @Param access_token query string false "Access token, for clients that cannot send the Authorization header"
+// @Success 200 {object} models.LiveMetrics "Event stream of metrics"
+// @Failure 500 {object} apierror.Response "Streaming is not supported"
+// @Router /api/v1/dental/stats/live [get]
+func StreamLiveMetrics(w http.ResponseWriter, r *http.Request) {
+	live.Metrics.ServeHTTP(w, r)
+}
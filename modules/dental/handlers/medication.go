@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/interactions"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var (
+	interactionChecker     interactions.Checker
+	interactionCheckerErr  error
+	interactionCheckerOnce sync.Once
+)
+
+func getInteractionChecker() (interactions.Checker, error) {
+	interactionCheckerOnce.Do(func() {
+		interactionChecker, interactionCheckerErr = interactions.NewCheckerFromEnv()
+	})
+	return interactionChecker, interactionCheckerErr
+}
+
+// CreateMedication godoc
+// @Summary Add a medication to the catalog
+// @Description Add a medication to the clinic's catalog, used in prescriptions. The active ingredient and class are what interactions are checked by.
+// @Tags medications
+// @Accept json
+// @Produce json
+// @Param medication body models.Medication true "Medication data"
+// @Success 201 {object} models.Medication
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 500 {object} apierror.Response "Failed to save medication"
+// @Router /api/v1/dental/medication [post]
+func CreateMedication(w http.ResponseWriter, r *http.Request) {
+	var medication models.Medication
+	if err := json.NewDecoder(r.Body).Decode(&medication); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := medication.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	medication.ID = uuid.NewString()
+	medication.ClinicID = ""
+	medication.CreatedAt = now
+	medication.UpdatedAt = now
+
+	if err := putMedication(r.Context(), medication, "attribute_not_exists(ID)"); err != nil {
+		http.Error(w, "Failed to save medication", http.StatusInternalServerError)
+		log.Printf("Error saving medication: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(medication)
+}
+
+// GetAllMedications godoc
+// @Summary Get the medication catalog
+// @Description Get the medications of the clinic's catalog by name, optionally only those whose name or active ingredient contains q
+// @Tags medications
+// @Produce json
+// @Param q query string false "Part of the name or active ingredient"
+// @Success 200 {array} models.Medication
+// @Failure 500 {object} apierror.Response "Failed to retrieve medications"
+// @Router /api/v1/dental/medication [get]
+func GetAllMedications(w http.ResponseWriter, r *http.Request) {
+	medications, err := paging.ScanAll[models.Medication](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Medications"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve medications", http.StatusInternalServerError)
+		log.Printf("Error scanning medications: %v", err)
+		return
+	}
+
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	result := []models.Medication{}
+	for _, medication := range medications {
+		if q == "" || strings.Contains(strings.ToLower(medication.Name), q) ||
+			strings.Contains(strings.ToLower(medication.ActiveIngredient), q) {
+			result = append(result, medication)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetMedicationByID godoc
+// @Summary Get a medication by ID
+// @Description Get a medication of the catalog by its ID
+// @Tags medications
+// @Produce json
+// @Param id path string true "Medication ID"
+// @Success 200 {object} models.Medication
+// @Failure 404 {object} apierror.Response "Medication not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve medication"
+// @Router /api/v1/dental/medication/{id} [get]
+func GetMedicationByID(w http.ResponseWriter, r *http.Request) {
+	medication, ok := loadMedication(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(medication)
+}
+
+// UpdateMedication godoc
+// @Summary Update a medication
+// @Description Replace the data of a medication of the catalog
+// @Tags medications
+// @Accept json
+// @Produce json
+// @Param id path string true "Medication ID"
+// @Param medication body models.Medication true "Medication data"
+// @Success 200 {object} models.Medication
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Medication not found"
+// @Failure 500 {object} apierror.Response "Failed to update medication"
+// @Router /api/v1/dental/medication/{id} [put]
+func UpdateMedication(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadMedication(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var medication models.Medication
+	if err := json.NewDecoder(r.Body).Decode(&medication); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := medication.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	medication.ID = current.ID
+	medication.ClinicID = current.ClinicID
+	medication.CreatedAt = current.CreatedAt
+	medication.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	err := putMedication(r.Context(), medication, "attribute_exists(ID)")
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Medication not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update medication", http.StatusInternalServerError)
+		log.Printf("Error updating medication %s: %v", medication.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(medication)
+}
+
+// DeleteMedication godoc
+// @Summary Delete a medication
+// @Description Remove a medication from the catalog; prescriptions already written keep it
+// @Tags medications
+// @Param id path string true "Medication ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Medication not found"
+// @Failure 500 {object} apierror.Response "Failed to delete medication"
+// @Router /api/v1/dental/medication/{id} [delete]
+func DeleteMedication(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Medications"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Medication not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete medication", http.StatusInternalServerError)
+		log.Printf("Error deleting medication %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CheckMedicationInteractions godoc
+// @Summary Check medication interactions for a patient
+// @Description Check the medications about to be prescribed against the medications the patient takes, as listed in the anamnesis (the patient's medications), with the provider set in INTERACTION_PROVIDER
+// @Tags medications
+// @Accept json
+// @Produce json
+// @Param check body models.InteractionCheckRequest true "Patient and medications to prescribe"
+// @Success 200 {object} models.InteractionCheck
+// @Failure 400 {object} apierror.Response "Invalid request body or missing fields"
+// @Failure 404 {object} apierror.Response "Patient or medication not found"
+// @Failure 500 {object} apierror.Response "Failed to check interactions"
+// @Failure 502 {object} apierror.Response "Interaction reference not reachable"
+// @Failure 503 {object} apierror.Response "Interaction provider not available"
+// @Router /api/v1/dental/medication/interactions [post]
+func CheckMedicationInteractions(w http.ResponseWriter, r *http.Request) {
+	var request models.InteractionCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	check, ok := medicationInteractions(w, r, request.PatientID, request.MedicationIDs)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(check)
+}
+
+// medicationInteractions checks the catalog medications with the given IDs
+// against the patient's medications, writing the error response when it
+// fails
+func medicationInteractions(w http.ResponseWriter, r *http.Request, patientID string, medicationIDs []string) (models.InteractionCheck, bool) {
+	patients, err := batchGetItems[models.Patient](r.Context(), "Patients", []string{patientID})
+	if err != nil {
+		http.Error(w, "Failed to check interactions", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s: %v", patientID, err)
+		return models.InteractionCheck{}, false
+	}
+	if len(patients) == 0 || patients[0].DeletedAt != "" {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return models.InteractionCheck{}, false
+	}
+	unique := make(map[string]bool, len(medicationIDs))
+	ids := make([]string, 0, len(medicationIDs))
+	for _, id := range medicationIDs {
+		if !unique[id] {
+			unique[id] = true
+			ids = append(ids, id)
+		}
+	}
+	medications, err := batchGetItems[models.Medication](r.Context(), "Medications", ids)
+	if err != nil {
+		http.Error(w, "Failed to check interactions", http.StatusInternalServerError)
+		log.Printf("Error fetching medications: %v", err)
+		return models.InteractionCheck{}, false
+	}
+	if len(medications) != len(ids) {
+		http.Error(w, "Medication not found", http.StatusNotFound)
+		return models.InteractionCheck{}, false
+	}
+
+	check, err := checkInteractions(r.Context(), patients[0], medications)
+	if errors.Is(err, errInteractionProvider) {
+		http.Error(w, "Interaction provider not available", http.StatusServiceUnavailable)
+		log.Printf("Error initializing interaction provider: %v", err)
+		return models.InteractionCheck{}, false
+	}
+	if err != nil {
+		http.Error(w, "Interaction reference not reachable", http.StatusBadGateway)
+		log.Printf("Error checking interactions for patient %s: %v", patientID, err)
+		return models.InteractionCheck{}, false
+	}
+	return check, true
+}
+
+// errInteractionProvider is returned when the interaction provider set in
+// the environment cannot be used
+var errInteractionProvider = errors.New("interaction provider not available")
+
+// checkInteractions checks medications against the ones the patient takes,
+// with the configured provider
+func checkInteractions(ctx context.Context, patient models.Patient, medications []models.Medication) (models.InteractionCheck, error) {
+	checker, err := getInteractionChecker()
+	if err != nil {
+		return models.InteractionCheck{}, fmt.Errorf("%w: %v", errInteractionProvider, err)
+	}
+	check := models.InteractionCheck{
+		PatientMedications: patient.Medications,
+		Interactions:       []models.MedicationInteraction{},
+		Provider:           checker.Name(),
+	}
+	if check.PatientMedications == nil {
+		check.PatientMedications = []string{}
+	}
+	if len(check.PatientMedications) == 0 || len(medications) == 0 {
+		return check, nil
+	}
+	found, err := checker.Check(ctx, medications, check.PatientMedications)
+	if err != nil {
+		return models.InteractionCheck{}, err
+	}
+	if found != nil {
+		check.Interactions = found
+	}
+	return check, nil
+}
+
+// loadMedication fetches a medication, writing the error response when it
+// fails
+func loadMedication(w http.ResponseWriter, r *http.Request, id string) (models.Medication, bool) {
+	medications, err := batchGetItems[models.Medication](r.Context(), "Medications", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to retrieve medication", http.StatusInternalServerError)
+		log.Printf("Error fetching medication %s: %v", id, err)
+		return models.Medication{}, false
+	}
+	if len(medications) == 0 {
+		http.Error(w, "Medication not found", http.StatusNotFound)
+		return models.Medication{}, false
+	}
+	return medications[0], true
+}
+
+func putMedication(ctx context.Context, medication models.Medication, condition string) error {
+	item, err := attributevalue.MarshalMap(medication)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Medications"),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+	})
+	return err
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetOdontogram godoc
+// @Summary Get a patient's dental chart
+// @Description Get the odontogram of a patient: the current conditions and treatments of each tooth charted, by FDI number. Teeth not charted yet are left out.
+// @Tags odontogram
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {object} models.Odontogram
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve odontogram"
+// @Router /api/v1/dental/patient/{id}/odontogram [get]
+func GetOdontogram(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+
+	exists, err := itemExists(r.Context(), "Patients", patientID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve odontogram", http.StatusInternalServerError)
+		log.Printf("Error checking patient %s: %v", patientID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+
+	chart, err := getOdontogram(r.Context(), patientID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve odontogram", http.StatusInternalServerError)
+		log.Printf("Error fetching odontogram of patient %s: %v", patientID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chart)
+}
+
+// UpdateTooth godoc
+// @Summary Chart a tooth
+// @Description Replace the conditions, treatments and notes of one tooth of the patient's odontogram, by FDI number (11-48 permanent, 51-85 primary). Each change raises the chart's version and keeps the resulting chart as a snapshot.
+// @Tags odontogram
+// @Accept json
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param number path int true "FDI tooth number"
+// @Param tooth body models.Tooth true "Conditions, treatments and notes of the tooth"
+// @Success 200 {object} models.Odontogram
+// @Failure 400 {object} apierror.Response "Invalid request body, tooth number or fields"
+// @Failure 404 {object} apierror.Response "Patient or procedure not found"
+// @Failure 409 {object} apierror.Response "The odontogram was changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to update odontogram"
+// @Router /api/v1/dental/patient/{id}/odontogram/teeth/{number} [put]
+func UpdateTooth(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	patientID := vars["id"]
+	number, err := strconv.Atoi(vars["number"])
+	if err != nil || !models.ValidToothNumber(number) {
+		http.Error(w, "tooth number must follow FDI numbering (11-48 or 51-85)", http.StatusBadRequest)
+		return
+	}
+
+	var tooth models.Tooth
+	if err := json.NewDecoder(r.Body).Decode(&tooth); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tooth.Number = number
+	if err := tooth.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	refs := map[string]string{patientID: "Patients"}
+	for _, treatment := range tooth.Treatments {
+		if treatment.ProcedureID != "" {
+			refs[treatment.ProcedureID] = "Procedures"
+		}
+	}
+	for id, table := range refs {
+		exists, err := itemExists(r.Context(), table, id)
+		if err != nil {
+			http.Error(w, "Failed to update odontogram", http.StatusInternalServerError)
+			log.Printf("Error checking %s item %s: %v", table, id, err)
+			return
+		}
+		if !exists {
+			http.Error(w, "Patient or procedure not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	chart, err := getOdontogram(r.Context(), patientID)
+	if err != nil {
+		http.Error(w, "Failed to update odontogram", http.StatusInternalServerError)
+		log.Printf("Error fetching odontogram of patient %s: %v", patientID, err)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	actor := config.ActorFrom(r.Context()).User
+	tooth.UpdatedAt = now
+	tooth.UpdatedBy = actor
+	chart.SetTooth(tooth)
+	previous := chart.Version
+	chart.Version++
+	chart.UpdatedAt = now
+
+	chartItem, err := attributevalue.MarshalMap(chart)
+	if err != nil {
+		http.Error(w, "Failed to update odontogram", http.StatusInternalServerError)
+		log.Printf("Error marshaling odontogram: %v", err)
+		return
+	}
+	snapshotItem, err := attributevalue.MarshalMap(models.OdontogramSnapshot{
+		PatientID: patientID,
+		Version:   chart.Version,
+		Tooth:     number,
+		TakenAt:   now,
+		TakenBy:   actor,
+		Teeth:     chart.Teeth,
+	})
+	if err != nil {
+		http.Error(w, "Failed to update odontogram", http.StatusInternalServerError)
+		log.Printf("Error marshaling odontogram snapshot: %v", err)
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err = config.DBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName:           aws.String("Odontograms"),
+				Item:                chartItem,
+				ConditionExpression: aws.String("attribute_not_exists(PatientID) OR Version = :version"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(previous, 10)},
+				},
+			}},
+			{Put: &types.Put{
+				TableName:           aws.String("OdontogramSnapshots"),
+				Item:                snapshotItem,
+				ConditionExpression: aws.String("attribute_not_exists(PatientID)"),
+			}},
+		},
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		http.Error(w, "The odontogram was changed concurrently; reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update odontogram", http.StatusInternalServerError)
+		log.Printf("Error saving odontogram of patient %s: %v", patientID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chart)
+}
+
+// GetOdontogramSnapshots godoc
+// @Summary List the versions of a patient's dental chart
+// @Description List the snapshots of the patient's odontogram, one per change, most recent first, with the tooth changed, when and by whom, without the teeth
+// @Tags odontogram
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {array} models.OdontogramSnapshot
+// @Failure 500 {object} apierror.Response "Failed to retrieve snapshots"
+// @Router /api/v1/dental/patient/{id}/odontogram/snapshots [get]
+func GetOdontogramSnapshots(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+
+	snapshots, err := queryItems[models.OdontogramSnapshot](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String("OdontogramSnapshots"),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve snapshots", http.StatusInternalServerError)
+		log.Printf("Error querying odontogram snapshots of patient %s: %v", patientID, err)
+		return
+	}
+	for i := range snapshots {
+		snapshots[i].Teeth = nil
+	}
+	if snapshots == nil {
+		snapshots = []models.OdontogramSnapshot{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// GetOdontogramSnapshot godoc
+// @Summary Get a version of a patient's dental chart
+// @Description Get the patient's odontogram as it was after the change that raised it to the version
+// @Tags odontogram
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param version path int true "Odontogram version"
+// @Success 200 {object} models.OdontogramSnapshot
+// @Failure 400 {object} apierror.Response "Invalid version"
+// @Failure 404 {object} apierror.Response "Snapshot not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve snapshot"
+// @Router /api/v1/dental/patient/{id}/odontogram/snapshots/{version} [get]
+func GetOdontogramSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	version, err := strconv.ParseInt(vars["version"], 10, 64)
+	if err != nil || version < 1 {
+		http.Error(w, "version must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("OdontogramSnapshots"),
+		Key: map[string]types.AttributeValue{
+			"PatientID": &types.AttributeValueMemberS{Value: vars["id"]},
+			"Version":   &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve snapshot", http.StatusInternalServerError)
+		log.Printf("Error fetching odontogram snapshot %d of patient %s: %v", version, vars["id"], err)
+		return
+	}
+	if result.Item == nil {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	var snapshot models.OdontogramSnapshot
+	if err := attributevalue.UnmarshalMap(result.Item, &snapshot); err != nil {
+		http.Error(w, "Failed to retrieve snapshot", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling odontogram snapshot: %v", err)
+		return
+	}
+	if snapshot.Teeth == nil {
+		snapshot.Teeth = map[string]models.Tooth{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// getOdontogram returns the patient's odontogram, empty when no tooth was
+// charted yet
+func getOdontogram(ctx context.Context, patientID string) (models.Odontogram, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	chart := models.Odontogram{PatientID: patientID, Teeth: map[string]models.Tooth{}}
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Odontograms"),
+		Key: map[string]types.AttributeValue{
+			"PatientID": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return chart, err
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &chart); err != nil {
+		return models.Odontogram{}, err
+	}
+	if chart.Teeth == nil {
+		chart.Teeth = map[string]models.Tooth{}
+	}
+	return chart, nil
+}
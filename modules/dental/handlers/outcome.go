@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetProcedureOutcome godoc
+// @Summary Get the outcome of a performed procedure
+// @Description Get the outcome recorded for the procedure of a completed appointment
+// @Tags appointments
+// @Produce json
+// @Param id path string true "Appointment ID"
+// @Success 200 {object} models.ProcedureOutcome
+// @Failure 404 {object} apierror.Response "Outcome not recorded"
+// @Failure 500 {object} apierror.Response "Failed to retrieve outcome"
+// @Router /api/v1/dental/appointment/{id}/outcome [get]
+func GetProcedureOutcome(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	outcome, err := getProcedureOutcome(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve outcome", http.StatusInternalServerError)
+		log.Printf("Error fetching outcome of appointment %s: %v", id, err)
+		return
+	}
+	if outcome == nil {
+		http.Error(w, "Outcome not recorded", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outcome)
+}
+
+// RecordProcedureOutcome godoc
+// @Summary Record the outcome of a performed procedure
+// @Description Record or replace whether the procedure of a completed appointment succeeded, the complications seen (postoperative_pain, swelling, bleeding, infection, dry_socket, nerve_injury, allergic_reaction, fracture, restoration_failure, implant_failure, other) and whether the patient needs a follow-up
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param id path string true "Appointment ID"
+// @Param outcome body models.ProcedureOutcome true "Outcome of the procedure"
+// @Success 200 {object} models.ProcedureOutcome
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Appointment not found"
+// @Failure 409 {object} apierror.Response "Appointment not completed"
+// @Failure 500 {object} apierror.Response "Failed to record outcome"
+// @Router /api/v1/dental/appointment/{id}/outcome [put]
+func RecordProcedureOutcome(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var outcome models.ProcedureOutcome
+	if err := json.NewDecoder(r.Body).Decode(&outcome); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := outcome.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	appointments, err := batchGetItems[models.Appointment](r.Context(), "Appointments", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to record outcome", http.StatusInternalServerError)
+		log.Printf("Error fetching appointment %s: %v", id, err)
+		return
+	}
+	if len(appointments) == 0 || appointments[0].DeletedAt != "" {
+		http.Error(w, "Appointment not found", http.StatusNotFound)
+		return
+	}
+	appointment := appointments[0]
+	if appointment.Status != models.AppointmentStatusCompleted {
+		http.Error(w, "Outcomes can only be recorded for completed appointments", http.StatusConflict)
+		return
+	}
+
+	// The appointment is copied so the report can be built from outcomes alone
+	outcome.AppointmentID = id
+	outcome.ClinicID = ""
+	outcome.PatientID = appointment.PatientID
+	outcome.DentistID = appointment.DentistID
+	outcome.ProcedureID = appointment.ProcedureID
+	outcome.PerformedAt = appointment.DateTime
+	outcome.RecordedAt = time.Now().UTC().Format(time.RFC3339)
+	outcome.RecordedBy = config.ActorFrom(r.Context()).User
+
+	item, err := attributevalue.MarshalMap(outcome)
+	if err != nil {
+		http.Error(w, "Failed to record outcome", http.StatusInternalServerError)
+		log.Printf("Error marshaling outcome: %v", err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("ProcedureOutcomes"),
+		Item:      item,
+	}); err != nil {
+		http.Error(w, "Failed to record outcome", http.StatusInternalServerError)
+		log.Printf("Error saving outcome of appointment %s: %v", id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outcome)
+}
+
+// GetQualityReport godoc
+// @Summary Get clinical quality report
+// @Description Get the success and complication rates of the procedures performed in a date range, with the outcome recorded, for the clinic, per procedure (overall and per dentist) and per dentist, with the occurrences of each complication
+// @Tags reports
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Param dentistId query string false "Only procedures performed by this dentist"
+// @Param procedureId query string false "Only this procedure"
+// @Success 200 {object} models.QualityReport
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 500 {object} apierror.Response "Failed to build quality report"
+// @Router /api/v1/dental/reports/quality [get]
+func GetQualityReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseReportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dentistFilter, procedureFilter := query.Get("dentistId"), query.Get("procedureId")
+
+	outcomes, err := paging.ScanAll[models.ProcedureOutcome](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("ProcedureOutcomes"),
+		FilterExpression: aws.String("PerformedAt >= :from AND PerformedAt < :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: from.Format("2006-01-02")},
+			":to":   &types.AttributeValueMemberS{Value: to.AddDate(0, 0, 1).Format("2006-01-02")},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to build quality report", http.StatusInternalServerError)
+		log.Printf("Error scanning procedure outcomes for quality report: %v", err)
+		return
+	}
+
+	report := models.QualityReport{
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		Clinic:     models.QualityStats{Complications: map[string]int{}},
+		Procedures: []models.ProcedureQuality{},
+		Dentists:   []models.DentistQuality{},
+	}
+	procedures := make(map[string]*models.ProcedureQuality)
+	procedureDentists := make(map[string]map[string]*models.DentistQuality)
+	dentists := make(map[string]*models.DentistQuality)
+	for _, outcome := range outcomes {
+		if (dentistFilter != "" && outcome.DentistID != dentistFilter) ||
+			(procedureFilter != "" && outcome.ProcedureID != procedureFilter) {
+			continue
+		}
+		report.Clinic.Add(outcome)
+
+		if procedures[outcome.ProcedureID] == nil {
+			procedures[outcome.ProcedureID] = &models.ProcedureQuality{ProcedureID: outcome.ProcedureID}
+			procedureDentists[outcome.ProcedureID] = make(map[string]*models.DentistQuality)
+		}
+		procedures[outcome.ProcedureID].Add(outcome)
+		byDentist := procedureDentists[outcome.ProcedureID]
+		if byDentist[outcome.DentistID] == nil {
+			byDentist[outcome.DentistID] = &models.DentistQuality{DentistID: outcome.DentistID}
+		}
+		byDentist[outcome.DentistID].Add(outcome)
+
+		if dentists[outcome.DentistID] == nil {
+			dentists[outcome.DentistID] = &models.DentistQuality{DentistID: outcome.DentistID}
+		}
+		dentists[outcome.DentistID].Add(outcome)
+	}
+
+	dentistNames, procedureNames, err := qualityReportNames(r.Context(), dentists, procedures)
+	if err != nil {
+		http.Error(w, "Failed to build quality report", http.StatusInternalServerError)
+		log.Printf("Error fetching names for quality report: %v", err)
+		return
+	}
+	for id, procedure := range procedures {
+		procedure.ProcedureName = procedureNames[id]
+		procedure.Dentists = []models.DentistQuality{}
+		for dentistID, dentist := range procedureDentists[id] {
+			dentist.DentistName = dentistNames[dentistID]
+			procedure.Dentists = append(procedure.Dentists, *dentist)
+		}
+		sortDentistQuality(procedure.Dentists)
+		report.Procedures = append(report.Procedures, *procedure)
+	}
+	sort.Slice(report.Procedures, func(i, j int) bool {
+		return report.Procedures[i].ProcedureName < report.Procedures[j].ProcedureName
+	})
+	for id, dentist := range dentists {
+		dentist.DentistName = dentistNames[id]
+		report.Dentists = append(report.Dentists, *dentist)
+	}
+	sortDentistQuality(report.Dentists)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// qualityReportNames returns the names of the dentists and procedures of the
+// quality report, by ID
+func qualityReportNames(ctx context.Context, dentists map[string]*models.DentistQuality, procedures map[string]*models.ProcedureQuality) (map[string]string, map[string]string, error) {
+	dentistNames := make(map[string]string)
+	procedureNames := make(map[string]string)
+	ids := make([]string, 0, len(dentists))
+	for id := range dentists {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		found, err := batchGetItems[models.Dentist](ctx, "Dentists", ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, dentist := range found {
+			dentistNames[dentist.ID] = dentist.Name
+		}
+	}
+	ids = ids[:0]
+	for id := range procedures {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		found, err := batchGetItems[models.Procedure](ctx, "Procedures", ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, procedure := range found {
+			procedureNames[procedure.ID] = procedure.Name
+		}
+	}
+	return dentistNames, procedureNames, nil
+}
+
+func sortDentistQuality(dentists []models.DentistQuality) {
+	sort.Slice(dentists, func(i, j int) bool {
+		return dentists[i].DentistName < dentists[j].DentistName
+	})
+}
+
+func getProcedureOutcome(ctx context.Context, appointmentID string) (*models.ProcedureOutcome, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("ProcedureOutcomes"),
+		Key: map[string]types.AttributeValue{
+			"AppointmentID": &types.AttributeValueMemberS{Value: appointmentID},
+		},
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var outcome models.ProcedureOutcome
+	if err := attributevalue.UnmarshalMap(result.Item, &outcome); err != nil {
+		return nil, err
+	}
+	return &outcome, nil
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/auth"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// DentistOwner lets a request on the dentist of the {id} path variable
+// through only for admins and for that dentist, recognized by the email of
+// their account, so dentists keep their own prices, schedule and calendar
+// sync while other dentists and the front desk cannot change them
+func DentistOwner(handler http.HandlerFunc) http.Handler {
+	return auth.RequireFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := auth.FromContext(r.Context())
+		if claims.Role != auth.RoleAdmin {
+			dentist, err := Dentists.Get(r.Context(), mux.Vars(r)["id"])
+			if err != nil {
+				writeServiceError(w, err, "Dentist", "Failed to retrieve dentist")
+				return
+			}
+			if !strings.EqualFold(dentist.Email, claims.Email) {
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeInsufficientRole, "Only admins and the dentist themselves can change the dentist's settings", nil)
+				return
+			}
+		}
+		handler(w, r)
+	}, auth.RoleDentist)
+}
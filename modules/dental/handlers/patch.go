@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"dental-saas/shared/mergepatch"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// maxPatchSize bounds the body of PATCH requests
+const maxPatchSize = 1 << 20
+
+// readMergePatch reads the JSON Merge Patch in the body of a PATCH request,
+// writing the error response when the body is not one
+func readMergePatch(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if !mergepatch.Accepts(r) {
+		http.Error(w, "Content-Type must be "+mergepatch.ContentType, http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil || !json.Valid(patch) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return patch, true
+}
@@ -1,20 +1,19 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
-	"errors"
 	"dental-saas/modules/dental/models"
 	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -26,9 +25,9 @@ import (
 // @Produce json
 // @Param patient body models.Patient true "Patient data"
 // @Success 201 {object} models.Patient
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Patient with this ID already exists"
-// @Failure 500 {string} string "Failed to save patient"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Patient with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save patient"
 // @Router /api/v1/dental/patient [post]
 func CreatePatient(w http.ResponseWriter, r *http.Request) {
 	var patient models.Patient
@@ -37,48 +36,15 @@ func CreatePatient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if patient.ID == "" {
-		patient.ID = uuid.NewString()
-	}
-
-	if err := patient.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	if patient.CreatedAt == "" {
-		patient.CreatedAt = time.Now().UTC().Format(time.RFC3339)
-	}
-	if patient.UpdatedAt == "" {
-		patient.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
-	}
-
-	_, err := config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName: aws.String("Patients"),
-		Item: map[string]types.AttributeValue{
-			"ID":           &types.AttributeValueMemberS{Value: patient.ID},
-			"Name":         &types.AttributeValueMemberS{Value: patient.Name},
-			"Email":        &types.AttributeValueMemberS{Value: patient.Email},
-			"Phone":        &types.AttributeValueMemberS{Value: patient.Phone},
-			"DateOfBirth":  &types.AttributeValueMemberS{Value: patient.DateOfBirth},
-			"MedicalNotes": &types.AttributeValueMemberS{Value: patient.MedicalNotes},
-			"CreatedAt":    &types.AttributeValueMemberS{Value: patient.CreatedAt},
-			"UpdatedAt":    &types.AttributeValueMemberS{Value: patient.UpdatedAt},
-		},
-		ConditionExpression: aws.String("attribute_not_exists(ID)"),
-	})
-
+	patient, err := Patients.Create(r.Context(), patient)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Patient with this ID already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to save patient", http.StatusInternalServerError)
-		log.Printf("Error saving patient: %v", err)
+		writeServiceError(w, err, "Patient", "Failed to save patient")
 		return
 	}
 
+	counters.IncrementAsync(r.Context(), counters.PatientsCounter(config.ClinicID(r.Context())), 1)
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "patient", ID: patient.ID}, inbox.User(r), "", patient.MedicalNotes)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(patient)
 }
@@ -88,31 +54,32 @@ func CreatePatient(w http.ResponseWriter, r *http.Request) {
 // @Description Get a list of all patients
 // @Tags patients
 // @Produce json
+// @Param stream query bool false "Stream the list as newline-delimited JSON"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
 // @Success 200 {array} models.Patient
-// @Failure 500 {string} string "Failed to retrieve patients"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patients"
 // @Router /api/v1/dental/patient [get]
 func GetAllPatients(w http.ResponseWriter, r *http.Request) {
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String("Patients"),
-	})
+	if wantsStream(r) {
+		streamList(w, r, "patients", Patients.List, nil)
+		return
+	}
+
+	page := paging.Request(r)
+	patients, next, err := Patients.List(r.Context(), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to retrieve patients", http.StatusInternalServerError)
 		log.Printf("Error scanning patients: %v", err)
 		return
 	}
 
-	var patients []models.Patient
-	for _, item := range result.Items {
-		var patient models.Patient
-		if err := attributevalue.UnmarshalMap(item, &patient); err != nil {
-			log.Printf("Error unmarshaling patient: %v", err)
-			continue
-		}
-		patients = append(patients, patient)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(patients)
+	paging.Write(w, page, patients, next)
 }
 
 // GetPatientByID godoc
@@ -122,33 +89,13 @@ func GetAllPatients(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "Patient ID"
 // @Success 200 {object} models.Patient
-// @Failure 404 {string} string "Patient not found"
-// @Failure 500 {string} string "Failed to retrieve patient"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patient"
 // @Router /api/v1/dental/patient/{id} [get]
 func GetPatientByID(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Patients"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
+	patient, err := Patients.Get(r.Context(), mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Failed to retrieve patient", http.StatusInternalServerError)
-		log.Printf("Error fetching patient with ID %s: %v", id, err)
-		return
-	}
-	if result.Item == nil {
-		http.Error(w, "Patient not found", http.StatusNotFound)
-		return
-	}
-
-	var patient models.Patient
-	if err = attributevalue.UnmarshalMap(result.Item, &patient); err != nil {
-		http.Error(w, "Failed to unmarshal patient data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling patient data: %v", err)
+		writeServiceError(w, err, "Patient", "Failed to retrieve patient")
 		return
 	}
 
@@ -163,79 +110,40 @@ func GetPatientByID(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param name path string true "Patient Name"
 // @Success 200 {array} models.Patient
-// @Failure 500 {string} string "Failed to retrieve patients"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patients"
 // @Router /api/v1/dental/patient/name/{name} [get]
 func GetPatientByName(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:        aws.String("Patients"),
-		FilterExpression: aws.String("contains(#name, :name)"),
-		ExpressionAttributeNames: map[string]string{
-			"#name": "Name",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":name": &types.AttributeValueMemberS{Value: name},
-		},
-	})
+	patients, err := Patients.FindByName(r.Context(), mux.Vars(r)["name"])
 	if err != nil {
 		http.Error(w, "Failed to retrieve patients", http.StatusInternalServerError)
 		log.Printf("Error scanning patients by name: %v", err)
 		return
 	}
 
-	var patients []models.Patient
-	for _, item := range result.Items {
-		var patient models.Patient
-		if err := attributevalue.UnmarshalMap(item, &patient); err != nil {
-			log.Printf("Error unmarshaling patient: %v", err)
-			continue
-		}
-		patients = append(patients, patient)
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(patients)
 }
 
 // UpdatePatient godoc
-// @Summary Update an existing patient
-// @Description Update fields of an existing patient by providing their ID
+// @Summary Replace an existing patient
+// @Description Replace an existing patient with the patient sent: fields left out are cleared. The ID, clinic, timestamps and booking campaign are kept. Use PATCH to change only some fields.
 // @Tags patients
 // @Accept json
 // @Produce json
 // @Param id path string true "Patient ID"
+// @Param If-Match header string false "Version of the patient being replaced; required unless the body has it"
 // @Param patient body models.Patient true "Patient data (ID will be ignored)"
 // @Success 200 {object} models.Patient
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Patient not found"
-// @Failure 500 {string} string "Failed to update patient"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 409 {object} apierror.Response "Patient was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the patient is required"
+// @Failure 500 {object} apierror.Response "Failed to update patient"
 // @Router /api/v1/dental/patient/{id} [put]
 func UpdatePatient(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Patients"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
-	if err != nil {
-		http.Error(w, "Failed to retrieve patient", http.StatusInternalServerError)
-		log.Printf("Error fetching patient with ID %s: %v", id, err)
-		return
-	}
-	if result.Item == nil {
-		http.Error(w, "Patient not found", http.StatusNotFound)
-		return
-	}
-
-	var currentPatient models.Patient
-	if err = attributevalue.UnmarshalMap(result.Item, &currentPatient); err != nil {
-		http.Error(w, "Failed to unmarshal patient data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling patient data: %v", err)
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Patients", id)
+	if !ok {
 		return
 	}
 
@@ -245,88 +153,116 @@ func UpdatePatient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if updatedData.Name != "" {
-		currentPatient.Name = updatedData.Name
-	}
-	if updatedData.Email != "" {
-		currentPatient.Email = updatedData.Email
-	}
-	if updatedData.Phone != "" {
-		currentPatient.Phone = updatedData.Phone
-	}
-	if updatedData.DateOfBirth != "" {
-		currentPatient.DateOfBirth = updatedData.DateOfBirth
-	}
-	if updatedData.MedicalNotes != "" {
-		currentPatient.MedicalNotes = updatedData.MedicalNotes
+	patient, previous, err := Patients.Update(r.Context(), id, updatedData)
+	if err != nil {
+		if !versioning.Conflict(w, r, err) {
+			writeServiceError(w, err, "Patient", "Failed to update patient")
+		}
+		return
 	}
+	patient.Version = version + 1
+	invalidateAgendas(r.Context())
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "patient", ID: patient.ID}, inbox.User(r), previous.MedicalNotes, patient.MedicalNotes)
+	webhooks.Publish(r.Context(), webhooks.EventPatientUpdated, patient)
 
-	if err := currentPatient.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(patient)
+}
+
+// PatchPatient godoc
+// @Summary Update fields of a patient
+// @Description Change some fields of an existing patient with a JSON Merge Patch (RFC 7386): only the fields sent change, and null clears an optional field such as medical_notes
+// @Tags patients
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param If-Match header string false "Version of the patient being changed; required unless the patch has it"
+// @Param patch body object true "Fields to change, null to clear"
+// @Success 200 {object} models.Patient
+// @Failure 400 {object} apierror.Response "Invalid patch or missing required fields"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 409 {object} apierror.Response "Patient was changed since the version sent"
+// @Failure 415 {object} apierror.Response "Content-Type must be application/merge-patch+json"
+// @Failure 428 {object} apierror.Response "Version of the patient is required"
+// @Failure 500 {object} apierror.Response "Failed to update patient"
+// @Router /api/v1/dental/patient/{id} [patch]
+func PatchPatient(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Patients", id)
+	if !ok {
 		return
 	}
 
-	currentPatient.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
 
-	_, err = config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName: aws.String("Patients"),
-		Item: map[string]types.AttributeValue{
-			"ID":           &types.AttributeValueMemberS{Value: currentPatient.ID},
-			"Name":         &types.AttributeValueMemberS{Value: currentPatient.Name},
-			"Email":        &types.AttributeValueMemberS{Value: currentPatient.Email},
-			"Phone":        &types.AttributeValueMemberS{Value: currentPatient.Phone},
-			"DateOfBirth":  &types.AttributeValueMemberS{Value: currentPatient.DateOfBirth},
-			"MedicalNotes": &types.AttributeValueMemberS{Value: currentPatient.MedicalNotes},
-			"CreatedAt":    &types.AttributeValueMemberS{Value: currentPatient.CreatedAt},
-			"UpdatedAt":    &types.AttributeValueMemberS{Value: currentPatient.UpdatedAt},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
+	patient, previous, err := Patients.Patch(r.Context(), id, patch)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Patient not found", http.StatusNotFound)
-			return
+		if !versioning.Conflict(w, r, err) {
+			writeServiceError(w, err, "Patient", "Failed to update patient")
 		}
-		http.Error(w, "Failed to update patient", http.StatusInternalServerError)
-		log.Printf("Error updating patient: %v", err)
 		return
 	}
+	patient.Version = version + 1
+	invalidateAgendas(r.Context())
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "patient", ID: patient.ID}, inbox.User(r), previous.MedicalNotes, patient.MedicalNotes)
+	webhooks.Publish(r.Context(), webhooks.EventPatientUpdated, patient)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(currentPatient)
+	json.NewEncoder(w).Encode(patient)
 }
 
 // DeletePatient godoc
 // @Summary Delete a patient
-// @Description Delete a patient by their ID
+// @Description Soft delete a patient by their ID: the patient is hidden from lists and lookups, unless ?include_deleted=true, until restored. Patients under legal hold cannot be deleted.
 // @Tags patients
 // @Param id path string true "Patient ID"
 // @Success 204 "Patient deleted successfully"
-// @Failure 404 {string} string "Patient not found"
-// @Failure 500 {string} string "Failed to delete patient"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 409 {object} apierror.Response "Record is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete patient"
 // @Router /api/v1/dental/patient/{id} [delete]
 func DeletePatient(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := mux.Vars(r)["id"]
 
-	_, err := config.DBClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-		TableName: aws.String("Patients"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
-	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Patient not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Failed to delete patient", http.StatusInternalServerError)
-		log.Printf("Error deleting patient: %v", err)
+	if !checkLegalHold(w, r, legalhold.RecordPatient, id, "") {
+		return
+	}
+
+	if err := Patients.Delete(r.Context(), id); err != nil {
+		writeServiceError(w, err, "Patient", "Failed to delete patient")
 		return
 	}
+	invalidateAgendas(r.Context())
+
+	counters.IncrementAsync(r.Context(), counters.PatientsCounter(config.ClinicID(r.Context())), -1)
 
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// RestorePatient godoc
+// @Summary Restore a deleted patient
+// @Description Bring back a soft-deleted patient
+// @Tags patients
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {object} models.Patient
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to restore patient"
+// @Router /api/v1/dental/patient/{id}/restore [post]
+func RestorePatient(w http.ResponseWriter, r *http.Request) {
+	patient, err := Patients.Restore(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, err, "Patient", "Failed to restore patient")
+		return
+	}
+	invalidateAgendas(r.Context())
+
+	counters.IncrementAsync(r.Context(), counters.PatientsCounter(config.ClinicID(r.Context())), 1)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(patient)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	financialmodels "dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetPatientHistory godoc
+// @Summary Get patient treatment history
+// @Description Get the patient's timeline for the clinical record: appointments, procedures performed in completed appointments, charges, payments and invoices merged in chronological order, oldest first unless order is desc
+// @Tags patients
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param order query string false "asc (default) or desc"
+// @Success 200 {object} models.PatientHistory
+// @Failure 400 {object} apierror.Response "Invalid order"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patient history"
+// @Router /api/v1/dental/patient/{id}/history [get]
+func GetPatientHistory(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	order := r.URL.Query().Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	history, err := patientHistory(r.Context(), id, order)
+	if err != nil {
+		http.Error(w, "Failed to retrieve patient history", http.StatusInternalServerError)
+		log.Printf("Error building history of patient %s: %v", id, err)
+		return
+	}
+	if history == nil {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// patientHistory builds the timeline of a patient of the clinic of ctx, nil
+// when there is no such patient
+func patientHistory(ctx context.Context, id, order string) (*models.PatientHistory, error) {
+	getCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(getCtx),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	history := models.PatientHistory{Events: []models.HistoryEvent{}}
+	if err = attributevalue.UnmarshalMap(result.Item, &history.Patient); err != nil {
+		return nil, err
+	}
+
+	appointments, err := queryItems[models.Appointment](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("Appointments"),
+		IndexName:              aws.String(config.AppointmentsByPatientIndex),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("querying appointments for patient history: %w", err)
+	}
+	if err := expandAppointments(ctx, appointments, map[string]bool{"dentist": true, "procedure": true}); err != nil {
+		return nil, fmt.Errorf("expanding appointments for patient history: %w", err)
+	}
+
+	byPatient := &dynamodb.ScanInput{
+		FilterExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: id},
+		},
+	}
+	revenuesInput, invoicesInput := *byPatient, *byPatient
+	revenuesInput.TableName, invoicesInput.TableName = aws.String("Revenues"), aws.String("Invoices")
+
+	revenues, err := paging.ScanAll[financialmodels.Revenue](ctx, &revenuesInput)
+	if err != nil {
+		return nil, fmt.Errorf("scanning revenues for patient history: %w", err)
+	}
+	invoices, err := paging.ScanAll[financialmodels.Invoice](ctx, &invoicesInput)
+	if err != nil {
+		return nil, fmt.Errorf("scanning invoices for patient history: %w", err)
+	}
+
+	for _, appointment := range appointments {
+		history.Events = append(history.Events, appointmentEvents(appointment)...)
+	}
+	for _, revenue := range revenues {
+		history.Events = append(history.Events, revenueEvents(revenue)...)
+	}
+	for _, invoice := range invoices {
+		history.Events = append(history.Events, models.HistoryEvent{
+			Date:        invoice.IssueDate,
+			Type:        models.HistoryInvoice,
+			ID:          invoice.ID,
+			Description: "Invoice " + invoice.Number,
+			Status:      string(invoice.Status),
+			Amount:      invoice.TotalAmount,
+		})
+	}
+
+	sort.SliceStable(history.Events, func(i, j int) bool {
+		if order == "desc" {
+			return history.Events[i].Date.After(history.Events[j].Date)
+		}
+		return history.Events[i].Date.Before(history.Events[j].Date)
+	})
+
+	return &history, nil
+}
+
+// appointmentEvents turns an appointment into its history event: the
+// procedure performed when it was completed, the appointment otherwise.
+// Appointments whose time cannot be read are left out.
+func appointmentEvents(appointment models.Appointment) []models.HistoryEvent {
+	start, err := appointment.StartTime()
+	if err != nil {
+		return nil
+	}
+	event := models.HistoryEvent{
+		Date:          start,
+		Type:          models.HistoryAppointment,
+		ID:            appointment.ID,
+		Description:   "Appointment",
+		Status:        appointment.Status,
+		DentistID:     appointment.DentistID,
+		ProcedureID:   appointment.ProcedureID,
+		AppointmentID: appointment.ID,
+	}
+	if appointment.Dentist != nil {
+		event.DentistName = appointment.Dentist.Name
+	}
+	if appointment.Procedure != nil {
+		event.Description = appointment.Procedure.Name
+	}
+	if appointment.Status == models.AppointmentStatusCompleted {
+		event.Type = models.HistoryProcedure
+		if appointment.Procedure == nil {
+			event.Description = "Completed appointment"
+		}
+	}
+	return []models.HistoryEvent{event}
+}
+
+// revenueEvents turns a revenue into the charge, on its due date, and the
+// payment, when it was paid
+func revenueEvents(revenue financialmodels.Revenue) []models.HistoryEvent {
+	events := []models.HistoryEvent{{
+		Date:          revenue.DueDate,
+		Type:          models.HistoryRevenue,
+		ID:            revenue.ID,
+		Description:   revenue.Description,
+		Status:        string(revenue.PaymentStatus),
+		Amount:        revenue.Amount,
+		ProcedureID:   revenue.ProcedureID,
+		AppointmentID: revenue.AppointmentID,
+	}}
+	if revenue.PaidDate != nil {
+		events = append(events, models.HistoryEvent{
+			Date:          *revenue.PaidDate,
+			Type:          models.HistoryPayment,
+			ID:            revenue.ID,
+			Description:   revenue.Description,
+			Status:        string(revenue.PaymentMethod),
+			Amount:        revenue.Amount,
+			ProcedureID:   revenue.ProcedureID,
+			AppointmentID: revenue.AppointmentID,
+		})
+	}
+	return events
+}
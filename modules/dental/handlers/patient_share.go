@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// patientSharesTable holds the access clinics grant each other to the records
+// of their patients, keyed by PatientID and TargetClinicID
+const patientSharesTable = "PatientShares"
+
+// SharePatient godoc
+// @Summary Share a patient record with another clinic of the organization
+// @Description Give another clinic of the organization access to the patient's record (profile, appointments, procedures and financial history) for some days, up to the organization's limit, so the patient can be attended there. Sharing again renews the access. Requires the organization's grant policy; the grant is recorded in the audit log.
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Param share body models.PatientShareRequest true "Clinic, reason and days of access"
+// @Success 201 {object} models.PatientShare
+// @Failure 400 {object} apierror.Response "Invalid request body, clinic or days"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 409 {object} apierror.Response "The organization's policy does not grant access to patient records"
+// @Failure 500 {object} apierror.Response "Failed to share patient record"
+// @Router /api/v1/dental/patient/{id}/shares [post]
+func SharePatient(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req models.PatientShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	owner := config.ClinicID(r.Context())
+	org, err := clinics.SharedOrganization(r.Context(), owner, req.ClinicID)
+	if err != nil {
+		http.Error(w, "Failed to share patient record", http.StatusInternalServerError)
+		log.Printf("Error loading organization of clinics %s and %s: %v", owner, req.ClinicID, err)
+		return
+	}
+	if org == nil || req.ClinicID == owner {
+		http.Error(w, "clinic_id must be another clinic of the organization", http.StatusBadRequest)
+		return
+	}
+	switch org.Sharing() {
+	case clinics.SharingOff:
+		http.Error(w, "The organization does not share patient records", http.StatusConflict)
+		return
+	case clinics.SharingOpen:
+		http.Error(w, "The clinics of the organization already see each other's patients", http.StatusConflict)
+		return
+	}
+	if err := req.IsValid(org.MaxShareDays()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patient, err := getPatient(r, id)
+	if err != nil {
+		http.Error(w, "Failed to share patient record", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s: %v", id, err)
+		return
+	}
+	if patient == nil {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	share := models.PatientShare{
+		PatientID:      id,
+		PatientName:    patient.Name,
+		OwnerClinicID:  owner,
+		TargetClinicID: req.ClinicID,
+		Reason:         req.Reason,
+		GrantedBy:      config.ActorFrom(r.Context()).User,
+		CreatedAt:      now.Format(time.RFC3339),
+		ExpiresAt:      now.AddDate(0, 0, req.Days).Format(time.RFC3339),
+	}
+	item, err := attributevalue.MarshalMap(share)
+	if err != nil {
+		http.Error(w, "Failed to share patient record", http.StatusInternalServerError)
+		log.Printf("Error marshaling share of patient %s: %v", id, err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(patientSharesTable),
+		Item:      item,
+	}); err != nil {
+		http.Error(w, "Failed to share patient record", http.StatusInternalServerError)
+		log.Printf("Error saving share of patient %s: %v", id, err)
+		return
+	}
+
+	if err := config.RecordAuditEvent(r.Context(), owner, "patients", id, config.AuditShared, map[string]interface{}{
+		"clinic_id":  share.TargetClinicID,
+		"reason":     share.Reason,
+		"expires_at": share.ExpiresAt,
+	}); err != nil {
+		log.Printf("Error recording share of patient %s in the audit log: %v", id, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(share)
+}
+
+// GetPatientShares godoc
+// @Summary List the clinics a patient record is shared with
+// @Description List the clinics of the organization with current access to the patient's record
+// @Tags patients
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {array} models.PatientShare
+// @Failure 500 {object} apierror.Response "Failed to retrieve shares"
+// @Router /api/v1/dental/patient/{id}/shares [get]
+func GetPatientShares(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	shares, err := queryItems[models.PatientShare](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String(patientSharesTable),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		FilterExpression:       aws.String("OwnerClinicID = :owner AND ExpiresAt > :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: id},
+			":owner":     &types.AttributeValueMemberS{Value: config.ClinicID(r.Context())},
+			":now":       &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve shares", http.StatusInternalServerError)
+		log.Printf("Error querying shares of patient %s: %v", id, err)
+		return
+	}
+	if shares == nil {
+		shares = []models.PatientShare{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// RevokePatientShare godoc
+// @Summary Stop sharing a patient record with a clinic
+// @Description Remove the access of another clinic to the patient's record before it expires; the revocation is recorded in the audit log
+// @Tags patients
+// @Param id path string true "Patient ID"
+// @Param clinicId path string true "Clinic the record is shared with"
+// @Success 204 "Access revoked"
+// @Failure 404 {object} apierror.Response "The record is not shared with the clinic"
+// @Failure 500 {object} apierror.Response "Failed to revoke share"
+// @Router /api/v1/dental/patient/{id}/shares/{clinicId} [delete]
+func RevokePatientShare(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	owner := config.ClinicID(r.Context())
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(patientSharesTable),
+		Key:                 shareKey(vars["id"], vars["clinicId"]),
+		ConditionExpression: aws.String("OwnerClinicID = :owner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "The record is not shared with the clinic", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke share", http.StatusInternalServerError)
+		log.Printf("Error deleting share of patient %s with clinic %s: %v", vars["id"], vars["clinicId"], err)
+		return
+	}
+
+	if err := config.RecordAuditEvent(r.Context(), owner, "patients", vars["id"], config.AuditUnshared, map[string]interface{}{
+		"clinic_id": vars["clinicId"],
+	}); err != nil {
+		log.Printf("Error recording revoked share of patient %s in the audit log: %v", vars["id"], err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedPatients godoc
+// @Summary List the patient records shared with the clinic
+// @Description List the patients of other clinics of the organization whose records were shared with the requesting clinic and are still accessible. Under the organization's open policy every patient of its clinics is accessible without being listed here.
+// @Tags patients
+// @Produce json
+// @Success 200 {array} models.PatientShare
+// @Failure 500 {object} apierror.Response "Failed to retrieve shared patients"
+// @Router /api/v1/dental/shared-patient [get]
+func GetSharedPatients(w http.ResponseWriter, r *http.Request) {
+	shares, err := paging.ScanAll[models.PatientShare](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String(patientSharesTable),
+		FilterExpression: aws.String("TargetClinicID = :clinic AND ExpiresAt > :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: config.ClinicID(r.Context())},
+			":now":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve shared patients", http.StatusInternalServerError)
+		log.Printf("Error scanning patient shares: %v", err)
+		return
+	}
+	if shares == nil {
+		shares = []models.PatientShare{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// GetSharedPatient godoc
+// @Summary Get the record of a patient of another clinic
+// @Description Get the profile and timeline of a patient of another clinic of the organization, as in the patient history, when the organization's policy is open or the patient's clinic shared the record with the requesting one. Each view is recorded in the audit log of the patient's clinic.
+// @Tags patients
+// @Produce json
+// @Param clinicId path string true "Clinic of the patient"
+// @Param id path string true "Patient ID"
+// @Param order query string false "asc (default) or desc"
+// @Success 200 {object} models.SharedPatientRecord
+// @Failure 400 {object} apierror.Response "Invalid order"
+// @Failure 404 {object} apierror.Response "Shared patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve shared patient"
+// @Router /api/v1/dental/shared-patient/{clinicId}/{id} [get]
+func GetSharedPatient(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	owner, id := vars["clinicId"], vars["id"]
+	order := r.URL.Query().Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	// Patients the clinic has no access to are reported as not found, so
+	// other clinics cannot learn which exist
+	clinicID := config.ClinicID(r.Context())
+	record, err := sharedRecord(r, owner, clinicID, id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve shared patient", http.StatusInternalServerError)
+		log.Printf("Error checking access of clinic %s to patient %s: %v", clinicID, id, err)
+		return
+	}
+	if record == nil {
+		http.Error(w, "Shared patient not found", http.StatusNotFound)
+		return
+	}
+
+	ownerCtx := config.WithClinic(r.Context(), owner)
+	history, err := patientHistory(ownerCtx, id, order)
+	if err != nil {
+		http.Error(w, "Failed to retrieve shared patient", http.StatusInternalServerError)
+		log.Printf("Error building history of shared patient %s: %v", id, err)
+		return
+	}
+	if history == nil {
+		http.Error(w, "Shared patient not found", http.StatusNotFound)
+		return
+	}
+	record.PatientHistory = *history
+
+	if err := config.RecordAuditEvent(ownerCtx, owner, "patients", id, config.AuditViewed, map[string]interface{}{
+		"clinic_id": clinicID,
+		"policy":    record.Policy,
+	}); err != nil {
+		log.Printf("Error recording view of shared patient %s in the audit log: %v", id, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(record)
+}
+
+// sharedRecord checks the clinic may see the patient of the owner clinic,
+// returning the record to fill with the patient's history, or nil when it
+// may not
+func sharedRecord(r *http.Request, owner, clinicID, patientID string) (*models.SharedPatientRecord, error) {
+	if owner == clinicID {
+		return nil, nil
+	}
+	org, err := clinics.SharedOrganization(r.Context(), owner, clinicID)
+	if err != nil || org == nil {
+		return nil, err
+	}
+
+	record := &models.SharedPatientRecord{OwnerClinicID: owner, Policy: org.Sharing()}
+	switch org.Sharing() {
+	case clinics.SharingOpen:
+		return record, nil
+	case clinics.SharingGrant:
+		ctx, cancel := config.DBContext(r.Context())
+		defer cancel()
+		result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(patientSharesTable),
+			Key:       shareKey(patientID, clinicID),
+		})
+		if err != nil || result.Item == nil {
+			return nil, err
+		}
+		var share models.PatientShare
+		if err := attributevalue.UnmarshalMap(result.Item, &share); err != nil {
+			return nil, err
+		}
+		if share.OwnerClinicID != owner || share.ExpiresAt <= time.Now().UTC().Format(time.RFC3339) {
+			return nil, nil
+		}
+		record.ExpiresAt = share.ExpiresAt
+		return record, nil
+	}
+	return nil, nil
+}
+
+func shareKey(patientID, clinicID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PatientID":      &types.AttributeValueMemberS{Value: patientID},
+		"TargetClinicID": &types.AttributeValueMemberS{Value: clinicID},
+	}
+}
+
+// getPatient fetches a patient of the clinic of the request, nil when there
+// is none
+func getPatient(r *http.Request, id string) (*models.Patient, error) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var patient models.Patient
+	if err := attributevalue.UnmarshalMap(result.Item, &patient); err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	financialmodels "dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetPatientSummary godoc
+// @Summary Get patient summary
+// @Description Get the patient profile together with the next appointment, last visit, outstanding balance and alerts in a single call
+// @Tags patients
+// @Produce json
+// @Param id path string true "Patient ID"
+// @Success 200 {object} models.PatientSummary
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve patient summary"
+// @Router /api/v1/dental/patient/{id}/summary [get]
+func GetPatientSummary(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve patient summary", http.StatusInternalServerError)
+		log.Printf("Error fetching patient with ID %s: %v", id, err)
+		return
+	}
+	if result.Item == nil {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+
+	summary := models.PatientSummary{Alerts: []models.PatientAlert{}}
+	if err = attributevalue.UnmarshalMap(result.Item, &summary.Patient); err != nil {
+		http.Error(w, "Failed to unmarshal patient data", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling patient data: %v", err)
+		return
+	}
+
+	appointments, err := queryItems[models.Appointment](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String("Appointments"),
+		IndexName:              aws.String(config.AppointmentsByPatientIndex),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve patient summary", http.StatusInternalServerError)
+		log.Printf("Error querying appointments for patient summary: %v", err)
+		return
+	}
+
+	revenues, err := paging.ScanAll[financialmodels.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve patient summary", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues for patient summary: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	var nextStart, lastStart time.Time
+	noShows := 0
+	for i := range appointments {
+		appointment := appointments[i]
+		start, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		switch {
+		case appointment.Status == models.AppointmentStatusNoShow:
+			noShows++
+		case appointment.Status == models.AppointmentStatusCompleted:
+			if summary.LastVisit == nil || start.After(lastStart) {
+				summary.LastVisit = &appointment
+				lastStart = start
+			}
+		case !appointment.IsCancelled() && start.After(now):
+			if summary.NextAppointment == nil || start.Before(nextStart) {
+				summary.NextAppointment = &appointment
+				nextStart = start
+			}
+		}
+	}
+
+	for _, revenue := range revenues {
+		outstanding := revenue.Outstanding()
+		summary.OutstandingBalance += outstanding
+		if revenue.DueDate.Before(now) {
+			summary.OverdueBalance += outstanding
+		}
+	}
+	summary.OutstandingBalance = math.Round(summary.OutstandingBalance*100) / 100
+	summary.OverdueBalance = math.Round(summary.OverdueBalance*100) / 100
+
+	if strings.TrimSpace(summary.Patient.MedicalNotes) != "" {
+		summary.Alerts = append(summary.Alerts, models.PatientAlert{
+			Type:     "medical_notes",
+			Severity: models.AlertSeverityWarning,
+			Message:  "Patient has medical notes on file, review before treatment",
+		})
+	}
+	if summary.OverdueBalance > 0 {
+		summary.Alerts = append(summary.Alerts, models.PatientAlert{
+			Type:     "overdue_balance",
+			Severity: models.AlertSeverityWarning,
+			Message:  fmt.Sprintf("Patient has %.2f in overdue payments", summary.OverdueBalance),
+		})
+	}
+	if noShows > 0 {
+		summary.Alerts = append(summary.Alerts, models.PatientAlert{
+			Type:     "no_shows",
+			Severity: models.AlertSeverityInfo,
+			Message:  fmt.Sprintf("Patient missed %d appointment(s)", noShows),
+		})
+	}
+	if summary.Patient.Phone == "" {
+		summary.Alerts = append(summary.Alerts, models.PatientAlert{
+			Type:     "missing_contact",
+			Severity: models.AlertSeverityInfo,
+			Message:  "Patient has no phone number registered",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreatePreAuth godoc
+// @Summary Submit a pre-authorization
+// @Description Record a pre-authorization request submitted to the insurance carrier for a patient's planned procedure. New requests start as pending unless the carrier's answer is already known.
+// @Tags preauth
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string false "Staff member submitting the request"
+// @Param preauth body models.PreAuth true "Patient, procedure, carrier and planned date"
+// @Success 201 {object} models.PreAuth
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Patient or procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to save pre-authorization"
+// @Router /api/v1/dental/preauth [post]
+func CreatePreAuth(w http.ResponseWriter, r *http.Request) {
+	var preAuth models.PreAuth
+	if err := json.NewDecoder(r.Body).Decode(&preAuth); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	preAuth.ID = uuid.NewString()
+	if preAuth.Status == "" {
+		preAuth.Status = models.PreAuthStatusPending
+	}
+	if err := preAuth.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !preAuthReferencesExist(w, r, preAuth) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	preAuth.CreatedBy = inbox.User(r)
+	preAuth.CreatedAt = now
+	preAuth.UpdatedAt = now
+	preAuth.DecidedAt = ""
+	if preAuth.Status != models.PreAuthStatusPending {
+		preAuth.DecidedAt = now
+	}
+
+	if err := putPreAuth(r.Context(), preAuth, true); err != nil {
+		http.Error(w, "Failed to save pre-authorization", http.StatusInternalServerError)
+		log.Printf("Error saving pre-authorization: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(preAuth)
+}
+
+// GetAllPreAuths godoc
+// @Summary Get pre-authorizations
+// @Description Get pre-authorizations, optionally filtered by status and patient
+// @Tags preauth
+// @Produce json
+// @Param status query string false "pending, approved or denied"
+// @Param patientId query string false "Only pre-authorizations of this patient"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.PreAuth
+// @Failure 500 {object} apierror.Response "Failed to retrieve pre-authorizations"
+// @Router /api/v1/dental/preauth [get]
+func GetAllPreAuths(w http.ResponseWriter, r *http.Request) {
+	input := &dynamodb.ScanInput{TableName: aws.String("PreAuths")}
+	var filters []string
+	values := map[string]types.AttributeValue{}
+	query := r.URL.Query()
+	if status := query.Get("status"); status != "" {
+		filters = append(filters, "#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		values[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+	if patientID := query.Get("patientId"); patientID != "" {
+		filters = append(filters, "PatientID = :patientId")
+		values[":patientId"] = &types.AttributeValueMemberS{Value: patientID}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+	}
+
+	page := paging.Request(r)
+	preAuths, next, err := paging.Scan[models.PreAuth](r.Context(), input, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve pre-authorizations", http.StatusInternalServerError)
+		log.Printf("Error scanning pre-authorizations: %v", err)
+		return
+	}
+
+	paging.Write(w, page, preAuths, next)
+}
+
+// GetPreAuthByID godoc
+// @Summary Get a pre-authorization by ID
+// @Description Get a pre-authorization by its ID
+// @Tags preauth
+// @Produce json
+// @Param id path string true "Pre-authorization ID"
+// @Success 200 {object} models.PreAuth
+// @Failure 404 {object} apierror.Response "Pre-authorization not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve pre-authorization"
+// @Router /api/v1/dental/preauth/{id} [get]
+func GetPreAuthByID(w http.ResponseWriter, r *http.Request) {
+	preAuth, ok := loadPreAuth(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preAuth)
+}
+
+// UpdatePreAuth godoc
+// @Summary Update a pre-authorization
+// @Description Update a pre-authorization by its ID, typically to record the carrier's answer: approved with the auth number and validity, or denied with the reason. Only the fields sent are changed.
+// @Tags preauth
+// @Accept json
+// @Produce json
+// @Param id path string true "Pre-authorization ID"
+// @Param If-Match header string false "Version of the pre-authorization being changed; required unless the body has it"
+// @Param preauth body models.PreAuth true "Pre-authorization data"
+// @Success 200 {object} models.PreAuth
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Pre-authorization, patient or procedure not found"
+// @Failure 409 {object} apierror.Response "Pre-authorization was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the pre-authorization is required"
+// @Failure 500 {object} apierror.Response "Failed to update pre-authorization"
+// @Router /api/v1/dental/preauth/{id} [put]
+func UpdatePreAuth(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "PreAuths", id)
+	if !ok {
+		return
+	}
+	current, ok := loadPreAuth(w, r, id)
+	if !ok {
+		return
+	}
+
+	var updatedData models.PreAuth
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.PatientID != "" {
+		current.PatientID = updatedData.PatientID
+	}
+	if updatedData.ProcedureID != "" {
+		current.ProcedureID = updatedData.ProcedureID
+	}
+	if updatedData.Carrier != "" {
+		current.Carrier = updatedData.Carrier
+	}
+	if updatedData.PlannedDate != "" {
+		current.PlannedDate = updatedData.PlannedDate
+	}
+	if updatedData.AuthNumber != "" {
+		current.AuthNumber = updatedData.AuthNumber
+	}
+	if updatedData.ValidFrom != "" {
+		current.ValidFrom = updatedData.ValidFrom
+	}
+	if updatedData.ValidUntil != "" {
+		current.ValidUntil = updatedData.ValidUntil
+	}
+	if updatedData.DenialReason != "" {
+		current.DenialReason = updatedData.DenialReason
+	}
+	if updatedData.Notes != "" {
+		current.Notes = updatedData.Notes
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if updatedData.Status != "" && updatedData.Status != current.Status {
+		current.Status = updatedData.Status
+		current.DecidedAt = ""
+		if current.Status != models.PreAuthStatusPending {
+			current.DecidedAt = now
+		}
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !preAuthReferencesExist(w, r, current) {
+		return
+	}
+	current.UpdatedAt = now
+
+	if err := putPreAuth(r.Context(), current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Pre-authorization not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update pre-authorization", http.StatusInternalServerError)
+		log.Printf("Error updating pre-authorization: %v", err)
+		return
+	}
+	current.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeletePreAuth godoc
+// @Summary Delete a pre-authorization
+// @Description Delete a pre-authorization by its ID
+// @Tags preauth
+// @Param id path string true "Pre-authorization ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Pre-authorization not found"
+// @Failure 500 {object} apierror.Response "Failed to delete pre-authorization"
+// @Router /api/v1/dental/preauth/{id} [delete]
+func DeletePreAuth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("PreAuths"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: mux.Vars(r)["id"]},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Pre-authorization not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete pre-authorization", http.StatusInternalServerError)
+		log.Printf("Error deleting pre-authorization: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// preAuthEnforcement returns how scheduling a procedure that requires
+// pre-authorization without a valid one is handled: off, warn (default) or block
+func preAuthEnforcement() string {
+	switch mode := config.EnvString("PREAUTH_ENFORCEMENT", models.PreAuthEnforcementWarn); mode {
+	case models.PreAuthEnforcementOff, models.PreAuthEnforcementBlock:
+		return mode
+	default:
+		return models.PreAuthEnforcementWarn
+	}
+}
+
+// checkPreAuth enforces PREAUTH_ENFORCEMENT for appointments of procedures
+// that require carrier pre-authorization and whose patient has no approved
+// pre-authorization valid on the appointment day: in block mode it writes a
+// 409, in warn mode it only adds a Warning header. It returns false when the
+// response was written.
+func checkPreAuth(w http.ResponseWriter, r *http.Request, appointments ...models.Appointment) bool {
+	mode := preAuthEnforcement()
+	if mode == models.PreAuthEnforcementOff {
+		return true
+	}
+
+	var procedureIDs []string
+	for _, appointment := range appointments {
+		if appointment.ProcedureID != "" && !appointment.IsCancelled() {
+			procedureIDs = append(procedureIDs, appointment.ProcedureID)
+		}
+	}
+	if len(procedureIDs) == 0 {
+		return true
+	}
+
+	missing, err := missingPreAuths(r.Context(), procedureIDs, appointments)
+	if err != nil {
+		http.Error(w, "Failed to check pre-authorization", http.StatusInternalServerError)
+		log.Printf("Error checking pre-authorizations: %v", err)
+		return false
+	}
+	if len(missing) == 0 {
+		return true
+	}
+
+	if mode == models.PreAuthEnforcementBlock {
+		http.Error(w, fmt.Sprintf("Carrier pre-authorization required: no approved pre-authorization covers %s", strings.Join(missing, ", ")), http.StatusConflict)
+		return false
+	}
+	for _, message := range missing {
+		w.Header().Add("Warning", fmt.Sprintf(`299 - "No approved carrier pre-authorization covers %s"`, message))
+	}
+	return true
+}
+
+// missingPreAuths describes each appointment of a procedure requiring
+// pre-authorization that no approved pre-authorization of its patient covers
+func missingPreAuths(ctx context.Context, procedureIDs []string, appointments []models.Appointment) ([]string, error) {
+	procedures, err := batchGetItems[models.Procedure](ctx, "Procedures", procedureIDs)
+	if err != nil {
+		return nil, err
+	}
+	required := make(map[string]string)
+	for _, procedure := range procedures {
+		if procedure.NeedsPreAuth() {
+			required[procedure.ID] = procedure.Name
+		}
+	}
+	if len(required) == 0 {
+		return nil, nil
+	}
+
+	approved := make(map[string][]models.PreAuth)
+	var missing []string
+	for _, appointment := range appointments {
+		name, ok := required[appointment.ProcedureID]
+		if !ok || appointment.IsCancelled() {
+			continue
+		}
+		day, ok := appointmentDay(appointment.DateTime)
+		if !ok {
+			continue
+		}
+
+		preAuths, loaded := approved[appointment.PatientID]
+		if !loaded {
+			preAuths, err = paging.ScanAll[models.PreAuth](ctx, &dynamodb.ScanInput{
+				TableName:                aws.String("PreAuths"),
+				FilterExpression:         aws.String("PatientID = :patientId AND #status = :approved"),
+				ExpressionAttributeNames: map[string]string{"#status": "Status"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":patientId": &types.AttributeValueMemberS{Value: appointment.PatientID},
+					":approved":  &types.AttributeValueMemberS{Value: models.PreAuthStatusApproved},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			approved[appointment.PatientID] = preAuths
+		}
+
+		covered := false
+		for _, preAuth := range preAuths {
+			if preAuth.ProcedureID == appointment.ProcedureID && preAuth.Covers(day) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			missing = append(missing, fmt.Sprintf("%s on %s", name, day))
+		}
+	}
+	return missing, nil
+}
+
+// loadPreAuth fetches a pre-authorization, writing the error response when it cannot be returned
+func loadPreAuth(w http.ResponseWriter, r *http.Request, id string) (models.PreAuth, bool) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("PreAuths"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve pre-authorization", http.StatusInternalServerError)
+		log.Printf("Error fetching pre-authorization with ID %s: %v", id, err)
+		return models.PreAuth{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Pre-authorization not found", http.StatusNotFound)
+		return models.PreAuth{}, false
+	}
+
+	var preAuth models.PreAuth
+	if err := attributevalue.UnmarshalMap(result.Item, &preAuth); err != nil {
+		http.Error(w, "Failed to unmarshal pre-authorization data", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling pre-authorization data: %v", err)
+		return models.PreAuth{}, false
+	}
+	return preAuth, true
+}
+
+// preAuthReferencesExist checks the patient and procedure exist, writing the
+// error response when they do not
+func preAuthReferencesExist(w http.ResponseWriter, r *http.Request, preAuth models.PreAuth) bool {
+	for _, ref := range []struct{ table, id, entity string }{
+		{"Patients", preAuth.PatientID, "Patient"},
+		{"Procedures", preAuth.ProcedureID, "Procedure"},
+	} {
+		exists, err := itemExists(r.Context(), ref.table, ref.id)
+		if err != nil {
+			http.Error(w, "Failed to save pre-authorization", http.StatusInternalServerError)
+			log.Printf("Error checking %s %s: %v", strings.ToLower(ref.entity), ref.id, err)
+			return false
+		}
+		if !exists {
+			http.Error(w, ref.entity+" not found", http.StatusNotFound)
+			return false
+		}
+	}
+	return true
+}
+
+// putPreAuth creates (create) or replaces a pre-authorization
+func putPreAuth(ctx context.Context, preAuth models.PreAuth, create bool) error {
+	item, err := attributevalue.MarshalMap(preAuth)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("PreAuths"),
+		Item:      item,
+	}, create)
+}
@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/pdf"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreatePrescription godoc
+// @Summary Write a prescription
+// @Description Write a prescription for a patient: the medications with their dosage and frequency, and optionally duration, quantity and instructions. Medications of the catalog (medication_id) fill in what is not sent. The medications are checked against the ones the patient takes, as listed in the anamnesis; the interactions found are kept in the prescription and sent in Warning headers, without blocking it.
+// @Tags prescriptions
+// @Accept json
+// @Produce json
+// @Param prescription body models.Prescription true "Patient, dentist and medications"
+// @Success 201 {object} models.Prescription
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or appointment of another patient"
+// @Failure 404 {object} apierror.Response "Patient, dentist, appointment or medication not found"
+// @Failure 500 {object} apierror.Response "Failed to save prescription"
+// @Router /api/v1/dental/prescription [post]
+func CreatePrescription(w http.ResponseWriter, r *http.Request) {
+	var prescription models.Prescription
+	if err := json.NewDecoder(r.Body).Decode(&prescription); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if prescription.IssueDate == "" {
+		prescription.IssueDate = time.Now().UTC().Format("2006-01-02")
+	}
+	if !preparePrescription(w, r, &prescription) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	prescription.ID = uuid.NewString()
+	prescription.ClinicID = ""
+	prescription.CreatedAt = now
+	prescription.CreatedBy = config.ActorFrom(r.Context()).User
+	prescription.UpdatedAt = now
+	prescription.Version = 0
+
+	if err := putPrescription(r.Context(), prescription, true); err != nil {
+		http.Error(w, "Failed to save prescription", http.StatusInternalServerError)
+		log.Printf("Error saving prescription: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(prescription)
+}
+
+// GetAllPrescriptions godoc
+// @Summary Get prescriptions
+// @Description Get prescriptions, optionally filtered by patient and dentist
+// @Tags prescriptions
+// @Produce json
+// @Param patientId query string false "Only prescriptions of this patient"
+// @Param dentistId query string false "Only prescriptions written by this dentist"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Prescription
+// @Failure 500 {object} apierror.Response "Failed to retrieve prescriptions"
+// @Router /api/v1/dental/prescription [get]
+func GetAllPrescriptions(w http.ResponseWriter, r *http.Request) {
+	input := &dynamodb.ScanInput{TableName: aws.String("Prescriptions")}
+	var filters []string
+	values := map[string]types.AttributeValue{}
+	query := r.URL.Query()
+	if patientID := query.Get("patientId"); patientID != "" {
+		filters = append(filters, "PatientID = :patientId")
+		values[":patientId"] = &types.AttributeValueMemberS{Value: patientID}
+	}
+	if dentistID := query.Get("dentistId"); dentistID != "" {
+		filters = append(filters, "DentistID = :dentistId")
+		values[":dentistId"] = &types.AttributeValueMemberS{Value: dentistID}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+	}
+
+	page := paging.Request(r)
+	prescriptions, next, err := paging.Scan[models.Prescription](r.Context(), input, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve prescriptions", http.StatusInternalServerError)
+		log.Printf("Error scanning prescriptions: %v", err)
+		return
+	}
+
+	paging.Write(w, page, prescriptions, next)
+}
+
+// GetPrescriptionByID godoc
+// @Summary Get a prescription by ID
+// @Description Get a prescription by its ID, with the interactions found when it was written
+// @Tags prescriptions
+// @Produce json
+// @Param id path string true "Prescription ID"
+// @Success 200 {object} models.Prescription
+// @Failure 404 {object} apierror.Response "Prescription not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve prescription"
+// @Router /api/v1/dental/prescription/{id} [get]
+func GetPrescriptionByID(w http.ResponseWriter, r *http.Request) {
+	prescription, ok := loadPrescription(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prescription)
+}
+
+// UpdatePrescription godoc
+// @Summary Update a prescription
+// @Description Replace the dentist, appointment, issue date, medications and notes of a prescription. The medications are checked for interactions again.
+// @Tags prescriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Prescription ID"
+// @Param If-Match header string false "Version of the prescription being changed; required unless the body has it"
+// @Param prescription body models.Prescription true "Prescription data"
+// @Success 200 {object} models.Prescription
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or appointment of another patient"
+// @Failure 404 {object} apierror.Response "Prescription, dentist, appointment or medication not found"
+// @Failure 409 {object} apierror.Response "Prescription was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the prescription is required"
+// @Failure 500 {object} apierror.Response "Failed to update prescription"
+// @Router /api/v1/dental/prescription/{id} [put]
+func UpdatePrescription(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Prescriptions", id)
+	if !ok {
+		return
+	}
+	current, ok := loadPrescription(w, r, id)
+	if !ok {
+		return
+	}
+
+	var updatedData models.Prescription
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.DentistID != "" {
+		current.DentistID = updatedData.DentistID
+	}
+	if updatedData.IssueDate != "" {
+		current.IssueDate = updatedData.IssueDate
+	}
+	if len(updatedData.Items) > 0 {
+		current.Items = updatedData.Items
+	}
+	current.AppointmentID = updatedData.AppointmentID
+	current.Notes = updatedData.Notes
+	if !preparePrescription(w, r, &current) {
+		return
+	}
+	current.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putPrescription(r.Context(), current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Prescription not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update prescription", http.StatusInternalServerError)
+		log.Printf("Error updating prescription %s: %v", id, err)
+		return
+	}
+	current.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeletePrescription godoc
+// @Summary Delete a prescription
+// @Description Delete a prescription by its ID. Prescriptions of a patient under legal hold are kept.
+// @Tags prescriptions
+// @Param id path string true "Prescription ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Prescription not found"
+// @Failure 409 {object} apierror.Response "Prescription is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete prescription"
+// @Router /api/v1/dental/prescription/{id} [delete]
+func DeletePrescription(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	patientID, err := prescriptionPatient(r, id)
+	if err != nil {
+		http.Error(w, "Failed to delete prescription", http.StatusInternalServerError)
+		log.Printf("Error fetching prescription %s: %v", id, err)
+		return
+	}
+	if !checkLegalHold(w, r, legalhold.RecordPrescription, id, patientID) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err = config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Prescriptions"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Prescription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete prescription", http.StatusInternalServerError)
+		log.Printf("Error deleting prescription %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPrescriptionPDF godoc
+// @Summary Print a prescription
+// @Description Render a prescription for printing and handing to the patient: the clinic's letterhead (see /api/v1/admin/letterhead), the patient, the medications with their directions and the dentist's signature line with the CRO
+// @Tags prescriptions
+// @Produce application/pdf
+// @Param id path string true "Prescription ID"
+// @Success 200 {file} file "Prescription PDF"
+// @Failure 404 {object} apierror.Response "Prescription not found"
+// @Failure 500 {object} apierror.Response "Failed to render prescription"
+// @Router /api/v1/dental/prescription/{id}/pdf [get]
+func GetPrescriptionPDF(w http.ResponseWriter, r *http.Request) {
+	prescription, ok := loadPrescription(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	letterhead, err := clinics.GetLetterhead(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to render prescription", http.StatusInternalServerError)
+		log.Printf("Error loading letterhead for prescription %s: %v", prescription.ID, err)
+		return
+	}
+	// Printed as written, even if the patient or dentist was removed since
+	ctx := config.WithDeleted(r.Context(), true)
+	var patient models.Patient
+	var dentist models.Dentist
+	patients, err := batchGetItems[models.Patient](ctx, "Patients", []string{prescription.PatientID})
+	if err == nil {
+		var dentists []models.Dentist
+		dentists, err = batchGetItems[models.Dentist](ctx, "Dentists", []string{prescription.DentistID})
+		if len(dentists) > 0 {
+			dentist = dentists[0]
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to render prescription", http.StatusInternalServerError)
+		log.Printf("Error fetching patient and dentist of prescription %s: %v", prescription.ID, err)
+		return
+	}
+	if len(patients) > 0 {
+		patient = patients[0]
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="prescription-%s.pdf"`, prescription.ID))
+	if err := pdf.RenderDocument(w, prescriptionDocument(prescription, patient, dentist, letterhead)); err != nil {
+		log.Printf("Error writing prescription PDF: %v", err)
+	}
+}
+
+// prescriptionDocument lays a prescription out as a PDF document
+func prescriptionDocument(prescription models.Prescription, patient models.Patient, dentist models.Dentist, letterhead clinics.Letterhead) pdf.Document {
+	patientName := patient.Name
+	if patientName == "" {
+		patientName = prescription.PatientID
+	}
+	lines := []string{
+		fmt.Sprintf("%-9s %s", "Patient:", patientName),
+	}
+	if patient.DateOfBirth != "" {
+		lines = append(lines, fmt.Sprintf("%-9s %s", "Born:", patient.DateOfBirth))
+	}
+	lines = append(lines, fmt.Sprintf("%-9s %s", "Date:", prescription.IssueDate), "")
+
+	for i, item := range prescription.Items {
+		medication := strings.Join(strings.Fields(strings.Join([]string{item.Name, item.Strength, item.Form}, " ")), " ")
+		if item.Quantity != "" {
+			medication += " - " + item.Quantity
+		}
+		lines = append(lines, wrapIndented(fmt.Sprintf("%d. ", i+1), medication)...)
+		directions := item.Dosage + ", " + item.Frequency
+		if item.Duration != "" {
+			directions += ", " + item.Duration
+		}
+		lines = append(lines, wrapIndented("   ", directions)...)
+		if item.Instructions != "" {
+			lines = append(lines, wrapIndented("   ", item.Instructions)...)
+		}
+		lines = append(lines, "")
+	}
+
+	if prescription.Notes != "" {
+		lines = append(lines, "Notes:")
+		lines = append(lines, wrapIndented("  ", prescription.Notes)...)
+		lines = append(lines, "")
+	}
+
+	dentistName := dentist.Name
+	if dentistName == "" {
+		dentistName = prescription.DentistID
+	}
+	lines = append(lines, "", "", strings.Repeat("_", 40), dentistName)
+	if dentist.CRO != "" {
+		lines = append(lines, "CRO "+dentist.CRO)
+	}
+	if letterhead.Footer != "" {
+		lines = append(lines, "", letterhead.Footer)
+	}
+
+	return pdf.Document{Letterhead: letterhead.Lines(), Title: "Prescription", Lines: lines}
+}
+
+// wrapIndented wraps text to the page, starting with prefix and indenting
+// the following lines as much
+func wrapIndented(prefix, text string) []string {
+	lines := wrapText(text, pdf.MaxColumns-len(prefix))
+	for i := range lines {
+		if i == 0 {
+			lines[i] = prefix + lines[i]
+		} else {
+			lines[i] = strings.Repeat(" ", len(prefix)) + lines[i]
+		}
+	}
+	return lines
+}
+
+// preparePrescription validates a prescription, fills its catalog
+// medications in and checks them for interactions with the ones the patient
+// takes, adding a Warning header for each interaction found. It writes the
+// error response and returns false when the prescription cannot be saved.
+func preparePrescription(w http.ResponseWriter, r *http.Request, prescription *models.Prescription) bool {
+	var ids []string
+	for _, item := range prescription.Items {
+		if item.MedicationID != "" {
+			ids = append(ids, item.MedicationID)
+		}
+	}
+	if len(ids) > 0 {
+		medications, err := batchGetItems[models.Medication](r.Context(), "Medications", ids)
+		if err != nil {
+			http.Error(w, "Failed to save prescription", http.StatusInternalServerError)
+			log.Printf("Error fetching medications: %v", err)
+			return false
+		}
+		catalog := make(map[string]models.Medication, len(medications))
+		for _, medication := range medications {
+			catalog[medication.ID] = medication
+		}
+		for i := range prescription.Items {
+			item := &prescription.Items[i]
+			if item.MedicationID == "" {
+				continue
+			}
+			medication, ok := catalog[item.MedicationID]
+			if !ok {
+				http.Error(w, fmt.Sprintf("Medication %s not found", item.MedicationID), http.StatusNotFound)
+				return false
+			}
+			fillPrescriptionItem(item, medication)
+		}
+	}
+	if err := prescription.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	patients, err := batchGetItems[models.Patient](r.Context(), "Patients", []string{prescription.PatientID})
+	if err != nil {
+		http.Error(w, "Failed to save prescription", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s: %v", prescription.PatientID, err)
+		return false
+	}
+	if len(patients) == 0 || patients[0].DeletedAt != "" {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return false
+	}
+	exists, err := itemExists(r.Context(), "Dentists", prescription.DentistID)
+	if err != nil {
+		http.Error(w, "Failed to save prescription", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", prescription.DentistID, err)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return false
+	}
+	if prescription.AppointmentID != "" {
+		appointments, err := batchGetItems[models.Appointment](r.Context(), "Appointments", []string{prescription.AppointmentID})
+		if err != nil {
+			http.Error(w, "Failed to save prescription", http.StatusInternalServerError)
+			log.Printf("Error fetching appointment %s: %v", prescription.AppointmentID, err)
+			return false
+		}
+		if len(appointments) == 0 {
+			http.Error(w, "Appointment not found", http.StatusNotFound)
+			return false
+		}
+		if appointments[0].PatientID != prescription.PatientID {
+			http.Error(w, "The appointment is of another patient", http.StatusBadRequest)
+			return false
+		}
+	}
+
+	// A prescription is never held back by the check: the dentist decides
+	check, err := checkInteractions(r.Context(), patients[0], prescription.Medications())
+	if err != nil {
+		log.Printf("Error checking interactions for prescription of patient %s: %v", prescription.PatientID, err)
+		w.Header().Add("Warning", `299 - "Medication interactions could not be checked"`)
+		prescription.Interactions = nil
+		return true
+	}
+	prescription.Interactions = check.Interactions
+	for _, interaction := range check.Interactions {
+		message := fmt.Sprintf("%s interaction of %s with %s: %s", interaction.Severity, interaction.Medication, interaction.With, interaction.Description)
+		w.Header().Add("Warning", fmt.Sprintf(`299 - "%s"`, strings.ReplaceAll(message, `"`, "'")))
+	}
+	return true
+}
+
+// fillPrescriptionItem completes an item with the data of its catalog
+// medication, keeping what was written
+func fillPrescriptionItem(item *models.PrescriptionItem, medication models.Medication) {
+	if item.Name == "" {
+		item.Name = medication.Name
+	}
+	item.ActiveIngredient = medication.ActiveIngredient
+	if item.Strength == "" {
+		item.Strength = medication.Strength
+	}
+	if item.Form == "" {
+		item.Form = medication.Form
+	}
+	if item.Dosage == "" {
+		item.Dosage = medication.DefaultDosage
+	}
+}
+
+// loadPrescription fetches a prescription, writing the error response when
+// it fails
+func loadPrescription(w http.ResponseWriter, r *http.Request, id string) (models.Prescription, bool) {
+	prescription, err := getPrescription(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve prescription", http.StatusInternalServerError)
+		log.Printf("Error fetching prescription %s: %v", id, err)
+		return models.Prescription{}, false
+	}
+	if prescription == nil {
+		http.Error(w, "Prescription not found", http.StatusNotFound)
+		return models.Prescription{}, false
+	}
+	return *prescription, true
+}
+
+func getPrescription(ctx context.Context, id string) (*models.Prescription, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Prescriptions"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var prescription models.Prescription
+	if err := attributevalue.UnmarshalMap(result.Item, &prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+func putPrescription(ctx context.Context, prescription models.Prescription, create bool) error {
+	item, err := attributevalue.MarshalMap(prescription)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Prescriptions"),
+		Item:      item,
+	}, create)
+}
@@ -2,19 +2,17 @@ package handlers
 
 import (
 	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/shared/i18n"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
 	"encoding/json"
 	"errors"
-	"dental-saas/modules/dental/models"
-	"dental-saas/shared/config"
 	"log"
 	"net/http"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -26,9 +24,9 @@ import (
 // @Produce json
 // @Param procedure body models.Procedure true "Procedure data"
 // @Success 201 {object} models.Procedure
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 409 {string} string "Procedure with this ID already exists"
-// @Failure 500 {string} string "Failed to save procedure"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Procedure with this ID already exists"
+// @Failure 500 {object} apierror.Response "Failed to save procedure"
 // @Router /api/v1/dental/procedure [post]
 func CreateProcedure(w http.ResponseWriter, r *http.Request) {
 	var procedure models.Procedure
@@ -37,43 +35,9 @@ func CreateProcedure(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if procedure.ID == "" {
-		procedure.ID = uuid.NewString()
-	}
-
-	if err := procedure.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	if procedure.CreatedAt == "" {
-		procedure.CreatedAt = time.Now().UTC().Format(time.RFC3339)
-	}
-	if procedure.UpdatedAt == "" {
-		procedure.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
-	}
-
-	_, err := config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName: aws.String("Procedures"),
-		Item: map[string]types.AttributeValue{
-			"ID":          &types.AttributeValueMemberS{Value: procedure.ID},
-			"Name":        &types.AttributeValueMemberS{Value: procedure.Name},
-			"Description": &types.AttributeValueMemberS{Value: procedure.Description},
-			"Price":       &types.AttributeValueMemberS{Value: procedure.Price},
-			"Duration":    &types.AttributeValueMemberS{Value: procedure.Duration},
-			"CreatedAt":   &types.AttributeValueMemberS{Value: procedure.CreatedAt},
-			"UpdatedAt":   &types.AttributeValueMemberS{Value: procedure.UpdatedAt},
-		},
-		ConditionExpression: aws.String("attribute_not_exists(ID)"),
-	})
+	procedure, err := Procedures.Create(r.Context(), procedure)
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Procedure with this ID already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to save procedure", http.StatusInternalServerError)
-		log.Printf("Error saving procedure: %v", err)
+		writeServiceError(w, err, "Procedure", "Failed to save procedure")
 		return
 	}
 
@@ -86,31 +50,41 @@ func CreateProcedure(w http.ResponseWriter, r *http.Request) {
 // @Description Get a list of all procedures
 // @Tags procedures
 // @Produce json
+// @Param stream query bool false "Stream the list as newline-delimited JSON"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Param Accept-Language header string false "Preferred languages (pt-BR, en, es); defaults to the clinic language"
 // @Success 200 {array} models.Procedure
-// @Failure 500 {string} string "Failed to retrieve procedures"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedures"
 // @Router /api/v1/dental/procedure [get]
 func GetAllProcedures(w http.ResponseWriter, r *http.Request) {
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String("Procedures"),
-	})
+	if wantsStream(r) {
+		languages := i18n.Preferred(r)
+		w.Header().Add("Vary", "Accept-Language")
+		streamList(w, r, "procedures", Procedures.List, func(ctx context.Context, page []models.Procedure) error {
+			for i := range page {
+				page[i].Localize(languages, i18n.Default())
+			}
+			return nil
+		})
+		return
+	}
+
+	page := paging.Request(r)
+	procedures, next, err := Procedures.List(r.Context(), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to retrieve procedures", http.StatusInternalServerError)
 		log.Printf("Error scanning procedures: %v", err)
 		return
 	}
+	localizeProcedures(w, r, procedures)
 
-	var procedures []models.Procedure
-	for _, item := range result.Items {
-		var procedure models.Procedure
-		if err := attributevalue.UnmarshalMap(item, &procedure); err != nil {
-			log.Printf("Error unmarshaling procedure: %v", err)
-			continue
-		}
-		procedures = append(procedures, procedure)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(procedures)
+	paging.Write(w, page, procedures, next)
 }
 
 // GetProcedureByID godoc
@@ -119,39 +93,22 @@ func GetAllProcedures(w http.ResponseWriter, r *http.Request) {
 // @Tags procedures
 // @Produce json
 // @Param id path string true "Procedure ID"
+// @Param Accept-Language header string false "Preferred languages (pt-BR, en, es); defaults to the clinic language"
 // @Success 200 {object} models.Procedure
-// @Failure 404 {string} string "Procedure not found"
-// @Failure 500 {string} string "Failed to retrieve procedure"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedure"
 // @Router /api/v1/dental/procedure/{id} [get]
 func GetProcedureByID(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Procedures"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
+	procedure, err := Procedures.Get(r.Context(), mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Failed to retrieve procedure", http.StatusInternalServerError)
-		log.Printf("Error fetching procedure with ID %s: %v", id, err)
-		return
-	}
-	if result.Item == nil {
-		http.Error(w, "Procedure not found", http.StatusNotFound)
-		return
-	}
-
-	var procedure models.Procedure
-	if err = attributevalue.UnmarshalMap(result.Item, &procedure); err != nil {
-		http.Error(w, "Failed to unmarshal procedure data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling procedure data: %v", err)
+		writeServiceError(w, err, "Procedure", "Failed to retrieve procedure")
 		return
 	}
+	localized := []models.Procedure{procedure}
+	localizeProcedures(w, r, localized)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(procedure)
+	json.NewEncoder(w).Encode(localized[0])
 }
 
 // GetProcedureByName godoc
@@ -160,167 +117,162 @@ func GetProcedureByID(w http.ResponseWriter, r *http.Request) {
 // @Tags procedures
 // @Produce json
 // @Param name path string true "Procedure Name"
+// @Param Accept-Language header string false "Preferred languages (pt-BR, en, es); defaults to the clinic language"
 // @Success 200 {array} models.Procedure
-// @Failure 500 {string} string "Failed to retrieve procedures"
+// @Failure 500 {object} apierror.Response "Failed to retrieve procedures"
 // @Router /api/v1/dental/procedure/name/{name} [get]
 func GetProcedureByName(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-
-	result, err := config.DBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:        aws.String("Procedures"),
-		FilterExpression: aws.String("contains(#name, :name)"),
-		ExpressionAttributeNames: map[string]string{
-			"#name": "Name",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":name": &types.AttributeValueMemberS{Value: name},
-		},
-	})
+	procedures, err := Procedures.FindByName(r.Context(), mux.Vars(r)["name"])
 	if err != nil {
 		http.Error(w, "Failed to retrieve procedures", http.StatusInternalServerError)
 		log.Printf("Error scanning procedures by name: %v", err)
 		return
 	}
 
-	var procedures []models.Procedure
-	for _, item := range result.Items {
-		var procedure models.Procedure
-		if err := attributevalue.UnmarshalMap(item, &procedure); err != nil {
-			log.Printf("Error unmarshaling procedure: %v", err)
-			continue
-		}
-		procedures = append(procedures, procedure)
-	}
+	localizeProcedures(w, r, procedures)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(procedures)
 }
 
 // UpdateProcedure godoc
-// @Summary Update an existing procedure
-// @Description Update fields of an existing procedure by providing its ID
+// @Summary Replace an existing procedure
+// @Description Replace an existing procedure with the procedure sent: fields left out are cleared. The ID, clinic and timestamps are kept. Use PATCH to change only some fields.
 // @Tags procedures
 // @Accept json
 // @Produce json
 // @Param id path string true "Procedure ID"
+// @Param If-Match header string false "Version of the procedure being replaced; required unless the body has it"
 // @Param procedure body models.Procedure true "Procedure data (ID will be ignored)"
 // @Success 200 {object} models.Procedure
-// @Failure 400 {string} string "Invalid request body or missing required fields"
-// @Failure 404 {string} string "Procedure not found"
-// @Failure 500 {string} string "Failed to update procedure"
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 409 {object} apierror.Response "Procedure was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the procedure is required"
+// @Failure 500 {object} apierror.Response "Failed to update procedure"
 // @Router /api/v1/dental/procedure/{id} [put]
 func UpdateProcedure(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	result, err := config.DBClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Procedures"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-	})
-	if err != nil {
-		http.Error(w, "Failed to retrieve procedure", http.StatusInternalServerError)
-		log.Printf("Error fetching procedure with ID %s: %v", id, err)
-		return
-	}
-	if result.Item == nil {
-		http.Error(w, "Procedure not found", http.StatusNotFound)
-		return
-	}
-
-	var currentProcedure models.Procedure
-	if err = attributevalue.UnmarshalMap(result.Item, &currentProcedure); err != nil {
-		http.Error(w, "Failed to unmarshal procedure data", http.StatusInternalServerError)
-		log.Printf("Error unmarshaling procedure data: %v", err)
+	r, version, ok := versioning.Require(w, r, "Procedures", mux.Vars(r)["id"])
+	if !ok {
 		return
 	}
 
-	var updatedData models.Procedure
-	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+	var procedure models.Procedure
+	if err := json.NewDecoder(r.Body).Decode(&procedure); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if updatedData.Name != "" {
-		currentProcedure.Name = updatedData.Name
-	}
-	if updatedData.Description != "" {
-		currentProcedure.Description = updatedData.Description
-	}
-	if updatedData.Price != "" {
-		currentProcedure.Price = updatedData.Price
-	}
-	if updatedData.Duration != "" {
-		currentProcedure.Duration = updatedData.Duration
-	}
+	current, previous, err := Procedures.Update(r.Context(), mux.Vars(r)["id"], procedure)
+	procedureUpdated(w, r, version, current, previous, err)
+}
 
-	if err := currentProcedure.IsValid(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// PatchProcedure godoc
+// @Summary Update fields of a procedure
+// @Description Change some fields of an existing procedure with a JSON Merge Patch (RFC 7386): only the fields sent change, and null clears an optional field such as description or tags. Members of translations are merged by language.
+// @Tags procedures
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Procedure ID"
+// @Param If-Match header string false "Version of the procedure being changed; required unless the patch has it"
+// @Param patch body object true "Fields to change, null to clear"
+// @Success 200 {object} models.Procedure
+// @Failure 400 {object} apierror.Response "Invalid patch or missing required fields"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 409 {object} apierror.Response "Procedure was changed since the version sent"
+// @Failure 415 {object} apierror.Response "Content-Type must be application/merge-patch+json"
+// @Failure 428 {object} apierror.Response "Version of the procedure is required"
+// @Failure 500 {object} apierror.Response "Failed to update procedure"
+// @Router /api/v1/dental/procedure/{id} [patch]
+func PatchProcedure(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Procedures", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	patch, ok := readMergePatch(w, r)
+	if !ok {
 		return
 	}
 
-	currentProcedure.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	current, previous, err := Procedures.Patch(r.Context(), mux.Vars(r)["id"], patch)
+	procedureUpdated(w, r, version, current, previous, err)
+}
 
-	_, err = config.DBClient.PutItem(r.Context(), &dynamodb.PutItemInput{
-		TableName: aws.String("Procedures"),
-		Item: map[string]types.AttributeValue{
-			"ID":          &types.AttributeValueMemberS{Value: currentProcedure.ID},
-			"Name":        &types.AttributeValueMemberS{Value: currentProcedure.Name},
-			"Description": &types.AttributeValueMemberS{Value: currentProcedure.Description},
-			"Price":       &types.AttributeValueMemberS{Value: currentProcedure.Price},
-			"Duration":    &types.AttributeValueMemberS{Value: currentProcedure.Duration},
-			"CreatedAt":   &types.AttributeValueMemberS{Value: currentProcedure.CreatedAt},
-			"UpdatedAt":   &types.AttributeValueMemberS{Value: currentProcedure.UpdatedAt},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
+// procedureUpdated answers a replacement or patch of a procedure, at
+// version, and keeps the price history when the price changed
+func procedureUpdated(w http.ResponseWriter, r *http.Request, version int64, current, previous models.Procedure, err error) {
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Procedure not found", http.StatusNotFound)
-			return
+		if !versioning.Conflict(w, r, err) {
+			writeServiceError(w, err, "Procedure", "Failed to update procedure")
 		}
-		http.Error(w, "Failed to update procedure", http.StatusInternalServerError)
-		log.Printf("Error updating procedure: %v", err)
 		return
 	}
+	current.Version = version + 1
+	invalidateAgendas(r.Context())
+
+	// Keep the price history so past dates still resolve to the old price
+	if current.Price != previous.Price {
+		today := time.Now().UTC().Format("2006-01-02")
+		if _, err := pricing.SchedulePrice(r.Context(), previous, current.Price, today); err != nil {
+			log.Printf("Error recording price history of procedure %s: %v", current.ID, err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(currentProcedure)
+	json.NewEncoder(w).Encode(current)
 }
 
 // DeleteProcedure godoc
 // @Summary Delete a procedure
-// @Description Delete a procedure by its ID
+// @Description Soft delete a procedure by its ID: the procedure is hidden from lists and lookups, unless ?include_deleted=true, until restored
 // @Tags procedures
 // @Param id path string true "Procedure ID"
 // @Success 204 "Procedure deleted successfully"
-// @Failure 404 {string} string "Procedure not found"
-// @Failure 500 {string} string "Failed to delete procedure"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to delete procedure"
 // @Router /api/v1/dental/procedure/{id} [delete]
 func DeleteProcedure(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	if err := Procedures.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeServiceError(w, err, "Procedure", "Failed to delete procedure")
+		return
+	}
+	invalidateAgendas(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	_, err := config.DBClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-		TableName: aws.String("Procedures"),
-		Key: map[string]types.AttributeValue{
-			"ID": &types.AttributeValueMemberS{Value: id},
-		},
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-	})
+// RestoreProcedure godoc
+// @Summary Restore a deleted procedure
+// @Description Bring back a soft-deleted procedure
+// @Tags procedures
+// @Produce json
+// @Param id path string true "Procedure ID"
+// @Success 200 {object} models.Procedure
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to restore procedure"
+// @Router /api/v1/dental/procedure/{id}/restore [post]
+func RestoreProcedure(w http.ResponseWriter, r *http.Request) {
+	procedure, err := Procedures.Restore(r.Context(), mux.Vars(r)["id"])
 	if err != nil {
-		var cfe *types.ConditionalCheckFailedException
-		if errors.As(err, &cfe) {
-			http.Error(w, "Procedure not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Failed to delete procedure", http.StatusInternalServerError)
-		log.Printf("Error deleting procedure: %v", err)
+		writeServiceError(w, err, "Procedure", "Failed to restore procedure")
 		return
 	}
+	invalidateAgendas(r.Context())
 
-	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(procedure)
+}
+
+// localizeProcedures returns the procedures in the language preferred by the
+// request, falling back to the clinic language
+func localizeProcedures(w http.ResponseWriter, r *http.Request, procedures []models.Procedure) {
+	languages := i18n.Preferred(r)
+	for i := range procedures {
+		procedures[i].Localize(languages, i18n.Default())
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	if len(procedures) == 1 {
+		w.Header().Set("Content-Language", procedures[0].Language)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GetProcedurePriceHistory godoc
+// @Summary Get the price history of a procedure
+// @Description List every price version of a procedure with the date it takes effect, including scheduled future changes
+// @Tags procedures
+// @Produce json
+// @Param id path string true "Procedure ID"
+// @Success 200 {array} models.ProcedurePrice
+// @Failure 500 {object} apierror.Response "Failed to retrieve price history"
+// @Router /api/v1/dental/procedure/{id}/prices [get]
+func GetProcedurePriceHistory(w http.ResponseWriter, r *http.Request) {
+	procedureID := mux.Vars(r)["id"]
+
+	versions, err := pricing.History(r.Context(), procedureID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve price history", http.StatusInternalServerError)
+		log.Printf("Error retrieving price history: %v", err)
+		return
+	}
+	if versions == nil {
+		versions = []models.ProcedurePrice{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// ScheduleProcedurePrice godoc
+// @Summary Schedule a price change
+// @Description Record a new price for a procedure effective from a date (today or later). Earlier dates keep resolving to the price in force at the time.
+// @Tags procedures
+// @Accept json
+// @Produce json
+// @Param id path string true "Procedure ID"
+// @Param price body models.ProcedurePrice true "Price and effective_from date (YYYY-MM-DD)"
+// @Success 201 {object} models.ProcedurePrice
+// @Failure 400 {object} apierror.Response "Invalid request body, price or date"
+// @Failure 404 {object} apierror.Response "Procedure not found"
+// @Failure 500 {object} apierror.Response "Failed to schedule price"
+// @Router /api/v1/dental/procedure/{id}/prices [post]
+func ScheduleProcedurePrice(w http.ResponseWriter, r *http.Request) {
+	procedureID := mux.Vars(r)["id"]
+
+	var request models.ProcedurePrice
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.ProcedureID = procedureID
+	if request.EffectiveFrom == "" {
+		request.EffectiveFrom = time.Now().UTC().Format("2006-01-02")
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.EffectiveFrom < time.Now().UTC().Format("2006-01-02") {
+		http.Error(w, "effective_from must not be in the past", http.StatusBadRequest)
+		return
+	}
+
+	procedure, err := pricing.GetProcedure(r.Context(), procedureID)
+	if err != nil {
+		if errors.Is(err, pricing.ErrProcedureNotFound) {
+			http.Error(w, "Procedure not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to schedule price", http.StatusInternalServerError)
+		log.Printf("Error fetching procedure %s: %v", procedureID, err)
+		return
+	}
+
+	version, err := pricing.SchedulePrice(r.Context(), procedure, request.Price, request.EffectiveFrom)
+	if err != nil {
+		http.Error(w, "Failed to schedule price", http.StatusInternalServerError)
+		log.Printf("Error scheduling price of procedure %s: %v", procedureID, err)
+		return
+	}
+	invalidateAgendas(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(version)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/reminders"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// GetReminderSettings godoc
+// @Summary Get the SMS and WhatsApp reminder settings
+// @Description Get whether the clinic sends appointment reminders by SMS or WhatsApp, on which channel and how many hours before each appointment. Clinics that never configured them do not send them.
+// @Tags reminders
+// @Produce json
+// @Success 200 {object} models.ReminderSettings
+// @Failure 500 {object} apierror.Response "Failed to retrieve reminder settings"
+// @Router /api/v1/dental/reminders/settings [get]
+func GetReminderSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := reminders.GetSettings(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve reminder settings", http.StatusInternalServerError)
+		log.Printf("Error fetching reminder settings: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateReminderSettings godoc
+// @Summary Update the SMS and WhatsApp reminder settings
+// @Description Enable or disable the clinic's SMS or WhatsApp appointment reminders, choosing the channel (sms by default) and how many hours before each appointment they go out (1 to 168, 24 by default). The scheduler reminds each appointment once, again if it is moved, through SMS_PROVIDER; the text can be customized in the appointment_text_reminder notification template.
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param settings body models.ReminderSettings true "Reminder settings"
+// @Success 200 {object} models.ReminderSettings
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 500 {object} apierror.Response "Failed to save reminder settings"
+// @Router /api/v1/dental/reminders/settings [put]
+func UpdateReminderSettings(w http.ResponseWriter, r *http.Request) {
+	var settings models.ReminderSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings.ClinicID = config.ClinicID(r.Context())
+	if err := settings.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := reminders.SaveSettings(r.Context(), settings)
+	if err != nil {
+		http.Error(w, "Failed to save reminder settings", http.StatusInternalServerError)
+		log.Printf("Error saving reminder settings: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// GetReminderLog godoc
+// @Summary List the SMS and WhatsApp reminders sent
+// @Description List the clinic's SMS and WhatsApp appointment reminders, the latest first: sent (handed to the notification service, or its queue), failed, with the error, or skipped for patients without a phone number
+// @Tags reminders
+// @Produce json
+// @Param status query string false "Only reminders in this status: sent, failed or skipped"
+// @Param appointmentId query string false "Only reminders of this appointment"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Success 200 {array} models.ReminderLogEntry
+// @Failure 400 {object} apierror.Response "Invalid status or page"
+// @Failure 500 {object} apierror.Response "Failed to retrieve reminder log"
+// @Router /api/v1/dental/reminders/log [get]
+func GetReminderLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && !slices.Contains(models.ReminderStatuses, status) {
+		http.Error(w, "status must be one of "+strings.Join(models.ReminderStatuses, ", "), http.StatusBadRequest)
+		return
+	}
+	page := paging.Request(r)
+	entries, next, err := reminders.Log(r.Context(), config.ClinicID(r.Context()), status, query.Get("appointmentId"), page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve reminder log", http.StatusInternalServerError)
+		log.Printf("Error querying reminder log: %v", err)
+		return
+	}
+
+	paging.Write(w, page, entries, next)
+}
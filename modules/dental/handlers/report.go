@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const maxReportDays = 366
+
+// GetCapacityReport godoc
+// @Summary Get appointment capacity heatmap
+// @Description Get per-dentist, per-hour chair utilization (booked vs available minutes) for a date range. Available minutes come from each dentist's working hours, or the opening hours given for dentists without a schedule. Saturdays and Sundays, and the appointments on them, are left out unless weekends is set.
+// @Tags reports
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Param open query int false "Opening hour of dentists without a schedule (default 8)"
+// @Param close query int false "Closing hour of dentists without a schedule (default 18)"
+// @Param weekends query bool false "Count Saturdays and Sundays"
+// @Success 200 {object} models.CapacityReport
+// @Failure 400 {object} apierror.Response "Invalid date range or opening hours"
+// @Failure 500 {object} apierror.Response "Failed to build capacity report"
+// @Router /api/v1/dental/reports/capacity [get]
+func GetCapacityReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, to, err := parseReportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	openHour, closeHour := 8, 18
+	if v := query.Get("open"); v != "" {
+		if openHour, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid opening hour", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("close"); v != "" {
+		if closeHour, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid closing hour", http.StatusBadRequest)
+			return
+		}
+	}
+	if openHour < 0 || closeHour > 24 || openHour >= closeHour {
+		http.Error(w, "Opening hour must be before closing hour", http.StatusBadRequest)
+		return
+	}
+	includeWeekends := query.Get("weekends") == "true"
+
+	dentists, err := paging.ScanAll[models.Dentist](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Dentists"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build capacity report", http.StatusInternalServerError)
+		log.Printf("Error scanning dentists for capacity report: %v", err)
+		return
+	}
+
+	schedules, err := paging.ScanAll[models.DentistSchedule](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("DentistSchedules"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build capacity report", http.StatusInternalServerError)
+		log.Printf("Error scanning dentist schedules for capacity report: %v", err)
+		return
+	}
+
+	appointments, err := scanAppointmentsInRange(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to build capacity report", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments for capacity report: %v", err)
+		return
+	}
+
+	counted := func(day time.Time) bool {
+		return includeWeekends || (day.Weekday() != time.Saturday && day.Weekday() != time.Sunday)
+	}
+
+	// booked[dentistID][hour] = minutes
+	booked := make(map[string][]int)
+	names := make(map[string]string)
+	for _, dentist := range dentists {
+		booked[dentist.ID] = make([]int, 24)
+		names[dentist.ID] = dentist.Name
+	}
+
+	for _, appointment := range appointments {
+		if appointment.IsCancelled() {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil {
+			log.Printf("Skipping appointment %s in capacity report: %v", appointment.ID, err)
+			continue
+		}
+		if !counted(start) {
+			continue
+		}
+		if _, ok := booked[appointment.DentistID]; !ok {
+			booked[appointment.DentistID] = make([]int, 24)
+		}
+		addHourlyMinutes(booked[appointment.DentistID], start, start.Add(time.Duration(appointment.DurationMinutes())*time.Minute))
+	}
+
+	// working[dentistID][hour] = minutes of the dentist's working hours
+	byDentist := make(map[string]models.DentistSchedule, len(schedules))
+	for _, schedule := range schedules {
+		byDentist[schedule.DentistID] = schedule
+	}
+	working := make(map[string][]int, len(booked))
+	for dentistID := range booked {
+		schedule, ok := byDentist[dentistID]
+		if !ok {
+			schedule = clinicHours(dentistID, openHour, closeHour, includeWeekends)
+		}
+		working[dentistID] = make([]int, 24)
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			if !counted(day) {
+				continue
+			}
+			for _, period := range schedule.PeriodsOn(day) {
+				addHourlyMinutes(working[dentistID], period.Start, period.End)
+			}
+		}
+	}
+
+	report := models.CapacityReport{
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		OpenHour:  openHour,
+		CloseHour: closeHour,
+		Dentists:  []models.DentistCapacity{},
+	}
+
+	for dentistID, hours := range booked {
+		capacity := models.DentistCapacity{
+			DentistID:   dentistID,
+			DentistName: names[dentistID],
+		}
+		for hour := 0; hour < 24; hour++ {
+			available := working[dentistID][hour]
+			if available == 0 && hours[hour] == 0 {
+				continue
+			}
+			capacity.Hours = append(capacity.Hours, models.HourlyCapacity{
+				Hour:             hour,
+				BookedMinutes:    hours[hour],
+				AvailableMinutes: available,
+				Utilization:      utilization(hours[hour], available),
+			})
+			capacity.BookedMinutes += hours[hour]
+			capacity.AvailableMinutes += available
+		}
+		capacity.Utilization = utilization(capacity.BookedMinutes, capacity.AvailableMinutes)
+		report.Dentists = append(report.Dentists, capacity)
+	}
+
+	sort.Slice(report.Dentists, func(i, j int) bool {
+		return report.Dentists[i].DentistName < report.Dentists[j].DentistName
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// clinicHours is the schedule of a dentist without one: the opening hours
+// on weekdays, and on weekends too when they are counted
+func clinicHours(dentistID string, openHour, closeHour int, weekends bool) models.DentistSchedule {
+	schedule := models.ClinicSchedule(dentistID, openHour, closeHour)
+	if weekends {
+		for _, weekday := range []time.Weekday{time.Saturday, time.Sunday} {
+			schedule.Weekly = append(schedule.Weekly, models.WorkingHours{
+				Weekday: int(weekday),
+				Start:   fmt.Sprintf("%02d:00", openHour),
+				End:     fmt.Sprintf("%02d:00", closeHour),
+			})
+		}
+	}
+	return schedule
+}
+
+// addHourlyMinutes splits [start, end) across the hours of the day it spans
+func addHourlyMinutes(hours []int, start, end time.Time) {
+	for cursor := start; cursor.Before(end); {
+		hourEnd := cursor.Truncate(time.Hour).Add(time.Hour)
+		if hourEnd.After(end) {
+			hourEnd = end
+		}
+		hours[cursor.Hour()] += int(hourEnd.Sub(cursor).Minutes())
+		cursor = hourEnd
+	}
+}
+
+// utilization returns booked/available as a percentage rounded to two decimals
+func utilization(booked, available int) float64 {
+	if available == 0 {
+		return 0
+	}
+	return math.Round(float64(booked)/float64(available)*10000) / 100
+}
+
+// parseReportRange validates the from/to query parameters of report endpoints
+func parseReportRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	if fromStr == "" || toStr == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("from and to are required")
+	}
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+	}
+	to, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must not be before from")
+	}
+	if to.Sub(from) > maxReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range must not exceed 366 days")
+	}
+	return from, to, nil
+}
+
+// scanAppointmentsInRange reads appointments whose DateTime falls between
+// from and to (both inclusive dates)
+func scanAppointmentsInRange(ctx context.Context, from, to time.Time) ([]models.Appointment, error) {
+	return paging.ScanAll[models.Appointment](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Appointments"),
+		FilterExpression: aws.String("#dt >= :from AND #dt < :to"),
+		ExpressionAttributeNames: map[string]string{
+			"#dt": "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: from.Format("2006-01-02")},
+			":to":   &types.AttributeValueMemberS{Value: to.AddDate(0, 0, 1).Format("2006-01-02")},
+		},
+	})
+}
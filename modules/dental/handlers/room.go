@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateRoom godoc
+// @Summary Add a room
+// @Description Add a room of the clinic with the features it offers (e.g. xray, sedation). Procedures listing room features are only suggested at times when a room offering all of them is free.
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param room body models.Room true "Room data"
+// @Success 201 {object} models.Room
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 500 {object} apierror.Response "Failed to save room"
+// @Router /api/v1/dental/room [post]
+func CreateRoom(w http.ResponseWriter, r *http.Request) {
+	var room models.Room
+	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := room.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	room.ID = uuid.NewString()
+	room.ClinicID = ""
+	room.CreatedAt = now
+	room.UpdatedAt = now
+
+	if err := putRoom(r.Context(), room, "attribute_not_exists(ID)"); err != nil {
+		http.Error(w, "Failed to save room", http.StatusInternalServerError)
+		log.Printf("Error saving room: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(room)
+}
+
+// GetAllRooms godoc
+// @Summary Get the rooms
+// @Description Get the rooms of the clinic by name, optionally only the active ones or those offering a feature
+// @Tags rooms
+// @Produce json
+// @Param active query bool false "Only active rooms"
+// @Param feature query string false "Only rooms offering this feature"
+// @Success 200 {array} models.Room
+// @Failure 500 {object} apierror.Response "Failed to retrieve rooms"
+// @Router /api/v1/dental/room [get]
+func GetAllRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := scanRooms(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve rooms", http.StatusInternalServerError)
+		log.Printf("Error scanning rooms: %v", err)
+		return
+	}
+
+	query := r.URL.Query()
+	feature := strings.ToLower(strings.TrimSpace(query.Get("feature")))
+	result := []models.Room{}
+	for _, room := range rooms {
+		if query.Get("active") == "true" && !room.Active {
+			continue
+		}
+		if feature != "" && !room.Offers([]string{feature}) {
+			continue
+		}
+		result = append(result, room)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetRoomByID godoc
+// @Summary Get a room by ID
+// @Description Get a room of the clinic by its ID
+// @Tags rooms
+// @Produce json
+// @Param id path string true "Room ID"
+// @Success 200 {object} models.Room
+// @Failure 404 {object} apierror.Response "Room not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve room"
+// @Router /api/v1/dental/room/{id} [get]
+func GetRoomByID(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rooms, err := batchGetItems[models.Room](r.Context(), "Rooms", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to retrieve room", http.StatusInternalServerError)
+		log.Printf("Error fetching room %s: %v", id, err)
+		return
+	}
+	if len(rooms) == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rooms[0])
+}
+
+// UpdateRoom godoc
+// @Summary Update a room
+// @Description Replace the data of a room; inactive rooms are left out of slot suggestions
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param id path string true "Room ID"
+// @Param room body models.Room true "Room data"
+// @Success 200 {object} models.Room
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Room not found"
+// @Failure 500 {object} apierror.Response "Failed to update room"
+// @Router /api/v1/dental/room/{id} [put]
+func UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rooms, err := batchGetItems[models.Room](r.Context(), "Rooms", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to update room", http.StatusInternalServerError)
+		log.Printf("Error fetching room %s: %v", id, err)
+		return
+	}
+	if len(rooms) == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	var room models.Room
+	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := room.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	room.ID = rooms[0].ID
+	room.ClinicID = rooms[0].ClinicID
+	room.CreatedAt = rooms[0].CreatedAt
+	room.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	err = putRoom(r.Context(), room, "attribute_exists(ID)")
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update room", http.StatusInternalServerError)
+		log.Printf("Error updating room %s: %v", room.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(room)
+}
+
+// DeleteRoom godoc
+// @Summary Delete a room
+// @Description Remove a room of the clinic
+// @Tags rooms
+// @Param id path string true "Room ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Room not found"
+// @Failure 500 {object} apierror.Response "Failed to delete room"
+// @Router /api/v1/dental/room/{id} [delete]
+func DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Rooms"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete room", http.StatusInternalServerError)
+		log.Printf("Error deleting room %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scanRooms returns the rooms of the clinic sorted by name
+func scanRooms(ctx context.Context) ([]models.Room, error) {
+	rooms, err := paging.ScanAll[models.Room](ctx, &dynamodb.ScanInput{
+		TableName: aws.String("Rooms"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return strings.ToLower(rooms[i].Name) < strings.ToLower(rooms[j].Name)
+	})
+	return rooms, nil
+}
+
+func putRoom(ctx context.Context, room models.Room, condition string) error {
+	item, err := attributevalue.MarshalMap(room)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Rooms"),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+	})
+	return err
+}
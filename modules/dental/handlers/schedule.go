@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetDentistSchedule godoc
+// @Summary Get a dentist's working hours
+// @Description Get the weekly working hours and exceptions of a dentist. Dentists without a schedule work clinic hours, from CLINIC_OPEN_HOUR to CLINIC_CLOSE_HOUR on weekdays, which are returned instead.
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 200 {object} models.DentistSchedule
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve schedule"
+// @Router /api/v1/dental/dentist/{id}/schedule [get]
+func GetDentistSchedule(w http.ResponseWriter, r *http.Request) {
+	dentistID := mux.Vars(r)["id"]
+	exists, err := itemExists(r.Context(), "Dentists", dentistID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve schedule", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", dentistID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+
+	schedule, err := dentistSchedule(r.Context(), dentistID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve schedule", http.StatusInternalServerError)
+		log.Printf("Error fetching schedule of dentist %s: %v", dentistID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// SetDentistSchedule godoc
+// @Summary Set a dentist's working hours
+// @Description Define the weekly working hours of a dentist, one or more shifts per weekday (0 = Sunday), and the exceptions to them between two dates: without hours the dentist is off (vacations, days off), with hours the dentist works only those. Times are HH:MM in clinic time (UTC). Only these hours are offered for scheduling and appointments outside them are rejected.
+// @Tags dentists
+// @Accept json
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param schedule body models.DentistSchedule true "Weekly shifts and exceptions"
+// @Success 200 {object} models.DentistSchedule
+// @Failure 400 {object} apierror.Response "Invalid request body or hours"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to save schedule"
+// @Router /api/v1/dental/dentist/{id}/schedule [put]
+func SetDentistSchedule(w http.ResponseWriter, r *http.Request) {
+	dentistID := mux.Vars(r)["id"]
+	var schedule models.DentistSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	schedule.DentistID = dentistID
+	if err := schedule.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exists, err := itemExists(r.Context(), "Dentists", dentistID)
+	if err != nil {
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", dentistID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	schedule.CreatedAt = now
+	current, err := getDentistSchedule(r.Context(), dentistID)
+	if err != nil {
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+		log.Printf("Error fetching schedule of dentist %s: %v", dentistID, err)
+		return
+	}
+	if current != nil {
+		schedule.CreatedAt = current.CreatedAt
+	}
+	schedule.UpdatedAt = now
+
+	item, err := attributevalue.MarshalMap(schedule)
+	if err != nil {
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+		log.Printf("Error marshaling schedule: %v", err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("DentistSchedules"),
+		Item:      item,
+	}); err != nil {
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+		log.Printf("Error saving schedule: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// DeleteDentistSchedule godoc
+// @Summary Remove a dentist's working hours
+// @Description Remove the schedule of a dentist, who then works clinic hours again
+// @Tags dentists
+// @Param id path string true "Dentist ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Schedule not found"
+// @Failure 500 {object} apierror.Response "Failed to delete schedule"
+// @Router /api/v1/dental/dentist/{id}/schedule [delete]
+func DeleteDentistSchedule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("DentistSchedules"),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: mux.Vars(r)["id"]},
+		},
+		ConditionExpression: aws.String("attribute_exists(DentistID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Schedule not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete schedule", http.StatusInternalServerError)
+		log.Printf("Error deleting schedule: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDentistAvailability godoc
+// @Summary Get a dentist's free slots on a date
+// @Description Get the periods the dentist works on a date and the start times at which an appointment of the given duration fits, outside other appointments and agenda blocks. Times are in clinic time (UTC).
+// @Tags dentists
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param date query string false "Date (YYYY-MM-DD, default today)"
+// @Param duration query int false "Appointment length in minutes (default 30)"
+// @Success 200 {object} models.DentistAvailability
+// @Failure 400 {object} apierror.Response "Invalid date or duration"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve availability"
+// @Router /api/v1/dental/dentist/{id}/availability [get]
+func GetDentistAvailability(w http.ResponseWriter, r *http.Request) {
+	dentistID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	if s := query.Get("date"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			http.Error(w, "date must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		day = parsed
+	}
+	duration := int(slotStep / time.Minute)
+	if s := query.Get("duration"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 24*60 {
+			http.Error(w, "duration must be a positive number of minutes", http.StatusBadRequest)
+			return
+		}
+		duration = n
+	}
+
+	exists, err := itemExists(r.Context(), "Dentists", dentistID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve availability", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", dentistID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+
+	schedule, err := dentistSchedule(r.Context(), dentistID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve availability", http.StatusInternalServerError)
+		log.Printf("Error fetching schedule of dentist %s: %v", dentistID, err)
+		return
+	}
+	slots, err := availableSlots(r.Context(), dentistID, day, day, duration, "")
+	if err != nil {
+		http.Error(w, "Failed to retrieve availability", http.StatusInternalServerError)
+		log.Printf("Error listing slots of dentist %s: %v", dentistID, err)
+		return
+	}
+	availability := models.DentistAvailability{
+		DentistID: dentistID,
+		Date:      day.Format("2006-01-02"),
+		Duration:  duration,
+		Periods:   schedule.PeriodsOn(day),
+		Slots:     slots,
+	}
+	if availability.Periods == nil {
+		availability.Periods = []models.WorkingPeriod{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(availability)
+}
+
+// checkDentistAvailability rejects appointments outside the dentist's working
+// hours, overlapping one of the dentist's agenda blocks or the dentist's time
+// at another linked clinic with 422. Other appointments of the clinic are not
+// checked, since the staff may double-book on purpose.
+// It returns false when the response was written.
+func checkDentistAvailability(w http.ResponseWriter, r *http.Request, appointment models.Appointment) bool {
+	if appointment.DentistID == "" || appointment.IsCancelled() {
+		return true
+	}
+	start, err := appointment.StartTime()
+	if err != nil {
+		return true
+	}
+	start = start.UTC()
+	end := start.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+
+	schedule, err := dentistSchedule(r.Context(), appointment.DentistID)
+	if err != nil {
+		http.Error(w, "Failed to check dentist availability", http.StatusInternalServerError)
+		log.Printf("Error fetching schedule of dentist %s: %v", appointment.DentistID, err)
+		return false
+	}
+	if !schedule.Covers(start, end) {
+		http.Error(w, fmt.Sprintf("Dentist does not work at %s; see /api/v1/dental/dentist/%s/availability", start.Format(slotLayout), appointment.DentistID), http.StatusUnprocessableEntity)
+		return false
+	}
+
+	blocks, err := scanUnavailability(r.Context(), appointment.DentistID, start, end)
+	if err != nil {
+		http.Error(w, "Failed to check dentist availability", http.StatusInternalServerError)
+		log.Printf("Error fetching agenda blocks of dentist %s: %v", appointment.DentistID, err)
+		return false
+	}
+	if len(blocks) > 0 {
+		http.Error(w, fmt.Sprintf("Dentist is unavailable at %s", start.Format(slotLayout)), http.StatusUnprocessableEntity)
+		return false
+	}
+
+	elsewhere, err := busyElsewhere(r.Context(), appointment.DentistID, start, end)
+	if err != nil {
+		http.Error(w, "Failed to check dentist availability", http.StatusInternalServerError)
+		log.Printf("Error fetching agenda of dentist %s at other clinics: %v", appointment.DentistID, err)
+		return false
+	}
+	if len(elsewhere) > 0 {
+		http.Error(w, fmt.Sprintf("Dentist is booked at another clinic at %s", start.Format(slotLayout)), http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
+
+// dentistSchedule returns the working hours of a dentist, which are clinic
+// hours for dentists without a schedule
+func dentistSchedule(ctx context.Context, dentistID string) (models.DentistSchedule, error) {
+	schedule, err := getDentistSchedule(ctx, dentistID)
+	if err != nil {
+		return models.DentistSchedule{}, err
+	}
+	if schedule == nil {
+		return models.ClinicSchedule(dentistID, config.EnvInt("CLINIC_OPEN_HOUR", 8), config.EnvInt("CLINIC_CLOSE_HOUR", 18)), nil
+	}
+	return *schedule, nil
+}
+
+func getDentistSchedule(ctx context.Context, dentistID string) (*models.DentistSchedule, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("DentistSchedules"),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: dentistID},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var schedule models.DentistSchedule
+	if err := attributevalue.UnmarshalMap(result.Item, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/selfservice"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// SelfServiceScope scopes the self-service requests to the clinic the link
+// was signed for, since patients following it are not logged in
+func SelfServiceScope(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clinicID, err := selfservice.Clinic(mux.Vars(r)["token"])
+		if err != nil {
+			// The handler verifies the link again and rejects it
+			next(w, r)
+			return
+		}
+		next(w, r.WithContext(config.WithClinic(r.Context(), clinicID)))
+	}
+}
+
+// GetSelfServiceAppointment godoc
+// @Summary Get the appointment behind a reminder link
+// @Description Public endpoint behind the link sent in appointment reminders. The link is signed, expires when the appointment starts and stops working once the appointment is moved.
+// @Tags self-service
+// @Produce json
+// @Param token path string true "Token from the reminder link"
+// @Success 200 {object} models.SelfServiceAppointment
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Failure 500 {object} apierror.Response "Failed to retrieve appointment"
+// @Router /api/v1/dental/self-service/{token} [get]
+func GetSelfServiceAppointment(w http.ResponseWriter, r *http.Request) {
+	appointment, ok := selfServiceAppointment(w, r)
+	if !ok {
+		return
+	}
+
+	public, err := publicAppointment(r, appointment)
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error describing appointment %s: %v", appointment.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
+
+// ConfirmSelfServiceAppointment godoc
+// @Summary Confirm an appointment from a reminder link
+// @Description Public endpoint the patient uses to confirm attendance. The change goes through the same validation as staff edits.
+// @Tags self-service
+// @Produce json
+// @Param token path string true "Token from the reminder link"
+// @Success 200 {object} models.SelfServiceAppointment
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 409 {object} apierror.Response "Appointment can no longer be changed"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
+// @Router /api/v1/dental/self-service/{token}/confirm [post]
+func ConfirmSelfServiceAppointment(w http.ResponseWriter, r *http.Request) {
+	changeSelfServiceStatus(w, r, models.AppointmentStatusConfirmed)
+}
+
+// CancelSelfServiceAppointment godoc
+// @Summary Cancel an appointment from a reminder link
+// @Description Public endpoint the patient uses to cancel. The change goes through the same validation as staff edits and frees the slot.
+// @Tags self-service
+// @Produce json
+// @Param token path string true "Token from the reminder link"
+// @Success 200 {object} models.SelfServiceAppointment
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 409 {object} apierror.Response "Appointment can no longer be changed"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
+// @Router /api/v1/dental/self-service/{token}/cancel [post]
+func CancelSelfServiceAppointment(w http.ResponseWriter, r *http.Request) {
+	changeSelfServiceStatus(w, r, models.AppointmentStatusCancelled)
+}
+
+// GetSelfServiceSlots godoc
+// @Summary List slots an appointment can be moved to
+// @Description Public endpoint listing the dentist's free start times, within clinic hours, for an appointment of the same duration
+// @Tags self-service
+// @Produce json
+// @Param token path string true "Token from the reminder link"
+// @Param from query string false "First day (YYYY-MM-DD), defaults to today"
+// @Param days query int false "Number of days to list, up to 30 (default 7)"
+// @Success 200 {object} models.SelfServiceSlots
+// @Failure 400 {object} apierror.Response "Invalid from or days"
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 409 {object} apierror.Response "Appointment can no longer be changed"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Failure 500 {object} apierror.Response "Failed to list slots"
+// @Router /api/v1/dental/self-service/{token}/slots [get]
+func GetSelfServiceSlots(w http.ResponseWriter, r *http.Request) {
+	appointment, ok := selfServiceAppointment(w, r)
+	if !ok {
+		return
+	}
+	if !selfServiceChangeable(w, appointment) {
+		return
+	}
+
+	from, to, ok := slotRange(w, r)
+	if !ok {
+		return
+	}
+
+	slots, err := availableSlots(r.Context(), appointment.DentistID, from, to, appointment.DurationMinutes(), appointment.ID)
+	if err != nil {
+		http.Error(w, "Failed to list slots", http.StatusInternalServerError)
+		log.Printf("Error listing slots for appointment %s: %v", appointment.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SelfServiceSlots{
+		From:  from.Format("2006-01-02"),
+		To:    to.Format("2006-01-02"),
+		Slots: slots,
+	})
+}
+
+// RescheduleSelfServiceAppointment godoc
+// @Summary Move an appointment from a reminder link
+// @Description Public endpoint moving the appointment to one of the free slots. The change goes through the same validation as staff edits; the old link stops working and the response carries a new one.
+// @Tags self-service
+// @Accept json
+// @Produce json
+// @Param token path string true "Token from the reminder link"
+// @Param reschedule body models.RescheduleRequest true "New date and time, one of the listed slots"
+// @Success 200 {object} models.SelfServiceAppointment
+// @Failure 400 {object} apierror.Response "Invalid request body"
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 409 {object} apierror.Response "Slot not available or appointment can no longer be changed"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Failure 500 {object} apierror.Response "Failed to update appointment"
+// @Router /api/v1/dental/self-service/{token}/reschedule [post]
+func RescheduleSelfServiceAppointment(w http.ResponseWriter, r *http.Request) {
+	var request models.RescheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := request.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	appointment, ok := selfServiceAppointment(w, r)
+	if !ok {
+		return
+	}
+	if !selfServiceChangeable(w, appointment) {
+		return
+	}
+
+	if _, err := (&models.Appointment{DateTime: request.DateTime}).StartTime(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	available, err := slotAvailable(r.Context(), appointment, request.DateTime)
+	if err != nil {
+		http.Error(w, "Failed to update appointment", http.StatusInternalServerError)
+		log.Printf("Error checking slot for appointment %s: %v", appointment.ID, err)
+		return
+	}
+	if !available {
+		http.Error(w, "Slot not available", http.StatusConflict)
+		return
+	}
+
+	previous := appointment
+	appointment.DateTime = request.DateTime
+	appointment.Status = models.AppointmentStatusScheduled
+	if !saveAppointmentChange(w, r, previous, &appointment) {
+		return
+	}
+
+	public, err := publicAppointment(r, appointment)
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error describing appointment %s: %v", appointment.ID, err)
+		return
+	}
+	token, err := selfservice.Token(appointment)
+	if err != nil {
+		log.Printf("Error signing link of appointment %s: %v", appointment.ID, err)
+	} else {
+		public.Link = selfservice.Link(token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
+
+// changeSelfServiceStatus confirms or cancels the appointment behind a link
+func changeSelfServiceStatus(w http.ResponseWriter, r *http.Request, status string) {
+	appointment, ok := selfServiceAppointment(w, r)
+	if !ok {
+		return
+	}
+	if !selfServiceChangeable(w, appointment) {
+		return
+	}
+
+	if appointment.Status != status {
+		previous := appointment
+		appointment.Status = status
+		if !saveAppointmentChange(w, r, previous, &appointment) {
+			return
+		}
+	}
+
+	public, err := publicAppointment(r, appointment)
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error describing appointment %s: %v", appointment.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
+
+// selfServiceAppointment verifies the link token and loads its appointment.
+// Links issued for another date and time than the current one no longer
+// work. It returns false when the error response was written.
+func selfServiceAppointment(w http.ResponseWriter, r *http.Request) (models.Appointment, bool) {
+	id, dateTime, err := selfservice.Verify(mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, selfservice.ErrExpiredLink) {
+			http.Error(w, "Link expired", http.StatusGone)
+			return models.Appointment{}, false
+		}
+		http.Error(w, "Invalid link", http.StatusForbidden)
+		return models.Appointment{}, false
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Appointments"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error fetching appointment with ID %s: %v", id, err)
+		return models.Appointment{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Link expired", http.StatusGone)
+		return models.Appointment{}, false
+	}
+
+	var appointment models.Appointment
+	if err := attributevalue.UnmarshalMap(result.Item, &appointment); err != nil {
+		http.Error(w, "Failed to retrieve appointment", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling appointment data: %v", err)
+		return models.Appointment{}, false
+	}
+	if appointment.DateTime != dateTime {
+		http.Error(w, "Link expired", http.StatusGone)
+		return models.Appointment{}, false
+	}
+	return appointment, true
+}
+
+// selfServiceChangeable rejects changes to appointments that were cancelled,
+// completed or missed; those are handled by the clinic
+func selfServiceChangeable(w http.ResponseWriter, appointment models.Appointment) bool {
+	if appointment.Status == models.AppointmentStatusScheduled || appointment.Status == models.AppointmentStatusConfirmed {
+		return true
+	}
+	http.Error(w, "Appointment can no longer be changed", http.StatusConflict)
+	return false
+}
+
+// publicAppointment describes an appointment to the patient, without
+// internal IDs or notes
+func publicAppointment(r *http.Request, appointment models.Appointment) (models.SelfServiceAppointment, error) {
+	public := models.SelfServiceAppointment{
+		DateTime: appointment.DateTime,
+		Duration: appointment.DurationMinutes(),
+		Status:   appointment.Status,
+	}
+
+	dentists, err := batchGetItems[models.Dentist](r.Context(), "Dentists", []string{appointment.DentistID})
+	if err != nil {
+		return public, err
+	}
+	if len(dentists) > 0 {
+		public.DentistName = dentists[0].Name
+	}
+
+	if appointment.ProcedureID != "" {
+		procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", []string{appointment.ProcedureID})
+		if err != nil {
+			return public, err
+		}
+		if len(procedures) > 0 {
+			public.ProcedureName = procedures[0].Name
+		}
+	}
+	return public, nil
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/repository"
+	"dental-saas/modules/dental/service"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Dentists, Patients, Procedures and Appointments are the services behind
+// the handlers of those entities. They store records in DynamoDB by default;
+// tests and alternate backends replace them before the router serves
+// requests.
+var (
+	Dentists     service.DentistService     = service.NewDentistService(repository.DynamoDentists{})
+	Patients     service.PatientService     = service.NewPatientService(repository.DynamoPatients{})
+	Procedures   service.ProcedureService   = service.NewProcedureService(repository.DynamoProcedures{})
+	Appointments service.AppointmentService = service.NewAppointmentService(repository.DynamoAppointments{})
+)
+
+// ClinicalNotes stores the clinical notes behind their handlers, in DynamoDB
+// by default and replaced like the services above
+var ClinicalNotes repository.ClinicalNoteRepository = repository.DynamoClinicalNotes{}
+
+// writeServiceError writes the response for an error returned by a service:
+// 400 for validation errors, 404 and 409 for missing and duplicate records
+// of the entity, and failure (logged) otherwise
+func writeServiceError(w http.ResponseWriter, err error, entity, failure string) {
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		http.Error(w, validation.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, entity+" not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrAlreadyExists):
+		http.Error(w, entity+" with this ID already exists", http.StatusConflict)
+	default:
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("%s: %v", failure, err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"dental-saas/modules/compliance/checklist"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxStatsDays = 92
+
+// GetDashboardStats godoc
+// @Summary Get dashboard counters
+// @Description Get the number of patients and of appointments per day from the sharded counters, without scanning the tables, and today's open and close checklists for the reception
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD), defaults to today"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive, defaults to 6 days after from"
+// @Success 200 {object} models.DashboardStats
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 500 {object} apierror.Response "Failed to retrieve dashboard stats"
+// @Router /api/v1/dental/stats [get]
+func GetDashboardStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	to := from.AddDate(0, 0, 6)
+	if query.Get("from") != "" || query.Get("to") != "" {
+		var err error
+		from, to, err = parseReportRange(query.Get("from"), query.Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Sub(from) > maxStatsDays*24*time.Hour {
+		http.Error(w, "date range must not exceed 92 days", http.StatusBadRequest)
+		return
+	}
+
+	patients, err := counters.Get(r.Context(), counters.PatientsCounter(config.ClinicID(r.Context())))
+	if err != nil {
+		http.Error(w, "Failed to retrieve dashboard stats", http.StatusInternalServerError)
+		log.Printf("Error reading patients counter: %v", err)
+		return
+	}
+
+	stats := models.DashboardStats{Patients: patients}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		count, err := counters.Get(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), date))
+		if err != nil {
+			http.Error(w, "Failed to retrieve dashboard stats", http.StatusInternalServerError)
+			log.Printf("Error reading appointments counter for %s: %v", date, err)
+			return
+		}
+		stats.AppointmentsPerDay = append(stats.AppointmentsPerDay, models.DailyCount{Date: date, Count: count})
+	}
+
+	// The checklists are a convenience for the reception; the counters are still served without them
+	if report, err := checklist.Report(r.Context(), time.Now().UTC(), ""); err != nil {
+		log.Printf("Error building checklist report for dashboard: %v", err)
+	} else {
+		stats.Checklists = &report
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// wantsStream reports whether the client asked for an NDJSON stream via ?stream=true
+func wantsStream(r *http.Request) bool {
+	return r.URL.Query().Get("stream") == "true"
+}
+
+// streamList writes every item of a list as newline-delimited JSON, one page
+// of list at a time, so memory stays bounded by the page size. list is the
+// List of the entity's service, so the stream reads through the repository
+// like the paginated list does. pageHook, when set, can enrich each page
+// before it is written. Errors after the first line has been sent are
+// reported as a final {"error": "..."} line since the status code can no
+// longer change.
+func streamList[T any](w http.ResponseWriter, r *http.Request, entity string, list func(context.Context, paging.Page) ([]T, string, error), pageHook func(context.Context, []T) error) {
+	ctx := r.Context()
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+
+	fail := func(err error) {
+		log.Printf("Error streaming %s: %v", entity, err)
+		if !started {
+			http.Error(w, "Failed to retrieve items", http.StatusInternalServerError)
+			return
+		}
+		encoder.Encode(map[string]string{"error": "stream interrupted"})
+	}
+
+	page := paging.Page{}
+	for {
+		items, next, err := list(ctx, page)
+		if err != nil {
+			fail(err)
+			return
+		}
+		if pageHook != nil {
+			if err := pageHook(ctx, items); err != nil {
+				fail(err)
+				return
+			}
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		for _, v := range items {
+			if err := encoder.Encode(v); err != nil {
+				// client went away
+				log.Printf("Error writing %s stream: %v", entity, err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if next == "" {
+			return
+		}
+		page.Token = next
+	}
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// defaultSuggestions and maxSuggestions bound how many slots are suggested
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+	// suggestionsPerDay is how many slots of the same dentist and day are
+	// suggested at most, so the list offers real alternatives
+	suggestionsPerDay = 2
+)
+
+// Points each criterion adds to a suggestion's score, 100 in all
+const (
+	soonPoints            = 35 // the earliest slot of the range gets all of them
+	preferredPeriodPoints = 20
+	preferredDayPoints    = 10
+	usualPeriodPoints     = 15 // times the share of past visits in the period
+	usualDayPoints        = 10 // times the share of past visits on the weekday
+	usualDentistPoints    = 10
+)
+
+// SuggestAppointmentSlots godoc
+// @Summary Suggest appointment slots
+// @Description Rank the free slots for a patient and procedure. Slots are those of the dentists credentialed for the procedure, within their working hours and clear of their appointments and unavailability and of the patient's other appointments, keeping the procedure's buffer_minutes free after each appointment. Procedures listing room_features are only suggested when an active room offering them all is free; appointments whose procedure needs features some of those rooms offer are counted against them. Sooner slots rank higher, then those matching the preferences and the times, weekdays and dentist of the patient's completed appointments. At most two slots per dentist and day are suggested.
+// @Tags appointments
+// @Produce json
+// @Param patientId query string true "Patient ID"
+// @Param procedureId query string true "Procedure ID"
+// @Param preferences query string false "Comma-separated periods (morning, afternoon, evening) and weekdays (monday or mon...)"
+// @Param dentistId query string false "Only this dentist"
+// @Param from query string false "First day (YYYY-MM-DD), defaults to today"
+// @Param days query int false "Number of days to search, up to 30 (default 7)"
+// @Param max query int false "Number of suggestions, up to 50 (default 10)"
+// @Success 200 {object} models.SlotSuggestions
+// @Failure 400 {object} apierror.Response "Missing patient or procedure, or invalid preferences, range or max"
+// @Failure 404 {object} apierror.Response "Patient or procedure not found"
+// @Failure 422 {object} apierror.Response "No active room offers the features the procedure requires"
+// @Failure 500 {object} apierror.Response "Failed to suggest slots"
+// @Router /api/v1/dental/appointment/suggest [get]
+func SuggestAppointmentSlots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	patientID, procedureID := query.Get("patientId"), query.Get("procedureId")
+	if patientID == "" || procedureID == "" {
+		http.Error(w, "patientId and procedureId are required", http.StatusBadRequest)
+		return
+	}
+	preferences, err := models.ParseSlotPreferences(query.Get("preferences"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	max := defaultSuggestions
+	if s := query.Get("max"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSuggestions {
+			http.Error(w, fmt.Sprintf("max must be between 1 and %d", maxSuggestions), http.StatusBadRequest)
+			return
+		}
+		max = n
+	}
+	from, to, ok := slotRange(w, r)
+	if !ok {
+		return
+	}
+
+	patient, err := getPatient(r, patientID)
+	if err != nil {
+		http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s: %v", patientID, err)
+		return
+	}
+	if patient == nil {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+	catalog, err := paging.ScanAll[models.Procedure](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Procedures"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+		log.Printf("Error scanning procedures: %v", err)
+		return
+	}
+	procedures := make(map[string]models.Procedure, len(catalog))
+	for _, procedure := range catalog {
+		procedures[procedure.ID] = procedure
+	}
+	procedure, ok := procedures[procedureID]
+	if !ok {
+		http.Error(w, "Procedure not found", http.StatusNotFound)
+		return
+	}
+
+	rooms, err := scanRooms(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+		log.Printf("Error scanning rooms: %v", err)
+		return
+	}
+	var suitable []models.Room
+	for _, room := range rooms {
+		if room.Active && room.Offers(procedure.RoomFeatures) {
+			suitable = append(suitable, room)
+		}
+	}
+	if len(procedure.RoomFeatures) > 0 && len(suitable) == 0 {
+		http.Error(w, "No active room offers the features the procedure requires", http.StatusUnprocessableEntity)
+		return
+	}
+
+	appointments, err := scanAppointmentsInRange(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments: %v", err)
+		return
+	}
+	history, err := queryItems[models.Appointment](r.Context(), &dynamodb.QueryInput{
+		TableName:              aws.String("Appointments"),
+		IndexName:              aws.String(config.AppointmentsByPatientIndex),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+		log.Printf("Error querying appointments of patient %s: %v", patientID, err)
+		return
+	}
+	usual := patientHabits(history)
+	var booked []busyPeriod
+	for _, appointment := range history {
+		if start, err := appointment.StartTime(); err == nil && !appointment.IsCancelled() {
+			booked = append(booked, busyPeriod{start, start.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)})
+		}
+	}
+
+	dentists, err := paging.ScanAll[models.Dentist](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Dentists"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+		log.Printf("Error scanning dentists: %v", err)
+		return
+	}
+
+	buffer := func(appointment models.Appointment) time.Duration {
+		return time.Duration(procedures[appointment.ProcedureID].BufferMinutes) * time.Minute
+	}
+	rules := slotRules{
+		buffer: buffer,
+		after:  time.Duration(procedure.BufferMinutes) * time.Minute,
+	}
+	if len(procedure.RoomFeatures) > 0 {
+		rules.roomFree = func(start, end time.Time) bool {
+			used := 0
+			for _, appointment := range appointments {
+				if appointment.IsCancelled() {
+					continue
+				}
+				features := procedures[appointment.ProcedureID].RoomFeatures
+				if len(features) == 0 || !anyRoomOffers(suitable, features) {
+					continue
+				}
+				begin, err := appointment.StartTime()
+				if err != nil {
+					continue
+				}
+				finish := begin.Add(time.Duration(appointment.DurationMinutes())*time.Minute + buffer(appointment))
+				if start.Before(finish) && begin.Before(end) {
+					used++
+				}
+			}
+			return used < len(suitable)
+		}
+	}
+
+	duration := (&models.Appointment{Duration: procedure.Duration}).DurationMinutes()
+	span := to.Sub(from).Hours()/24 + 1
+	var candidates []models.SlotSuggestion
+	for _, dentist := range dentists {
+		if id := query.Get("dentistId"); id != "" && dentist.ID != id {
+			continue
+		}
+		if !dentist.Performs(procedureID) {
+			continue
+		}
+		slots, err := freeSlots(r.Context(), dentist.ID, appointments, from, to, duration, "", rules)
+		if err != nil {
+			http.Error(w, "Failed to suggest slots", http.StatusInternalServerError)
+			log.Printf("Error listing slots of dentist %s: %v", dentist.ID, err)
+			return
+		}
+		for _, slot := range slots {
+			start, err := time.Parse(slotLayout, slot)
+			if err != nil || overlapsAny(booked, start, start.Add(time.Duration(duration)*time.Minute)) {
+				continue
+			}
+			suggestion := models.SlotSuggestion{DentistID: dentist.ID, DentistName: dentist.Name, DateTime: slot}
+			scoreSlot(&suggestion, start, from, span, preferences, usual)
+			candidates = append(candidates, suggestion)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].DateTime != candidates[j].DateTime {
+			return candidates[i].DateTime < candidates[j].DateTime
+		}
+		return candidates[i].DentistName < candidates[j].DentistName
+	})
+	result := models.SlotSuggestions{
+		PatientID:    patientID,
+		ProcedureID:  procedureID,
+		Duration:     duration,
+		Buffer:       procedure.BufferMinutes,
+		RoomFeatures: procedure.RoomFeatures,
+		From:         from.Format("2006-01-02"),
+		To:           to.Format("2006-01-02"),
+		Preferences:  preferences,
+		History:      usual.visits,
+		Suggestions:  []models.SlotSuggestion{},
+	}
+	perDay := map[string]int{}
+	for _, candidate := range candidates {
+		if len(result.Suggestions) == max {
+			break
+		}
+		key := candidate.DentistID + "|" + candidate.DateTime[:10]
+		if perDay[key] == suggestionsPerDay {
+			continue
+		}
+		perDay[key]++
+		result.Suggestions = append(result.Suggestions, candidate)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// habits summarizes when and with whom a patient has come in
+type habits struct {
+	visits   int
+	periods  map[string]int
+	weekdays map[time.Weekday]int
+	dentist  string // the one seen most often
+}
+
+// patientHabits reads the habits of a patient from the completed appointments
+func patientHabits(appointments []models.Appointment) habits {
+	h := habits{periods: map[string]int{}, weekdays: map[time.Weekday]int{}}
+	dentists := map[string]int{}
+	for _, appointment := range appointments {
+		if appointment.Status != models.AppointmentStatusCompleted {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		h.visits++
+		h.periods[models.DayPeriod(start)]++
+		h.weekdays[start.Weekday()]++
+		dentists[appointment.DentistID]++
+		if dentists[appointment.DentistID] > dentists[h.dentist] {
+			h.dentist = appointment.DentistID
+		}
+	}
+	return h
+}
+
+// scoreSlot fills the score of a suggestion starting at start, and the
+// reasons behind it
+func scoreSlot(suggestion *models.SlotSuggestion, start, from time.Time, span float64, preferences models.SlotPreferences, h habits) {
+	period := models.DayPeriod(start)
+	day := math.Floor(start.Sub(from).Hours() / 24)
+	score := soonPoints * (1 - day/span)
+	reasons := []string{}
+	if day == 0 {
+		reasons = append(reasons, "available on the first day searched")
+	}
+
+	if preferences.HasPeriod(period) {
+		score += preferredPeriodPoints
+		reasons = append(reasons, "in the preferred "+period)
+	}
+	if preferences.HasWeekday(start.Weekday()) {
+		score += preferredDayPoints
+		reasons = append(reasons, "on a preferred day")
+	}
+	if h.visits > 0 {
+		periodShare := float64(h.periods[period]) / float64(h.visits)
+		dayShare := float64(h.weekdays[start.Weekday()]) / float64(h.visits)
+		score += usualPeriodPoints*periodShare + usualDayPoints*dayShare
+		if periodShare >= 0.5 {
+			reasons = append(reasons, "the patient usually comes in the "+period)
+		}
+		if dayShare >= 0.5 {
+			reasons = append(reasons, "the patient usually comes on "+start.Weekday().String())
+		}
+		if suggestion.DentistID == h.dentist {
+			score += usualDentistPoints
+			reasons = append(reasons, "the patient's usual dentist")
+		}
+	}
+
+	suggestion.Score = math.Round(score*10) / 10
+	suggestion.Reasons = reasons
+}
+
+// overlapsAny reports whether start to end overlaps one of the periods
+func overlapsAny(periods []busyPeriod, start, end time.Time) bool {
+	for _, p := range periods {
+		if start.Before(p.end) && p.start.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyRoomOffers reports whether one of the rooms offers all the features
+func anyRoomOffers(rooms []models.Room, features []string) bool {
+	for _, room := range rooms {
+		if room.Offers(features) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/survey"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SurveyScope scopes the public survey requests to the clinic of the survey
+// behind the link, since patients answering it are not logged in
+func SurveyScope(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The token identifies the survey on its own, whatever its clinic
+		s, err := survey.ByToken(config.AllClinics(r.Context()), mux.Vars(r)["token"])
+		if err != nil {
+			// The handler looks the survey up again and reports the error
+			next(w, r)
+			return
+		}
+		clinicID := s.ClinicID
+		if clinicID == "" {
+			clinicID = config.DefaultClinicID
+		}
+		next(w, r.WithContext(config.WithClinic(r.Context(), clinicID)))
+	}
+}
+
+// GetSurvey godoc
+// @Summary Get a satisfaction survey
+// @Description Public endpoint behind the link sent to patients after a completed appointment. Returns what the survey page shows and whether it was already answered.
+// @Tags surveys
+// @Produce json
+// @Param token path string true "Survey token from the link"
+// @Success 200 {object} models.PublicSurvey
+// @Failure 404 {object} apierror.Response "Survey not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve survey"
+// @Router /api/v1/dental/survey/{token} [get]
+func GetSurvey(w http.ResponseWriter, r *http.Request) {
+	s, err := survey.ByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, survey.ErrSurveyNotFound) {
+			http.Error(w, "Survey not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve survey", http.StatusInternalServerError)
+		log.Printf("Error fetching survey: %v", err)
+		return
+	}
+
+	public := models.PublicSurvey{Answered: s.RespondedAt != ""}
+
+	appointments, err := batchGetItems[models.Appointment](r.Context(), "Appointments", []string{s.AppointmentID})
+	if err != nil {
+		http.Error(w, "Failed to retrieve survey", http.StatusInternalServerError)
+		log.Printf("Error fetching appointment %s of survey: %v", s.AppointmentID, err)
+		return
+	}
+	if len(appointments) > 0 {
+		public.AppointmentDate = appointments[0].DateTime
+	}
+
+	dentists, err := batchGetItems[models.Dentist](r.Context(), "Dentists", []string{s.DentistID})
+	if err != nil {
+		http.Error(w, "Failed to retrieve survey", http.StatusInternalServerError)
+		log.Printf("Error fetching dentist %s of survey: %v", s.DentistID, err)
+		return
+	}
+	if len(dentists) > 0 {
+		public.DentistName = dentists[0].Name
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
+
+// RespondToSurvey godoc
+// @Summary Answer a satisfaction survey
+// @Description Public endpoint recording the patient's 0-10 score and optional comment. Detractors (0-6) who leave a comment are flagged for follow-up.
+// @Tags surveys
+// @Accept json
+// @Param token path string true "Survey token from the link"
+// @Param response body models.SurveyResponse true "Score and comment"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Response "Invalid request body or score"
+// @Failure 404 {object} apierror.Response "Survey not found"
+// @Failure 409 {object} apierror.Response "Survey already answered"
+// @Failure 500 {object} apierror.Response "Failed to save survey response"
+// @Router /api/v1/dental/survey/{token}/response [post]
+func RespondToSurvey(w http.ResponseWriter, r *http.Request) {
+	var response models.SurveyResponse
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := response.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := survey.Respond(r.Context(), mux.Vars(r)["token"], response); err != nil {
+		switch {
+		case errors.Is(err, survey.ErrSurveyNotFound):
+			http.Error(w, "Survey not found", http.StatusNotFound)
+		case errors.Is(err, survey.ErrAlreadyAnswered):
+			http.Error(w, "Survey already answered", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to save survey response", http.StatusInternalServerError)
+			log.Printf("Error saving survey response: %v", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSurveyFollowUps godoc
+// @Summary List detractor comments flagged for follow-up
+// @Description List survey responses from detractors who left a comment, oldest first
+// @Tags surveys
+// @Produce json
+// @Param status query string false "open (default) or resolved"
+// @Success 200 {array} models.Survey
+// @Failure 400 {object} apierror.Response "Invalid status"
+// @Failure 500 {object} apierror.Response "Failed to retrieve follow-ups"
+// @Router /api/v1/dental/survey/follow-ups [get]
+func GetSurveyFollowUps(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.FollowUpOpen
+	}
+	if err := (&models.SurveyFollowUp{Status: status}).IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	surveys, err := survey.FollowUps(r.Context(), status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve follow-ups", http.StatusInternalServerError)
+		log.Printf("Error scanning survey follow-ups: %v", err)
+		return
+	}
+	if surveys == nil {
+		surveys = []models.Survey{}
+	}
+	sort.Slice(surveys, func(i, j int) bool {
+		return surveys[i].RespondedAt < surveys[j].RespondedAt
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(surveys)
+}
+
+// UpdateSurveyFollowUp godoc
+// @Summary Record the follow-up of a detractor comment
+// @Description Mark a flagged survey response as resolved (or reopen it) with notes on how the clinic followed up
+// @Tags surveys
+// @Accept json
+// @Produce json
+// @Param appointmentId path string true "Appointment ID of the survey"
+// @Param followUp body models.SurveyFollowUp true "Follow-up status and notes"
+// @Success 200 {object} models.Survey
+// @Failure 400 {object} apierror.Response "Invalid request body or status"
+// @Failure 404 {object} apierror.Response "Flagged survey not found"
+// @Failure 500 {object} apierror.Response "Failed to update follow-up"
+// @Router /api/v1/dental/survey/follow-ups/{appointmentId} [put]
+func UpdateSurveyFollowUp(w http.ResponseWriter, r *http.Request) {
+	var followUp models.SurveyFollowUp
+	if err := json.NewDecoder(r.Body).Decode(&followUp); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := followUp.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, err := survey.SetFollowUp(r.Context(), mux.Vars(r)["appointmentId"], followUp)
+	if err != nil {
+		if errors.Is(err, survey.ErrSurveyNotFound) {
+			http.Error(w, "Flagged survey not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update follow-up", http.StatusInternalServerError)
+		log.Printf("Error updating survey follow-up: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// GetNPSReport godoc
+// @Summary Get Net Promoter Score
+// @Description Get the NPS of the clinic and of each dentist for survey responses received in a date range, overall and per week or month
+// @Tags reports
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Param interval query string false "month (default) or week"
+// @Param dentistId query string false "Only responses about this dentist"
+// @Success 200 {object} models.NPSReport
+// @Failure 400 {object} apierror.Response "Invalid date range or interval"
+// @Failure 500 {object} apierror.Response "Failed to build NPS report"
+// @Router /api/v1/dental/reports/nps [get]
+func GetNPSReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, to, err := parseReportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if interval != "month" && interval != "week" {
+		http.Error(w, "interval must be month or week", http.StatusBadRequest)
+		return
+	}
+	dentistFilter := query.Get("dentistId")
+
+	responses, err := survey.Responses(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to build NPS report", http.StatusInternalServerError)
+		log.Printf("Error scanning survey responses for NPS report: %v", err)
+		return
+	}
+
+	clinic := newNPSAccumulator()
+	dentists := make(map[string]*npsAccumulator)
+	for _, response := range responses {
+		if dentistFilter != "" && response.DentistID != dentistFilter {
+			continue
+		}
+		respondedAt, err := time.Parse(time.RFC3339, response.RespondedAt)
+		if err != nil {
+			continue
+		}
+		period := npsPeriod(respondedAt, interval)
+
+		clinic.add(period, response.Category)
+		if dentists[response.DentistID] == nil {
+			dentists[response.DentistID] = newNPSAccumulator()
+		}
+		dentists[response.DentistID].add(period, response.Category)
+	}
+
+	report := models.NPSReport{
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Interval: interval,
+		Clinic:   clinic.trend(),
+		Dentists: []models.NPSTrend{},
+	}
+
+	ids := make([]string, 0, len(dentists))
+	for id := range dentists {
+		ids = append(ids, id)
+	}
+	names := make(map[string]string)
+	if len(ids) > 0 {
+		found, err := batchGetItems[models.Dentist](r.Context(), "Dentists", ids)
+		if err != nil {
+			http.Error(w, "Failed to build NPS report", http.StatusInternalServerError)
+			log.Printf("Error fetching dentists for NPS report: %v", err)
+			return
+		}
+		for _, dentist := range found {
+			names[dentist.ID] = dentist.Name
+		}
+	}
+	for id, acc := range dentists {
+		trend := acc.trend()
+		trend.DentistID = id
+		trend.DentistName = names[id]
+		report.Dentists = append(report.Dentists, trend)
+	}
+	sort.Slice(report.Dentists, func(i, j int) bool {
+		return report.Dentists[i].DentistName < report.Dentists[j].DentistName
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// npsPeriod returns the month (2006-01) or ISO week (2006-W01) of a response
+func npsPeriod(t time.Time, interval string) string {
+	if interval == "week" {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01")
+}
+
+// npsAccumulator tallies responses overall and per period
+type npsAccumulator struct {
+	overall models.NPSScore
+	periods map[string]*models.NPSScore
+}
+
+func newNPSAccumulator() *npsAccumulator {
+	return &npsAccumulator{periods: make(map[string]*models.NPSScore)}
+}
+
+func (a *npsAccumulator) add(period, category string) {
+	a.overall.Add(category)
+	if a.periods[period] == nil {
+		a.periods[period] = &models.NPSScore{Period: period}
+	}
+	a.periods[period].Add(category)
+}
+
+func (a *npsAccumulator) trend() models.NPSTrend {
+	trend := models.NPSTrend{Overall: a.overall, Periods: []models.NPSScore{}}
+	for _, score := range a.periods {
+		trend.Periods = append(trend.Periods, *score)
+	}
+	sort.Slice(trend.Periods, func(i, j int) bool {
+		return trend.Periods[i].Period < trend.Periods[j].Period
+	})
+	return trend
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// syncSettle holds back the most recent changes: a write still in flight on
+// another instance may be logged with a slightly earlier sequence number,
+// and would be skipped by a cursor already past it
+const syncSettle = 5 * time.Second
+
+// GetSync godoc
+// @Summary Get the changes since a cursor
+// @Description Get the dentists, patients, procedures and appointments created, updated or deleted since the cursor of the previous sync, for clients that work offline. Created and updated records come in their current state, deleted ones as IDs. Without a cursor only the current cursor is returned: clients load the lists first and sync from it. Changes of the last few seconds are left for the next sync.
+// @Tags sync
+// @Produce json
+// @Param cursor query string false "Cursor returned by the previous sync"
+// @Param entities query string false "Comma-separated entity types to sync: dentists, patients, procedures, appointments (default all)"
+// @Param limit query int false "Most changes per response, up to 1000 (default 500); has_more tells whether more remain"
+// @Success 200 {object} models.SyncResponse
+// @Failure 400 {object} apierror.Response "Invalid cursor, entities or limit"
+// @Failure 500 {object} apierror.Response "Failed to sync"
+// @Router /api/v1/dental/sync [get]
+func GetSync(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	entities, err := syncEntities(query.Get("entities"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := models.DefaultSyncLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > models.MaxSyncLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", models.MaxSyncLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	cursor := query.Get("cursor")
+	until := config.ChangeSeq(time.Now().Add(-syncSettle))
+	if cursor != "" && !config.ValidChangeSeq(cursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	response := models.SyncResponse{Cursor: cursor}
+	if entities["dentists"] {
+		response.Dentists = &models.SyncChanges[models.Dentist]{}
+	}
+	if entities["patients"] {
+		response.Patients = &models.SyncChanges[models.Patient]{}
+	}
+	if entities["procedures"] {
+		response.Procedures = &models.SyncChanges[models.Procedure]{}
+	}
+	if entities["appointments"] {
+		response.Appointments = &models.SyncChanges[models.Appointment]{}
+	}
+	if cursor == "" {
+		response.Cursor = until
+	} else {
+		changes, hasMore, err := readChanges(r.Context(), cursor, until, entities, limit)
+		if err != nil {
+			http.Error(w, "Failed to sync", http.StatusInternalServerError)
+			log.Printf("Error reading change log after %s: %v", cursor, err)
+			return
+		}
+		response.HasMore = hasMore
+		if len(changes) > 0 {
+			response.Cursor = changes[len(changes)-1].Seq
+		}
+
+		created, updated, deleted := collapseChanges(changes)
+		err = fillSyncChanges(r.Context(), response.Dentists, "Dentists", created["dentists"], updated["dentists"], deleted["dentists"])
+		if err == nil {
+			err = fillSyncChanges(r.Context(), response.Patients, "Patients", created["patients"], updated["patients"], deleted["patients"])
+		}
+		if err == nil {
+			err = fillSyncChanges(r.Context(), response.Procedures, "Procedures", created["procedures"], updated["procedures"], deleted["procedures"])
+		}
+		if err == nil {
+			err = fillSyncChanges(r.Context(), response.Appointments, "Appointments", created["appointments"], updated["appointments"], deleted["appointments"])
+		}
+		if err != nil {
+			http.Error(w, "Failed to sync", http.StatusInternalServerError)
+			log.Printf("Error loading synced records: %v", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// syncEntities parses the entity types to sync, every synced type when empty
+func syncEntities(s string) (map[string]bool, error) {
+	entities := make(map[string]bool, len(config.SyncedTables))
+	if s == "" {
+		for _, entity := range config.SyncedTables {
+			entities[entity] = true
+		}
+		return entities, nil
+	}
+	supported := make(map[string]bool, len(config.SyncedTables))
+	for _, entity := range config.SyncedTables {
+		supported[entity] = true
+	}
+	for _, entity := range strings.Split(s, ",") {
+		entity = strings.TrimSpace(entity)
+		if !supported[entity] {
+			return nil, fmt.Errorf("unsupported entity %q, use dentists, patients, procedures or appointments", entity)
+		}
+		entities[entity] = true
+	}
+	return entities, nil
+}
+
+// readChanges returns up to limit changes of the clinic logged after cursor
+// and before until, oldest first, and whether more remain
+func readChanges(ctx context.Context, cursor, until string, entities map[string]bool, limit int) ([]config.Change, bool, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(config.ChangeLogTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic AND Seq BETWEEN :after AND :until"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: config.ClinicID(ctx)},
+			":after":  &types.AttributeValueMemberS{Value: cursor},
+			":until":  &types.AttributeValueMemberS{Value: until},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	var changes []config.Change
+	for {
+		input.Limit = aws.Int32(int32(limit - len(changes) + 1))
+		pageCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Query(pageCtx, input)
+		cancel()
+		if err != nil {
+			return nil, false, err
+		}
+		var page []config.Change
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, false, err
+		}
+		for _, change := range page {
+			if change.Seq == cursor {
+				continue
+			}
+			if len(changes) == limit {
+				return changes, true, nil
+			}
+			// Skipped changes still move the cursor past them
+			if !entities[change.Entity] {
+				change.ID = ""
+			}
+			changes = append(changes, change)
+		}
+		if result.LastEvaluatedKey == nil {
+			return changes, false, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// collapseChanges reduces the changes of each record to its net change, by
+// entity type: created (possibly updated since), updated, or deleted
+func collapseChanges(changes []config.Change) (created, updated, deleted map[string][]string) {
+	created, updated, deleted = map[string][]string{}, map[string][]string{}, map[string][]string{}
+	type net struct{ first, last string }
+	nets := make(map[string]*net)
+	var order []config.Change
+	for _, change := range changes {
+		if change.ID == "" {
+			continue
+		}
+		key := change.Entity + "/" + change.ID
+		if n, ok := nets[key]; ok {
+			n.last = change.Action
+			continue
+		}
+		nets[key] = &net{first: change.Action, last: change.Action}
+		order = append(order, change)
+	}
+	for _, change := range order {
+		n := nets[change.Entity+"/"+change.ID]
+		switch {
+		case n.last == config.ChangeDeleted:
+			deleted[change.Entity] = append(deleted[change.Entity], change.ID)
+		case n.first == config.ChangeCreated:
+			created[change.Entity] = append(created[change.Entity], change.ID)
+		default:
+			updated[change.Entity] = append(updated[change.Entity], change.ID)
+		}
+	}
+	return created, updated, deleted
+}
+
+// fillSyncChanges loads the current state of the created and updated records
+// of an entity type. Records deleted after the changes were read are left
+// out; the next sync reports their deletion.
+func fillSyncChanges[T any](ctx context.Context, changes *models.SyncChanges[T], tableName string, created, updated, deleted []string) error {
+	if changes == nil {
+		return nil
+	}
+	var err error
+	if changes.Created, err = batchGetChunked[T](ctx, tableName, created); err != nil {
+		return err
+	}
+	if changes.Updated, err = batchGetChunked[T](ctx, tableName, updated); err != nil {
+		return err
+	}
+	changes.Deleted = deleted
+	if changes.Deleted == nil {
+		changes.Deleted = []string{}
+	}
+	return nil
+}
+
+// batchGetChunked fetches items by ID in batches of at most MaxBatchGetIDs
+func batchGetChunked[T any](ctx context.Context, tableName string, ids []string) ([]T, error) {
+	items := []T{}
+	for start := 0; start < len(ids); start += models.MaxBatchGetIDs {
+		end := min(start+models.MaxBatchGetIDs, len(ids))
+		chunk, err := batchGetItems[T](ctx, tableName, ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, chunk...)
+	}
+	return items, nil
+}
+
+// syncRoutes maps the synced entity types to their routes under /api/v1/dental
+var syncRoutes = map[string]string{
+	"dentists":     "/api/v1/dental/dentist",
+	"patients":     "/api/v1/dental/patient",
+	"procedures":   "/api/v1/dental/procedure",
+	"appointments": "/api/v1/dental/appointment",
+}
+
+// ApplySyncChanges godoc
+// @Summary Apply changes made offline
+// @Description Apply up to 100 changes made by an offline client, in order. Updates and deletes carry the cursor of the sync in which the client got the record as base_version; a record changed on the server since then is not touched and comes back as a conflict with its current state and the server changes, for the client to merge and resend. Creates with an ID already taken are conflicts too. Each applied change goes through the same validation and permissions as the equivalent create, update or delete request; rejected ones are reported as failed with the error.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param request body models.SyncWriteRequest true "Changes made offline"
+// @Success 200 {object} models.SyncWriteResponse
+// @Failure 400 {object} apierror.Response "Invalid request body or changes"
+// @Failure 500 {object} apierror.Response "Failed to apply changes"
+// @Router /api/v1/dental/sync [post]
+func ApplySyncChanges(router http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.SyncWriteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.IsValid(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, change := range req.Changes {
+			if _, ok := syncRoutes[change.Entity]; !ok {
+				http.Error(w, fmt.Sprintf("change %d: unsupported entity %q, use dentists, patients, procedures or appointments", i, change.Entity), http.StatusBadRequest)
+				return
+			}
+			if change.BaseVersion != "" && !config.ValidChangeSeq(change.BaseVersion) {
+				http.Error(w, fmt.Sprintf("change %d: invalid base_version", i), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Conflicts are judged against the server changes made before this
+		// request, so changes of the same request never conflict
+		serverChanges, err := changesSinceBase(r.Context(), req.Changes)
+		if err != nil {
+			http.Error(w, "Failed to apply changes", http.StatusInternalServerError)
+			log.Printf("Error reading change log for offline changes: %v", err)
+			return
+		}
+
+		response := models.SyncWriteResponse{Results: make([]models.SyncWriteResult, 0, len(req.Changes))}
+		for i, change := range req.Changes {
+			result := applySyncChange(router, r, change, serverChanges)
+			result.Index = i
+			switch result.Status {
+			case models.SyncWriteApplied:
+				response.Applied++
+			case models.SyncWriteConflict:
+				response.Conflicts++
+			default:
+				response.Failed++
+			}
+			response.Results = append(response.Results, result)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// applySyncChange applies one offline change through the route of its
+// entity, unless the record changed on the server since its base version
+func applySyncChange(router http.Handler, r *http.Request, change models.SyncWrite, serverChanges map[string][]config.Change) models.SyncWriteResult {
+	result := models.SyncWriteResult{Entity: change.Entity, ID: change.ID}
+	route := syncRoutes[change.Entity]
+
+	if change.Action != models.SyncWriteCreate {
+		var since []models.SyncServerChange
+		for _, c := range serverChanges[change.Entity+"/"+change.ID] {
+			if c.Seq > change.BaseVersion {
+				since = append(since, models.SyncServerChange{Seq: c.Seq, Action: c.Action, At: c.At})
+			}
+		}
+		if len(since) > 0 {
+			deleted := since[len(since)-1].Action == config.ChangeDeleted
+			if deleted && change.Action == models.SyncWriteDelete {
+				result.Status = models.SyncWriteApplied
+				return result
+			}
+			result.Status = models.SyncWriteConflict
+			result.Conflict = &models.SyncConflict{Reason: models.SyncConflictUpdated, Changes: since}
+			if deleted {
+				result.Conflict.Reason = models.SyncConflictDeleted
+			} else {
+				result.Conflict.Current = currentRecord(router, r, route+"/"+change.ID)
+			}
+			return result
+		}
+	}
+
+	var status int
+	var body []byte
+	switch change.Action {
+	case models.SyncWriteCreate:
+		data := change.Data
+		if change.ID != "" {
+			var fields map[string]interface{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				result.Status = models.SyncWriteFailed
+				result.Error = "data must be a JSON object"
+				return result
+			}
+			fields["id"] = change.ID
+			data, _ = json.Marshal(fields)
+		}
+		status, body = dispatch(router, r, http.MethodPost, route, data)
+		if status == http.StatusConflict && change.ID != "" {
+			if current := currentRecord(router, r, route+"/"+change.ID); current != nil {
+				result.Status = models.SyncWriteConflict
+				result.Conflict = &models.SyncConflict{Reason: models.SyncConflictExists, Current: current}
+				return result
+			}
+		}
+	case models.SyncWriteUpdate:
+		status, body = dispatch(router, r, http.MethodPatch, route+"/"+change.ID, change.Data)
+	case models.SyncWriteDelete:
+		status, body = dispatch(router, r, http.MethodDelete, route+"/"+change.ID, nil)
+		// Deleted on the server after the change log was read
+		if status == http.StatusNotFound {
+			status = http.StatusNoContent
+		}
+	}
+
+	switch {
+	case status >= 200 && status < 300:
+		result.Status = models.SyncWriteApplied
+		if json.Valid(body) {
+			result.Record = body
+			var record struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(body, &record) == nil && record.ID != "" {
+				result.ID = record.ID
+			}
+		}
+	case status == http.StatusNotFound && change.Action == models.SyncWriteUpdate:
+		result.Status = models.SyncWriteConflict
+		result.Conflict = &models.SyncConflict{Reason: models.SyncConflictDeleted}
+	default:
+		result.Status = models.SyncWriteFailed
+		result.Error = strings.TrimSpace(string(body))
+	}
+	return result
+}
+
+// dispatch serves a request for the route on behalf of r, with its user and
+// clinic, and returns the response status and body
+func dispatch(router http.Handler, r *http.Request, method, path string, body []byte) (int, []byte) {
+	req := r.Clone(r.Context())
+	req.Method = method
+	req.URL = &url.URL{Path: path}
+	req.RequestURI = path
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code, recorder.Body.Bytes()
+}
+
+// currentRecord returns the record at path as its route serves it, or nil
+// when it does not exist
+func currentRecord(router http.Handler, r *http.Request, path string) json.RawMessage {
+	status, body := dispatch(router, r, http.MethodGet, path, nil)
+	if status != http.StatusOK || !json.Valid(body) {
+		return nil
+	}
+	return body
+}
+
+// changesSinceBase reads the clinic's changes logged after the oldest base
+// version among the updates and deletes, keyed by entity type and ID
+func changesSinceBase(ctx context.Context, writes []models.SyncWrite) (map[string][]config.Change, error) {
+	base := ""
+	ids := make(map[string]bool)
+	for _, write := range writes {
+		if write.Action == models.SyncWriteCreate {
+			continue
+		}
+		if base == "" || write.BaseVersion < base {
+			base = write.BaseVersion
+		}
+		ids[write.ID] = true
+	}
+	byRecord := make(map[string][]config.Change)
+	if base == "" {
+		return byRecord, nil
+	}
+
+	values := map[string]types.AttributeValue{
+		":clinic": &types.AttributeValueMemberS{Value: config.ClinicID(ctx)},
+		":base":   &types.AttributeValueMemberS{Value: base},
+	}
+	placeholders := make([]string, 0, len(ids))
+	for id := range ids {
+		placeholder := fmt.Sprintf(":id%d", len(placeholders))
+		values[placeholder] = &types.AttributeValueMemberS{Value: id}
+		placeholders = append(placeholders, placeholder)
+	}
+	changes, err := queryItems[config.Change](ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(config.ChangeLogTable),
+		KeyConditionExpression:    aws.String("ClinicID = :clinic AND Seq > :base"),
+		FilterExpression:          aws.String("#id IN (" + strings.Join(placeholders, ", ") + ")"),
+		ExpressionAttributeNames:  map[string]string{"#id": "ID"},
+		ExpressionAttributeValues: values,
+		ConsistentRead:            aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		key := change.Entity + "/" + change.ID
+		byRecord[key] = append(byRecord[key], change)
+	}
+	return byRecord, nil
+}
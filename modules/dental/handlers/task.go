@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/notify"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateTask godoc
+// @Summary Create a task
+// @Description Create a staff follow-up task, optionally linked to a patient and with a reminder sent to the assignee
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string false "Staff member creating the task"
+// @Param task body models.Task true "Task data"
+// @Success 201 {object} models.Task
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to save task"
+// @Router /api/v1/dental/task [post]
+func CreateTask(w http.ResponseWriter, r *http.Request) {
+	var task models.Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	task.ID = uuid.NewString()
+	task.ClinicID = config.ClinicID(r.Context())
+	if task.Status == "" {
+		task.Status = models.TaskStatusOpen
+	}
+	task.ReminderSentAt = ""
+	if err := task.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !taskPatientExists(w, r, task) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	task.CreatedBy = inbox.User(r)
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	if task.IsClosed() {
+		task.CompletedAt = now
+	}
+
+	if err := putTask(r.Context(), task, true); err != nil {
+		http.Error(w, "Failed to save task", http.StatusInternalServerError)
+		log.Printf("Error saving task: %v", err)
+		return
+	}
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "task", ID: task.ID}, inbox.User(r), "", taskText(task))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(task)
+}
+
+// GetAllTasks godoc
+// @Summary Get all tasks
+// @Description Get all tasks, optionally filtered by status, ordered by due date
+// @Tags tasks
+// @Produce json
+// @Param status query string false "open, in_progress, done or cancelled"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Task
+// @Failure 500 {object} apierror.Response "Failed to retrieve tasks"
+// @Router /api/v1/dental/task [get]
+func GetAllTasks(w http.ResponseWriter, r *http.Request) {
+	input := &dynamodb.ScanInput{TableName: aws.String("Tasks")}
+	if status := r.URL.Query().Get("status"); status != "" {
+		input.FilterExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		}
+	}
+	writeTasks(w, r, input, nil)
+}
+
+// GetMyTasks godoc
+// @Summary Get my tasks
+// @Description Get the tasks that are still open for the requesting staff member, ordered by due date
+// @Tags tasks
+// @Produce json
+// @Param X-User-ID header string false "Requesting staff member"
+// @Param assignee query string false "Assignee, when the X-User-ID header is not sent"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Task
+// @Failure 400 {object} apierror.Response "Assignee is required"
+// @Failure 500 {object} apierror.Response "Failed to retrieve tasks"
+// @Router /api/v1/dental/task/mine [get]
+func GetMyTasks(w http.ResponseWriter, r *http.Request) {
+	assignee := inbox.User(r)
+	if assignee == "" {
+		assignee = r.URL.Query().Get("assignee")
+	}
+	if assignee == "" {
+		http.Error(w, "Assignee is required", http.StatusBadRequest)
+		return
+	}
+
+	writeTasks(w, r, &dynamodb.ScanInput{
+		TableName:        aws.String("Tasks"),
+		FilterExpression: aws.String("Assignee = :assignee"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":assignee": &types.AttributeValueMemberS{Value: assignee},
+		},
+	}, func(task models.Task) bool {
+		return !task.IsClosed()
+	})
+}
+
+// GetOverdueTasks godoc
+// @Summary Get overdue tasks
+// @Description Get open tasks whose due date has passed, optionally for a single assignee
+// @Tags tasks
+// @Produce json
+// @Param assignee query string false "Only tasks of this assignee"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Task
+// @Failure 500 {object} apierror.Response "Failed to retrieve tasks"
+// @Router /api/v1/dental/task/overdue [get]
+func GetOverdueTasks(w http.ResponseWriter, r *http.Request) {
+	today := time.Now().UTC().Format("2006-01-02")
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String("Tasks"),
+		FilterExpression: aws.String("DueDate < :today"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":today": &types.AttributeValueMemberS{Value: today},
+		},
+	}
+	if assignee := r.URL.Query().Get("assignee"); assignee != "" {
+		input.FilterExpression = aws.String("DueDate < :today AND Assignee = :assignee")
+		input.ExpressionAttributeValues[":assignee"] = &types.AttributeValueMemberS{Value: assignee}
+	}
+	writeTasks(w, r, input, func(task models.Task) bool {
+		return task.IsOverdue(today)
+	})
+}
+
+// GetTasksByPatient godoc
+// @Summary Get tasks of a patient
+// @Description Get all tasks linked to a patient, ordered by due date
+// @Tags tasks
+// @Produce json
+// @Param patientId path string true "Patient ID"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Task
+// @Failure 500 {object} apierror.Response "Failed to retrieve tasks"
+// @Router /api/v1/dental/task/patient/{patientId} [get]
+func GetTasksByPatient(w http.ResponseWriter, r *http.Request) {
+	writeTasks(w, r, &dynamodb.ScanInput{
+		TableName:        aws.String("Tasks"),
+		FilterExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: mux.Vars(r)["patientId"]},
+		},
+	}, nil)
+}
+
+// GetTaskByID godoc
+// @Summary Get a task by ID
+// @Description Get a task by its ID
+// @Tags tasks
+// @Produce json
+// @Param id path string true "Task ID"
+// @Success 200 {object} models.Task
+// @Failure 404 {object} apierror.Response "Task not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve task"
+// @Router /api/v1/dental/task/{id} [get]
+func GetTaskByID(w http.ResponseWriter, r *http.Request) {
+	task, ok := loadTask(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// UpdateTask godoc
+// @Summary Update a task
+// @Description Update a task by its ID. Only the fields sent are changed; changing the reminder time schedules it again.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path string true "Task ID"
+// @Param If-Match header string false "Version of the task being changed; required unless the body has it"
+// @Param task body models.Task true "Task data"
+// @Success 200 {object} models.Task
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Task or patient not found"
+// @Failure 409 {object} apierror.Response "Task was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the task is required"
+// @Failure 500 {object} apierror.Response "Failed to update task"
+// @Router /api/v1/dental/task/{id} [put]
+func UpdateTask(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Tasks", id)
+	if !ok {
+		return
+	}
+	current, ok := loadTask(w, r, id)
+	if !ok {
+		return
+	}
+
+	previousText := taskText(current)
+
+	var updatedData models.Task
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Title != "" {
+		current.Title = updatedData.Title
+	}
+	if updatedData.Description != "" {
+		current.Description = updatedData.Description
+	}
+	if updatedData.Assignee != "" {
+		current.Assignee = updatedData.Assignee
+	}
+	if updatedData.PatientID != "" {
+		current.PatientID = updatedData.PatientID
+	}
+	if updatedData.DueDate != "" {
+		current.DueDate = updatedData.DueDate
+	}
+	if updatedData.RemindAt != "" && updatedData.RemindAt != current.RemindAt {
+		current.RemindAt = updatedData.RemindAt
+		current.ReminderSentAt = ""
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if updatedData.Status != "" && updatedData.Status != current.Status {
+		current.Status = updatedData.Status
+		current.CompletedAt = ""
+		if current.IsClosed() {
+			current.CompletedAt = now
+		}
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !taskPatientExists(w, r, current) {
+		return
+	}
+	current.UpdatedAt = now
+
+	if err := putTask(r.Context(), current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update task", http.StatusInternalServerError)
+		log.Printf("Error updating task: %v", err)
+		return
+	}
+	current.Version = version + 1
+	inbox.NotifyMentions(r.Context(), inbox.Source{Type: "task", ID: current.ID}, inbox.User(r), previousText, taskText(current))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteTask godoc
+// @Summary Delete a task
+// @Description Delete a task by its ID. Tasks under legal hold, or of a patient under legal hold, cannot be deleted.
+// @Tags tasks
+// @Param id path string true "Task ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Task not found"
+// @Failure 409 {object} apierror.Response "Record is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete task"
+// @Router /api/v1/dental/task/{id} [delete]
+func DeleteTask(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	patientID, err := taskPatient(r, id)
+	if err != nil {
+		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
+		log.Printf("Error fetching task %s: %v", id, err)
+		return
+	}
+	if !checkLegalHold(w, r, legalhold.RecordTask, id, patientID) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err = config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Tasks"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
+		log.Printf("Error deleting task: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func init() {
+	notify.RegisterKind(notify.Kind{
+		Name:        "task_reminder",
+		Description: "Reminder of a staff task sent to its assignee",
+		Fields: map[string]string{
+			"task_title": "Call the lab about the crown",
+			"due":        " (due 2024-03-11)",
+		},
+		Subject: "Task reminder",
+		Body:    "{{task_title}}{{due}}",
+	})
+}
+
+// SendTaskReminders notifies assignees of open tasks whose reminder time has
+// passed, returning how many reminders were sent
+func SendTaskReminders(ctx context.Context) (int, error) {
+	sent := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := sendClinicTaskReminders(ctx)
+		sent += n
+		return err
+	})
+	return sent, err
+}
+
+// sendClinicTaskReminders sends the task reminders of the clinic of ctx
+func sendClinicTaskReminders(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	tasks, err := paging.ScanAll[models.Task](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Tasks"),
+		FilterExpression: aws.String("RemindAt <= :now AND attribute_not_exists(ReminderSentAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scanning due task reminders: %v", err)
+	}
+
+	sent := 0
+	for _, task := range tasks {
+		if task.IsClosed() || task.ReminderSentAt != "" {
+			continue
+		}
+
+		// Mark first so concurrent instances do not remind twice
+		updateCtx, cancel := config.DBContext(ctx)
+		_, err := config.DBClient.UpdateItem(updateCtx, &dynamodb.UpdateItemInput{
+			TableName: aws.String("Tasks"),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: task.ID},
+			},
+			UpdateExpression:    aws.String("SET ReminderSentAt = :now"),
+			ConditionExpression: aws.String("RemindAt = :remindAt AND attribute_not_exists(ReminderSentAt)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":now":      &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+				":remindAt": &types.AttributeValueMemberS{Value: task.RemindAt},
+			},
+		})
+		cancel()
+		if err != nil {
+			var cfe *types.ConditionalCheckFailedException
+			if !errors.As(err, &cfe) {
+				log.Printf("Error marking reminder of task %s: %v", task.ID, err)
+			}
+			continue
+		}
+
+		// The reminder goes out with the clinic's templates and sender;
+		// tasks older than clinics belong to the default one
+		clinicID := task.ClinicID
+		if clinicID == "" {
+			clinicID = config.DefaultClinicID
+		}
+		sendCtx := config.WithClinic(ctx, clinicID)
+		due := ""
+		if task.DueDate != "" {
+			due = fmt.Sprintf(" (due %s)", task.DueDate)
+		}
+		msg, err := notify.Compose(sendCtx, clinicID, "task_reminder", task.Assignee, map[string]string{
+			"task_title": task.Title,
+			"due":        due,
+		})
+		if err == nil {
+			err = notify.Send(sendCtx, msg)
+		}
+		if err != nil {
+			log.Printf("Error sending reminder of task %s: %v", task.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// StartTaskReminders sends due task reminders once at startup and then every interval
+func StartTaskReminders(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	remind := func() {
+		n, err := SendTaskReminders(ctx)
+		if err != nil {
+			log.Printf("Error sending task reminders: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Sent %d task reminders", n)
+		}
+	}
+
+	go func() {
+		remind()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				remind()
+			}
+		}
+	}()
+}
+
+// writeTasks scans tasks, keeps those accepted by keep (all when nil) and
+// writes them ordered by due date, tasks without one last
+func writeTasks(w http.ResponseWriter, r *http.Request, input *dynamodb.ScanInput, keep func(models.Task) bool) {
+	page := paging.Request(r)
+	tasks, next, err := paging.Scan[models.Task](r.Context(), input, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		log.Printf("Error scanning tasks: %v", err)
+		return
+	}
+
+	filtered := []models.Task{}
+	for _, task := range tasks {
+		if keep == nil || keep(task) {
+			filtered = append(filtered, task)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i].DueDate, filtered[j].DueDate
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		return a < b
+	})
+
+	paging.Write(w, page, filtered, next)
+}
+
+// taskText is the text of a task searched for @mentions
+func taskText(task models.Task) string {
+	return task.Title + "\n" + task.Description
+}
+
+// loadTask fetches a task, writing the error response when it cannot be returned
+func loadTask(w http.ResponseWriter, r *http.Request, id string) (models.Task, bool) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Tasks"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve task", http.StatusInternalServerError)
+		log.Printf("Error fetching task with ID %s: %v", id, err)
+		return models.Task{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return models.Task{}, false
+	}
+
+	var task models.Task
+	if err := attributevalue.UnmarshalMap(result.Item, &task); err != nil {
+		http.Error(w, "Failed to unmarshal task data", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling task data: %v", err)
+		return models.Task{}, false
+	}
+	return task, true
+}
+
+// taskPatientExists checks the linked patient exists, writing the error
+// response when it does not
+func taskPatientExists(w http.ResponseWriter, r *http.Request, task models.Task) bool {
+	if task.PatientID == "" {
+		return true
+	}
+	exists, err := itemExists(r.Context(), "Patients", task.PatientID)
+	if err != nil {
+		http.Error(w, "Failed to save task", http.StatusInternalServerError)
+		log.Printf("Error checking patient %s: %v", task.PatientID, err)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// putTask writes a task; empty optional fields are omitted so the reminder
+// and due date filters only match tasks that have them
+func putTask(ctx context.Context, task models.Task, create bool) error {
+	item, err := attributevalue.MarshalMap(task)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Tasks"),
+		Item:      item,
+	}, create)
+}
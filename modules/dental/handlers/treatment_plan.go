@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/config"
+	"dental-saas/shared/counters"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateTreatmentPlan godoc
+// @Summary Propose a treatment plan
+// @Description Propose a treatment plan for a patient: the procedures planned, each with an estimated cost (the dentist's price for the procedure when not sent), a priority (urgent, high, medium or low, default medium) and optionally the tooth. Plans start as proposed and can be changed until approved.
+// @Tags treatment-plans
+// @Accept json
+// @Produce json
+// @Param plan body models.TreatmentPlan true "Patient, dentist and planned procedures"
+// @Success 201 {object} models.TreatmentPlan
+// @Failure 400 {object} apierror.Response "Invalid request body, missing fields or unknown procedures"
+// @Failure 404 {object} apierror.Response "Patient or dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to save treatment plan"
+// @Router /api/v1/dental/treatment-plan [post]
+func CreateTreatmentPlan(w http.ResponseWriter, r *http.Request) {
+	var plan models.TreatmentPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	plan.ID = uuid.NewString()
+	plan.Status = models.TreatmentPlanProposed
+	plan.ApprovedAt, plan.ApprovedBy, plan.CompletedAt = "", "", ""
+	if !prepareTreatmentPlan(w, r, &plan) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+	plan.Version = 0
+
+	if err := putTreatmentPlan(r.Context(), plan, true); err != nil {
+		http.Error(w, "Failed to save treatment plan", http.StatusInternalServerError)
+		log.Printf("Error saving treatment plan: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// GetAllTreatmentPlans godoc
+// @Summary Get treatment plans
+// @Description Get treatment plans, optionally filtered by patient and status
+// @Tags treatment-plans
+// @Produce json
+// @Param patientId query string false "Only plans of this patient"
+// @Param status query string false "proposed, approved, in_progress or completed"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.TreatmentPlan
+// @Failure 500 {object} apierror.Response "Failed to retrieve treatment plans"
+// @Router /api/v1/dental/treatment-plan [get]
+func GetAllTreatmentPlans(w http.ResponseWriter, r *http.Request) {
+	input := &dynamodb.ScanInput{TableName: aws.String("TreatmentPlans")}
+	var filters []string
+	values := map[string]types.AttributeValue{}
+	query := r.URL.Query()
+	if status := query.Get("status"); status != "" {
+		filters = append(filters, "#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		values[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+	if patientID := query.Get("patientId"); patientID != "" {
+		filters = append(filters, "PatientID = :patientId")
+		values[":patientId"] = &types.AttributeValueMemberS{Value: patientID}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+	}
+
+	page := paging.Request(r)
+	plans, next, err := paging.Scan[models.TreatmentPlan](r.Context(), input, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve treatment plans", http.StatusInternalServerError)
+		log.Printf("Error scanning treatment plans: %v", err)
+		return
+	}
+
+	paging.Write(w, page, plans, next)
+}
+
+// GetTreatmentPlanByID godoc
+// @Summary Get a treatment plan by ID
+// @Description Get a treatment plan by its ID, with the status of each planned procedure and the appointment booked for it
+// @Tags treatment-plans
+// @Produce json
+// @Param id path string true "Treatment plan ID"
+// @Success 200 {object} models.TreatmentPlan
+// @Failure 404 {object} apierror.Response "Treatment plan not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve treatment plan"
+// @Router /api/v1/dental/treatment-plan/{id} [get]
+func GetTreatmentPlanByID(w http.ResponseWriter, r *http.Request) {
+	plan, ok := loadTreatmentPlan(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// UpdateTreatmentPlan godoc
+// @Summary Update a proposed treatment plan
+// @Description Change the dentist, title, notes or items of a treatment plan not approved yet. Only the fields sent are changed; items sent replace all the items of the plan.
+// @Tags treatment-plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment plan ID"
+// @Param If-Match header string false "Version of the treatment plan being changed; required unless the body has it"
+// @Param plan body models.TreatmentPlan true "Treatment plan data"
+// @Success 200 {object} models.TreatmentPlan
+// @Failure 400 {object} apierror.Response "Invalid request body, fields or unknown procedures"
+// @Failure 404 {object} apierror.Response "Treatment plan or dentist not found"
+// @Failure 409 {object} apierror.Response "Treatment plan already approved, or changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the treatment plan is required"
+// @Failure 500 {object} apierror.Response "Failed to update treatment plan"
+// @Router /api/v1/dental/treatment-plan/{id} [put]
+func UpdateTreatmentPlan(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "TreatmentPlans", id)
+	if !ok {
+		return
+	}
+	current, ok := loadTreatmentPlan(w, r, id)
+	if !ok {
+		return
+	}
+	if current.Status != models.TreatmentPlanProposed {
+		http.Error(w, "Only proposed treatment plans can be changed", http.StatusConflict)
+		return
+	}
+
+	var updatedData models.TreatmentPlan
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.DentistID != "" {
+		current.DentistID = updatedData.DentistID
+	}
+	if updatedData.Title != "" {
+		current.Title = updatedData.Title
+	}
+	if updatedData.Notes != "" {
+		current.Notes = updatedData.Notes
+	}
+	if len(updatedData.Items) > 0 {
+		current.Items = updatedData.Items
+	}
+	if !prepareTreatmentPlan(w, r, &current) {
+		return
+	}
+	current.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putTreatmentPlan(r.Context(), current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Treatment plan not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update treatment plan", http.StatusInternalServerError)
+		log.Printf("Error updating treatment plan: %v", err)
+		return
+	}
+	current.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteTreatmentPlan godoc
+// @Summary Delete a treatment plan
+// @Description Delete a treatment plan none of whose procedures was booked yet. Plans of a patient under legal hold are kept.
+// @Tags treatment-plans
+// @Param id path string true "Treatment plan ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Treatment plan not found"
+// @Failure 409 {object} apierror.Response "Treatment plan has booked procedures or is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete treatment plan"
+// @Router /api/v1/dental/treatment-plan/{id} [delete]
+func DeleteTreatmentPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := loadTreatmentPlan(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	for _, item := range plan.Items {
+		if item.Status != models.TreatmentItemPlanned {
+			http.Error(w, "Treatment plan has booked procedures and cannot be deleted", http.StatusConflict)
+			return
+		}
+	}
+	if !checkLegalHold(w, r, legalhold.RecordTreatmentPlan, plan.ID, plan.PatientID) {
+		return
+	}
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("TreatmentPlans"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: plan.ID},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID) AND Version = :version"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(plan.Version, 10)},
+		},
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Treatment plan was changed while being deleted; try again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to delete treatment plan", http.StatusInternalServerError)
+		log.Printf("Error deleting treatment plan: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ApproveTreatmentPlan godoc
+// @Summary Approve a treatment plan
+// @Description Record that the patient accepted a proposed treatment plan, which can then be scheduled and no longer changed
+// @Tags treatment-plans
+// @Produce json
+// @Param id path string true "Treatment plan ID"
+// @Success 200 {object} models.TreatmentPlan
+// @Failure 404 {object} apierror.Response "Treatment plan not found"
+// @Failure 409 {object} apierror.Response "Treatment plan not proposed, or changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to approve treatment plan"
+// @Router /api/v1/dental/treatment-plan/{id}/approve [post]
+func ApproveTreatmentPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := loadTreatmentPlan(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if plan.Status != models.TreatmentPlanProposed {
+		http.Error(w, "Only proposed treatment plans can be approved", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	plan.Status = models.TreatmentPlanApproved
+	plan.ApprovedAt = now
+	plan.ApprovedBy = config.ActorFrom(r.Context()).User
+	plan.UpdatedAt = now
+
+	if err := putTreatmentPlan(r.Context(), plan, false); err != nil {
+		if errors.Is(err, config.ErrVersionConflict) {
+			http.Error(w, "Treatment plan was changed concurrently; try again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to approve treatment plan", http.StatusInternalServerError)
+		log.Printf("Error approving treatment plan %s: %v", plan.ID, err)
+		return
+	}
+	plan.Version++
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// ScheduleTreatmentPlan godoc
+// @Summary Book the planned procedures of a treatment plan
+// @Description Create one appointment per procedure of an approved treatment plan not booked yet (or those of item_ids), highest priority first. Procedures are booked back to back from start, or days_apart days from each other, at their estimated cost. Items follow their appointments: completed when the appointment is, planned again when it is cancelled, and the plan is completed with its last item.
+// @Tags treatment-plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment plan ID"
+// @Param schedule body models.TreatmentPlanScheduleRequest true "Start, spacing and dentist of the appointments"
+// @Success 201 {object} models.TreatmentPlanSchedule
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Treatment plan not found"
+// @Failure 409 {object} apierror.Response "Treatment plan not approved, nothing left to book, pre-authorization missing or plan changed concurrently"
+// @Failure 422 {object} apierror.Response "Dentist not credentialed for a procedure or not available at the time"
+// @Failure 500 {object} apierror.Response "Failed to schedule treatment plan"
+// @Router /api/v1/dental/treatment-plan/{id}/schedule [post]
+func ScheduleTreatmentPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := loadTreatmentPlan(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if plan.Status != models.TreatmentPlanApproved && plan.Status != models.TreatmentPlanInProgress {
+		http.Error(w, "Only approved treatment plans can be scheduled", http.StatusConflict)
+		return
+	}
+
+	var req models.TreatmentPlanScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DentistID == "" {
+		req.DentistID = plan.DentistID
+	}
+	start, _ := (&models.Appointment{DateTime: req.Start}).StartTime()
+
+	indexes := plan.PlannedItems(req.ItemIDs)
+	if len(indexes) == 0 {
+		http.Error(w, "Treatment plan has no planned procedures left to book", http.StatusConflict)
+		return
+	}
+	// One write of the transaction is the plan itself
+	if len(indexes) >= maxSeriesAppointments {
+		http.Error(w, "Treatment plan has too many procedures to book at once; send item_ids", http.StatusBadRequest)
+		return
+	}
+
+	procedureIDs := make([]string, len(indexes))
+	for i, index := range indexes {
+		procedureIDs[i] = plan.Items[index].ProcedureID
+	}
+	procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", procedureIDs)
+	if err != nil {
+		http.Error(w, "Failed to schedule treatment plan", http.StatusInternalServerError)
+		log.Printf("Error loading procedures of treatment plan %s: %v", plan.ID, err)
+		return
+	}
+	byID := make(map[string]models.Procedure, len(procedures))
+	for _, procedure := range procedures {
+		byID[procedure.ID] = procedure
+	}
+
+	schedule := models.TreatmentPlanSchedule{}
+	now := time.Now().UTC().Format(time.RFC3339)
+	at := start
+	var writes []types.TransactWriteItem
+	for _, index := range indexes {
+		item := &plan.Items[index]
+		appointment := models.Appointment{
+			ID:              uuid.NewString(),
+			DentistID:       req.DentistID,
+			PatientID:       plan.PatientID,
+			ProcedureID:     item.ProcedureID,
+			DateTime:        at.Format("2006-01-02T15:04:05"),
+			Duration:        byID[item.ProcedureID].Duration,
+			Status:          models.AppointmentStatusScheduled,
+			Notes:           item.Notes,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			Price:           item.EstimatedCost,
+			TreatmentPlanID: plan.ID,
+		}
+		item.Status = models.TreatmentItemScheduled
+		item.AppointmentID = appointment.ID
+		schedule.Appointments = append(schedule.Appointments, appointment)
+		writes = append(writes, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String("Appointments"),
+				Item:                repository.AppointmentItem(appointment),
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
+			},
+		})
+
+		if req.DaysApart > 0 {
+			at = at.AddDate(0, 0, req.DaysApart)
+		} else {
+			at = at.Add(time.Duration(appointment.DurationMinutes()) * time.Minute)
+		}
+	}
+
+	if !checkDentistPerforms(w, r, schedule.Appointments...) {
+		return
+	}
+	for _, appointment := range schedule.Appointments {
+		if !checkDentistAvailability(w, r, appointment) {
+			return
+		}
+	}
+	if !checkPreAuth(w, r, schedule.Appointments...) {
+		return
+	}
+
+	plan.Progress()
+	plan.UpdatedAt = now
+	previous := plan.Version
+	plan.Version++
+	planItem, err := attributevalue.MarshalMap(plan)
+	if err != nil {
+		http.Error(w, "Failed to schedule treatment plan", http.StatusInternalServerError)
+		log.Printf("Error marshaling treatment plan: %v", err)
+		return
+	}
+	// Transactions bypass the versioning middleware, so the plan checks its
+	// version itself
+	writes = append(writes, types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:           aws.String("TreatmentPlans"),
+			Item:                planItem,
+			ConditionExpression: aws.String("attribute_exists(ID) AND Version = :version"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(previous, 10)},
+			},
+		},
+	})
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	_, err = config.DBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		http.Error(w, "Treatment plan was changed concurrently; reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to schedule treatment plan", http.StatusInternalServerError)
+		log.Printf("Error saving appointments of treatment plan %s: %v", plan.ID, err)
+		return
+	}
+
+	for _, appointment := range schedule.Appointments {
+		if day, ok := appointmentDay(appointment.DateTime); ok {
+			counters.IncrementAsync(r.Context(), counters.AppointmentsPerDayCounter(config.ClinicID(r.Context()), day), 1)
+			invalidateAgenda(r.Context(), day)
+		}
+		webhooks.Publish(r.Context(), webhooks.EventAppointmentCreated, appointment)
+	}
+
+	schedule.Plan = plan
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// progressTreatmentPlan moves the plan item of an appointment whose status
+// changed along with it: completed when the appointment is, planned again
+// when it is cancelled or missed. The appointment is already saved, so
+// failures are only logged.
+func progressTreatmentPlan(ctx context.Context, appointment models.Appointment) {
+	plan, err := getTreatmentPlan(ctx, appointment.TreatmentPlanID)
+	if err != nil || plan == nil {
+		if err != nil {
+			log.Printf("Error fetching treatment plan %s of appointment %s: %v", appointment.TreatmentPlanID, appointment.ID, err)
+		}
+		return
+	}
+
+	found := false
+	for i := range plan.Items {
+		item := &plan.Items[i]
+		if item.AppointmentID != appointment.ID {
+			continue
+		}
+		found = true
+		switch appointment.Status {
+		case models.AppointmentStatusCompleted:
+			item.Status = models.TreatmentItemCompleted
+		case models.AppointmentStatusCancelled, models.AppointmentStatusNoShow:
+			item.Status = models.TreatmentItemPlanned
+			item.AppointmentID = ""
+		default:
+			item.Status = models.TreatmentItemScheduled
+		}
+	}
+	if !found {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if plan.Progress() {
+		plan.CompletedAt = now
+	} else if plan.Status != models.TreatmentPlanCompleted {
+		plan.CompletedAt = ""
+	}
+	plan.UpdatedAt = now
+
+	if err := putTreatmentPlan(ctx, *plan, false); err != nil {
+		log.Printf("Error updating treatment plan %s after appointment %s: %v", plan.ID, appointment.ID, err)
+	}
+}
+
+// prepareTreatmentPlan validates a plan being proposed or changed, checks its
+// patient, dentist and procedures exist and fills the items' IDs, statuses,
+// missing estimated costs and the plan's total, writing the error response
+// when it fails
+func prepareTreatmentPlan(w http.ResponseWriter, r *http.Request, plan *models.TreatmentPlan) bool {
+	if err := plan.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	for table, id := range map[string]string{"Patients": plan.PatientID, "Dentists": plan.DentistID} {
+		exists, err := itemExists(r.Context(), table, id)
+		if err != nil {
+			http.Error(w, "Failed to save treatment plan", http.StatusInternalServerError)
+			log.Printf("Error checking %s item %s: %v", table, id, err)
+			return false
+		}
+		if !exists {
+			http.Error(w, "Patient or dentist not found", http.StatusNotFound)
+			return false
+		}
+	}
+	bundle := models.Bundle{Items: make([]models.BundleItem, len(plan.Items))}
+	for i, item := range plan.Items {
+		bundle.Items[i] = models.BundleItem{ProcedureID: item.ProcedureID}
+	}
+	if !bundleProceduresExist(w, r, bundle) {
+		return false
+	}
+
+	now := time.Now()
+	for i := range plan.Items {
+		item := &plan.Items[i]
+		item.ID = uuid.NewString()
+		item.Status = models.TreatmentItemPlanned
+		item.AppointmentID = ""
+		if item.EstimatedCost != "" {
+			continue
+		}
+		price, err := pricing.Resolve(r.Context(), item.ProcedureID, plan.DentistID, now)
+		if err != nil {
+			http.Error(w, "Failed to save treatment plan", http.StatusInternalServerError)
+			log.Printf("Error resolving price of procedure %s: %v", item.ProcedureID, err)
+			return false
+		}
+		item.EstimatedCost = models.FormatPrice(price.Amount)
+	}
+	plan.EstimatedTotal = plan.Total()
+	return true
+}
+
+// loadTreatmentPlan fetches a treatment plan, writing the error response when
+// it fails
+func loadTreatmentPlan(w http.ResponseWriter, r *http.Request, id string) (models.TreatmentPlan, bool) {
+	plan, err := getTreatmentPlan(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve treatment plan", http.StatusInternalServerError)
+		log.Printf("Error fetching treatment plan with ID %s: %v", id, err)
+		return models.TreatmentPlan{}, false
+	}
+	if plan == nil {
+		http.Error(w, "Treatment plan not found", http.StatusNotFound)
+		return models.TreatmentPlan{}, false
+	}
+	return *plan, true
+}
+
+func getTreatmentPlan(ctx context.Context, id string) (*models.TreatmentPlan, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("TreatmentPlans"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var plan models.TreatmentPlan
+	if err := attributevalue.UnmarshalMap(result.Item, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func putTreatmentPlan(ctx context.Context, plan models.TreatmentPlan, create bool) error {
+	item, err := attributevalue.MarshalMap(plan)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("TreatmentPlans"),
+		Item:      item,
+	}, create)
+}
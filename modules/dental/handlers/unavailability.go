@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/calendarsync"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateUnavailability godoc
+// @Summary Block a dentist's agenda
+// @Description Record a period in which the dentist does not see patients, such as a course or a vacation. Blocked periods are not offered for scheduling. Times are in clinic time (UTC).
+// @Tags unavailability
+// @Accept json
+// @Produce json
+// @Param unavailability body models.Unavailability true "Dentist, start, end and reason (ID and source will be ignored)"
+// @Success 201 {object} models.Unavailability
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to save unavailability"
+// @Router /api/v1/dental/unavailability [post]
+func CreateUnavailability(w http.ResponseWriter, r *http.Request) {
+	var block models.Unavailability
+	if err := json.NewDecoder(r.Body).Decode(&block); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := block.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exists, err := itemExists(r.Context(), "Dentists", block.DentistID)
+	if err != nil {
+		http.Error(w, "Failed to save unavailability", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", block.DentistID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+
+	// Stored in a single layout so blocks can be filtered by range
+	start, end, _ := block.Period()
+	block.ID = uuid.NewString()
+	block.Start = start.UTC().Format(models.UnavailabilityLayout)
+	block.End = end.UTC().Format(models.UnavailabilityLayout)
+	block.Source = models.UnavailabilitySourceManual
+	block.ExternalID = ""
+	now := time.Now().UTC().Format(time.RFC3339)
+	block.CreatedAt = now
+	block.UpdatedAt = now
+
+	item, err := attributevalue.MarshalMap(block)
+	if err != nil {
+		http.Error(w, "Failed to save unavailability", http.StatusInternalServerError)
+		log.Printf("Error marshaling unavailability: %v", err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Unavailability"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}); err != nil {
+		http.Error(w, "Failed to save unavailability", http.StatusInternalServerError)
+		log.Printf("Error saving unavailability: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(block)
+}
+
+// GetAllUnavailability godoc
+// @Summary Get agenda blocks
+// @Description Get the periods in which dentists are unavailable, both recorded by staff and imported from their personal calendars, optionally filtered by dentist and date range
+// @Tags unavailability
+// @Produce json
+// @Param dentistId query string false "Dentist ID"
+// @Param from query string false "Blocks ending on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Blocks starting on or before this date (YYYY-MM-DD)"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Unavailability
+// @Failure 400 {object} apierror.Response "Invalid filter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve unavailability"
+// @Router /api/v1/dental/unavailability [get]
+func GetAllUnavailability(w http.ResponseWriter, r *http.Request) {
+	input := &dynamodb.ScanInput{TableName: aws.String("Unavailability")}
+	var filters []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	query := r.URL.Query()
+	if dentistID := query.Get("dentistId"); dentistID != "" {
+		filters = append(filters, "DentistID = :dentistId")
+		values[":dentistId"] = &types.AttributeValueMemberS{Value: dentistID}
+	}
+	if from := query.Get("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, "#end > :from")
+		names["#end"] = "End"
+		values[":from"] = &types.AttributeValueMemberS{Value: day.Format(models.UnavailabilityLayout)}
+	}
+	if to := query.Get("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, "#start < :to")
+		names["#start"] = "Start"
+		values[":to"] = &types.AttributeValueMemberS{Value: day.AddDate(0, 0, 1).Format(models.UnavailabilityLayout)}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+		if len(names) > 0 {
+			input.ExpressionAttributeNames = names
+		}
+	}
+
+	page := paging.Request(r)
+	blocks, next, err := paging.Scan[models.Unavailability](r.Context(), input, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve unavailability", http.StatusInternalServerError)
+		log.Printf("Error scanning unavailability: %v", err)
+		return
+	}
+
+	paging.Write(w, page, blocks, next)
+}
+
+// DeleteUnavailability godoc
+// @Summary Remove an agenda block
+// @Description Remove a block recorded by staff. Blocks imported from a personal calendar follow the calendar and are removed there.
+// @Tags unavailability
+// @Param id path string true "Unavailability ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Unavailability not found"
+// @Failure 409 {object} apierror.Response "Block was imported from a personal calendar"
+// @Failure 500 {object} apierror.Response "Failed to delete unavailability"
+// @Router /api/v1/dental/unavailability/{id} [delete]
+func DeleteUnavailability(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Unavailability"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: mux.Vars(r)["id"]},
+		},
+		ConditionExpression:      aws.String("attribute_exists(ID) AND #source <> :caldav"),
+		ExpressionAttributeNames: map[string]string{"#source": "Source"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":caldav": &types.AttributeValueMemberS{Value: models.UnavailabilitySourceCalDAV},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			if cfe.Item == nil {
+				http.Error(w, "Unavailability not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Block was imported from the dentist's personal calendar, remove the event there instead", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to delete unavailability", http.StatusInternalServerError)
+		log.Printf("Error deleting unavailability: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCalendarSync godoc
+// @Summary Get a dentist's calendar sync
+// @Description Get the personal CalDAV calendar connected to a dentist and the outcome of its last sync. The password is never returned.
+// @Tags unavailability
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 200 {object} models.CalendarSync
+// @Failure 404 {object} apierror.Response "Calendar sync not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve calendar sync"
+// @Router /api/v1/dental/dentist/{id}/calendar-sync [get]
+func GetCalendarSync(w http.ResponseWriter, r *http.Request) {
+	cs, ok := loadCalendarSync(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cs)
+}
+
+// SetCalendarSync godoc
+// @Summary Connect a dentist's personal calendar
+// @Description Connect or update the CalDAV calendar of a dentist. Busy events there become agenda blocks and the dentist's appointments are published there, every CALDAV_SYNC_INTERVAL. The URL must resolve to a public address, unless CALDAV_ALLOW_PRIVATE_NETWORKS is set. The password is stored encrypted and never returned; on update, an omitted password keeps the current one.
+// @Tags unavailability
+// @Accept json
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Param sync body models.CalendarSync true "Calendar collection URL and credentials"
+// @Success 200 {object} models.CalendarSync
+// @Failure 400 {object} apierror.Response "Invalid request body or URL"
+// @Failure 404 {object} apierror.Response "Dentist not found"
+// @Failure 500 {object} apierror.Response "Failed to save calendar sync"
+// @Router /api/v1/dental/dentist/{id}/calendar-sync [put]
+func SetCalendarSync(w http.ResponseWriter, r *http.Request) {
+	dentistID := mux.Vars(r)["id"]
+	var cs models.CalendarSync
+	if err := json.NewDecoder(r.Body).Decode(&cs); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	cs.DentistID = dentistID
+	if err := cs.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := calendarsync.CheckURL(cs.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exists, err := itemExists(r.Context(), "Dentists", dentistID)
+	if err != nil {
+		http.Error(w, "Failed to save calendar sync", http.StatusInternalServerError)
+		log.Printf("Error checking dentist %s: %v", dentistID, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Dentist not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	cs.CreatedAt = now
+	cs.LastSyncAt = ""
+	cs.LastError = ""
+	current, err := getCalendarSync(r.Context(), dentistID)
+	if err != nil {
+		http.Error(w, "Failed to save calendar sync", http.StatusInternalServerError)
+		log.Printf("Error fetching calendar sync of dentist %s: %v", dentistID, err)
+		return
+	}
+	if current != nil {
+		cs.CreatedAt = current.CreatedAt
+		cs.SealedPassword = current.SealedPassword
+		// A different calendar gets all appointments published again
+		if cs.URL == current.URL {
+			cs.LastSyncAt = current.LastSyncAt
+		}
+	}
+	cs.UpdatedAt = now
+	if cs.Password != "" {
+		if cs.SealedPassword, err = calendarsync.SealPassword(cs.Password); err != nil {
+			http.Error(w, "Failed to save calendar sync", http.StatusInternalServerError)
+			log.Printf("Error sealing calendar password of dentist %s: %v", dentistID, err)
+			return
+		}
+	}
+
+	item, err := attributevalue.MarshalMap(cs)
+	if err != nil {
+		http.Error(w, "Failed to save calendar sync", http.StatusInternalServerError)
+		log.Printf("Error marshaling calendar sync: %v", err)
+		return
+	}
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("CalendarSyncs"),
+		Item:      item,
+	}); err != nil {
+		http.Error(w, "Failed to save calendar sync", http.StatusInternalServerError)
+		log.Printf("Error saving calendar sync: %v", err)
+		return
+	}
+
+	cs.Password = ""
+	cs.PasswordSet = cs.SealedPassword != ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cs)
+}
+
+// DeleteCalendarSync godoc
+// @Summary Disconnect a dentist's personal calendar
+// @Description Stop syncing the dentist's CalDAV calendar and remove the blocks imported from it. Appointments already published there are left in the calendar.
+// @Tags unavailability
+// @Param id path string true "Dentist ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Calendar sync not found"
+// @Failure 500 {object} apierror.Response "Failed to delete calendar sync"
+// @Router /api/v1/dental/dentist/{id}/calendar-sync [delete]
+func DeleteCalendarSync(w http.ResponseWriter, r *http.Request) {
+	dentistID := mux.Vars(r)["id"]
+	ctx, cancel := config.DBContext(r.Context())
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("CalendarSyncs"),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: dentistID},
+		},
+		ConditionExpression: aws.String("attribute_exists(DentistID)"),
+	})
+	cancel()
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Calendar sync not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete calendar sync", http.StatusInternalServerError)
+		log.Printf("Error deleting calendar sync: %v", err)
+		return
+	}
+
+	if err := calendarsync.RemoveBlocks(r.Context(), dentistID); err != nil {
+		http.Error(w, "Failed to delete calendar sync", http.StatusInternalServerError)
+		log.Printf("Error removing imported blocks of dentist %s: %v", dentistID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunCalendarSync godoc
+// @Summary Sync a dentist's personal calendar now
+// @Description Sync the dentist's CalDAV calendar without waiting for the next interval, for example right after connecting it
+// @Tags unavailability
+// @Produce json
+// @Param id path string true "Dentist ID"
+// @Success 200 {object} models.CalendarSync
+// @Failure 404 {object} apierror.Response "Calendar sync not found"
+// @Failure 502 {object} apierror.Response "Calendar could not be synced"
+// @Failure 500 {object} apierror.Response "Failed to retrieve calendar sync"
+// @Router /api/v1/dental/dentist/{id}/calendar-sync/run [post]
+func RunCalendarSync(w http.ResponseWriter, r *http.Request) {
+	cs, ok := loadCalendarSync(w, r)
+	if !ok {
+		return
+	}
+	if err := calendarsync.Sync(r.Context(), cs); err != nil {
+		http.Error(w, "Calendar could not be synced: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	cs, ok = loadCalendarSync(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cs)
+}
+
+// loadCalendarSync fetches the calendar sync of the dentist in the request path, writing the error response when it cannot be returned
+func loadCalendarSync(w http.ResponseWriter, r *http.Request) (models.CalendarSync, bool) {
+	dentistID := mux.Vars(r)["id"]
+	cs, err := getCalendarSync(r.Context(), dentistID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve calendar sync", http.StatusInternalServerError)
+		log.Printf("Error fetching calendar sync of dentist %s: %v", dentistID, err)
+		return models.CalendarSync{}, false
+	}
+	if cs == nil {
+		http.Error(w, "Calendar sync not found", http.StatusNotFound)
+		return models.CalendarSync{}, false
+	}
+	return *cs, true
+}
+
+func getCalendarSync(ctx context.Context, dentistID string) (*models.CalendarSync, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("CalendarSyncs"),
+		Key: map[string]types.AttributeValue{
+			"DentistID": &types.AttributeValueMemberS{Value: dentistID},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var cs models.CalendarSync
+	if err := attributevalue.UnmarshalMap(result.Item, &cs); err != nil {
+		return nil, err
+	}
+	cs.PasswordSet = cs.SealedPassword != ""
+	return &cs, nil
+}
+
+// scanUnavailability returns the dentist's blocks overlapping [from, to)
+func scanUnavailability(ctx context.Context, dentistID string, from, to time.Time) ([]models.Unavailability, error) {
+	return paging.ScanAll[models.Unavailability](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Unavailability"),
+		FilterExpression: aws.String("DentistID = :dentistId AND #start < :to AND #end > :from"),
+		ExpressionAttributeNames: map[string]string{
+			"#start": "Start",
+			"#end":   "End",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dentistId": &types.AttributeValueMemberS{Value: dentistID},
+			":from":      &types.AttributeValueMemberS{Value: from.UTC().Format(models.UnavailabilityLayout)},
+			":to":        &types.AttributeValueMemberS{Value: to.UTC().Format(models.UnavailabilityLayout)},
+		},
+	})
+}
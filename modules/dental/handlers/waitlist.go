@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateWaitlistEntry godoc
+// @Summary Add a patient to the waitlist
+// @Description Add a patient waiting for a time for a procedure, optionally with a dentist, the accepted dates and the preferred periods and weekdays. Waiting entries are offered first when a slot opens.
+// @Tags waitlist
+// @Accept json
+// @Produce json
+// @Param entry body models.WaitlistEntry true "Waitlist entry"
+// @Success 201 {object} models.WaitlistEntry
+// @Failure 400 {object} apierror.Response "Invalid request body, missing required fields or unknown patient or procedure"
+// @Failure 500 {object} apierror.Response "Failed to save waitlist entry"
+// @Router /api/v1/dental/waitlist [post]
+func CreateWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	var entry models.WaitlistEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := entry.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkWaitlistReferences(w, r, entry) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	entry.ID = uuid.NewString()
+	entry.ClinicID = ""
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+
+	if err := putWaitlistEntry(r.Context(), entry, "attribute_not_exists(ID)"); err != nil {
+		http.Error(w, "Failed to save waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error saving waitlist entry: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// GetWaitlist godoc
+// @Summary Get the waitlist
+// @Description Get the waitlist entries of the clinic, oldest first, optionally of a patient, procedure or status
+// @Tags waitlist
+// @Produce json
+// @Param patientId query string false "Only entries of this patient"
+// @Param procedureId query string false "Only entries for this procedure"
+// @Param status query string false "Only entries in this status (waiting, booked, removed)"
+// @Success 200 {array} models.WaitlistEntry
+// @Failure 400 {object} apierror.Response "Invalid status"
+// @Failure 500 {object} apierror.Response "Failed to retrieve waitlist"
+// @Router /api/v1/dental/waitlist [get]
+func GetWaitlist(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && !slices.Contains(models.WaitlistStatuses, status) {
+		http.Error(w, "status must be one of waiting, booked, removed", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := scanWaitlist(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve waitlist", http.StatusInternalServerError)
+		log.Printf("Error scanning waitlist: %v", err)
+		return
+	}
+
+	result := []models.WaitlistEntry{}
+	for _, entry := range entries {
+		if id := query.Get("patientId"); id != "" && entry.PatientID != id {
+			continue
+		}
+		if id := query.Get("procedureId"); id != "" && entry.ProcedureID != id {
+			continue
+		}
+		if status != "" && entry.Status != status {
+			continue
+		}
+		result = append(result, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetWaitlistEntryByID godoc
+// @Summary Get a waitlist entry by ID
+// @Description Get a waitlist entry of the clinic by its ID
+// @Tags waitlist
+// @Produce json
+// @Param id path string true "Waitlist entry ID"
+// @Success 200 {object} models.WaitlistEntry
+// @Failure 404 {object} apierror.Response "Waitlist entry not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve waitlist entry"
+// @Router /api/v1/dental/waitlist/{id} [get]
+func GetWaitlistEntryByID(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	entries, err := batchGetItems[models.WaitlistEntry](r.Context(), "Waitlist", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to retrieve waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error fetching waitlist entry %s: %v", id, err)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries[0])
+}
+
+// UpdateWaitlistEntry godoc
+// @Summary Update a waitlist entry
+// @Description Replace the data of a waitlist entry; set status to booked, with the appointment_id, once the patient is scheduled, or to removed when they no longer need the time
+// @Tags waitlist
+// @Accept json
+// @Produce json
+// @Param id path string true "Waitlist entry ID"
+// @Param entry body models.WaitlistEntry true "Waitlist entry"
+// @Success 200 {object} models.WaitlistEntry
+// @Failure 400 {object} apierror.Response "Invalid request body, missing required fields or unknown patient or procedure"
+// @Failure 404 {object} apierror.Response "Waitlist entry not found"
+// @Failure 500 {object} apierror.Response "Failed to update waitlist entry"
+// @Router /api/v1/dental/waitlist/{id} [put]
+func UpdateWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	entries, err := batchGetItems[models.WaitlistEntry](r.Context(), "Waitlist", []string{id})
+	if err != nil {
+		http.Error(w, "Failed to update waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error fetching waitlist entry %s: %v", id, err)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return
+	}
+
+	var entry models.WaitlistEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := entry.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkWaitlistReferences(w, r, entry) {
+		return
+	}
+	entry.ID = entries[0].ID
+	entry.ClinicID = entries[0].ClinicID
+	entry.CreatedAt = entries[0].CreatedAt
+	entry.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	err = putWaitlistEntry(r.Context(), entry, "attribute_exists(ID)")
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error updating waitlist entry %s: %v", entry.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// DeleteWaitlistEntry godoc
+// @Summary Delete a waitlist entry
+// @Description Remove an entry from the waitlist
+// @Tags waitlist
+// @Param id path string true "Waitlist entry ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Waitlist entry not found"
+// @Failure 500 {object} apierror.Response "Failed to delete waitlist entry"
+// @Router /api/v1/dental/waitlist/{id} [delete]
+func DeleteWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Waitlist"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error deleting waitlist entry %s: %v", id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkWaitlistReferences verifies the patient and procedure of an entry
+// exist, writing the error response when they do not
+func checkWaitlistReferences(w http.ResponseWriter, r *http.Request, entry models.WaitlistEntry) bool {
+	patient, err := getPatient(r, entry.PatientID)
+	if err != nil {
+		http.Error(w, "Failed to save waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s: %v", entry.PatientID, err)
+		return false
+	}
+	if patient == nil {
+		http.Error(w, "Patient not found", http.StatusBadRequest)
+		return false
+	}
+	procedures, err := batchGetItems[models.Procedure](r.Context(), "Procedures", []string{entry.ProcedureID})
+	if err != nil {
+		http.Error(w, "Failed to save waitlist entry", http.StatusInternalServerError)
+		log.Printf("Error fetching procedure %s: %v", entry.ProcedureID, err)
+		return false
+	}
+	if len(procedures) == 0 {
+		http.Error(w, "Procedure not found", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// scanWaitlist returns the waitlist entries of the clinic, oldest first
+func scanWaitlist(ctx context.Context) ([]models.WaitlistEntry, error) {
+	entries, err := paging.ScanAll[models.WaitlistEntry](ctx, &dynamodb.ScanInput{
+		TableName: aws.String("Waitlist"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt < entries[j].CreatedAt
+	})
+	return entries, nil
+}
+
+func putWaitlistEntry(ctx context.Context, entry models.WaitlistEntry, condition string) error {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Waitlist"),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+	})
+	return err
+}
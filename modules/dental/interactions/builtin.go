@@ -0,0 +1,129 @@
+package interactions
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"strings"
+)
+
+// groups are the drug classes of the builtin rules, by the class name a
+// catalog medication may have, with the active ingredients in each
+var groups = map[string][]string{
+	"nsaid":            {"ibuprofen", "ibuprofeno", "diclofenac", "diclofenaco", "naproxen", "naproxeno", "ketorolac", "cetorolaco", "nimesulide", "ketoprofen", "cetoprofeno", "meloxicam", "celecoxib", "piroxicam"},
+	"aspirin":          {"aspirin", "acetylsalicylic", "acetilsalicílico", "aas"},
+	"anticoagulant":    {"warfarin", "varfarina", "acenocoumarol", "rivaroxaban", "rivaroxabana", "apixaban", "apixabana", "dabigatran", "dabigatrana", "heparin", "heparina"},
+	"antiplatelet":     {"clopidogrel", "ticagrelor", "prasugrel"},
+	"antihypertensive": {"enalapril", "captopril", "lisinopril", "ramipril", "losartan", "losartana", "valsartan", "valsartana", "hydrochlorothiazide", "hidroclorotiazida", "furosemide", "furosemida"},
+	"lithium":          {"lithium", "lítio", "litio"},
+	"methotrexate":     {"methotrexate", "metotrexato"},
+	"metronidazole":    {"metronidazole", "metronidazol"},
+	"alcohol":          {"alcohol", "álcool", "alcool", "disulfiram", "dissulfiram"},
+	"vasoconstrictor":  {"epinephrine", "epinefrina", "adrenaline", "adrenalina", "norepinephrine", "noradrenalina", "felipressina", "felypressin"},
+	"beta_blocker":     {"propranolol", "nadolol", "sotalol", "timolol"},
+	"tricyclic":        {"amitriptyline", "amitriptilina", "nortriptyline", "nortriptilina", "imipramine", "imipramina", "clomipramine", "clomipramina"},
+	"macrolide":        {"erythromycin", "eritromicina", "clarithromycin", "claritromicina"},
+	"statin":           {"simvastatin", "sinvastatina", "atorvastatin", "atorvastatina", "lovastatin", "lovastatina"},
+	"azole":            {"fluconazole", "fluconazol", "ketoconazole", "cetoconazol", "itraconazole", "itraconazol"},
+	"benzodiazepine":   {"midazolam", "triazolam", "alprazolam"},
+	"penicillin":       {"amoxicillin", "amoxicilina", "ampicillin", "ampicilina", "penicillin", "penicilina"},
+	"contraceptive":    {"ethinylestradiol", "etinilestradiol", "levonorgestrel", "desogestrel", "contraceptive", "anticoncepcional"},
+	"tetracycline":     {"tetracycline", "tetraciclina", "doxycycline", "doxiciclina", "minocycline", "minociclina"},
+	"retinoid":         {"isotretinoin", "isotretinoína", "isotretinoina"},
+}
+
+// rule is an interaction between two groups, in either direction
+type rule struct {
+	a, b        string
+	severity    string
+	description string
+}
+
+// rules are well known interactions of the drugs prescribed in dentistry
+var rules = []rule{
+	{"nsaid", "anticoagulant", models.InteractionMajor, "NSAIDs raise the bleeding risk of anticoagulants"},
+	{"aspirin", "anticoagulant", models.InteractionMajor, "Aspirin raises the bleeding risk of anticoagulants"},
+	{"nsaid", "antiplatelet", models.InteractionModerate, "NSAIDs add to the bleeding risk of antiplatelet drugs"},
+	{"nsaid", "antihypertensive", models.InteractionModerate, "NSAIDs reduce the effect of antihypertensives and may impair kidney function"},
+	{"nsaid", "lithium", models.InteractionMajor, "NSAIDs raise lithium levels, with risk of toxicity"},
+	{"nsaid", "methotrexate", models.InteractionMajor, "NSAIDs reduce methotrexate clearance, with risk of toxicity"},
+	{"metronidazole", "anticoagulant", models.InteractionMajor, "Metronidazole potentiates warfarin and raises the bleeding risk"},
+	{"metronidazole", "alcohol", models.InteractionContraindicated, "Metronidazole with alcohol or disulfiram causes a disulfiram-like reaction"},
+	{"vasoconstrictor", "beta_blocker", models.InteractionMajor, "Epinephrine with non-selective beta blockers may cause severe hypertension and bradycardia; limit the anesthetic dose"},
+	{"vasoconstrictor", "tricyclic", models.InteractionModerate, "Tricyclic antidepressants enhance the pressor effect of vasoconstrictors; limit the anesthetic dose"},
+	{"macrolide", "statin", models.InteractionMajor, "Macrolides raise statin levels, with risk of myopathy"},
+	{"macrolide", "anticoagulant", models.InteractionModerate, "Macrolides may potentiate warfarin"},
+	{"azole", "anticoagulant", models.InteractionMajor, "Azole antifungals potentiate warfarin and raise the bleeding risk"},
+	{"azole", "benzodiazepine", models.InteractionMajor, "Azole antifungals raise benzodiazepine levels, with prolonged sedation"},
+	{"penicillin", "methotrexate", models.InteractionModerate, "Penicillins reduce methotrexate clearance"},
+	{"penicillin", "contraceptive", models.InteractionMinor, "Antibiotics may reduce the effect of oral contraceptives; advise a backup method"},
+	{"tetracycline", "retinoid", models.InteractionContraindicated, "Tetracyclines with isotretinoin raise the risk of intracranial hypertension"},
+}
+
+// BuiltinChecker checks a short list of well known interactions of the drugs
+// used in dentistry. Medications in the anamnesis are matched by active
+// ingredient in their written name, so brand names are not recognized.
+type BuiltinChecker struct{}
+
+// Name identifies the checker in the results
+func (BuiltinChecker) Name() string {
+	return "builtin"
+}
+
+// Check matches every prescribed medication against every medication in use
+func (c BuiltinChecker) Check(_ context.Context, prescribed []models.Medication, current []string) ([]models.MedicationInteraction, error) {
+	var interactions []models.MedicationInteraction
+	for _, medication := range prescribed {
+		prescribedGroups := medicationGroups(medication)
+		for _, entry := range current {
+			entryGroups := textGroups(entry)
+			for _, r := range rules {
+				if !(prescribedGroups[r.a] && entryGroups[r.b]) && !(prescribedGroups[r.b] && entryGroups[r.a]) {
+					continue
+				}
+				interactions = append(interactions, models.MedicationInteraction{
+					MedicationID: medication.ID,
+					Medication:   medication.Name,
+					With:         entry,
+					Severity:     r.severity,
+					Description:  r.description,
+					Source:       c.Name(),
+				})
+			}
+		}
+	}
+	return interactions, nil
+}
+
+// medicationGroups returns the groups of a catalog medication, by its class
+// and active ingredient
+func medicationGroups(medication models.Medication) map[string]bool {
+	found := textGroups(medication.ActiveIngredient + " " + medication.Name)
+	if class := strings.ToLower(strings.TrimSpace(medication.Class)); groups[class] != nil {
+		found[class] = true
+	}
+	return found
+}
+
+// textGroups returns the groups whose name or ingredients are words of text
+func textGroups(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r > 127)
+	}) {
+		words[word] = true
+	}
+	found := make(map[string]bool)
+	for group, ingredients := range groups {
+		if words[group] {
+			found[group] = true
+			continue
+		}
+		for _, ingredient := range ingredients {
+			if words[ingredient] {
+				found[group] = true
+				break
+			}
+		}
+	}
+	return found
+}
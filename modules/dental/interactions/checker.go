@@ -0,0 +1,35 @@
+package interactions
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Checker looks up the interactions between prescribed medications and the
+// medications a patient already takes, as written in the anamnesis
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, prescribed []models.Medication, current []string) ([]models.MedicationInteraction, error)
+}
+
+// NewCheckerFromEnv returns the checker selected by the INTERACTION_PROVIDER
+// environment variable ("builtin" by default, or "http", a reference service
+// at INTERACTION_CHECK_URL)
+func NewCheckerFromEnv() (Checker, error) {
+	switch os.Getenv("INTERACTION_PROVIDER") {
+	case "", "builtin":
+		return BuiltinChecker{}, nil
+	case "http":
+		url := os.Getenv("INTERACTION_CHECK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("INTERACTION_CHECK_URL is required for the http interaction provider")
+		}
+		return &HTTPChecker{URL: url, Token: os.Getenv("INTERACTION_CHECK_TOKEN"), Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("unknown interaction provider %q", os.Getenv("INTERACTION_PROVIDER"))
+	}
+}
@@ -0,0 +1,76 @@
+package interactions
+
+import (
+	"bytes"
+	"context"
+	"dental-saas/modules/dental/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPChecker asks an external drug interaction reference. It posts
+// {"prescribed": [medications], "current": [names]} as JSON and expects
+// {"interactions": [interactions]} back, with medication_id naming the
+// prescribed medication of each interaction.
+type HTTPChecker struct {
+	URL    string
+	Token  string // sent as a bearer token when set
+	Client *http.Client
+}
+
+// Name identifies the checker in the results
+func (c *HTTPChecker) Name() string {
+	return "http"
+}
+
+// Check posts the medications to the reference service
+func (c *HTTPChecker) Check(ctx context.Context, prescribed []models.Medication, current []string) ([]models.MedicationInteraction, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"prescribed": prescribed,
+		"current":    current,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("interaction reference returned %s", resp.Status)
+	}
+
+	var result struct {
+		Interactions []models.MedicationInteraction `json:"interactions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid interaction reference response: %v", err)
+	}
+	names := make(map[string]string, len(prescribed))
+	for _, medication := range prescribed {
+		names[medication.ID] = medication.Name
+	}
+	for i := range result.Interactions {
+		interaction := &result.Interactions[i]
+		if interaction.Medication == "" {
+			interaction.Medication = names[interaction.MedicationID]
+		}
+		if interaction.Source == "" {
+			interaction.Source = c.Name()
+		}
+	}
+	return result.Interactions, nil
+}
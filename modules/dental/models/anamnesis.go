@@ -0,0 +1,231 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tipos de pergunta da anamnese
+const (
+	QuestionYesNo          = "yes_no"          // resposta yes ou no, com detalhes opcionais
+	QuestionText           = "text"            // texto livre
+	QuestionChoice         = "choice"          // uma das opções
+	QuestionMultipleChoice = "multiple_choice" // várias das opções
+	QuestionList           = "list"            // lista livre, como os medicamentos em uso
+)
+
+// Campos da ficha do paciente alimentados pelas respostas
+const (
+	AnamnesisAllergies   = "allergies"
+	AnamnesisMedications = "medications"
+	AnamnesisConditions  = "conditions"
+)
+
+// QuestionTypes e AnamnesisFields listam os valores aceitos
+var (
+	QuestionTypes   = []string{QuestionYesNo, QuestionText, QuestionChoice, QuestionMultipleChoice, QuestionList}
+	AnamnesisFields = []string{AnamnesisAllergies, AnamnesisMedications, AnamnesisConditions}
+)
+
+// AnamnesisQuestion representa uma pergunta do modelo de anamnese
+type AnamnesisQuestion struct {
+	ID       string   `json:"id"` // gerado quando não informado; mantido nas alterações do modelo
+	Text     string   `json:"text"`
+	Type     string   `json:"type"`
+	Options  []string `json:"options,omitempty" dynamodbav:",omitempty"` // nas perguntas de escolha
+	Required bool     `json:"required,omitempty" dynamodbav:",omitempty"`
+	Field    string   `json:"field,omitempty" dynamodbav:",omitempty"` // allergies, medications ou conditions, quando a resposta alimenta a ficha
+}
+
+// AnamnesisTemplate representa um questionário de anamnese definido pela
+// clínica
+type AnamnesisTemplate struct {
+	ID          string              `json:"id"`
+	ClinicID    string              `json:"clinic_id,omitempty"` // clínica dona do registro
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty" dynamodbav:",omitempty"`
+	Questions   []AnamnesisQuestion `json:"questions"`
+	Active      bool                `json:"active"` // somente modelos ativos são usados em novas anamneses
+	CreatedAt   string              `json:"created_at"`
+	UpdatedAt   string              `json:"updated_at"`
+	Version     int64               `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica o nome e as perguntas do modelo
+func (t *AnamnesisTemplate) IsValid() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(t.Questions) == 0 {
+		return fmt.Errorf("at least one question is required")
+	}
+	ids := make(map[string]bool, len(t.Questions))
+	for _, question := range t.Questions {
+		if strings.TrimSpace(question.Text) == "" {
+			return fmt.Errorf("text is required for every question")
+		}
+		if !oneOf(QuestionTypes, question.Type) {
+			return fmt.Errorf("type of %q must be one of %s", question.Text, strings.Join(QuestionTypes, ", "))
+		}
+		choice := question.Type == QuestionChoice || question.Type == QuestionMultipleChoice
+		if choice && len(question.Options) == 0 {
+			return fmt.Errorf("options are required for %q", question.Text)
+		}
+		if !choice && len(question.Options) > 0 {
+			return fmt.Errorf("options are only accepted in choice questions")
+		}
+		if question.Field != "" && !oneOf(AnamnesisFields, question.Field) {
+			return fmt.Errorf("field of %q must be one of %s", question.Text, strings.Join(AnamnesisFields, ", "))
+		}
+		if question.ID != "" && ids[question.ID] {
+			return fmt.Errorf("question ID %s is repeated", question.ID)
+		}
+		ids[question.ID] = true
+	}
+	return nil
+}
+
+// AnamnesisAnswer representa a resposta a uma pergunta, com o texto e o
+// tipo da pergunta como estavam ao responder
+type AnamnesisAnswer struct {
+	QuestionID string   `json:"question_id"`
+	Question   string   `json:"question"`
+	Type       string   `json:"type"`
+	Answer     string   `json:"answer,omitempty" dynamodbav:",omitempty"` // yes_no, text e choice
+	Items      []string `json:"items,omitempty" dynamodbav:",omitempty"`  // multiple_choice e list
+	Details    string   `json:"details,omitempty" dynamodbav:",omitempty"`
+}
+
+// Empty informa se a pergunta ficou sem resposta
+func (a *AnamnesisAnswer) Empty() bool {
+	return strings.TrimSpace(a.Answer) == "" && len(a.Items) == 0
+}
+
+// Anamnesis representa uma versão da anamnese do paciente. Cada
+// preenchimento grava uma nova versão, e as anteriores são mantidas.
+type Anamnesis struct {
+	PatientID    string            `json:"patient_id"`
+	Version      int64             `json:"version"` // 1 no primeiro preenchimento, aumentada a cada novo
+	ClinicID     string            `json:"clinic_id,omitempty"`
+	TemplateID   string            `json:"template_id"`
+	TemplateName string            `json:"template_name"`
+	Answers      []AnamnesisAnswer `json:"answers,omitempty" dynamodbav:",omitempty"`
+	Allergies    []string          `json:"allergies"`
+	Medications  []string          `json:"medications"`
+	Conditions   []string          `json:"conditions"`
+	Notes        string            `json:"notes,omitempty" dynamodbav:",omitempty"`
+	RecordedAt   string            `json:"recorded_at"`
+	RecordedBy   string            `json:"recorded_by,omitempty" dynamodbav:",omitempty"`
+}
+
+// Answer confere as respostas com as perguntas do modelo, completando-as com
+// o texto e o tipo da pergunta, e preenche alergias, medicamentos e condições
+// com as respostas das perguntas que alimentam a ficha
+func (a *Anamnesis) Answer(template AnamnesisTemplate) error {
+	given := make(map[string]AnamnesisAnswer, len(a.Answers))
+	for _, answer := range a.Answers {
+		given[answer.QuestionID] = answer
+	}
+	fields := map[string]*[]string{
+		AnamnesisAllergies:   &a.Allergies,
+		AnamnesisMedications: &a.Medications,
+		AnamnesisConditions:  &a.Conditions,
+	}
+
+	answers := make([]AnamnesisAnswer, 0, len(template.Questions))
+	for _, question := range template.Questions {
+		answer, ok := given[question.ID]
+		delete(given, question.ID)
+		if !ok || answer.Empty() {
+			if question.Required {
+				return fmt.Errorf("%q must be answered", question.Text)
+			}
+			continue
+		}
+		answer.Question = question.Text
+		answer.Type = question.Type
+		answer.Answer = strings.TrimSpace(answer.Answer)
+		answer.Items = trimmed(answer.Items)
+		if err := answer.check(question); err != nil {
+			return err
+		}
+		answers = append(answers, answer)
+
+		if target := fields[question.Field]; target != nil {
+			switch {
+			case len(answer.Items) > 0:
+				*target = append(*target, answer.Items...)
+			case question.Type == QuestionYesNo:
+				if answer.Answer == "yes" && strings.TrimSpace(answer.Details) != "" {
+					*target = append(*target, strings.TrimSpace(answer.Details))
+				}
+			default:
+				*target = append(*target, answer.Answer)
+			}
+		}
+	}
+	for id := range given {
+		return fmt.Errorf("question %s is not in the template", id)
+	}
+
+	a.Answers = answers
+	a.TemplateID = template.ID
+	a.TemplateName = template.Name
+	for _, target := range fields {
+		*target = unique(trimmed(*target))
+	}
+	return nil
+}
+
+// check verifica a resposta conforme o tipo da pergunta
+func (a *AnamnesisAnswer) check(question AnamnesisQuestion) error {
+	switch question.Type {
+	case QuestionYesNo:
+		if a.Answer != "yes" && a.Answer != "no" {
+			return fmt.Errorf("answer to %q must be yes or no", question.Text)
+		}
+	case QuestionChoice:
+		if !oneOf(question.Options, a.Answer) {
+			return fmt.Errorf("answer to %q must be one of %s", question.Text, strings.Join(question.Options, ", "))
+		}
+	case QuestionMultipleChoice:
+		for _, item := range a.Items {
+			if !oneOf(question.Options, item) {
+				return fmt.Errorf("answers to %q must be among %s", question.Text, strings.Join(question.Options, ", "))
+			}
+		}
+	}
+	multiple := question.Type == QuestionMultipleChoice || question.Type == QuestionList
+	if multiple && a.Answer != "" {
+		return fmt.Errorf("answers to %q go in items", question.Text)
+	}
+	if !multiple && len(a.Items) > 0 {
+		return fmt.Errorf("answer to %q goes in answer", question.Text)
+	}
+	return nil
+}
+
+// trimmed retorna os valores sem espaços nas pontas, sem os vazios
+func trimmed(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// unique retorna os valores sem repetições, ignorando maiúsculas, na ordem
+// em que aparecem
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := []string{}
+	for _, value := range values {
+		if key := strings.ToLower(value); !seen[key] {
+			seen[key] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
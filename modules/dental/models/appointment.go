@@ -1,9 +1,34 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Status conhecidos de um agendamento
+const (
+	AppointmentStatusScheduled = "scheduled"
+	AppointmentStatusConfirmed = "confirmed"
+	AppointmentStatusCompleted = "completed"
+	AppointmentStatusCancelled = "cancelled"
+	AppointmentStatusNoShow    = "no_show"
+)
+
+// DefaultAppointmentDuration é usada quando o agendamento não informa a duração (em minutos)
+const DefaultAppointmentDuration = 30
+
+var appointmentTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
 
 type Appointment struct {
 	ID          string `json:"id"`
+	ClinicID    string `json:"clinic_id,omitempty"` // clínica dona do registro
 	DentistID   string `json:"dentist_id"`
 	PatientID   string `json:"patient_id"`
 	ProcedureID string `json:"procedure_id,omitempty"`
@@ -13,6 +38,75 @@ type Appointment struct {
 	Notes       string `json:"notes,omitempty"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+	Version     int64  `json:"version"` // versão do registro, aumentada a cada alteração
+
+	// Preenchidos quando o agendamento faz parte de uma série criada a partir de um pacote
+	BundleID string `json:"bundle_id,omitempty"`
+	SeriesID string `json:"series_id,omitempty"`
+	Price    string `json:"price,omitempty"` // parcela do preço do pacote atribuída ao procedimento
+
+	// Plano de tratamento cujo item originou o agendamento
+	TreatmentPlanID string `json:"treatment_plan_id,omitempty" dynamodbav:",omitempty"`
+
+	// Campanha que originou o agendamento, capturada em agendamentos online
+	CampaignAttribution
+
+	// Quando o lembrete com o link de autoatendimento foi enviado ao paciente
+	ReminderSentAt string `json:"reminder_sent_at,omitempty"`
+
+	// Quando o lembrete por SMS ou WhatsApp foi enviado ao paciente
+	TextReminderSentAt string `json:"text_reminder_sent_at,omitempty" dynamodbav:",omitempty"`
+
+	// Quando o paciente avisou que estava perto e quando chegou, e quem avisou
+	NearbyAt      string `json:"nearby_at,omitempty" dynamodbav:",omitempty"`
+	ArrivedAt     string `json:"arrived_at,omitempty" dynamodbav:",omitempty"`
+	ArrivalSource string `json:"arrival_source,omitempty" dynamodbav:",omitempty"`
+
+	// Início e fim reais do atendimento, registrados pela equipe
+	StartedAt  string `json:"started_at,omitempty" dynamodbav:",omitempty"`
+	FinishedAt string `json:"finished_at,omitempty" dynamodbav:",omitempty"`
+
+	// IDs do agendamento no software anterior, preenchidos na importação
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty" dynamodbav:",omitempty"`
+
+	// Quando o registro foi removido; removidos ficam ocultos até serem restaurados
+	DeletedAt string `json:"deleted_at,omitempty" dynamodbav:",omitempty"`
+
+	// Rótulo e cor (#RRGGBB) definidos pela equipe; quando vazios valem os do procedimento
+	Label string `json:"label,omitempty" dynamodbav:",omitempty"`
+	Color string `json:"color,omitempty" dynamodbav:",omitempty"`
+	// Rótulo e cor efetivos, calculados na leitura das listagens e da agenda
+	Display *AppointmentDisplay `json:"display,omitempty" dynamodbav:"-"`
+
+	// Entidades relacionadas, preenchidas apenas quando solicitadas via ?expand=
+	Patient   *Patient   `json:"patient,omitempty" dynamodbav:"-"`
+	Dentist   *Dentist   `json:"dentist,omitempty" dynamodbav:"-"`
+	Procedure *Procedure `json:"procedure,omitempty" dynamodbav:"-"`
+}
+
+// KeepServerFields copia do registro gravado os campos que o cliente não
+// altera (ID, clínica, criação, remoção, pacote, plano de tratamento, campanha,
+// lembrete e horários reais) ao substituir ou modificar o agendamento, e
+// descarta as entidades expandidas e a exibição calculada
+func (a *Appointment) KeepServerFields(stored Appointment) {
+	a.ID = stored.ID
+	a.ClinicID = stored.ClinicID
+	a.CreatedAt = stored.CreatedAt
+	a.DeletedAt = stored.DeletedAt
+	a.BundleID = stored.BundleID
+	a.SeriesID = stored.SeriesID
+	a.Price = stored.Price
+	a.TreatmentPlanID = stored.TreatmentPlanID
+	a.CampaignAttribution = stored.CampaignAttribution
+	a.ReminderSentAt = stored.ReminderSentAt
+	a.TextReminderSentAt = stored.TextReminderSentAt
+	a.NearbyAt = stored.NearbyAt
+	a.ArrivedAt = stored.ArrivedAt
+	a.ArrivalSource = stored.ArrivalSource
+	a.StartedAt = stored.StartedAt
+	a.FinishedAt = stored.FinishedAt
+	a.Patient, a.Dentist, a.Procedure = nil, nil, nil
+	a.Display = nil
 }
 
 // IsValid verifica se os campos obrigatórios do agendamento estão preenchidos
@@ -29,6 +123,69 @@ func (a *Appointment) IsValid() error {
 	if a.Status == "" {
 		return fmt.Errorf("status is required")
 	}
+	if err := validColor(a.Color); err != nil {
+		return err
+	}
+	if err := a.ExternalIDs.IsValid(); err != nil {
+		return err
+	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// StartTime interpreta o campo DateTime do agendamento
+func (a *Appointment) StartTime() (time.Time, error) {
+	return parseAppointmentTime(a.DateTime)
+}
+
+// parseAppointmentTime interpreta uma data e hora em um dos formatos aceitos na agenda
+func parseAppointmentTime(value string) (time.Time, error) {
+	for _, layout := range appointmentTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date and time %q", value)
+}
+
+// ActualMinutes retorna quantos minutos o atendimento durou, quando o início e
+// o fim foram registrados
+func (a *Appointment) ActualMinutes() (float64, bool) {
+	started, err := time.Parse(time.RFC3339, a.StartedAt)
+	if err != nil {
+		return 0, false
+	}
+	finished, err := time.Parse(time.RFC3339, a.FinishedAt)
+	if err != nil || !finished.After(started) {
+		return 0, false
+	}
+	return finished.Sub(started).Minutes(), true
+}
+
+// DurationMinutes retorna a duração do agendamento em minutos, usando o padrão quando ausente ou inválida
+func (a *Appointment) DurationMinutes() int {
+	minutes, err := strconv.Atoi(a.Duration)
+	if err != nil || minutes <= 0 {
+		return DefaultAppointmentDuration
+	}
+	return minutes
+}
+
+// IsCancelled indica se o agendamento não ocupa mais a agenda
+func (a *Appointment) IsCancelled() bool {
+	return a.Status == AppointmentStatusCancelled || a.Status == "canceled"
+}
+
+// CalendarDay representa os agendamentos de um dia do calendário, em ordem de horário
+type CalendarDay struct {
+	Date         string        `json:"date"`
+	Appointments []Appointment `json:"appointments"`
+}
+
+// Day retorna o dia (YYYY-MM-DD) do agendamento, como gravado em DateTime
+func (a *Appointment) Day() string {
+	if len(a.DateTime) < len("2006-01-02") {
+		return ""
+	}
+	return a.DateTime[:len("2006-01-02")]
+}
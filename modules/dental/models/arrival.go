@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Eventos de chegada do paciente, enviados pelo aplicativo (cerca geográfica),
+// pelo totem de check-in ou pela recepção
+const (
+	ArrivalNearby  = "nearby"  // o paciente está perto da clínica
+	ArrivalArrived = "arrived" // o paciente chegou
+)
+
+// ArrivalRequest representa o aviso de que o paciente está perto ou chegou.
+// Informe o agendamento ou, sem ele, o paciente, cuja consulta de hoje é
+// localizada.
+type ArrivalRequest struct {
+	AppointmentID string `json:"appointment_id,omitempty"`
+	PatientID     string `json:"patient_id,omitempty"`
+	Event         string `json:"event,omitempty"`  // nearby ou arrived (padrão)
+	Source        string `json:"source,omitempty"` // quem avisou, como app, kiosk ou front_desk
+	At            string `json:"at,omitempty"`     // RFC 3339, padrão agora
+}
+
+// IsValid confere o evento, usando arrived quando ausente
+func (r *ArrivalRequest) IsValid() error {
+	if r.Event == "" {
+		r.Event = ArrivalArrived
+	}
+	if r.Event != ArrivalNearby && r.Event != ArrivalArrived {
+		return fmt.Errorf("event must be %s or %s", ArrivalNearby, ArrivalArrived)
+	}
+	if len(r.Source) > 50 {
+		return fmt.Errorf("source must have at most 50 characters")
+	}
+	return nil
+}
+
+// Time interpreta o momento do aviso, que não pode estar no futuro
+func (r *ArrivalRequest) Time(now time.Time) (time.Time, error) {
+	request := AppointmentTimeRequest{At: r.At}
+	return request.Time(now)
+}
+
+// Situações de um agendamento na fila de atendimento do dia
+const (
+	QueueInProgress = "in_progress" // em atendimento
+	QueueArrived    = "arrived"     // aguardando na recepção
+	QueueNearby     = "nearby"      // a caminho, perto da clínica
+	QueueExpected   = "expected"    // ainda não chegou
+	QueueDone       = "done"        // atendimento concluído
+)
+
+// QueueEntry representa um agendamento na fila de atendimento
+type QueueEntry struct {
+	AppointmentID  string `json:"appointment_id"`
+	PatientID      string `json:"patient_id"`
+	PatientName    string `json:"patient_name"`
+	DentistID      string `json:"dentist_id"`
+	DentistName    string `json:"dentist_name"`
+	DateTime       string `json:"date_time"`
+	State          string `json:"state"`
+	NearbyAt       string `json:"nearby_at,omitempty"`
+	ArrivedAt      string `json:"arrived_at,omitempty"`
+	StartedAt      string `json:"started_at,omitempty"`
+	WaitingMinutes int    `json:"waiting_minutes,omitempty"` // desde a chegada, enquanto aguarda
+	Late           bool   `json:"late,omitempty"`            // horário passou e o paciente não chegou
+}
+
+// Queue representa a fila de atendimento de um dia: em atendimento, aguardando
+// (por ordem de chegada), a caminho, esperados e concluídos
+type Queue struct {
+	Date      string       `json:"date"`
+	Entries   []QueueEntry `json:"entries"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Categorias de anexo do paciente
+const (
+	AttachmentRadiograph = "radiograph" // radiografias e tomografias
+	AttachmentConsent    = "consent"    // termos e formulários assinados
+	AttachmentLabReport  = "lab_report" // laudos e exames de laboratório
+	AttachmentPhoto      = "photo"
+	AttachmentOther      = "other"
+)
+
+// AttachmentCategories lista as categorias aceitas
+var AttachmentCategories = []string{AttachmentRadiograph, AttachmentConsent, AttachmentLabReport, AttachmentPhoto, AttachmentOther}
+
+// Attachment representa um arquivo do paciente, como uma radiografia ou um
+// laudo. O arquivo fica no armazenamento de arquivos, e o registro guarda
+// os seus dados.
+type Attachment struct {
+	PatientID   string `json:"patient_id"`
+	ID          string `json:"id"`                  // ordena os anexos do paciente pelo envio
+	ClinicID    string `json:"clinic_id,omitempty"` // clínica dona do registro
+	Name        string `json:"name"`                // nome do arquivo enviado
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"` // em bytes
+	Category    string `json:"category"`
+	Description string `json:"description,omitempty" dynamodbav:",omitempty"`
+	StorageKey  string `json:"-"` // chave do arquivo no armazenamento
+	UploadedAt  string `json:"uploaded_at"`
+	UploadedBy  string `json:"uploaded_by,omitempty" dynamodbav:",omitempty"`
+}
+
+// IsValid verifica o nome e a categoria, preenchendo a categoria padrão
+func (a *Attachment) IsValid() error {
+	if strings.TrimSpace(a.Name) == "" {
+		return fmt.Errorf("file name is required")
+	}
+	if a.Category == "" {
+		a.Category = AttachmentOther
+	}
+	if !oneOf(AttachmentCategories, a.Category) {
+		return fmt.Errorf("category must be one of %s", strings.Join(AttachmentCategories, ", "))
+	}
+	return nil
+}
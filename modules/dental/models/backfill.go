@@ -0,0 +1,41 @@
+package models
+
+// Origens dos candidatos a ocupar um horário vago
+const (
+	BackfillWaitlist = "waitlist"          // paciente na lista de espera
+	BackfillEarlier  = "later_appointment" // paciente com consulta marcada para depois, que pode ser antecipada
+	BackfillRecall   = "recall"            // paciente com o retorno periódico vencido
+)
+
+// BackfillSlot representa o horário vago a ocupar
+type BackfillSlot struct {
+	DentistID     string `json:"dentist_id"`
+	DateTime      string `json:"date_time"`
+	Duration      int    `json:"duration"`                 // em minutos
+	ProcedureID   string `json:"procedure_id,omitempty"`   // do agendamento cancelado, quando informado
+	AppointmentID string `json:"appointment_id,omitempty"` // agendamento cancelado que abriu o horário
+}
+
+// BackfillCandidate representa um paciente que pode ocupar o horário, com a
+// pontuação que o ordena e os motivos dela
+type BackfillCandidate struct {
+	Source        string   `json:"source"` // waitlist, later_appointment ou recall
+	PatientID     string   `json:"patient_id"`
+	PatientName   string   `json:"patient_name"`
+	Phone         string   `json:"phone,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	ProcedureID   string   `json:"procedure_id,omitempty"`
+	EntryID       string   `json:"waitlist_entry_id,omitempty"` // entrada da lista de espera
+	AppointmentID string   `json:"appointment_id,omitempty"`    // consulta que seria antecipada
+	CurrentTime   string   `json:"current_date_time,omitempty"` // horário atual dessa consulta
+	LastVisit     string   `json:"last_visit,omitempty"`        // última consulta concluída, no retorno
+	Score         float64  `json:"score"`                       // de 0 a 100, maior é melhor
+	Reasons       []string `json:"reasons"`
+}
+
+// BackfillCandidates representa os candidatos a ocupar um horário vago, do
+// melhor para o pior
+type BackfillCandidates struct {
+	Slot       BackfillSlot        `json:"slot"`
+	Candidates []BackfillCandidate `json:"candidates"`
+}
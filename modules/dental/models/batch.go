@@ -0,0 +1,34 @@
+package models
+
+import "fmt"
+
+// MaxBatchGetIDs é o limite de IDs por requisição de busca em lote (limite do BatchGetItem)
+const MaxBatchGetIDs = 100
+
+// BatchGetRequest representa uma busca em lote por lista de IDs
+type BatchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// IsValid verifica se a lista de IDs está preenchida e dentro do limite, removendo duplicados
+func (b *BatchGetRequest) IsValid() error {
+	seen := make(map[string]bool, len(b.IDs))
+	unique := b.IDs[:0]
+	for _, id := range b.IDs {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	b.IDs = unique
+
+	if len(b.IDs) == 0 {
+		return fmt.Errorf("at least one ID is required")
+	}
+	if len(b.IDs) > MaxBatchGetIDs {
+		return fmt.Errorf("at most %d IDs are allowed", MaxBatchGetIDs)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package models
+
+// BenchmarkPeriod representa os indicadores de um mês; grupos com menos
+// pacientes que o mínimo exigido são suprimidos e ficam sem valores
+type BenchmarkPeriod struct {
+	Period        string   `json:"period"` // 2006-01
+	Visits        *int     `json:"visits,omitempty"`
+	AverageTicket *float64 `json:"average_ticket,omitempty"`
+	Suppressed    bool     `json:"suppressed,omitempty"`
+}
+
+// BenchmarkProcedureShare representa a participação de um procedimento nas consultas do período
+type BenchmarkProcedureShare struct {
+	Procedure string  `json:"procedure"` // "other" agrupa os procedimentos com poucos pacientes
+	Share     float64 `json:"share"`     // percentual das consultas
+}
+
+// BenchmarkTotals soma apenas os meses não suprimidos, para que os totais não revelem os suprimidos
+type BenchmarkTotals struct {
+	Visits        int      `json:"visits"`
+	AverageTicket *float64 `json:"average_ticket,omitempty"`
+}
+
+// BenchmarkExport representa os indicadores desidentificados da clínica para comparação entre clínicas
+type BenchmarkExport struct {
+	ClinicToken  string                    `json:"clinic_token,omitempty"` // pseudônimo estável da clínica
+	From         string                    `json:"from"`
+	To           string                    `json:"to"`
+	MinGroupSize int                       `json:"min_group_size"` // k: menor número de pacientes distintos por grupo publicado
+	Periods      []BenchmarkPeriod         `json:"periods"`
+	ProcedureMix []BenchmarkProcedureShare `json:"procedure_mix"`
+	Totals       BenchmarkTotals           `json:"totals"`
+}
+
+// BenchmarkSettings representa a adesão de uma clínica ao benchmarking; sem
+// ela, a clínica não exporta seus indicadores
+type BenchmarkSettings struct {
+	ClinicID  string `json:"clinic_id"`
+	OptIn     bool   `json:"opt_in"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import "fmt"
+
+// BundleItem representa um procedimento do catálogo incluído em um pacote
+type BundleItem struct {
+	ProcedureID string `json:"procedure_id"`
+	Quantity    int    `json:"quantity,omitempty"` // padrão: 1
+}
+
+// Bundle representa um pacote de procedimentos vendido por um preço combinado
+type Bundle struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Price       string       `json:"price"`
+	Items       []BundleItem `json:"items"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"updated_at"`
+	Version     int64        `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica se os campos obrigatórios do pacote estão preenchidos
+func (b *Bundle) IsValid() error {
+	if b.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if b.Price == "" {
+		return fmt.Errorf("price is required")
+	}
+	if _, err := b.PriceValue(); err != nil {
+		return err
+	}
+	if len(b.Items) == 0 {
+		return fmt.Errorf("at least one procedure is required")
+	}
+	for i := range b.Items {
+		if b.Items[i].ProcedureID == "" {
+			return fmt.Errorf("procedure ID is required for every item")
+		}
+		if b.Items[i].Quantity < 0 {
+			return fmt.Errorf("quantity must not be negative")
+		}
+		if b.Items[i].Quantity == 0 {
+			b.Items[i].Quantity = 1
+		}
+	}
+	return nil
+}
+
+// PriceValue interpreta o preço do pacote com as mesmas regras do procedimento
+func (b *Bundle) PriceValue() (float64, error) {
+	return (&Procedure{Price: b.Price}).PriceValue()
+}
+
+// BundleBookingRequest representa o agendamento de um pacote como uma série de consultas
+type BundleBookingRequest struct {
+	PatientID string `json:"patient_id"`
+	DentistID string `json:"dentist_id"`
+	Start     string `json:"start"`      // data e hora da primeira consulta
+	DaysApart int    `json:"days_apart"` // 0 agenda os procedimentos em sequência no mesmo dia
+	Notes     string `json:"notes,omitempty"`
+}
+
+// IsValid verifica se os campos obrigatórios do agendamento do pacote estão preenchidos
+func (b *BundleBookingRequest) IsValid() error {
+	if b.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if b.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	if b.Start == "" {
+		return fmt.Errorf("start is required")
+	}
+	if _, err := (&Appointment{DateTime: b.Start}).StartTime(); err != nil {
+		return err
+	}
+	if b.DaysApart < 0 {
+		return fmt.Errorf("days_apart must not be negative")
+	}
+	return nil
+}
+
+// BundleSeries representa as consultas criadas ao agendar um pacote
+type BundleSeries struct {
+	SeriesID     string        `json:"series_id"`
+	BundleID     string        `json:"bundle_id"`
+	Price        string        `json:"price"`
+	Appointments []Appointment `json:"appointments"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import "fmt"
+
+// CampaignAttribution representa os parâmetros UTM da campanha que originou um agendamento
+type CampaignAttribution struct {
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+}
+
+// HasCampaign indica se algum parâmetro UTM foi capturado
+func (c CampaignAttribution) HasCampaign() bool {
+	return c.UTMSource != "" || c.UTMMedium != "" || c.UTMCampaign != ""
+}
+
+// BookingRequest representa um pedido de agendamento feito pelo site ou outro canal público
+type BookingRequest struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	DentistID   string `json:"dentist_id"`
+	ProcedureID string `json:"procedure_id,omitempty"`
+	DateTime    string `json:"date_time"`
+	Notes       string `json:"notes,omitempty"`
+	CampaignAttribution
+}
+
+// IsValid verifica se os campos obrigatórios do pedido de agendamento estão preenchidos
+func (b *BookingRequest) IsValid() error {
+	if b.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if b.Email == "" {
+		return fmt.Errorf("email is required")
+	}
+	if b.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	if b.DateTime == "" {
+		return fmt.Errorf("date and time is required")
+	}
+	if _, err := (&Appointment{DateTime: b.DateTime}).StartTime(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BookingSlots representa os horários livres oferecidos no agendamento online,
+// por dentista habilitado a realizar o procedimento procurado
+type BookingSlots struct {
+	ProcedureID string         `json:"procedure_id,omitempty"`
+	Duration    int            `json:"duration"` // em minutos
+	From        string         `json:"from"`
+	To          string         `json:"to"`
+	Dentists    []DentistSlots `json:"dentists"`
+}
+
+// DentistSlots representa os horários livres de um dentista
+type DentistSlots struct {
+	DentistID   string   `json:"dentist_id"`
+	DentistName string   `json:"dentist_name"`
+	Slots       []string `json:"slots"`
+}
+
+// CampaignPerformance representa o desempenho de uma campanha no período
+type CampaignPerformance struct {
+	CampaignAttribution
+	Bookings  int     `json:"bookings"`
+	Completed int     `json:"completed"`
+	NoShows   int     `json:"no_shows"`
+	Cancelled int     `json:"cancelled"`
+	ShowRate  float64 `json:"show_rate"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// CampaignReport representa o relatório de desempenho das campanhas de marketing
+type CampaignReport struct {
+	From      string                `json:"from"`
+	To        string                `json:"to"`
+	Campaigns []CampaignPerformance `json:"campaigns"`
+}
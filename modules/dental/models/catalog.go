@@ -0,0 +1,140 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// CatalogItem representa um procedimento de um catálogo padrão
+type CatalogItem struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       string `json:"price"`
+	Duration    string `json:"duration"` // em minutos
+}
+
+// CatalogTemplate representa um catálogo padrão de procedimentos de uma especialidade
+type CatalogTemplate struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Specialty string        `json:"specialty"`
+	Items     []CatalogItem `json:"items"`
+}
+
+// CatalogApplyRequest representa as sobrescritas locais de preço, por código do item
+type CatalogApplyRequest struct {
+	PriceOverrides map[string]string `json:"price_overrides"`
+}
+
+// IsValid verifica se as sobrescritas de preço referenciam itens do catálogo
+func (c *CatalogApplyRequest) IsValid(template CatalogTemplate) error {
+	codes := make(map[string]bool, len(template.Items))
+	for _, item := range template.Items {
+		codes[item.Code] = true
+	}
+	for code, price := range c.PriceOverrides {
+		if !codes[code] {
+			return fmt.Errorf("unknown catalog item %q in price_overrides", code)
+		}
+		if price == "" {
+			return fmt.Errorf("price override for %q is empty", code)
+		}
+	}
+	return nil
+}
+
+// Ações do plano de aplicação de um catálogo
+const (
+	CatalogActionCreate    = "create"
+	CatalogActionUpdate    = "update"
+	CatalogActionUnchanged = "unchanged"
+)
+
+// CatalogChange representa a ação aplicada a um procedimento do catálogo
+type CatalogChange struct {
+	Code        string `json:"code"`
+	ProcedureID string `json:"procedure_id"`
+	Action      string `json:"action"`
+}
+
+// CatalogApplyResult representa o resultado da aplicação de um catálogo
+type CatalogApplyResult struct {
+	Template  string          `json:"template"`
+	DryRun    bool            `json:"dry_run"`
+	Created   int             `json:"created"`
+	Updated   int             `json:"updated"`
+	Unchanged int             `json:"unchanged"`
+	Changes   []CatalogChange `json:"changes"`
+}
+
+// Modos de reajuste em lote dos preços do catálogo
+const (
+	PriceAdjustmentPercent = "percent"
+	PriceAdjustmentFixed   = "fixed"
+)
+
+// PriceAdjustmentRequest representa um reajuste em lote dos preços do
+// catálogo. Os filtros se combinam: o reajuste vale para os procedimentos
+// que atendem a todos os informados, ou para o catálogo inteiro sem filtros.
+type PriceAdjustmentRequest struct {
+	Mode          string   `json:"mode"`                                            // percent ou fixed
+	Value         float64  `json:"value"`                                           // percentual (10 = +10%) ou valor somado ao preço; negativo reduz
+	EffectiveFrom string   `json:"effective_from"`                                  // YYYY-MM-DD, padrão hoje
+	Template      string   `json:"template,omitempty" dynamodbav:",omitempty"`      // procedimentos de um catálogo padrão
+	Tags          []string `json:"tags,omitempty" dynamodbav:",omitempty"`          // procedimentos com alguma das etiquetas
+	ProcedureIDs  []string `json:"procedure_ids,omitempty" dynamodbav:",omitempty"` // procedimentos específicos
+	Reason        string   `json:"reason,omitempty" dynamodbav:",omitempty"`
+}
+
+// IsValid verifica o modo, o valor e a data do reajuste
+func (a *PriceAdjustmentRequest) IsValid() error {
+	switch a.Mode {
+	case PriceAdjustmentPercent:
+		if a.Value <= -100 {
+			return fmt.Errorf("percent value must be greater than -100")
+		}
+	case PriceAdjustmentFixed:
+	default:
+		return fmt.Errorf("mode must be %s or %s", PriceAdjustmentPercent, PriceAdjustmentFixed)
+	}
+	if a.Value == 0 {
+		return fmt.Errorf("value must not be zero")
+	}
+	if _, err := time.Parse("2006-01-02", a.EffectiveFrom); err != nil {
+		return fmt.Errorf("effective_from must be in YYYY-MM-DD format")
+	}
+	a.Tags = NormalizeTags(a.Tags)
+	return nil
+}
+
+// Apply calcula o novo preço, arredondado para centavos
+func (a *PriceAdjustmentRequest) Apply(price float64) float64 {
+	if a.Mode == PriceAdjustmentPercent {
+		price *= 1 + a.Value/100
+	} else {
+		price += a.Value
+	}
+	return math.Round(price*100) / 100
+}
+
+// PriceAdjustmentChange representa a mudança de preço de um procedimento no reajuste
+type PriceAdjustmentChange struct {
+	ProcedureID string `json:"procedure_id"`
+	Name        string `json:"name"`
+	OldPrice    string `json:"old_price"` // preço em vigor na data do reajuste
+	NewPrice    string `json:"new_price"`
+}
+
+// PriceAdjustment é o registro de auditoria de um reajuste em lote, com o
+// pedido, quem o fez e as mudanças aplicadas
+type PriceAdjustment struct {
+	ID       string `json:"id"`
+	ClinicID string `json:"clinic_id,omitempty"` // clínica dona do registro
+	PriceAdjustmentRequest
+	DryRun    bool                    `json:"dry_run" dynamodbav:"-"`
+	Changes   []PriceAdjustmentChange `json:"changes"`
+	CreatedBy string                  `json:"created_by,omitempty" dynamodbav:",omitempty"`
+	CreatedAt string                  `json:"created_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClinicalNoteAttachment representa um arquivo anexado à nota clínica
+type ClinicalNoteAttachment struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty" dynamodbav:",omitempty"`
+}
+
+// ClinicalNote representa uma nota clínica do prontuário do paciente. As notas
+// só são acrescentadas: enquanto não assinada o autor pode corrigi-la, e
+// depois de assinada ela não muda mais; correções são feitas em uma nova nota
+// que indica em Amends a nota corrigida.
+type ClinicalNote struct {
+	PatientID     string                   `json:"patient_id"`
+	ID            string                   `json:"id"`                  // ordena as notas do paciente pela criação
+	ClinicID      string                   `json:"clinic_id,omitempty"` // clínica dona do registro
+	DentistID     string                   `json:"dentist_id"`          // dentista autor
+	AppointmentID string                   `json:"appointment_id,omitempty" dynamodbav:",omitempty"`
+	Body          string                   `json:"body"`
+	Attachments   []ClinicalNoteAttachment `json:"attachments,omitempty" dynamodbav:",omitempty"`
+	Amends        string                   `json:"amends,omitempty" dynamodbav:",omitempty"` // nota assinada que esta corrige
+	CreatedAt     string                   `json:"created_at"`
+	CreatedBy     string                   `json:"created_by,omitempty" dynamodbav:",omitempty"`
+	UpdatedAt     string                   `json:"updated_at,omitempty" dynamodbav:",omitempty"`
+	SignedAt      string                   `json:"signed_at,omitempty" dynamodbav:",omitempty"`
+	SignedBy      string                   `json:"signed_by,omitempty" dynamodbav:",omitempty"`
+}
+
+// Signed informa se a nota foi assinada e não pode mais ser alterada
+func (n *ClinicalNote) Signed() bool {
+	return n.SignedAt != ""
+}
+
+// IsValid verifica se o autor e o texto foram informados e se os anexos têm
+// nome e endereço
+func (n *ClinicalNote) IsValid() error {
+	if n.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	if strings.TrimSpace(n.Body) == "" {
+		return fmt.Errorf("body is required")
+	}
+	for _, attachment := range n.Attachments {
+		if attachment.Name == "" || attachment.URL == "" {
+			return fmt.Errorf("attachments need a name and a URL")
+		}
+	}
+	return nil
+}
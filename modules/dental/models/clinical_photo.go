@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tipos de foto clínica
+const (
+	PhotoIntraoral = "intraoral"
+	PhotoExtraoral = "extraoral"
+)
+
+// Momento da foto em relação ao procedimento
+const (
+	PhotoStageBefore   = "before"
+	PhotoStageProgress = "progress" // durante o tratamento
+	PhotoStageAfter    = "after"
+)
+
+// Incidências padronizadas das fotos clínicas
+const (
+	PhotoViewFrontal       = "frontal"
+	PhotoViewRightLateral  = "right_lateral"
+	PhotoViewLeftLateral   = "left_lateral"
+	PhotoViewUpperOcclusal = "upper_occlusal"
+	PhotoViewLowerOcclusal = "lower_occlusal"
+	PhotoViewSmile         = "smile"
+	PhotoViewFace          = "face"
+	PhotoViewProfile       = "profile"
+	PhotoViewDetail        = "detail" // de um dente ou região
+)
+
+// PhotoTypes, PhotoStages e PhotoViews listam os valores aceitos
+var (
+	PhotoTypes  = []string{PhotoIntraoral, PhotoExtraoral}
+	PhotoStages = []string{PhotoStageBefore, PhotoStageProgress, PhotoStageAfter}
+	PhotoViews  = []string{PhotoViewFrontal, PhotoViewRightLateral, PhotoViewLeftLateral, PhotoViewUpperOcclusal, PhotoViewLowerOcclusal, PhotoViewSmile, PhotoViewFace, PhotoViewProfile, PhotoViewDetail}
+)
+
+// ClinicalPhoto representa uma foto clínica do paciente. As fotos do mesmo
+// dia e procedimento formam uma sessão, e as sessões em ordem formam a
+// linha do tempo do tratamento. A imagem fica no armazenamento de arquivos.
+type ClinicalPhoto struct {
+	PatientID     string `json:"patient_id"`
+	ID            string `json:"id"`                  // ordena as fotos do paciente pelo envio
+	ClinicID      string `json:"clinic_id,omitempty"` // clínica dona do registro
+	Type          string `json:"type"`                // intraoral ou extraoral
+	View          string `json:"view"`                // incidência, usada para parear antes e depois
+	Stage         string `json:"stage,omitempty" dynamodbav:",omitempty"`
+	Tooth         int    `json:"tooth,omitempty" dynamodbav:",omitempty"` // número FDI, nas fotos de detalhe
+	ProcedureID   string `json:"procedure_id,omitempty" dynamodbav:",omitempty"`
+	AppointmentID string `json:"appointment_id,omitempty" dynamodbav:",omitempty"`
+	TakenOn       string `json:"taken_on"` // dia da sessão (YYYY-MM-DD), padrão: dia do envio
+	Notes         string `json:"notes,omitempty" dynamodbav:",omitempty"`
+	ContentType   string `json:"content_type"`
+	Size          int64  `json:"size"`
+	StorageKey    string `json:"-"` // chave da imagem no armazenamento
+	UploadedAt    string `json:"uploaded_at"`
+	UploadedBy    string `json:"uploaded_by,omitempty" dynamodbav:",omitempty"`
+}
+
+// IsValid verifica o tipo, a incidência, o momento, o dente e o dia da foto
+func (p *ClinicalPhoto) IsValid() error {
+	if !oneOf(PhotoTypes, p.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(PhotoTypes, ", "))
+	}
+	if !oneOf(PhotoViews, p.View) {
+		return fmt.Errorf("view must be one of %s", strings.Join(PhotoViews, ", "))
+	}
+	if p.Stage != "" && !oneOf(PhotoStages, p.Stage) {
+		return fmt.Errorf("stage must be one of %s", strings.Join(PhotoStages, ", "))
+	}
+	if p.Tooth != 0 && !ValidToothNumber(p.Tooth) {
+		return fmt.Errorf("tooth must follow FDI numbering (11-48 or 51-85)")
+	}
+	if _, err := time.Parse("2006-01-02", p.TakenOn); err != nil {
+		return fmt.Errorf("taken_on must be a date (YYYY-MM-DD)")
+	}
+	return nil
+}
+
+// PairKey identifica a foto equivalente em outra sessão: mesma incidência,
+// tipo e dente
+func (p *ClinicalPhoto) PairKey() string {
+	return fmt.Sprintf("%s/%s/%d", p.Type, p.View, p.Tooth)
+}
+
+// PhotoSession representa as fotos de um dia e procedimento
+type PhotoSession struct {
+	TakenOn       string          `json:"taken_on"`
+	ProcedureID   string          `json:"procedure_id,omitempty"`
+	AppointmentID string          `json:"appointment_id,omitempty"`
+	Stage         string          `json:"stage,omitempty"` // momento, quando todas as fotos da sessão têm o mesmo
+	Photos        []ClinicalPhoto `json:"photos"`
+}
+
+// PhotoPair representa a mesma incidência antes e depois; falta um dos
+// lados quando só uma sessão tem a foto
+type PhotoPair struct {
+	Type   string         `json:"type"`
+	View   string         `json:"view"`
+	Tooth  int            `json:"tooth,omitempty"`
+	Before *ClinicalPhoto `json:"before"`
+	After  *ClinicalPhoto `json:"after"`
+}
+
+// PhotoComparison representa as fotos de duas sessões pareadas por
+// incidência
+type PhotoComparison struct {
+	ProcedureID string      `json:"procedure_id,omitempty"`
+	Before      string      `json:"before"` // dia da sessão de antes
+	After       string      `json:"after"`  // dia da sessão de depois
+	Pairs       []PhotoPair `json:"pairs"`
+}
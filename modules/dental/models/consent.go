@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// MaxConsentDocumentSize limita o tamanho do termo assinado, que é gravado no
+// próprio item do DynamoDB (limite de 400 KB por item)
+const MaxConsentDocumentSize = 300 * 1024
+
+// ConsentContentTypes lista os formatos aceitos para o termo assinado
+var ConsentContentTypes = []string{"application/pdf", "image/png", "image/jpeg"}
+
+// Consent representa o termo de consentimento assinado por um paciente para
+// um procedimento, exigido antes de realizar procedimentos marcados com
+// RequiresConsent
+type Consent struct {
+	PatientID   string `json:"patient_id"`
+	ProcedureID string `json:"procedure_id"`
+	SignedBy    string `json:"signed_by"`                                  // paciente ou responsável legal que assinou
+	SignedAt    string `json:"signed_at"`                                  // RFC3339
+	ContentType string `json:"content_type"`                               // formato do termo assinado
+	Document    string `json:"document,omitempty" dynamodbav:",omitempty"` // termo assinado em base64
+	RecordedBy  string `json:"recorded_by,omitempty" dynamodbav:",omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// IsValid verifica quem assinou e o termo assinado, que deve estar em base64
+// em um dos formatos aceitos
+func (c *Consent) IsValid() error {
+	if c.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if c.ProcedureID == "" {
+		return fmt.Errorf("procedure ID is required")
+	}
+	c.SignedBy = strings.TrimSpace(c.SignedBy)
+	if c.SignedBy == "" {
+		return fmt.Errorf("signed by is required")
+	}
+	if c.Document == "" {
+		return fmt.Errorf("document is required")
+	}
+	supported := false
+	for _, contentType := range ConsentContentTypes {
+		if c.ContentType == contentType {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("content type must be one of %s", strings.Join(ConsentContentTypes, ", "))
+	}
+	document, err := base64.StdEncoding.DecodeString(c.Document)
+	if err != nil {
+		return fmt.Errorf("document must be base64 encoded")
+	}
+	if len(document) > MaxConsentDocumentSize {
+		return fmt.Errorf("document must not exceed %d KB", MaxConsentDocumentSize/1024)
+	}
+	return nil
+}
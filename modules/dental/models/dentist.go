@@ -7,6 +7,7 @@ import (
 
 type Dentist struct {
 	ID        string    `json:"id,omitempty"`
+	ClinicID  string    `json:"clinic_id,omitempty"` // clínica dona do registro
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
 	Phone     string    `json:"phone"`
@@ -15,6 +16,21 @@ type Dentist struct {
 	Specialty string    `json:"specialty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"` // versão do registro, aumentada a cada alteração
+
+	// Procedimentos do catálogo que o dentista está habilitado a realizar;
+	// vazio permite todos
+	ProcedureIDs []string `json:"procedure_ids,omitempty"`
+
+	// Usuário da equipe do dentista, que recebe as notificações internas
+	// (como a chegada dos pacientes); vazio usa o e-mail
+	Username string `json:"username,omitempty" dynamodbav:",omitempty"`
+
+	// IDs do dentista no software anterior, preenchidos na importação
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty" dynamodbav:",omitempty"`
+
+	// Quando o registro foi removido; removidos ficam ocultos até serem restaurados
+	DeletedAt string `json:"deleted_at,omitempty" dynamodbav:",omitempty"`
 }
 
 func (d *Dentist) IsValid() error {
@@ -30,6 +46,41 @@ func (d *Dentist) IsValid() error {
 	if d.Country == "" {
 		return fmt.Errorf("country is required")
 	}
+	seen := make(map[string]bool, len(d.ProcedureIDs))
+	for _, id := range d.ProcedureIDs {
+		if id == "" {
+			return fmt.Errorf("procedure IDs must not be empty")
+		}
+		if seen[id] {
+			return fmt.Errorf("procedure %s is listed more than once", id)
+		}
+		seen[id] = true
+	}
+	if err := d.ExternalIDs.IsValid(); err != nil {
+		return err
+	}
 
 	return nil
+}
+
+// KeepServerFields copia do registro gravado os campos que o cliente não
+// altera (ID, clínica, criação e remoção) ao substituir ou modificar o dentista
+func (d *Dentist) KeepServerFields(stored Dentist) {
+	d.ID = stored.ID
+	d.ClinicID = stored.ClinicID
+	d.CreatedAt = stored.CreatedAt
+	d.DeletedAt = stored.DeletedAt
+}
+
+// Performs indica se o dentista está habilitado a realizar o procedimento
+func (d *Dentist) Performs(procedureID string) bool {
+	if len(d.ProcedureIDs) == 0 {
+		return true
+	}
+	for _, id := range d.ProcedureIDs {
+		if id == procedureID {
+			return true
+		}
+	}
+	return false
 }
\ No newline at end of file
@@ -0,0 +1,63 @@
+package models
+
+// DentistIdentity representa o profissional por trás dos cadastros de dentista
+// de várias clínicas, que atende em todas elas. Os cadastros vinculados
+// compartilham a agenda: um horário ocupado em uma clínica não é oferecido
+// nas outras.
+type DentistIdentity struct {
+	ID                string        `json:"id"`
+	CRO               string        `json:"cro"`
+	Country           string        `json:"country"`
+	JoinCodeHash      string        `json:"-" dynamodbav:",omitempty"` // hash do código de vínculo pendente
+	JoinCodeExpiresAt string        `json:"-" dynamodbav:",omitempty"`
+	CreatedAt         string        `json:"created_at"`
+	Links             []DentistLink `json:"links" dynamodbav:"-"`
+}
+
+// DentistLink representa o vínculo do cadastro de um dentista em uma clínica
+// com a identidade do profissional
+type DentistLink struct {
+	DentistID  string `json:"dentist_id"`
+	ClinicID   string `json:"clinic_id"`
+	ClinicName string `json:"clinic_name,omitempty" dynamodbav:"-"`
+	IdentityID string `json:"identity_id"`
+	LinkedAt   string `json:"linked_at"`
+}
+
+// DentistLinkCode representa o código, de uso único, com que outra clínica
+// vincula o seu cadastro do mesmo dentista
+type DentistLinkCode struct {
+	IdentityID string `json:"identity_id"`
+	Code       string `json:"code"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+// DentistJoinRequest representa o pedido de vínculo com o código recebido
+type DentistJoinRequest struct {
+	Code string `json:"code"`
+}
+
+// DentistAgendaEntry representa um compromisso na agenda unificada do
+// dentista. Dos compromissos de outras clínicas só são mostrados o horário, a
+// duração e a situação.
+type DentistAgendaEntry struct {
+	ClinicID        string `json:"clinic_id"`
+	ClinicName      string `json:"clinic_name,omitempty"`
+	Type            string `json:"type"` // appointment ou unavailable
+	ID              string `json:"id"`
+	Start           string `json:"start"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Status          string `json:"status,omitempty"`
+	PatientName     string `json:"patient_name,omitempty"`
+	ProcedureName   string `json:"procedure_name,omitempty"`
+}
+
+// DentistAgenda representa a agenda do dentista em todas as clínicas em que
+// atende, em ordem de horário
+type DentistAgenda struct {
+	DentistID  string               `json:"dentist_id"`
+	IdentityID string               `json:"identity_id,omitempty"`
+	From       string               `json:"from"`
+	To         string               `json:"to"`
+	Entries    []DentistAgendaEntry `json:"entries"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "fmt"
+
+// Origem do preço efetivo de um procedimento
+const (
+	PriceSourceDentist   = "dentist"
+	PriceSourceProcedure = "procedure"
+)
+
+// DentistPrice representa o preço de um procedimento do catálogo cobrado por um dentista específico
+type DentistPrice struct {
+	DentistID   string `json:"dentist_id"`
+	ProcedureID string `json:"procedure_id"`
+	Price       string `json:"price"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// IsValid verifica se o preço do dentista está preenchido e é um valor válido
+func (d *DentistPrice) IsValid() error {
+	if d.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	if d.ProcedureID == "" {
+		return fmt.Errorf("procedure ID is required")
+	}
+	if d.Price == "" {
+		return fmt.Errorf("price is required")
+	}
+	value, err := d.PriceValue()
+	if err != nil {
+		return err
+	}
+	if value < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	return nil
+}
+
+// PriceValue interpreta o preço do dentista com as mesmas regras do procedimento
+func (d *DentistPrice) PriceValue() (float64, error) {
+	return (&Procedure{Price: d.Price}).PriceValue()
+}
+
+// EffectivePrice representa o preço de um procedimento resolvido para um dentista em uma data
+type EffectivePrice struct {
+	ProcedureID   string  `json:"procedure_id"`
+	DentistID     string  `json:"dentist_id,omitempty"`
+	At            string  `json:"at"`
+	Price         string  `json:"price"`
+	Amount        float64 `json:"amount"`
+	Source        string  `json:"source"`
+	EffectiveFrom string  `json:"effective_from,omitempty"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxProcedureDuration é a maior duração aceita para um procedimento, em minutos
+const MaxProcedureDuration = 480
+
+// AppointmentTimeRequest informa quando o atendimento começou ou terminou;
+// sem At vale o momento da chamada
+type AppointmentTimeRequest struct {
+	At string `json:"at,omitempty"` // RFC 3339
+}
+
+// Time interpreta o momento informado, que não pode estar no futuro
+func (r *AppointmentTimeRequest) Time(now time.Time) (time.Time, error) {
+	if r.At == "" {
+		return now, nil
+	}
+	at, err := time.Parse(time.RFC3339, r.At)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("at must be a date and time in RFC 3339 format")
+	}
+	if at.After(now.Add(time.Minute)) {
+		return time.Time{}, fmt.Errorf("at must not be in the future")
+	}
+	return at.UTC(), nil
+}
+
+// DurationSuggestion representa a duração sugerida para um procedimento, de
+// todos os dentistas ou de um só, pela média dos atendimentos realizados
+type DurationSuggestion struct {
+	ProcedureID       string  `json:"procedure_id"`
+	ProcedureName     string  `json:"procedure_name"`
+	DentistID         string  `json:"dentist_id,omitempty"` // vazio na sugestão do procedimento
+	Samples           int     `json:"samples"`              // atendimentos com início e fim registrados
+	CurrentDuration   int     `json:"current_duration"`     // duração do catálogo, em minutos
+	AverageDuration   float64 `json:"average_duration"`
+	SuggestedDuration int     `json:"suggested_duration"` // média arredondada a 5 minutos
+	Change            int     `json:"change"`             // sugerida menos a atual
+}
+
+// DurationSuggestions representa as sugestões de duração de um período
+type DurationSuggestions struct {
+	From       string               `json:"from"`
+	To         string               `json:"to"`
+	MinSamples int                  `json:"min_samples"`
+	Procedures []DurationSuggestion `json:"procedures"` // por procedimento, de todos os dentistas
+	Dentists   []DurationSuggestion `json:"dentists"`   // por procedimento e dentista
+}
+
+// DurationChange representa a nova duração aprovada para um procedimento
+type DurationChange struct {
+	ProcedureID string `json:"procedure_id"`
+	Duration    int    `json:"duration"` // em minutos
+}
+
+// DurationApplyRequest lista as durações aprovadas para o catálogo
+type DurationApplyRequest struct {
+	Changes []DurationChange `json:"changes"`
+}
+
+// IsValid verifica os procedimentos e as durações aprovadas
+func (r *DurationApplyRequest) IsValid() error {
+	if len(r.Changes) == 0 {
+		return fmt.Errorf("at least one change is required")
+	}
+	seen := make(map[string]bool, len(r.Changes))
+	for _, change := range r.Changes {
+		if change.ProcedureID == "" {
+			return fmt.Errorf("procedure ID is required for every change")
+		}
+		if seen[change.ProcedureID] {
+			return fmt.Errorf("procedure %s is repeated", change.ProcedureID)
+		}
+		seen[change.ProcedureID] = true
+		if change.Duration <= 0 || change.Duration > MaxProcedureDuration {
+			return fmt.Errorf("duration of procedure %s must be between 1 and %d minutes", change.ProcedureID, MaxProcedureDuration)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import "fmt"
+
+// MaxImportRecords é o limite de registros por requisição de importação
+const MaxImportRecords = 500
+
+// ExternalIDs guarda os IDs de um registro migrado no software anterior da
+// clínica, por sistema de origem (ex.: {"dentalsoft": "1234"})
+type ExternalIDs map[string]string
+
+// IsValid verifica se os sistemas de origem e os IDs estão preenchidos
+func (e ExternalIDs) IsValid() error {
+	for source, id := range e {
+		if source == "" {
+			return fmt.Errorf("external ID source is required")
+		}
+		if id == "" {
+			return fmt.Errorf("external ID for %s is required", source)
+		}
+	}
+	return nil
+}
+
+// Situação de um registro na importação
+const (
+	ImportStatusCreated  = "created"  // criado nesta importação
+	ImportStatusExisting = "existing" // já importado antes, mantido como está
+	ImportStatusFailed   = "failed"
+)
+
+// ImportRequest representa uma importação em lote de registros de um sistema
+// de origem; cada registro traz o seu ID original em external_ids[source]
+type ImportRequest[T any] struct {
+	Source  string `json:"source"`
+	Records []T    `json:"records"`
+}
+
+// IsValid verifica o sistema de origem e a quantidade de registros
+func (i *ImportRequest[T]) IsValid() error {
+	if i.Source == "" {
+		return fmt.Errorf("source is required")
+	}
+	if len(i.Records) == 0 {
+		return fmt.Errorf("at least one record is required")
+	}
+	if len(i.Records) > MaxImportRecords {
+		return fmt.Errorf("at most %d records are allowed", MaxImportRecords)
+	}
+	return nil
+}
+
+// ImportRecordResult representa o resultado da importação de um registro
+type ImportRecordResult struct {
+	ExternalID string `json:"external_id"`
+	ID         string `json:"id,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportResult representa o resultado de uma importação em lote, na ordem dos registros enviados
+type ImportResult struct {
+	Source   string               `json:"source"`
+	Created  int                  `json:"created"`
+	Existing int                  `json:"existing"`
+	Failed   int                  `json:"failed"`
+	Records  []ImportRecordResult `json:"records"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Origem do rótulo e da cor com que um agendamento é exibido
+const (
+	DisplaySourceAppointment = "appointment" // definidos no próprio agendamento
+	DisplaySourceProcedure   = "procedure"   // herdados do procedimento agendado
+)
+
+// hexColor é o formato aceito para as cores: #RRGGBB
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// validColor verifica se a cor, quando informada, está no formato #RRGGBB
+func validColor(color string) error {
+	if color != "" && !hexColor.MatchString(color) {
+		return fmt.Errorf("color must be a hex color such as #1E88E5")
+	}
+	return nil
+}
+
+// AppointmentDisplay é o rótulo e a cor com que os calendários exibem um
+// agendamento, iguais em todos os clientes. Calculado na leitura, não persistido.
+type AppointmentDisplay struct {
+	Label  string `json:"label,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Source string `json:"source"` // appointment ou procedure
+}
+
+// DisplayFor calcula a exibição do agendamento: o rótulo e a cor definidos
+// nele prevalecem, e o que faltar vem do procedimento (seu rótulo, ou o nome
+// quando não tem). Sem nenhum dos dois retorna nil.
+func (a *Appointment) DisplayFor(procedure *Procedure) *AppointmentDisplay {
+	display := AppointmentDisplay{Label: a.Label, Color: a.Color, Source: DisplaySourceAppointment}
+	if procedure != nil && (display.Label == "" || display.Color == "") {
+		if display.Label == "" && display.Color == "" {
+			display.Source = DisplaySourceProcedure
+		}
+		if display.Label == "" {
+			display.Label = procedure.Label
+			if display.Label == "" {
+				display.Label = procedure.Name
+			}
+		}
+		if display.Color == "" {
+			display.Color = procedure.Color
+		}
+	}
+	if display.Label == "" && display.Color == "" {
+		return nil
+	}
+	return &display
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Gravidade de uma interação medicamentosa, da menor para a maior
+const (
+	InteractionMinor           = "minor"           // em geral sem consequência clínica
+	InteractionModerate        = "moderate"        // pede acompanhamento ou ajuste de dose
+	InteractionMajor           = "major"           // evitar a combinação, salvo benefício claro
+	InteractionContraindicated = "contraindicated" // não associar
+)
+
+// Medication representa um medicamento do catálogo da clínica, usado nas
+// prescrições
+type Medication struct {
+	ID               string `json:"id"`
+	ClinicID         string `json:"clinic_id,omitempty"`                     // clínica dona do registro
+	Name             string `json:"name"`                                    // nome comercial ou genérico
+	ActiveIngredient string `json:"active_ingredient"`                       // princípio ativo, usado na verificação de interações
+	Class            string `json:"class,omitempty" dynamodbav:",omitempty"` // classe terapêutica, como nsaid ou antibiotic
+	Form             string `json:"form,omitempty" dynamodbav:",omitempty"`  // comprimido, cápsula, solução...
+	Strength         string `json:"strength,omitempty" dynamodbav:",omitempty"`
+	DefaultDosage    string `json:"default_dosage,omitempty" dynamodbav:",omitempty"` // posologia sugerida na prescrição
+	CreatedAt        string `json:"created_at"`
+	UpdatedAt        string `json:"updated_at"`
+}
+
+// IsValid verifica se o nome e o princípio ativo foram informados
+func (m *Medication) IsValid() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(m.ActiveIngredient) == "" {
+		return fmt.Errorf("active ingredient is required")
+	}
+	return nil
+}
+
+// MedicationInteraction representa uma interação entre um medicamento
+// prescrito e um que o paciente já usa
+type MedicationInteraction struct {
+	MedicationID string `json:"medication_id"`
+	Medication   string `json:"medication"` // nome do medicamento prescrito
+	With         string `json:"with"`       // medicamento em uso, como consta na anamnese
+	Severity     string `json:"severity"`
+	Description  string `json:"description"`
+	Source       string `json:"source,omitempty"` // referência que apontou a interação
+}
+
+// InteractionCheckRequest representa os medicamentos a verificar contra os
+// que o paciente usa
+type InteractionCheckRequest struct {
+	PatientID     string   `json:"patient_id"`
+	MedicationIDs []string `json:"medication_ids"`
+}
+
+// IsValid verifica se o paciente e ao menos um medicamento foram informados
+func (c *InteractionCheckRequest) IsValid() error {
+	if c.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if len(c.MedicationIDs) == 0 {
+		return fmt.Errorf("at least one medication is required")
+	}
+	return nil
+}
+
+// InteractionCheck representa o resultado da verificação de interações
+type InteractionCheck struct {
+	PatientMedications []string                `json:"patient_medications"` // medicamentos em uso segundo a anamnese
+	Interactions       []MedicationInteraction `json:"interactions"`
+	Provider           string                  `json:"provider"` // referência usada na verificação
+}
+
+// Worst retorna a maior gravidade entre as interações, ou vazio sem interações
+func (c *InteractionCheck) Worst() string {
+	worst, rank := "", -1
+	for _, interaction := range c.Interactions {
+		if r := severityRank(interaction.Severity); r > rank {
+			worst, rank = interaction.Severity, r
+		}
+	}
+	return worst
+}
+
+func severityRank(severity string) int {
+	for i, s := range []string{InteractionMinor, InteractionModerate, InteractionMajor, InteractionContraindicated} {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Situações de um dente no odontograma
+const (
+	ToothConditionSound               = "sound" // hígido
+	ToothConditionCaries              = "caries"
+	ToothConditionRestored            = "restored"
+	ToothConditionFractured           = "fractured"
+	ToothConditionRootCanal           = "root_canal"
+	ToothConditionCrown               = "crown"
+	ToothConditionImplant             = "implant"
+	ToothConditionMissing             = "missing"
+	ToothConditionExtractionIndicated = "extraction_indicated"
+	ToothConditionUnerupted           = "unerupted"
+)
+
+// ToothConditions lista as situações aceitas
+var ToothConditions = []string{
+	ToothConditionSound, ToothConditionCaries, ToothConditionRestored, ToothConditionFractured,
+	ToothConditionRootCanal, ToothConditionCrown, ToothConditionImplant, ToothConditionMissing,
+	ToothConditionExtractionIndicated, ToothConditionUnerupted,
+}
+
+// ToothSurfaces lista as faces do dente aceitas
+var ToothSurfaces = []string{"mesial", "distal", "occlusal", "incisal", "buccal", "lingual", "palatal"}
+
+// Status de um tratamento registrado no dente
+const (
+	ToothTreatmentPlanned   = "planned"
+	ToothTreatmentCompleted = "completed"
+)
+
+// ToothCondition representa uma situação encontrada no dente, em todo ele ou
+// nas faces informadas
+type ToothCondition struct {
+	Condition string   `json:"condition"`
+	Surfaces  []string `json:"surfaces,omitempty" dynamodbav:",omitempty"`
+	Notes     string   `json:"notes,omitempty" dynamodbav:",omitempty"`
+}
+
+// ToothTreatment representa um tratamento planejado ou realizado no dente
+type ToothTreatment struct {
+	ProcedureID   string   `json:"procedure_id,omitempty" dynamodbav:",omitempty"`
+	Description   string   `json:"description,omitempty" dynamodbav:",omitempty"`
+	Status        string   `json:"status"` // planned ou completed
+	Surfaces      []string `json:"surfaces,omitempty" dynamodbav:",omitempty"`
+	Date          string   `json:"date,omitempty" dynamodbav:",omitempty"` // YYYY-MM-DD
+	AppointmentID string   `json:"appointment_id,omitempty" dynamodbav:",omitempty"`
+	DentistID     string   `json:"dentist_id,omitempty" dynamodbav:",omitempty"`
+}
+
+// Tooth representa a situação de um dente, identificado pela numeração FDI
+// (11 a 48 na dentição permanente, 51 a 85 na decídua)
+type Tooth struct {
+	Number     int              `json:"number"`
+	Conditions []ToothCondition `json:"conditions"`
+	Treatments []ToothTreatment `json:"treatments,omitempty" dynamodbav:",omitempty"`
+	Notes      string           `json:"notes,omitempty" dynamodbav:",omitempty"`
+	UpdatedAt  string           `json:"updated_at,omitempty"`
+	UpdatedBy  string           `json:"updated_by,omitempty" dynamodbav:",omitempty"`
+}
+
+// ValidToothNumber verifica se o número segue a numeração FDI: quadrantes 1 a
+// 4 com dentes 1 a 8 (permanentes) e 5 a 8 com dentes 1 a 5 (decíduos)
+func ValidToothNumber(number int) bool {
+	quadrant, tooth := number/10, number%10
+	switch {
+	case quadrant >= 1 && quadrant <= 4:
+		return tooth >= 1 && tooth <= 8
+	case quadrant >= 5 && quadrant <= 8:
+		return tooth >= 1 && tooth <= 5
+	}
+	return false
+}
+
+// IsValid verifica as situações, os tratamentos e as faces informadas
+func (t *Tooth) IsValid() error {
+	if !ValidToothNumber(t.Number) {
+		return fmt.Errorf("tooth number must follow FDI numbering (11-48 or 51-85)")
+	}
+	if len(t.Conditions) == 0 {
+		return fmt.Errorf("at least one condition is required")
+	}
+	for _, condition := range t.Conditions {
+		if !oneOf(ToothConditions, condition.Condition) {
+			return fmt.Errorf("condition must be one of %s", strings.Join(ToothConditions, ", "))
+		}
+		if err := validSurfaces(condition.Surfaces); err != nil {
+			return err
+		}
+	}
+	for _, treatment := range t.Treatments {
+		if treatment.ProcedureID == "" && strings.TrimSpace(treatment.Description) == "" {
+			return fmt.Errorf("treatments need a procedure ID or a description")
+		}
+		if treatment.Status != ToothTreatmentPlanned && treatment.Status != ToothTreatmentCompleted {
+			return fmt.Errorf("treatment status must be planned or completed")
+		}
+		if treatment.Date != "" {
+			if _, err := time.Parse("2006-01-02", treatment.Date); err != nil {
+				return fmt.Errorf("treatment date must be in YYYY-MM-DD format")
+			}
+		}
+		if err := validSurfaces(treatment.Surfaces); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validSurfaces(surfaces []string) error {
+	for _, surface := range surfaces {
+		if !oneOf(ToothSurfaces, surface) {
+			return fmt.Errorf("surfaces must be among %s", strings.Join(ToothSurfaces, ", "))
+		}
+	}
+	return nil
+}
+
+func oneOf(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Odontogram representa o odontograma do paciente: a situação atual de cada
+// dente registrado, pelo número FDI. Dentes sem registro não foram avaliados.
+type Odontogram struct {
+	PatientID string           `json:"patient_id"`
+	ClinicID  string           `json:"clinic_id,omitempty"` // clínica dona do registro
+	Teeth     map[string]Tooth `json:"teeth"`
+	Version   int64            `json:"version"` // aumentada a cada alteração, numera as versões guardadas
+	UpdatedAt string           `json:"updated_at,omitempty"`
+}
+
+// SetTooth grava a situação de um dente no odontograma
+func (o *Odontogram) SetTooth(tooth Tooth) {
+	if o.Teeth == nil {
+		o.Teeth = map[string]Tooth{}
+	}
+	o.Teeth[strconv.Itoa(tooth.Number)] = tooth
+}
+
+// OdontogramSnapshot representa uma versão guardada do odontograma, gravada a
+// cada alteração de um dente
+type OdontogramSnapshot struct {
+	PatientID string           `json:"patient_id"`
+	Version   int64            `json:"version"`
+	Tooth     int              `json:"tooth"` // dente alterado nesta versão
+	TakenAt   string           `json:"taken_at"`
+	TakenBy   string           `json:"taken_by,omitempty" dynamodbav:",omitempty"`
+	Teeth     map[string]Tooth `json:"teeth,omitempty" dynamodbav:",omitempty"`
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Códigos de complicação de um procedimento realizado
+const (
+	ComplicationPostoperativePain  = "postoperative_pain"
+	ComplicationSwelling           = "swelling"
+	ComplicationBleeding           = "bleeding"
+	ComplicationInfection          = "infection"
+	ComplicationDrySocket          = "dry_socket" // alveolite
+	ComplicationNerveInjury        = "nerve_injury"
+	ComplicationAllergicReaction   = "allergic_reaction"
+	ComplicationFracture           = "fracture"
+	ComplicationRestorationFailure = "restoration_failure"
+	ComplicationImplantFailure     = "implant_failure"
+	ComplicationOther              = "other"
+)
+
+// ComplicationCodes lista os códigos de complicação aceitos
+var ComplicationCodes = []string{
+	ComplicationPostoperativePain, ComplicationSwelling, ComplicationBleeding, ComplicationInfection,
+	ComplicationDrySocket, ComplicationNerveInjury, ComplicationAllergicReaction, ComplicationFracture,
+	ComplicationRestorationFailure, ComplicationImplantFailure, ComplicationOther,
+}
+
+// ProcedureOutcome representa o resultado do procedimento realizado em um
+// agendamento concluído, registrado pelo dentista para o acompanhamento da
+// qualidade clínica
+type ProcedureOutcome struct {
+	AppointmentID  string   `json:"appointment_id"`
+	ClinicID       string   `json:"clinic_id,omitempty"` // clínica dona do registro
+	PatientID      string   `json:"patient_id"`
+	DentistID      string   `json:"dentist_id"`
+	ProcedureID    string   `json:"procedure_id,omitempty"`
+	PerformedAt    string   `json:"performed_at"` // data e hora do agendamento
+	Success        *bool    `json:"success"`
+	Complications  []string `json:"complications,omitempty" dynamodbav:",omitempty"`
+	FollowUpNeeded bool     `json:"follow_up_needed"`
+	Notes          string   `json:"notes,omitempty" dynamodbav:",omitempty"`
+	RecordedAt     string   `json:"recorded_at"`
+	RecordedBy     string   `json:"recorded_by,omitempty" dynamodbav:",omitempty"`
+}
+
+// IsValid verifica se o sucesso foi informado e se os códigos de complicação
+// são conhecidos e não se repetem
+func (o *ProcedureOutcome) IsValid() error {
+	if o.Success == nil {
+		return fmt.Errorf("success is required")
+	}
+	seen := make(map[string]bool)
+	for _, code := range o.Complications {
+		if !oneOf(ComplicationCodes, code) {
+			return fmt.Errorf("complications must be among %s", strings.Join(ComplicationCodes, ", "))
+		}
+		if seen[code] {
+			return fmt.Errorf("complication %s is repeated", code)
+		}
+		seen[code] = true
+	}
+	return nil
+}
+
+// QualityStats representa os resultados de um conjunto de procedimentos realizados
+type QualityStats struct {
+	Performed         int            `json:"performed"` // procedimentos com resultado registrado
+	Successful        int            `json:"successful"`
+	WithComplications int            `json:"with_complications"`
+	FollowUpsNeeded   int            `json:"follow_ups_needed"`
+	SuccessRate       float64        `json:"success_rate"`      // em porcentagem
+	ComplicationRate  float64        `json:"complication_rate"` // em porcentagem
+	Complications     map[string]int `json:"complications"`     // ocorrências por código
+}
+
+// Add contabiliza o resultado de um procedimento e recalcula as taxas
+func (s *QualityStats) Add(outcome ProcedureOutcome) {
+	if s.Complications == nil {
+		s.Complications = map[string]int{}
+	}
+	s.Performed++
+	if outcome.Success != nil && *outcome.Success {
+		s.Successful++
+	}
+	if len(outcome.Complications) > 0 {
+		s.WithComplications++
+	}
+	if outcome.FollowUpNeeded {
+		s.FollowUpsNeeded++
+	}
+	for _, code := range outcome.Complications {
+		s.Complications[code]++
+	}
+	s.SuccessRate = math.Round(float64(s.Successful)/float64(s.Performed)*10000) / 100
+	s.ComplicationRate = math.Round(float64(s.WithComplications)/float64(s.Performed)*10000) / 100
+}
+
+// DentistQuality representa os resultados dos procedimentos de um dentista
+type DentistQuality struct {
+	DentistID   string `json:"dentist_id"`
+	DentistName string `json:"dentist_name,omitempty"`
+	QualityStats
+}
+
+// ProcedureQuality representa os resultados de um procedimento, no total e
+// por dentista
+type ProcedureQuality struct {
+	ProcedureID   string `json:"procedure_id"`
+	ProcedureName string `json:"procedure_name,omitempty"`
+	QualityStats
+	Dentists []DentistQuality `json:"dentists"`
+}
+
+// QualityReport representa o relatório de qualidade clínica: taxas de sucesso
+// e de complicação da clínica, por procedimento e por dentista
+type QualityReport struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Clinic     QualityStats       `json:"clinic"`
+	Procedures []ProcedureQuality `json:"procedures"`
+	Dentists   []DentistQuality   `json:"dentists"`
+}
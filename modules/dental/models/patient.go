@@ -4,6 +4,7 @@ import "fmt"
 
 type Patient struct {
 	ID           string `json:"id"`
+	ClinicID     string `json:"clinic_id,omitempty"` // clínica dona do registro
 	Name         string `json:"name"`
 	Email        string `json:"email"`
 	Phone        string `json:"phone"`
@@ -11,6 +12,30 @@ type Patient struct {
 	MedicalNotes string `json:"medical_notes"`
 	CreatedAt    string `json:"created_at"`
 	UpdatedAt    string `json:"updated_at"`
+	Version      int64  `json:"version"` // versão do registro, aumentada a cada alteração
+
+	// Campanha do primeiro agendamento online do paciente
+	CampaignAttribution
+
+	// Medicamentos em uso declarados na anamnese, verificados nas prescrições
+	Medications []string `json:"medications,omitempty" dynamodbav:",omitempty"`
+
+	// IDs do paciente no software anterior, preenchidos na importação
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty" dynamodbav:",omitempty"`
+
+	// Quando o registro foi removido; removidos ficam ocultos até serem restaurados
+	DeletedAt string `json:"deleted_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// KeepServerFields copia do registro gravado os campos que o cliente não
+// altera (ID, clínica, criação, remoção e campanha de origem) ao substituir
+// ou modificar o paciente
+func (p *Patient) KeepServerFields(stored Patient) {
+	p.ID = stored.ID
+	p.ClinicID = stored.ClinicID
+	p.CreatedAt = stored.CreatedAt
+	p.DeletedAt = stored.DeletedAt
+	p.CampaignAttribution = stored.CampaignAttribution
 }
 
 // IsValid verifica se os campos obrigatórios do paciente estão preenchidos
@@ -21,6 +46,9 @@ func (p *Patient) IsValid() error {
 	if p.Email == "" {
 		return fmt.Errorf("email is required")
 	}
+	if err := p.ExternalIDs.IsValid(); err != nil {
+		return err
+	}
 
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Severidades de alertas do paciente
+const (
+	AlertSeverityInfo    = "info"
+	AlertSeverityWarning = "warning"
+)
+
+// PatientAlert representa um aviso exibido na ficha do paciente
+type PatientAlert struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// PatientSummary agrega os dados exibidos na tela do paciente em uma única resposta
+type PatientSummary struct {
+	Patient            Patient        `json:"patient"`
+	NextAppointment    *Appointment   `json:"next_appointment,omitempty"`
+	LastVisit          *Appointment   `json:"last_visit,omitempty"`
+	OutstandingBalance float64        `json:"outstanding_balance"`
+	OverdueBalance     float64        `json:"overdue_balance"`
+	Alerts             []PatientAlert `json:"alerts"`
+}
+
+// Tipos de eventos do histórico do paciente
+const (
+	HistoryAppointment = "appointment" // agendamento não realizado: agendado, confirmado, cancelado ou falta
+	HistoryProcedure   = "procedure"   // atendimento concluído, com o procedimento realizado
+	HistoryRevenue     = "revenue"     // cobrança lançada ao paciente, no vencimento
+	HistoryPayment     = "payment"     // pagamento de uma cobrança
+	HistoryInvoice     = "invoice"     // nota fiscal, na data de emissão
+)
+
+// HistoryEvent representa um evento da linha do tempo do paciente
+type HistoryEvent struct {
+	Date          time.Time `json:"date"`
+	Type          string    `json:"type"`
+	ID            string    `json:"id"` // ID do registro de origem (agendamento, receita ou nota fiscal)
+	Description   string    `json:"description"`
+	Status        string    `json:"status,omitempty"`
+	Amount        float64   `json:"amount,omitempty"`
+	DentistID     string    `json:"dentist_id,omitempty"`
+	DentistName   string    `json:"dentist_name,omitempty"`
+	ProcedureID   string    `json:"procedure_id,omitempty"`
+	AppointmentID string    `json:"appointment_id,omitempty"`
+}
+
+// PatientHistory reúne em ordem cronológica os atendimentos, procedimentos e
+// a movimentação financeira do paciente, para o prontuário
+type PatientHistory struct {
+	Patient Patient        `json:"patient"`
+	Events  []HistoryEvent `json:"events"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status de uma pré-autorização junto à operadora
+const (
+	PreAuthStatusPending  = "pending"
+	PreAuthStatusApproved = "approved"
+	PreAuthStatusDenied   = "denied"
+)
+
+// Modos de exigência de pré-autorização ao agendar (PREAUTH_ENFORCEMENT)
+const (
+	PreAuthEnforcementOff   = "off"
+	PreAuthEnforcementWarn  = "warn"
+	PreAuthEnforcementBlock = "block"
+)
+
+// PreAuth representa o pedido de autorização prévia à operadora do convênio
+// para um procedimento planejado de um paciente
+type PreAuth struct {
+	ID           string `json:"id"`
+	PatientID    string `json:"patient_id"`
+	ProcedureID  string `json:"procedure_id"`
+	Carrier      string `json:"carrier"`                                        // operadora do convênio
+	PlannedDate  string `json:"planned_date,omitempty" dynamodbav:",omitempty"` // YYYY-MM-DD
+	Status       string `json:"status"`
+	AuthNumber   string `json:"auth_number,omitempty" dynamodbav:",omitempty"` // senha de autorização da operadora
+	ValidFrom    string `json:"valid_from,omitempty" dynamodbav:",omitempty"`  // YYYY-MM-DD
+	ValidUntil   string `json:"valid_until,omitempty" dynamodbav:",omitempty"` // YYYY-MM-DD
+	DenialReason string `json:"denial_reason,omitempty" dynamodbav:",omitempty"`
+	Notes        string `json:"notes,omitempty" dynamodbav:",omitempty"`
+	CreatedBy    string `json:"created_by,omitempty" dynamodbav:",omitempty"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+	Version      int64  `json:"version"` // versão do registro, aumentada a cada alteração
+	DecidedAt    string `json:"decided_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// IsValid verifica os campos obrigatórios e, para pedidos aprovados, o número
+// e a validade da autorização
+func (p *PreAuth) IsValid() error {
+	if p.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if p.ProcedureID == "" {
+		return fmt.Errorf("procedure ID is required")
+	}
+	if p.Carrier == "" {
+		return fmt.Errorf("carrier is required")
+	}
+	switch p.Status {
+	case PreAuthStatusPending, PreAuthStatusDenied:
+	case PreAuthStatusApproved:
+		if p.AuthNumber == "" {
+			return fmt.Errorf("auth number is required for approved pre-authorizations")
+		}
+		if p.ValidUntil == "" {
+			return fmt.Errorf("valid until is required for approved pre-authorizations")
+		}
+	default:
+		return fmt.Errorf("status must be one of pending, approved or denied")
+	}
+	for name, date := range map[string]string{"planned date": p.PlannedDate, "valid from": p.ValidFrom, "valid until": p.ValidUntil} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("%s must be in YYYY-MM-DD format", name)
+		}
+	}
+	if p.ValidFrom != "" && p.ValidUntil != "" && p.ValidUntil < p.ValidFrom {
+		return fmt.Errorf("valid until must not be before valid from")
+	}
+	return nil
+}
+
+// Covers indica se a autorização está aprovada e válida no dia informado (YYYY-MM-DD)
+func (p *PreAuth) Covers(day string) bool {
+	return p.Status == PreAuthStatusApproved &&
+		(p.ValidFrom == "" || p.ValidFrom <= day) &&
+		day <= p.ValidUntil
+}
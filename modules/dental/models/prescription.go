@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PrescriptionItem representa um medicamento prescrito. Com MedicationID, os
+// dados não informados vêm do catálogo; sem ele, o medicamento é escrito
+// livremente.
+type PrescriptionItem struct {
+	MedicationID     string `json:"medication_id,omitempty" dynamodbav:",omitempty"`
+	Name             string `json:"name"`
+	ActiveIngredient string `json:"active_ingredient,omitempty" dynamodbav:",omitempty"`
+	Strength         string `json:"strength,omitempty" dynamodbav:",omitempty"` // concentração, como 500 mg
+	Form             string `json:"form,omitempty" dynamodbav:",omitempty"`
+	Dosage           string `json:"dosage"`                                     // quanto tomar por vez, como 1 comprimido
+	Frequency        string `json:"frequency"`                                  // como a cada 8 horas
+	Duration         string `json:"duration,omitempty" dynamodbav:",omitempty"` // como por 7 dias
+	Quantity         string `json:"quantity,omitempty" dynamodbav:",omitempty"` // quantidade a dispensar
+	Instructions     string `json:"instructions,omitempty" dynamodbav:",omitempty"`
+}
+
+// Prescription representa uma receita emitida por um dentista para o
+// paciente. As interações encontradas com os medicamentos em uso ficam
+// registradas na receita.
+type Prescription struct {
+	ID            string                  `json:"id"`
+	ClinicID      string                  `json:"clinic_id,omitempty"` // clínica dona do registro
+	PatientID     string                  `json:"patient_id"`
+	DentistID     string                  `json:"dentist_id"`
+	AppointmentID string                  `json:"appointment_id,omitempty" dynamodbav:",omitempty"`
+	IssueDate     string                  `json:"issue_date"` // YYYY-MM-DD, padrão: hoje
+	Items         []PrescriptionItem      `json:"items"`
+	Notes         string                  `json:"notes,omitempty" dynamodbav:",omitempty"`
+	Interactions  []MedicationInteraction `json:"interactions,omitempty" dynamodbav:",omitempty"`
+	CreatedAt     string                  `json:"created_at"`
+	CreatedBy     string                  `json:"created_by,omitempty" dynamodbav:",omitempty"`
+	UpdatedAt     string                  `json:"updated_at"`
+	Version       int64                   `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica o paciente, o dentista, a data e os itens da receita
+func (p *Prescription) IsValid() error {
+	if p.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if p.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	if _, err := time.Parse("2006-01-02", p.IssueDate); err != nil {
+		return fmt.Errorf("issue_date must be a date (YYYY-MM-DD)")
+	}
+	if len(p.Items) == 0 {
+		return fmt.Errorf("at least one medication is required")
+	}
+	for _, item := range p.Items {
+		if strings.TrimSpace(item.Name) == "" {
+			return fmt.Errorf("name is required for every medication")
+		}
+		if strings.TrimSpace(item.Dosage) == "" || strings.TrimSpace(item.Frequency) == "" {
+			return fmt.Errorf("dosage and frequency are required for %s", item.Name)
+		}
+	}
+	return nil
+}
+
+// Medications retorna os itens como medicamentos, para a verificação de
+// interações
+func (p *Prescription) Medications() []Medication {
+	medications := make([]Medication, len(p.Items))
+	for i, item := range p.Items {
+		medications[i] = Medication{ID: item.MedicationID, Name: item.Name, ActiveIngredient: item.ActiveIngredient, Form: item.Form, Strength: item.Strength}
+	}
+	return medications
+}
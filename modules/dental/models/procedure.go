@@ -1,15 +1,69 @@
 package models
 
-import "fmt"
+import (
+	"dental-saas/shared/i18n"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxBufferMinutes é o maior intervalo aceito após um atendimento, em minutos
+const MaxBufferMinutes = 120
 
 type Procedure struct {
 	ID          string `json:"id"`
+	ClinicID    string `json:"clinic_id,omitempty"` // clínica dona do registro
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Price       string `json:"price"`
 	Duration    string `json:"duration"` // em minutos
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+	Version     int64  `json:"version"` // versão do registro, aumentada a cada alteração
+
+	// Nome e descrição em outros idiomas, por código (pt-BR, en, es); Name e
+	// Description ficam no idioma padrão da clínica
+	Translations map[string]ProcedureTranslation `json:"translations,omitempty" dynamodbav:",omitempty"`
+	// Idioma em que Name e Description foram retornados
+	Language string `json:"language,omitempty" dynamodbav:"-"`
+
+	// Exige autorização prévia da operadora do convênio antes de ser agendado
+	RequiresPreAuth *bool `json:"requires_pre_auth,omitempty" dynamodbav:",omitempty"`
+	// Exige o termo de consentimento assinado pelo paciente antes de ser realizado
+	RequiresConsent *bool `json:"requires_consent,omitempty" dynamodbav:",omitempty"`
+	// Rótulo curto e cor (#RRGGBB) dos agendamentos do procedimento nos
+	// calendários; sem rótulo vale o nome
+	Label string `json:"label,omitempty" dynamodbav:",omitempty"`
+	Color string `json:"color,omitempty" dynamodbav:",omitempty"`
+	// Etiquetas livres da clínica (ex.: estética, prótese), usadas para
+	// selecionar procedimentos em reajustes de preço
+	Tags []string `json:"tags,omitempty" dynamodbav:",omitempty"`
+	// Recursos que a sala do atendimento precisa ter (ex.: raio-x, sedação),
+	// entre os cadastrados nas salas; sem recursos qualquer cadeira serve
+	RoomFeatures []string `json:"room_features,omitempty" dynamodbav:",omitempty"`
+	// Minutos mantidos livres na agenda do dentista e na sala após o
+	// atendimento, para limpeza e preparo
+	BufferMinutes int `json:"buffer_minutes,omitempty" dynamodbav:",omitempty"`
+	// IDs do procedimento no software anterior, preenchidos na importação
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty" dynamodbav:",omitempty"`
+	// Quando o registro foi removido; removidos ficam ocultos até serem restaurados
+	DeletedAt string `json:"deleted_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// ProcedureTranslation representa o nome e a descrição de um procedimento em um idioma
+type ProcedureTranslation struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// KeepServerFields copia do registro gravado os campos que o cliente não
+// altera (ID, clínica, criação e remoção) ao substituir ou modificar o procedimento
+func (p *Procedure) KeepServerFields(stored Procedure) {
+	p.ID = stored.ID
+	p.ClinicID = stored.ClinicID
+	p.CreatedAt = stored.CreatedAt
+	p.DeletedAt = stored.DeletedAt
+	p.Language = ""
 }
 
 // IsValid verifica se os campos obrigatórios do procedimento estão preenchidos
@@ -23,6 +77,104 @@ func (p *Procedure) IsValid() error {
 	if p.Duration == "" {
 		return fmt.Errorf("duration is required")
 	}
+	for language, translation := range p.Translations {
+		if !i18n.IsSupported(language) {
+			return fmt.Errorf("unsupported translation language %q, use one of %s", language, strings.Join(i18n.Languages, ", "))
+		}
+		if translation.Name == "" {
+			return fmt.Errorf("name is required for the %s translation", language)
+		}
+	}
+	p.Tags = NormalizeTags(p.Tags)
+	p.RoomFeatures = NormalizeTags(p.RoomFeatures)
+	if p.BufferMinutes < 0 || p.BufferMinutes > MaxBufferMinutes {
+		return fmt.Errorf("buffer_minutes must be between 0 and %d", MaxBufferMinutes)
+	}
+	if err := validColor(p.Color); err != nil {
+		return err
+	}
+	if err := p.ExternalIDs.IsValid(); err != nil {
+		return err
+	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// Localize troca o nome e a descrição pelos do primeiro idioma de languages
+// em que o procedimento está disponível, mantendo os do idioma padrão
+// (defaultLanguage) quando nenhum tiver tradução
+func (p *Procedure) Localize(languages []string, defaultLanguage string) {
+	p.Language = defaultLanguage
+	for _, language := range languages {
+		if language == defaultLanguage {
+			return
+		}
+		translation, ok := p.Translations[language]
+		if !ok {
+			continue
+		}
+		p.Name = translation.Name
+		if translation.Description != "" {
+			p.Description = translation.Description
+		}
+		p.Language = language
+		return
+	}
+}
+
+// NeedsPreAuth indica se o procedimento exige autorização prévia da operadora
+func (p *Procedure) NeedsPreAuth() bool {
+	return p.RequiresPreAuth != nil && *p.RequiresPreAuth
+}
+
+// NeedsConsent indica se o procedimento exige o termo de consentimento assinado
+func (p *Procedure) NeedsConsent() bool {
+	return p.RequiresConsent != nil && *p.RequiresConsent
+}
+
+// HasAnyTag indica se o procedimento tem alguma das etiquetas
+func (p *Procedure) HasAnyTag(tags []string) bool {
+	for _, tag := range p.Tags {
+		for _, wanted := range tags {
+			if tag == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeTags deixa as etiquetas em minúsculas, sem espaços nas pontas,
+// sem vazias e sem repetidas
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// PriceValue interpreta o preço do procedimento, aceitando "1234.56" e "1.234,56"
+func (p *Procedure) PriceValue() (float64, error) {
+	price := strings.TrimSpace(p.Price)
+	if strings.Contains(price, ",") {
+		price = strings.ReplaceAll(price, ".", "")
+		price = strings.Replace(price, ",", ".", 1)
+	}
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", p.Price)
+	}
+	return value, nil
+}
+
+// FormatPrice formata um valor monetário no formato usado pelos preços ("1234.56")
+func FormatPrice(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
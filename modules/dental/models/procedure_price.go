@@ -0,0 +1,31 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProcedurePrice representa uma versão do preço de um procedimento, válida a partir de uma data
+type ProcedurePrice struct {
+	ProcedureID   string `json:"procedure_id"`
+	EffectiveFrom string `json:"effective_from"` // YYYY-MM-DD
+	Price         string `json:"price"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// IsValid verifica se o preço e a data de vigência estão preenchidos e são válidos
+func (p *ProcedurePrice) IsValid() error {
+	if p.ProcedureID == "" {
+		return fmt.Errorf("procedure ID is required")
+	}
+	if p.Price == "" {
+		return fmt.Errorf("price is required")
+	}
+	if _, err := (&Procedure{Price: p.Price}).PriceValue(); err != nil {
+		return err
+	}
+	if _, err := time.Parse("2006-01-02", p.EffectiveFrom); err != nil {
+		return fmt.Errorf("effective_from must be in YYYY-MM-DD format")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import "fmt"
+
+// MaxReminderHours limita a antecedência dos lembretes por SMS ou WhatsApp (uma semana)
+const MaxReminderHours = 168
+
+// Canais dos lembretes por mensagem de texto
+const (
+	ReminderChannelSMS      = "sms"
+	ReminderChannelWhatsApp = "whatsapp"
+)
+
+// ReminderSettings representa a configuração dos lembretes de consulta por
+// SMS ou WhatsApp de uma clínica; sem ela, a clínica não envia esses lembretes
+type ReminderSettings struct {
+	ClinicID    string `json:"clinic_id"`
+	Enabled     bool   `json:"enabled"`
+	Channel     string `json:"channel"`      // sms ou whatsapp
+	HoursBefore int    `json:"hours_before"` // antecedência do lembrete em relação à consulta
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// IsValid verifica o canal e a antecedência, usando SMS e 24 horas quando não informados
+func (s *ReminderSettings) IsValid() error {
+	if s.Channel == "" {
+		s.Channel = ReminderChannelSMS
+	}
+	if s.Channel != ReminderChannelSMS && s.Channel != ReminderChannelWhatsApp {
+		return fmt.Errorf("channel must be sms or whatsapp")
+	}
+	if s.HoursBefore == 0 {
+		s.HoursBefore = 24
+	}
+	if s.HoursBefore < 1 || s.HoursBefore > MaxReminderHours {
+		return fmt.Errorf("hours_before must be between 1 and %d", MaxReminderHours)
+	}
+	return nil
+}
+
+// Resultados de um lembrete no registro de envios
+const (
+	ReminderSent    = "sent"    // entregue ao serviço de notificações
+	ReminderFailed  = "failed"  // o envio falhou
+	ReminderSkipped = "skipped" // paciente sem telefone
+)
+
+// ReminderStatuses lista os resultados aceitos no filtro do registro
+var ReminderStatuses = []string{ReminderSent, ReminderFailed, ReminderSkipped}
+
+// ReminderLogEntry representa um lembrete por SMS ou WhatsApp no registro de
+// envios da clínica
+type ReminderLogEntry struct {
+	ClinicID        string `json:"clinic_id"`
+	ID              string `json:"id"` // ordenado pelo horário do envio
+	AppointmentID   string `json:"appointment_id"`
+	PatientID       string `json:"patient_id"`
+	AppointmentTime string `json:"appointment_time"`
+	Channel         string `json:"channel"`
+	To              string `json:"to,omitempty" dynamodbav:",omitempty"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty" dynamodbav:",omitempty"` // motivo da falha ou do descarte
+	CreatedAt       string `json:"created_at"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	compliancemodels "dental-saas/modules/compliance/models"
+	"time"
+)
+
+// HourlyCapacity representa a ocupação de uma hora do dia no período consultado
+type HourlyCapacity struct {
+	Hour             int     `json:"hour"`
+	BookedMinutes    int     `json:"booked_minutes"`
+	AvailableMinutes int     `json:"available_minutes"`
+	Utilization      float64 `json:"utilization"`
+}
+
+// DentistCapacity representa a ocupação de um dentista, por hora do dia
+type DentistCapacity struct {
+	DentistID        string           `json:"dentist_id"`
+	DentistName      string           `json:"dentist_name"`
+	BookedMinutes    int              `json:"booked_minutes"`
+	AvailableMinutes int              `json:"available_minutes"`
+	Utilization      float64          `json:"utilization"`
+	Hours            []HourlyCapacity `json:"hours"`
+}
+
+// CapacityReport representa o mapa de calor de ocupação das cadeiras
+type CapacityReport struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	OpenHour  int               `json:"open_hour"`
+	CloseHour int               `json:"close_hour"`
+	Dentists  []DentistCapacity `json:"dentists"`
+}
+
+// DailyCount representa a contagem de um dia
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// DashboardStats representa os contadores exibidos no painel da clínica
+type DashboardStats struct {
+	Patients           int64        `json:"patients"`
+	AppointmentsPerDay []DailyCount `json:"appointments_per_day"`
+
+	// Checklists de abertura e fechamento de hoje, para a recepção acompanhar o que falta
+	Checklists *compliancemodels.ChecklistReport `json:"checklists,omitempty"`
+}
+
+// LiveMetrics representa os números do dia enviados aos painéis da clínica
+// conforme mudam
+type LiveMetrics struct {
+	Date              string    `json:"date"`
+	Patients          int64     `json:"patients"`
+	AppointmentsToday int64     `json:"appointments_today"`
+	RevenueCollected  float64   `json:"revenue_collected"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
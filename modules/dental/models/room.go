@@ -0,0 +1,45 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Room representa uma sala da clínica com os recursos que oferece, como
+// raio-x ou sedação, exigidos por alguns procedimentos
+type Room struct {
+	ID        string   `json:"id"`
+	ClinicID  string   `json:"clinic_id,omitempty"` // clínica dona do registro
+	Name      string   `json:"name"`
+	Features  []string `json:"features,omitempty" dynamodbav:",omitempty"` // em minúsculas, como as etiquetas
+	Active    bool     `json:"active"`                                     // salas inativas não são consideradas na agenda
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// IsValid verifica o nome da sala e normaliza os recursos
+func (r *Room) IsValid() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	r.Features = NormalizeTags(r.Features)
+	return nil
+}
+
+// Offers indica se a sala tem todos os recursos
+func (r *Room) Offers(features []string) bool {
+	for _, feature := range features {
+		found := false
+		for _, offered := range r.Features {
+			if offered == feature {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
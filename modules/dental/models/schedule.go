@@ -0,0 +1,182 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ScheduleTimeLayout é o formato dos horários da agenda do dentista, no horário da clínica (UTC)
+const ScheduleTimeLayout = "15:04"
+
+// WorkingHours representa um turno de atendimento em um dia da semana
+type WorkingHours struct {
+	Weekday int    `json:"weekday"` // 0 = domingo, ..., 6 = sábado
+	Start   string `json:"start"`   // HH:MM
+	End     string `json:"end"`     // HH:MM
+}
+
+// ScheduleException substitui a agenda semanal entre duas datas: sem horários
+// o dentista não atende (férias, folgas); com horários, atende somente neles
+type ScheduleException struct {
+	From   string `json:"from"`                                    // YYYY-MM-DD
+	To     string `json:"to"`                                      // YYYY-MM-DD, inclusive; padrão From
+	Start  string `json:"start,omitempty" dynamodbav:",omitempty"` // HH:MM
+	End    string `json:"end,omitempty" dynamodbav:",omitempty"`   // HH:MM
+	Reason string `json:"reason,omitempty" dynamodbav:",omitempty"`
+}
+
+// DentistSchedule representa o horário de trabalho de um dentista: os turnos
+// de cada dia da semana e as exceções. Dentistas sem agenda seguem o horário
+// da clínica.
+type DentistSchedule struct {
+	DentistID  string              `json:"dentist_id"`
+	Weekly     []WorkingHours      `json:"weekly"`
+	Exceptions []ScheduleException `json:"exceptions,omitempty" dynamodbav:",omitempty"`
+	CreatedAt  string              `json:"created_at,omitempty" dynamodbav:",omitempty"`
+	UpdatedAt  string              `json:"updated_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// WorkingPeriod é um intervalo de atendimento em uma data
+type WorkingPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DentistAvailability representa o horário de um dentista em uma data e os
+// horários de início livres para uma consulta da duração pedida
+type DentistAvailability struct {
+	DentistID string          `json:"dentist_id"`
+	Date      string          `json:"date"`
+	Duration  int             `json:"duration"` // em minutos
+	Periods   []WorkingPeriod `json:"periods"`
+	Slots     []string        `json:"slots"`
+}
+
+// ClinicSchedule monta a agenda padrão, de segunda a sexta no horário da clínica
+func ClinicSchedule(dentistID string, openHour, closeHour int) DentistSchedule {
+	schedule := DentistSchedule{DentistID: dentistID}
+	for weekday := time.Monday; weekday <= time.Friday; weekday++ {
+		schedule.Weekly = append(schedule.Weekly, WorkingHours{
+			Weekday: int(weekday),
+			Start:   fmt.Sprintf("%02d:00", openHour),
+			End:     fmt.Sprintf("%02d:00", closeHour),
+		})
+	}
+	return schedule
+}
+
+// IsValid verifica os turnos, que não podem se sobrepor no mesmo dia, e as exceções
+func (s *DentistSchedule) IsValid() error {
+	if s.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	for i, hours := range s.Weekly {
+		if hours.Weekday < 0 || hours.Weekday > 6 {
+			return fmt.Errorf("weekday must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		start, end, err := shiftTimes(hours.Start, hours.End)
+		if err != nil {
+			return err
+		}
+		for _, other := range s.Weekly[:i] {
+			if other.Weekday != hours.Weekday {
+				continue
+			}
+			otherStart, otherEnd, _ := shiftTimes(other.Start, other.End)
+			if start < otherEnd && otherStart < end {
+				return fmt.Errorf("working hours overlap on %s", time.Weekday(hours.Weekday))
+			}
+		}
+	}
+	for i := range s.Exceptions {
+		exception := &s.Exceptions[i]
+		if exception.To == "" {
+			exception.To = exception.From
+		}
+		from, err := time.Parse("2006-01-02", exception.From)
+		if err != nil {
+			return fmt.Errorf("exception from must be a date in YYYY-MM-DD format")
+		}
+		to, err := time.Parse("2006-01-02", exception.To)
+		if err != nil {
+			return fmt.Errorf("exception to must be a date in YYYY-MM-DD format")
+		}
+		if to.Before(from) {
+			return fmt.Errorf("exception to must not be before from")
+		}
+		if exception.Start != "" || exception.End != "" {
+			if _, _, err := shiftTimes(exception.Start, exception.End); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PeriodsOn devolve os intervalos em que o dentista atende em uma data, em
+// ordem. As exceções que cobrem a data substituem a agenda semanal.
+func (s *DentistSchedule) PeriodsOn(day time.Time) []WorkingPeriod {
+	date := day.Format("2006-01-02")
+	var hours [][2]string
+	excepted := false
+	for _, exception := range s.Exceptions {
+		if date < exception.From || date > exception.To {
+			continue
+		}
+		if exception.Start == "" {
+			return nil
+		}
+		excepted = true
+		hours = append(hours, [2]string{exception.Start, exception.End})
+	}
+	if !excepted {
+		for _, shift := range s.Weekly {
+			if time.Weekday(shift.Weekday) == day.Weekday() {
+				hours = append(hours, [2]string{shift.Start, shift.End})
+			}
+		}
+	}
+
+	var periods []WorkingPeriod
+	for _, h := range hours {
+		start, end, err := shiftTimes(h[0], h[1])
+		if err != nil {
+			continue
+		}
+		midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		periods = append(periods, WorkingPeriod{Start: midnight.Add(start), End: midnight.Add(end)})
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Start.Before(periods[j].Start)
+	})
+	return periods
+}
+
+// Covers indica se o intervalo [start, end) cabe inteiro em um dos períodos
+// de atendimento do dia
+func (s *DentistSchedule) Covers(start, end time.Time) bool {
+	for _, period := range s.PeriodsOn(start.UTC()) {
+		if !start.Before(period.Start) && !end.After(period.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// shiftTimes interpreta o início e o fim de um turno como durações desde a meia-noite
+func shiftTimes(start, end string) (time.Duration, time.Duration, error) {
+	s, err := time.Parse(ScheduleTimeLayout, start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start %q, use HH:MM", start)
+	}
+	e, err := time.Parse(ScheduleTimeLayout, end)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end %q, use HH:MM", end)
+	}
+	if !e.After(s) {
+		return 0, 0, fmt.Errorf("end %s must be after start %s", end, start)
+	}
+	midnight := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	return s.Sub(midnight), e.Sub(midnight), nil
+}
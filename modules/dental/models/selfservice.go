@@ -0,0 +1,34 @@
+package models
+
+import "fmt"
+
+// SelfServiceAppointment representa os dados do agendamento exibidos ao paciente pelo link do lembrete
+type SelfServiceAppointment struct {
+	DateTime      string `json:"date_time"`
+	Duration      int    `json:"duration"` // em minutos
+	Status        string `json:"status"`
+	DentistName   string `json:"dentist_name,omitempty"`
+	ProcedureName string `json:"procedure_name,omitempty"`
+	// Link atualizado, devolvido após uma remarcação (o anterior deixa de valer)
+	Link string `json:"link,omitempty"`
+}
+
+// SelfServiceSlots representa os horários livres oferecidos ao paciente para remarcação
+type SelfServiceSlots struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Slots []string `json:"slots"`
+}
+
+// RescheduleRequest representa o novo horário escolhido pelo paciente
+type RescheduleRequest struct {
+	DateTime string `json:"date_time"`
+}
+
+// IsValid verifica se o novo horário foi informado
+func (r *RescheduleRequest) IsValid() error {
+	if r.DateTime == "" {
+		return fmt.Errorf("date and time is required")
+	}
+	return nil
+}
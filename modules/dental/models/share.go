@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PatientShare representa o acesso dado pela clínica do paciente a outra
+// clínica da mesma rede ao prontuário dele, até ExpiresAt
+type PatientShare struct {
+	PatientID      string `json:"patient_id"`
+	PatientName    string `json:"patient_name"`
+	OwnerClinicID  string `json:"owner_clinic_id"` // clínica do paciente
+	TargetClinicID string `json:"clinic_id"`       // clínica que recebe o acesso
+	Reason         string `json:"reason"`
+	GrantedBy      string `json:"granted_by,omitempty" dynamodbav:",omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"` // RFC3339
+}
+
+// PatientShareRequest representa o pedido de compartilhamento do prontuário
+// com outra clínica da rede; sem Days vale o prazo máximo da rede
+type PatientShareRequest struct {
+	ClinicID string `json:"clinic_id"`
+	Reason   string `json:"reason"`
+	Days     int    `json:"days,omitempty"`
+}
+
+// IsValid verifica a clínica, o motivo e o prazo, que não pode passar do
+// prazo máximo da rede
+func (s *PatientShareRequest) IsValid(maxDays int) error {
+	if s.ClinicID == "" {
+		return fmt.Errorf("clinic_id is required")
+	}
+	s.Reason = strings.TrimSpace(s.Reason)
+	if s.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	if s.Days < 0 || s.Days > maxDays {
+		return fmt.Errorf("days must be between 1 and %d", maxDays)
+	}
+	if s.Days == 0 {
+		s.Days = maxDays
+	}
+	return nil
+}
+
+// SharedPatientRecord representa o prontuário de um paciente de outra clínica
+// da rede, aberto por compartilhamento
+type SharedPatientRecord struct {
+	OwnerClinicID string `json:"owner_clinic_id"`
+	Policy        string `json:"policy"`               // grant ou open
+	ExpiresAt     string `json:"expires_at,omitempty"` // fim do acesso dado pela clínica do paciente
+	PatientHistory
+}
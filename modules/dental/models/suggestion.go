@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Períodos do dia usados nas preferências de horário
+const (
+	PeriodMorning   = "morning"   // antes das 12h
+	PeriodAfternoon = "afternoon" // das 12h às 18h
+	PeriodEvening   = "evening"   // a partir das 18h
+)
+
+// DayPeriod retorna o período do dia de um horário
+func DayPeriod(t time.Time) string {
+	switch {
+	case t.Hour() < 12:
+		return PeriodMorning
+	case t.Hour() < 18:
+		return PeriodAfternoon
+	default:
+		return PeriodEvening
+	}
+}
+
+// SlotPreferences representa os períodos e dias da semana que o paciente
+// prefere; vazias, valem os horários em que costuma vir
+type SlotPreferences struct {
+	Periods  []string       `json:"periods,omitempty"`
+	Weekdays []time.Weekday `json:"weekdays,omitempty"` // 0 = domingo, ..., 6 = sábado
+}
+
+// ParseSlotPreferences interpreta uma lista separada por vírgulas de
+// períodos (morning, afternoon, evening) e dias da semana em inglês
+// (monday a sunday, ou as três primeiras letras)
+func ParseSlotPreferences(value string) (SlotPreferences, error) {
+	var preferences SlotPreferences
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		switch part {
+		case PeriodMorning, PeriodAfternoon, PeriodEvening:
+			preferences.Periods = append(preferences.Periods, part)
+			continue
+		}
+		weekday, ok := parseWeekday(part)
+		if !ok {
+			return SlotPreferences{}, fmt.Errorf("unknown preference %q, use morning, afternoon, evening or a day of the week", part)
+		}
+		preferences.Weekdays = append(preferences.Weekdays, weekday)
+	}
+	return preferences, nil
+}
+
+// Empty indica se nenhuma preferência foi informada
+func (p SlotPreferences) Empty() bool {
+	return len(p.Periods) == 0 && len(p.Weekdays) == 0
+}
+
+// HasPeriod indica se o período está entre os preferidos
+func (p SlotPreferences) HasPeriod(period string) bool {
+	return oneOf(p.Periods, period)
+}
+
+// HasWeekday indica se o dia da semana está entre os preferidos
+func (p SlotPreferences) HasWeekday(weekday time.Weekday) bool {
+	for _, preferred := range p.Weekdays {
+		if preferred == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWeekday(value string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if value == name || value == name[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// SlotSuggestion representa um horário sugerido para o agendamento, com a
+// pontuação que o ordena e os motivos dela
+type SlotSuggestion struct {
+	DentistID   string   `json:"dentist_id"`
+	DentistName string   `json:"dentist_name"`
+	DateTime    string   `json:"date_time"` // início, no horário da clínica
+	Score       float64  `json:"score"`     // de 0 a 100, maior é melhor
+	Reasons     []string `json:"reasons"`
+}
+
+// SlotSuggestions representa os horários sugeridos para um paciente e
+// procedimento, do melhor para o pior
+type SlotSuggestions struct {
+	PatientID    string           `json:"patient_id"`
+	ProcedureID  string           `json:"procedure_id"`
+	Duration     int              `json:"duration"`                 // em minutos
+	Buffer       int              `json:"buffer_minutes,omitempty"` // mantidos livres após o atendimento
+	RoomFeatures []string         `json:"room_features,omitempty"`
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	Preferences  SlotPreferences  `json:"preferences"`
+	History      int              `json:"history"` // atendimentos anteriores do paciente considerados
+	Suggestions  []SlotSuggestion `json:"suggestions"`
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Categorias NPS de uma resposta
+const (
+	NPSPromoter  = "promoter"
+	NPSPassive   = "passive"
+	NPSDetractor = "detractor"
+)
+
+// Status do acompanhamento de um detrator
+const (
+	FollowUpOpen     = "open"
+	FollowUpResolved = "resolved"
+)
+
+// Survey representa a pesquisa de satisfação enviada após um agendamento concluído
+type Survey struct {
+	AppointmentID string `json:"appointment_id"`
+	ClinicID      string `json:"clinic_id,omitempty"` // clínica dona do registro
+	Token         string `json:"token"`               // identificador público usado no link enviado ao paciente
+	PatientID     string `json:"patient_id"`
+	DentistID     string `json:"dentist_id"`
+	SentAt        string `json:"sent_at"`
+	Score         *int   `json:"score,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+	Category      string `json:"category,omitempty"`
+	RespondedAt   string `json:"responded_at,omitempty"`
+
+	// Preenchidos quando um detrator deixa comentário e precisa de retorno da clínica
+	FollowUpStatus string `json:"follow_up_status,omitempty"`
+	FollowUpNotes  string `json:"follow_up_notes,omitempty"`
+	FollowUpAt     string `json:"follow_up_at,omitempty"`
+}
+
+// PublicSurvey representa os dados da pesquisa exibidos ao paciente
+type PublicSurvey struct {
+	DentistName     string `json:"dentist_name,omitempty"`
+	AppointmentDate string `json:"appointment_date"`
+	Answered        bool   `json:"answered"`
+}
+
+// SurveyResponse representa a resposta do paciente à pesquisa
+type SurveyResponse struct {
+	Score   *int   `json:"score"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// IsValid verifica se a nota está entre 0 e 10
+func (s *SurveyResponse) IsValid() error {
+	if s.Score == nil {
+		return fmt.Errorf("score is required")
+	}
+	if *s.Score < 0 || *s.Score > 10 {
+		return fmt.Errorf("score must be between 0 and 10")
+	}
+	return nil
+}
+
+// NPSCategory classifica uma nota como promotor (9-10), neutro (7-8) ou detrator (0-6)
+func NPSCategory(score int) string {
+	switch {
+	case score >= 9:
+		return NPSPromoter
+	case score >= 7:
+		return NPSPassive
+	default:
+		return NPSDetractor
+	}
+}
+
+// SurveyFollowUp representa o registro do retorno dado a um detrator
+type SurveyFollowUp struct {
+	Status string `json:"status"`
+	Notes  string `json:"notes,omitempty"`
+}
+
+// IsValid verifica se o status do acompanhamento é conhecido
+func (f *SurveyFollowUp) IsValid() error {
+	if f.Status != FollowUpOpen && f.Status != FollowUpResolved {
+		return fmt.Errorf("status must be %q or %q", FollowUpOpen, FollowUpResolved)
+	}
+	return nil
+}
+
+// NPSScore representa o NPS calculado sobre um conjunto de respostas
+type NPSScore struct {
+	Period     string  `json:"period,omitempty"`
+	Responses  int     `json:"responses"`
+	Promoters  int     `json:"promoters"`
+	Passives   int     `json:"passives"`
+	Detractors int     `json:"detractors"`
+	NPS        float64 `json:"nps"`
+}
+
+// Add contabiliza uma resposta e recalcula o NPS
+func (s *NPSScore) Add(category string) {
+	s.Responses++
+	switch category {
+	case NPSPromoter:
+		s.Promoters++
+	case NPSPassive:
+		s.Passives++
+	case NPSDetractor:
+		s.Detractors++
+	}
+	s.NPS = math.Round(float64(s.Promoters-s.Detractors)/float64(s.Responses)*10000) / 100
+}
+
+// NPSTrend representa o NPS total e a evolução por período de uma clínica ou dentista
+type NPSTrend struct {
+	DentistID   string     `json:"dentist_id,omitempty"`
+	DentistName string     `json:"dentist_name,omitempty"`
+	Overall     NPSScore   `json:"overall"`
+	Periods     []NPSScore `json:"periods"`
+}
+
+// NPSReport representa o relatório de NPS da clínica e de cada dentista
+type NPSReport struct {
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Interval string     `json:"interval"`
+	Clinic   NPSTrend   `json:"clinic"`
+	Dentists []NPSTrend `json:"dentists"`
+}
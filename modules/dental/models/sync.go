@@ -0,0 +1,140 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Limites de mudanças por resposta da sincronização
+const (
+	DefaultSyncLimit = 500
+	MaxSyncLimit     = 1000
+)
+
+// SyncChanges representa as mudanças de um tipo de registro desde o cursor:
+// os registros criados e alterados, no estado atual, e os IDs dos removidos
+type SyncChanges[T any] struct {
+	Created []T      `json:"created"`
+	Updated []T      `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+// SyncResponse representa as mudanças desde o cursor enviado pelo cliente,
+// por tipo de registro. Cursor é enviado na próxima sincronização; com
+// HasMore, há mais mudanças a buscar logo em seguida.
+type SyncResponse struct {
+	Cursor       string                    `json:"cursor"`
+	HasMore      bool                      `json:"has_more"`
+	Dentists     *SyncChanges[Dentist]     `json:"dentists,omitempty"`
+	Patients     *SyncChanges[Patient]     `json:"patients,omitempty"`
+	Procedures   *SyncChanges[Procedure]   `json:"procedures,omitempty"`
+	Appointments *SyncChanges[Appointment] `json:"appointments,omitempty"`
+}
+
+// MaxSyncWrites é o limite de mudanças por envio de um cliente offline
+const MaxSyncWrites = 100
+
+// Ações de uma mudança enviada por um cliente offline
+const (
+	SyncWriteCreate = "create"
+	SyncWriteUpdate = "update"
+	SyncWriteDelete = "delete"
+)
+
+// Situações de uma mudança enviada após a reconciliação
+const (
+	SyncWriteApplied  = "applied"
+	SyncWriteConflict = "conflict"
+	SyncWriteFailed   = "failed"
+)
+
+// Motivos de conflito: o registro foi alterado ou removido no servidor desde
+// a versão base, ou já existe um registro com o ID a criar
+const (
+	SyncConflictUpdated = "updated"
+	SyncConflictDeleted = "deleted"
+	SyncConflictExists  = "exists"
+)
+
+// SyncWrite representa uma mudança feita offline. BaseVersion é o cursor da
+// sincronização em que o cliente recebeu o registro que alterou; Data segue o
+// corpo da criação do registro ou, nas atualizações, é um JSON Merge Patch
+// com os campos alterados (null limpa um campo).
+type SyncWrite struct {
+	Entity      string          `json:"entity"`
+	Action      string          `json:"action"`
+	ID          string          `json:"id,omitempty"`
+	BaseVersion string          `json:"base_version,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+}
+
+// SyncWriteRequest representa as mudanças feitas offline, aplicadas na ordem enviada
+type SyncWriteRequest struct {
+	Changes []SyncWrite `json:"changes"`
+}
+
+// IsValid verifica as mudanças; os tipos de registro são verificados pelo handler
+func (req *SyncWriteRequest) IsValid() error {
+	if len(req.Changes) == 0 {
+		return fmt.Errorf("at least one change is required")
+	}
+	if len(req.Changes) > MaxSyncWrites {
+		return fmt.Errorf("at most %d changes are allowed", MaxSyncWrites)
+	}
+	for i, change := range req.Changes {
+		switch change.Action {
+		case SyncWriteCreate:
+			if len(change.Data) == 0 {
+				return fmt.Errorf("change %d: data is required to create", i)
+			}
+		case SyncWriteUpdate, SyncWriteDelete:
+			if change.ID == "" {
+				return fmt.Errorf("change %d: id is required to %s", i, change.Action)
+			}
+			if change.BaseVersion == "" {
+				return fmt.Errorf("change %d: base_version is required to %s", i, change.Action)
+			}
+			if change.Action == SyncWriteUpdate && len(change.Data) == 0 {
+				return fmt.Errorf("change %d: data is required to update", i)
+			}
+		default:
+			return fmt.Errorf("change %d: action must be create, update or delete", i)
+		}
+	}
+	return nil
+}
+
+// SyncServerChange representa uma mudança feita no servidor em um registro
+type SyncServerChange struct {
+	Seq    string `json:"seq"`
+	Action string `json:"action"`
+	At     string `json:"at"`
+}
+
+// SyncConflict descreve por que uma mudança não foi aplicada: o estado atual
+// do registro, ausente se foi removido, e as mudanças feitas no servidor
+// desde a versão base, para o cliente mesclar e reenviar
+type SyncConflict struct {
+	Reason  string             `json:"reason"`
+	Current json.RawMessage    `json:"current,omitempty" swaggertype:"object"`
+	Changes []SyncServerChange `json:"changes,omitempty"`
+}
+
+// SyncWriteResult representa o resultado de uma mudança, na ordem enviada
+type SyncWriteResult struct {
+	Index    int             `json:"index"`
+	Entity   string          `json:"entity"`
+	ID       string          `json:"id,omitempty"`
+	Status   string          `json:"status"`
+	Record   json.RawMessage `json:"record,omitempty" swaggertype:"object"`
+	Error    string          `json:"error,omitempty"`
+	Conflict *SyncConflict   `json:"conflict,omitempty"`
+}
+
+// SyncWriteResponse representa o resultado das mudanças enviadas
+type SyncWriteResponse struct {
+	Applied   int               `json:"applied"`
+	Conflicts int               `json:"conflicts"`
+	Failed    int               `json:"failed"`
+	Results   []SyncWriteResult `json:"results"`
+}
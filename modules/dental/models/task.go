@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status conhecidos de uma tarefa
+const (
+	TaskStatusOpen       = "open"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusDone       = "done"
+	TaskStatusCancelled  = "cancelled"
+)
+
+// Task representa uma tarefa interna da equipe, opcionalmente ligada a um paciente
+type Task struct {
+	ID          string `json:"id"`
+	ClinicID    string `json:"clinic_id,omitempty"` // clínica dona do registro
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty" dynamodbav:",omitempty"`
+	Assignee    string `json:"assignee"`
+	PatientID   string `json:"patient_id,omitempty" dynamodbav:",omitempty"`
+	DueDate     string `json:"due_date,omitempty" dynamodbav:",omitempty"` // YYYY-MM-DD
+	Status      string `json:"status"`
+	CreatedBy   string `json:"created_by,omitempty" dynamodbav:",omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	Version     int64  `json:"version"` // versão do registro, aumentada a cada alteração
+	CompletedAt string `json:"completed_at,omitempty" dynamodbav:",omitempty"`
+
+	// Lembrete opcional enviado ao responsável pelo serviço de notificações
+	RemindAt       string `json:"remind_at,omitempty" dynamodbav:",omitempty"` // RFC3339
+	ReminderSentAt string `json:"reminder_sent_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// IsValid verifica se os campos obrigatórios da tarefa estão preenchidos
+func (t *Task) IsValid() error {
+	if t.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if t.Assignee == "" {
+		return fmt.Errorf("assignee is required")
+	}
+	switch t.Status {
+	case TaskStatusOpen, TaskStatusInProgress, TaskStatusDone, TaskStatusCancelled:
+	default:
+		return fmt.Errorf("status must be one of open, in_progress, done or cancelled")
+	}
+	if t.DueDate != "" {
+		if _, err := time.Parse("2006-01-02", t.DueDate); err != nil {
+			return fmt.Errorf("due date must be in YYYY-MM-DD format")
+		}
+	}
+	if t.RemindAt != "" {
+		if _, err := time.Parse(time.RFC3339, t.RemindAt); err != nil {
+			return fmt.Errorf("remind at must be an RFC3339 timestamp")
+		}
+	}
+	return nil
+}
+
+// IsClosed indica se a tarefa foi concluída ou cancelada
+func (t *Task) IsClosed() bool {
+	return t.Status == TaskStatusDone || t.Status == TaskStatusCancelled
+}
+
+// IsOverdue indica se a tarefa ainda aberta passou do prazo no dia informado (YYYY-MM-DD)
+func (t *Task) IsOverdue(today string) bool {
+	return !t.IsClosed() && t.DueDate != "" && t.DueDate < today
+}
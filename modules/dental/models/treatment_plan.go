@@ -0,0 +1,203 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Status de um plano de tratamento
+const (
+	TreatmentPlanProposed   = "proposed"    // apresentado ao paciente, ainda pode ser alterado
+	TreatmentPlanApproved   = "approved"    // aceito pelo paciente
+	TreatmentPlanInProgress = "in_progress" // com procedimentos agendados ou realizados
+	TreatmentPlanCompleted  = "completed"   // todos os procedimentos realizados
+)
+
+// Status de um item do plano de tratamento
+const (
+	TreatmentItemPlanned   = "planned"
+	TreatmentItemScheduled = "scheduled"
+	TreatmentItemCompleted = "completed"
+)
+
+// Prioridades de um item do plano, da mais alta à mais baixa
+const (
+	TreatmentPriorityUrgent = "urgent"
+	TreatmentPriorityHigh   = "high"
+	TreatmentPriorityMedium = "medium"
+	TreatmentPriorityLow    = "low"
+)
+
+// TreatmentPriorities lista as prioridades aceitas, da mais alta à mais baixa
+var TreatmentPriorities = []string{TreatmentPriorityUrgent, TreatmentPriorityHigh, TreatmentPriorityMedium, TreatmentPriorityLow}
+
+// TreatmentPlanItem representa um procedimento planejado para o paciente
+type TreatmentPlanItem struct {
+	ID            string `json:"id"`
+	ProcedureID   string `json:"procedure_id"`
+	Tooth         int    `json:"tooth,omitempty" dynamodbav:",omitempty"` // número FDI, quando o procedimento é em um dente
+	EstimatedCost string `json:"estimated_cost"`                          // padrão: preço do dentista para o procedimento
+	Priority      string `json:"priority"`                                // padrão: medium
+	Status        string `json:"status"`
+	AppointmentID string `json:"appointment_id,omitempty" dynamodbav:",omitempty"` // agendamento criado para o item
+	Notes         string `json:"notes,omitempty" dynamodbav:",omitempty"`
+}
+
+// TreatmentPlan representa o plano de tratamento de um paciente: os
+// procedimentos propostos pelo dentista, com custo estimado e prioridade,
+// que depois de aprovados são convertidos em agendamentos
+type TreatmentPlan struct {
+	ID             string              `json:"id"`
+	ClinicID       string              `json:"clinic_id,omitempty"` // clínica dona do registro
+	PatientID      string              `json:"patient_id"`
+	DentistID      string              `json:"dentist_id"`
+	Title          string              `json:"title,omitempty" dynamodbav:",omitempty"`
+	Notes          string              `json:"notes,omitempty" dynamodbav:",omitempty"`
+	Status         string              `json:"status"`
+	Items          []TreatmentPlanItem `json:"items"`
+	EstimatedTotal string              `json:"estimated_total"`
+	ApprovedAt     string              `json:"approved_at,omitempty" dynamodbav:",omitempty"`
+	ApprovedBy     string              `json:"approved_by,omitempty" dynamodbav:",omitempty"`
+	CompletedAt    string              `json:"completed_at,omitempty" dynamodbav:",omitempty"`
+	CreatedAt      string              `json:"created_at"`
+	UpdatedAt      string              `json:"updated_at"`
+	Version        int64               `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica os campos obrigatórios do plano e de cada item, preenchendo
+// a prioridade padrão
+func (p *TreatmentPlan) IsValid() error {
+	if p.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if p.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	if len(p.Items) == 0 {
+		return fmt.Errorf("at least one item is required")
+	}
+	for i := range p.Items {
+		item := &p.Items[i]
+		if item.ProcedureID == "" {
+			return fmt.Errorf("procedure ID is required for every item")
+		}
+		if item.Tooth != 0 && !ValidToothNumber(item.Tooth) {
+			return fmt.Errorf("tooth must follow FDI numbering (11-48 or 51-85)")
+		}
+		if item.Priority == "" {
+			item.Priority = TreatmentPriorityMedium
+		}
+		if !oneOf(TreatmentPriorities, item.Priority) {
+			return fmt.Errorf("priority must be one of %s", strings.Join(TreatmentPriorities, ", "))
+		}
+		if item.EstimatedCost != "" {
+			cost, err := (&Procedure{Price: item.EstimatedCost}).PriceValue()
+			if err != nil {
+				return fmt.Errorf("invalid estimated cost %q", item.EstimatedCost)
+			}
+			if cost < 0 {
+				return fmt.Errorf("estimated cost must not be negative")
+			}
+		}
+	}
+	return nil
+}
+
+// Total soma o custo estimado dos itens
+func (p *TreatmentPlan) Total() string {
+	total := 0.0
+	for _, item := range p.Items {
+		if cost, err := (&Procedure{Price: item.EstimatedCost}).PriceValue(); err == nil {
+			total += cost
+		}
+	}
+	return FormatPrice(total)
+}
+
+// PlannedItems retorna os índices dos itens ainda não agendados, da maior
+// para a menor prioridade e, na mesma prioridade, na ordem do plano. Com ids,
+// somente os itens informados.
+func (p *TreatmentPlan) PlannedItems(ids []string) []int {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var indexes []int
+	for i, item := range p.Items {
+		if item.Status == TreatmentItemPlanned && (len(ids) == 0 || wanted[item.ID]) {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return priorityRank(p.Items[indexes[a]].Priority) < priorityRank(p.Items[indexes[b]].Priority)
+	})
+	return indexes
+}
+
+// Progress atualiza o status do plano aprovado conforme os itens: em
+// andamento quando algum foi agendado ou realizado, concluído quando todos
+// foram realizados. Retorna se o plano foi concluído agora.
+func (p *TreatmentPlan) Progress() bool {
+	if p.Status == TreatmentPlanProposed {
+		return false
+	}
+	completed, started := 0, false
+	for _, item := range p.Items {
+		switch item.Status {
+		case TreatmentItemCompleted:
+			completed++
+			started = true
+		case TreatmentItemScheduled:
+			started = true
+		}
+	}
+	previous := p.Status
+	switch {
+	case completed == len(p.Items):
+		p.Status = TreatmentPlanCompleted
+	case started:
+		p.Status = TreatmentPlanInProgress
+	default:
+		p.Status = TreatmentPlanApproved
+	}
+	return p.Status == TreatmentPlanCompleted && previous != TreatmentPlanCompleted
+}
+
+func priorityRank(priority string) int {
+	for i, p := range TreatmentPriorities {
+		if p == priority {
+			return i
+		}
+	}
+	return len(TreatmentPriorities)
+}
+
+// TreatmentPlanScheduleRequest representa a conversão dos itens planejados em
+// agendamentos
+type TreatmentPlanScheduleRequest struct {
+	DentistID string   `json:"dentist_id,omitempty"` // padrão: dentista do plano
+	Start     string   `json:"start"`                // data e hora da primeira consulta
+	DaysApart int      `json:"days_apart"`           // 0 agenda os procedimentos em sequência no mesmo dia
+	ItemIDs   []string `json:"item_ids,omitempty"`   // padrão: todos os itens ainda não agendados
+}
+
+// IsValid verifica se o início foi informado e se o intervalo não é negativo
+func (s *TreatmentPlanScheduleRequest) IsValid() error {
+	if s.Start == "" {
+		return fmt.Errorf("start is required")
+	}
+	if _, err := (&Appointment{DateTime: s.Start}).StartTime(); err != nil {
+		return err
+	}
+	if s.DaysApart < 0 {
+		return fmt.Errorf("days_apart must not be negative")
+	}
+	return nil
+}
+
+// TreatmentPlanSchedule representa os agendamentos criados a partir do plano
+type TreatmentPlanSchedule struct {
+	Plan         TreatmentPlan `json:"plan"`
+	Appointments []Appointment `json:"appointments"`
+}
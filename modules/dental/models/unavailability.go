@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Origem de um bloqueio de agenda
+const (
+	UnavailabilitySourceManual = "manual" // cadastrado pela equipe
+	UnavailabilitySourceCalDAV = "caldav" // importado da agenda pessoal do dentista, substituído a cada sincronização
+)
+
+// UnavailabilityLayout é o formato de início e fim dos bloqueios, em UTC
+const UnavailabilityLayout = "2006-01-02T15:04"
+
+// Unavailability representa um período em que o dentista não atende e que
+// não é oferecido para agendamento
+type Unavailability struct {
+	ID         string `json:"id"`
+	DentistID  string `json:"dentist_id"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Reason     string `json:"reason,omitempty" dynamodbav:",omitempty"`
+	Source     string `json:"source"`
+	ExternalID string `json:"external_id,omitempty" dynamodbav:",omitempty"` // UID do evento na agenda externa
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// IsValid verifica o dentista e se o fim é posterior ao início
+func (u *Unavailability) IsValid() error {
+	if u.DentistID == "" {
+		return fmt.Errorf("dentist ID is required")
+	}
+	start, end, err := u.Period()
+	if err != nil {
+		return err
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end must be after start")
+	}
+	return nil
+}
+
+// Period interpreta o início e o fim do bloqueio
+func (u *Unavailability) Period() (time.Time, time.Time, error) {
+	start, err := parseAppointmentTime(u.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start %q", u.Start)
+	}
+	end, err := parseAppointmentTime(u.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end %q", u.End)
+	}
+	return start, end, nil
+}
+
+// CalendarSync representa a agenda CalDAV pessoal de um dentista: os
+// horários ocupados nela viram bloqueios e os agendamentos são publicados nela
+type CalendarSync struct {
+	DentistID      string `json:"dentist_id"`
+	URL            string `json:"url"` // coleção da agenda, ex.: https://caldav.example.com/calendars/ana/personal/
+	Username       string `json:"username,omitempty" dynamodbav:",omitempty"`
+	Password       string `json:"password,omitempty" dynamodbav:"-"` // recebida ao conectar, nunca gravada em claro nem devolvida pela API
+	SealedPassword string `json:"-" dynamodbav:",omitempty"`         // a senha cifrada com CALDAV_SECRET, como fica gravada
+	PasswordSet    bool   `json:"password_set" dynamodbav:"-"`       // se há senha gravada, já que ela não é devolvida
+	LastSyncAt     string `json:"last_sync_at,omitempty" dynamodbav:",omitempty"`
+	LastError      string `json:"last_error,omitempty" dynamodbav:",omitempty"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// IsValid verifica se a URL da agenda é HTTP(S)
+func (c *CalendarSync) IsValid() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	return nil
+}
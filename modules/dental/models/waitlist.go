@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Situações de uma entrada da lista de espera
+const (
+	WaitlistWaiting = "waiting" // aguardando um horário
+	WaitlistBooked  = "booked"  // agendado
+	WaitlistRemoved = "removed" // desistiu ou não precisa mais
+)
+
+// WaitlistStatuses lista as situações aceitas
+var WaitlistStatuses = []string{WaitlistWaiting, WaitlistBooked, WaitlistRemoved}
+
+// WaitlistEntry representa um paciente aguardando um horário para um
+// procedimento, oferecido quando uma vaga abre
+type WaitlistEntry struct {
+	ID            string          `json:"id"`
+	ClinicID      string          `json:"clinic_id,omitempty"` // clínica dona do registro
+	PatientID     string          `json:"patient_id"`
+	ProcedureID   string          `json:"procedure_id"`
+	DentistID     string          `json:"dentist_id,omitempty" dynamodbav:",omitempty"` // vazio aceita qualquer dentista habilitado
+	Preferences   SlotPreferences `json:"preferences"`
+	EarliestDate  string          `json:"earliest_date,omitempty" dynamodbav:",omitempty"` // YYYY-MM-DD
+	LatestDate    string          `json:"latest_date,omitempty" dynamodbav:",omitempty"`   // YYYY-MM-DD
+	Notes         string          `json:"notes,omitempty" dynamodbav:",omitempty"`
+	Status        string          `json:"status"`
+	AppointmentID string          `json:"appointment_id,omitempty" dynamodbav:",omitempty"` // agendamento marcado, na situação booked
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+}
+
+// IsValid verifica o paciente, o procedimento, a situação e o período aceito
+func (e *WaitlistEntry) IsValid() error {
+	if e.PatientID == "" {
+		return fmt.Errorf("patient ID is required")
+	}
+	if e.ProcedureID == "" {
+		return fmt.Errorf("procedure ID is required")
+	}
+	if e.Status == "" {
+		e.Status = WaitlistWaiting
+	}
+	if !oneOf(WaitlistStatuses, e.Status) {
+		return fmt.Errorf("status must be one of waiting, booked, removed")
+	}
+	for _, date := range []string{e.EarliestDate, e.LatestDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("earliest and latest dates must be in YYYY-MM-DD format")
+		}
+	}
+	if e.EarliestDate != "" && e.LatestDate != "" && e.LatestDate < e.EarliestDate {
+		return fmt.Errorf("latest date must not be before earliest date")
+	}
+	for _, period := range e.Preferences.Periods {
+		if period != PeriodMorning && period != PeriodAfternoon && period != PeriodEvening {
+			return fmt.Errorf("preferred periods must be morning, afternoon or evening")
+		}
+	}
+	for _, weekday := range e.Preferences.Weekdays {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return fmt.Errorf("preferred weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	return nil
+}
+
+// Accepts indica se o paciente aceita um horário na data (YYYY-MM-DD)
+func (e *WaitlistEntry) Accepts(day string) bool {
+	return (e.EarliestDate == "" || day >= e.EarliestDate) && (e.LatestDate == "" || day <= e.LatestDate)
+}
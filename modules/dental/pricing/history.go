@@ -0,0 +1,285 @@
+package pricing
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// HistoryTableName holds the versioned procedure prices, keyed by ProcedureID and EffectiveFrom
+const HistoryTableName = "ProcedurePrices"
+
+const dateLayout = "2006-01-02"
+
+// History returns the price versions of a procedure, oldest first
+func History(ctx context.Context, procedureID string) ([]models.ProcedurePrice, error) {
+	var versions []models.ProcedurePrice
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(HistoryTableName),
+		KeyConditionExpression: aws.String("ProcedureID = :procedureId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":procedureId": &types.AttributeValueMemberS{Value: procedureID},
+		},
+	}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("querying price history of procedure %s: %v", procedureID, err)
+		}
+		var pageVersions []models.ProcedurePrice
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageVersions); err != nil {
+			return nil, fmt.Errorf("unmarshaling price history: %v", err)
+		}
+		versions = append(versions, pageVersions...)
+	}
+	return versions, nil
+}
+
+// versionAt returns the version in force on a day from versions sorted oldest first
+func versionAt(versions []models.ProcedurePrice, day string) *models.ProcedurePrice {
+	var current *models.ProcedurePrice
+	for i := range versions {
+		if versions[i].EffectiveFrom > day {
+			break
+		}
+		current = &versions[i]
+	}
+	return current
+}
+
+// SchedulePrice records a price for a procedure from effectiveFrom (YYYY-MM-DD)
+// on. The first change also records the price the procedure had until then,
+// so earlier dates keep resolving to it. When the price is already in force
+// the procedure's current price is updated as well.
+func SchedulePrice(ctx context.Context, procedure models.Procedure, price, effectiveFrom string) (models.ProcedurePrice, error) {
+	version := models.ProcedurePrice{
+		ProcedureID:   procedure.ID,
+		EffectiveFrom: effectiveFrom,
+		Price:         price,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := version.IsValid(); err != nil {
+		return models.ProcedurePrice{}, err
+	}
+
+	versions, err := History(ctx, procedure.ID)
+	if err != nil {
+		return models.ProcedurePrice{}, err
+	}
+	if len(versions) == 0 && procedure.Price != "" {
+		initial := models.ProcedurePrice{
+			ProcedureID:   procedure.ID,
+			EffectiveFrom: "0001-01-01",
+			Price:         procedure.Price,
+			CreatedAt:     version.CreatedAt,
+		}
+		if err := putVersion(ctx, initial); err != nil {
+			return models.ProcedurePrice{}, err
+		}
+	}
+	if err := putVersion(ctx, version); err != nil {
+		return models.ProcedurePrice{}, err
+	}
+
+	if effectiveFrom <= time.Now().UTC().Format(dateLayout) {
+		versions, err = History(ctx, procedure.ID)
+		if err != nil {
+			return models.ProcedurePrice{}, err
+		}
+		if current := versionAt(versions, time.Now().UTC().Format(dateLayout)); current != nil && current.Price != procedure.Price {
+			if err := setCurrentPrice(ctx, procedure.ID, current.Price); err != nil {
+				return models.ProcedurePrice{}, err
+			}
+		}
+	}
+	return version, nil
+}
+
+func putVersion(ctx context.Context, version models.ProcedurePrice) error {
+	item, err := attributevalue.MarshalMap(version)
+	if err != nil {
+		return fmt.Errorf("marshaling price version: %v", err)
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(HistoryTableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("saving price version of procedure %s: %v", version.ProcedureID, err)
+	}
+	return nil
+}
+
+// setCurrentPrice updates the price stored on the procedure itself
+func setCurrentPrice(ctx context.Context, procedureID, price string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("Procedures"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: procedureID},
+		},
+		UpdateExpression:    aws.String("SET Price = :price, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":price":     &types.AttributeValueMemberS{Value: price},
+			":updatedAt": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("updating price of procedure %s: %v", procedureID, err)
+	}
+	return nil
+}
+
+// PriceHistory indexes every procedure's price versions for bulk lookups (reports)
+type PriceHistory map[string][]models.ProcedurePrice
+
+// LoadHistory reads the price versions of every procedure
+func LoadHistory(ctx context.Context) (PriceHistory, error) {
+	history := make(PriceHistory)
+	input := &dynamodb.ScanInput{TableName: aws.String(HistoryTableName)}
+	for {
+		pageCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(pageCtx, input)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("scanning price history: %v", err)
+		}
+
+		var versions []models.ProcedurePrice
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &versions); err != nil {
+			return nil, fmt.Errorf("unmarshaling price history: %v", err)
+		}
+		for _, version := range versions {
+			history[version.ProcedureID] = append(history[version.ProcedureID], version)
+		}
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	for _, versions := range history {
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].EffectiveFrom < versions[j].EffectiveFrom
+		})
+	}
+	return history, nil
+}
+
+// PriceAt returns the catalog price of a procedure in force at a time,
+// falling back to the given current price when the procedure has no history
+func (h PriceHistory) PriceAt(procedureID string, at time.Time, currentPrice float64) float64 {
+	version := versionAt(h[procedureID], at.UTC().Format(dateLayout))
+	if version == nil {
+		return currentPrice
+	}
+	price, err := (&models.Procedure{Price: version.Price}).PriceValue()
+	if err != nil {
+		return currentPrice
+	}
+	return price
+}
+
+// ActivateDuePrices copies the version in force today onto procedures whose
+// stored price is out of date, returning how many were updated
+func ActivateDuePrices(ctx context.Context) (int, error) {
+	activated := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := activateClinicPrices(ctx)
+		activated += n
+		return err
+	})
+	return activated, err
+}
+
+// activateClinicPrices activates the prices of the clinic of ctx
+func activateClinicPrices(ctx context.Context) (int, error) {
+	history, err := LoadHistory(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	today := time.Now().UTC().Format(dateLayout)
+	activated := 0
+	for procedureID, versions := range history {
+		current := versionAt(versions, today)
+		if current == nil {
+			continue
+		}
+
+		getCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+			TableName: aws.String("Procedures"),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: procedureID},
+			},
+			ProjectionExpression: aws.String("Price"),
+		})
+		cancel()
+		if err != nil {
+			return activated, fmt.Errorf("fetching procedure %s: %v", procedureID, err)
+		}
+		if result.Item == nil {
+			continue
+		}
+		if stored, ok := result.Item["Price"].(*types.AttributeValueMemberS); ok && stored.Value == current.Price {
+			continue
+		}
+		if err := setCurrentPrice(ctx, procedureID, current.Price); err != nil {
+			return activated, err
+		}
+		activated++
+	}
+	return activated, nil
+}
+
+// StartPriceActivator applies scheduled price changes once at startup and then every interval
+func StartPriceActivator(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	activate := func() {
+		n, err := ActivateDuePrices(ctx)
+		if err != nil {
+			log.Printf("Error activating scheduled prices: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Activated %d scheduled procedure prices", n)
+		}
+	}
+
+	go func() {
+		activate()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				activate()
+			}
+		}
+	}()
+}
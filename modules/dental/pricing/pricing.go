@@ -0,0 +1,169 @@
+package pricing
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableName holds the dentist-specific price overrides, keyed by DentistID and ProcedureID
+const TableName = "DentistPrices"
+
+// ErrProcedureNotFound is returned when resolving the price of an unknown procedure
+var ErrProcedureNotFound = errors.New("procedure not found")
+
+// Resolve returns the price a dentist charges for a procedure at a time: the
+// dentist's override when one exists, otherwise the catalog price in force then
+func Resolve(ctx context.Context, procedureID, dentistID string, at time.Time) (models.EffectivePrice, error) {
+	day := at.UTC().Format(dateLayout)
+	if dentistID != "" {
+		override, err := GetOverride(ctx, dentistID, procedureID)
+		if err != nil {
+			return models.EffectivePrice{}, err
+		}
+		if override != nil {
+			amount, err := override.PriceValue()
+			if err != nil {
+				return models.EffectivePrice{}, err
+			}
+			return models.EffectivePrice{
+				ProcedureID: procedureID,
+				DentistID:   dentistID,
+				At:          day,
+				Price:       override.Price,
+				Amount:      amount,
+				Source:      models.PriceSourceDentist,
+			}, nil
+		}
+	}
+
+	procedure, err := GetProcedure(ctx, procedureID)
+	if err != nil {
+		return models.EffectivePrice{}, err
+	}
+	price := models.EffectivePrice{
+		ProcedureID: procedureID,
+		DentistID:   dentistID,
+		At:          day,
+		Price:       procedure.Price,
+		Source:      models.PriceSourceProcedure,
+	}
+
+	versions, err := History(ctx, procedureID)
+	if err != nil {
+		return models.EffectivePrice{}, err
+	}
+	if version := versionAt(versions, day); version != nil {
+		price.Price = version.Price
+		price.EffectiveFrom = version.EffectiveFrom
+	}
+
+	amount, err := (&models.Procedure{Price: price.Price}).PriceValue()
+	if err != nil {
+		return models.EffectivePrice{}, err
+	}
+	price.Amount = amount
+	return price, nil
+}
+
+// GetProcedure fetches a catalog procedure, returning ErrProcedureNotFound when it does not exist
+func GetProcedure(ctx context.Context, procedureID string) (models.Procedure, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Procedures"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: procedureID},
+		},
+	})
+	if err != nil {
+		return models.Procedure{}, fmt.Errorf("fetching procedure %s: %v", procedureID, err)
+	}
+	if result.Item == nil {
+		return models.Procedure{}, ErrProcedureNotFound
+	}
+	var procedure models.Procedure
+	if err := attributevalue.UnmarshalMap(result.Item, &procedure); err != nil {
+		return models.Procedure{}, fmt.Errorf("unmarshaling procedure %s: %v", procedureID, err)
+	}
+	return procedure, nil
+}
+
+// GetOverride returns the dentist's price for a procedure, or nil when there is none
+func GetOverride(ctx context.Context, dentistID, procedureID string) (*models.DentistPrice, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"DentistID":   &types.AttributeValueMemberS{Value: dentistID},
+			"ProcedureID": &types.AttributeValueMemberS{Value: procedureID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching price of dentist %s for procedure %s: %v", dentistID, procedureID, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var price models.DentistPrice
+	if err := attributevalue.UnmarshalMap(result.Item, &price); err != nil {
+		return nil, fmt.Errorf("unmarshaling dentist price: %v", err)
+	}
+	return &price, nil
+}
+
+// Overrides indexes every dentist price override for bulk lookups (reports)
+type Overrides map[string]map[string]float64
+
+// LoadOverrides reads every dentist price override
+func LoadOverrides(ctx context.Context) (Overrides, error) {
+	overrides := make(Overrides)
+	input := &dynamodb.ScanInput{TableName: aws.String(TableName)}
+	for {
+		pageCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(pageCtx, input)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("scanning dentist prices: %v", err)
+		}
+
+		var prices []models.DentistPrice
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &prices); err != nil {
+			return nil, fmt.Errorf("unmarshaling dentist prices: %v", err)
+		}
+		for _, price := range prices {
+			amount, err := price.PriceValue()
+			if err != nil {
+				continue
+			}
+			if overrides[price.DentistID] == nil {
+				overrides[price.DentistID] = make(map[string]float64)
+			}
+			overrides[price.DentistID][price.ProcedureID] = amount
+		}
+
+		if result.LastEvaluatedKey == nil {
+			return overrides, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// Price returns the dentist's override for a procedure, falling back to the catalog price
+func (o Overrides) Price(dentistID, procedureID string, catalogPrice float64) float64 {
+	if price, ok := o[dentistID][procedureID]; ok {
+		return price
+	}
+	return catalogPrice
+}
@@ -0,0 +1,380 @@
+// Package reminders sends appointment reminders by SMS or WhatsApp, hours
+// before each appointment, for the clinics that enable them, and keeps the
+// log of what was sent.
+package reminders
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/selfservice"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/notify"
+	"dental-saas/shared/paging"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// SettingsTable holds the reminder settings of each clinic, keyed by ClinicID
+	SettingsTable = "ReminderSettings"
+	// LogTable holds the reminders sent, keyed by ClinicID and a time-ordered ID
+	LogTable = "ReminderLog"
+)
+
+// Kind is the notification kind of the reminders
+const Kind = "appointment_text_reminder"
+
+func init() {
+	notify.RegisterKind(notify.Kind{
+		Name:        Kind,
+		Description: "SMS or WhatsApp reminder sent to the patient hours before an appointment, for clinics that enable them",
+		Fields: map[string]string{
+			"patient_name":     "Maria Silva",
+			"dentist_name":     "Dr. João Souza",
+			"appointment_time": "2024-03-11 09:00",
+			"link":             selfservice.Link("sample-token"),
+		},
+		Subject: "Appointment reminder",
+		Body:    "Hi {{patient_name}}, reminder of your appointment with {{dentist_name}} on {{appointment_time}}. Confirm, cancel or reschedule: {{link}}",
+	})
+}
+
+// GetSettings returns the reminder settings of a clinic, disabled when it
+// has none
+func GetSettings(ctx context.Context, clinicID string) (models.ReminderSettings, error) {
+	getCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+	result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+		TableName: aws.String(SettingsTable),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	if err != nil {
+		return models.ReminderSettings{}, err
+	}
+	settings := models.ReminderSettings{ClinicID: clinicID, Channel: models.ReminderChannelSMS, HoursBefore: 24}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+			return models.ReminderSettings{}, err
+		}
+	}
+	return settings, nil
+}
+
+// SaveSettings stores the reminder settings of a clinic
+func SaveSettings(ctx context.Context, settings models.ReminderSettings) (models.ReminderSettings, error) {
+	if err := settings.IsValid(); err != nil {
+		return models.ReminderSettings{}, err
+	}
+	settings.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		return models.ReminderSettings{}, err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(SettingsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return models.ReminderSettings{}, err
+	}
+	return settings, nil
+}
+
+// Log reads a page of a clinic's reminder log, the latest first, optionally
+// only the reminders in status or of an appointment
+func Log(ctx context.Context, clinicID, status, appointmentID string, page paging.Page) ([]models.ReminderLogEntry, string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(LogTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	var filters []string
+	if status != "" {
+		filters = append(filters, "#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+	if appointmentID != "" {
+		filters = append(filters, "AppointmentID = :appointment")
+		input.ExpressionAttributeValues[":appointment"] = &types.AttributeValueMemberS{Value: appointmentID}
+	}
+	switch len(filters) {
+	case 1:
+		input.FilterExpression = aws.String(filters[0])
+	case 2:
+		input.FilterExpression = aws.String(filters[0] + " AND " + filters[1])
+	}
+	return paging.Query[models.ReminderLogEntry](ctx, input, page)
+}
+
+// Send sends the reminders due at every clinic that enabled them and returns
+// how many were sent. The settings are read per clinic, as they are kept in
+// the region of each clinic.
+func Send(ctx context.Context) (int, error) {
+	sent := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		settings, err := GetSettings(ctx, config.ClinicID(ctx))
+		if err != nil {
+			return fmt.Errorf("reading reminder settings: %v", err)
+		}
+		if !settings.Enabled {
+			return nil
+		}
+		n, err := sendClinic(ctx, settings)
+		sent += n
+		if err != nil {
+			log.Printf("Error sending reminders of clinic %s: %v", settings.ClinicID, err)
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// sendClinic reminds the patients of a clinic's appointments starting within
+// the hours of its settings that were not reminded yet
+func sendClinic(ctx context.Context, settings models.ReminderSettings) (int, error) {
+	now := time.Now().UTC()
+	until := now.Add(time.Duration(settings.HoursBefore) * time.Hour)
+	appointments, err := paging.ScanAll[models.Appointment](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Appointments"),
+		FilterExpression: aws.String("#dt >= :from AND #dt < :to AND attribute_not_exists(TextReminderSentAt)"),
+		ExpressionAttributeNames: map[string]string{
+			"#dt": "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: now.Format("2006-01-02")},
+			":to":   &types.AttributeValueMemberS{Value: until.AddDate(0, 0, 1).Format("2006-01-02")},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scanning upcoming appointments: %v", err)
+	}
+
+	sent := 0
+	for _, appointment := range appointments {
+		if appointment.Status != models.AppointmentStatusScheduled && appointment.Status != models.AppointmentStatusConfirmed {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil || start.Before(now) || !start.Before(until) {
+			continue
+		}
+		ok, err := remind(ctx, settings, appointment, start)
+		if err != nil {
+			log.Printf("Error sending %s reminder of appointment %s: %v", settings.Channel, appointment.ID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// remind marks the appointment as reminded, texts the patient and logs the
+// result. The mark comes first so concurrent instances do not remind twice;
+// patients without a phone number are marked and logged as skipped.
+func remind(ctx context.Context, settings models.ReminderSettings, appointment models.Appointment, start time.Time) (bool, error) {
+	patient, err := getPatient(ctx, appointment.PatientID)
+	if err != nil {
+		return false, err
+	}
+	if patient == nil {
+		return false, nil
+	}
+
+	marked, err := mark(ctx, appointment)
+	if err != nil || !marked {
+		return false, err
+	}
+	entry := models.ReminderLogEntry{
+		ClinicID:        settings.ClinicID,
+		AppointmentID:   appointment.ID,
+		PatientID:       appointment.PatientID,
+		AppointmentTime: start.Format("2006-01-02 15:04"),
+		Channel:         settings.Channel,
+		To:              patient.Phone,
+		Status:          models.ReminderSent,
+	}
+	if patient.Phone == "" {
+		entry.Status = models.ReminderSkipped
+		entry.Error = "patient has no phone number"
+		return false, record(ctx, entry)
+	}
+
+	if err := text(ctx, settings, appointment, *patient, start); err != nil {
+		entry.Status = models.ReminderFailed
+		entry.Error = err.Error()
+		if logErr := record(ctx, entry); logErr != nil {
+			log.Printf("Error logging reminder of appointment %s: %v", appointment.ID, logErr)
+		}
+		return false, err
+	}
+	return true, record(ctx, entry)
+}
+
+// text composes the reminder on the clinic's channel and sends it
+func text(ctx context.Context, settings models.ReminderSettings, appointment models.Appointment, patient models.Patient, start time.Time) error {
+	if appointment.ClinicID == "" {
+		appointment.ClinicID = settings.ClinicID
+	}
+	token, err := selfservice.Token(appointment)
+	if err != nil {
+		return err
+	}
+	dentistName, err := getDentistName(ctx, appointment.DentistID)
+	if err != nil {
+		return err
+	}
+	link := selfservice.Link(token)
+	msg, err := notify.ComposeFor(ctx, settings.ClinicID, Kind, settings.Channel, patient.Phone, map[string]string{
+		"patient_name":     patient.Name,
+		"dentist_name":     dentistName,
+		"appointment_time": start.Format("2006-01-02 15:04"),
+		"link":             link,
+	})
+	if err != nil {
+		return err
+	}
+	msg.Link = link
+	return notify.Send(ctx, msg)
+}
+
+// mark sets TextReminderSentAt on the appointment, unless it was moved or
+// reminded meanwhile
+func mark(ctx context.Context, appointment models.Appointment) (bool, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("Appointments"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: appointment.ID},
+		},
+		UpdateExpression:         aws.String("SET TextReminderSentAt = :now"),
+		ConditionExpression:      aws.String("#dt = :dt AND attribute_not_exists(TextReminderSentAt)"),
+		ExpressionAttributeNames: map[string]string{"#dt": "DateTime"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":dt":  &types.AttributeValueMemberS{Value: appointment.DateTime},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// record adds an entry to the clinic's reminder log
+func record(ctx context.Context, entry models.ReminderLogEntry) error {
+	now := time.Now()
+	entry.ID = config.ChangeSeq(now) + "-" + uuid.NewString()[:8]
+	entry.CreatedAt = now.UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(LogTable),
+		Item:      item,
+	})
+	return err
+}
+
+// StartScheduler sends the due SMS and WhatsApp reminders once at startup
+// and then every interval
+func StartScheduler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	send := func() {
+		n, err := Send(ctx)
+		if err != nil {
+			log.Printf("Error sending SMS and WhatsApp reminders: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Sent %d SMS and WhatsApp reminders", n)
+		}
+	}
+
+	go func() {
+		send()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+}
+
+func getPatient(ctx context.Context, id string) (*models.Patient, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching patient %s: %v", id, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var patient models.Patient
+	if err := attributevalue.UnmarshalMap(result.Item, &patient); err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+func getDentistName(ctx context.Context, id string) (string, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Dentists"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ProjectionExpression:     aws.String("#name"),
+		ExpressionAttributeNames: map[string]string{"#name": "Name"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("fetching dentist %s: %v", id, err)
+	}
+	var dentist models.Dentist
+	if err := attributevalue.UnmarshalMap(result.Item, &dentist); err != nil {
+		return "", err
+	}
+	return dentist.Name, nil
+}
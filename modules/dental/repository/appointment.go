@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AppointmentRepository stores appointments
+type AppointmentRepository interface {
+	Get(ctx context.Context, id string) (models.Appointment, error)
+	// List returns a page of appointments starting at the page's cursor and
+	// the cursor of the next page, empty on the last one
+	List(ctx context.Context, page paging.Page) ([]models.Appointment, string, error)
+	FindByPatient(ctx context.Context, patientID string) ([]models.Appointment, error)
+	FindByDentist(ctx context.Context, dentistID string) ([]models.Appointment, error)
+	Create(ctx context.Context, appointment models.Appointment) error
+	Update(ctx context.Context, appointment models.Appointment) error
+	// Delete soft deletes an appointment, which is hidden from reads until
+	// restored, and returns it as deleted
+	Delete(ctx context.Context, id string) (models.Appointment, error)
+	Restore(ctx context.Context, id string) (models.Appointment, error)
+}
+
+// DynamoAppointments stores appointments in the Appointments table
+type DynamoAppointments struct{}
+
+const appointmentsTable = "Appointments"
+
+// Get reads an appointment by ID
+func (DynamoAppointments) Get(ctx context.Context, id string) (models.Appointment, error) {
+	var appointment models.Appointment
+	err := records.Get(ctx, appointmentsTable, id, &appointment)
+	return appointment, err
+}
+
+// List reads a page of appointments
+func (DynamoAppointments) List(ctx context.Context, page paging.Page) ([]models.Appointment, string, error) {
+	return paging.Scan[models.Appointment](ctx, &dynamodb.ScanInput{
+		TableName: aws.String(appointmentsTable),
+	}, page)
+}
+
+// FindByPatient returns the appointments of a patient
+func (DynamoAppointments) FindByPatient(ctx context.Context, patientID string) ([]models.Appointment, error) {
+	return records.Query[models.Appointment](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(appointmentsTable),
+		IndexName:              aws.String(config.AppointmentsByPatientIndex),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	})
+}
+
+// FindByDentist returns the appointments of a dentist
+func (DynamoAppointments) FindByDentist(ctx context.Context, dentistID string) ([]models.Appointment, error) {
+	return records.Query[models.Appointment](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(appointmentsTable),
+		IndexName:              aws.String(config.AppointmentsByDentistIndex),
+		KeyConditionExpression: aws.String("DentistID = :dentistId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dentistId": &types.AttributeValueMemberS{Value: dentistID},
+		},
+	})
+}
+
+// Create writes a new appointment
+func (DynamoAppointments) Create(ctx context.Context, appointment models.Appointment) error {
+	return records.Put(ctx, appointmentsTable, AppointmentItem(appointment), true)
+}
+
+// Update replaces an existing appointment
+func (DynamoAppointments) Update(ctx context.Context, appointment models.Appointment) error {
+	return records.Put(ctx, appointmentsTable, AppointmentItem(appointment), false)
+}
+
+// Delete soft deletes an appointment
+func (DynamoAppointments) Delete(ctx context.Context, id string) (models.Appointment, error) {
+	var appointment models.Appointment
+	err := records.Delete(ctx, appointmentsTable, id, &appointment)
+	return appointment, err
+}
+
+// Restore brings back a soft-deleted appointment
+func (DynamoAppointments) Restore(ctx context.Context, id string) (models.Appointment, error) {
+	var appointment models.Appointment
+	err := records.Restore(ctx, appointmentsTable, id, &appointment)
+	return appointment, err
+}
+
+// AppointmentItem builds the DynamoDB item of an appointment, omitting empty
+// optional fields, for the handlers writing appointments in transactions and
+// imports
+func AppointmentItem(appointment models.Appointment) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"ID":        &types.AttributeValueMemberS{Value: appointment.ID},
+		"PatientID": &types.AttributeValueMemberS{Value: appointment.PatientID},
+		"DentistID": &types.AttributeValueMemberS{Value: appointment.DentistID},
+		"DateTime":  &types.AttributeValueMemberS{Value: appointment.DateTime},
+		"Status":    &types.AttributeValueMemberS{Value: appointment.Status},
+		"CreatedAt": &types.AttributeValueMemberS{Value: appointment.CreatedAt},
+		"UpdatedAt": &types.AttributeValueMemberS{Value: appointment.UpdatedAt},
+		"Version":   &types.AttributeValueMemberN{Value: strconv.FormatInt(appointment.Version, 10)},
+	}
+
+	if appointment.ProcedureID != "" {
+		item["ProcedureID"] = &types.AttributeValueMemberS{Value: appointment.ProcedureID}
+	}
+	if appointment.Notes != "" {
+		item["Notes"] = &types.AttributeValueMemberS{Value: appointment.Notes}
+	}
+	if appointment.Duration != "" {
+		item["Duration"] = &types.AttributeValueMemberS{Value: appointment.Duration}
+	}
+	if appointment.BundleID != "" {
+		item["BundleID"] = &types.AttributeValueMemberS{Value: appointment.BundleID}
+	}
+	if appointment.SeriesID != "" {
+		item["SeriesID"] = &types.AttributeValueMemberS{Value: appointment.SeriesID}
+	}
+	if appointment.Price != "" {
+		item["Price"] = &types.AttributeValueMemberS{Value: appointment.Price}
+	}
+	if appointment.TreatmentPlanID != "" {
+		item["TreatmentPlanID"] = &types.AttributeValueMemberS{Value: appointment.TreatmentPlanID}
+	}
+	if appointment.ReminderSentAt != "" {
+		item["ReminderSentAt"] = &types.AttributeValueMemberS{Value: appointment.ReminderSentAt}
+	}
+	if appointment.TextReminderSentAt != "" {
+		item["TextReminderSentAt"] = &types.AttributeValueMemberS{Value: appointment.TextReminderSentAt}
+	}
+	if appointment.NearbyAt != "" {
+		item["NearbyAt"] = &types.AttributeValueMemberS{Value: appointment.NearbyAt}
+	}
+	if appointment.ArrivedAt != "" {
+		item["ArrivedAt"] = &types.AttributeValueMemberS{Value: appointment.ArrivedAt}
+	}
+	if appointment.ArrivalSource != "" {
+		item["ArrivalSource"] = &types.AttributeValueMemberS{Value: appointment.ArrivalSource}
+	}
+	if appointment.StartedAt != "" {
+		item["StartedAt"] = &types.AttributeValueMemberS{Value: appointment.StartedAt}
+	}
+	if appointment.FinishedAt != "" {
+		item["FinishedAt"] = &types.AttributeValueMemberS{Value: appointment.FinishedAt}
+	}
+	if appointment.Label != "" {
+		item["Label"] = &types.AttributeValueMemberS{Value: appointment.Label}
+	}
+	if appointment.Color != "" {
+		item["Color"] = &types.AttributeValueMemberS{Value: appointment.Color}
+	}
+	AddCampaignAttributes(item, appointment.CampaignAttribution)
+	AddExternalIDs(item, appointment.ExternalIDs)
+	return item
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/records"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrNoteSigned is returned when changing a clinical note that was signed
+var ErrNoteSigned = errors.New("clinical note is signed")
+
+// ClinicalNoteRepository stores the clinical notes of the patients, keyed by
+// patient and note ID. Notes are never deleted, and a signed note is not
+// changed anymore.
+type ClinicalNoteRepository interface {
+	Get(ctx context.Context, patientID, id string) (models.ClinicalNote, error)
+	// ListByPatient returns the notes of a patient in the order they were
+	// written, newest first when desc
+	ListByPatient(ctx context.Context, patientID string, desc bool) ([]models.ClinicalNote, error)
+	Create(ctx context.Context, note models.ClinicalNote) error
+	// Update replaces a note not signed yet, failing with ErrNoteSigned
+	// otherwise
+	Update(ctx context.Context, note models.ClinicalNote) error
+	// Sign marks a note as signed by signedBy, failing with ErrNoteSigned
+	// when it already was
+	Sign(ctx context.Context, patientID, id, signedAt, signedBy string) error
+}
+
+// DynamoClinicalNotes stores clinical notes in the ClinicalNotes table
+type DynamoClinicalNotes struct{}
+
+const clinicalNotesTable = "ClinicalNotes"
+
+// unsignedNote is the condition of the writes that change a clinical note
+const unsignedNote = "attribute_exists(PatientID) AND attribute_not_exists(SignedAt)"
+
+// Get reads a clinical note of a patient
+func (DynamoClinicalNotes) Get(ctx context.Context, patientID, id string) (models.ClinicalNote, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	var note models.ClinicalNote
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(clinicalNotesTable),
+		Key:            clinicalNoteKey(patientID, id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return note, err
+	}
+	if result.Item == nil {
+		return note, ErrNotFound
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &note)
+	return note, err
+}
+
+// ListByPatient returns the clinical notes of a patient
+func (DynamoClinicalNotes) ListByPatient(ctx context.Context, patientID string, desc bool) ([]models.ClinicalNote, error) {
+	return records.Query[models.ClinicalNote](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(clinicalNotesTable),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ScanIndexForward: aws.Bool(!desc),
+	})
+}
+
+// Create writes a new clinical note
+func (DynamoClinicalNotes) Create(ctx context.Context, note models.ClinicalNote) error {
+	err := putClinicalNote(ctx, note, "attribute_not_exists(PatientID)")
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// Update replaces a clinical note not signed yet
+func (DynamoClinicalNotes) Update(ctx context.Context, note models.ClinicalNote) error {
+	err := putClinicalNote(ctx, note, unsignedNote)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrNoteSigned
+	}
+	return err
+}
+
+// Sign sets the signature of a clinical note not signed yet
+func (DynamoClinicalNotes) Sign(ctx context.Context, patientID, id, signedAt, signedBy string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(clinicalNotesTable),
+		Key:                 clinicalNoteKey(patientID, id),
+		UpdateExpression:    aws.String("SET SignedAt = :signedAt, SignedBy = :signedBy"),
+		ConditionExpression: aws.String(unsignedNote),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":signedAt": &types.AttributeValueMemberS{Value: signedAt},
+			":signedBy": &types.AttributeValueMemberS{Value: signedBy},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrNoteSigned
+	}
+	return err
+}
+
+func clinicalNoteKey(patientID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PatientID": &types.AttributeValueMemberS{Value: patientID},
+		"ID":        &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+func putClinicalNote(ctx context.Context, note models.ClinicalNote, condition string) error {
+	item, err := attributevalue.MarshalMap(note)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(clinicalNotesTable),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+	})
+	return err
+}
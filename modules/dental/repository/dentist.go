@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DentistRepository stores dentists
+type DentistRepository interface {
+	Get(ctx context.Context, id string) (models.Dentist, error)
+	// List returns a page of dentists starting at the page's cursor and the
+	// cursor of the next page, empty on the last one
+	List(ctx context.Context, page paging.Page) ([]models.Dentist, string, error)
+	FindByName(ctx context.Context, name string) ([]models.Dentist, error)
+	FindByCRO(ctx context.Context, cro string) (models.Dentist, error)
+	Create(ctx context.Context, dentist models.Dentist) error
+	Update(ctx context.Context, dentist models.Dentist) error
+	// Delete soft deletes a dentist, who is hidden from reads until restored
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (models.Dentist, error)
+}
+
+// DynamoDentists stores dentists in the Dentists table
+type DynamoDentists struct{}
+
+const dentistsTable = "Dentists"
+
+// Get reads a dentist by ID
+func (DynamoDentists) Get(ctx context.Context, id string) (models.Dentist, error) {
+	var dentist models.Dentist
+	err := records.Get(ctx, dentistsTable, id, &dentist)
+	return dentist, err
+}
+
+// List reads a page of dentists
+func (DynamoDentists) List(ctx context.Context, page paging.Page) ([]models.Dentist, string, error) {
+	return paging.Scan[models.Dentist](ctx, &dynamodb.ScanInput{
+		TableName: aws.String(dentistsTable),
+	}, page)
+}
+
+// FindByName returns the dentists whose name contains name
+func (DynamoDentists) FindByName(ctx context.Context, name string) ([]models.Dentist, error) {
+	return records.NameContains[models.Dentist](ctx, dentistsTable, name)
+}
+
+// FindByCRO returns the dentist registered under a CRO number
+func (DynamoDentists) FindByCRO(ctx context.Context, cro string) (models.Dentist, error) {
+	dentists, err := records.Query[models.Dentist](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(dentistsTable),
+		IndexName:              aws.String(config.DentistsByCROIndex),
+		KeyConditionExpression: aws.String("CRO = :cro"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cro": &types.AttributeValueMemberS{Value: cro},
+		},
+	})
+	if err != nil {
+		return models.Dentist{}, err
+	}
+	if len(dentists) == 0 {
+		return models.Dentist{}, ErrNotFound
+	}
+	return dentists[0], nil
+}
+
+// Create writes a new dentist
+func (DynamoDentists) Create(ctx context.Context, dentist models.Dentist) error {
+	return records.Put(ctx, dentistsTable, dentistItem(dentist), true)
+}
+
+// Update replaces an existing dentist
+func (DynamoDentists) Update(ctx context.Context, dentist models.Dentist) error {
+	return records.Put(ctx, dentistsTable, dentistItem(dentist), false)
+}
+
+// Delete soft deletes a dentist
+func (DynamoDentists) Delete(ctx context.Context, id string) error {
+	var deleted models.Dentist
+	return records.Delete(ctx, dentistsTable, id, &deleted)
+}
+
+// Restore brings back a soft-deleted dentist
+func (DynamoDentists) Restore(ctx context.Context, id string) (models.Dentist, error) {
+	var dentist models.Dentist
+	err := records.Restore(ctx, dentistsTable, id, &dentist)
+	return dentist, err
+}
+
+// dentistItem builds the DynamoDB item of a dentist
+func dentistItem(dentist models.Dentist) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"ID":        &types.AttributeValueMemberS{Value: dentist.ID},
+		"Name":      &types.AttributeValueMemberS{Value: dentist.Name},
+		"Email":     &types.AttributeValueMemberS{Value: dentist.Email},
+		"Phone":     &types.AttributeValueMemberS{Value: dentist.Phone},
+		"CRO":       &types.AttributeValueMemberS{Value: dentist.CRO},
+		"Country":   &types.AttributeValueMemberS{Value: dentist.Country},
+		"Specialty": &types.AttributeValueMemberS{Value: dentist.Specialty},
+		"CreatedAt": &types.AttributeValueMemberS{Value: dentist.CreatedAt.Format(time.RFC3339)},
+		"UpdatedAt": &types.AttributeValueMemberS{Value: dentist.UpdatedAt.Format(time.RFC3339)},
+		"Version":   &types.AttributeValueMemberN{Value: strconv.FormatInt(dentist.Version, 10)},
+	}
+	if len(dentist.ProcedureIDs) > 0 {
+		item["ProcedureIDs"] = &types.AttributeValueMemberSS{Value: dentist.ProcedureIDs}
+	}
+	if dentist.Username != "" {
+		item["Username"] = &types.AttributeValueMemberS{Value: dentist.Username}
+	}
+	AddExternalIDs(item, dentist.ExternalIDs)
+	return item
+}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strings"
+)
+
+// MemoryDentists stores dentists in memory, for tests of the services and
+// handlers that need no DynamoDB
+type MemoryDentists struct {
+	store *records.Memory[models.Dentist]
+}
+
+// NewMemoryDentists returns a MemoryDentists holding dentists
+func NewMemoryDentists(dentists ...models.Dentist) *MemoryDentists {
+	return &MemoryDentists{store: records.NewMemory(
+		func(d models.Dentist) string { return d.ID },
+		func(d *models.Dentist) *string { return &d.DeletedAt },
+		dentists,
+	)}
+}
+
+// Get reads a dentist by ID
+func (r *MemoryDentists) Get(_ context.Context, id string) (models.Dentist, error) {
+	return r.store.Get(id)
+}
+
+// List reads a page of dentists, sorted by ID
+func (r *MemoryDentists) List(_ context.Context, page paging.Page) ([]models.Dentist, string, error) {
+	return r.store.List(page, nil)
+}
+
+// FindByName returns the dentists whose name contains name
+func (r *MemoryDentists) FindByName(_ context.Context, name string) ([]models.Dentist, error) {
+	return r.store.Find(func(d models.Dentist) bool { return strings.Contains(d.Name, name) }), nil
+}
+
+// FindByCRO returns the dentist registered under a CRO number
+func (r *MemoryDentists) FindByCRO(_ context.Context, cro string) (models.Dentist, error) {
+	dentists := r.store.Find(func(d models.Dentist) bool { return d.CRO == cro })
+	if len(dentists) == 0 {
+		return models.Dentist{}, ErrNotFound
+	}
+	return dentists[0], nil
+}
+
+// Create stores a new dentist
+func (r *MemoryDentists) Create(_ context.Context, dentist models.Dentist) error {
+	return r.store.Put(dentist, true)
+}
+
+// Update replaces an existing dentist
+func (r *MemoryDentists) Update(_ context.Context, dentist models.Dentist) error {
+	return r.store.Put(dentist, false)
+}
+
+// Delete soft deletes a dentist
+func (r *MemoryDentists) Delete(_ context.Context, id string) error {
+	_, err := r.store.Delete(id)
+	return err
+}
+
+// Restore brings back a soft-deleted dentist
+func (r *MemoryDentists) Restore(_ context.Context, id string) (models.Dentist, error) {
+	return r.store.Restore(id)
+}
+
+// MemoryPatients stores patients in memory, like MemoryDentists
+type MemoryPatients struct {
+	store *records.Memory[models.Patient]
+}
+
+// NewMemoryPatients returns a MemoryPatients holding patients
+func NewMemoryPatients(patients ...models.Patient) *MemoryPatients {
+	return &MemoryPatients{store: records.NewMemory(
+		func(p models.Patient) string { return p.ID },
+		func(p *models.Patient) *string { return &p.DeletedAt },
+		patients,
+	)}
+}
+
+// Get reads a patient by ID
+func (r *MemoryPatients) Get(_ context.Context, id string) (models.Patient, error) {
+	return r.store.Get(id)
+}
+
+// List reads a page of patients, sorted by ID
+func (r *MemoryPatients) List(_ context.Context, page paging.Page) ([]models.Patient, string, error) {
+	return r.store.List(page, nil)
+}
+
+// FindByName returns the patients whose name contains name
+func (r *MemoryPatients) FindByName(_ context.Context, name string) ([]models.Patient, error) {
+	return r.store.Find(func(p models.Patient) bool { return strings.Contains(p.Name, name) }), nil
+}
+
+// FindByEmail returns the patients registered with an email
+func (r *MemoryPatients) FindByEmail(_ context.Context, email string) ([]models.Patient, error) {
+	return r.store.Find(func(p models.Patient) bool { return p.Email == email }), nil
+}
+
+// Create stores a new patient
+func (r *MemoryPatients) Create(_ context.Context, patient models.Patient) error {
+	return r.store.Put(patient, true)
+}
+
+// Update replaces an existing patient
+func (r *MemoryPatients) Update(_ context.Context, patient models.Patient) error {
+	return r.store.Put(patient, false)
+}
+
+// Delete soft deletes a patient
+func (r *MemoryPatients) Delete(_ context.Context, id string) error {
+	_, err := r.store.Delete(id)
+	return err
+}
+
+// Restore brings back a soft-deleted patient
+func (r *MemoryPatients) Restore(_ context.Context, id string) (models.Patient, error) {
+	return r.store.Restore(id)
+}
+
+// MemoryProcedures stores procedures in memory, like MemoryDentists
+type MemoryProcedures struct {
+	store *records.Memory[models.Procedure]
+}
+
+// NewMemoryProcedures returns a MemoryProcedures holding procedures
+func NewMemoryProcedures(procedures ...models.Procedure) *MemoryProcedures {
+	return &MemoryProcedures{store: records.NewMemory(
+		func(p models.Procedure) string { return p.ID },
+		func(p *models.Procedure) *string { return &p.DeletedAt },
+		procedures,
+	)}
+}
+
+// Get reads a procedure by ID
+func (r *MemoryProcedures) Get(_ context.Context, id string) (models.Procedure, error) {
+	return r.store.Get(id)
+}
+
+// List reads a page of procedures, sorted by ID
+func (r *MemoryProcedures) List(_ context.Context, page paging.Page) ([]models.Procedure, string, error) {
+	return r.store.List(page, nil)
+}
+
+// FindByName returns the procedures whose name contains name
+func (r *MemoryProcedures) FindByName(_ context.Context, name string) ([]models.Procedure, error) {
+	return r.store.Find(func(p models.Procedure) bool { return strings.Contains(p.Name, name) }), nil
+}
+
+// Create stores a new procedure
+func (r *MemoryProcedures) Create(_ context.Context, procedure models.Procedure) error {
+	return r.store.Put(procedure, true)
+}
+
+// Update replaces an existing procedure
+func (r *MemoryProcedures) Update(_ context.Context, procedure models.Procedure) error {
+	return r.store.Put(procedure, false)
+}
+
+// Delete soft deletes a procedure
+func (r *MemoryProcedures) Delete(_ context.Context, id string) error {
+	_, err := r.store.Delete(id)
+	return err
+}
+
+// Restore brings back a soft-deleted procedure
+func (r *MemoryProcedures) Restore(_ context.Context, id string) (models.Procedure, error) {
+	return r.store.Restore(id)
+}
+
+// MemoryAppointments stores appointments in memory, like MemoryDentists
+type MemoryAppointments struct {
+	store *records.Memory[models.Appointment]
+}
+
+// NewMemoryAppointments returns a MemoryAppointments holding appointments
+func NewMemoryAppointments(appointments ...models.Appointment) *MemoryAppointments {
+	return &MemoryAppointments{store: records.NewMemory(
+		func(a models.Appointment) string { return a.ID },
+		func(a *models.Appointment) *string { return &a.DeletedAt },
+		appointments,
+	)}
+}
+
+// Get reads an appointment by ID
+func (r *MemoryAppointments) Get(_ context.Context, id string) (models.Appointment, error) {
+	return r.store.Get(id)
+}
+
+// List reads a page of appointments, sorted by ID
+func (r *MemoryAppointments) List(_ context.Context, page paging.Page) ([]models.Appointment, string, error) {
+	return r.store.List(page, nil)
+}
+
+// FindByPatient returns the appointments of a patient
+func (r *MemoryAppointments) FindByPatient(_ context.Context, patientID string) ([]models.Appointment, error) {
+	return r.store.Find(func(a models.Appointment) bool { return a.PatientID == patientID }), nil
+}
+
+// FindByDentist returns the appointments of a dentist
+func (r *MemoryAppointments) FindByDentist(_ context.Context, dentistID string) ([]models.Appointment, error) {
+	return r.store.Find(func(a models.Appointment) bool { return a.DentistID == dentistID }), nil
+}
+
+// Create stores a new appointment
+func (r *MemoryAppointments) Create(_ context.Context, appointment models.Appointment) error {
+	return r.store.Put(appointment, true)
+}
+
+// Update replaces an existing appointment
+func (r *MemoryAppointments) Update(_ context.Context, appointment models.Appointment) error {
+	return r.store.Put(appointment, false)
+}
+
+// Delete soft deletes an appointment
+func (r *MemoryAppointments) Delete(_ context.Context, id string) (models.Appointment, error) {
+	return r.store.Delete(id)
+}
+
+// Restore brings back a soft-deleted appointment
+func (r *MemoryAppointments) Restore(_ context.Context, id string) (models.Appointment, error) {
+	return r.store.Restore(id)
+}
+
+// MemoryClinicalNotes stores clinical notes in memory, like MemoryDentists
+type MemoryClinicalNotes struct {
+	store *records.Memory[models.ClinicalNote]
+}
+
+// NewMemoryClinicalNotes returns a MemoryClinicalNotes holding notes
+func NewMemoryClinicalNotes(notes ...models.ClinicalNote) *MemoryClinicalNotes {
+	return &MemoryClinicalNotes{store: records.NewMemory(
+		func(n models.ClinicalNote) string { return n.PatientID + "/" + n.ID },
+		nil,
+		notes,
+	)}
+}
+
+// Get reads a clinical note of a patient
+func (r *MemoryClinicalNotes) Get(_ context.Context, patientID, id string) (models.ClinicalNote, error) {
+	return r.store.Get(patientID + "/" + id)
+}
+
+// ListByPatient returns the clinical notes of a patient, sorted by ID
+func (r *MemoryClinicalNotes) ListByPatient(_ context.Context, patientID string, desc bool) ([]models.ClinicalNote, error) {
+	notes := r.store.Find(func(n models.ClinicalNote) bool { return n.PatientID == patientID })
+	if desc {
+		for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+			notes[i], notes[j] = notes[j], notes[i]
+		}
+	}
+	return notes, nil
+}
+
+// Create stores a new clinical note
+func (r *MemoryClinicalNotes) Create(_ context.Context, note models.ClinicalNote) error {
+	return r.store.Put(note, true)
+}
+
+// Update replaces a clinical note not signed yet
+func (r *MemoryClinicalNotes) Update(_ context.Context, note models.ClinicalNote) error {
+	stored, err := r.store.Get(note.PatientID + "/" + note.ID)
+	if err != nil || stored.Signed() {
+		return ErrNoteSigned
+	}
+	return r.store.Put(note, false)
+}
+
+// Sign sets the signature of a clinical note not signed yet
+func (r *MemoryClinicalNotes) Sign(_ context.Context, patientID, id, signedAt, signedBy string) error {
+	note, err := r.store.Get(patientID + "/" + id)
+	if err != nil || note.Signed() {
+		return ErrNoteSigned
+	}
+	note.SignedAt, note.SignedBy = signedAt, signedBy
+	return r.store.Put(note, false)
+}
+
+var (
+	_ DentistRepository      = (*MemoryDentists)(nil)
+	_ PatientRepository      = (*MemoryPatients)(nil)
+	_ ProcedureRepository    = (*MemoryProcedures)(nil)
+	_ AppointmentRepository  = (*MemoryAppointments)(nil)
+	_ ClinicalNoteRepository = (*MemoryClinicalNotes)(nil)
+)
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// PatientRepository stores patients
+type PatientRepository interface {
+	Get(ctx context.Context, id string) (models.Patient, error)
+	// List returns a page of patients starting at the page's cursor and the
+	// cursor of the next page, empty on the last one
+	List(ctx context.Context, page paging.Page) ([]models.Patient, string, error)
+	FindByName(ctx context.Context, name string) ([]models.Patient, error)
+	FindByEmail(ctx context.Context, email string) ([]models.Patient, error)
+	Create(ctx context.Context, patient models.Patient) error
+	Update(ctx context.Context, patient models.Patient) error
+	// Delete soft deletes a patient, who is hidden from reads until restored
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (models.Patient, error)
+}
+
+// DynamoPatients stores patients in the Patients table
+type DynamoPatients struct{}
+
+const patientsTable = "Patients"
+
+// Get reads a patient by ID
+func (DynamoPatients) Get(ctx context.Context, id string) (models.Patient, error) {
+	var patient models.Patient
+	err := records.Get(ctx, patientsTable, id, &patient)
+	return patient, err
+}
+
+// List reads a page of patients
+func (DynamoPatients) List(ctx context.Context, page paging.Page) ([]models.Patient, string, error) {
+	return paging.Scan[models.Patient](ctx, &dynamodb.ScanInput{
+		TableName: aws.String(patientsTable),
+	}, page)
+}
+
+// FindByName returns the patients whose name contains name
+func (DynamoPatients) FindByName(ctx context.Context, name string) ([]models.Patient, error) {
+	return records.NameContains[models.Patient](ctx, patientsTable, name)
+}
+
+// FindByEmail returns the patients registered with an email
+func (DynamoPatients) FindByEmail(ctx context.Context, email string) ([]models.Patient, error) {
+	return records.Query[models.Patient](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(patientsTable),
+		IndexName:              aws.String(config.PatientsByEmailIndex),
+		KeyConditionExpression: aws.String("Email = :email"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":email": &types.AttributeValueMemberS{Value: email},
+		},
+	})
+}
+
+// Create writes a new patient
+func (DynamoPatients) Create(ctx context.Context, patient models.Patient) error {
+	return records.Put(ctx, patientsTable, patientItem(patient), true)
+}
+
+// Update replaces an existing patient
+func (DynamoPatients) Update(ctx context.Context, patient models.Patient) error {
+	return records.Put(ctx, patientsTable, patientItem(patient), false)
+}
+
+// Delete soft deletes a patient
+func (DynamoPatients) Delete(ctx context.Context, id string) error {
+	var deleted models.Patient
+	return records.Delete(ctx, patientsTable, id, &deleted)
+}
+
+// Restore brings back a soft-deleted patient
+func (DynamoPatients) Restore(ctx context.Context, id string) (models.Patient, error) {
+	var patient models.Patient
+	err := records.Restore(ctx, patientsTable, id, &patient)
+	return patient, err
+}
+
+// patientItem builds the DynamoDB item of a patient
+func patientItem(patient models.Patient) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"ID":           &types.AttributeValueMemberS{Value: patient.ID},
+		"Name":         &types.AttributeValueMemberS{Value: patient.Name},
+		"Email":        &types.AttributeValueMemberS{Value: patient.Email},
+		"Phone":        &types.AttributeValueMemberS{Value: patient.Phone},
+		"DateOfBirth":  &types.AttributeValueMemberS{Value: patient.DateOfBirth},
+		"MedicalNotes": &types.AttributeValueMemberS{Value: patient.MedicalNotes},
+		"CreatedAt":    &types.AttributeValueMemberS{Value: patient.CreatedAt},
+		"UpdatedAt":    &types.AttributeValueMemberS{Value: patient.UpdatedAt},
+		"Version":      &types.AttributeValueMemberN{Value: strconv.FormatInt(patient.Version, 10)},
+	}
+	if len(patient.Medications) > 0 {
+		medications := make([]types.AttributeValue, len(patient.Medications))
+		for i, medication := range patient.Medications {
+			medications[i] = &types.AttributeValueMemberS{Value: medication}
+		}
+		item["Medications"] = &types.AttributeValueMemberL{Value: medications}
+	}
+	AddCampaignAttributes(item, patient.CampaignAttribution)
+	AddExternalIDs(item, patient.ExternalIDs)
+	return item
+}
+
+// AddExternalIDs sets the IDs a record had in the systems it was imported
+// from on an item, when there are any
+func AddExternalIDs(item map[string]types.AttributeValue, ids models.ExternalIDs) {
+	if len(ids) == 0 {
+		return
+	}
+	m := make(map[string]types.AttributeValue, len(ids))
+	for source, id := range ids {
+		m[source] = &types.AttributeValueMemberS{Value: id}
+	}
+	item["ExternalIDs"] = &types.AttributeValueMemberM{Value: m}
+}
+
+// AddCampaignAttributes sets the UTM attributes of a campaign on an item,
+// leaving out empty ones
+func AddCampaignAttributes(item map[string]types.AttributeValue, campaign models.CampaignAttribution) {
+	if campaign.UTMSource != "" {
+		item["UTMSource"] = &types.AttributeValueMemberS{Value: campaign.UTMSource}
+	}
+	if campaign.UTMMedium != "" {
+		item["UTMMedium"] = &types.AttributeValueMemberS{Value: campaign.UTMMedium}
+	}
+	if campaign.UTMCampaign != "" {
+		item["UTMCampaign"] = &types.AttributeValueMemberS{Value: campaign.UTMCampaign}
+	}
+}
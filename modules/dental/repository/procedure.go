@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ProcedureRepository stores procedures
+type ProcedureRepository interface {
+	Get(ctx context.Context, id string) (models.Procedure, error)
+	// List returns a page of procedures starting at the page's cursor and
+	// the cursor of the next page, empty on the last one
+	List(ctx context.Context, page paging.Page) ([]models.Procedure, string, error)
+	FindByName(ctx context.Context, name string) ([]models.Procedure, error)
+	Create(ctx context.Context, procedure models.Procedure) error
+	Update(ctx context.Context, procedure models.Procedure) error
+	// Delete soft deletes a procedure, which is hidden from reads until restored
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (models.Procedure, error)
+}
+
+// DynamoProcedures stores procedures in the Procedures table
+type DynamoProcedures struct{}
+
+const proceduresTable = "Procedures"
+
+// Get reads a procedure by ID
+func (DynamoProcedures) Get(ctx context.Context, id string) (models.Procedure, error) {
+	var procedure models.Procedure
+	err := records.Get(ctx, proceduresTable, id, &procedure)
+	return procedure, err
+}
+
+// List reads a page of procedures
+func (DynamoProcedures) List(ctx context.Context, page paging.Page) ([]models.Procedure, string, error) {
+	return paging.Scan[models.Procedure](ctx, &dynamodb.ScanInput{
+		TableName: aws.String(proceduresTable),
+	}, page)
+}
+
+// FindByName returns the procedures whose name contains name
+func (DynamoProcedures) FindByName(ctx context.Context, name string) ([]models.Procedure, error) {
+	return records.NameContains[models.Procedure](ctx, proceduresTable, name)
+}
+
+// Create writes a new procedure
+func (DynamoProcedures) Create(ctx context.Context, procedure models.Procedure) error {
+	return records.Put(ctx, proceduresTable, ProcedureItem(procedure), true)
+}
+
+// Update replaces an existing procedure
+func (DynamoProcedures) Update(ctx context.Context, procedure models.Procedure) error {
+	return records.Put(ctx, proceduresTable, ProcedureItem(procedure), false)
+}
+
+// Delete soft deletes a procedure
+func (DynamoProcedures) Delete(ctx context.Context, id string) error {
+	var procedure models.Procedure
+	return records.Delete(ctx, proceduresTable, id, &procedure)
+}
+
+// Restore brings back a soft-deleted procedure
+func (DynamoProcedures) Restore(ctx context.Context, id string) (models.Procedure, error) {
+	var procedure models.Procedure
+	err := records.Restore(ctx, proceduresTable, id, &procedure)
+	return procedure, err
+}
+
+// ProcedureItem builds the DynamoDB item of a procedure, for the handlers
+// writing procedures in transactions and imports
+func ProcedureItem(procedure models.Procedure) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"ID":          &types.AttributeValueMemberS{Value: procedure.ID},
+		"Name":        &types.AttributeValueMemberS{Value: procedure.Name},
+		"Description": &types.AttributeValueMemberS{Value: procedure.Description},
+		"Price":       &types.AttributeValueMemberS{Value: procedure.Price},
+		"Duration":    &types.AttributeValueMemberS{Value: procedure.Duration},
+		"CreatedAt":   &types.AttributeValueMemberS{Value: procedure.CreatedAt},
+		"UpdatedAt":   &types.AttributeValueMemberS{Value: procedure.UpdatedAt},
+		"Version":     &types.AttributeValueMemberN{Value: strconv.FormatInt(procedure.Version, 10)},
+	}
+	if len(procedure.Translations) > 0 {
+		if translations, err := attributevalue.Marshal(procedure.Translations); err == nil {
+			item["Translations"] = translations
+		}
+	}
+	if procedure.NeedsPreAuth() {
+		item["RequiresPreAuth"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	if procedure.NeedsConsent() {
+		item["RequiresConsent"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	if len(procedure.Tags) > 0 {
+		item["Tags"] = &types.AttributeValueMemberSS{Value: procedure.Tags}
+	}
+	if procedure.Label != "" {
+		item["Label"] = &types.AttributeValueMemberS{Value: procedure.Label}
+	}
+	if procedure.Color != "" {
+		item["Color"] = &types.AttributeValueMemberS{Value: procedure.Color}
+	}
+	if len(procedure.RoomFeatures) > 0 {
+		item["RoomFeatures"] = &types.AttributeValueMemberSS{Value: procedure.RoomFeatures}
+	}
+	if procedure.BufferMinutes > 0 {
+		item["BufferMinutes"] = &types.AttributeValueMemberN{Value: strconv.Itoa(procedure.BufferMinutes)}
+	}
+	AddExternalIDs(item, procedure.ExternalIDs)
+	return item
+}
@@ -0,0 +1,14 @@
+// Package repository holds the storage of the dental entities behind
+// interfaces, so handlers and services do not depend on DynamoDB and can be
+// tested with the in-memory implementations or pointed at another backend.
+package repository
+
+import "dental-saas/shared/records"
+
+// Aliases of the records errors, so callers need not import both packages
+var (
+	// ErrNotFound is returned when the record does not exist
+	ErrNotFound = records.ErrNotFound
+	// ErrAlreadyExists is returned when creating a record whose ID is taken
+	ErrAlreadyExists = records.ErrAlreadyExists
+)
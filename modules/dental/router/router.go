@@ -2,6 +2,10 @@ package router
 
 import (
 	"dental-saas/modules/dental/handlers"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/budget"
+	"dental-saas/shared/schema"
 
 	"github.com/gorilla/mux"
 )
@@ -13,39 +17,265 @@ func NewDentalRouter() *mux.Router {
 	// Create a subrouter for dental module with /api/v1/dental prefix
 	dentalRouter := r.PathPrefix("/api/v1/dental").Subrouter()
 
-	// Dentist routes
-	dentalRouter.HandleFunc("/dentist", handlers.CreateDentist).Methods("POST")
-	dentalRouter.HandleFunc("/dentist", handlers.GetAllDentists).Methods("GET")
+	// Deletes and restores are for admins only; a dentist's prices, schedule
+	// and calendar sync are changed by admins or by the dentist
+
+	// Dentist routes; only admins manage the dentists themselves
+	dentalRouter.Handle("/dentist", auth.RequireFunc(handlers.CreateDentist, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.Handle("/dentist", budget.ListFunc(handlers.GetAllDentists)).Methods("GET")
+	dentalRouter.HandleFunc("/dentist/$schema", schema.Handler("Dentist", models.Dentist{}, "name", "email", "cro", "country")).Methods("GET")
+	dentalRouter.HandleFunc("/dentist/batch-get", handlers.BatchGetDentists).Methods("POST")
+	dentalRouter.Handle("/dentist/import", auth.RequireFunc(handlers.ImportDentists, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.HandleFunc("/dentist/external/{source}/{externalId}", handlers.GetDentistByExternalID).Methods("GET")
 	dentalRouter.HandleFunc("/dentist/name/{name}", handlers.GetDentistByName).Methods("GET")
 	dentalRouter.HandleFunc("/dentist/cro/{cro}", handlers.GetDentistByCRO).Methods("GET")
 	dentalRouter.HandleFunc("/dentist/{id}", handlers.GetDentistByID).Methods("GET")
-	dentalRouter.HandleFunc("/dentist/{id}", handlers.UpdateDentist).Methods("PUT")
-	dentalRouter.HandleFunc("/dentist/{id}", handlers.DeleteDentist).Methods("DELETE")
+	dentalRouter.Handle("/dentist/{id}", auth.RequireFunc(handlers.UpdateDentist, auth.RoleAdmin)).Methods("PUT")
+	dentalRouter.Handle("/dentist/{id}", auth.RequireFunc(handlers.PatchDentist, auth.RoleAdmin)).Methods("PATCH")
+	dentalRouter.Handle("/dentist/{id}", auth.RequireFunc(handlers.DeleteDentist, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.Handle("/dentist/{id}/restore", auth.RequireFunc(handlers.RestoreDentist, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.HandleFunc("/dentist/{id}/prices", handlers.GetDentistPrices).Methods("GET")
+	dentalRouter.Handle("/dentist/{id}/prices/{procedureId}", handlers.DentistOwner(handlers.SetDentistPrice)).Methods("PUT")
+	dentalRouter.Handle("/dentist/{id}/prices/{procedureId}", handlers.DentistOwner(handlers.DeleteDentistPrice)).Methods("DELETE")
+	dentalRouter.HandleFunc("/dentist/{id}/schedule", handlers.GetDentistSchedule).Methods("GET")
+	dentalRouter.Handle("/dentist/{id}/schedule", handlers.DentistOwner(handlers.SetDentistSchedule)).Methods("PUT")
+	dentalRouter.Handle("/dentist/{id}/schedule", handlers.DentistOwner(handlers.DeleteDentistSchedule)).Methods("DELETE")
+	dentalRouter.HandleFunc("/dentist/{id}/availability", handlers.GetDentistAvailability).Methods("GET")
+	dentalRouter.HandleFunc("/dentist/{id}/agenda", handlers.GetDentistAgenda).Methods("GET")
+	dentalRouter.HandleFunc("/dentist/{id}/identity", handlers.GetDentistIdentity).Methods("GET")
+	dentalRouter.Handle("/dentist/{id}/identity", auth.RequireFunc(handlers.UnlinkDentistIdentity, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.Handle("/dentist/{id}/identity/code", auth.RequireFunc(handlers.CreateDentistLinkCode, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.Handle("/dentist/{id}/identity/join", auth.RequireFunc(handlers.JoinDentistIdentity, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.HandleFunc("/dentist/{id}/calendar-sync", handlers.GetCalendarSync).Methods("GET")
+	dentalRouter.Handle("/dentist/{id}/calendar-sync", handlers.DentistOwner(handlers.SetCalendarSync)).Methods("PUT")
+	dentalRouter.Handle("/dentist/{id}/calendar-sync", handlers.DentistOwner(handlers.DeleteCalendarSync)).Methods("DELETE")
+	dentalRouter.Handle("/dentist/{id}/calendar-sync/run", handlers.DentistOwner(handlers.RunCalendarSync)).Methods("POST")
 
 	// Patient routes
 	dentalRouter.HandleFunc("/patient", handlers.CreatePatient).Methods("POST")
-	dentalRouter.HandleFunc("/patient", handlers.GetAllPatients).Methods("GET")
-	dentalRouter.HandleFunc("/patient/{id}", handlers.GetPatientByID).Methods("GET")
+	dentalRouter.Handle("/patient", budget.ListFunc(handlers.GetAllPatients)).Methods("GET")
+	dentalRouter.HandleFunc("/patient/$schema", schema.Handler("Patient", models.Patient{}, "name", "email")).Methods("GET")
+	dentalRouter.HandleFunc("/patient/batch-get", handlers.BatchGetPatients).Methods("POST")
+	dentalRouter.HandleFunc("/patient/import", handlers.ImportPatients).Methods("POST")
+	dentalRouter.HandleFunc("/patient/external/{source}/{externalId}", handlers.GetPatientByExternalID).Methods("GET")
 	dentalRouter.HandleFunc("/patient/name/{name}", handlers.GetPatientByName).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}", handlers.GetPatientByID).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/summary", handlers.GetPatientSummary).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/history", handlers.GetPatientHistory).Methods("GET")
 	dentalRouter.HandleFunc("/patient/{id}", handlers.UpdatePatient).Methods("PUT")
-	dentalRouter.HandleFunc("/patient/{id}", handlers.DeletePatient).Methods("DELETE")
+	dentalRouter.HandleFunc("/patient/{id}", handlers.PatchPatient).Methods("PATCH")
+	dentalRouter.Handle("/patient/{id}", auth.RequireFunc(handlers.DeletePatient, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.Handle("/patient/{id}/restore", auth.RequireFunc(handlers.RestorePatient, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.Handle("/patient/{id}/shares", auth.RequireFunc(handlers.SharePatient, auth.RoleDentist)).Methods("POST")
+	dentalRouter.HandleFunc("/patient/{id}/shares", handlers.GetPatientShares).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/shares/{clinicId}", auth.RequireFunc(handlers.RevokePatientShare, auth.RoleDentist)).Methods("DELETE")
+	dentalRouter.HandleFunc("/patient/{id}/odontogram", handlers.GetOdontogram).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/odontogram/teeth/{number}", auth.RequireFunc(handlers.UpdateTooth, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.HandleFunc("/patient/{id}/odontogram/snapshots", handlers.GetOdontogramSnapshots).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/odontogram/snapshots/{version}", handlers.GetOdontogramSnapshot).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/anamnesis", handlers.RecordAnamnesis).Methods("POST")
+	dentalRouter.HandleFunc("/patient/{id}/anamnesis", handlers.GetAnamnesis).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/anamnesis/versions", handlers.GetAnamnesisVersions).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/anamnesis/versions/{version}", handlers.GetAnamnesisVersion).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/notes", auth.RequireFunc(handlers.CreateClinicalNote, auth.RoleDentist)).Methods("POST")
+	dentalRouter.Handle("/patient/{id}/notes", auth.RequireFunc(handlers.GetClinicalNotes, auth.RoleDentist)).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/notes/{noteId}", auth.RequireFunc(handlers.GetClinicalNote, auth.RoleDentist)).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/notes/{noteId}", auth.RequireFunc(handlers.UpdateClinicalNote, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.Handle("/patient/{id}/notes/{noteId}/sign", auth.RequireFunc(handlers.SignClinicalNote, auth.RoleDentist)).Methods("POST")
+	dentalRouter.HandleFunc("/patient/{id}/attachments", handlers.UploadPatientAttachment).Methods("POST")
+	dentalRouter.HandleFunc("/patient/{id}/attachments", handlers.GetPatientAttachments).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/attachments/{attachmentId}", handlers.GetPatientAttachment).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/attachments/{attachmentId}/download", handlers.DownloadPatientAttachment).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/attachments/{attachmentId}", auth.RequireFunc(handlers.DeletePatientAttachment, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.HandleFunc("/patient/{id}/photos", handlers.UploadClinicalPhoto).Methods("POST")
+	dentalRouter.HandleFunc("/patient/{id}/photos", handlers.GetClinicalPhotoTimeline).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/photos/compare", handlers.CompareClinicalPhotos).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/photos/{photoId}", handlers.GetClinicalPhoto).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/photos/{photoId}/image", handlers.GetClinicalPhotoImage).Methods("GET")
+	dentalRouter.Handle("/patient/{id}/photos/{photoId}", auth.RequireFunc(handlers.DeleteClinicalPhoto, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.HandleFunc("/patient/{id}/consents", handlers.GetPatientConsents).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/consents/{procedureId}", handlers.GetPatientConsent).Methods("GET")
+	dentalRouter.HandleFunc("/patient/{id}/consents/{procedureId}", handlers.SetPatientConsent).Methods("PUT")
+	dentalRouter.Handle("/patient/{id}/consents/{procedureId}", auth.RequireFunc(handlers.DeletePatientConsent, auth.RoleAdmin)).Methods("DELETE")
+
+	// Patients of other clinics of the organization
+	dentalRouter.HandleFunc("/shared-patient", handlers.GetSharedPatients).Methods("GET")
+	dentalRouter.Handle("/shared-patient/{clinicId}/{id}", auth.RequireFunc(handlers.GetSharedPatient, auth.RoleDentist, auth.RoleReceptionist)).Methods("GET")
 
 	// Procedure routes
 	dentalRouter.HandleFunc("/procedure", handlers.CreateProcedure).Methods("POST")
-	dentalRouter.HandleFunc("/procedure", handlers.GetAllProcedures).Methods("GET")
-	dentalRouter.HandleFunc("/procedure/{id}", handlers.GetProcedureByID).Methods("GET")
+	dentalRouter.Handle("/procedure", budget.ListFunc(handlers.GetAllProcedures)).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/$schema", schema.Handler("Procedure", models.Procedure{}, "name", "price", "duration")).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/batch-get", handlers.BatchGetProcedures).Methods("POST")
+	dentalRouter.HandleFunc("/procedure/import", handlers.ImportProcedures).Methods("POST")
+	dentalRouter.HandleFunc("/procedure/external/{source}/{externalId}", handlers.GetProcedureByExternalID).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/catalog/templates", handlers.GetCatalogTemplates).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/catalog/apply", handlers.ApplyCatalogTemplate).Methods("POST")
+	dentalRouter.HandleFunc("/procedure/catalog/adjust", handlers.AdjustCatalogPrices).Methods("POST")
+	dentalRouter.HandleFunc("/procedure/catalog/adjustments", handlers.GetPriceAdjustments).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/durations", handlers.GetDurationSuggestions).Methods("GET")
+	dentalRouter.Handle("/procedure/durations/apply", auth.RequireFunc(handlers.ApplyDurationSuggestions, auth.RoleAdmin)).Methods("POST")
 	dentalRouter.HandleFunc("/procedure/name/{name}", handlers.GetProcedureByName).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/{id}", handlers.GetProcedureByID).Methods("GET")
 	dentalRouter.HandleFunc("/procedure/{id}", handlers.UpdateProcedure).Methods("PUT")
-	dentalRouter.HandleFunc("/procedure/{id}", handlers.DeleteProcedure).Methods("DELETE")
+	dentalRouter.HandleFunc("/procedure/{id}", handlers.PatchProcedure).Methods("PATCH")
+	dentalRouter.Handle("/procedure/{id}", auth.RequireFunc(handlers.DeleteProcedure, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.Handle("/procedure/{id}/restore", auth.RequireFunc(handlers.RestoreProcedure, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.HandleFunc("/procedure/{id}/price", handlers.GetEffectivePrice).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/{id}/prices", handlers.GetProcedurePriceHistory).Methods("GET")
+	dentalRouter.HandleFunc("/procedure/{id}/prices", handlers.ScheduleProcedurePrice).Methods("POST")
+
+	// Bundle routes
+	dentalRouter.HandleFunc("/bundle", handlers.CreateBundle).Methods("POST")
+	dentalRouter.Handle("/bundle", budget.ListFunc(handlers.GetAllBundles)).Methods("GET")
+	dentalRouter.HandleFunc("/bundle/$schema", schema.Handler("Bundle", models.Bundle{}, "name", "price", "items")).Methods("GET")
+	dentalRouter.HandleFunc("/bundle/{id}", handlers.GetBundleByID).Methods("GET")
+	dentalRouter.HandleFunc("/bundle/{id}", handlers.UpdateBundle).Methods("PUT")
+	dentalRouter.Handle("/bundle/{id}", auth.RequireFunc(handlers.DeleteBundle, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.HandleFunc("/bundle/{id}/book", handlers.BookBundle).Methods("POST")
+
+	// Medication catalog routes
+	dentalRouter.Handle("/medication", auth.RequireFunc(handlers.CreateMedication, auth.RoleDentist)).Methods("POST")
+	dentalRouter.HandleFunc("/medication", handlers.GetAllMedications).Methods("GET")
+	dentalRouter.Handle("/medication/interactions", auth.RequireFunc(handlers.CheckMedicationInteractions, auth.RoleDentist)).Methods("POST")
+	dentalRouter.HandleFunc("/medication/{id}", handlers.GetMedicationByID).Methods("GET")
+	dentalRouter.Handle("/medication/{id}", auth.RequireFunc(handlers.UpdateMedication, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.Handle("/medication/{id}", auth.RequireFunc(handlers.DeleteMedication, auth.RoleAdmin)).Methods("DELETE")
+
+	// Room routes
+	dentalRouter.Handle("/room", auth.RequireFunc(handlers.CreateRoom, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.HandleFunc("/room", handlers.GetAllRooms).Methods("GET")
+	dentalRouter.HandleFunc("/room/$schema", schema.Handler("Room", models.Room{}, "name")).Methods("GET")
+	dentalRouter.HandleFunc("/room/{id}", handlers.GetRoomByID).Methods("GET")
+	dentalRouter.Handle("/room/{id}", auth.RequireFunc(handlers.UpdateRoom, auth.RoleAdmin)).Methods("PUT")
+	dentalRouter.Handle("/room/{id}", auth.RequireFunc(handlers.DeleteRoom, auth.RoleAdmin)).Methods("DELETE")
+
+	// Waitlist routes
+	dentalRouter.HandleFunc("/waitlist", handlers.CreateWaitlistEntry).Methods("POST")
+	dentalRouter.HandleFunc("/waitlist", handlers.GetWaitlist).Methods("GET")
+	dentalRouter.HandleFunc("/waitlist/$schema", schema.Handler("WaitlistEntry", models.WaitlistEntry{}, "patient_id", "procedure_id")).Methods("GET")
+	dentalRouter.HandleFunc("/waitlist/{id}", handlers.GetWaitlistEntryByID).Methods("GET")
+	dentalRouter.HandleFunc("/waitlist/{id}", handlers.UpdateWaitlistEntry).Methods("PUT")
+	dentalRouter.Handle("/waitlist/{id}", auth.RequireFunc(handlers.DeleteWaitlistEntry, auth.RoleAdmin)).Methods("DELETE")
+
+	// Anamnesis template routes
+	dentalRouter.Handle("/anamnesis-template", auth.RequireFunc(handlers.CreateAnamnesisTemplate, auth.RoleDentist)).Methods("POST")
+	dentalRouter.HandleFunc("/anamnesis-template", handlers.GetAllAnamnesisTemplates).Methods("GET")
+	dentalRouter.HandleFunc("/anamnesis-template/$schema", schema.Handler("AnamnesisTemplate", models.AnamnesisTemplate{}, "name", "questions")).Methods("GET")
+	dentalRouter.HandleFunc("/anamnesis-template/{id}", handlers.GetAnamnesisTemplateByID).Methods("GET")
+	dentalRouter.Handle("/anamnesis-template/{id}", auth.RequireFunc(handlers.UpdateAnamnesisTemplate, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.Handle("/anamnesis-template/{id}", auth.RequireFunc(handlers.DeleteAnamnesisTemplate, auth.RoleAdmin)).Methods("DELETE")
+
+	// Prescription routes
+	dentalRouter.Handle("/prescription", auth.RequireFunc(handlers.CreatePrescription, auth.RoleDentist)).Methods("POST")
+	dentalRouter.Handle("/prescription", budget.ListFunc(handlers.GetAllPrescriptions)).Methods("GET")
+	dentalRouter.HandleFunc("/prescription/$schema", schema.Handler("Prescription", models.Prescription{}, "patient_id", "dentist_id", "items")).Methods("GET")
+	dentalRouter.HandleFunc("/prescription/{id}", handlers.GetPrescriptionByID).Methods("GET")
+	dentalRouter.Handle("/prescription/{id}", auth.RequireFunc(handlers.UpdatePrescription, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.Handle("/prescription/{id}", auth.RequireFunc(handlers.DeletePrescription, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.HandleFunc("/prescription/{id}/pdf", handlers.GetPrescriptionPDF).Methods("GET")
+
+	// Treatment plan routes
+	dentalRouter.Handle("/treatment-plan", auth.RequireFunc(handlers.CreateTreatmentPlan, auth.RoleDentist)).Methods("POST")
+	dentalRouter.Handle("/treatment-plan", budget.ListFunc(handlers.GetAllTreatmentPlans)).Methods("GET")
+	dentalRouter.HandleFunc("/treatment-plan/$schema", schema.Handler("TreatmentPlan", models.TreatmentPlan{}, "patient_id", "dentist_id", "items")).Methods("GET")
+	dentalRouter.HandleFunc("/treatment-plan/{id}", handlers.GetTreatmentPlanByID).Methods("GET")
+	dentalRouter.Handle("/treatment-plan/{id}", auth.RequireFunc(handlers.UpdateTreatmentPlan, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.Handle("/treatment-plan/{id}", auth.RequireFunc(handlers.DeleteTreatmentPlan, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.HandleFunc("/treatment-plan/{id}/approve", handlers.ApproveTreatmentPlan).Methods("POST")
+	dentalRouter.HandleFunc("/treatment-plan/{id}/schedule", handlers.ScheduleTreatmentPlan).Methods("POST")
 
 	// Appointment routes
 	dentalRouter.HandleFunc("/appointment", handlers.CreateAppointment).Methods("POST")
-	dentalRouter.HandleFunc("/appointment", handlers.GetAllAppointments).Methods("GET")
+	dentalRouter.Handle("/appointment", budget.ListFunc(handlers.GetAllAppointments)).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/$schema", schema.Handler("Appointment", models.Appointment{}, "dentist_id", "patient_id", "date_time", "status")).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/import", handlers.ImportAppointments).Methods("POST")
+	dentalRouter.HandleFunc("/appointment/external/{source}/{externalId}", handlers.GetAppointmentByExternalID).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/calendar", handlers.GetAppointmentCalendar).Methods("GET")
+	// Plural path of the calendar, as published to the front-end
+	dentalRouter.HandleFunc("/appointments/calendar", handlers.GetAppointmentCalendar).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/suggest", handlers.SuggestAppointmentSlots).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/backfill", handlers.GetBackfillCandidates).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/queue", handlers.GetQueue).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/queue/live", handlers.StreamQueue).Methods("GET")
 	dentalRouter.HandleFunc("/appointment/{id}", handlers.GetAppointmentByID).Methods("GET")
 	dentalRouter.HandleFunc("/appointment/patient/{patientId}", handlers.GetAppointmentsByPatient).Methods("GET")
 	dentalRouter.HandleFunc("/appointment/dentist/{dentistId}", handlers.GetAppointmentsByDentist).Methods("GET")
+	dentalRouter.HandleFunc("/appointment/series/{seriesId}", handlers.GetAppointmentSeries).Methods("GET")
 	dentalRouter.HandleFunc("/appointment/{id}", handlers.UpdateAppointment).Methods("PUT")
-	dentalRouter.HandleFunc("/appointment/{id}", handlers.DeleteAppointment).Methods("DELETE")
+	dentalRouter.HandleFunc("/appointment/{id}", handlers.PatchAppointment).Methods("PATCH")
+	dentalRouter.Handle("/appointment/{id}", auth.RequireFunc(handlers.DeleteAppointment, auth.RoleAdmin)).Methods("DELETE")
+	dentalRouter.Handle("/appointment/{id}/restore", auth.RequireFunc(handlers.RestoreAppointment, auth.RoleAdmin)).Methods("POST")
+	dentalRouter.HandleFunc("/appointment/{id}/start", handlers.StartAppointment).Methods("POST")
+	dentalRouter.HandleFunc("/appointment/{id}/finish", handlers.FinishAppointment).Methods("POST")
+	dentalRouter.HandleFunc("/check-in", handlers.CheckIn).Methods("POST")
+	dentalRouter.HandleFunc("/appointment/{id}/outcome", handlers.GetProcedureOutcome).Methods("GET")
+	dentalRouter.Handle("/appointment/{id}/outcome", auth.RequireFunc(handlers.RecordProcedureOutcome, auth.RoleDentist)).Methods("PUT")
+	dentalRouter.HandleFunc("/agenda", handlers.GetAgenda).Methods("GET")
+	dentalRouter.HandleFunc("/agenda/print", handlers.PrintAgenda).Methods("GET")
+
+	// Online booking routes
+	dentalRouter.HandleFunc("/booking", handlers.CreateBooking).Methods("POST")
+	dentalRouter.HandleFunc("/booking/slots", handlers.GetBookingSlots).Methods("GET")
+
+	// Agenda block routes
+	dentalRouter.HandleFunc("/unavailability", handlers.CreateUnavailability).Methods("POST")
+	dentalRouter.Handle("/unavailability", budget.ListFunc(handlers.GetAllUnavailability)).Methods("GET")
+	dentalRouter.HandleFunc("/unavailability/$schema", schema.Handler("Unavailability", models.Unavailability{}, "dentist_id", "start", "end")).Methods("GET")
+	dentalRouter.Handle("/unavailability/{id}", auth.RequireFunc(handlers.DeleteUnavailability, auth.RoleAdmin)).Methods("DELETE")
+
+	// Insurance pre-authorization routes
+	dentalRouter.HandleFunc("/preauth", handlers.CreatePreAuth).Methods("POST")
+	dentalRouter.Handle("/preauth", budget.ListFunc(handlers.GetAllPreAuths)).Methods("GET")
+	dentalRouter.HandleFunc("/preauth/$schema", schema.Handler("PreAuth", models.PreAuth{}, "patient_id", "procedure_id", "carrier")).Methods("GET")
+	dentalRouter.HandleFunc("/preauth/{id}", handlers.GetPreAuthByID).Methods("GET")
+	dentalRouter.HandleFunc("/preauth/{id}", handlers.UpdatePreAuth).Methods("PUT")
+	dentalRouter.Handle("/preauth/{id}", auth.RequireFunc(handlers.DeletePreAuth, auth.RoleAdmin)).Methods("DELETE")
+
+	// Task routes
+	dentalRouter.HandleFunc("/task", handlers.CreateTask).Methods("POST")
+	dentalRouter.Handle("/task", budget.ListFunc(handlers.GetAllTasks)).Methods("GET")
+	dentalRouter.HandleFunc("/task/$schema", schema.Handler("Task", models.Task{}, "title", "assignee")).Methods("GET")
+	dentalRouter.Handle("/task/mine", budget.ListFunc(handlers.GetMyTasks)).Methods("GET")
+	dentalRouter.HandleFunc("/task/overdue", handlers.GetOverdueTasks).Methods("GET")
+	dentalRouter.Handle("/task/patient/{patientId}", budget.ListFunc(handlers.GetTasksByPatient)).Methods("GET")
+	dentalRouter.HandleFunc("/task/{id}", handlers.GetTaskByID).Methods("GET")
+	dentalRouter.HandleFunc("/task/{id}", handlers.UpdateTask).Methods("PUT")
+	dentalRouter.Handle("/task/{id}", auth.RequireFunc(handlers.DeleteTask, auth.RoleAdmin)).Methods("DELETE")
+
+	// SMS and WhatsApp reminder routes
+	dentalRouter.HandleFunc("/reminders/settings", handlers.GetReminderSettings).Methods("GET")
+	dentalRouter.Handle("/reminders/settings", auth.RequireFunc(handlers.UpdateReminderSettings, auth.RoleAdmin)).Methods("PUT")
+	dentalRouter.Handle("/reminders/log", budget.ListFunc(handlers.GetReminderLog)).Methods("GET")
+
+	// Satisfaction survey routes
+	dentalRouter.HandleFunc("/survey/follow-ups", handlers.GetSurveyFollowUps).Methods("GET")
+	dentalRouter.HandleFunc("/survey/follow-ups/{appointmentId}", handlers.UpdateSurveyFollowUp).Methods("PUT")
+	dentalRouter.HandleFunc("/survey/{token}", handlers.SurveyScope(handlers.GetSurvey)).Methods("GET")
+	dentalRouter.HandleFunc("/survey/{token}/response", handlers.SurveyScope(handlers.RespondToSurvey)).Methods("POST")
+
+	// Self-service routes, behind the links sent in appointment reminders
+	dentalRouter.HandleFunc("/self-service/{token}", handlers.SelfServiceScope(handlers.GetSelfServiceAppointment)).Methods("GET")
+	dentalRouter.HandleFunc("/self-service/{token}/confirm", handlers.SelfServiceScope(handlers.ConfirmSelfServiceAppointment)).Methods("POST")
+	dentalRouter.HandleFunc("/self-service/{token}/cancel", handlers.SelfServiceScope(handlers.CancelSelfServiceAppointment)).Methods("POST")
+	dentalRouter.HandleFunc("/self-service/{token}/slots", handlers.SelfServiceScope(handlers.GetSelfServiceSlots)).Methods("GET")
+	dentalRouter.HandleFunc("/self-service/{token}/reschedule", handlers.SelfServiceScope(handlers.RescheduleSelfServiceAppointment)).Methods("POST")
+	dentalRouter.HandleFunc("/self-service/{token}/arrival", handlers.SelfServiceScope(handlers.SelfServiceArrival)).Methods("POST")
+
+	// Offline client sync route
+	dentalRouter.HandleFunc("/sync", handlers.GetSync).Methods("GET")
+	dentalRouter.HandleFunc("/sync", handlers.ApplySyncChanges(r)).Methods("POST")
+
+	// Report routes
+	dentalRouter.HandleFunc("/reports/capacity", handlers.GetCapacityReport).Methods("GET")
+	dentalRouter.HandleFunc("/reports/campaigns", handlers.GetCampaignReport).Methods("GET")
+	dentalRouter.HandleFunc("/reports/nps", handlers.GetNPSReport).Methods("GET")
+	dentalRouter.HandleFunc("/reports/quality", handlers.GetQualityReport).Methods("GET")
+	dentalRouter.Handle("/reports/benchmark", auth.RequireFunc(handlers.GetBenchmarkExport, auth.RoleAccountant)).Methods("GET")
+	dentalRouter.Handle("/reports/benchmark/settings", auth.RequireFunc(handlers.GetBenchmarkSettings, auth.RoleAccountant)).Methods("GET")
+	dentalRouter.Handle("/reports/benchmark/settings", auth.RequireFunc(handlers.UpdateBenchmarkSettings, auth.RoleAdmin)).Methods("PUT")
+	dentalRouter.HandleFunc("/stats", handlers.GetDashboardStats).Methods("GET")
+	dentalRouter.HandleFunc("/stats/live", handlers.StreamLiveMetrics).Methods("GET")
 
 	return r
 }
\ No newline at end of file
@@ -0,0 +1,295 @@
+// Package selfservice signs the links sent in appointment reminders, which
+// let patients confirm, cancel or reschedule without logging in, and sends
+// those reminders.
+package selfservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/notify"
+	"dental-saas/shared/paging"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// ErrInvalidLink is returned for tokens that are malformed or not signed by this clinic
+	ErrInvalidLink = errors.New("invalid appointment link")
+	// ErrExpiredLink is returned once the appointment a link was sent for has started
+	ErrExpiredLink = errors.New("appointment link has expired")
+)
+
+func init() {
+	notify.RegisterKind(notify.Kind{
+		Name:        "appointment_reminder",
+		Description: "Reminder sent to the patient before an appointment, with the link to confirm, cancel or reschedule it",
+		Fields: map[string]string{
+			"patient_name":     "Maria Silva",
+			"appointment_time": "2024-03-11 09:00",
+			"link":             Link("sample-token"),
+		},
+		Subject: "Appointment reminder",
+		Body:    "Hi {{patient_name}}, this is a reminder of your appointment on {{appointment_time}}. Use the link to confirm it, cancel it or pick another time.",
+	})
+}
+
+// secret returns the key links are signed with (see config.EnvSecret)
+var secret = config.EnvSecret("APPOINTMENT_LINK_SECRET", "appointment links")
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Token signs a link for an appointment at its current date and time. The
+// link expires when the appointment starts and stops working once the
+// appointment is moved to another time. Links of appointments outside the
+// default clinic also carry their clinic.
+func Token(appointment models.Appointment) (string, error) {
+	start, err := appointment.StartTime()
+	if err != nil {
+		return "", err
+	}
+	parts := []string{appointment.ID, appointment.DateTime, strconv.FormatInt(start.Unix(), 10)}
+	if appointment.ClinicID != "" && appointment.ClinicID != config.DefaultClinicID {
+		parts = append(parts, appointment.ClinicID)
+	}
+	payload := strings.Join(parts, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(payload), nil
+}
+
+// payload checks a token's signature and splits its payload into the
+// appointment ID, date and time, expiry and clinic
+func payload(token string) ([]string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidLink
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(string(raw)))) {
+		return nil, ErrInvalidLink
+	}
+
+	parts := strings.Split(string(raw), "|")
+	switch len(parts) {
+	case 3:
+		return append(parts, config.DefaultClinicID), nil
+	case 4:
+		return parts, nil
+	}
+	return nil, ErrInvalidLink
+}
+
+// Clinic returns the clinic a token was signed for, without checking whether
+// the link expired
+func Clinic(token string) (string, error) {
+	parts, err := payload(token)
+	if err != nil {
+		return "", err
+	}
+	return parts[3], nil
+}
+
+// Verify checks a token's signature and expiry, returning the appointment ID
+// and the date and time the link was issued for
+func Verify(token string) (string, string, error) {
+	parts, err := payload(token)
+	if err != nil {
+		return "", "", err
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", ErrInvalidLink
+	}
+	if time.Now().Unix() >= expires {
+		return "", "", ErrExpiredLink
+	}
+	return parts[0], parts[1], nil
+}
+
+// Link returns the public URL a patient uses to manage an appointment
+func Link(token string) string {
+	return config.EnvString("SELF_SERVICE_BASE_URL", "http://localhost:8080/api/v1/dental/self-service") + "/" + token
+}
+
+// SendReminders notifies patients of appointments starting within lead that
+// were not reminded yet, with a link to confirm, cancel or reschedule, and
+// returns how many reminders were sent
+func SendReminders(ctx context.Context, lead time.Duration) (int, error) {
+	sent := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := sendClinicReminders(ctx, lead)
+		sent += n
+		return err
+	})
+	return sent, err
+}
+
+// sendClinicReminders sends the reminders of the clinic of ctx
+func sendClinicReminders(ctx context.Context, lead time.Duration) (int, error) {
+	now := time.Now().UTC()
+	until := now.Add(lead)
+	appointments, err := paging.ScanAll[models.Appointment](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Appointments"),
+		FilterExpression: aws.String("#dt >= :from AND #dt < :to AND attribute_not_exists(ReminderSentAt)"),
+		ExpressionAttributeNames: map[string]string{
+			"#dt": "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: now.Format("2006-01-02")},
+			":to":   &types.AttributeValueMemberS{Value: until.AddDate(0, 0, 1).Format("2006-01-02")},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scanning upcoming appointments: %v", err)
+	}
+
+	sent := 0
+	for _, appointment := range appointments {
+		if appointment.Status != models.AppointmentStatusScheduled && appointment.Status != models.AppointmentStatusConfirmed {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil || start.Before(now) || !start.Before(until) {
+			continue
+		}
+		ok, err := remind(ctx, appointment, start)
+		if err != nil {
+			log.Printf("Error sending reminder of appointment %s: %v", appointment.ID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// remind marks the appointment as reminded and notifies the patient. The
+// mark comes first so concurrent instances do not remind twice.
+func remind(ctx context.Context, appointment models.Appointment, start time.Time) (bool, error) {
+	patient, err := getPatient(ctx, appointment.PatientID)
+	if err != nil {
+		return false, err
+	}
+	if patient == nil || (patient.Email == "" && patient.Phone == "") {
+		return false, nil
+	}
+	token, err := Token(appointment)
+	if err != nil {
+		return false, err
+	}
+
+	updateCtx, cancel := config.DBContext(ctx)
+	_, err = config.DBClient.UpdateItem(updateCtx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("Appointments"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: appointment.ID},
+		},
+		UpdateExpression:         aws.String("SET ReminderSentAt = :now"),
+		ConditionExpression:      aws.String("#dt = :dt AND attribute_not_exists(ReminderSentAt)"),
+		ExpressionAttributeNames: map[string]string{"#dt": "DateTime"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":dt":  &types.AttributeValueMemberS{Value: appointment.DateTime},
+		},
+	})
+	cancel()
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	to := patient.Email
+	if to == "" {
+		to = patient.Phone
+	}
+	msg, err := notify.Compose(ctx, appointment.ClinicID, "appointment_reminder", to, map[string]string{
+		"patient_name":     patient.Name,
+		"appointment_time": start.Format("2006-01-02 15:04"),
+		"link":             Link(token),
+	})
+	if err != nil {
+		return false, err
+	}
+	msg.Link = Link(token)
+	if err := notify.Send(ctx, msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StartReminders sends due appointment reminders once at startup and then every interval
+func StartReminders(ctx context.Context, interval, lead time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	send := func() {
+		n, err := SendReminders(ctx, lead)
+		if err != nil {
+			log.Printf("Error sending appointment reminders: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Sent %d appointment reminders", n)
+		}
+	}
+
+	go func() {
+		send()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+}
+
+func getPatient(ctx context.Context, id string) (*models.Patient, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching patient %s: %v", id, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var patient models.Patient
+	if err := attributevalue.UnmarshalMap(result.Item, &patient); err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
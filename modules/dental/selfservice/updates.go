@@ -0,0 +1,142 @@
+package selfservice
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/notify"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Kinds of the emails sent to patients when their appointments change
+const (
+	KindConfirmation = "appointment_confirmation"
+	KindRescheduled  = "appointment_rescheduled"
+	KindCancelled    = "appointment_cancelled"
+)
+
+func init() {
+	notify.RegisterKind(notify.Kind{
+		Name:        KindConfirmation,
+		Description: "Email sent to the patient when an appointment is booked, with the link to confirm, cancel or reschedule it",
+		Fields: map[string]string{
+			"patient_name":     "Maria Silva",
+			"dentist_name":     "Dr. João Souza",
+			"appointment_time": "2024-03-11 09:00",
+			"link":             Link("sample-token"),
+		},
+		Subject: "Appointment booked",
+		Body:    "Hi {{patient_name}}, your appointment with {{dentist_name}} is booked for {{appointment_time}}. Use the link to confirm it, cancel it or pick another time.",
+	})
+	notify.RegisterKind(notify.Kind{
+		Name:        KindRescheduled,
+		Description: "Email sent to the patient when an appointment is moved to another time",
+		Fields: map[string]string{
+			"patient_name":     "Maria Silva",
+			"dentist_name":     "Dr. João Souza",
+			"appointment_time": "2024-03-12 14:30",
+			"previous_time":    "2024-03-11 09:00",
+			"link":             Link("sample-token"),
+		},
+		Subject: "Appointment rescheduled",
+		Body:    "Hi {{patient_name}}, your appointment with {{dentist_name}} on {{previous_time}} was moved to {{appointment_time}}. Use the link to confirm it, cancel it or pick another time.",
+	})
+	notify.RegisterKind(notify.Kind{
+		Name:        KindCancelled,
+		Description: "Email sent to the patient when an appointment is cancelled",
+		Fields: map[string]string{
+			"patient_name":     "Maria Silva",
+			"dentist_name":     "Dr. João Souza",
+			"appointment_time": "2024-03-11 09:00",
+		},
+		Subject: "Appointment cancelled",
+		Body:    "Hi {{patient_name}}, your appointment with {{dentist_name}} on {{appointment_time}} was cancelled. Contact us to book another time.",
+	})
+}
+
+// SendUpdate emails the patient of an appointment a message of kind, one of
+// KindConfirmation, KindRescheduled or KindCancelled. previousTime is the
+// time the appointment was moved from, for KindRescheduled. Patients without
+// an email address are skipped, returning false.
+func SendUpdate(ctx context.Context, kind string, appointment models.Appointment, previousTime string) (bool, error) {
+	patient, err := getPatient(ctx, appointment.PatientID)
+	if err != nil {
+		return false, err
+	}
+	if patient == nil || patient.Email == "" {
+		return false, nil
+	}
+	dentistName, err := getDentistName(ctx, appointment.DentistID)
+	if err != nil {
+		return false, err
+	}
+	if appointment.ClinicID == "" {
+		appointment.ClinicID = config.ClinicID(ctx)
+	}
+
+	data := map[string]string{
+		"patient_name":     patient.Name,
+		"dentist_name":     dentistName,
+		"appointment_time": displayTime(appointment.DateTime),
+	}
+	link := ""
+	if kind != KindCancelled {
+		token, err := Token(appointment)
+		if err != nil {
+			return false, err
+		}
+		link = Link(token)
+		data["link"] = link
+	}
+	if kind == KindRescheduled {
+		data["previous_time"] = displayTime(previousTime)
+	}
+
+	msg, err := notify.Compose(ctx, appointment.ClinicID, kind, patient.Email, data)
+	if err != nil {
+		return false, err
+	}
+	msg.Link = link
+	if err := notify.Send(ctx, msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// displayTime formats an appointment time as the reminders do, keeping
+// values it cannot read as they are
+func displayTime(dateTime string) string {
+	appointment := models.Appointment{DateTime: dateTime}
+	start, err := appointment.StartTime()
+	if err != nil {
+		return dateTime
+	}
+	return start.Format("2006-01-02 15:04")
+}
+
+func getDentistName(ctx context.Context, id string) (string, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Dentists"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ProjectionExpression:     aws.String("#name"),
+		ExpressionAttributeNames: map[string]string{"#name": "Name"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("fetching dentist %s: %v", id, err)
+	}
+	var dentist models.Dentist
+	if err := attributevalue.UnmarshalMap(result.Item, &dentist); err != nil {
+		return "", err
+	}
+	return dentist.Name, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/paging"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AppointmentService manages appointments. The checks against the dentist's
+// credentials, working hours, pre-authorizations and consents are left to
+// the callers, which run them before Create and Save.
+type AppointmentService interface {
+	Create(ctx context.Context, appointment models.Appointment) (models.Appointment, error)
+	Get(ctx context.Context, id string) (models.Appointment, error)
+	List(ctx context.Context, page paging.Page) ([]models.Appointment, string, error)
+	FindByPatient(ctx context.Context, patientID string) ([]models.Appointment, error)
+	FindByDentist(ctx context.Context, dentistID string) ([]models.Appointment, error)
+	// Save replaces an appointment already merged by the caller with its
+	// stored previous version. An appointment moved to another time is
+	// reminded again.
+	Save(ctx context.Context, previous, appointment models.Appointment) (models.Appointment, error)
+	// Delete soft deletes an appointment and returns it; Restore brings it
+	// back
+	Delete(ctx context.Context, id string) (models.Appointment, error)
+	Restore(ctx context.Context, id string) (models.Appointment, error)
+}
+
+// NewAppointmentService returns an AppointmentService storing appointments
+// in repo
+func NewAppointmentService(repo repository.AppointmentRepository) AppointmentService {
+	return &appointmentService{repo: repo}
+}
+
+type appointmentService struct {
+	repo repository.AppointmentRepository
+}
+
+func (s *appointmentService) Create(ctx context.Context, appointment models.Appointment) (models.Appointment, error) {
+	if appointment.ID == "" {
+		appointment.ID = uuid.NewString()
+	}
+	if err := appointment.IsValid(); err != nil {
+		return models.Appointment{}, &ValidationError{Err: err}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if appointment.CreatedAt == "" {
+		appointment.CreatedAt = now
+	}
+	if appointment.UpdatedAt == "" {
+		appointment.UpdatedAt = now
+	}
+	if err := s.repo.Create(ctx, appointment); err != nil {
+		return models.Appointment{}, err
+	}
+	return appointment, nil
+}
+
+func (s *appointmentService) Get(ctx context.Context, id string) (models.Appointment, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *appointmentService) List(ctx context.Context, page paging.Page) ([]models.Appointment, string, error) {
+	return s.repo.List(ctx, page)
+}
+
+func (s *appointmentService) FindByPatient(ctx context.Context, patientID string) ([]models.Appointment, error) {
+	return s.repo.FindByPatient(ctx, patientID)
+}
+
+func (s *appointmentService) FindByDentist(ctx context.Context, dentistID string) ([]models.Appointment, error) {
+	return s.repo.FindByDentist(ctx, dentistID)
+}
+
+func (s *appointmentService) Save(ctx context.Context, previous, appointment models.Appointment) (models.Appointment, error) {
+	if err := appointment.IsValid(); err != nil {
+		return models.Appointment{}, &ValidationError{Err: err}
+	}
+	if appointment.DateTime != previous.DateTime {
+		// remind the patient again of the new time
+		appointment.ReminderSentAt = ""
+		appointment.TextReminderSentAt = ""
+	}
+	appointment.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(ctx, appointment); err != nil {
+		return models.Appointment{}, err
+	}
+	return appointment, nil
+}
+
+func (s *appointmentService) Delete(ctx context.Context, id string) (models.Appointment, error) {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *appointmentService) Restore(ctx context.Context, id string) (models.Appointment, error) {
+	return s.repo.Restore(ctx, id)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/mergepatch"
+	"dental-saas/shared/paging"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DentistService manages dentists
+type DentistService interface {
+	Create(ctx context.Context, dentist models.Dentist) (models.Dentist, error)
+	Get(ctx context.Context, id string) (models.Dentist, error)
+	List(ctx context.Context, page paging.Page) ([]models.Dentist, string, error)
+	FindByName(ctx context.Context, name string) ([]models.Dentist, error)
+	FindByCRO(ctx context.Context, cro string) (models.Dentist, error)
+	// Update replaces the dentist with dentist: fields left out are cleared.
+	// The ID, clinic and timestamps are kept.
+	Update(ctx context.Context, id string, dentist models.Dentist) (models.Dentist, error)
+	// Patch applies a JSON Merge Patch to the dentist: only the fields in the
+	// patch change, and null clears a field
+	Patch(ctx context.Context, id string, patch []byte) (models.Dentist, error)
+	// Delete soft deletes a dentist; Restore brings them back
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (models.Dentist, error)
+}
+
+// NewDentistService returns a DentistService storing dentists in repo
+func NewDentistService(repo repository.DentistRepository) DentistService {
+	return &dentistService{repo: repo}
+}
+
+type dentistService struct {
+	repo repository.DentistRepository
+}
+
+func (s *dentistService) Create(ctx context.Context, dentist models.Dentist) (models.Dentist, error) {
+	if dentist.ID == "" {
+		dentist.ID = uuid.NewString()
+	}
+	if err := dentist.IsValid(); err != nil {
+		return models.Dentist{}, &ValidationError{Err: err}
+	}
+	now := time.Now().UTC()
+	if dentist.CreatedAt.IsZero() {
+		dentist.CreatedAt = now
+	}
+	if dentist.UpdatedAt.IsZero() {
+		dentist.UpdatedAt = now
+	}
+	if err := s.repo.Create(ctx, dentist); err != nil {
+		return models.Dentist{}, err
+	}
+	return dentist, nil
+}
+
+func (s *dentistService) Get(ctx context.Context, id string) (models.Dentist, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *dentistService) List(ctx context.Context, page paging.Page) ([]models.Dentist, string, error) {
+	return s.repo.List(ctx, page)
+}
+
+func (s *dentistService) FindByName(ctx context.Context, name string) ([]models.Dentist, error) {
+	return s.repo.FindByName(ctx, name)
+}
+
+func (s *dentistService) FindByCRO(ctx context.Context, cro string) (models.Dentist, error) {
+	return s.repo.FindByCRO(ctx, cro)
+}
+
+func (s *dentistService) Update(ctx context.Context, id string, dentist models.Dentist) (models.Dentist, error) {
+	stored, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Dentist{}, err
+	}
+	dentist.KeepServerFields(stored)
+	return s.save(ctx, dentist)
+}
+
+func (s *dentistService) Patch(ctx context.Context, id string, patch []byte) (models.Dentist, error) {
+	stored, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Dentist{}, err
+	}
+	dentist, err := mergepatch.Apply(stored, patch)
+	if err != nil {
+		return models.Dentist{}, &ValidationError{Err: err}
+	}
+	dentist.KeepServerFields(stored)
+	return s.save(ctx, dentist)
+}
+
+func (s *dentistService) save(ctx context.Context, dentist models.Dentist) (models.Dentist, error) {
+	if err := dentist.IsValid(); err != nil {
+		return models.Dentist{}, &ValidationError{Err: err}
+	}
+
+	dentist.UpdatedAt = time.Now().UTC()
+	if err := s.repo.Update(ctx, dentist); err != nil {
+		return models.Dentist{}, err
+	}
+	return dentist, nil
+}
+
+func (s *dentistService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *dentistService) Restore(ctx context.Context, id string) (models.Dentist, error) {
+	return s.repo.Restore(ctx, id)
+}
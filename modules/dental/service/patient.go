@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/mergepatch"
+	"dental-saas/shared/paging"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PatientService manages patients
+type PatientService interface {
+	Create(ctx context.Context, patient models.Patient) (models.Patient, error)
+	Get(ctx context.Context, id string) (models.Patient, error)
+	List(ctx context.Context, page paging.Page) ([]models.Patient, string, error)
+	FindByName(ctx context.Context, name string) ([]models.Patient, error)
+	FindByEmail(ctx context.Context, email string) ([]models.Patient, error)
+	// Update replaces the patient with patient: fields left out are cleared.
+	// The ID, clinic, timestamps and campaign are kept. It returns the
+	// patient as updated and as it was before.
+	Update(ctx context.Context, id string, patient models.Patient) (models.Patient, models.Patient, error)
+	// Patch applies a JSON Merge Patch to the patient, like Update: only the
+	// fields in the patch change, and null clears a field
+	Patch(ctx context.Context, id string, patch []byte) (models.Patient, models.Patient, error)
+	// Save replaces a patient already merged by the caller, e.g. to record
+	// the campaign of their first online booking
+	Save(ctx context.Context, patient models.Patient) (models.Patient, error)
+	// Delete soft deletes a patient; Restore brings them back
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (models.Patient, error)
+}
+
+// NewPatientService returns a PatientService storing patients in repo
+func NewPatientService(repo repository.PatientRepository) PatientService {
+	return &patientService{repo: repo}
+}
+
+type patientService struct {
+	repo repository.PatientRepository
+}
+
+func (s *patientService) Create(ctx context.Context, patient models.Patient) (models.Patient, error) {
+	if patient.ID == "" {
+		patient.ID = uuid.NewString()
+	}
+	if err := patient.IsValid(); err != nil {
+		return models.Patient{}, &ValidationError{Err: err}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if patient.CreatedAt == "" {
+		patient.CreatedAt = now
+	}
+	if patient.UpdatedAt == "" {
+		patient.UpdatedAt = now
+	}
+	if err := s.repo.Create(ctx, patient); err != nil {
+		return models.Patient{}, err
+	}
+	return patient, nil
+}
+
+func (s *patientService) Get(ctx context.Context, id string) (models.Patient, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *patientService) List(ctx context.Context, page paging.Page) ([]models.Patient, string, error) {
+	return s.repo.List(ctx, page)
+}
+
+func (s *patientService) FindByName(ctx context.Context, name string) ([]models.Patient, error) {
+	return s.repo.FindByName(ctx, name)
+}
+
+func (s *patientService) FindByEmail(ctx context.Context, email string) ([]models.Patient, error) {
+	return s.repo.FindByEmail(ctx, email)
+}
+
+func (s *patientService) Update(ctx context.Context, id string, patient models.Patient) (models.Patient, models.Patient, error) {
+	previous, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Patient{}, models.Patient{}, err
+	}
+	patient.KeepServerFields(previous)
+	patient, err = s.Save(ctx, patient)
+	return patient, previous, err
+}
+
+func (s *patientService) Patch(ctx context.Context, id string, patch []byte) (models.Patient, models.Patient, error) {
+	previous, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Patient{}, models.Patient{}, err
+	}
+	patient, err := mergepatch.Apply(previous, patch)
+	if err != nil {
+		return models.Patient{}, models.Patient{}, &ValidationError{Err: err}
+	}
+	patient.KeepServerFields(previous)
+	patient, err = s.Save(ctx, patient)
+	return patient, previous, err
+}
+
+func (s *patientService) Save(ctx context.Context, patient models.Patient) (models.Patient, error) {
+	if err := patient.IsValid(); err != nil {
+		return models.Patient{}, &ValidationError{Err: err}
+	}
+	patient.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(ctx, patient); err != nil {
+		return models.Patient{}, err
+	}
+	return patient, nil
+}
+
+func (s *patientService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *patientService) Restore(ctx context.Context, id string) (models.Patient, error) {
+	return s.repo.Restore(ctx, id)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/mergepatch"
+	"dental-saas/shared/paging"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProcedureService manages procedures
+type ProcedureService interface {
+	Create(ctx context.Context, procedure models.Procedure) (models.Procedure, error)
+	Get(ctx context.Context, id string) (models.Procedure, error)
+	List(ctx context.Context, page paging.Page) ([]models.Procedure, string, error)
+	FindByName(ctx context.Context, name string) ([]models.Procedure, error)
+	// Update replaces the procedure with procedure: fields left out are
+	// cleared. The ID, clinic and timestamps are kept. It returns the
+	// procedure as updated and as it was before, whose price the caller
+	// keeps in the price history.
+	Update(ctx context.Context, id string, procedure models.Procedure) (models.Procedure, models.Procedure, error)
+	// Patch applies a JSON Merge Patch to the procedure, like Update: only
+	// the fields in the patch change, and null clears a field
+	Patch(ctx context.Context, id string, patch []byte) (models.Procedure, models.Procedure, error)
+	// Delete soft deletes a procedure; Restore brings it back
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (models.Procedure, error)
+}
+
+// NewProcedureService returns a ProcedureService storing procedures in repo
+func NewProcedureService(repo repository.ProcedureRepository) ProcedureService {
+	return &procedureService{repo: repo}
+}
+
+type procedureService struct {
+	repo repository.ProcedureRepository
+}
+
+func (s *procedureService) Create(ctx context.Context, procedure models.Procedure) (models.Procedure, error) {
+	if procedure.ID == "" {
+		procedure.ID = uuid.NewString()
+	}
+	if err := procedure.IsValid(); err != nil {
+		return models.Procedure{}, &ValidationError{Err: err}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if procedure.CreatedAt == "" {
+		procedure.CreatedAt = now
+	}
+	if procedure.UpdatedAt == "" {
+		procedure.UpdatedAt = now
+	}
+	if err := s.repo.Create(ctx, procedure); err != nil {
+		return models.Procedure{}, err
+	}
+	return procedure, nil
+}
+
+func (s *procedureService) Get(ctx context.Context, id string) (models.Procedure, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *procedureService) List(ctx context.Context, page paging.Page) ([]models.Procedure, string, error) {
+	return s.repo.List(ctx, page)
+}
+
+func (s *procedureService) FindByName(ctx context.Context, name string) ([]models.Procedure, error) {
+	return s.repo.FindByName(ctx, name)
+}
+
+func (s *procedureService) Update(ctx context.Context, id string, procedure models.Procedure) (models.Procedure, models.Procedure, error) {
+	previous, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Procedure{}, models.Procedure{}, err
+	}
+	procedure.KeepServerFields(previous)
+	procedure, err = s.save(ctx, procedure)
+	return procedure, previous, err
+}
+
+func (s *procedureService) Patch(ctx context.Context, id string, patch []byte) (models.Procedure, models.Procedure, error) {
+	previous, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Procedure{}, models.Procedure{}, err
+	}
+	procedure, err := mergepatch.Apply(previous, patch)
+	if err != nil {
+		return models.Procedure{}, models.Procedure{}, &ValidationError{Err: err}
+	}
+	procedure.KeepServerFields(previous)
+	procedure, err = s.save(ctx, procedure)
+	return procedure, previous, err
+}
+
+func (s *procedureService) save(ctx context.Context, procedure models.Procedure) (models.Procedure, error) {
+	if err := procedure.IsValid(); err != nil {
+		return models.Procedure{}, &ValidationError{Err: err}
+	}
+	procedure.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(ctx, procedure); err != nil {
+		return models.Procedure{}, err
+	}
+	return procedure, nil
+}
+
+func (s *procedureService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *procedureService) Restore(ctx context.Context, id string) (models.Procedure, error) {
+	return s.repo.Restore(ctx, id)
+}
@@ -0,0 +1,20 @@
+// Package service holds the business rules of the dental entities: ID and
+// timestamp assignment, validation and the merging of partial updates. It
+// reads and writes through the repository interfaces, so handlers depend
+// only on these services and either side can be replaced by a mock.
+package service
+
+import (
+	"dental-saas/modules/dental/repository"
+	"dental-saas/shared/records"
+)
+
+// ValidationError is returned when a record fails validation; its message is
+// safe to show to the client
+type ValidationError = records.ValidationError
+
+// Aliases of the repository errors, so callers need not import both packages
+var (
+	ErrNotFound      = repository.ErrNotFound
+	ErrAlreadyExists = repository.ErrAlreadyExists
+)
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/repository"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDentistServiceCreate(t *testing.T) {
+	ctx := context.Background()
+	dentists := NewDentistService(repository.NewMemoryDentists())
+
+	created, err := dentists.Create(ctx, models.Dentist{Name: "Ana Souza", Email: "ana@example.com", CRO: "SP-12345", Country: "BR"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == "" || created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Errorf("Create did not assign the ID and timestamps: %+v", created)
+	}
+	stored, err := dentists.Get(ctx, created.ID)
+	if err != nil || stored.Name != "Ana Souza" {
+		t.Errorf("Get = %+v, %v, want the created dentist", stored, err)
+	}
+
+	_, err = dentists.Create(ctx, models.Dentist{Name: "Ana Souza"})
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Errorf("Create without email = %v, want a ValidationError", err)
+	}
+
+	_, err = dentists.Create(ctx, created)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Create with a taken ID = %v, want ErrAlreadyExists", err)
+	}
+}
+
+func TestDentistServiceUpdateKeepsServerFields(t *testing.T) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+	dentists := NewDentistService(repository.NewMemoryDentists(models.Dentist{
+		ID: "d1", ClinicID: "c1", Name: "Ana Souza", Email: "ana@example.com", CRO: "SP-12345",
+		Country: "BR", Specialty: "Ortodontia", CreatedAt: createdAt, UpdatedAt: createdAt,
+	}))
+
+	updated, err := dentists.Update(ctx, "d1", models.Dentist{
+		ID: "other", ClinicID: "c2", Name: "Ana Lima", Email: "ana@example.com", CRO: "SP-12345", Country: "BR",
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.ID != "d1" || updated.ClinicID != "c1" || !updated.CreatedAt.Equal(createdAt) {
+		t.Errorf("Update changed the server fields: %+v", updated)
+	}
+	if updated.Specialty != "" {
+		t.Errorf("Update kept specialty %q, want it cleared", updated.Specialty)
+	}
+	if !updated.UpdatedAt.After(createdAt) {
+		t.Errorf("Update did not move UpdatedAt: %v", updated.UpdatedAt)
+	}
+
+	if _, err := dentists.Update(ctx, "missing", updated); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of a missing dentist = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDentistServicePatch(t *testing.T) {
+	ctx := context.Background()
+	dentists := NewDentistService(repository.NewMemoryDentists(models.Dentist{
+		ID: "d1", Name: "Ana Souza", Email: "ana@example.com", CRO: "SP-12345", Country: "BR", Specialty: "Ortodontia",
+	}))
+
+	patched, err := dentists.Patch(ctx, "d1", []byte(`{"phone": "11999990000", "specialty": null}`))
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if patched.Phone != "11999990000" || patched.Specialty != "" || patched.Name != "Ana Souza" {
+		t.Errorf("Patch = %+v, want the phone set, the specialty cleared and the rest kept", patched)
+	}
+
+	_, err = dentists.Patch(ctx, "d1", []byte(`{"email": null}`))
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Errorf("Patch clearing the email = %v, want a ValidationError", err)
+	}
+}
+
+func TestDentistServiceDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dentists := NewDentistService(repository.NewMemoryDentists(models.Dentist{
+		ID: "d1", Name: "Ana Souza", Email: "ana@example.com", CRO: "SP-12345", Country: "BR",
+	}))
+
+	if err := dentists.Delete(ctx, "d1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := dentists.Get(ctx, "d1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted dentist = %v, want ErrNotFound", err)
+	}
+	if err := dentists.Delete(ctx, "d1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete = %v, want ErrNotFound", err)
+	}
+
+	restored, err := dentists.Restore(ctx, "d1")
+	if err != nil || restored.DeletedAt != "" {
+		t.Fatalf("Restore = %+v, %v, want the dentist back", restored, err)
+	}
+	if _, err := dentists.Get(ctx, "d1"); err != nil {
+		t.Errorf("Get of a restored dentist: %v", err)
+	}
+}
+
+func TestPatientServiceUpdateReturnsPrevious(t *testing.T) {
+	ctx := context.Background()
+	campaign := models.CampaignAttribution{UTMSource: "instagram"}
+	patients := NewPatientService(repository.NewMemoryPatients(models.Patient{
+		ID: "p1", Name: "Bruno Lima", Email: "bruno@example.com", CreatedAt: "2024-03-04T12:00:00Z",
+		CampaignAttribution: campaign,
+	}))
+
+	updated, previous, err := patients.Update(ctx, "p1", models.Patient{Name: "Bruno Souza Lima", Email: "bruno.lima@example.com"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if previous.Name != "Bruno Lima" || updated.Name != "Bruno Souza Lima" {
+		t.Errorf("Update = %q, previous %q", updated.Name, previous.Name)
+	}
+	if updated.CampaignAttribution != campaign || updated.CreatedAt != "2024-03-04T12:00:00Z" {
+		t.Errorf("Update changed the server fields: %+v", updated)
+	}
+
+	if found, err := patients.FindByEmail(ctx, "bruno@example.com"); err != nil || len(found) != 0 {
+		t.Errorf("FindByEmail of the previous email = %v, %v, want none", found, err)
+	}
+	if found, err := patients.FindByEmail(ctx, "bruno.lima@example.com"); err != nil || len(found) != 1 {
+		t.Errorf("FindByEmail of the new email = %v, %v, want the patient", found, err)
+	}
+}
+
+func TestProcedureServicePatchReturnsPrevious(t *testing.T) {
+	ctx := context.Background()
+	procedures := NewProcedureService(repository.NewMemoryProcedures(models.Procedure{
+		ID: "pr1", ClinicID: "c1", Name: "Limpeza", Price: "150.00", Duration: "30", CreatedAt: "2024-03-04T12:00:00Z",
+	}))
+
+	patched, previous, err := procedures.Patch(ctx, "pr1", []byte(`{"price": "180.00"}`))
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if previous.Price != "150.00" || patched.Price != "180.00" || patched.Name != "Limpeza" {
+		t.Errorf("Patch = %+v, previous %+v, want the price raised and the rest kept", patched, previous)
+	}
+	if patched.ClinicID != "c1" || patched.CreatedAt != "2024-03-04T12:00:00Z" {
+		t.Errorf("Patch changed the server fields: %+v", patched)
+	}
+
+	_, _, err = procedures.Update(ctx, "pr1", models.Procedure{Name: "Limpeza"})
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Errorf("Update without price = %v, want a ValidationError", err)
+	}
+	if _, _, err := procedures.Patch(ctx, "missing", []byte(`{}`)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Patch of a missing procedure = %v, want ErrNotFound", err)
+	}
+}
+
+func TestProcedureServiceDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	procedures := NewProcedureService(repository.NewMemoryProcedures(models.Procedure{
+		ID: "pr1", Name: "Limpeza", Price: "150.00", Duration: "30",
+	}))
+
+	if err := procedures.Delete(ctx, "pr1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if found, err := procedures.FindByName(ctx, "Limp"); err != nil || len(found) != 0 {
+		t.Errorf("FindByName of a deleted procedure = %v, %v, want none", found, err)
+	}
+	if _, err := procedures.Restore(ctx, "pr1"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if found, err := procedures.FindByName(ctx, "Limp"); err != nil || len(found) != 1 {
+		t.Errorf("FindByName of a restored procedure = %v, %v, want it", found, err)
+	}
+}
+
+func TestAppointmentServiceSaveRemindsMovedAppointments(t *testing.T) {
+	ctx := context.Background()
+	appointments := NewAppointmentService(repository.NewMemoryAppointments())
+
+	created, err := appointments.Create(ctx, models.Appointment{
+		PatientID: "p1", DentistID: "d1", DateTime: "2024-03-04T09:00:00Z", Status: "scheduled",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == "" || created.CreatedAt == "" {
+		t.Errorf("Create did not assign the ID and timestamps: %+v", created)
+	}
+
+	reminded := created
+	reminded.ReminderSentAt = "2024-03-03T09:00:00Z"
+	reminded.Notes = "Trazer exames"
+	saved, err := appointments.Save(ctx, created, reminded)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if saved.ReminderSentAt == "" {
+		t.Errorf("Save cleared the reminder of an appointment kept at its time")
+	}
+
+	moved := saved
+	moved.DateTime = "2024-03-05T09:00:00Z"
+	saved, err = appointments.Save(ctx, reminded, moved)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if saved.ReminderSentAt != "" {
+		t.Errorf("Save kept the reminder of a moved appointment: %q", saved.ReminderSentAt)
+	}
+	if found, err := appointments.FindByDentist(ctx, "d1"); err != nil || len(found) != 1 || found[0].DateTime != moved.DateTime {
+		t.Errorf("FindByDentist = %+v, %v, want the moved appointment", found, err)
+	}
+}
+
+func TestAppointmentServiceDeleteReturnsAppointment(t *testing.T) {
+	ctx := context.Background()
+	appointments := NewAppointmentService(repository.NewMemoryAppointments(models.Appointment{
+		ID: "a1", PatientID: "p1", DentistID: "d1", DateTime: "2024-03-04T09:00:00Z", Status: "scheduled",
+	}))
+
+	deleted, err := appointments.Delete(ctx, "a1")
+	if err != nil || deleted.DateTime != "2024-03-04T09:00:00Z" {
+		t.Fatalf("Delete = %+v, %v, want the deleted appointment", deleted, err)
+	}
+	if found, err := appointments.FindByPatient(ctx, "p1"); err != nil || len(found) != 0 {
+		t.Errorf("FindByPatient after Delete = %v, %v, want none", found, err)
+	}
+	if _, err := appointments.Delete(ctx, "a1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,362 @@
+package survey
+
+import (
+	"context"
+	"dental-saas/modules/dental/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/notify"
+	"dental-saas/shared/paging"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// TableName holds the satisfaction surveys, keyed by AppointmentID
+const TableName = "Surveys"
+
+var (
+	// ErrSurveyNotFound is returned for unknown survey tokens or appointments
+	ErrSurveyNotFound = errors.New("survey not found")
+	// ErrAlreadyAnswered is returned when a survey receives a second response
+	ErrAlreadyAnswered = errors.New("survey already answered")
+)
+
+func init() {
+	notify.RegisterKind(notify.Kind{
+		Name:        "satisfaction_survey",
+		Description: "Satisfaction survey sent to the patient after a completed appointment",
+		Fields: map[string]string{
+			"patient_name": "Maria Silva",
+			"link":         Link("sample-token"),
+		},
+		Subject: "How was your appointment?",
+		Body:    "Hi {{patient_name}}, please tell us how likely you are to recommend us to a friend, from 0 to 10.",
+	})
+}
+
+// Dispatch creates and sends a survey for every appointment completed in the
+// last maxAge that has none yet, returning how many were sent
+func Dispatch(ctx context.Context, maxAge time.Duration) (int, error) {
+	sent := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := dispatchClinic(ctx, maxAge)
+		sent += n
+		return err
+	})
+	return sent, err
+}
+
+// dispatchClinic sends the surveys of the clinic of ctx
+func dispatchClinic(ctx context.Context, maxAge time.Duration) (int, error) {
+	since := time.Now().UTC().Add(-maxAge).Format("2006-01-02T15:04:05")
+	appointments, err := paging.ScanAll[models.Appointment](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Appointments"),
+		FilterExpression: aws.String("#status = :completed AND #dt >= :since"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+			"#dt":     "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":completed": &types.AttributeValueMemberS{Value: models.AppointmentStatusCompleted},
+			":since":     &types.AttributeValueMemberS{Value: since},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scanning completed appointments: %v", err)
+	}
+	if len(appointments) == 0 {
+		return 0, nil
+	}
+
+	existing, err := paging.ScanAll[models.Survey](ctx, &dynamodb.ScanInput{
+		TableName:            aws.String(TableName),
+		ProjectionExpression: aws.String("AppointmentID"),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scanning surveys: %v", err)
+	}
+	surveyed := make(map[string]bool, len(existing))
+	for _, s := range existing {
+		surveyed[s.AppointmentID] = true
+	}
+
+	sent := 0
+	for _, appointment := range appointments {
+		if surveyed[appointment.ID] {
+			continue
+		}
+		ok, err := send(ctx, appointment)
+		if err != nil {
+			log.Printf("Error sending survey for appointment %s: %v", appointment.ID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// send records the survey of an appointment and notifies the patient. The
+// survey is removed again when the notification fails so the next run retries.
+func send(ctx context.Context, appointment models.Appointment) (bool, error) {
+	patient, err := getPatient(ctx, appointment.PatientID)
+	if err != nil {
+		return false, err
+	}
+	if patient == nil || (patient.Email == "" && patient.Phone == "") {
+		return false, nil
+	}
+
+	survey := models.Survey{
+		AppointmentID: appointment.ID,
+		Token:         uuid.NewString(),
+		PatientID:     appointment.PatientID,
+		DentistID:     appointment.DentistID,
+		ClinicID:      appointment.ClinicID,
+		SentAt:        time.Now().UTC().Format(time.RFC3339),
+	}
+	item, err := attributevalue.MarshalMap(survey)
+	if err != nil {
+		return false, err
+	}
+
+	putCtx, cancel := config.DBContext(ctx)
+	_, err = config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(AppointmentID)"),
+	})
+	cancel()
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	to := patient.Email
+	if to == "" {
+		to = patient.Phone
+	}
+	msg, err := notify.Compose(ctx, appointment.ClinicID, "satisfaction_survey", to, map[string]string{
+		"patient_name": patient.Name,
+		"link":         Link(survey.Token),
+	})
+	if err == nil {
+		msg.Link = Link(survey.Token)
+		err = notify.Send(ctx, msg)
+	}
+	if err != nil {
+		delCtx, cancel := config.DBContext(ctx)
+		defer cancel()
+		if _, delErr := config.DBClient.DeleteItem(delCtx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(TableName),
+			Key: map[string]types.AttributeValue{
+				"AppointmentID": &types.AttributeValueMemberS{Value: appointment.ID},
+			},
+		}); delErr != nil {
+			log.Printf("Error removing unsent survey for appointment %s: %v", appointment.ID, delErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Link returns the public URL a patient uses to answer a survey
+func Link(token string) string {
+	return config.EnvString("SURVEY_BASE_URL", "http://localhost:8080/api/v1/dental/survey") + "/" + token
+}
+
+// ByToken returns the survey a public link points to
+func ByToken(ctx context.Context, token string) (models.Survey, error) {
+	surveys, err := paging.ScanAll[models.Survey](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(TableName),
+		FilterExpression: aws.String("#token = :token"),
+		ExpressionAttributeNames: map[string]string{
+			"#token": "Token",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token": &types.AttributeValueMemberS{Value: token},
+		},
+	})
+	if err != nil {
+		return models.Survey{}, err
+	}
+	if len(surveys) == 0 {
+		return models.Survey{}, ErrSurveyNotFound
+	}
+	return surveys[0], nil
+}
+
+// Respond records a patient's answer. Detractors who leave a comment are
+// flagged for follow-up by the clinic.
+func Respond(ctx context.Context, token string, response models.SurveyResponse) (models.Survey, error) {
+	survey, err := ByToken(ctx, token)
+	if err != nil {
+		return models.Survey{}, err
+	}
+	if survey.RespondedAt != "" {
+		return models.Survey{}, ErrAlreadyAnswered
+	}
+
+	survey.Score = response.Score
+	survey.Comment = response.Comment
+	survey.Category = models.NPSCategory(*response.Score)
+	survey.RespondedAt = time.Now().UTC().Format(time.RFC3339)
+
+	update := "SET Score = :score, Category = :category, RespondedAt = :respondedAt, #comment = :comment"
+	values := map[string]types.AttributeValue{
+		":score":       &types.AttributeValueMemberN{Value: fmt.Sprint(*survey.Score)},
+		":category":    &types.AttributeValueMemberS{Value: survey.Category},
+		":respondedAt": &types.AttributeValueMemberS{Value: survey.RespondedAt},
+		":comment":     &types.AttributeValueMemberS{Value: survey.Comment},
+	}
+	if survey.Category == models.NPSDetractor && survey.Comment != "" {
+		survey.FollowUpStatus = models.FollowUpOpen
+		update += ", FollowUpStatus = :followUp"
+		values[":followUp"] = &types.AttributeValueMemberS{Value: survey.FollowUpStatus}
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"AppointmentID": &types.AttributeValueMemberS{Value: survey.AppointmentID},
+		},
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("attribute_not_exists(RespondedAt)"),
+		ExpressionAttributeNames:  map[string]string{"#comment": "Comment"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return models.Survey{}, ErrAlreadyAnswered
+		}
+		return models.Survey{}, err
+	}
+	return survey, nil
+}
+
+// FollowUps returns the detractor responses with the given follow-up status
+func FollowUps(ctx context.Context, status string) ([]models.Survey, error) {
+	return paging.ScanAll[models.Survey](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(TableName),
+		FilterExpression: aws.String("FollowUpStatus = :status"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		},
+	})
+}
+
+// SetFollowUp records the clinic's follow-up on a flagged response
+func SetFollowUp(ctx context.Context, appointmentID string, followUp models.SurveyFollowUp) (models.Survey, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"AppointmentID": &types.AttributeValueMemberS{Value: appointmentID},
+		},
+		UpdateExpression:    aws.String("SET FollowUpStatus = :status, FollowUpNotes = :notes, FollowUpAt = :at"),
+		ConditionExpression: aws.String("attribute_exists(FollowUpStatus)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: followUp.Status},
+			":notes":  &types.AttributeValueMemberS{Value: followUp.Notes},
+			":at":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return models.Survey{}, ErrSurveyNotFound
+		}
+		return models.Survey{}, err
+	}
+
+	var survey models.Survey
+	if err := attributevalue.UnmarshalMap(result.Attributes, &survey); err != nil {
+		return models.Survey{}, err
+	}
+	return survey, nil
+}
+
+// Responses returns the surveys answered between from and to (inclusive dates)
+func Responses(ctx context.Context, from, to time.Time) ([]models.Survey, error) {
+	return paging.ScanAll[models.Survey](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(TableName),
+		FilterExpression: aws.String("RespondedAt >= :from AND RespondedAt < :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: from.Format("2006-01-02")},
+			":to":   &types.AttributeValueMemberS{Value: to.AddDate(0, 0, 1).Format("2006-01-02")},
+		},
+	})
+}
+
+// StartDispatcher sends pending surveys once at startup and then every interval
+func StartDispatcher(ctx context.Context, interval, maxAge time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	dispatch := func() {
+		n, err := Dispatch(ctx, maxAge)
+		if err != nil {
+			log.Printf("Error dispatching satisfaction surveys: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Sent %d satisfaction surveys", n)
+		}
+	}
+
+	go func() {
+		dispatch()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				dispatch()
+			}
+		}
+	}()
+}
+
+func getPatient(ctx context.Context, id string) (*models.Patient, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Patients"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching patient %s: %v", id, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var patient models.Patient
+	if err := attributevalue.UnmarshalMap(result.Item, &patient); err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
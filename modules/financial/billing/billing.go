@@ -0,0 +1,120 @@
+// Package billing books the revenue of the procedures performed in the
+// dental module: when an appointment with a procedure is completed, a
+// pending revenue for the procedure's price is created for the patient,
+// linked back to the appointment. It is off unless AUTO_REVENUE_FROM_APPOINTMENTS
+// is true.
+package billing
+
+import (
+	"context"
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// revenueNamespace derives the ID of an appointment's revenue from the
+// appointment's, so completing it again does not book it twice
+var revenueNamespace = uuid.MustParse("6b1f7c2e-5d0a-4f3b-9c47-2a8e1d6f0b93")
+
+// Enabled reports whether completed appointments book their revenue
+func Enabled() bool {
+	return config.Feature("AUTO_REVENUE_FROM_APPOINTMENTS")
+}
+
+// PaymentMethod is the payment method of the revenues booked for completed
+// appointments (AUTO_REVENUE_PAYMENT_METHOD, cash by default), until the
+// payment is recorded
+func PaymentMethod() models.PaymentMethod {
+	return models.PaymentMethod(config.EnvString("AUTO_REVENUE_PAYMENT_METHOD", string(models.PaymentMethodCash)))
+}
+
+// RevenueID returns the ID of the revenue booked for an appointment
+func RevenueID(appointmentID string) string {
+	return uuid.NewSHA1(revenueNamespace, []byte(appointmentID)).String()
+}
+
+// BookAppointment creates the pending revenue of a completed appointment:
+// the share of its bundle's price when it belongs to one, otherwise the price
+// its dentist charges for the procedure today. It returns nil, without
+// error, when there is nothing to book: the appointment has no procedure,
+// the price is zero, or its revenue was already booked. Revenues due in a closed period are refused with periods.ErrClosed.
+func BookAppointment(ctx context.Context, appointment dentalmodels.Appointment) (*models.Revenue, error) {
+	if appointment.Status != dentalmodels.AppointmentStatusCompleted || appointment.ProcedureID == "" {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	procedure, err := pricing.GetProcedure(ctx, appointment.ProcedureID)
+	if err != nil {
+		return nil, err
+	}
+	var amount float64
+	if appointment.Price != "" {
+		amount, err = (&dentalmodels.Procedure{Price: appointment.Price}).PriceValue()
+	} else {
+		var price dentalmodels.EffectivePrice
+		price, err = pricing.Resolve(ctx, appointment.ProcedureID, appointment.DentistID, now)
+		amount = price.Amount
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolving price of procedure %s: %v", appointment.ProcedureID, err)
+	}
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	day := now.Format("2006-01-02")
+	if start, err := appointment.StartTime(); err == nil {
+		day = start.Format("2006-01-02")
+	}
+	revenue := models.Revenue{
+		ID:            RevenueID(appointment.ID),
+		Description:   fmt.Sprintf("%s (%s)", procedure.Name, day),
+		Amount:        amount,
+		PatientID:     appointment.PatientID,
+		ProcedureID:   appointment.ProcedureID,
+		AppointmentID: appointment.ID,
+		PaymentMethod: PaymentMethod(),
+		PaymentStatus: models.PaymentStatusPending,
+		DueDate:       now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := revenue.IsValid(); err != nil {
+		return nil, err
+	}
+	if err := periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return nil, err
+	}
+
+	item, err := attributevalue.MarshalMap(revenue)
+	if err != nil {
+		return nil, err
+	}
+	putCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Revenues"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revenue, nil
+}
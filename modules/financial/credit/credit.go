@@ -0,0 +1,404 @@
+package credit
+
+import (
+	"context"
+	"crypto/rand"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/shared/config"
+	"dental-saas/shared/live"
+	"dental-saas/shared/webhooks"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Tables backing the credit ledger
+const (
+	BalancesTable = "CreditBalances"
+	LedgerTable   = "CreditLedger"
+	VouchersTable = "Vouchers"
+)
+
+// offsetAttempts bounds the retries when the balance changes concurrently
+const offsetAttempts = 3
+
+var (
+	// ErrVoucherNotFound is returned for unknown voucher codes
+	ErrVoucherNotFound = errors.New("voucher not found")
+	// ErrVoucherUnavailable is returned when a voucher was already redeemed, cancelled or expired
+	ErrVoucherUnavailable = errors.New("voucher is not available for redemption")
+	// ErrRevenueNotFound is returned when applying credit to an unknown revenue
+	ErrRevenueNotFound = errors.New("revenue not found")
+	// ErrRevenueNotPending is returned when applying credit to a revenue that is not pending
+	ErrRevenueNotPending = errors.New("revenue is not pending")
+	// ErrRevenueSplit is returned when applying credit to a revenue split
+	// between payers; the patient's split is paid on its own instead
+	ErrRevenueSplit = errors.New("revenue is split between payers")
+)
+
+// roundMoney rounds an amount to cents
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func newEntry(patientID string, entryType models.CreditEntryType, amount float64, reference, description string) models.CreditEntry {
+	now := time.Now().UTC()
+	return models.CreditEntry{
+		PatientID: patientID,
+		// Prefixing with the timestamp keeps the ledger sorted chronologically
+		EntryID:     now.Format(time.RFC3339Nano) + "#" + uuid.NewString(),
+		Type:        entryType,
+		Amount:      roundMoney(amount),
+		Reference:   reference,
+		Description: description,
+		CreatedAt:   now,
+	}
+}
+
+// entryWrites records an entry and moves the balance by its amount; debits
+// only succeed while the balance covers them
+func entryWrites(ctx context.Context, entry models.CreditEntry) ([]types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling credit entry: %v", err)
+	}
+
+	update := &types.Update{
+		TableName: aws.String(BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"PatientID": &types.AttributeValueMemberS{Value: entry.PatientID},
+		},
+		// The first entry creates the balance, which belongs to the patient's clinic
+		UpdateExpression: aws.String("ADD Balance :amount SET UpdatedAt = :now, ClinicID = if_not_exists(ClinicID, :owner)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":amount": &types.AttributeValueMemberN{Value: strconv.FormatFloat(entry.Amount, 'f', 2, 64)},
+			":now":    &types.AttributeValueMemberS{Value: entry.CreatedAt.Format(time.RFC3339)},
+			":owner":  &types.AttributeValueMemberS{Value: config.ClinicID(ctx)},
+		},
+	}
+	if entry.Amount < 0 {
+		update.ConditionExpression = aws.String("Balance >= :needed")
+		update.ExpressionAttributeValues[":needed"] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(-entry.Amount, 'f', 2, 64)}
+	}
+
+	return []types.TransactWriteItem{
+		{Update: update},
+		{Put: &types.Put{TableName: aws.String(LedgerTable), Item: item}},
+	}, nil
+}
+
+func transact(ctx context.Context, writes []types.TransactWriteItem) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: writes,
+	})
+	return err
+}
+
+// TopUp adds prepaid credit to a patient's balance
+func TopUp(ctx context.Context, patientID string, topUp models.CreditTopUp) (models.CreditEntry, error) {
+	description := topUp.Description
+	if description == "" {
+		description = "Top-up paid by " + string(topUp.PaymentMethod)
+	}
+	entry := newEntry(patientID, models.CreditEntryTopUp, topUp.Amount, "", description)
+	writes, err := entryWrites(ctx, entry)
+	if err != nil {
+		return models.CreditEntry{}, err
+	}
+	if err := transact(ctx, writes); err != nil {
+		return models.CreditEntry{}, fmt.Errorf("saving top-up: %v", err)
+	}
+	return entry, nil
+}
+
+// Balance returns a patient's current credit balance
+func Balance(ctx context.Context, patientID string) (float64, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(BalancesTable),
+		Key: map[string]types.AttributeValue{
+			"PatientID": &types.AttributeValueMemberS{Value: patientID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("fetching credit balance of patient %s: %v", patientID, err)
+	}
+	balance, ok := result.Item["Balance"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseFloat(balance.Value, 64)
+}
+
+// Entries returns a patient's ledger, oldest first
+func Entries(ctx context.Context, patientID string) ([]models.CreditEntry, error) {
+	entries := []models.CreditEntry{}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, &dynamodb.QueryInput{
+		TableName:              aws.String(LedgerTable),
+		KeyConditionExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("querying credit ledger of patient %s: %v", patientID, err)
+		}
+		var pageEntries []models.CreditEntry
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEntries); err != nil {
+			return nil, fmt.Errorf("unmarshaling credit ledger: %v", err)
+		}
+		entries = append(entries, pageEntries...)
+	}
+	return entries, nil
+}
+
+// voucherAlphabet leaves out characters easily confused when read aloud or printed
+const voucherAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+func newVoucherCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = voucherAlphabet[int(b[i])%len(voucherAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// SellVoucher issues a new voucher with a random code
+func SellVoucher(ctx context.Context, voucher models.Voucher) (models.Voucher, error) {
+	code, err := newVoucherCode()
+	if err != nil {
+		return models.Voucher{}, fmt.Errorf("generating voucher code: %v", err)
+	}
+	now := time.Now().UTC()
+	voucher.Code = code
+	voucher.Amount = roundMoney(voucher.Amount)
+	voucher.Status = models.VoucherStatusActive
+	voucher.RedeemedBy = ""
+	voucher.RedeemedAt = nil
+	voucher.CreatedAt = now
+	voucher.UpdatedAt = now
+
+	item, err := attributevalue.MarshalMap(voucher)
+	if err != nil {
+		return models.Voucher{}, fmt.Errorf("marshaling voucher: %v", err)
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(VouchersTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(Code)"),
+	}); err != nil {
+		return models.Voucher{}, fmt.Errorf("saving voucher: %v", err)
+	}
+	return voucher, nil
+}
+
+// GetVoucher fetches a voucher by code
+func GetVoucher(ctx context.Context, code string) (models.Voucher, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(VouchersTable),
+		Key: map[string]types.AttributeValue{
+			"Code": &types.AttributeValueMemberS{Value: code},
+		},
+	})
+	if err != nil {
+		return models.Voucher{}, fmt.Errorf("fetching voucher %s: %v", code, err)
+	}
+	if result.Item == nil {
+		return models.Voucher{}, ErrVoucherNotFound
+	}
+	var voucher models.Voucher
+	if err := attributevalue.UnmarshalMap(result.Item, &voucher); err != nil {
+		return models.Voucher{}, fmt.Errorf("unmarshaling voucher %s: %v", code, err)
+	}
+	return voucher, nil
+}
+
+// RedeemVoucher credits an active voucher to a patient's balance and marks it redeemed
+func RedeemVoucher(ctx context.Context, code, patientID string) (models.CreditEntry, error) {
+	voucher, err := GetVoucher(ctx, code)
+	if err != nil {
+		return models.CreditEntry{}, err
+	}
+	if voucher.Status != models.VoucherStatusActive || (voucher.ExpiresAt != nil && voucher.ExpiresAt.Before(time.Now())) {
+		return models.CreditEntry{}, ErrVoucherUnavailable
+	}
+
+	entry := newEntry(patientID, models.CreditEntryVoucher, voucher.Amount, voucher.Code, "Gift voucher redeemed")
+	writes, err := entryWrites(ctx, entry)
+	if err != nil {
+		return models.CreditEntry{}, err
+	}
+	writes = append(writes, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: aws.String(VouchersTable),
+			Key: map[string]types.AttributeValue{
+				"Code": &types.AttributeValueMemberS{Value: voucher.Code},
+			},
+			UpdateExpression:    aws.String("SET #status = :redeemed, RedeemedBy = :patientId, RedeemedAt = :now, UpdatedAt = :now"),
+			ConditionExpression: aws.String("#status = :active"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":redeemed":  &types.AttributeValueMemberS{Value: string(models.VoucherStatusRedeemed)},
+				":active":    &types.AttributeValueMemberS{Value: string(models.VoucherStatusActive)},
+				":patientId": &types.AttributeValueMemberS{Value: patientID},
+				":now":       &types.AttributeValueMemberS{Value: entry.CreatedAt.Format(time.RFC3339Nano)},
+			},
+		},
+	})
+
+	if err := transact(ctx, writes); err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) {
+			return models.CreditEntry{}, ErrVoucherUnavailable
+		}
+		return models.CreditEntry{}, fmt.Errorf("redeeming voucher %s: %v", code, err)
+	}
+	return entry, nil
+}
+
+// OffsetRevenue pays as much of a pending revenue as the patient's credit
+// covers. A fully covered revenue is marked paid by credit; otherwise the
+// remaining amount due is left to be charged.
+func OffsetRevenue(ctx context.Context, revenueID string) (models.CreditApplication, error) {
+	for attempt := 1; ; attempt++ {
+		application, err := offsetRevenue(ctx, revenueID)
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) && attempt < offsetAttempts {
+			// The balance or the revenue changed since they were read
+			continue
+		}
+		return application, err
+	}
+}
+
+func offsetRevenue(ctx context.Context, revenueID string) (models.CreditApplication, error) {
+	revenue, err := getRevenue(ctx, revenueID)
+	if err != nil {
+		return models.CreditApplication{}, err
+	}
+	if revenue.PaymentStatus != models.PaymentStatusPending {
+		return models.CreditApplication{}, ErrRevenueNotPending
+	}
+	if len(revenue.Splits) > 0 {
+		return models.CreditApplication{}, ErrRevenueSplit
+	}
+	if err := periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return models.CreditApplication{}, err
+	}
+
+	balance, err := Balance(ctx, revenue.PatientID)
+	if err != nil {
+		return models.CreditApplication{}, err
+	}
+	applied := roundMoney(math.Min(balance, revenue.AmountDue()))
+	if applied <= 0 {
+		return models.CreditApplication{
+			RevenueID: revenue.ID,
+			AmountDue: roundMoney(revenue.AmountDue()),
+			Balance:   balance,
+		}, nil
+	}
+
+	entry := newEntry(revenue.PatientID, models.CreditEntryCharge, -applied, revenue.ID, revenue.Description)
+	writes, err := entryWrites(ctx, entry)
+	if err != nil {
+		return models.CreditApplication{}, err
+	}
+
+	creditApplied := roundMoney(revenue.CreditApplied + applied)
+	update := &types.Update{
+		TableName: aws.String("Revenues"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: revenue.ID},
+		},
+		UpdateExpression:    aws.String("SET CreditApplied = :applied, UpdatedAt = :now"),
+		ConditionExpression: aws.String("PaymentStatus = :pending AND (attribute_not_exists(CreditApplied) OR CreditApplied = :previous)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":applied":  &types.AttributeValueMemberN{Value: strconv.FormatFloat(creditApplied, 'f', 2, 64)},
+			":previous": &types.AttributeValueMemberN{Value: strconv.FormatFloat(revenue.CreditApplied, 'f', -1, 64)},
+			":pending":  &types.AttributeValueMemberS{Value: string(models.PaymentStatusPending)},
+			":now":      &types.AttributeValueMemberS{Value: entry.CreatedAt.Format(time.RFC3339Nano)},
+		},
+	}
+	if creditApplied >= roundMoney(revenue.Amount) {
+		update.UpdateExpression = aws.String("SET CreditApplied = :applied, UpdatedAt = :now, PaymentStatus = :paid, PaymentMethod = :credit, PaidDate = :now")
+		update.ExpressionAttributeValues[":paid"] = &types.AttributeValueMemberS{Value: string(models.PaymentStatusPaid)}
+		update.ExpressionAttributeValues[":credit"] = &types.AttributeValueMemberS{Value: string(models.PaymentMethodCredit)}
+	}
+	writes = append(writes, types.TransactWriteItem{Update: update})
+
+	if err := transact(ctx, writes); err != nil {
+		return models.CreditApplication{}, err
+	}
+	live.Metrics.Touch()
+	if creditApplied >= roundMoney(revenue.Amount) {
+		paidAt := entry.CreatedAt
+		revenue.CreditApplied = creditApplied
+		revenue.PaymentStatus = models.PaymentStatusPaid
+		revenue.PaymentMethod = models.PaymentMethodCredit
+		revenue.PaidDate = &paidAt
+		revenue.UpdatedAt = paidAt
+		webhooks.Publish(ctx, webhooks.EventRevenuePaid, revenue)
+	}
+	return models.CreditApplication{
+		RevenueID: revenue.ID,
+		Applied:   applied,
+		AmountDue: roundMoney(revenue.Amount - creditApplied),
+		Balance:   roundMoney(balance - applied),
+	}, nil
+}
+
+func getRevenue(ctx context.Context, revenueID string) (models.Revenue, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Revenues"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: revenueID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return models.Revenue{}, fmt.Errorf("fetching revenue %s: %v", revenueID, err)
+	}
+	if result.Item == nil {
+		return models.Revenue{}, ErrRevenueNotFound
+	}
+	var revenue models.Revenue
+	if err := attributevalue.UnmarshalMap(result.Item, &revenue); err != nil {
+		return models.Revenue{}, fmt.Errorf("unmarshaling revenue %s: %v", revenueID, err)
+	}
+	return revenue, nil
+}
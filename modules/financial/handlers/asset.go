@@ -0,0 +1,614 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateAsset godoc
+// @Summary Register an equipment asset
+// @Description Register a piece of clinic equipment with its purchase data, straight-line depreciation and recurring maintenance interval
+// @Tags assets
+// @Accept json
+// @Produce json
+// @Param asset body models.Asset true "Asset data"
+// @Success 201 {object} models.Asset
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 500 {object} apierror.Response "Failed to save asset"
+// @Router /api/v1/financial/asset [post]
+func CreateAsset(w http.ResponseWriter, r *http.Request) {
+	var asset models.Asset
+	if err := json.NewDecoder(r.Body).Decode(&asset); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	asset.ID = uuid.NewString()
+	if err := asset.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if asset.NextMaintenance == nil {
+		asset.ScheduleNextMaintenance()
+	}
+
+	now := time.Now().UTC()
+	asset.CreatedAt = now
+	asset.UpdatedAt = now
+
+	if err := putAsset(r.Context(), asset, true); err != nil {
+		http.Error(w, "Failed to save asset", http.StatusInternalServerError)
+		log.Printf("Error saving asset: %v", err)
+		return
+	}
+
+	depreciation := asset.DepreciationAt(now)
+	asset.Depreciation = &depreciation
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(asset)
+}
+
+// GetAllAssets godoc
+// @Summary Get all equipment assets
+// @Description Get the registered equipment with its current depreciation, optionally only assets whose maintenance is due within a number of days
+// @Tags assets
+// @Produce json
+// @Param dueWithin query int false "Only assets with maintenance due within this many days (overdue included)"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Asset
+// @Failure 400 {object} apierror.Response "Invalid dueWithin"
+// @Failure 500 {object} apierror.Response "Failed to retrieve assets"
+// @Router /api/v1/financial/asset [get]
+func GetAllAssets(w http.ResponseWriter, r *http.Request) {
+	var dueBy *time.Time
+	if v := r.URL.Query().Get("dueWithin"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			http.Error(w, "dueWithin must be a non-negative number of days", http.StatusBadRequest)
+			return
+		}
+		limit := time.Now().UTC().AddDate(0, 0, days)
+		dueBy = &limit
+	}
+
+	page := paging.Request(r)
+	assets, next, err := paging.Scan[models.Asset](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Assets"),
+	}, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve assets", http.StatusInternalServerError)
+		log.Printf("Error scanning assets: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	filtered := []models.Asset{}
+	for _, asset := range assets {
+		if dueBy != nil && (asset.NextMaintenance == nil || asset.NextMaintenance.After(*dueBy)) {
+			continue
+		}
+		depreciation := asset.DepreciationAt(now)
+		asset.Depreciation = &depreciation
+		filtered = append(filtered, asset)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Name < filtered[j].Name
+	})
+
+	paging.Write(w, page, filtered, next)
+}
+
+// GetAssetByID godoc
+// @Summary Get an equipment asset
+// @Description Get an asset with its straight-line depreciation and book value on a date
+// @Tags assets
+// @Produce json
+// @Param id path string true "Asset ID"
+// @Param at query string false "Date for the depreciation (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} models.Asset
+// @Failure 400 {object} apierror.Response "Invalid date"
+// @Failure 404 {object} apierror.Response "Asset not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve asset"
+// @Router /api/v1/financial/asset/{id} [get]
+func GetAssetByID(w http.ResponseWriter, r *http.Request) {
+	at := time.Now().UTC()
+	if v := r.URL.Query().Get("at"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "at must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		at = parsed
+	}
+
+	asset, ok := loadAsset(w, r)
+	if !ok {
+		return
+	}
+	depreciation := asset.DepreciationAt(at)
+	asset.Depreciation = &depreciation
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset)
+}
+
+// UpdateAsset godoc
+// @Summary Update an equipment asset
+// @Description Update an asset by its ID. Only the fields sent are changed; changing the maintenance interval reschedules the next maintenance.
+// @Tags assets
+// @Accept json
+// @Produce json
+// @Param id path string true "Asset ID"
+// @Param If-Match header string false "Version of the asset being changed; required unless the body has it"
+// @Param asset body models.Asset true "Asset data"
+// @Success 200 {object} models.Asset
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Asset not found"
+// @Failure 409 {object} apierror.Response "Asset was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the asset is required"
+// @Failure 500 {object} apierror.Response "Failed to update asset"
+// @Router /api/v1/financial/asset/{id} [put]
+func UpdateAsset(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Assets", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	current, ok := loadAsset(w, r)
+	if !ok {
+		return
+	}
+
+	var updatedData models.Asset
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Name != "" {
+		current.Name = updatedData.Name
+	}
+	if updatedData.Category != "" {
+		current.Category = updatedData.Category
+	}
+	if updatedData.SerialNumber != "" {
+		current.SerialNumber = updatedData.SerialNumber
+	}
+	if updatedData.Supplier != "" {
+		current.Supplier = updatedData.Supplier
+	}
+	if !updatedData.PurchaseDate.IsZero() {
+		current.PurchaseDate = updatedData.PurchaseDate
+	}
+	if updatedData.PurchasePrice != 0 {
+		current.PurchasePrice = updatedData.PurchasePrice
+	}
+	if updatedData.SalvageValue != 0 {
+		current.SalvageValue = updatedData.SalvageValue
+	}
+	if updatedData.UsefulLifeMonths != 0 {
+		current.UsefulLifeMonths = updatedData.UsefulLifeMonths
+	}
+	if updatedData.Notes != "" {
+		current.Notes = updatedData.Notes
+	}
+	if updatedData.Responsible != "" {
+		current.Responsible = updatedData.Responsible
+	}
+	if updatedData.MaintenanceIntervalDays != 0 && updatedData.MaintenanceIntervalDays != current.MaintenanceIntervalDays {
+		current.MaintenanceIntervalDays = updatedData.MaintenanceIntervalDays
+		current.ScheduleNextMaintenance()
+	}
+	if updatedData.NextMaintenance != nil {
+		current.NextMaintenance = updatedData.NextMaintenance
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current.UpdatedAt = time.Now().UTC()
+
+	if err := putAsset(r.Context(), current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Asset not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update asset", http.StatusInternalServerError)
+		log.Printf("Error updating asset: %v", err)
+		return
+	}
+	current.Version = version + 1
+
+	depreciation := current.DepreciationAt(current.UpdatedAt)
+	current.Depreciation = &depreciation
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteAsset godoc
+// @Summary Delete an equipment asset
+// @Description Delete an asset by its ID (e.g. when it is sold or discarded). Maintenance expenses already recorded are kept.
+// @Tags assets
+// @Param id path string true "Asset ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Asset not found"
+// @Failure 500 {object} apierror.Response "Failed to delete asset"
+// @Router /api/v1/financial/asset/{id} [delete]
+func DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Assets"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: mux.Vars(r)["id"]},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Asset not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete asset", http.StatusInternalServerError)
+		log.Printf("Error deleting asset: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RecordMaintenance godoc
+// @Summary Record a maintenance of an equipment asset
+// @Description Record a maintenance performed on an asset. Its cost is booked as an equipment expense and the next maintenance is scheduled from the maintenance date.
+// @Tags assets
+// @Accept json
+// @Produce json
+// @Param id path string true "Asset ID"
+// @Param maintenance body models.MaintenanceRecord true "Maintenance date, description, cost and supplier"
+// @Success 201 {object} models.MaintenanceRecord
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Asset not found"
+// @Failure 409 {object} apierror.Response "Financial period of the maintenance date is closed"
+// @Failure 500 {object} apierror.Response "Failed to record maintenance"
+// @Router /api/v1/financial/asset/{id}/maintenance [post]
+func RecordMaintenance(w http.ResponseWriter, r *http.Request) {
+	asset, ok := loadAsset(w, r)
+	if !ok {
+		return
+	}
+
+	var record models.MaintenanceRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := record.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	record.AssetID = asset.ID
+	record.ID = uuid.NewString()
+	record.CreatedAt = now
+	if record.Supplier == "" {
+		record.Supplier = asset.Supplier
+	}
+
+	var items []types.TransactWriteItem
+	if record.Cost > 0 {
+		if !checkPeriodOpen(w, r, record.Date) {
+			return
+		}
+		expense := models.Expense{
+			ID:          uuid.NewString(),
+			Description: fmt.Sprintf("Maintenance of %s: %s", asset.Name, record.Description),
+			Amount:      record.Cost,
+			Category:    models.ExpenseCategoryEquipment,
+			Date:        record.Date,
+			Supplier:    record.Supplier,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		record.ExpenseID = expense.ID
+		item, err := attributevalue.MarshalMap(expense)
+		if err != nil {
+			http.Error(w, "Failed to record maintenance", http.StatusInternalServerError)
+			log.Printf("Error marshaling maintenance expense: %v", err)
+			return
+		}
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String("Expenses"),
+			Item:      item,
+		}})
+	}
+
+	// Only a newer maintenance moves the schedule forward
+	if asset.LastMaintenance == nil || record.Date.After(*asset.LastMaintenance) {
+		date := record.Date
+		asset.LastMaintenance = &date
+		asset.ScheduleNextMaintenance()
+		asset.ReminderSentFor = ""
+	}
+	asset.UpdatedAt = now
+
+	recordItem, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		http.Error(w, "Failed to record maintenance", http.StatusInternalServerError)
+		log.Printf("Error marshaling maintenance record: %v", err)
+		return
+	}
+	assetItem, err := attributevalue.MarshalMap(asset)
+	if err != nil {
+		http.Error(w, "Failed to record maintenance", http.StatusInternalServerError)
+		log.Printf("Error marshaling asset: %v", err)
+		return
+	}
+	items = append(items,
+		types.TransactWriteItem{Put: &types.Put{
+			TableName: aws.String("AssetMaintenance"),
+			Item:      recordItem,
+		}},
+		types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String("Assets"),
+			Item:                assetItem,
+			ConditionExpression: aws.String("attribute_exists(ID)"),
+		}},
+	)
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	if _, err := config.DBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	}); err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) {
+			http.Error(w, "Asset not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to record maintenance", http.StatusInternalServerError)
+		log.Printf("Error recording maintenance: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+// GetMaintenanceHistory godoc
+// @Summary Get the maintenance history of an equipment asset
+// @Description Get the maintenances recorded for an asset, newest first
+// @Tags assets
+// @Produce json
+// @Param id path string true "Asset ID"
+// @Success 200 {array} models.MaintenanceRecord
+// @Failure 500 {object} apierror.Response "Failed to retrieve maintenance history"
+// @Router /api/v1/financial/asset/{id}/maintenance [get]
+func GetMaintenanceHistory(w http.ResponseWriter, r *http.Request) {
+	assetID := mux.Vars(r)["id"]
+
+	var records []models.MaintenanceRecord
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, &dynamodb.QueryInput{
+		TableName:              aws.String("AssetMaintenance"),
+		KeyConditionExpression: aws.String("AssetID = :assetId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":assetId": &types.AttributeValueMemberS{Value: assetID},
+		},
+	})
+	for paginator.HasMorePages() {
+		ctx, cancel := config.DBContext(r.Context())
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			http.Error(w, "Failed to retrieve maintenance history", http.StatusInternalServerError)
+			log.Printf("Error querying maintenance of asset %s: %v", assetID, err)
+			return
+		}
+		var pageRecords []models.MaintenanceRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRecords); err != nil {
+			http.Error(w, "Failed to retrieve maintenance history", http.StatusInternalServerError)
+			log.Printf("Error unmarshaling maintenance records: %v", err)
+			return
+		}
+		records = append(records, pageRecords...)
+	}
+	if records == nil {
+		records = []models.MaintenanceRecord{}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Date.After(records[j].Date)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// SendMaintenanceReminders notifies the responsible staff member, through the
+// notification inbox, of maintenances due within leadDays. Each scheduled
+// maintenance is reminded once. Returns how many reminders were sent.
+func SendMaintenanceReminders(ctx context.Context, leadDays int) (int, error) {
+	sent := 0
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		n, err := sendClinicMaintenanceReminders(ctx, leadDays)
+		sent += n
+		return err
+	})
+	return sent, err
+}
+
+// sendClinicMaintenanceReminders sends the maintenance reminders of the clinic of ctx
+func sendClinicMaintenanceReminders(ctx context.Context, leadDays int) (int, error) {
+	assets, err := paging.ScanAll[models.Asset](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Assets"),
+		FilterExpression: aws.String("attribute_exists(NextMaintenance) AND attribute_exists(Responsible)"),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scanning assets: %v", err)
+	}
+
+	limit := time.Now().UTC().AddDate(0, 0, leadDays)
+	sent := 0
+	for _, asset := range assets {
+		if asset.NextMaintenance == nil || asset.Responsible == "" || asset.NextMaintenance.After(limit) {
+			continue
+		}
+		due := asset.NextMaintenance.Format("2006-01-02")
+		if asset.ReminderSentFor == due {
+			continue
+		}
+
+		updateCtx, cancel := config.DBContext(ctx)
+		_, err := config.DBClient.UpdateItem(updateCtx, &dynamodb.UpdateItemInput{
+			TableName: aws.String("Assets"),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: asset.ID},
+			},
+			UpdateExpression:    aws.String("SET ReminderSentFor = :due"),
+			ConditionExpression: aws.String("attribute_not_exists(ReminderSentFor) OR ReminderSentFor <> :due"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":due": &types.AttributeValueMemberS{Value: due},
+			},
+		})
+		cancel()
+		if err != nil {
+			var cfe *types.ConditionalCheckFailedException
+			if !errors.As(err, &cfe) {
+				log.Printf("Error marking maintenance reminder of asset %s: %v", asset.ID, err)
+			}
+			continue
+		}
+
+		if err := inbox.Notify(ctx, inbox.Notification{
+			Recipient:  asset.Responsible,
+			Kind:       "maintenance_due",
+			SourceType: "asset",
+			SourceID:   asset.ID,
+			Excerpt:    fmt.Sprintf("Maintenance of %s is due on %s", asset.Name, due),
+		}); err != nil {
+			log.Printf("Error notifying maintenance of asset %s: %v", asset.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// StartMaintenanceReminders sends due maintenance reminders once at startup and then every interval
+func StartMaintenanceReminders(ctx context.Context, interval time.Duration, leadDays int) {
+	if interval <= 0 {
+		return
+	}
+	remind := func() {
+		n, err := SendMaintenanceReminders(ctx, leadDays)
+		if err != nil {
+			log.Printf("Error sending maintenance reminders: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Sent %d maintenance reminders", n)
+		}
+	}
+
+	go func() {
+		remind()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				remind()
+			}
+		}
+	}()
+}
+
+// loadAsset fetches the asset of the request path, writing the error response when it cannot be returned
+func loadAsset(w http.ResponseWriter, r *http.Request) (models.Asset, bool) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := config.DBContext(r.Context())
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Assets"),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve asset", http.StatusInternalServerError)
+		log.Printf("Error fetching asset with ID %s: %v", id, err)
+		return models.Asset{}, false
+	}
+	if result.Item == nil {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return models.Asset{}, false
+	}
+
+	var asset models.Asset
+	if err := attributevalue.UnmarshalMap(result.Item, &asset); err != nil {
+		http.Error(w, "Failed to unmarshal asset data", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling asset data: %v", err)
+		return models.Asset{}, false
+	}
+	return asset, true
+}
+
+// putAsset writes an asset; empty optional fields are omitted so the reminder
+// scan only matches assets with a schedule and a responsible member
+func putAsset(ctx context.Context, asset models.Asset, create bool) error {
+	item, err := attributevalue.MarshalMap(asset)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"Responsible", "ReminderSentFor"} {
+		if v, ok := item[name].(*types.AttributeValueMemberS); ok && v.Value == "" {
+			delete(item, name)
+		}
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Assets"),
+		Item:      item,
+	}, create)
+}
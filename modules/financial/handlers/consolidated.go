@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxConsolidatedMonths bounds the months of a consolidated report, each
+// clinic's open months costing a scan of its records
+const maxConsolidatedMonths = 12
+
+// GetConsolidatedReport godoc
+// @Summary Get the consolidated report of an organization
+// @Description Revenue, expense and invoice totals of every clinic of the user's organization month by month, with each clinic's and the group's totals and net amount (revenues minus expenses). Closed months report the totals recorded at closing, open ones the current totals. Requires a group-level role.
+// @Tags reports
+// @Produce json
+// @Param from query string false "First month (YYYY-MM), default the current month"
+// @Param to query string false "Last month (YYYY-MM), default the current month; at most 12 months after from"
+// @Success 200 {object} models.ConsolidatedReport
+// @Failure 400 {object} apierror.Response "Invalid months"
+// @Failure 403 {object} apierror.Response "A group-level role is required"
+// @Failure 500 {object} apierror.Response "Failed to build consolidated report"
+// @Router /api/v1/financial/reports/consolidated [get]
+func GetConsolidatedReport(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok || claims.Organization == "" {
+		http.Error(w, "A group-level role is required", http.StatusForbidden)
+		return
+	}
+
+	current := periods.Month(time.Now())
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" {
+		from = current
+	}
+	if to == "" {
+		to = current
+	}
+	start, err := models.ParseMonth(from)
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	end, err := models.ParseMonth(to)
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	if !end.Before(start.AddDate(0, maxConsolidatedMonths, 0)) {
+		http.Error(w, "the report covers at most 12 months", http.StatusBadRequest)
+		return
+	}
+
+	members, err := clinics.OrganizationClinics(r.Context(), claims.Organization)
+	if err != nil {
+		http.Error(w, "Failed to build consolidated report", http.StatusInternalServerError)
+		log.Printf("Error listing clinics of organization %s: %v", claims.Organization, err)
+		return
+	}
+
+	report := models.ConsolidatedReport{
+		OrganizationID: claims.Organization,
+		From:           from,
+		To:             to,
+		Clinics:        make([]models.ClinicTotals, 0, len(members)),
+	}
+	for _, clinic := range members {
+		months, err := periods.Range(config.WithClinic(r.Context(), clinic.ID), from, to)
+		if err != nil {
+			http.Error(w, "Failed to build consolidated report", http.StatusInternalServerError)
+			log.Printf("Error computing periods of clinic %s: %v", clinic.ID, err)
+			return
+		}
+		totals := models.ClinicTotals{ClinicID: clinic.ID, ClinicName: clinic.Name, Months: months}
+		for _, month := range months {
+			totals.Totals.Add(month.Totals)
+		}
+		totals.Net = totals.Totals.RevenueAmount - totals.Totals.ExpenseAmount
+		report.Clinics = append(report.Clinics, totals)
+		report.Totals.Add(totals.Totals)
+	}
+	report.Net = report.Totals.RevenueAmount - report.Totals.ExpenseAmount
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/credit"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/shared/apierror"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SellVoucher godoc
+// @Summary Sell a gift voucher
+// @Description Issue a gift voucher with a random code that a patient can later redeem as prepaid credit
+// @Tags credit
+// @Accept json
+// @Produce json
+// @Param voucher body models.Voucher true "Voucher amount, purchaser, payment method and optional expiration"
+// @Success 201 {object} models.Voucher
+// @Failure 400 {object} apierror.Response "Invalid request body or missing fields"
+// @Failure 500 {object} apierror.Response "Failed to sell voucher"
+// @Router /api/v1/financial/voucher [post]
+func SellVoucher(w http.ResponseWriter, r *http.Request) {
+	var voucher models.Voucher
+	if err := json.NewDecoder(r.Body).Decode(&voucher); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := voucher.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	voucher, err := credit.SellVoucher(r.Context(), voucher)
+	if err != nil {
+		http.Error(w, "Failed to sell voucher", http.StatusInternalServerError)
+		log.Printf("Error selling voucher: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// GetVoucher godoc
+// @Summary Get a gift voucher
+// @Description Get a gift voucher by code, including whether it was already redeemed
+// @Tags credit
+// @Produce json
+// @Param code path string true "Voucher code"
+// @Success 200 {object} models.Voucher
+// @Failure 404 {object} apierror.Response "Voucher not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve voucher"
+// @Router /api/v1/financial/voucher/{code} [get]
+func GetVoucher(w http.ResponseWriter, r *http.Request) {
+	voucher, err := credit.GetVoucher(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		if errors.Is(err, credit.ErrVoucherNotFound) {
+			http.Error(w, "Voucher not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve voucher", http.StatusInternalServerError)
+		log.Printf("Error fetching voucher: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// RedeemVoucher godoc
+// @Summary Redeem a gift voucher
+// @Description Credit the voucher amount to a patient's prepaid balance. A voucher can be redeemed once, before it expires.
+// @Tags credit
+// @Accept json
+// @Produce json
+// @Param code path string true "Voucher code"
+// @Param redemption body models.VoucherRedemption true "Patient receiving the credit"
+// @Success 200 {object} models.CreditEntry
+// @Failure 400 {object} apierror.Response "Invalid request body"
+// @Failure 404 {object} apierror.Response "Voucher not found"
+// @Failure 409 {object} apierror.Response "Voucher is not available for redemption"
+// @Failure 500 {object} apierror.Response "Failed to redeem voucher"
+// @Router /api/v1/financial/voucher/{code}/redeem [post]
+func RedeemVoucher(w http.ResponseWriter, r *http.Request) {
+	var redemption models.VoucherRedemption
+	if err := json.NewDecoder(r.Body).Decode(&redemption); err != nil || redemption.PatientID == "" {
+		http.Error(w, "Invalid request body: patient_id is required", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := credit.RedeemVoucher(r.Context(), mux.Vars(r)["code"], redemption.PatientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, credit.ErrVoucherNotFound):
+			http.Error(w, "Voucher not found", http.StatusNotFound)
+		case errors.Is(err, credit.ErrVoucherUnavailable):
+			http.Error(w, "Voucher is not available for redemption", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to redeem voucher", http.StatusInternalServerError)
+			log.Printf("Error redeeming voucher: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// GetCreditBalance godoc
+// @Summary Get a patient's credit balance
+// @Description Get a patient's prepaid credit balance and ledger (top-ups, redeemed vouchers and charges paid with credit)
+// @Tags credit
+// @Produce json
+// @Param patientId path string true "Patient ID"
+// @Success 200 {object} models.CreditBalance
+// @Failure 500 {object} apierror.Response "Failed to retrieve credit balance"
+// @Router /api/v1/financial/credit/{patientId} [get]
+func GetCreditBalance(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["patientId"]
+
+	balance, err := credit.Balance(r.Context(), patientID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve credit balance", http.StatusInternalServerError)
+		log.Printf("Error fetching credit balance: %v", err)
+		return
+	}
+	entries, err := credit.Entries(r.Context(), patientID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve credit balance", http.StatusInternalServerError)
+		log.Printf("Error fetching credit ledger: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.CreditBalance{
+		PatientID: patientID,
+		Balance:   balance,
+		Entries:   entries,
+	})
+}
+
+// TopUpCredit godoc
+// @Summary Top up a patient's credit
+// @Description Add prepaid credit paid by the patient to their balance
+// @Tags credit
+// @Accept json
+// @Produce json
+// @Param patientId path string true "Patient ID"
+// @Param topUp body models.CreditTopUp true "Amount and payment method"
+// @Success 201 {object} models.CreditEntry
+// @Failure 400 {object} apierror.Response "Invalid request body or missing fields"
+// @Failure 500 {object} apierror.Response "Failed to top up credit"
+// @Router /api/v1/financial/credit/{patientId}/top-up [post]
+func TopUpCredit(w http.ResponseWriter, r *http.Request) {
+	var topUp models.CreditTopUp
+	if err := json.NewDecoder(r.Body).Decode(&topUp); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := topUp.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := credit.TopUp(r.Context(), mux.Vars(r)["patientId"], topUp)
+	if err != nil {
+		http.Error(w, "Failed to top up credit", http.StatusInternalServerError)
+		log.Printf("Error topping up credit: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// ApplyCreditToRevenue godoc
+// @Summary Pay a pending revenue with credit
+// @Description Offset as much of a pending revenue as the patient's credit covers. Fully covered revenues are marked paid by credit; otherwise the remaining amount due is returned to be charged.
+// @Tags credit
+// @Produce json
+// @Param id path string true "Revenue ID"
+// @Success 200 {object} models.CreditApplication
+// @Failure 404 {object} apierror.Response "Revenue not found"
+// @Failure 409 {object} apierror.Response "Revenue is not pending, is split between payers or its period is closed"
+// @Failure 500 {object} apierror.Response "Failed to apply credit"
+// @Router /api/v1/financial/revenue/{id}/apply-credit [post]
+func ApplyCreditToRevenue(w http.ResponseWriter, r *http.Request) {
+	application, err := credit.OffsetRevenue(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		switch {
+		case errors.Is(err, credit.ErrRevenueNotFound):
+			http.Error(w, "Revenue not found", http.StatusNotFound)
+		case errors.Is(err, credit.ErrRevenueNotPending):
+			http.Error(w, "Revenue is not pending", http.StatusConflict)
+		case errors.Is(err, credit.ErrRevenueSplit):
+			http.Error(w, "Revenue is split between payers, pay the patient's split instead", http.StatusConflict)
+		case errors.Is(err, periods.ErrClosed):
+			apierror.Write(w, r, http.StatusConflict, apierror.CodePeriodClosed, err.Error(), nil)
+		default:
+			http.Error(w, "Failed to apply credit", http.StatusInternalServerError)
+			log.Printf("Error applying credit to revenue: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(application)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// CreateExpense godoc
+// @Summary Create a new expense
+// @Description Record a clinic expense. Expenses dated in a closed financial period are refused; record an adjusting entry instead.
+// @Tags expenses
+// @Accept json
+// @Produce json
+// @Param expense body models.Expense true "Expense data (ID will be ignored)"
+// @Success 201 {object} models.Expense
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Financial period of the expense date is closed"
+// @Failure 500 {object} apierror.Response "Failed to save expense"
+// @Router /api/v1/financial/expense [post]
+func CreateExpense(w http.ResponseWriter, r *http.Request) {
+	var expense models.Expense
+	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expense.ID = ""
+	// Adjusting entries are only created through the period endpoints
+	expense.AdjustsPeriod = ""
+	expense.AdjustsID = ""
+
+	expense, err := Expenses.Create(r.Context(), expense)
+	if err != nil {
+		writeServiceError(w, r, err, "Expense", "Failed to save expense")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(expense)
+}
+
+// GetAllExpenses godoc
+// @Summary Get all expenses
+// @Description Get the clinic expenses, optionally filtered by category, status and date range
+// @Tags expenses
+// @Produce json
+// @Param category query string false "Expense category"
+// @Param status query string false "draft or approved"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Expense
+// @Failure 400 {object} apierror.Response "Invalid filter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve expenses"
+// @Router /api/v1/financial/expense [get]
+func GetAllExpenses(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repository.ExpenseFilter{
+		Category: models.ExpenseCategory(query.Get("category")),
+		Status:   models.ExpenseStatus(query.Get("status")),
+	}
+	switch filter.Status {
+	case "", models.ExpenseStatusDraft, models.ExpenseStatusApproved:
+	default:
+		http.Error(w, "status must be draft or approved", http.StatusBadRequest)
+		return
+	}
+	date, ok := requestDateRange(w, r)
+	if !ok {
+		return
+	}
+	filter.Date = date
+
+	page := paging.Request(r)
+	expenses, next, err := Expenses.List(r.Context(), filter, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve expenses", http.StatusInternalServerError)
+		log.Printf("Error scanning expenses: %v", err)
+		return
+	}
+
+	paging.Write(w, page, expenses, next)
+}
+
+// GetExpenseByID godoc
+// @Summary Get an expense by ID
+// @Description Get an expense by its ID
+// @Tags expenses
+// @Produce json
+// @Param id path string true "Expense ID"
+// @Success 200 {object} models.Expense
+// @Failure 404 {object} apierror.Response "Expense not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve expense"
+// @Router /api/v1/financial/expense/{id} [get]
+func GetExpenseByID(w http.ResponseWriter, r *http.Request) {
+	expense, err := Expenses.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, r, err, "Expense", "Failed to retrieve expense")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expense)
+}
+
+// UpdateExpense godoc
+// @Summary Update an expense
+// @Description Update an expense by its ID. Only the fields sent are changed; approving a draft is done by sending status "approved". Expenses in a closed period, or moved into one, are refused.
+// @Tags expenses
+// @Accept json
+// @Produce json
+// @Param id path string true "Expense ID"
+// @Param If-Match header string false "Version of the expense being changed; required unless the body has it"
+// @Param expense body models.Expense true "Expense data"
+// @Success 200 {object} models.Expense
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Expense not found"
+// @Failure 409 {object} apierror.Response "Financial period is closed or expense was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the expense is required"
+// @Failure 500 {object} apierror.Response "Failed to update expense"
+// @Router /api/v1/financial/expense/{id} [put]
+func UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Expenses", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var updatedData models.Expense
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	expense, err := Expenses.Update(r.Context(), mux.Vars(r)["id"], updatedData)
+	if err != nil {
+		writeServiceError(w, r, err, "Expense", "Failed to update expense")
+		return
+	}
+	expense.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expense)
+}
+
+// DeleteExpense godoc
+// @Summary Delete an expense
+// @Description Delete an expense by its ID. Expenses in a closed period are kept; record an adjusting entry instead.
+// @Tags expenses
+// @Param id path string true "Expense ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Expense not found"
+// @Failure 409 {object} apierror.Response "Financial period of the expense date is closed"
+// @Failure 500 {object} apierror.Response "Failed to delete expense"
+// @Router /api/v1/financial/expense/{id} [delete]
+func DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	if err := Expenses.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeServiceError(w, r, err, "Expense", "Failed to delete expense")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dateRangeFilter adds the from and to query parameters, as inclusive dates,
+// to a scan filter on a date attribute. It returns false when the error
+// response was written.
+func dateRangeFilter(w http.ResponseWriter, r *http.Request, attribute string, filters *[]string, names map[string]string, values map[string]types.AttributeValue) bool {
+	dates, ok := requestDateRange(w, r)
+	if !ok {
+		return false
+	}
+	dates.Filter(attribute, filters, names, values)
+	return true
+}
+
+// requestDateRange reads the from and to query parameters as an inclusive
+// range of dates. It returns false when the error response was written.
+func requestDateRange(w http.ResponseWriter, r *http.Request) (repository.DateRange, bool) {
+	query := r.URL.Query()
+	from, hasFrom, err := parseDateParam(query, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return repository.DateRange{}, false
+	}
+	to, hasTo, err := parseDateParam(query, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return repository.DateRange{}, false
+	}
+	if hasFrom && hasTo && to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return repository.DateRange{}, false
+	}
+	dates := repository.DateRange{From: from}
+	if hasTo {
+		dates.To = to.AddDate(0, 0, 1)
+	}
+	return dates, true
+}
+
+// deleteRecord deletes an item by ID, writing the error response, named
+// after the entity, when it fails. It returns false when the error response
+// was written.
+func deleteRecord(w http.ResponseWriter, r *http.Request, table, id, entity string) bool {
+	if err := records.Remove(r.Context(), table, id); err != nil {
+		if errors.Is(err, records.ErrNotFound) {
+			http.Error(w, entity+" not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Failed to delete "+strings.ToLower(entity), http.StatusInternalServerError)
+		log.Printf("Error deleting %s %s: %v", strings.ToLower(entity), id, err)
+		return false
+	}
+	return true
+}
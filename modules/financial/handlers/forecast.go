@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/modules/dental/pricing"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// z-score for a 95% confidence interval
+const forecastZ = 1.96
+
+// GetRevenueForecast godoc
+// @Summary Get revenue forecast
+// @Description Project revenue for a future period from scheduled appointments (price in force on the appointment date, or the dentist's own price, × historical completion rate) and pending receivables due in the period (amount × historical collection rate), with 95% confidence ranges
+// @Tags reports
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD), defaults to today"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive, defaults to 30 days after from"
+// @Param history_days query int false "Days of history used to compute rates (default 90)"
+// @Success 200 {object} models.RevenueForecast
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 500 {object} apierror.Response "Failed to build revenue forecast"
+// @Router /api/v1/financial/reports/forecast [get]
+func GetRevenueForecast(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "from must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	to := from.AddDate(0, 0, 30)
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "to must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	historyDays := 90
+	if v := query.Get("history_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			http.Error(w, "history_days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		historyDays = days
+	}
+	historyFrom := from.AddDate(0, 0, -historyDays)
+	end := to.AddDate(0, 0, 1)
+
+	appointments, err := paging.ScanAll[dentalmodels.Appointment](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Appointments"),
+		FilterExpression: aws.String("#dt >= :from AND #dt < :to"),
+		ExpressionAttributeNames: map[string]string{
+			"#dt": "DateTime",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: historyFrom.Format("2006-01-02")},
+			":to":   &types.AttributeValueMemberS{Value: end.Format("2006-01-02")},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to build revenue forecast", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments for forecast: %v", err)
+		return
+	}
+
+	procedures, err := paging.ScanAll[dentalmodels.Procedure](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Procedures"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build revenue forecast", http.StatusInternalServerError)
+		log.Printf("Error scanning procedures for forecast: %v", err)
+		return
+	}
+	prices := make(map[string]float64)
+	for _, procedure := range procedures {
+		if price, err := procedure.PriceValue(); err == nil {
+			prices[procedure.ID] = price
+		}
+	}
+
+	overrides, err := pricing.LoadOverrides(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to build revenue forecast", http.StatusInternalServerError)
+		log.Printf("Error loading dentist prices for forecast: %v", err)
+		return
+	}
+
+	history, err := pricing.LoadHistory(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to build revenue forecast", http.StatusInternalServerError)
+		log.Printf("Error loading price history for forecast: %v", err)
+		return
+	}
+
+	revenues, err := paging.ScanAll[models.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("DueDate >= :from AND DueDate < :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: historyFrom.Format(time.RFC3339)},
+			":to":   &types.AttributeValueMemberS{Value: end.Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to build revenue forecast", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues for forecast: %v", err)
+		return
+	}
+
+	// Historical completion rate and upcoming appointment values
+	var pastTotal, pastCompleted int
+	var upcoming []float64
+	for _, appointment := range appointments {
+		start, err := appointment.StartTime()
+		if err != nil {
+			continue
+		}
+		if start.Before(from) {
+			pastTotal++
+			if appointment.Status == dentalmodels.AppointmentStatusCompleted {
+				pastCompleted++
+			}
+			continue
+		}
+		if appointment.IsCancelled() || appointment.Status == dentalmodels.AppointmentStatusCompleted {
+			continue
+		}
+		if price, ok := prices[appointment.ProcedureID]; ok {
+			price = history.PriceAt(appointment.ProcedureID, start, price)
+			upcoming = append(upcoming, overrides.Price(appointment.DentistID, appointment.ProcedureID, price))
+		}
+	}
+	completionRate := 1.0
+	if pastTotal > 0 {
+		completionRate = float64(pastCompleted) / float64(pastTotal)
+	}
+
+	// Historical collection rate and receivables due in the period
+	var pastDue, pastCollected float64
+	var receivables []float64
+	for _, revenue := range revenues {
+		if revenue.DueDate.Before(from) {
+			if revenue.PaymentStatus == models.PaymentStatusRefunded {
+				continue
+			}
+			pastDue += revenue.Amount
+			for _, payment := range revenue.Payments() {
+				pastCollected += payment.Amount
+			}
+			continue
+		}
+		if revenue.PaymentStatus != models.PaymentStatusPending {
+			continue
+		}
+		// each payer's pending split is collected independently
+		if len(revenue.Splits) == 0 {
+			receivables = append(receivables, revenue.Outstanding())
+			continue
+		}
+		for _, split := range revenue.Splits {
+			if split.PaymentStatus == models.PaymentStatusPending {
+				receivables = append(receivables, split.Amount)
+			}
+		}
+	}
+	collectionRate := 1.0
+	if pastDue > 0 {
+		collectionRate = pastCollected / pastDue
+	}
+
+	forecast := models.RevenueForecast{
+		From:         from.Format("2006-01-02"),
+		To:           to.Format("2006-01-02"),
+		HistoryDays:  historyDays,
+		Appointments: forecastComponent(upcoming, completionRate),
+		Receivables:  forecastComponent(receivables, collectionRate),
+	}
+
+	// Both components are treated as independent, so variances add up
+	forecast.Expected = roundMoney(forecast.Appointments.Expected + forecast.Receivables.Expected)
+	sigma := math.Sqrt(componentVariance(upcoming, completionRate) + componentVariance(receivables, collectionRate))
+	forecast.Low = roundMoney(math.Max(0, forecast.Expected-forecastZ*sigma))
+	forecast.High = roundMoney(forecast.Expected + forecastZ*sigma)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// forecastComponent models each value as an independent Bernoulli trial
+// with success probability rate
+func forecastComponent(values []float64, rate float64) models.ForecastComponent {
+	var gross float64
+	for _, v := range values {
+		gross += v
+	}
+	expected := gross * rate
+	sigma := math.Sqrt(componentVariance(values, rate))
+
+	return models.ForecastComponent{
+		Count:    len(values),
+		Gross:    roundMoney(gross),
+		Rate:     math.Round(rate*10000) / 10000,
+		Expected: roundMoney(expected),
+		Low:      roundMoney(math.Max(0, expected-forecastZ*sigma)),
+		High:     roundMoney(math.Min(gross, expected+forecastZ*sigma)),
+	}
+}
+
+func componentVariance(values []float64, rate float64) float64 {
+	var variance float64
+	for _, v := range values {
+		variance += v * v * rate * (1 - rate)
+	}
+	return variance
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
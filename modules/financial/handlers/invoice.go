@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateInvoice godoc
+// @Summary Create a new invoice
+// @Description Create an invoice; item totals, subtotal and total are calculated from the items and tax. New invoices are drafts unless a status is sent. Invoices issued in a closed financial period are refused.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param invoice body models.Invoice true "Invoice data (ID and totals will be ignored)"
+// @Success 201 {object} models.Invoice
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Financial period of the issue date is closed"
+// @Failure 500 {object} apierror.Response "Failed to save invoice"
+// @Router /api/v1/financial/invoice [post]
+func CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if err := json.NewDecoder(r.Body).Decode(&invoice); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	invoice.ID = uuid.NewString()
+	if invoice.Status == "" {
+		invoice.Status = models.InvoiceStatusDraft
+	}
+	invoice.CalculateTotals()
+	if err := invoice.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkPeriodOpen(w, r, invoice.IssueDate) {
+		return
+	}
+
+	now := time.Now().UTC()
+	invoice.CreatedAt = now
+	invoice.UpdatedAt = now
+
+	if err := putInvoice(r.Context(), invoice, true); err != nil {
+		http.Error(w, "Failed to save invoice", http.StatusInternalServerError)
+		log.Printf("Error saving invoice: %v", err)
+		return
+	}
+	if invoice.Status == models.InvoiceStatusIssued {
+		webhooks.Publish(r.Context(), webhooks.EventInvoiceIssued, invoice)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// GetAllInvoices godoc
+// @Summary Get all invoices
+// @Description Get the clinic invoices, optionally filtered by patient, status and issue date range
+// @Tags invoices
+// @Produce json
+// @Param patientId query string false "Patient ID"
+// @Param status query string false "Invoice status (draft, issued or cancelled)"
+// @Param from query string false "Start issue date (YYYY-MM-DD)"
+// @Param to query string false "End issue date (YYYY-MM-DD), inclusive"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Invoice
+// @Failure 400 {object} apierror.Response "Invalid filter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve invoices"
+// @Router /api/v1/financial/invoice [get]
+func GetAllInvoices(w http.ResponseWriter, r *http.Request) {
+	input := &dynamodb.ScanInput{TableName: aws.String("Invoices")}
+	var filters []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	query := r.URL.Query()
+	if patientID := query.Get("patientId"); patientID != "" {
+		filters = append(filters, "PatientID = :patientId")
+		values[":patientId"] = &types.AttributeValueMemberS{Value: patientID}
+	}
+	if status := query.Get("status"); status != "" {
+		filters = append(filters, "#status = :status")
+		names["#status"] = "Status"
+		values[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+	if !dateRangeFilter(w, r, "IssueDate", &filters, names, values) {
+		return
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+		if len(names) > 0 {
+			input.ExpressionAttributeNames = names
+		}
+	}
+
+	page := paging.Request(r)
+	invoices, next, err := paging.Scan[models.Invoice](r.Context(), input, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve invoices", http.StatusInternalServerError)
+		log.Printf("Error scanning invoices: %v", err)
+		return
+	}
+
+	paging.Write(w, page, invoices, next)
+}
+
+// GetInvoiceByID godoc
+// @Summary Get an invoice by ID
+// @Description Get an invoice by its ID
+// @Tags invoices
+// @Produce json
+// @Param id path string true "Invoice ID"
+// @Success 200 {object} models.Invoice
+// @Failure 404 {object} apierror.Response "Invoice not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve invoice"
+// @Router /api/v1/financial/invoice/{id} [get]
+func GetInvoiceByID(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := loadInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// UpdateInvoice godoc
+// @Summary Update an invoice
+// @Description Update an invoice by its ID. Only the fields sent are changed and totals are recalculated. Issued invoices only accept a change of status (e.g. to cancel them), and cancelled invoices cannot be changed. Invoices in a closed period, or moved into one, are refused.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param id path string true "Invoice ID"
+// @Param If-Match header string false "Version of the invoice being changed; required unless the body has it"
+// @Param invoice body models.Invoice true "Invoice data"
+// @Success 200 {object} models.Invoice
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Invoice not found"
+// @Failure 409 {object} apierror.Response "Invoice already issued or cancelled, financial period is closed or invoice was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the invoice is required"
+// @Failure 500 {object} apierror.Response "Failed to update invoice"
+// @Router /api/v1/financial/invoice/{id} [put]
+func UpdateInvoice(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Invoices", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	current, ok := loadInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	var updatedData models.Invoice
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	wasIssued := current.Status == models.InvoiceStatusIssued
+	switch current.Status {
+	case models.InvoiceStatusCancelled:
+		http.Error(w, "Invoice is cancelled and cannot be changed", http.StatusConflict)
+		return
+	case models.InvoiceStatusIssued:
+		if updatedData.Status == "" || updatedData.Status == models.InvoiceStatusDraft {
+			http.Error(w, "Invoice is already issued, only its status can be changed", http.StatusConflict)
+			return
+		}
+		current.Status = updatedData.Status
+	default:
+		previousIssueDate := current.IssueDate
+		if updatedData.Number != "" {
+			current.Number = updatedData.Number
+		}
+		if updatedData.Type != "" {
+			current.Type = updatedData.Type
+		}
+		if updatedData.Status != "" {
+			current.Status = updatedData.Status
+		}
+		if updatedData.PatientID != "" {
+			current.PatientID = updatedData.PatientID
+		}
+		if updatedData.PatientName != "" {
+			current.PatientName = updatedData.PatientName
+		}
+		if updatedData.PatientEmail != "" {
+			current.PatientEmail = updatedData.PatientEmail
+		}
+		if len(updatedData.Items) > 0 {
+			current.Items = updatedData.Items
+		}
+		if updatedData.TaxAmount != 0 {
+			current.TaxAmount = updatedData.TaxAmount
+		}
+		if !updatedData.IssueDate.IsZero() {
+			current.IssueDate = updatedData.IssueDate
+		}
+		if !updatedData.DueDate.IsZero() {
+			current.DueDate = updatedData.DueDate
+		}
+		if updatedData.Notes != "" {
+			current.Notes = updatedData.Notes
+		}
+		current.CalculateTotals()
+		if err := current.IsValid(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checkPeriodOpen(w, r, previousIssueDate) {
+			return
+		}
+	}
+	if !checkPeriodOpen(w, r, current.IssueDate) {
+		return
+	}
+	current.UpdatedAt = time.Now().UTC()
+
+	if err := putInvoice(r.Context(), current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update invoice", http.StatusInternalServerError)
+		log.Printf("Error updating invoice: %v", err)
+		return
+	}
+	current.Version = version + 1
+	if !wasIssued && current.Status == models.InvoiceStatusIssued {
+		webhooks.Publish(r.Context(), webhooks.EventInvoiceIssued, current)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteInvoice godoc
+// @Summary Delete an invoice
+// @Description Delete a draft invoice by its ID. Issued invoices are kept for the fiscal record and must be cancelled instead, and invoices under legal hold, themselves or through their patient, are kept.
+// @Tags invoices
+// @Param id path string true "Invoice ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Invoice not found"
+// @Failure 409 {object} apierror.Response "Invoice is not a draft, financial period is closed or invoice is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete invoice"
+// @Router /api/v1/financial/invoice/{id} [delete]
+func DeleteInvoice(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := loadInvoice(w, r)
+	if !ok {
+		return
+	}
+	if invoice.Status != models.InvoiceStatusDraft {
+		http.Error(w, "Only draft invoices can be deleted, cancel it instead", http.StatusConflict)
+		return
+	}
+	if !checkPeriodOpen(w, r, invoice.IssueDate) {
+		return
+	}
+	if !checkLegalHold(w, r, legalhold.RecordInvoice, invoice.ID, invoice.PatientID) {
+		return
+	}
+
+	if !deleteRecord(w, r, "Invoices", invoice.ID, "Invoice") {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadInvoice fetches the invoice of the request path, writing the error response when it cannot be returned
+func loadInvoice(w http.ResponseWriter, r *http.Request) (models.Invoice, bool) {
+	id := mux.Vars(r)["id"]
+	item, err := getRecord(r.Context(), "Invoices", id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve invoice", http.StatusInternalServerError)
+		log.Printf("Error fetching invoice %s: %v", id, err)
+		return models.Invoice{}, false
+	}
+	if item == nil {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return models.Invoice{}, false
+	}
+	var invoice models.Invoice
+	if err := attributevalue.UnmarshalMap(item, &invoice); err != nil {
+		http.Error(w, "Failed to retrieve invoice", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling invoice %s: %v", id, err)
+		return models.Invoice{}, false
+	}
+	return invoice, true
+}
+
+func putInvoice(ctx context.Context, invoice models.Invoice, create bool) error {
+	item, err := attributevalue.MarshalMap(invoice)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	return config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Invoices"),
+		Item:      item,
+	}, create)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/pdf"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// invoiceColumns is the width of the item table of invoice PDFs
+const invoiceColumns = 86
+
+// GetInvoicePDF godoc
+// @Summary Download an invoice as PDF
+// @Description Render an invoice for printing or handing to the patient: the clinic's letterhead (see /api/v1/admin/letterhead), the patient's details, the items and the totals. Drafts and cancelled invoices are marked as such, and so are the invoices of sandbox clinics, which have no fiscal value.
+// @Tags invoices
+// @Produce application/pdf
+// @Param id path string true "Invoice ID"
+// @Success 200 {file} file "Invoice PDF"
+// @Failure 404 {object} apierror.Response "Invoice not found"
+// @Failure 500 {object} apierror.Response "Failed to render invoice"
+// @Router /api/v1/financial/invoice/{id}/pdf [get]
+func GetInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := loadInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	letterhead, err := clinics.GetLetterhead(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to render invoice", http.StatusInternalServerError)
+		log.Printf("Error loading letterhead for invoice %s: %v", invoice.ID, err)
+		return
+	}
+	sandbox, err := config.Sandbox(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to render invoice", http.StatusInternalServerError)
+		log.Printf("Error loading clinic for invoice %s: %v", invoice.ID, err)
+		return
+	}
+
+	// The invoice keeps the patient's name and email as issued; the phone
+	// comes from the patient record, which may have been removed since
+	var patient dentalmodels.Patient
+	item, err := getRecord(config.WithDeleted(r.Context(), true), "Patients", invoice.PatientID)
+	if err != nil {
+		http.Error(w, "Failed to render invoice", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s for invoice %s: %v", invoice.PatientID, invoice.ID, err)
+		return
+	}
+	if item != nil {
+		if err := attributevalue.UnmarshalMap(item, &patient); err != nil {
+			log.Printf("Error unmarshaling patient %s for invoice %s: %v", invoice.PatientID, invoice.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="invoice-%s.pdf"`, invoiceFileName(invoice)))
+	if err := pdf.RenderDocument(w, invoiceDocument(invoice, patient, letterhead, sandbox)); err != nil {
+		log.Printf("Error writing invoice PDF: %v", err)
+	}
+}
+
+// invoiceDocument lays an invoice out as a PDF document. The invoices of
+// sandbox clinics say they are not valid documents.
+func invoiceDocument(invoice models.Invoice, patient dentalmodels.Patient, letterhead clinics.Letterhead, sandbox bool) pdf.Document {
+	title := "Invoice " + invoice.Number
+	switch invoice.Status {
+	case models.InvoiceStatusDraft:
+		title += " (DRAFT)"
+	case models.InvoiceStatusCancelled:
+		title += " (CANCELLED)"
+	}
+	if sandbox {
+		title = "SANDBOX - " + title
+	}
+
+	var lines []string
+	if sandbox {
+		lines = append(lines, "Issued by a sandbox clinic for testing: not a valid fiscal document.", "")
+	}
+	lines = append(lines,
+		fmt.Sprintf("%-12s %s", "Issue date:", invoice.IssueDate.Format("2006-01-02")),
+		fmt.Sprintf("%-12s %s", "Due date:", invoice.DueDate.Format("2006-01-02")),
+		fmt.Sprintf("%-12s %s", "Type:", invoice.Type),
+		"",
+		"Bill to:",
+		"  "+invoice.PatientName,
+	)
+	if invoice.PatientEmail != "" {
+		lines = append(lines, "  "+invoice.PatientEmail)
+	}
+	if patient.Phone != "" {
+		lines = append(lines, "  "+patient.Phone)
+	}
+
+	row := func(description, quantity, unitPrice, total string) string {
+		if runes := []rune(description); len(runes) > 44 {
+			description = string(runes[:43]) + "~"
+		}
+		return fmt.Sprintf("%-44s %8s %15s %15s", description, quantity, unitPrice, total)
+	}
+	lines = append(lines,
+		"",
+		row("Description", "Qty", "Unit price", "Total"),
+		strings.Repeat("-", invoiceColumns),
+	)
+	for _, item := range invoice.Items {
+		lines = append(lines, row(item.Description, fmt.Sprint(item.Quantity), fmt.Sprintf("%.2f", item.UnitPrice), fmt.Sprintf("%.2f", item.TotalPrice)))
+	}
+	total := func(label string, amount float64) string {
+		return fmt.Sprintf("%*s %15.2f", invoiceColumns-16, label, amount)
+	}
+	lines = append(lines,
+		strings.Repeat("-", invoiceColumns),
+		total("Subtotal", invoice.Subtotal),
+		total("Tax", invoice.TaxAmount),
+		total("Total", invoice.TotalAmount),
+	)
+
+	if invoice.Notes != "" {
+		lines = append(lines, "", "Notes:")
+		lines = append(lines, wrapText(invoice.Notes, pdf.MaxColumns-2, "  ")...)
+	}
+	if letterhead.Footer != "" {
+		lines = append(lines, "", letterhead.Footer)
+	}
+
+	return pdf.Document{Letterhead: letterhead.Lines(), Title: title, Lines: lines}
+}
+
+// wrapText breaks text into lines of at most width characters at spaces,
+// each starting with indent
+func wrapText(text string, width int, indent string) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+				lines = append(lines, indent+line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, indent+line)
+	}
+	return lines
+}
+
+// invoiceFileName is the invoice number made safe for a file name, or the ID
+func invoiceFileName(invoice models.Invoice) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, invoice.Number)
+	if name == "" {
+		return invoice.ID
+	}
+	return name
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"dental-saas/shared/legalhold"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// checkLegalHold verifies that a record about to be deleted is not under legal
+// hold, itself or through its patient, writing the error response when it is
+func checkLegalHold(w http.ResponseWriter, r *http.Request, recordType, id, patientID string) bool {
+	err := legalhold.Check(r.Context(), recordType, id, patientID)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, legalhold.ErrHeld) {
+		http.Error(w, "Record is under legal hold and cannot be deleted", http.StatusConflict)
+		return false
+	}
+	http.Error(w, "Failed to check legal holds", http.StatusInternalServerError)
+	log.Printf("Error checking legal hold of %s %s: %v", recordType, id, err)
+	return false
+}
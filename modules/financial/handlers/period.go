@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/config"
+	"dental-saas/shared/inbox"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetPeriods godoc
+// @Summary List closed financial periods
+// @Description List the months closed by the accountant with the totals recorded when they were closed, most recent first
+// @Tags periods
+// @Produce json
+// @Success 200 {array} models.Period
+// @Failure 500 {object} apierror.Response "Failed to retrieve periods"
+// @Router /api/v1/financial/period [get]
+func GetPeriods(w http.ResponseWriter, r *http.Request) {
+	list, err := periods.List(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve periods", http.StatusInternalServerError)
+		log.Printf("Error listing financial periods: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetPeriod godoc
+// @Summary Get a financial period
+// @Description Get the status of a month with its revenue, expense and invoice totals: those recorded at closing, or the current ones while it is open
+// @Tags periods
+// @Produce json
+// @Param month path string true "Month (YYYY-MM)"
+// @Success 200 {object} models.Period
+// @Failure 400 {object} apierror.Response "Invalid month"
+// @Failure 500 {object} apierror.Response "Failed to retrieve period"
+// @Router /api/v1/financial/period/{month} [get]
+func GetPeriod(w http.ResponseWriter, r *http.Request) {
+	month := mux.Vars(r)["month"]
+	if _, err := models.ParseMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	period, err := periods.Get(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to retrieve period", http.StatusInternalServerError)
+		log.Printf("Error fetching financial period %s: %v", month, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(period)
+}
+
+// ClosePeriod godoc
+// @Summary Close a financial period
+// @Description Lock the revenues, expenses and invoices of a month that has ended, recording its totals. Records booked in a closed month can no longer be created, changed or deleted; corrections are recorded as adjusting entries in the open period.
+// @Tags periods
+// @Accept json
+// @Produce json
+// @Param month path string true "Month (YYYY-MM)"
+// @Param X-User-ID header string false "Accountant closing the period"
+// @Param request body models.PeriodCloseRequest false "Closing notes"
+// @Success 200 {object} models.Period
+// @Failure 400 {object} apierror.Response "Invalid month or the month has not ended"
+// @Failure 409 {object} apierror.Response "Period already closed"
+// @Failure 500 {object} apierror.Response "Failed to close period"
+// @Router /api/v1/financial/period/{month}/close [post]
+func ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	month := mux.Vars(r)["month"]
+	if _, err := models.ParseMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req models.PeriodCloseRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	period, err := periods.Close(r.Context(), month, inbox.User(r), req.Notes)
+	if err != nil {
+		switch {
+		case errors.Is(err, periods.ErrNotEnded):
+			http.Error(w, "Only months that have ended can be closed", http.StatusBadRequest)
+		case errors.Is(err, periods.ErrAlreadyClosed):
+			http.Error(w, "Period already closed", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to close period", http.StatusInternalServerError)
+			log.Printf("Error closing financial period %s: %v", month, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(period)
+}
+
+// CreateAdjustment godoc
+// @Summary Record an adjusting entry for a closed period
+// @Description Correct a closed month with a revenue or expense booked today, in the open period, referencing the closed month and optionally the corrected record. The amount may be negative. Revenue adjustments copy the patient and payment method of the corrected revenue.
+// @Tags periods
+// @Accept json
+// @Produce json
+// @Param month path string true "Closed month being corrected (YYYY-MM)"
+// @Param adjustment body models.AdjustmentRequest true "Adjusting entry"
+// @Success 201 {object} object "The revenue or expense created"
+// @Failure 400 {object} apierror.Response "Invalid request body or record outside the month"
+// @Failure 404 {object} apierror.Response "Record not found"
+// @Failure 409 {object} apierror.Response "Period is open"
+// @Failure 500 {object} apierror.Response "Failed to record adjustment"
+// @Router /api/v1/financial/period/{month}/adjustment [post]
+func CreateAdjustment(w http.ResponseWriter, r *http.Request) {
+	month := mux.Vars(r)["month"]
+	if _, err := models.ParseMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req models.AdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	closed, err := periods.IsClosed(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to record adjustment", http.StatusInternalServerError)
+		log.Printf("Error checking financial period %s: %v", month, err)
+		return
+	}
+	if !closed {
+		http.Error(w, "Period is open, change its records directly", http.StatusConflict)
+		return
+	}
+
+	// The entry is booked today, so the services refuse it while the
+	// current month is closed
+	now := time.Now().UTC()
+	var entry interface{}
+	switch req.Type {
+	case models.AdjustmentTypeRevenue:
+		original, err := Revenues.Get(r.Context(), req.RecordID)
+		if err != nil {
+			writeServiceError(w, r, err, "Record", "Failed to record adjustment")
+			return
+		}
+		if periods.Month(original.DueDate) != month {
+			http.Error(w, fmt.Sprintf("Revenue %s is not booked in %s", original.ID, month), http.StatusBadRequest)
+			return
+		}
+		entry, err = Revenues.Create(r.Context(), models.Revenue{
+			Description:   req.Description,
+			Amount:        req.Amount,
+			PatientID:     original.PatientID,
+			ProcedureID:   original.ProcedureID,
+			PaymentMethod: original.PaymentMethod,
+			PaymentStatus: original.PaymentStatus,
+			DueDate:       now,
+			AdjustsPeriod: month,
+			AdjustsID:     original.ID,
+		})
+		if err != nil {
+			writeServiceError(w, r, err, "Record", "Failed to record adjustment")
+			return
+		}
+	case models.AdjustmentTypeExpense:
+		expense := models.Expense{
+			Description:   req.Description,
+			Amount:        req.Amount,
+			Category:      models.ExpenseCategoryOther,
+			Date:          now,
+			Status:        models.ExpenseStatusApproved,
+			AdjustsPeriod: month,
+		}
+		if req.RecordID != "" {
+			original, err := Expenses.Get(r.Context(), req.RecordID)
+			if err != nil {
+				writeServiceError(w, r, err, "Record", "Failed to record adjustment")
+				return
+			}
+			if periods.Month(original.Date) != month {
+				http.Error(w, fmt.Sprintf("Expense %s is not booked in %s", original.ID, month), http.StatusBadRequest)
+				return
+			}
+			expense.Category = original.Category
+			expense.Supplier = original.Supplier
+			expense.AdjustsID = original.ID
+		}
+		entry, err = Expenses.Create(r.Context(), expense)
+		if err != nil {
+			writeServiceError(w, r, err, "Record", "Failed to record adjustment")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// checkPeriodOpen writes a 409 when any of the dates falls in a closed
+// financial period. Every handler writing revenues, expenses or invoices
+// calls it with the dates the record is booked on, before and after the change.
+func checkPeriodOpen(w http.ResponseWriter, r *http.Request, dates ...time.Time) bool {
+	if err := periods.CheckOpen(r.Context(), dates...); err != nil {
+		if errors.Is(err, periods.ErrClosed) {
+			apierror.Write(w, r, http.StatusConflict, apierror.CodePeriodClosed, err.Error(), nil)
+			return false
+		}
+		http.Error(w, "Failed to check financial period", http.StatusInternalServerError)
+		log.Printf("Error checking financial periods: %v", err)
+		return false
+	}
+	return true
+}
+
+func getRecord(ctx context.Context, table, id string) (map[string]types.AttributeValue, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Item, nil
+}
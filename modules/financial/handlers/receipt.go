@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/ocr"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const maxReceiptSize = 10 << 20
+
+var (
+	ocrProvider     ocr.Provider
+	ocrProviderErr  error
+	ocrProviderOnce sync.Once
+)
+
+func getOCRProvider() (ocr.Provider, error) {
+	ocrProviderOnce.Do(func() {
+		ocrProvider, ocrProviderErr = ocr.NewProviderFromEnv()
+	})
+	return ocrProvider, ocrProviderErr
+}
+
+// CreateExpenseFromReceipt godoc
+// @Summary Draft an expense from a receipt photo
+// @Description Run a receipt image through OCR and return a prefilled expense draft for confirmation. The draft is not saved. PDF receipts are only read with OCR_PROVIDER=textract.
+// @Tags expenses
+// @Accept multipart/form-data
+// @Produce json
+// @Param receipt formData file true "Receipt image"
+// @Success 200 {object} models.ExpenseDraft
+// @Failure 400 {object} apierror.Response "Invalid receipt image, or a PDF the OCR provider cannot read"
+// @Failure 502 {object} apierror.Response "Failed to read receipt"
+// @Failure 503 {object} apierror.Response "OCR provider not available"
+// @Router /api/v1/financial/expense/from-receipt [post]
+func CreateExpenseFromReceipt(w http.ResponseWriter, r *http.Request) {
+	image, err := readReceiptImage(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	provider, err := getOCRProvider()
+	if err != nil {
+		http.Error(w, "OCR provider not available", http.StatusServiceUnavailable)
+		log.Printf("Error initializing OCR provider: %v", err)
+		return
+	}
+
+	text, err := provider.ExtractText(r.Context(), image)
+	if errors.Is(err, ocr.ErrUnsupportedFormat) {
+		http.Error(w, "The OCR provider cannot read PDF receipts; send a photo of the receipt instead", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read receipt", http.StatusBadGateway)
+		log.Printf("Error extracting receipt text: %v", err)
+		return
+	}
+
+	data := ocr.ParseReceipt(text)
+	draft := models.ExpenseDraft{
+		Expense: models.Expense{
+			Amount:   data.Amount,
+			Category: models.ExpenseCategoryOther,
+			Date:     data.Date,
+			Supplier: data.Supplier,
+		},
+		RawText: text,
+	}
+	if data.Supplier != "" {
+		draft.Expense.Description = fmt.Sprintf("Receipt from %s", data.Supplier)
+	}
+
+	if draft.Expense.Amount <= 0 {
+		draft.MissingFields = append(draft.MissingFields, "amount")
+	}
+	if draft.Expense.Date.IsZero() {
+		draft.MissingFields = append(draft.MissingFields, "date")
+	}
+	if draft.Expense.Supplier == "" {
+		draft.MissingFields = append(draft.MissingFields, "supplier")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(draft)
+}
+
+// readReceiptImage accepts either a multipart "receipt" file or a raw image body
+func readReceiptImage(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxReceiptSize)
+
+	var image []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, ferr := r.FormFile("receipt")
+		if ferr != nil {
+			return nil, fmt.Errorf("receipt file is required")
+		}
+		defer file.Close()
+		image, err = io.ReadAll(file)
+	} else {
+		image, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid receipt image")
+	}
+	if len(image) == 0 {
+		return nil, fmt.Errorf("receipt image is empty")
+	}
+
+	contentType := http.DetectContentType(image)
+	if !strings.HasPrefix(contentType, "image/") && contentType != "application/pdf" {
+		return nil, fmt.Errorf("unsupported receipt type %s", contentType)
+	}
+
+	return image, nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetOverdueRevenues godoc
+// @Summary List overdue revenues
+// @Description Pending revenues whose due date has passed, for collection: each with the patient's name, email and phone, the days since it was due and the amount still outstanding (the unpaid splits of split revenues). Due dates are compared by UTC day, so a revenue is overdue from the day after it was due.
+// @Tags revenues
+// @Produce json
+// @Param patientId query string false "Patient ID"
+// @Param minDays query int false "Only revenues overdue by at least this many days (default 1)"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.OverdueRevenue
+// @Failure 400 {object} apierror.Response "Invalid minDays"
+// @Failure 500 {object} apierror.Response "Failed to retrieve overdue revenues"
+// @Router /api/v1/financial/revenue/overdue [get]
+func GetOverdueRevenues(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	minDays := 1
+	if v := query.Get("minDays"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			http.Error(w, "minDays must be a positive number of days", http.StatusBadRequest)
+			return
+		}
+		minDays = days
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	filter := "PaymentStatus = :pending AND DueDate < :cutoff"
+	values := map[string]types.AttributeValue{
+		":pending": &types.AttributeValueMemberS{Value: string(models.PaymentStatusPending)},
+		":cutoff":  &types.AttributeValueMemberS{Value: today.AddDate(0, 0, 1-minDays).Format("2006-01-02")},
+	}
+	if patientID := query.Get("patientId"); patientID != "" {
+		filter += " AND PatientID = :patientId"
+		values[":patientId"] = &types.AttributeValueMemberS{Value: patientID}
+	}
+
+	page := paging.Request(r)
+	revenues, next, err := paging.Scan[models.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName:                 aws.String("Revenues"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+	}, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve overdue revenues", http.StatusInternalServerError)
+		log.Printf("Error scanning overdue revenues: %v", err)
+		return
+	}
+
+	// Patients who have since been removed still owe what they owe
+	ctx := config.WithDeleted(r.Context(), true)
+	patients := map[string]*dentalmodels.Patient{}
+	overdue := make([]models.OverdueRevenue, 0, len(revenues))
+	for _, revenue := range revenues {
+		patient, seen := patients[revenue.PatientID]
+		if !seen {
+			item, err := getRecord(ctx, "Patients", revenue.PatientID)
+			if err != nil {
+				http.Error(w, "Failed to retrieve overdue revenues", http.StatusInternalServerError)
+				log.Printf("Error fetching patient %s of overdue revenue %s: %v", revenue.PatientID, revenue.ID, err)
+				return
+			}
+			if item != nil {
+				patient = &dentalmodels.Patient{}
+				if err := attributevalue.UnmarshalMap(item, patient); err != nil {
+					log.Printf("Error unmarshaling patient %s: %v", revenue.PatientID, err)
+					patient = nil
+				}
+			}
+			patients[revenue.PatientID] = patient
+		}
+
+		entry := models.OverdueRevenue{
+			Revenue:     revenue,
+			DaysOverdue: int(today.Sub(revenue.DueDate.UTC().Truncate(24*time.Hour)).Hours() / 24),
+			Outstanding: revenue.Unpaid(),
+		}
+		if patient != nil {
+			entry.PatientName = patient.Name
+			entry.PatientEmail = patient.Email
+			entry.PatientPhone = patient.Phone
+		}
+		overdue = append(overdue, entry)
+	}
+
+	paging.Write(w, page, overdue, next)
+}
+
+// PayRevenue godoc
+// @Summary Record the payment of a revenue
+// @Description Mark a pending revenue as paid in full with the payment method, on the date given or now. Revenues split between payers are paid split by split, and prepaid credit is applied through apply-credit.
+// @Tags revenues
+// @Accept json
+// @Produce json
+// @Param id path string true "Revenue ID"
+// @Param payment body models.RevenuePaymentRequest true "Payment method and optional paid date"
+// @Success 200 {object} models.Revenue
+// @Failure 400 {object} apierror.Response "Invalid request body or payment method"
+// @Failure 404 {object} apierror.Response "Revenue not found"
+// @Failure 409 {object} apierror.Response "Revenue is not pending, is split, is in a closed period or was changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to record payment"
+// @Router /api/v1/financial/revenue/{id}/pay [post]
+func PayRevenue(w http.ResponseWriter, r *http.Request) {
+	var payment models.RevenuePaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revenue, err := Revenues.Pay(r.Context(), mux.Vars(r)["id"], payment)
+	if err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to record payment")
+		return
+	}
+	revenue.Version++
+	webhooks.Publish(r.Context(), webhooks.EventRevenuePaid, revenue)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revenue)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateRevenue godoc
+// @Summary Create a new revenue
+// @Description Record an amount to be received from a patient. Revenues due in a closed financial period are refused; record an adjusting entry instead. Credit and payer splits are applied through their own endpoints.
+// @Tags revenues
+// @Accept json
+// @Produce json
+// @Param revenue body models.Revenue true "Revenue data (ID will be ignored)"
+// @Success 201 {object} models.Revenue
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 409 {object} apierror.Response "Financial period of the due date is closed"
+// @Failure 500 {object} apierror.Response "Failed to save revenue"
+// @Router /api/v1/financial/revenue [post]
+func CreateRevenue(w http.ResponseWriter, r *http.Request) {
+	var revenue models.Revenue
+	if err := json.NewDecoder(r.Body).Decode(&revenue); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	revenue.ID = ""
+	// Adjusting entries are only created through the period endpoints
+	revenue.AdjustsPeriod = ""
+	revenue.AdjustsID = ""
+	revenue.CreditApplied = 0
+	revenue.Splits = nil
+
+	revenue, err := Revenues.Create(r.Context(), revenue)
+	if err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to save revenue")
+		return
+	}
+	if revenue.PaymentStatus == models.PaymentStatusPaid {
+		webhooks.Publish(r.Context(), webhooks.EventRevenuePaid, revenue)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(revenue)
+}
+
+// GetAllRevenues godoc
+// @Summary Get all revenues
+// @Description Get the clinic revenues, optionally filtered by patient, payment status and due date range
+// @Tags revenues
+// @Produce json
+// @Param patientId query string false "Patient ID"
+// @Param status query string false "Payment status (pending, paid, cancelled or refunded)"
+// @Param from query string false "Start due date (YYYY-MM-DD)"
+// @Param to query string false "End due date (YYYY-MM-DD), inclusive"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.Revenue
+// @Failure 400 {object} apierror.Response "Invalid filter"
+// @Failure 500 {object} apierror.Response "Failed to retrieve revenues"
+// @Router /api/v1/financial/revenue [get]
+func GetAllRevenues(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repository.RevenueFilter{
+		PatientID: query.Get("patientId"),
+		Status:    models.PaymentStatus(query.Get("status")),
+	}
+	dueDate, ok := requestDateRange(w, r)
+	if !ok {
+		return
+	}
+	filter.DueDate = dueDate
+
+	page := paging.Request(r)
+	revenues, next, err := Revenues.List(r.Context(), filter, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve revenues", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues: %v", err)
+		return
+	}
+
+	paging.Write(w, page, revenues, next)
+}
+
+// GetRevenueByID godoc
+// @Summary Get a revenue by ID
+// @Description Get a revenue by its ID
+// @Tags revenues
+// @Produce json
+// @Param id path string true "Revenue ID"
+// @Success 200 {object} models.Revenue
+// @Failure 404 {object} apierror.Response "Revenue not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve revenue"
+// @Router /api/v1/financial/revenue/{id} [get]
+func GetRevenueByID(w http.ResponseWriter, r *http.Request) {
+	revenue, err := Revenues.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to retrieve revenue")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revenue)
+}
+
+// UpdateRevenue godoc
+// @Summary Update a revenue
+// @Description Update a revenue by its ID. Only the fields sent are changed; marking it paid without a paid date records the current time. The amount and payment status of a revenue split between payers are managed through its splits. Revenues in a closed period, or moved into one, are refused.
+// @Tags revenues
+// @Accept json
+// @Produce json
+// @Param id path string true "Revenue ID"
+// @Param If-Match header string false "Version of the revenue being changed; required unless the body has it"
+// @Param revenue body models.Revenue true "Revenue data"
+// @Success 200 {object} models.Revenue
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Revenue not found"
+// @Failure 409 {object} apierror.Response "Financial period is closed, revenue is split or was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the revenue is required"
+// @Failure 500 {object} apierror.Response "Failed to update revenue"
+// @Router /api/v1/financial/revenue/{id} [put]
+func UpdateRevenue(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Revenues", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var updatedData models.Revenue
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revenue, previous, err := Revenues.Update(r.Context(), mux.Vars(r)["id"], updatedData)
+	if err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to update revenue")
+		return
+	}
+	revenue.Version = version + 1
+	if previous.PaymentStatus != models.PaymentStatusPaid && revenue.PaymentStatus == models.PaymentStatusPaid {
+		webhooks.Publish(r.Context(), webhooks.EventRevenuePaid, revenue)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revenue)
+}
+
+// DeleteRevenue godoc
+// @Summary Delete a revenue
+// @Description Delete a revenue by its ID. Revenues in a closed period are kept, as are revenues paid in part with prepaid credit, so the credit ledger stays consistent, and revenues under legal hold, themselves or through their patient.
+// @Tags revenues
+// @Param id path string true "Revenue ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Revenue not found"
+// @Failure 409 {object} apierror.Response "Financial period is closed, credit was applied or revenue is under legal hold"
+// @Failure 500 {object} apierror.Response "Failed to delete revenue"
+// @Router /api/v1/financial/revenue/{id} [delete]
+func DeleteRevenue(w http.ResponseWriter, r *http.Request) {
+	if err := Revenues.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to delete revenue")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/periods"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/modules/financial/service"
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/versioning"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Revenues and Expenses are the services behind the handlers of those
+// records, stored in DynamoDB and checked against the closed financial
+// periods and, for revenue deletes, the legal holds. Tests and alternate backends replace them before the router
+// serves requests.
+var (
+	Revenues service.RevenueService = service.NewRevenueService(repository.DynamoRevenues{}, service.PeriodsFunc(periods.CheckOpen), service.HoldsFunc(legalhold.Check))
+	Expenses service.ExpenseService = service.NewExpenseService(repository.DynamoExpenses{}, service.PeriodsFunc(periods.CheckOpen))
+)
+
+// writeServiceError writes the response for an error returned by a service:
+// 400 for validation errors, 404 for a missing record of the entity, 409 for
+// legal holds, closed periods, version conflicts and payments the revenue's
+// state refuses, and failure (logged) otherwise
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error, entity, failure string) {
+	var validation *service.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		http.Error(w, validation.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, entity+" not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrSplitNotFound):
+		http.Error(w, "Split not found", http.StatusNotFound)
+	case errors.Is(err, legalhold.ErrHeld):
+		http.Error(w, "Record is under legal hold and cannot be deleted", http.StatusConflict)
+	case errors.Is(err, periods.ErrClosed):
+		apierror.Write(w, r, http.StatusConflict, apierror.CodePeriodClosed, err.Error(), nil)
+	case versioning.Conflict(w, r, err):
+	case errors.Is(err, service.ErrNotPending):
+		http.Error(w, "Revenue is not pending", http.StatusConflict)
+	case errors.Is(err, service.ErrSplit):
+		http.Error(w, "Revenue is split between payers; update or pay its splits instead", http.StatusConflict)
+	case errors.Is(err, service.ErrPaidSplits):
+		http.Error(w, "Revenue has paid splits and can no longer be re-split", http.StatusConflict)
+	case errors.Is(err, service.ErrSplitNotPending):
+		http.Error(w, "Split is not pending", http.StatusConflict)
+	case errors.Is(err, service.ErrCreditApplied):
+		http.Error(w, "Revenue has prepaid credit applied and cannot be deleted", http.StatusConflict)
+	default:
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("%s: %v", failure, err)
+	}
+}
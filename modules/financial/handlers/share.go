@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/reportlinks"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// sharedReport is a report that can be shared by link: its handler, the path
+// variable it reads, if any, and the query parameters a link may set
+type sharedReport struct {
+	handler http.HandlerFunc
+	pathVar string
+	query   []string
+}
+
+// sharedReports are the reports that can be shared, by the name links use
+var sharedReports = map[string]sharedReport{
+	"period":       {handler: GetPeriod, pathVar: "month"},
+	"forecast":     {handler: GetRevenueForecast, query: []string{"from", "to", "history_days"}},
+	"top-patients": {handler: GetTopPatients, query: []string{"from", "to", "sort", "limit", "format"}},
+	"statement":    {handler: GetPatientStatement, pathVar: "id", query: []string{"from", "to", "format"}},
+}
+
+// checkShareParams checks the parameters of a report to be shared: the path
+// variable is required, and only the parameters the report reads are allowed
+func checkShareParams(report sharedReport, params map[string]string) error {
+	if report.pathVar != "" && params[report.pathVar] == "" {
+		return fmt.Errorf("params.%s is required", report.pathVar)
+	}
+	for name := range params {
+		if name != report.pathVar && !slices.Contains(report.query, name) {
+			return fmt.Errorf("params.%s is not a parameter of this report", name)
+		}
+	}
+	if report.pathVar == "month" {
+		if _, err := models.ParseMonth(params["month"]); err != nil {
+			return err
+		}
+	}
+	query := make(url.Values)
+	for _, name := range []string{"from", "to"} {
+		query.Set(name, params[name])
+		if _, _, err := parseDateParam(query, name); err != nil {
+			return fmt.Errorf("params.%w", err)
+		}
+	}
+	return nil
+}
+
+// ShareReport godoc
+// @Summary Share a report by link
+// @Description Create a signed link giving read-only access to a single report, such as the month's period totals for an external accountant, without an account. The link is the report with the given parameters only: the period of a month (params.month), the revenue forecast, the top patients ranking or a patient statement (params.id), with the query parameters of those endpoints. Links last 7 days unless other days are asked for, at most REPORT_LINK_MAX_TTL, and every share is recorded in the audit log.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param request body models.ShareReportRequest true "Report, parameters and days the link lasts"
+// @Success 201 {object} models.SharedReportLink
+// @Failure 400 {object} apierror.Response "Invalid request body or parameters"
+// @Failure 500 {object} apierror.Response "Failed to share report"
+// @Router /api/v1/financial/reports/share [post]
+func ShareReport(w http.ResponseWriter, r *http.Request) {
+	var req models.ShareReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, ok := sharedReports[req.Report]
+	if !ok {
+		http.Error(w, "report must be period, forecast, top-patients or statement", http.StatusBadRequest)
+		return
+	}
+	if err := checkShareParams(report, req.Params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl := min(reportlinks.DefaultTTL, reportlinks.MaxTTL())
+	if req.Days > 0 {
+		ttl = time.Duration(req.Days) * 24 * time.Hour
+	}
+	if max := reportlinks.MaxTTL(); ttl > max {
+		http.Error(w, fmt.Sprintf("days must be at most %d", int(max.Hours()/24)), http.StatusBadRequest)
+		return
+	}
+
+	link := reportlinks.Link{
+		ID:        uuid.NewString(),
+		Report:    req.Report,
+		Params:    req.Params,
+		ClinicID:  config.ClinicID(r.Context()),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	token, err := reportlinks.Token(link)
+	if err != nil {
+		http.Error(w, "Failed to share report", http.StatusInternalServerError)
+		log.Printf("Error signing link of report %s: %v", link.Report, err)
+		return
+	}
+	expiresAt := link.Expires().Format(time.RFC3339)
+
+	if err := config.RecordAuditEvent(r.Context(), link.ClinicID, "reports", link.ID, config.AuditShared, map[string]interface{}{
+		"report":     link.Report,
+		"params":     link.Params,
+		"expires_at": expiresAt,
+	}); err != nil {
+		log.Printf("Error recording share of report %s in the audit log: %v", link.Report, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.SharedReportLink{
+		ID:        link.ID,
+		Report:    link.Report,
+		Params:    link.Params,
+		URL:       reportlinks.URL(token),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// GetSharedReport godoc
+// @Summary Get a shared report
+// @Description Public endpoint behind the links created by ShareReport. It returns the shared report of the clinic that shared it, run with the link's parameters; query parameters of the request are ignored. The response is that of the report's own endpoint.
+// @Tags reports
+// @Produce json
+// @Param token path string true "Token from the shared link"
+// @Success 200 {object} object "The shared report"
+// @Failure 403 {object} apierror.Response "Invalid link"
+// @Failure 410 {object} apierror.Response "Link expired"
+// @Router /api/v1/financial/shared/{token} [get]
+func GetSharedReport(w http.ResponseWriter, r *http.Request) {
+	link, err := reportlinks.Verify(mux.Vars(r)["token"])
+	if errors.Is(err, reportlinks.ErrExpiredLink) {
+		http.Error(w, "Link expired", http.StatusGone)
+		return
+	}
+	report, ok := sharedReports[link.Report]
+	if err != nil || !ok {
+		http.Error(w, "Invalid link", http.StatusForbidden)
+		return
+	}
+
+	shared := r.WithContext(config.WithClinic(r.Context(), link.ClinicID))
+	shared.URL = new(url.URL)
+	*shared.URL = *r.URL
+	query := make(url.Values)
+	for _, name := range report.query {
+		if v, ok := link.Params[name]; ok {
+			query.Set(name, v)
+		}
+	}
+	shared.URL.RawQuery = query.Encode()
+	vars := map[string]string{}
+	if report.pathVar != "" {
+		vars[report.pathVar] = link.Params[report.pathVar]
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	report.handler(w, mux.SetURLVars(shared, vars))
+}
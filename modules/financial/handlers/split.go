@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/webhooks"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SetRevenueSplits godoc
+// @Summary Split a revenue between payers
+// @Description Split the amount due of a pending revenue between payers (patient, insurance carrier, guardian), each paid and tracked separately. The splits must add up to the amount due; an empty list removes the split. A revenue can no longer be re-split once any split is paid.
+// @Tags revenue
+// @Accept json
+// @Produce json
+// @Param id path string true "Revenue ID"
+// @Param splits body models.RevenueSplitRequest true "Payer, payer name and amount of each split"
+// @Success 200 {object} models.Revenue
+// @Failure 400 {object} apierror.Response "Invalid request body or splits"
+// @Failure 404 {object} apierror.Response "Revenue not found"
+// @Failure 409 {object} apierror.Response "Revenue is not pending, has paid splits, is in a closed period or was changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to split revenue"
+// @Router /api/v1/financial/revenue/{id}/splits [put]
+func SetRevenueSplits(w http.ResponseWriter, r *http.Request) {
+	var req models.RevenueSplitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revenue, err := Revenues.SetSplits(r.Context(), mux.Vars(r)["id"], req.Splits)
+	if err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to split revenue")
+		return
+	}
+	revenue.Version++
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revenue)
+}
+
+// PayRevenueSplit godoc
+// @Summary Record the payment of a revenue split
+// @Description Mark one payer's split of a revenue as paid. The revenue becomes paid, on the date of the last payment, once every split is paid.
+// @Tags revenue
+// @Accept json
+// @Produce json
+// @Param id path string true "Revenue ID"
+// @Param splitId path string true "Split ID"
+// @Param payment body models.SplitPayment true "Payment method and optional payment date"
+// @Success 200 {object} models.Revenue
+// @Failure 400 {object} apierror.Response "Invalid request body or missing payment method"
+// @Failure 404 {object} apierror.Response "Revenue or split not found"
+// @Failure 409 {object} apierror.Response "Split is not pending, or revenue is in a closed period or was changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to record split payment"
+// @Router /api/v1/financial/revenue/{id}/splits/{splitId}/pay [post]
+func PayRevenueSplit(w http.ResponseWriter, r *http.Request) {
+	var payment models.SplitPayment
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	revenue, err := Revenues.PaySplit(r.Context(), vars["id"], vars["splitId"], payment)
+	if err != nil {
+		writeServiceError(w, r, err, "Revenue", "Failed to record split payment")
+		return
+	}
+	revenue.Version++
+	// Paying the last split pays the revenue
+	if revenue.PaymentStatus == models.PaymentStatusPaid {
+		webhooks.Publish(r.Context(), webhooks.EventRevenuePaid, revenue)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revenue)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/pdf"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gorilla/mux"
+)
+
+// GetPatientStatement godoc
+// @Summary Get a patient statement
+// @Description Itemized statement of a patient's charges, payments and adjustments with the running balance, optionally within a date range. Activity before "from" is carried into the opening balance. Use format=pdf (or Accept: application/pdf) to download it as a PDF, e.g. for reimbursement claims.
+// @Tags reports
+// @Produce json
+// @Produce application/pdf
+// @Param id path string true "Patient ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param format query string false "Response format: json (default) or pdf"
+// @Success 200 {object} models.PatientStatement
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 404 {object} apierror.Response "Patient not found"
+// @Failure 500 {object} apierror.Response "Failed to build patient statement"
+// @Router /api/v1/financial/patient/{id}/statement [get]
+func GetPatientStatement(w http.ResponseWriter, r *http.Request) {
+	patientID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	from, hasFrom, err := parseDateParam(query, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, hasTo, err := parseDateParam(query, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hasFrom && hasTo && to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	item, err := getRecord(r.Context(), "Patients", patientID)
+	if err != nil {
+		http.Error(w, "Failed to build patient statement", http.StatusInternalServerError)
+		log.Printf("Error fetching patient %s for statement: %v", patientID, err)
+		return
+	}
+	if item == nil {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+	var patient dentalmodels.Patient
+	if err := attributevalue.UnmarshalMap(item, &patient); err != nil {
+		http.Error(w, "Failed to build patient statement", http.StatusInternalServerError)
+		log.Printf("Error unmarshaling patient %s: %v", patientID, err)
+		return
+	}
+
+	revenues, err := paging.ScanAll[models.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("PatientID = :patientId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":patientId": &types.AttributeValueMemberS{Value: patientID},
+		},
+	})
+	if err != nil {
+		http.Error(w, "Failed to build patient statement", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues for patient statement: %v", err)
+		return
+	}
+
+	statement := models.PatientStatement{
+		PatientID:    patient.ID,
+		PatientName:  patient.Name,
+		PatientEmail: patient.Email,
+		Entries:      []models.StatementEntry{},
+	}
+	if hasFrom {
+		statement.From = from.Format("2006-01-02")
+	}
+	if hasTo {
+		statement.To = to.Format("2006-01-02")
+	}
+
+	var balance float64
+	for _, entry := range statementEntries(revenues) {
+		balance = roundMoney(balance + entry.Amount)
+		if hasFrom && entry.Date < statement.From {
+			statement.OpeningBalance = balance
+			continue
+		}
+		if hasTo && entry.Date > statement.To {
+			break
+		}
+		entry.Balance = balance
+		switch entry.Type {
+		case models.StatementEntryCharge:
+			statement.Charges += entry.Amount
+		case models.StatementEntryPayment:
+			statement.Payments -= entry.Amount
+		case models.StatementEntryAdjustment:
+			statement.Adjustments += entry.Amount
+		}
+		statement.Entries = append(statement.Entries, entry)
+	}
+	statement.Charges = roundMoney(statement.Charges)
+	statement.Payments = roundMoney(statement.Payments)
+	statement.Adjustments = roundMoney(statement.Adjustments)
+	statement.ClosingBalance = roundMoney(statement.OpeningBalance + statement.Charges - statement.Payments + statement.Adjustments)
+
+	if query.Get("format") == "pdf" || strings.Contains(r.Header.Get("Accept"), "application/pdf") {
+		writeStatementPDF(w, statement)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statement)
+}
+
+// statementEntries turns a patient's revenues into dated statement lines in
+// chronological order, without balances. Cancelled revenues are left out;
+// refunded ones are charged and then reversed.
+func statementEntries(revenues []models.Revenue) []models.StatementEntry {
+	sort.Slice(revenues, func(i, j int) bool {
+		if !revenues[i].DueDate.Equal(revenues[j].DueDate) {
+			return revenues[i].DueDate.Before(revenues[j].DueDate)
+		}
+		return revenues[i].CreatedAt.Before(revenues[j].CreatedAt)
+	})
+
+	day := func(t time.Time) string { return t.UTC().Format("2006-01-02") }
+
+	var entries []models.StatementEntry
+	for _, revenue := range revenues {
+		if revenue.PaymentStatus == models.PaymentStatusCancelled {
+			continue
+		}
+
+		charge := models.StatementEntry{
+			Date:        day(revenue.DueDate),
+			Type:        models.StatementEntryCharge,
+			Description: revenue.Description,
+			RevenueID:   revenue.ID,
+			Amount:      revenue.Amount,
+		}
+		if revenue.AdjustsPeriod != "" {
+			charge.Type = models.StatementEntryAdjustment
+			charge.Description = fmt.Sprintf("%s (adjusts %s)", revenue.Description, revenue.AdjustsPeriod)
+		}
+		entries = append(entries, charge)
+
+		if revenue.PaymentStatus == models.PaymentStatusRefunded {
+			entries = append(entries, models.StatementEntry{
+				Date:        day(revenue.UpdatedAt),
+				Type:        models.StatementEntryAdjustment,
+				Description: "Refund: " + revenue.Description,
+				RevenueID:   revenue.ID,
+				Amount:      -revenue.Amount,
+			})
+			continue
+		}
+
+		for _, payment := range revenue.Payments() {
+			description := "Payment: " + revenue.Description
+			switch {
+			case payment.Method == models.PaymentMethodCredit:
+				description = "Prepaid credit: " + revenue.Description
+			case payment.Payer != models.PayerPatient:
+				description = fmt.Sprintf("Payment (%s): %s", payment.Payer, revenue.Description)
+			}
+			entries = append(entries, models.StatementEntry{
+				Date:          day(payment.Date),
+				Type:          models.StatementEntryPayment,
+				Description:   description,
+				RevenueID:     revenue.ID,
+				PaymentMethod: payment.Method,
+				Amount:        -payment.Amount,
+			})
+		}
+	}
+
+	// a payment can come after later charges, so order by date keeping each
+	// revenue's charge ahead of its payments
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date < entries[j].Date
+	})
+	return entries
+}
+
+func writeStatementPDF(w http.ResponseWriter, statement models.PatientStatement) {
+	period := "All activity"
+	switch {
+	case statement.From != "" && statement.To != "":
+		period = statement.From + " to " + statement.To
+	case statement.From != "":
+		period = "From " + statement.From
+	case statement.To != "":
+		period = "Until " + statement.To
+	}
+
+	row := func(date, description, entryType, amount string, balance float64) string {
+		if runes := []rune(description); len(runes) > 38 {
+			description = string(runes[:37]) + "~"
+		}
+		return fmt.Sprintf("%-10s %-38s %-10s %12s %12.2f", date, description, entryType, amount, balance)
+	}
+
+	lines := []string{
+		"Patient: " + statement.PatientName + " (" + statement.PatientID + ")",
+		"Period:  " + period,
+		fmt.Sprintf("Issued:  %s", time.Now().UTC().Format("2006-01-02")),
+		"",
+		fmt.Sprintf("%-10s %-38s %-10s %12s %12s", "Date", "Description", "Type", "Amount", "Balance"),
+		strings.Repeat("-", 86),
+		row("", "Opening balance", "", "", statement.OpeningBalance),
+	}
+	for _, entry := range statement.Entries {
+		lines = append(lines, row(entry.Date, entry.Description, entry.Type, fmt.Sprintf("%.2f", entry.Amount), entry.Balance))
+	}
+	lines = append(lines,
+		strings.Repeat("-", 86),
+		fmt.Sprintf("%-24s %12.2f", "Charges", statement.Charges),
+		fmt.Sprintf("%-24s %12.2f", "Payments", statement.Payments),
+		fmt.Sprintf("%-24s %12.2f", "Adjustments", statement.Adjustments),
+		fmt.Sprintf("%-24s %12.2f", "Closing balance", statement.ClosingBalance),
+	)
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.pdf"`, statement.PatientID))
+	if err := pdf.Render(w, "Patient statement", lines); err != nil {
+		log.Printf("Error writing patient statement PDF: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	dentalmodels "dental-saas/modules/dental/models"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/paging"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// GetTopPatients godoc
+// @Summary Get top patients by lifetime value
+// @Description Rank patients by cumulative paid revenue, visit frequency or outstanding balance, optionally within a date range. Use format=csv (or Accept: text/csv) to download the ranking.
+// @Tags reports
+// @Produce json
+// @Produce text/csv
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param sort query string false "Ranking criterion: revenue (default), visits or outstanding"
+// @Param limit query int false "Maximum number of patients (default 50)"
+// @Param format query string false "Response format: json (default) or csv"
+// @Success 200 {object} models.TopPatientsReport
+// @Failure 400 {object} apierror.Response "Invalid filters"
+// @Failure 500 {object} apierror.Response "Failed to build top patients report"
+// @Router /api/v1/financial/reports/top-patients [get]
+func GetTopPatients(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, hasFrom, err := parseDateParam(query, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, hasTo, err := parseDateParam(query, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hasTo {
+		// make "to" inclusive
+		to = to.AddDate(0, 0, 1)
+	}
+	inRange := func(t time.Time) bool {
+		return (!hasFrom || !t.Before(from)) && (!hasTo || t.Before(to))
+	}
+
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "revenue"
+	}
+	if sortBy != "revenue" && sortBy != "visits" && sortBy != "outstanding" {
+		http.Error(w, "sort must be one of revenue, visits or outstanding", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	patients, err := paging.ScanAll[dentalmodels.Patient](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Patients"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build top patients report", http.StatusInternalServerError)
+		log.Printf("Error scanning patients for top patients report: %v", err)
+		return
+	}
+	revenues, err := paging.ScanAll[models.Revenue](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Revenues"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build top patients report", http.StatusInternalServerError)
+		log.Printf("Error scanning revenues for top patients report: %v", err)
+		return
+	}
+	appointments, err := paging.ScanAll[dentalmodels.Appointment](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Appointments"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build top patients report", http.StatusInternalServerError)
+		log.Printf("Error scanning appointments for top patients report: %v", err)
+		return
+	}
+
+	values := make(map[string]*models.PatientValue)
+	valueFor := func(patientID string) *models.PatientValue {
+		if v, ok := values[patientID]; ok {
+			return v
+		}
+		v := &models.PatientValue{PatientID: patientID}
+		values[patientID] = v
+		return v
+	}
+
+	for _, revenue := range revenues {
+		// split revenues count each payer's payment on its own date
+		for _, payment := range revenue.Payments() {
+			if inRange(payment.Date) {
+				valueFor(revenue.PatientID).PaidRevenue += payment.Amount
+			}
+		}
+		if outstanding := revenue.Outstanding(); outstanding > 0 && inRange(revenue.DueDate) {
+			valueFor(revenue.PatientID).OutstandingBalance += outstanding
+		}
+	}
+
+	lastVisits := make(map[string]time.Time)
+	for _, appointment := range appointments {
+		if appointment.Status != dentalmodels.AppointmentStatusCompleted {
+			continue
+		}
+		start, err := appointment.StartTime()
+		if err != nil || !inRange(start) {
+			continue
+		}
+		valueFor(appointment.PatientID).Visits++
+		if start.After(lastVisits[appointment.PatientID]) {
+			lastVisits[appointment.PatientID] = start
+		}
+	}
+
+	for _, patient := range patients {
+		if v, ok := values[patient.ID]; ok {
+			v.PatientName = patient.Name
+			v.PatientEmail = patient.Email
+			v.PatientPhone = patient.Phone
+		}
+	}
+
+	report := models.TopPatientsReport{
+		SortBy:   sortBy,
+		Patients: []models.PatientValue{},
+	}
+	if hasFrom {
+		report.From = from.Format("2006-01-02")
+	}
+	if hasTo {
+		report.To = to.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+
+	for patientID, v := range values {
+		v.PaidRevenue = roundMoney(v.PaidRevenue)
+		v.OutstandingBalance = roundMoney(v.OutstandingBalance)
+		if v.Visits > 0 {
+			v.AverageTicket = roundMoney(v.PaidRevenue / float64(v.Visits))
+		}
+		if last, ok := lastVisits[patientID]; ok {
+			v.LastVisit = last.Format(time.RFC3339)
+		}
+		report.Patients = append(report.Patients, *v)
+	}
+
+	sort.Slice(report.Patients, func(i, j int) bool {
+		a, b := report.Patients[i], report.Patients[j]
+		switch sortBy {
+		case "visits":
+			if a.Visits != b.Visits {
+				return a.Visits > b.Visits
+			}
+		case "outstanding":
+			if a.OutstandingBalance != b.OutstandingBalance {
+				return a.OutstandingBalance > b.OutstandingBalance
+			}
+		}
+		if a.PaidRevenue != b.PaidRevenue {
+			return a.PaidRevenue > b.PaidRevenue
+		}
+		return a.PatientID < b.PatientID
+	})
+	if len(report.Patients) > limit {
+		report.Patients = report.Patients[:limit]
+	}
+
+	if query.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeTopPatientsCSV(w, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func writeTopPatientsCSV(w http.ResponseWriter, report models.TopPatientsReport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="top-patients.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"rank", "patient_id", "patient_name", "patient_email", "patient_phone", "paid_revenue", "visits", "average_ticket", "outstanding_balance", "last_visit"})
+	for i, p := range report.Patients {
+		cw.Write([]string{
+			strconv.Itoa(i + 1),
+			p.PatientID,
+			p.PatientName,
+			p.PatientEmail,
+			p.PatientPhone,
+			strconv.FormatFloat(p.PaidRevenue, 'f', 2, 64),
+			strconv.Itoa(p.Visits),
+			strconv.FormatFloat(p.AverageTicket, 'f', 2, 64),
+			strconv.FormatFloat(p.OutstandingBalance, 'f', 2, 64),
+			p.LastVisit,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing top patients CSV: %v", err)
+	}
+}
+
+// parseDateParam reads an optional YYYY-MM-DD query parameter
+func parseDateParam(query url.Values, name string) (time.Time, bool, error) {
+	v := query.Get(name)
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%s must be a date in YYYY-MM-DD format", name)
+	}
+	return t, true, nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Asset representa um equipamento da clínica (autoclave, cadeira, aparelho de raio-x...)
+type Asset struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Category         string    `json:"category"`
+	SerialNumber     string    `json:"serial_number,omitempty"`
+	Supplier         string    `json:"supplier,omitempty"`
+	PurchaseDate     time.Time `json:"purchase_date"`
+	PurchasePrice    float64   `json:"purchase_price"`
+	SalvageValue     float64   `json:"salvage_value,omitempty"`      // valor residual ao fim da vida útil
+	UsefulLifeMonths int       `json:"useful_life_months,omitempty"` // vida útil para depreciação linear
+	Notes            string    `json:"notes,omitempty"`
+
+	// Manutenção preventiva recorrente
+	MaintenanceIntervalDays int        `json:"maintenance_interval_days,omitempty"`
+	LastMaintenance         *time.Time `json:"last_maintenance,omitempty"`
+	NextMaintenance         *time.Time `json:"next_maintenance,omitempty"`
+	Responsible             string     `json:"responsible,omitempty"` // usuário da equipe notificado das manutenções
+	ReminderSentFor         string     `json:"-"`                     // data da manutenção já lembrada
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"` // versão do registro, aumentada a cada alteração
+
+	// Calculado na consulta
+	Depreciation *AssetDepreciation `json:"depreciation,omitempty" dynamodbav:"-"`
+}
+
+// IsValid verifica se os campos obrigatórios do equipamento estão preenchidos
+func (a *Asset) IsValid() error {
+	if a.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if a.Category == "" {
+		return fmt.Errorf("category is required")
+	}
+	if a.PurchaseDate.IsZero() {
+		return fmt.Errorf("purchase date is required")
+	}
+	if a.PurchasePrice < 0 || a.SalvageValue < 0 {
+		return fmt.Errorf("purchase price and salvage value must not be negative")
+	}
+	if a.SalvageValue > a.PurchasePrice {
+		return fmt.Errorf("salvage value must not exceed the purchase price")
+	}
+	if a.UsefulLifeMonths < 0 || a.MaintenanceIntervalDays < 0 {
+		return fmt.Errorf("useful life and maintenance interval must not be negative")
+	}
+	return nil
+}
+
+// ScheduleNextMaintenance calcula a próxima manutenção a partir da última (ou da compra)
+func (a *Asset) ScheduleNextMaintenance() {
+	if a.MaintenanceIntervalDays == 0 {
+		a.NextMaintenance = nil
+		return
+	}
+	from := a.PurchaseDate
+	if a.LastMaintenance != nil {
+		from = *a.LastMaintenance
+	}
+	next := from.AddDate(0, 0, a.MaintenanceIntervalDays)
+	a.NextMaintenance = &next
+}
+
+// AssetDepreciation representa a depreciação linear de um equipamento em uma data
+type AssetDepreciation struct {
+	At                      string  `json:"at"`
+	MonthlyDepreciation     float64 `json:"monthly_depreciation"`
+	AccumulatedDepreciation float64 `json:"accumulated_depreciation"`
+	BookValue               float64 `json:"book_value"`
+	FullyDepreciated        bool    `json:"fully_depreciated"`
+}
+
+// DepreciationAt calcula a depreciação linear acumulada até a data informada
+func (a *Asset) DepreciationAt(at time.Time) AssetDepreciation {
+	result := AssetDepreciation{At: at.Format("2006-01-02"), BookValue: a.PurchasePrice}
+	if a.UsefulLifeMonths == 0 {
+		return result
+	}
+
+	depreciable := a.PurchasePrice - a.SalvageValue
+	result.MonthlyDepreciation = math.Round(depreciable/float64(a.UsefulLifeMonths)*100) / 100
+
+	months := (at.Year()-a.PurchaseDate.Year())*12 + int(at.Month()-a.PurchaseDate.Month())
+	if at.Day() < a.PurchaseDate.Day() {
+		months--
+	}
+	if months < 0 {
+		months = 0
+	}
+	if months >= a.UsefulLifeMonths {
+		months = a.UsefulLifeMonths
+		result.FullyDepreciated = true
+	}
+
+	result.AccumulatedDepreciation = math.Round(depreciable*float64(months)/float64(a.UsefulLifeMonths)*100) / 100
+	result.BookValue = math.Round((a.PurchasePrice-result.AccumulatedDepreciation)*100) / 100
+	return result
+}
+
+// MaintenanceRecord representa uma manutenção realizada em um equipamento
+type MaintenanceRecord struct {
+	AssetID     string    `json:"asset_id"`
+	ID          string    `json:"id"`
+	Date        time.Time `json:"date"`
+	Description string    `json:"description"`
+	Cost        float64   `json:"cost"`
+	Supplier    string    `json:"supplier,omitempty"`
+	ExpenseID   string    `json:"expense_id,omitempty"` // gasto gerado pelo custo da manutenção
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IsValid verifica se os campos obrigatórios da manutenção estão preenchidos
+func (m *MaintenanceRecord) IsValid() error {
+	if m.Date.IsZero() {
+		return fmt.Errorf("date is required")
+	}
+	if m.Description == "" {
+		return fmt.Errorf("description is required")
+	}
+	if m.Cost < 0 {
+		return fmt.Errorf("cost must not be negative")
+	}
+	return nil
+}
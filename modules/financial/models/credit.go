@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// CreditEntryType representa a origem de um lançamento no crédito do paciente
+type CreditEntryType string
+
+const (
+	CreditEntryTopUp   CreditEntryType = "top_up"
+	CreditEntryVoucher CreditEntryType = "voucher"
+	CreditEntryCharge  CreditEntryType = "charge"
+)
+
+// CreditEntry representa um lançamento no extrato de crédito pré-pago de um paciente.
+// Valores positivos creditam o saldo e negativos o consomem.
+type CreditEntry struct {
+	PatientID   string          `json:"patient_id"`
+	EntryID     string          `json:"entry_id"`
+	Type        CreditEntryType `json:"type"`
+	Amount      float64         `json:"amount"`
+	Reference   string          `json:"reference,omitempty"` // código do vale ou ID da receita
+	Description string          `json:"description,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// CreditBalance representa o saldo de crédito de um paciente e seu extrato
+type CreditBalance struct {
+	PatientID string        `json:"patient_id"`
+	Balance   float64       `json:"balance"`
+	Entries   []CreditEntry `json:"entries"`
+}
+
+// CreditTopUp representa uma recarga de crédito paga pelo paciente
+type CreditTopUp struct {
+	Amount        float64       `json:"amount"`
+	PaymentMethod PaymentMethod `json:"payment_method"`
+	Description   string        `json:"description,omitempty"`
+}
+
+// IsValid verifica se a recarga tem valor e forma de pagamento
+func (c *CreditTopUp) IsValid() error {
+	if c.Amount <= 0 {
+		return fmt.Errorf("amount must be greater than zero")
+	}
+	if c.PaymentMethod == "" {
+		return fmt.Errorf("payment method is required")
+	}
+	return nil
+}
+
+// VoucherStatus representa a situação de um vale-presente
+type VoucherStatus string
+
+const (
+	VoucherStatusActive    VoucherStatus = "active"
+	VoucherStatusRedeemed  VoucherStatus = "redeemed"
+	VoucherStatusCancelled VoucherStatus = "cancelled"
+)
+
+// Voucher representa um vale-presente vendido pela clínica
+type Voucher struct {
+	Code          string        `json:"code"`
+	Amount        float64       `json:"amount"`
+	PurchaserName string        `json:"purchaser_name"`
+	PaymentMethod PaymentMethod `json:"payment_method"`
+	Status        VoucherStatus `json:"status"`
+	RedeemedBy    string        `json:"redeemed_by,omitempty"`
+	RedeemedAt    *time.Time    `json:"redeemed_at,omitempty"`
+	ExpiresAt     *time.Time    `json:"expires_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// IsValid verifica se os campos obrigatórios do vale estão preenchidos
+func (v *Voucher) IsValid() error {
+	if v.Amount <= 0 {
+		return fmt.Errorf("amount must be greater than zero")
+	}
+	if v.PurchaserName == "" {
+		return fmt.Errorf("purchaser name is required")
+	}
+	if v.PaymentMethod == "" {
+		return fmt.Errorf("payment method is required")
+	}
+	if v.ExpiresAt != nil && v.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("expiration date must be in the future")
+	}
+	return nil
+}
+
+// VoucherRedemption representa o resgate de um vale no crédito de um paciente
+type VoucherRedemption struct {
+	PatientID string `json:"patient_id"`
+}
+
+// CreditApplication representa o uso do crédito do paciente para abater uma receita pendente
+type CreditApplication struct {
+	RevenueID string  `json:"revenue_id"`
+	Applied   float64 `json:"applied"`
+	AmountDue float64 `json:"amount_due"`
+	Balance   float64 `json:"balance"`
+}
@@ -9,25 +9,42 @@ import (
 type ExpenseCategory string
 
 const (
-	ExpenseCategoryMaterials  ExpenseCategory = "materials"
-	ExpenseCategoryRent       ExpenseCategory = "rent"
-	ExpenseCategoryUtilities  ExpenseCategory = "utilities"
-	ExpenseCategoryStaff      ExpenseCategory = "staff"
-	ExpenseCategoryEquipment  ExpenseCategory = "equipment"
-	ExpenseCategoryOther      ExpenseCategory = "other"
+	ExpenseCategoryMaterials ExpenseCategory = "materials"
+	ExpenseCategoryRent      ExpenseCategory = "rent"
+	ExpenseCategoryUtilities ExpenseCategory = "utilities"
+	ExpenseCategoryStaff     ExpenseCategory = "staff"
+	ExpenseCategoryEquipment ExpenseCategory = "equipment"
+	ExpenseCategoryOther     ExpenseCategory = "other"
+)
+
+// ExpenseStatus representa a situação de aprovação de um gasto
+type ExpenseStatus string
+
+const (
+	ExpenseStatusDraft    ExpenseStatus = "draft"    // gerado automaticamente, aguardando aprovação
+	ExpenseStatusApproved ExpenseStatus = "approved" // gastos sem status também são considerados aprovados
 )
 
 // Expense representa um gasto da clínica
 type Expense struct {
 	ID          string          `json:"id"`
+	ClinicID    string          `json:"clinic_id,omitempty"` // clínica dona do registro
 	Description string          `json:"description"`
 	Amount      float64         `json:"amount"`
 	Category    ExpenseCategory `json:"category"`
 	Date        time.Time       `json:"date"`
 	Supplier    string          `json:"supplier,omitempty"`
 	InvoiceID   string          `json:"invoice_id,omitempty"`
-	CreatedAt   time.Time       `json:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at"`
+	Status      ExpenseStatus   `json:"status,omitempty"`
+	StaffID     string          `json:"staff_id,omitempty"`    // membro da equipe, em gastos de folha de pagamento
+	PayrollRun  string          `json:"payroll_run,omitempty"` // mês (YYYY-MM) da folha que gerou o gasto
+
+	AdjustsPeriod string `json:"adjusts_period,omitempty"` // mês fechado (YYYY-MM) corrigido por este lançamento de ajuste
+	AdjustsID     string `json:"adjusts_id,omitempty"`     // gasto corrigido pelo ajuste
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"` // versão do registro, aumentada a cada alteração
 }
 
 // IsValid verifica se os campos obrigatórios do gasto estão preenchidos
@@ -35,9 +52,12 @@ func (e *Expense) IsValid() error {
 	if e.Description == "" {
 		return fmt.Errorf("description is required")
 	}
-	if e.Amount <= 0 {
+	if e.AdjustsPeriod == "" && e.Amount <= 0 {
 		return fmt.Errorf("amount must be greater than zero")
 	}
+	if e.AdjustsPeriod != "" && e.Amount == 0 {
+		return fmt.Errorf("amount must not be zero")
+	}
 	if e.Category == "" {
 		return fmt.Errorf("category is required")
 	}
@@ -46,4 +66,11 @@ func (e *Expense) IsValid() error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// ExpenseDraft representa um gasto pré-preenchido a partir de um recibo, aguardando confirmação
+type ExpenseDraft struct {
+	Expense       Expense  `json:"expense"`
+	RawText       string   `json:"raw_text"`
+	MissingFields []string `json:"missing_fields,omitempty"`
+}
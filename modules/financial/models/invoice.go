@@ -34,6 +34,7 @@ type InvoiceItem struct {
 // Invoice representa uma nota fiscal
 type Invoice struct {
 	ID           string          `json:"id"`
+	ClinicID     string          `json:"clinic_id,omitempty"` // clínica dona do registro
 	Number       string          `json:"number"`
 	Type         InvoiceType     `json:"type"`
 	Status       InvoiceStatus   `json:"status"`
@@ -49,6 +50,7 @@ type Invoice struct {
 	Notes        string          `json:"notes,omitempty"`
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
+	Version      int64           `json:"version"` // versão do registro, aumentada a cada alteração
 }
 
 // IsValid verifica se os campos obrigatórios da nota fiscal estão preenchidos
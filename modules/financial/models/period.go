@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status de um período financeiro (mês)
+const (
+	PeriodStatusOpen   = "open"
+	PeriodStatusClosed = "closed"
+)
+
+// Tipos de lançamento de ajuste
+const (
+	AdjustmentTypeRevenue = "revenue"
+	AdjustmentTypeExpense = "expense"
+)
+
+// PeriodTotals representa os totais de um mês, registrados no fechamento
+type PeriodTotals struct {
+	Revenues      int     `json:"revenues"`
+	RevenueAmount float64 `json:"revenue_amount"`
+	Expenses      int     `json:"expenses"`
+	ExpenseAmount float64 `json:"expense_amount"`
+	Invoices      int     `json:"invoices"`
+	InvoiceAmount float64 `json:"invoice_amount"`
+}
+
+// Add soma os totais de outro período a estes
+func (t *PeriodTotals) Add(other PeriodTotals) {
+	t.Revenues += other.Revenues
+	t.RevenueAmount += other.RevenueAmount
+	t.Expenses += other.Expenses
+	t.ExpenseAmount += other.ExpenseAmount
+	t.Invoices += other.Invoices
+	t.InvoiceAmount += other.InvoiceAmount
+}
+
+// Period representa um mês contábil; depois de fechado, receitas, gastos e
+// notas fiscais do mês não podem mais ser alterados
+type Period struct {
+	ClinicID string       `json:"-"`
+	Month    string       `json:"month"` // YYYY-MM
+	Status   string       `json:"status"`
+	ClosedBy string       `json:"closed_by,omitempty"`
+	ClosedAt *time.Time   `json:"closed_at,omitempty"`
+	Totals   PeriodTotals `json:"totals"` // no fechamento, ou atuais enquanto aberto
+	Notes    string       `json:"notes,omitempty"`
+}
+
+// PeriodCloseRequest representa o fechamento de um mês pelo contador
+type PeriodCloseRequest struct {
+	Notes string `json:"notes,omitempty"`
+}
+
+// AdjustmentRequest representa um lançamento de ajuste, registrado no período
+// aberto, que corrige um mês já fechado
+type AdjustmentRequest struct {
+	Type        string  `json:"type"`                // revenue ou expense
+	RecordID    string  `json:"record_id,omitempty"` // receita ou gasto corrigido; obrigatório para receitas
+	Amount      float64 `json:"amount"`              // positivo ou negativo
+	Description string  `json:"description"`
+}
+
+// IsValid verifica se os campos obrigatórios do ajuste estão preenchidos
+func (a *AdjustmentRequest) IsValid() error {
+	switch a.Type {
+	case AdjustmentTypeRevenue:
+		if a.RecordID == "" {
+			return fmt.Errorf("record ID is required for revenue adjustments")
+		}
+	case AdjustmentTypeExpense:
+	default:
+		return fmt.Errorf("type must be revenue or expense")
+	}
+	if a.Amount == 0 {
+		return fmt.Errorf("amount must not be zero")
+	}
+	if a.Description == "" {
+		return fmt.Errorf("description is required")
+	}
+	return nil
+}
+
+// ParseMonth valida um mês no formato YYYY-MM
+func ParseMonth(month string) (time.Time, error) {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("month must be in YYYY-MM format")
+	}
+	return t, nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import "fmt"
+
+// ForecastComponent representa uma parcela da previsão de receita
+type ForecastComponent struct {
+	Count    int     `json:"count"`
+	Gross    float64 `json:"gross"`
+	Rate     float64 `json:"rate"`
+	Expected float64 `json:"expected"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// RevenueForecast representa a previsão de receita para um período futuro.
+// Low e High formam um intervalo de confiança de 95%.
+type RevenueForecast struct {
+	From         string            `json:"from"`
+	To           string            `json:"to"`
+	HistoryDays  int               `json:"history_days"`
+	Appointments ForecastComponent `json:"appointments"`
+	Receivables  ForecastComponent `json:"receivables"`
+	Expected     float64           `json:"expected"`
+	Low          float64           `json:"low"`
+	High         float64           `json:"high"`
+}
+
+// PatientValue representa o valor acumulado de um paciente para a clínica
+type PatientValue struct {
+	PatientID          string  `json:"patient_id"`
+	PatientName        string  `json:"patient_name"`
+	PatientEmail       string  `json:"patient_email"`
+	PatientPhone       string  `json:"patient_phone"`
+	PaidRevenue        float64 `json:"paid_revenue"`
+	Visits             int     `json:"visits"`
+	AverageTicket      float64 `json:"average_ticket"`
+	OutstandingBalance float64 `json:"outstanding_balance"`
+	LastVisit          string  `json:"last_visit,omitempty"`
+}
+
+// TopPatientsReport representa o ranking de pacientes por valor
+type TopPatientsReport struct {
+	From     string         `json:"from,omitempty"`
+	To       string         `json:"to,omitempty"`
+	SortBy   string         `json:"sort_by"`
+	Patients []PatientValue `json:"patients"`
+}
+
+// ShareReportRequest representa o pedido de um link de acesso somente leitura
+// a um relatório, para alguém sem conta na clínica (ex.: o contador externo).
+// Params traz os parâmetros do relatório, como o mês do período.
+type ShareReportRequest struct {
+	Report string            `json:"report"`
+	Params map[string]string `json:"params,omitempty"`
+	Days   int               `json:"days,omitempty"` // padrão 7
+}
+
+// IsValid verifica se o pedido informa o relatório e uma validade positiva
+func (s *ShareReportRequest) IsValid() error {
+	if s.Report == "" {
+		return fmt.Errorf("report is required")
+	}
+	if s.Days < 0 {
+		return fmt.Errorf("days must be positive")
+	}
+	return nil
+}
+
+// SharedReportLink representa um link assinado de um relatório compartilhado
+type SharedReportLink struct {
+	ID        string            `json:"id"`
+	Report    string            `json:"report"`
+	Params    map[string]string `json:"params,omitempty"`
+	URL       string            `json:"url"`
+	Token     string            `json:"token"`
+	ExpiresAt string            `json:"expires_at"`
+}
+
+// ClinicTotals representa os totais de uma clínica no relatório consolidado
+type ClinicTotals struct {
+	ClinicID   string       `json:"clinic_id"`
+	ClinicName string       `json:"clinic_name"`
+	Months     []Period     `json:"months"`
+	Totals     PeriodTotals `json:"totals"`
+	Net        float64      `json:"net"` // receitas menos gastos
+}
+
+// ConsolidatedReport representa os totais das clínicas de uma organização
+// (rede de clínicas) em um intervalo de meses
+type ConsolidatedReport struct {
+	OrganizationID string         `json:"organization_id"`
+	From           string         `json:"from"` // YYYY-MM
+	To             string         `json:"to"`   // YYYY-MM
+	Clinics        []ClinicTotals `json:"clinics"`
+	Totals         PeriodTotals   `json:"totals"`
+	Net            float64        `json:"net"`
+}
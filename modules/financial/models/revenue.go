@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"math"
 	"time"
 )
 
@@ -9,11 +10,12 @@ import (
 type PaymentMethod string
 
 const (
-	PaymentMethodCash       PaymentMethod = "cash"
-	PaymentMethodCard       PaymentMethod = "card"
-	PaymentMethodPix        PaymentMethod = "pix"
-	PaymentMethodBankSlip   PaymentMethod = "bank_slip"
-	PaymentMethodInsurance  PaymentMethod = "insurance"
+	PaymentMethodCash      PaymentMethod = "cash"
+	PaymentMethodCard      PaymentMethod = "card"
+	PaymentMethodPix       PaymentMethod = "pix"
+	PaymentMethodBankSlip  PaymentMethod = "bank_slip"
+	PaymentMethodInsurance PaymentMethod = "insurance"
+	PaymentMethodCredit    PaymentMethod = "credit"
 )
 
 // PaymentStatus representa o status do pagamento
@@ -26,21 +28,85 @@ const (
 	PaymentStatusRefunded  PaymentStatus = "refunded"
 )
 
-// Revenue representa uma receita da clínica
-type Revenue struct {
+// PayerType representa quem paga uma parte da receita
+type PayerType string
+
+const (
+	PayerPatient   PayerType = "patient"
+	PayerInsurance PayerType = "insurance"
+	PayerGuardian  PayerType = "guardian"
+)
+
+// RevenueSplit representa a parte de uma receita cobrada de um pagador,
+// com pagamento acompanhado separadamente
+type RevenueSplit struct {
 	ID            string        `json:"id"`
-	Description   string        `json:"description"`
+	Payer         PayerType     `json:"payer"`
+	PayerName     string        `json:"payer_name,omitempty"` // operadora do convênio ou nome do responsável
 	Amount        float64       `json:"amount"`
-	PatientID     string        `json:"patient_id"`
-	ProcedureID   string        `json:"procedure_id,omitempty"`
-	AppointmentID string        `json:"appointment_id,omitempty"`
-	PaymentMethod PaymentMethod `json:"payment_method"`
+	PaymentMethod PaymentMethod `json:"payment_method,omitempty"`
 	PaymentStatus PaymentStatus `json:"payment_status"`
-	DueDate       time.Time     `json:"due_date"`
 	PaidDate      *time.Time    `json:"paid_date,omitempty"`
-	InvoiceID     string        `json:"invoice_id,omitempty"`
-	CreatedAt     time.Time     `json:"created_at"`
-	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// RevenueSplitRequest representa a divisão de uma receita entre pagadores;
+// uma lista vazia desfaz a divisão
+type RevenueSplitRequest struct {
+	Splits []RevenueSplit `json:"splits"`
+}
+
+// SplitPayment representa o pagamento de uma das partes da receita
+type SplitPayment struct {
+	PaymentMethod PaymentMethod `json:"payment_method"`
+	PaidDate      *time.Time    `json:"paid_date,omitempty"` // padrão: agora
+}
+
+// RevenuePaymentRequest representa o pagamento integral de uma receita
+type RevenuePaymentRequest struct {
+	PaymentMethod PaymentMethod `json:"payment_method"`
+	PaidDate      *time.Time    `json:"paid_date,omitempty"` // padrão: agora
+}
+
+// OverdueRevenue representa uma receita pendente com vencimento passado, com
+// o contato do paciente para a cobrança
+type OverdueRevenue struct {
+	Revenue
+	PatientName  string  `json:"patient_name,omitempty"`
+	PatientEmail string  `json:"patient_email,omitempty"`
+	PatientPhone string  `json:"patient_phone,omitempty"`
+	DaysOverdue  int     `json:"days_overdue"`
+	Outstanding  float64 `json:"outstanding"` // valor ainda em aberto, sem as partes já pagas
+}
+
+// RevenuePayment representa um valor já recebido de uma receita
+type RevenuePayment struct {
+	Payer  PayerType
+	Method PaymentMethod
+	Amount float64
+	Date   time.Time
+}
+
+// Revenue representa uma receita da clínica
+type Revenue struct {
+	ID            string         `json:"id"`
+	ClinicID      string         `json:"clinic_id,omitempty"` // clínica dona do registro
+	Description   string         `json:"description"`
+	Amount        float64        `json:"amount"`
+	PatientID     string         `json:"patient_id"`
+	ProcedureID   string         `json:"procedure_id,omitempty"`
+	AppointmentID string         `json:"appointment_id,omitempty"`
+	PaymentMethod PaymentMethod  `json:"payment_method"`
+	PaymentStatus PaymentStatus  `json:"payment_status"`
+	DueDate       time.Time      `json:"due_date"`
+	PaidDate      *time.Time     `json:"paid_date,omitempty"`
+	InvoiceID     string         `json:"invoice_id,omitempty"`
+	CreditApplied float64        `json:"credit_applied,omitempty"` // parte abatida do crédito pré-pago do paciente
+	AdjustsPeriod string         `json:"adjusts_period,omitempty"` // mês fechado (YYYY-MM) corrigido por este lançamento de ajuste
+	AdjustsID     string         `json:"adjusts_id,omitempty"`     // receita corrigida pelo ajuste
+	Splits        []RevenueSplit `json:"splits,omitempty"`         // divisão do valor a cobrar entre pagadores
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	Version       int64          `json:"version"` // versão do registro, aumentada a cada alteração
 }
 
 // IsValid verifica se os campos obrigatórios da receita estão preenchidos
@@ -48,9 +114,12 @@ func (r *Revenue) IsValid() error {
 	if r.Description == "" {
 		return fmt.Errorf("description is required")
 	}
-	if r.Amount <= 0 {
+	if r.AdjustsPeriod == "" && r.Amount <= 0 {
 		return fmt.Errorf("amount must be greater than zero")
 	}
+	if r.AdjustsPeriod != "" && r.Amount == 0 {
+		return fmt.Errorf("amount must not be zero")
+	}
 	if r.PatientID == "" {
 		return fmt.Errorf("patient ID is required")
 	}
@@ -65,4 +134,127 @@ func (r *Revenue) IsValid() error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// AmountDue retorna o valor ainda a cobrar, descontado o crédito aplicado
+func (r *Revenue) AmountDue() float64 {
+	return r.Amount - r.CreditApplied
+}
+
+// Unpaid retorna o valor a cobrar ainda não pago: numa receita dividida, a
+// soma das partes pendentes
+func (r *Revenue) Unpaid() float64 {
+	if len(r.Splits) == 0 {
+		return r.AmountDue()
+	}
+	var total float64
+	for _, split := range r.Splits {
+		if split.PaymentStatus == PaymentStatusPending {
+			total += split.Amount
+		}
+	}
+	return total
+}
+
+// ValidateSplits verifica se as partes têm pagador e valor e se, somadas,
+// cobrem exatamente o valor a cobrar
+func (r *Revenue) ValidateSplits(splits []RevenueSplit) error {
+	var total float64
+	for _, split := range splits {
+		switch split.Payer {
+		case PayerPatient, PayerInsurance, PayerGuardian:
+		default:
+			return fmt.Errorf("payer must be patient, insurance or guardian")
+		}
+		if split.Payer != PayerPatient && split.PayerName == "" {
+			return fmt.Errorf("payer name is required for %s splits", split.Payer)
+		}
+		if split.Amount <= 0 {
+			return fmt.Errorf("split amount must be greater than zero")
+		}
+		total += split.Amount
+	}
+	if len(splits) > 0 && math.Round(total*100) != math.Round(r.AmountDue()*100) {
+		return fmt.Errorf("splits must add up to the amount due (%.2f)", r.AmountDue())
+	}
+	return nil
+}
+
+// SettleSplits atualiza a situação da receita a partir das partes: paga,
+// na data do último pagamento, quando todas foram pagas
+func (r *Revenue) SettleSplits() {
+	if len(r.Splits) == 0 {
+		return
+	}
+	var paidDate time.Time
+	for _, split := range r.Splits {
+		if split.PaymentStatus != PaymentStatusPaid {
+			r.PaymentStatus = PaymentStatusPending
+			r.PaidDate = nil
+			return
+		}
+		if split.PaidDate != nil && split.PaidDate.After(paidDate) {
+			paidDate = *split.PaidDate
+		}
+	}
+	r.PaymentStatus = PaymentStatusPaid
+	r.PaidDate = &paidDate
+}
+
+// Payments lista os valores já recebidos: o crédito aplicado e o pagamento
+// integral ou, numa receita dividida, o de cada parte paga. Receitas
+// canceladas ou estornadas não têm pagamentos.
+func (r *Revenue) Payments() []RevenuePayment {
+	if r.PaymentStatus == PaymentStatusCancelled || r.PaymentStatus == PaymentStatusRefunded {
+		return nil
+	}
+
+	paidAt := r.DueDate
+	if r.PaidDate != nil {
+		paidAt = *r.PaidDate
+	}
+
+	var payments []RevenuePayment
+	if r.CreditApplied != 0 {
+		creditAt := r.UpdatedAt
+		if r.PaidDate != nil {
+			creditAt = *r.PaidDate
+		}
+		payments = append(payments, RevenuePayment{Payer: PayerPatient, Method: PaymentMethodCredit, Amount: r.CreditApplied, Date: creditAt})
+	}
+	if len(r.Splits) > 0 {
+		for _, split := range r.Splits {
+			if split.PaymentStatus != PaymentStatusPaid {
+				continue
+			}
+			date := paidAt
+			if split.PaidDate != nil {
+				date = *split.PaidDate
+			}
+			payments = append(payments, RevenuePayment{Payer: split.Payer, Method: split.PaymentMethod, Amount: split.Amount, Date: date})
+		}
+		return payments
+	}
+	if r.PaymentStatus == PaymentStatusPaid && r.AmountDue() != 0 {
+		payments = append(payments, RevenuePayment{Payer: PayerPatient, Method: r.PaymentMethod, Amount: r.AmountDue(), Date: paidAt})
+	}
+	return payments
+}
+
+// Outstanding retorna o valor ainda a receber: o valor a cobrar de uma
+// receita pendente ou, numa receita dividida, a soma das partes pendentes
+func (r *Revenue) Outstanding() float64 {
+	if r.PaymentStatus != PaymentStatusPending {
+		return 0
+	}
+	if len(r.Splits) == 0 {
+		return r.AmountDue()
+	}
+	var outstanding float64
+	for _, split := range r.Splits {
+		if split.PaymentStatus == PaymentStatusPending {
+			outstanding += split.Amount
+		}
+	}
+	return outstanding
+}
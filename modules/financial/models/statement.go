@@ -0,0 +1,36 @@
+package models
+
+// Tipos de lançamento do extrato do paciente
+const (
+	StatementEntryCharge     = "charge"
+	StatementEntryPayment    = "payment"
+	StatementEntryAdjustment = "adjustment"
+)
+
+// StatementEntry representa uma linha do extrato do paciente. Cobranças e
+// ajustes positivos aumentam o saldo devedor; pagamentos o reduzem.
+type StatementEntry struct {
+	Date          string        `json:"date"` // YYYY-MM-DD
+	Type          string        `json:"type"`
+	Description   string        `json:"description"`
+	RevenueID     string        `json:"revenue_id"`
+	PaymentMethod PaymentMethod `json:"payment_method,omitempty"`
+	Amount        float64       `json:"amount"`
+	Balance       float64       `json:"balance"`
+}
+
+// PatientStatement representa o extrato detalhado de um paciente num período,
+// usado por exemplo para pedidos de reembolso ao convênio
+type PatientStatement struct {
+	PatientID      string           `json:"patient_id"`
+	PatientName    string           `json:"patient_name"`
+	PatientEmail   string           `json:"patient_email,omitempty"`
+	From           string           `json:"from,omitempty"`
+	To             string           `json:"to,omitempty"`
+	OpeningBalance float64          `json:"opening_balance"`
+	Charges        float64          `json:"charges"`
+	Payments       float64          `json:"payments"`
+	Adjustments    float64          `json:"adjustments"`
+	ClosingBalance float64          `json:"closing_balance"`
+	Entries        []StatementEntry `json:"entries"`
+}
@@ -0,0 +1,38 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrUnsupportedFormat is returned by providers that cannot read the format
+// of a receipt, such as tesseract with PDFs
+var ErrUnsupportedFormat = errors.New("receipt format not supported by the OCR provider")
+
+// Provider extracts the raw text printed on a receipt image
+type Provider interface {
+	ExtractText(ctx context.Context, image []byte) (string, error)
+}
+
+// NewProviderFromEnv returns the OCR provider selected by the OCR_PROVIDER
+// environment variable ("tesseract" by default, or "textract")
+func NewProviderFromEnv() (Provider, error) {
+	switch os.Getenv("OCR_PROVIDER") {
+	case "", "tesseract":
+		binary := "tesseract"
+		if path := os.Getenv("TESSERACT_PATH"); path != "" {
+			binary = path
+		}
+		return &TesseractProvider{Binary: binary}, nil
+	case "textract":
+		region := "us-west-2"
+		if r := os.Getenv("TEXTRACT_REGION"); r != "" {
+			region = r
+		}
+		return NewTextractProvider(context.Background(), region)
+	default:
+		return nil, fmt.Errorf("unknown OCR provider %q", os.Getenv("OCR_PROVIDER"))
+	}
+}
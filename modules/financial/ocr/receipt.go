@@ -0,0 +1,113 @@
+package ocr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReceiptData holds the fields extracted from a receipt's text
+type ReceiptData struct {
+	Amount   float64
+	Date     time.Time
+	Supplier string
+}
+
+var (
+	amountPattern = regexp.MustCompile(`\d{1,3}(?:[.,]\d{3})*[.,]\d{2}\b`)
+	datePatterns  = []struct {
+		re     *regexp.Regexp
+		layout string
+	}{
+		{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`), "2006-01-02"},
+		{regexp.MustCompile(`\b\d{2}/\d{2}/\d{4}\b`), "02/01/2006"},
+		{regexp.MustCompile(`\b\d{2}\.\d{2}\.\d{4}\b`), "02.01.2006"},
+		{regexp.MustCompile(`\b\d{2}/\d{2}/\d{2}\b`), "02/01/06"},
+	}
+	totalKeywords = []string{"total", "valor a pagar", "valor pago", "amount due"}
+)
+
+// ParseReceipt extracts amount, date and supplier from OCR text.
+// The amount prefers lines mentioning a total and falls back to the largest
+// value found; the supplier is the first line that is not a number or date.
+func ParseReceipt(text string) ReceiptData {
+	var data ReceiptData
+
+	lines := strings.Split(text, "\n")
+	var largest, total float64
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		isTotal := false
+		for _, kw := range totalKeywords {
+			if strings.Contains(lower, kw) && !strings.Contains(lower, "subtotal") {
+				isTotal = true
+				break
+			}
+		}
+		for _, match := range amountPattern.FindAllString(line, -1) {
+			value, ok := parseAmount(match)
+			if !ok {
+				continue
+			}
+			if value > largest {
+				largest = value
+			}
+			if isTotal && value > total {
+				total = value
+			}
+		}
+	}
+	if total > 0 {
+		data.Amount = total
+	} else {
+		data.Amount = largest
+	}
+
+	for _, p := range datePatterns {
+		if match := p.re.FindString(text); match != "" {
+			if d, err := time.Parse(p.layout, match); err == nil {
+				data.Date = d.UTC()
+				break
+			}
+		}
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) < 3 || amountPattern.MatchString(line) {
+			continue
+		}
+		isDate := false
+		for _, p := range datePatterns {
+			if p.re.MatchString(line) {
+				isDate = true
+				break
+			}
+		}
+		if !isDate {
+			data.Supplier = line
+			break
+		}
+	}
+
+	return data
+}
+
+// parseAmount accepts both "1.234,56" and "1,234.56" notations
+func parseAmount(s string) (float64, bool) {
+	decimalSep := s[len(s)-3]
+	var normalized string
+	if decimalSep == ',' {
+		normalized = strings.ReplaceAll(s, ".", "")
+		normalized = strings.Replace(normalized, ",", ".", 1)
+	} else {
+		normalized = strings.ReplaceAll(s, ",", "")
+	}
+
+	value, err := strconv.ParseFloat(normalized, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
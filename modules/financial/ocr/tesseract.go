@@ -0,0 +1,35 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+)
+
+// TesseractProvider runs the local tesseract CLI over the image
+type TesseractProvider struct {
+	Binary string
+}
+
+// ExtractText pipes the image through tesseract and returns its stdout.
+// tesseract reads no PDFs from stdin, so those fail with ErrUnsupportedFormat
+// without running it.
+func (p *TesseractProvider) ExtractText(ctx context.Context, image []byte) (string, error) {
+	if http.DetectContentType(image) == "application/pdf" {
+		return "", fmt.Errorf("%w: tesseract reads images, not PDFs", ErrUnsupportedFormat)
+	}
+	cmd := exec.CommandContext(ctx, p.Binary, "stdin", "stdout")
+	cmd.Stdin = bytes.NewReader(image)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %v: %s", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
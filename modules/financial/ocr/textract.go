@@ -0,0 +1,99 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// TextractProvider calls the AWS Textract DetectDocumentText API
+type TextractProvider struct {
+	Region      string
+	Credentials aws.CredentialsProvider
+	HTTPClient  *http.Client
+}
+
+// NewTextractProvider loads AWS credentials from the default chain
+func NewTextractProvider(ctx context.Context, region string) (*TextractProvider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+
+	return &TextractProvider{
+		Region:      region,
+		Credentials: cfg.Credentials,
+		HTTPClient:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+type textractBlock struct {
+	BlockType string `json:"BlockType"`
+	Text      string `json:"Text"`
+}
+
+// ExtractText sends the image to Textract and joins the detected LINE blocks
+func (p *TextractProvider) ExtractText(ctx context.Context, image []byte) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"Document": map[string]interface{}{"Bytes": image},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := fmt.Sprintf("https://textract.%s.amazonaws.com/", p.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Textract.DetectDocumentText")
+
+	creds, err := p.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %v", err)
+	}
+
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "textract", p.Region, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to sign Textract request: %v", err)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("textract request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("textract returned status %d: %s", resp.StatusCode, msg)
+	}
+
+	var out struct {
+		Blocks []textractBlock `json:"Blocks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode Textract response: %v", err)
+	}
+
+	var lines []string
+	for _, block := range out.Blocks {
+		if block.BlockType == "LINE" {
+			lines = append(lines, block.Text)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
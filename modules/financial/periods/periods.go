@@ -0,0 +1,324 @@
+package periods
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableName is the table holding the closed months of each clinic
+const TableName = "FinancialPeriods"
+
+const monthLayout = "2006-01"
+
+var (
+	// ErrClosed is returned when writing a revenue, expense or invoice dated
+	// in a closed month; corrections go through adjusting entries instead
+	ErrClosed = errors.New("financial period is closed")
+	// ErrAlreadyClosed is returned when closing a month twice
+	ErrAlreadyClosed = errors.New("financial period is already closed")
+	// ErrNotEnded is returned when closing the current or a future month
+	ErrNotEnded = errors.New("financial period has not ended yet")
+)
+
+// Month returns the period (YYYY-MM) a date falls in
+func Month(t time.Time) string {
+	return t.UTC().Format(monthLayout)
+}
+
+// CheckOpen returns ErrClosed, naming the month, when any of the dates falls
+// in a closed period. Every write to revenues, expenses and invoices checks
+// the date the record is booked on, before and after the change.
+func CheckOpen(ctx context.Context, dates ...time.Time) error {
+	closed, err := closedMonths(ctx)
+	if err != nil {
+		return err
+	}
+	for _, date := range dates {
+		if date.IsZero() {
+			continue
+		}
+		if month := Month(date); closed[month] {
+			return fmt.Errorf("%w: %s, record an adjusting entry in the open period instead", ErrClosed, month)
+		}
+	}
+	return nil
+}
+
+// IsClosed reports whether a month has been closed
+func IsClosed(ctx context.Context, month string) (bool, error) {
+	closed, err := closedMonths(ctx)
+	if err != nil {
+		return false, err
+	}
+	return closed[month], nil
+}
+
+// Get returns a month with its totals: those recorded when it was closed,
+// or the current ones while it is open
+func Get(ctx context.Context, month string) (models.Period, error) {
+	getCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: config.ClinicID(ctx)},
+			"Month":    &types.AttributeValueMemberS{Value: month},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return models.Period{}, err
+	}
+	if result.Item != nil {
+		var period models.Period
+		if err := attributevalue.UnmarshalMap(result.Item, &period); err != nil {
+			return models.Period{}, err
+		}
+		return period, nil
+	}
+
+	totals, err := Totals(ctx, month)
+	if err != nil {
+		return models.Period{}, err
+	}
+	return models.Period{Month: month, Status: models.PeriodStatusOpen, Totals: totals}, nil
+}
+
+// List returns the closed months, most recent first
+func List(ctx context.Context) ([]models.Period, error) {
+	items, err := queryPeriods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	periods := make([]models.Period, 0, len(items))
+	for _, item := range items {
+		var period models.Period
+		if err := attributevalue.UnmarshalMap(item, &period); err != nil {
+			log.Printf("Error unmarshaling %s item: %v", TableName, err)
+			continue
+		}
+		periods = append(periods, period)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Month > periods[j].Month
+	})
+	return periods, nil
+}
+
+// Close locks a month that has ended, recording its totals at the time of
+// closing
+func Close(ctx context.Context, month, closedBy, notes string) (models.Period, error) {
+	start, err := models.ParseMonth(month)
+	if err != nil {
+		return models.Period{}, err
+	}
+	if !time.Now().UTC().After(start.AddDate(0, 1, 0)) {
+		return models.Period{}, ErrNotEnded
+	}
+
+	totals, err := Totals(ctx, month)
+	if err != nil {
+		return models.Period{}, err
+	}
+	now := time.Now().UTC()
+	period := models.Period{
+		ClinicID: config.ClinicID(ctx),
+		Month:    month,
+		Status:   models.PeriodStatusClosed,
+		ClosedBy: closedBy,
+		ClosedAt: &now,
+		Totals:   totals,
+		Notes:    notes,
+	}
+	item, err := attributevalue.MarshalMap(period)
+	if err != nil {
+		return models.Period{}, err
+	}
+
+	putCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#month)"),
+		ExpressionAttributeNames: map[string]string{
+			"#month": "Month",
+		},
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return models.Period{}, ErrAlreadyClosed
+		}
+		return models.Period{}, err
+	}
+	return period, nil
+}
+
+// Totals sums the revenues (by due date), expenses (by date) and invoices
+// (by issue date) booked in a month
+func Totals(ctx context.Context, month string) (models.PeriodTotals, error) {
+	totals, err := monthTotals(ctx, map[string]bool{month: true})
+	if err != nil {
+		return models.PeriodTotals{}, err
+	}
+	return totals[month], nil
+}
+
+// Range returns the months from first to last (YYYY-MM), oldest first, each
+// with its totals as Get returns them. The records are read once for all the
+// open months.
+func Range(ctx context.Context, first, last string) ([]models.Period, error) {
+	start, err := models.ParseMonth(first)
+	if err != nil {
+		return nil, err
+	}
+	end, err := models.ParseMonth(last)
+	if err != nil {
+		return nil, err
+	}
+
+	closed, err := List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	closedByMonth := make(map[string]models.Period, len(closed))
+	for _, period := range closed {
+		closedByMonth[period.Month] = period
+	}
+
+	var months []string
+	open := map[string]bool{}
+	for t := start; !t.After(end); t = t.AddDate(0, 1, 0) {
+		month := Month(t)
+		months = append(months, month)
+		if _, ok := closedByMonth[month]; !ok {
+			open[month] = true
+		}
+	}
+	totals := map[string]models.PeriodTotals{}
+	if len(open) > 0 {
+		if totals, err = monthTotals(ctx, open); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]models.Period, 0, len(months))
+	for _, month := range months {
+		if period, ok := closedByMonth[month]; ok {
+			result = append(result, period)
+			continue
+		}
+		result = append(result, models.Period{Month: month, Status: models.PeriodStatusOpen, Totals: totals[month]})
+	}
+	return result, nil
+}
+
+// monthTotals sums the records booked in each of the months
+func monthTotals(ctx context.Context, months map[string]bool) (map[string]models.PeriodTotals, error) {
+	sums := make(map[string]*models.PeriodTotals, len(months))
+	for month := range months {
+		sums[month] = &models.PeriodTotals{}
+	}
+
+	revenues, err := paging.ScanAll[models.Revenue](ctx, &dynamodb.ScanInput{TableName: aws.String("Revenues")})
+	if err != nil {
+		return nil, err
+	}
+	for _, revenue := range revenues {
+		if totals, ok := sums[Month(revenue.DueDate)]; ok && revenue.PaymentStatus != models.PaymentStatusCancelled {
+			totals.Revenues++
+			totals.RevenueAmount += revenue.Amount
+		}
+	}
+
+	expenses, err := paging.ScanAll[models.Expense](ctx, &dynamodb.ScanInput{TableName: aws.String("Expenses")})
+	if err != nil {
+		return nil, err
+	}
+	for _, expense := range expenses {
+		if totals, ok := sums[Month(expense.Date)]; ok {
+			totals.Expenses++
+			totals.ExpenseAmount += expense.Amount
+		}
+	}
+
+	invoices, err := paging.ScanAll[models.Invoice](ctx, &dynamodb.ScanInput{TableName: aws.String("Invoices")})
+	if err != nil {
+		return nil, err
+	}
+	for _, invoice := range invoices {
+		if totals, ok := sums[Month(invoice.IssueDate)]; ok && invoice.Status != models.InvoiceStatusCancelled {
+			totals.Invoices++
+			totals.InvoiceAmount += invoice.TotalAmount
+		}
+	}
+
+	result := make(map[string]models.PeriodTotals, len(sums))
+	for month, totals := range sums {
+		totals.RevenueAmount = roundMoney(totals.RevenueAmount)
+		totals.ExpenseAmount = roundMoney(totals.ExpenseAmount)
+		totals.InvoiceAmount = roundMoney(totals.InvoiceAmount)
+		result[month] = *totals
+	}
+	return result, nil
+}
+
+// closedMonths reads the closed months of the clinic. Closing is rare and
+// writes must never slip into a month closed moments ago on another
+// instance, so this is not cached.
+func closedMonths(ctx context.Context) (map[string]bool, error) {
+	items, err := queryPeriods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("checking closed periods: %v", err)
+	}
+	closed := make(map[string]bool, len(items))
+	for _, item := range items {
+		if month, ok := item["Month"].(*types.AttributeValueMemberS); ok {
+			closed[month.Value] = true
+		}
+	}
+	return closed, nil
+}
+
+func queryPeriods(ctx context.Context) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: config.ClinicID(ctx)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// roundMoney rounds an amount to cents
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,96 @@
+// Package reportlinks signs the links accountants share to give someone
+// outside the clinic, such as an external bookkeeper, read-only access to a
+// single report until the link expires.
+package reportlinks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"dental-saas/shared/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Links last DefaultTTL unless asked otherwise, and never longer than
+// REPORT_LINK_MAX_TTL
+const (
+	DefaultTTL    = 7 * 24 * time.Hour
+	defaultMaxTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidLink is returned for tokens that are malformed or not signed by this deployment
+	ErrInvalidLink = errors.New("invalid report link")
+	// ErrExpiredLink is returned once a link is past its expiry
+	ErrExpiredLink = errors.New("report link has expired")
+)
+
+// Link is a report shared by link: the report, the parameters it is run
+// with, the clinic it reads from and when the link stops working
+type Link struct {
+	ID        string            `json:"i"`
+	Report    string            `json:"r"`
+	Params    map[string]string `json:"p,omitempty"`
+	ClinicID  string            `json:"c"`
+	ExpiresAt int64             `json:"e"`
+}
+
+// Expires returns when the link stops working
+func (l Link) Expires() time.Time {
+	return time.Unix(l.ExpiresAt, 0).UTC()
+}
+
+// secret returns the key links are signed with (see config.EnvSecret)
+var secret = config.EnvSecret("REPORT_LINK_SECRET", "shared report links")
+
+func sign(payload []byte) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// MaxTTL returns the longest a link may last
+func MaxTTL() time.Duration {
+	return config.EnvDuration("REPORT_LINK_MAX_TTL", defaultMaxTTL)
+}
+
+// Token signs a link
+func Token(link Link) (string, error) {
+	payload, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + sign(payload), nil
+}
+
+// Verify checks a token's signature and expiry, returning its link
+func Verify(token string) (Link, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Link{}, ErrInvalidLink
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Link{}, ErrInvalidLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(payload))) {
+		return Link{}, ErrInvalidLink
+	}
+
+	var link Link
+	if err := json.Unmarshal(payload, &link); err != nil || link.Report == "" || link.ClinicID == "" {
+		return Link{}, ErrInvalidLink
+	}
+	if time.Now().Unix() >= link.ExpiresAt {
+		return Link{}, ErrExpiredLink
+	}
+	return link, nil
+}
+
+// URL returns the public URL a shared report is read from
+func URL(token string) string {
+	return config.EnvString("REPORT_LINK_BASE_URL", "http://localhost:8080/api/v1/financial/shared") + "/" + token
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ExpenseFilter selects the expenses of a list; empty fields match every
+// expense. Expenses without a status are approved.
+type ExpenseFilter struct {
+	Category models.ExpenseCategory
+	Status   models.ExpenseStatus
+	Date     DateRange
+}
+
+// ExpenseRepository stores expenses
+type ExpenseRepository interface {
+	Get(ctx context.Context, id string) (models.Expense, error)
+	// List returns a page of the expenses the filter matches starting at the
+	// page's cursor and the cursor of the next page, empty on the last one
+	List(ctx context.Context, filter ExpenseFilter, page paging.Page) ([]models.Expense, string, error)
+	Create(ctx context.Context, expense models.Expense) error
+	// Update replaces an existing expense, failing with
+	// config.ErrVersionConflict when it changed since it was read
+	Update(ctx context.Context, expense models.Expense) error
+	Delete(ctx context.Context, id string) error
+}
+
+// DynamoExpenses stores expenses in the Expenses table
+type DynamoExpenses struct{}
+
+const expensesTable = "Expenses"
+
+// Get reads an expense by ID
+func (DynamoExpenses) Get(ctx context.Context, id string) (models.Expense, error) {
+	var expense models.Expense
+	err := records.Get(ctx, expensesTable, id, &expense)
+	return expense, err
+}
+
+// List reads a page of the expenses the filter matches
+func (DynamoExpenses) List(ctx context.Context, filter ExpenseFilter, page paging.Page) ([]models.Expense, string, error) {
+	input := &dynamodb.ScanInput{TableName: aws.String(expensesTable)}
+	var filters []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	if filter.Category != "" {
+		filters = append(filters, "Category = :category")
+		values[":category"] = &types.AttributeValueMemberS{Value: string(filter.Category)}
+	}
+	switch filter.Status {
+	case "":
+	case models.ExpenseStatusApproved:
+		filters = append(filters, "(attribute_not_exists(#status) OR #status <> :draft)")
+		names["#status"] = "Status"
+		values[":draft"] = &types.AttributeValueMemberS{Value: string(models.ExpenseStatusDraft)}
+	default:
+		filters = append(filters, "#status = :status")
+		names["#status"] = "Status"
+		values[":status"] = &types.AttributeValueMemberS{Value: string(filter.Status)}
+	}
+	filter.Date.Filter("Date", &filters, names, values)
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+		if len(names) > 0 {
+			input.ExpressionAttributeNames = names
+		}
+	}
+	return paging.Scan[models.Expense](ctx, input, page)
+}
+
+// Create writes a new expense
+func (DynamoExpenses) Create(ctx context.Context, expense models.Expense) error {
+	return putExpense(ctx, expense, true)
+}
+
+// Update replaces an existing expense
+func (DynamoExpenses) Update(ctx context.Context, expense models.Expense) error {
+	return putExpense(ctx, expense, false)
+}
+
+// Delete removes an expense
+func (DynamoExpenses) Delete(ctx context.Context, id string) error {
+	return records.Remove(ctx, expensesTable, id)
+}
+
+func putExpense(ctx context.Context, expense models.Expense, create bool) error {
+	item, err := attributevalue.MarshalMap(expense)
+	if err != nil {
+		return err
+	}
+	return records.Put(ctx, expensesTable, item, create)
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+)
+
+// MemoryRevenues stores revenues in memory, for tests of the services and
+// handlers that need no DynamoDB
+type MemoryRevenues struct {
+	store *records.Memory[models.Revenue]
+}
+
+// NewMemoryRevenues returns a MemoryRevenues holding revenues
+func NewMemoryRevenues(revenues ...models.Revenue) *MemoryRevenues {
+	return &MemoryRevenues{store: records.NewMemory(
+		func(r models.Revenue) string { return r.ID },
+		nil,
+		revenues,
+	)}
+}
+
+// Get reads a revenue by ID
+func (r *MemoryRevenues) Get(_ context.Context, id string) (models.Revenue, error) {
+	return r.store.Get(id)
+}
+
+// List reads a page of the revenues the filter matches, sorted by ID
+func (r *MemoryRevenues) List(_ context.Context, filter RevenueFilter, page paging.Page) ([]models.Revenue, string, error) {
+	return r.store.List(page, func(revenue models.Revenue) bool {
+		return (filter.PatientID == "" || revenue.PatientID == filter.PatientID) &&
+			(filter.Status == "" || revenue.PaymentStatus == filter.Status) &&
+			filter.DueDate.Contains(revenue.DueDate)
+	})
+}
+
+// Create stores a new revenue
+func (r *MemoryRevenues) Create(_ context.Context, revenue models.Revenue) error {
+	return r.store.Put(revenue, true)
+}
+
+// Update replaces an existing revenue
+func (r *MemoryRevenues) Update(_ context.Context, revenue models.Revenue) error {
+	return r.store.Put(revenue, false)
+}
+
+// Delete removes a revenue
+func (r *MemoryRevenues) Delete(_ context.Context, id string) error {
+	_, err := r.store.Delete(id)
+	return err
+}
+
+// MemoryExpenses stores expenses in memory, like MemoryRevenues
+type MemoryExpenses struct {
+	store *records.Memory[models.Expense]
+}
+
+// NewMemoryExpenses returns a MemoryExpenses holding expenses
+func NewMemoryExpenses(expenses ...models.Expense) *MemoryExpenses {
+	return &MemoryExpenses{store: records.NewMemory(
+		func(e models.Expense) string { return e.ID },
+		nil,
+		expenses,
+	)}
+}
+
+// Get reads an expense by ID
+func (r *MemoryExpenses) Get(_ context.Context, id string) (models.Expense, error) {
+	return r.store.Get(id)
+}
+
+// List reads a page of the expenses the filter matches, sorted by ID
+func (r *MemoryExpenses) List(_ context.Context, filter ExpenseFilter, page paging.Page) ([]models.Expense, string, error) {
+	return r.store.List(page, func(expense models.Expense) bool {
+		status := expense.Status
+		if status == "" {
+			status = models.ExpenseStatusApproved
+		}
+		return (filter.Category == "" || expense.Category == filter.Category) &&
+			(filter.Status == "" || status == filter.Status) &&
+			filter.Date.Contains(expense.Date)
+	})
+}
+
+// Create stores a new expense
+func (r *MemoryExpenses) Create(_ context.Context, expense models.Expense) error {
+	return r.store.Put(expense, true)
+}
+
+// Update replaces an existing expense
+func (r *MemoryExpenses) Update(_ context.Context, expense models.Expense) error {
+	return r.store.Put(expense, false)
+}
+
+// Delete removes an expense
+func (r *MemoryExpenses) Delete(_ context.Context, id string) error {
+	_, err := r.store.Delete(id)
+	return err
+}
+
+var (
+	_ RevenueRepository = (*MemoryRevenues)(nil)
+	_ ExpenseRepository = (*MemoryExpenses)(nil)
+)
@@ -0,0 +1,47 @@
+// Package repository holds the storage of the revenues and expenses behind
+// interfaces, like the dental repositories: DynamoDB in production, and
+// memory for the tests of the services.
+package repository
+
+import (
+	"dental-saas/shared/records"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Errors returned by every repository
+var (
+	ErrNotFound      = records.ErrNotFound
+	ErrAlreadyExists = records.ErrAlreadyExists
+)
+
+// DateRange limits a list to the records booked from From, inclusive, to
+// To, exclusive. A zero bound leaves its side open.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t falls in the range
+func (d DateRange) Contains(t time.Time) bool {
+	if !d.From.IsZero() && t.Before(d.From) {
+		return false
+	}
+	return d.To.IsZero() || t.Before(d.To)
+}
+
+// Filter adds the range, on a date attribute, to the filters of a scan
+func (d DateRange) Filter(attribute string, filters *[]string, names map[string]string, values map[string]types.AttributeValue) {
+	if !d.From.IsZero() || !d.To.IsZero() {
+		names["#range"] = attribute
+	}
+	if !d.From.IsZero() {
+		*filters = append(*filters, "#range >= :from")
+		values[":from"] = &types.AttributeValueMemberS{Value: d.From.Format("2006-01-02")}
+	}
+	if !d.To.IsZero() {
+		*filters = append(*filters, "#range < :to")
+		values[":to"] = &types.AttributeValueMemberS{Value: d.To.Format("2006-01-02")}
+	}
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/records"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// RevenueFilter selects the revenues of a list; empty fields match every
+// revenue
+type RevenueFilter struct {
+	PatientID string
+	Status    models.PaymentStatus
+	DueDate   DateRange
+}
+
+// RevenueRepository stores revenues
+type RevenueRepository interface {
+	Get(ctx context.Context, id string) (models.Revenue, error)
+	// List returns a page of the revenues the filter matches starting at the
+	// page's cursor and the cursor of the next page, empty on the last one
+	List(ctx context.Context, filter RevenueFilter, page paging.Page) ([]models.Revenue, string, error)
+	Create(ctx context.Context, revenue models.Revenue) error
+	// Update replaces an existing revenue, failing with
+	// config.ErrVersionConflict when it changed since it was read
+	Update(ctx context.Context, revenue models.Revenue) error
+	Delete(ctx context.Context, id string) error
+}
+
+// DynamoRevenues stores revenues in the Revenues table
+type DynamoRevenues struct{}
+
+const revenuesTable = "Revenues"
+
+// Get reads a revenue by ID
+func (DynamoRevenues) Get(ctx context.Context, id string) (models.Revenue, error) {
+	var revenue models.Revenue
+	err := records.Get(ctx, revenuesTable, id, &revenue)
+	return revenue, err
+}
+
+// List reads a page of the revenues the filter matches
+func (DynamoRevenues) List(ctx context.Context, filter RevenueFilter, page paging.Page) ([]models.Revenue, string, error) {
+	input := &dynamodb.ScanInput{TableName: aws.String(revenuesTable)}
+	var filters []string
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	if filter.PatientID != "" {
+		filters = append(filters, "PatientID = :patientId")
+		values[":patientId"] = &types.AttributeValueMemberS{Value: filter.PatientID}
+	}
+	if filter.Status != "" {
+		filters = append(filters, "PaymentStatus = :status")
+		values[":status"] = &types.AttributeValueMemberS{Value: string(filter.Status)}
+	}
+	filter.DueDate.Filter("DueDate", &filters, names, values)
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeValues = values
+		if len(names) > 0 {
+			input.ExpressionAttributeNames = names
+		}
+	}
+	return paging.Scan[models.Revenue](ctx, input, page)
+}
+
+// Create writes a new revenue
+func (DynamoRevenues) Create(ctx context.Context, revenue models.Revenue) error {
+	return putRevenue(ctx, revenue, true)
+}
+
+// Update replaces an existing revenue
+func (DynamoRevenues) Update(ctx context.Context, revenue models.Revenue) error {
+	return putRevenue(ctx, revenue, false)
+}
+
+// Delete removes a revenue
+func (DynamoRevenues) Delete(ctx context.Context, id string) error {
+	return records.Remove(ctx, revenuesTable, id)
+}
+
+func putRevenue(ctx context.Context, revenue models.Revenue, create bool) error {
+	item, err := attributevalue.MarshalMap(revenue)
+	if err != nil {
+		return err
+	}
+	return records.Put(ctx, revenuesTable, item, create)
+}
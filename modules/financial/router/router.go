@@ -0,0 +1,89 @@
+package router
+
+import (
+	"dental-saas/modules/financial/handlers"
+	"dental-saas/modules/financial/models"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/budget"
+	"dental-saas/shared/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// NewFinancialRouter creates and configures routes for the financial module
+func NewFinancialRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Reports shared by signed link are read without an account
+	r.HandleFunc("/api/v1/financial/shared/{token}", handlers.GetSharedReport).Methods("GET")
+
+	// Create a subrouter for financial module with /api/v1/financial prefix
+	financialRouter := r.PathPrefix("/api/v1/financial").Subrouter()
+	// Only accountants and admins work with the clinic's finances
+	financialRouter.Use(auth.Require(auth.RoleAccountant))
+
+	// Expense routes
+	financialRouter.HandleFunc("/expense", handlers.CreateExpense).Methods("POST")
+	financialRouter.Handle("/expense", budget.ListFunc(handlers.GetAllExpenses)).Methods("GET")
+	financialRouter.HandleFunc("/expense/$schema", schema.Handler("Expense", models.Expense{}, "description", "amount", "category", "date")).Methods("GET")
+	financialRouter.HandleFunc("/expense/from-receipt", handlers.CreateExpenseFromReceipt).Methods("POST")
+	financialRouter.HandleFunc("/expense/{id}", handlers.GetExpenseByID).Methods("GET")
+	financialRouter.HandleFunc("/expense/{id}", handlers.UpdateExpense).Methods("PUT")
+	financialRouter.HandleFunc("/expense/{id}", handlers.DeleteExpense).Methods("DELETE")
+
+	// Revenue routes
+	financialRouter.HandleFunc("/revenue", handlers.CreateRevenue).Methods("POST")
+	financialRouter.Handle("/revenue", budget.ListFunc(handlers.GetAllRevenues)).Methods("GET")
+	financialRouter.HandleFunc("/revenue/$schema", schema.Handler("Revenue", models.Revenue{}, "description", "amount", "patient_id", "payment_method", "payment_status", "due_date")).Methods("GET")
+	financialRouter.HandleFunc("/revenue/overdue", handlers.GetOverdueRevenues).Methods("GET")
+	financialRouter.HandleFunc("/revenue/{id}", handlers.GetRevenueByID).Methods("GET")
+	financialRouter.HandleFunc("/revenue/{id}", handlers.UpdateRevenue).Methods("PUT")
+	financialRouter.HandleFunc("/revenue/{id}", handlers.DeleteRevenue).Methods("DELETE")
+	financialRouter.HandleFunc("/revenue/{id}/pay", handlers.PayRevenue).Methods("POST")
+	financialRouter.HandleFunc("/revenue/{id}/apply-credit", handlers.ApplyCreditToRevenue).Methods("POST")
+	financialRouter.HandleFunc("/revenue/{id}/splits", handlers.SetRevenueSplits).Methods("PUT")
+	financialRouter.HandleFunc("/revenue/{id}/splits/{splitId}/pay", handlers.PayRevenueSplit).Methods("POST")
+
+	// Invoice routes
+	financialRouter.HandleFunc("/invoice", handlers.CreateInvoice).Methods("POST")
+	financialRouter.Handle("/invoice", budget.ListFunc(handlers.GetAllInvoices)).Methods("GET")
+	financialRouter.HandleFunc("/invoice/$schema", schema.Handler("Invoice", models.Invoice{}, "number", "type", "patient_id", "patient_name", "items", "issue_date", "due_date")).Methods("GET")
+	financialRouter.HandleFunc("/invoice/{id}", handlers.GetInvoiceByID).Methods("GET")
+	financialRouter.HandleFunc("/invoice/{id}/pdf", handlers.GetInvoicePDF).Methods("GET")
+	financialRouter.HandleFunc("/invoice/{id}", handlers.UpdateInvoice).Methods("PUT")
+	financialRouter.HandleFunc("/invoice/{id}", handlers.DeleteInvoice).Methods("DELETE")
+
+	// Prepaid credit and gift voucher routes
+	financialRouter.HandleFunc("/voucher", handlers.SellVoucher).Methods("POST")
+	financialRouter.HandleFunc("/voucher/{code}", handlers.GetVoucher).Methods("GET")
+	financialRouter.HandleFunc("/voucher/{code}/redeem", handlers.RedeemVoucher).Methods("POST")
+	financialRouter.HandleFunc("/credit/{patientId}", handlers.GetCreditBalance).Methods("GET")
+	financialRouter.HandleFunc("/credit/{patientId}/top-up", handlers.TopUpCredit).Methods("POST")
+
+	// Equipment asset routes
+	financialRouter.HandleFunc("/asset", handlers.CreateAsset).Methods("POST")
+	financialRouter.Handle("/asset", budget.ListFunc(handlers.GetAllAssets)).Methods("GET")
+	financialRouter.HandleFunc("/asset/$schema", schema.Handler("Asset", models.Asset{}, "name", "category", "purchase_date")).Methods("GET")
+	financialRouter.HandleFunc("/asset/{id}", handlers.GetAssetByID).Methods("GET")
+	financialRouter.HandleFunc("/asset/{id}", handlers.UpdateAsset).Methods("PUT")
+	financialRouter.HandleFunc("/asset/{id}", handlers.DeleteAsset).Methods("DELETE")
+	financialRouter.HandleFunc("/asset/{id}/maintenance", handlers.RecordMaintenance).Methods("POST")
+	financialRouter.HandleFunc("/asset/{id}/maintenance", handlers.GetMaintenanceHistory).Methods("GET")
+
+	// Financial period closing routes
+	financialRouter.HandleFunc("/period", handlers.GetPeriods).Methods("GET")
+	financialRouter.HandleFunc("/period/{month}", handlers.GetPeriod).Methods("GET")
+	financialRouter.HandleFunc("/period/{month}/close", handlers.ClosePeriod).Methods("POST")
+	financialRouter.HandleFunc("/period/{month}/adjustment", handlers.CreateAdjustment).Methods("POST")
+
+	// Patient statement routes
+	financialRouter.HandleFunc("/patient/{id}/statement", handlers.GetPatientStatement).Methods("GET")
+
+	// Report routes
+	financialRouter.HandleFunc("/reports/forecast", handlers.GetRevenueForecast).Methods("GET")
+	financialRouter.HandleFunc("/reports/top-patients", handlers.GetTopPatients).Methods("GET")
+	financialRouter.HandleFunc("/reports/consolidated", handlers.GetConsolidatedReport).Methods("GET")
+	financialRouter.HandleFunc("/reports/share", handlers.ShareReport).Methods("POST")
+
+	return r
+}
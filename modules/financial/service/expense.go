@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/shared/paging"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExpenseService manages expenses. Like revenues, every write is refused
+// with periods.ErrClosed when the expense is dated, before or after the
+// change, in a closed financial period.
+type ExpenseService interface {
+	// Create records an expense, or an adjusting entry when AdjustsPeriod is
+	// set
+	Create(ctx context.Context, expense models.Expense) (models.Expense, error)
+	Get(ctx context.Context, id string) (models.Expense, error)
+	List(ctx context.Context, filter repository.ExpenseFilter, page paging.Page) ([]models.Expense, string, error)
+	// Update changes the fields set in changes; approving a draft is done by
+	// setting the approved status
+	Update(ctx context.Context, id string, changes models.Expense) (models.Expense, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// NewExpenseService returns an ExpenseService storing expenses in repo and
+// checking their dates against periods
+func NewExpenseService(repo repository.ExpenseRepository, periods Periods) ExpenseService {
+	return &expenseService{repo: repo, periods: periods}
+}
+
+type expenseService struct {
+	repo    repository.ExpenseRepository
+	periods Periods
+}
+
+func (s *expenseService) Create(ctx context.Context, expense models.Expense) (models.Expense, error) {
+	if expense.ID == "" {
+		expense.ID = uuid.NewString()
+	}
+	if err := expense.IsValid(); err != nil {
+		return models.Expense{}, &ValidationError{Err: err}
+	}
+	if err := s.periods.CheckOpen(ctx, expense.Date); err != nil {
+		return models.Expense{}, err
+	}
+
+	now := time.Now().UTC()
+	expense.CreatedAt = now
+	expense.UpdatedAt = now
+	if err := s.repo.Create(ctx, expense); err != nil {
+		return models.Expense{}, err
+	}
+	return expense, nil
+}
+
+func (s *expenseService) Get(ctx context.Context, id string) (models.Expense, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *expenseService) List(ctx context.Context, filter repository.ExpenseFilter, page paging.Page) ([]models.Expense, string, error) {
+	return s.repo.List(ctx, filter, page)
+}
+
+func (s *expenseService) Update(ctx context.Context, id string, changes models.Expense) (models.Expense, error) {
+	expense, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Expense{}, err
+	}
+	previousDate := expense.Date
+	if changes.Description != "" {
+		expense.Description = changes.Description
+	}
+	if changes.Amount != 0 {
+		expense.Amount = changes.Amount
+	}
+	if changes.Category != "" {
+		expense.Category = changes.Category
+	}
+	if !changes.Date.IsZero() {
+		expense.Date = changes.Date
+	}
+	if changes.Supplier != "" {
+		expense.Supplier = changes.Supplier
+	}
+	if changes.InvoiceID != "" {
+		expense.InvoiceID = changes.InvoiceID
+	}
+	if changes.Status != "" {
+		expense.Status = changes.Status
+	}
+	if changes.StaffID != "" {
+		expense.StaffID = changes.StaffID
+	}
+	if err := expense.IsValid(); err != nil {
+		return models.Expense{}, &ValidationError{Err: err}
+	}
+	if err := s.periods.CheckOpen(ctx, previousDate, expense.Date); err != nil {
+		return models.Expense{}, err
+	}
+
+	expense.UpdatedAt = time.Now().UTC()
+	if err := s.repo.Update(ctx, expense); err != nil {
+		return models.Expense{}, err
+	}
+	return expense, nil
+}
+
+func (s *expenseService) Delete(ctx context.Context, id string) error {
+	expense, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.periods.CheckOpen(ctx, expense.Date); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/live"
+	"dental-saas/shared/paging"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors of the revenue payments and splits
+var (
+	// ErrNotPending is returned when paying or splitting a revenue that is
+	// no longer pending
+	ErrNotPending = errors.New("revenue is not pending")
+	// ErrSplit is returned when paying in full, or changing the amount or
+	// status of, a revenue split between payers
+	ErrSplit = errors.New("revenue is split between payers")
+	// ErrPaidSplits is returned when re-splitting a revenue with paid splits
+	ErrPaidSplits = errors.New("revenue has paid splits")
+	// ErrSplitNotFound is returned when paying a split the revenue lacks
+	ErrSplitNotFound = errors.New("split not found")
+	// ErrSplitNotPending is returned when paying a split already settled
+	ErrSplitNotPending = errors.New("split is not pending")
+	// ErrCreditApplied is returned when deleting a revenue paid in part with
+	// prepaid credit, which would leave the credit ledger inconsistent
+	ErrCreditApplied = errors.New("revenue has prepaid credit applied")
+)
+
+// RevenueService manages revenues. Every write is refused with
+// periods.ErrClosed when the revenue is due, before or after the change, in
+// a closed financial period, and deletes with legalhold.ErrHeld when the
+// revenue or its patient is under legal hold.
+type RevenueService interface {
+	// Create records a revenue, or an adjusting entry when AdjustsPeriod is
+	// set. A revenue created paid is paid now unless it has a paid date.
+	Create(ctx context.Context, revenue models.Revenue) (models.Revenue, error)
+	Get(ctx context.Context, id string) (models.Revenue, error)
+	List(ctx context.Context, filter repository.RevenueFilter, page paging.Page) ([]models.Revenue, string, error)
+	// Update changes the fields set in changes and returns the revenue as
+	// updated and as it was before. Marking it paid without a paid date
+	// records the current time.
+	Update(ctx context.Context, id string, changes models.Revenue) (models.Revenue, models.Revenue, error)
+	// Pay marks a pending revenue paid in full
+	Pay(ctx context.Context, id string, payment models.RevenuePaymentRequest) (models.Revenue, error)
+	// SetSplits splits the amount due of a pending revenue between payers;
+	// no splits removes the split
+	SetSplits(ctx context.Context, id string, splits []models.RevenueSplit) (models.Revenue, error)
+	// PaySplit marks one split paid, paying the revenue with the last one
+	PaySplit(ctx context.Context, id, splitID string, payment models.SplitPayment) (models.Revenue, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// NewRevenueService returns a RevenueService storing revenues in repo,
+// checking their dates against periods and their deletes against holds
+func NewRevenueService(repo repository.RevenueRepository, periods Periods, holds Holds) RevenueService {
+	return &revenueService{repo: repo, periods: periods, holds: holds}
+}
+
+type revenueService struct {
+	repo    repository.RevenueRepository
+	periods Periods
+	holds   Holds
+}
+
+func (s *revenueService) Create(ctx context.Context, revenue models.Revenue) (models.Revenue, error) {
+	if revenue.ID == "" {
+		revenue.ID = uuid.NewString()
+	}
+	if err := revenue.IsValid(); err != nil {
+		return models.Revenue{}, &ValidationError{Err: err}
+	}
+	if err := s.periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return models.Revenue{}, err
+	}
+
+	now := time.Now().UTC()
+	if revenue.PaymentStatus == models.PaymentStatusPaid && revenue.PaidDate == nil {
+		revenue.PaidDate = &now
+	}
+	revenue.CreatedAt = now
+	revenue.UpdatedAt = now
+	if err := s.repo.Create(ctx, revenue); err != nil {
+		return models.Revenue{}, err
+	}
+	live.Metrics.Touch()
+	return revenue, nil
+}
+
+func (s *revenueService) Get(ctx context.Context, id string) (models.Revenue, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *revenueService) List(ctx context.Context, filter repository.RevenueFilter, page paging.Page) ([]models.Revenue, string, error) {
+	return s.repo.List(ctx, filter, page)
+}
+
+func (s *revenueService) Update(ctx context.Context, id string, changes models.Revenue) (models.Revenue, models.Revenue, error) {
+	previous, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Revenue{}, models.Revenue{}, err
+	}
+	if len(previous.Splits) > 0 &&
+		((changes.Amount != 0 && changes.Amount != previous.Amount) ||
+			(changes.PaymentStatus != "" && changes.PaymentStatus != previous.PaymentStatus && changes.PaymentStatus != models.PaymentStatusCancelled && changes.PaymentStatus != models.PaymentStatusRefunded)) {
+		return models.Revenue{}, models.Revenue{}, ErrSplit
+	}
+	if changes.Amount != 0 && changes.Amount < previous.CreditApplied {
+		return models.Revenue{}, models.Revenue{}, &ValidationError{Err: fmt.Errorf("amount must not be less than the credit applied")}
+	}
+
+	revenue := previous
+	if changes.Description != "" {
+		revenue.Description = changes.Description
+	}
+	if changes.Amount != 0 {
+		revenue.Amount = changes.Amount
+	}
+	if changes.PatientID != "" {
+		revenue.PatientID = changes.PatientID
+	}
+	if changes.ProcedureID != "" {
+		revenue.ProcedureID = changes.ProcedureID
+	}
+	if changes.AppointmentID != "" {
+		revenue.AppointmentID = changes.AppointmentID
+	}
+	if changes.PaymentMethod != "" {
+		revenue.PaymentMethod = changes.PaymentMethod
+	}
+	if changes.PaymentStatus != "" {
+		revenue.PaymentStatus = changes.PaymentStatus
+	}
+	if !changes.DueDate.IsZero() {
+		revenue.DueDate = changes.DueDate
+	}
+	if changes.PaidDate != nil {
+		revenue.PaidDate = changes.PaidDate
+	}
+	if changes.InvoiceID != "" {
+		revenue.InvoiceID = changes.InvoiceID
+	}
+	if err := revenue.IsValid(); err != nil {
+		return models.Revenue{}, models.Revenue{}, &ValidationError{Err: err}
+	}
+	if err := s.periods.CheckOpen(ctx, previous.DueDate, revenue.DueDate); err != nil {
+		return models.Revenue{}, models.Revenue{}, err
+	}
+
+	now := time.Now().UTC()
+	if revenue.PaymentStatus == models.PaymentStatusPaid && revenue.PaidDate == nil {
+		revenue.PaidDate = &now
+	}
+	if revenue.PaymentStatus == models.PaymentStatusPending && len(revenue.Splits) == 0 {
+		revenue.PaidDate = nil
+	}
+	revenue.UpdatedAt = now
+	if err := s.save(ctx, revenue); err != nil {
+		return models.Revenue{}, models.Revenue{}, err
+	}
+	return revenue, previous, nil
+}
+
+func (s *revenueService) Pay(ctx context.Context, id string, payment models.RevenuePaymentRequest) (models.Revenue, error) {
+	if payment.PaymentMethod == "" {
+		return models.Revenue{}, &ValidationError{Err: fmt.Errorf("payment method is required")}
+	}
+	if payment.PaymentMethod == models.PaymentMethodCredit {
+		return models.Revenue{}, &ValidationError{Err: fmt.Errorf("prepaid credit is applied through apply-credit")}
+	}
+
+	revenue, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Revenue{}, err
+	}
+	if revenue.PaymentStatus != models.PaymentStatusPending {
+		return models.Revenue{}, ErrNotPending
+	}
+	if len(revenue.Splits) > 0 {
+		return models.Revenue{}, ErrSplit
+	}
+	if err := s.periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return models.Revenue{}, err
+	}
+
+	now := time.Now().UTC()
+	paidDate := now
+	if payment.PaidDate != nil {
+		paidDate = payment.PaidDate.UTC()
+	}
+	revenue.PaymentMethod = payment.PaymentMethod
+	revenue.PaymentStatus = models.PaymentStatusPaid
+	revenue.PaidDate = &paidDate
+	revenue.UpdatedAt = now
+	if err := s.save(ctx, revenue); err != nil {
+		return models.Revenue{}, err
+	}
+	return revenue, nil
+}
+
+func (s *revenueService) SetSplits(ctx context.Context, id string, splits []models.RevenueSplit) (models.Revenue, error) {
+	revenue, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Revenue{}, err
+	}
+	if revenue.PaymentStatus != models.PaymentStatusPending {
+		return models.Revenue{}, ErrNotPending
+	}
+	for _, split := range revenue.Splits {
+		if split.PaymentStatus == models.PaymentStatusPaid {
+			return models.Revenue{}, ErrPaidSplits
+		}
+	}
+	if err := revenue.ValidateSplits(splits); err != nil {
+		return models.Revenue{}, &ValidationError{Err: err}
+	}
+	if err := s.periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return models.Revenue{}, err
+	}
+
+	revenue.Splits = make([]models.RevenueSplit, len(splits))
+	for i, split := range splits {
+		revenue.Splits[i] = models.RevenueSplit{
+			ID:            uuid.NewString(),
+			Payer:         split.Payer,
+			PayerName:     split.PayerName,
+			Amount:        split.Amount,
+			PaymentMethod: split.PaymentMethod,
+			PaymentStatus: models.PaymentStatusPending,
+		}
+	}
+	revenue.UpdatedAt = time.Now().UTC()
+	if err := s.save(ctx, revenue); err != nil {
+		return models.Revenue{}, err
+	}
+	return revenue, nil
+}
+
+func (s *revenueService) PaySplit(ctx context.Context, id, splitID string, payment models.SplitPayment) (models.Revenue, error) {
+	if payment.PaymentMethod == "" {
+		return models.Revenue{}, &ValidationError{Err: fmt.Errorf("payment method is required")}
+	}
+
+	revenue, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return models.Revenue{}, err
+	}
+	index := -1
+	for i, split := range revenue.Splits {
+		if split.ID == splitID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return models.Revenue{}, ErrSplitNotFound
+	}
+	if revenue.PaymentStatus != models.PaymentStatusPending || revenue.Splits[index].PaymentStatus != models.PaymentStatusPending {
+		return models.Revenue{}, ErrSplitNotPending
+	}
+	if err := s.periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return models.Revenue{}, err
+	}
+
+	now := time.Now().UTC()
+	paidDate := now
+	if payment.PaidDate != nil {
+		paidDate = payment.PaidDate.UTC()
+	}
+	revenue.Splits[index].PaymentMethod = payment.PaymentMethod
+	revenue.Splits[index].PaymentStatus = models.PaymentStatusPaid
+	revenue.Splits[index].PaidDate = &paidDate
+	revenue.SettleSplits()
+	revenue.UpdatedAt = now
+	if err := s.save(ctx, revenue); err != nil {
+		return models.Revenue{}, err
+	}
+	return revenue, nil
+}
+
+func (s *revenueService) Delete(ctx context.Context, id string) error {
+	revenue, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if revenue.CreditApplied != 0 {
+		return ErrCreditApplied
+	}
+	if err := s.periods.CheckOpen(ctx, revenue.DueDate); err != nil {
+		return err
+	}
+	if err := s.holds.Check(ctx, legalhold.RecordRevenue, revenue.ID, revenue.PatientID); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	live.Metrics.Touch()
+	return nil
+}
+
+// save writes a revenue back only if it is still at the version it was read
+// at, so concurrent split payments or credit applications are not lost
+func (s *revenueService) save(ctx context.Context, revenue models.Revenue) error {
+	if err := s.repo.Update(ctx, revenue); err != nil {
+		return err
+	}
+	live.Metrics.Touch()
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package service holds the business rules of the revenues and expenses:
+// ID and timestamp assignment, validation, the merging of partial updates,
+// payments and the closed financial periods no write may touch. Like the
+// dental services, it reads and writes through the repository interfaces.
+package service
+
+import (
+	"context"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/shared/records"
+	"time"
+)
+
+// ValidationError is returned when a record fails validation; its message is
+// safe to show to the client
+type ValidationError = records.ValidationError
+
+// Aliases of the repository errors, so callers need not import both packages
+var (
+	ErrNotFound      = repository.ErrNotFound
+	ErrAlreadyExists = repository.ErrAlreadyExists
+)
+
+// Periods checks that records are booked in open financial periods,
+// returning periods.ErrClosed when any of the dates falls in a closed one
+type Periods interface {
+	CheckOpen(ctx context.Context, dates ...time.Time) error
+}
+
+// PeriodsFunc adapts a function, such as periods.CheckOpen, to Periods
+type PeriodsFunc func(ctx context.Context, dates ...time.Time) error
+
+// CheckOpen calls f
+func (f PeriodsFunc) CheckOpen(ctx context.Context, dates ...time.Time) error {
+	return f(ctx, dates...)
+}
+
+// Holds checks that a record about to be deleted is not under legal hold,
+// itself or through its patient, returning legalhold.ErrHeld when it is
+type Holds interface {
+	Check(ctx context.Context, recordType, id, patientID string) error
+}
+
+// HoldsFunc adapts a function, such as legalhold.Check, to Holds
+type HoldsFunc func(ctx context.Context, recordType, id, patientID string) error
+
+// Check calls f
+func (f HoldsFunc) Check(ctx context.Context, recordType, id, patientID string) error {
+	return f(ctx, recordType, id, patientID)
+}
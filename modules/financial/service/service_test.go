@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/modules/financial/repository"
+	"dental-saas/shared/legalhold"
+	"dental-saas/shared/paging"
+	"errors"
+	"testing"
+	"time"
+)
+
+// closedMonths returns Periods refusing the dates of the months given
+func closedMonths(months ...string) Periods {
+	return PeriodsFunc(func(_ context.Context, dates ...time.Time) error {
+		for _, date := range dates {
+			for _, month := range months {
+				if !date.IsZero() && periods.Month(date) == month {
+					return periods.ErrClosed
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// heldRecords returns Holds refusing the records and patients given
+func heldRecords(ids ...string) Holds {
+	return HoldsFunc(func(_ context.Context, _, id, patientID string) error {
+		for _, held := range ids {
+			if held == id || held == patientID {
+				return legalhold.ErrHeld
+			}
+		}
+		return nil
+	})
+}
+
+func pendingRevenue(id string, due time.Time) models.Revenue {
+	return models.Revenue{
+		ID: id, Description: "Limpeza", Amount: 200, PatientID: "p1",
+		PaymentMethod: models.PaymentMethodPix, PaymentStatus: models.PaymentStatusPending, DueDate: due,
+	}
+}
+
+func TestRevenueServiceCreate(t *testing.T) {
+	ctx := context.Background()
+	revenues := NewRevenueService(repository.NewMemoryRevenues(), closedMonths("2024-01"), heldRecords())
+
+	revenue := pendingRevenue("", time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC))
+	revenue.PaymentStatus = models.PaymentStatusPaid
+	created, err := revenues.Create(ctx, revenue)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == "" || created.CreatedAt.IsZero() || created.PaidDate == nil {
+		t.Errorf("Create did not assign the ID, timestamps and paid date: %+v", created)
+	}
+
+	_, err = revenues.Create(ctx, pendingRevenue("", time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)))
+	if !errors.Is(err, periods.ErrClosed) {
+		t.Errorf("Create in a closed month = %v, want periods.ErrClosed", err)
+	}
+
+	invalid := pendingRevenue("", created.DueDate)
+	invalid.Amount = -10
+	var validation *ValidationError
+	if _, err := revenues.Create(ctx, invalid); !errors.As(err, &validation) {
+		t.Errorf("Create with a negative amount = %v, want a ValidationError", err)
+	}
+	invalid.AdjustsPeriod = "2024-01"
+	if _, err := revenues.Create(ctx, invalid); err != nil {
+		t.Errorf("Create of a negative adjusting entry: %v", err)
+	}
+}
+
+func TestRevenueServiceUpdate(t *testing.T) {
+	ctx := context.Background()
+	march := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	split := pendingRevenue("r2", march)
+	split.Splits = []models.RevenueSplit{{ID: "s1", Payer: models.PayerPatient, Amount: 200, PaymentStatus: models.PaymentStatusPending}}
+	revenues := NewRevenueService(repository.NewMemoryRevenues(pendingRevenue("r1", march), split), closedMonths("2024-01"), heldRecords())
+
+	updated, previous, err := revenues.Update(ctx, "r1", models.Revenue{PaymentStatus: models.PaymentStatusPaid})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if previous.PaymentStatus != models.PaymentStatusPending || updated.PaidDate == nil || updated.Amount != 200 {
+		t.Errorf("Update = %+v, previous %+v, want it paid now with the rest kept", updated, previous)
+	}
+
+	_, _, err = revenues.Update(ctx, "r1", models.Revenue{DueDate: time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)})
+	if !errors.Is(err, periods.ErrClosed) {
+		t.Errorf("Update moving into a closed month = %v, want periods.ErrClosed", err)
+	}
+	if _, _, err := revenues.Update(ctx, "r2", models.Revenue{Amount: 300}); !errors.Is(err, ErrSplit) {
+		t.Errorf("Update of the amount of a split revenue = %v, want ErrSplit", err)
+	}
+	if _, _, err := revenues.Update(ctx, "missing", models.Revenue{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of a missing revenue = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRevenueServiceSplitsAndPayments(t *testing.T) {
+	ctx := context.Background()
+	march := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	revenues := NewRevenueService(repository.NewMemoryRevenues(pendingRevenue("r1", march), pendingRevenue("r2", march)), closedMonths(), heldRecords())
+
+	revenue, err := revenues.SetSplits(ctx, "r1", []models.RevenueSplit{
+		{Payer: models.PayerPatient, Amount: 50},
+		{Payer: models.PayerInsurance, PayerName: "Odonto Seguros", Amount: 150},
+	})
+	if err != nil {
+		t.Fatalf("SetSplits: %v", err)
+	}
+	if _, err := revenues.Pay(ctx, "r1", models.RevenuePaymentRequest{PaymentMethod: models.PaymentMethodPix}); !errors.Is(err, ErrSplit) {
+		t.Errorf("Pay of a split revenue = %v, want ErrSplit", err)
+	}
+
+	revenue, err = revenues.PaySplit(ctx, "r1", revenue.Splits[0].ID, models.SplitPayment{PaymentMethod: models.PaymentMethodPix})
+	if err != nil || revenue.PaymentStatus != models.PaymentStatusPending {
+		t.Fatalf("PaySplit of the first split = %+v, %v, want the revenue still pending", revenue, err)
+	}
+	if _, err := revenues.PaySplit(ctx, "r1", revenue.Splits[0].ID, models.SplitPayment{PaymentMethod: models.PaymentMethodPix}); !errors.Is(err, ErrSplitNotPending) {
+		t.Errorf("second PaySplit = %v, want ErrSplitNotPending", err)
+	}
+	if _, err := revenues.SetSplits(ctx, "r1", nil); !errors.Is(err, ErrPaidSplits) {
+		t.Errorf("SetSplits with a paid split = %v, want ErrPaidSplits", err)
+	}
+	revenue, err = revenues.PaySplit(ctx, "r1", revenue.Splits[1].ID, models.SplitPayment{PaymentMethod: models.PaymentMethodPix})
+	if err != nil || revenue.PaymentStatus != models.PaymentStatusPaid {
+		t.Errorf("PaySplit of the last split = %+v, %v, want the revenue paid", revenue, err)
+	}
+
+	paid, err := revenues.Pay(ctx, "r2", models.RevenuePaymentRequest{PaymentMethod: models.PaymentMethodPix})
+	if err != nil || paid.PaymentStatus != models.PaymentStatusPaid || paid.PaidDate == nil {
+		t.Fatalf("Pay = %+v, %v, want it paid", paid, err)
+	}
+	if _, err := revenues.Pay(ctx, "r2", models.RevenuePaymentRequest{PaymentMethod: models.PaymentMethodPix}); !errors.Is(err, ErrNotPending) {
+		t.Errorf("second Pay = %v, want ErrNotPending", err)
+	}
+}
+
+func TestRevenueServiceDelete(t *testing.T) {
+	ctx := context.Background()
+	credited := pendingRevenue("r2", time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC))
+	credited.CreditApplied = 50
+	held := pendingRevenue("r4", time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC))
+	held.PatientID = "p2"
+	revenues := NewRevenueService(repository.NewMemoryRevenues(
+		pendingRevenue("r1", time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)),
+		credited,
+		pendingRevenue("r3", time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)),
+		held,
+	), closedMonths("2024-01"), heldRecords("p2"))
+
+	if err := revenues.Delete(ctx, "r1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := revenues.Get(ctx, "r1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted revenue = %v, want ErrNotFound", err)
+	}
+	if err := revenues.Delete(ctx, "r2"); !errors.Is(err, ErrCreditApplied) {
+		t.Errorf("Delete of a credited revenue = %v, want ErrCreditApplied", err)
+	}
+	if err := revenues.Delete(ctx, "r3"); !errors.Is(err, periods.ErrClosed) {
+		t.Errorf("Delete in a closed month = %v, want periods.ErrClosed", err)
+	}
+	if err := revenues.Delete(ctx, "r4"); !errors.Is(err, legalhold.ErrHeld) {
+		t.Errorf("Delete of a held patient's revenue = %v, want legalhold.ErrHeld", err)
+	}
+}
+
+func TestExpenseServiceUpdateAndList(t *testing.T) {
+	ctx := context.Background()
+	march := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	expenses := NewExpenseService(repository.NewMemoryExpenses(
+		models.Expense{ID: "e1", Description: "Luvas", Amount: 80, Category: models.ExpenseCategoryOther, Date: march, Status: models.ExpenseStatusDraft},
+		models.Expense{ID: "e2", Description: "Aluguel", Amount: 3000, Category: models.ExpenseCategoryOther, Date: march.AddDate(0, 0, 10)},
+	), closedMonths("2024-01"))
+
+	approved, err := expenses.Update(ctx, "e1", models.Expense{Status: models.ExpenseStatusApproved})
+	if err != nil || approved.Status != models.ExpenseStatusApproved || approved.Description != "Luvas" {
+		t.Fatalf("Update = %+v, %v, want the draft approved", approved, err)
+	}
+	if _, err := expenses.Update(ctx, "e1", models.Expense{Date: time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)}); !errors.Is(err, periods.ErrClosed) {
+		t.Errorf("Update moving into a closed month = %v, want periods.ErrClosed", err)
+	}
+
+	list, _, err := expenses.List(ctx, repository.ExpenseFilter{
+		Status: models.ExpenseStatusApproved,
+		Date:   repository.DateRange{From: march, To: march.AddDate(0, 0, 1)},
+	}, paging.Page{})
+	if err != nil || len(list) != 1 || list[0].ID != "e1" {
+		t.Errorf("List of the approved expenses of the day = %+v, %v, want e1", list, err)
+	}
+
+	if err := expenses.Delete(ctx, "e2"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := expenses.Delete(ctx, "e2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete = %v, want ErrNotFound", err)
+	}
+}
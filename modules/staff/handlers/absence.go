@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/staff/models"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateAbsence godoc
+// @Summary Record a staff absence
+// @Description Record a vacation, sick leave or other absence. Shifts already scheduled in the period are flagged as uncovered in the rota.
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param absence body models.Absence true "Absence data"
+// @Success 201 {object} models.Absence
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Staff member not found"
+// @Failure 500 {object} apierror.Response "Failed to save absence"
+// @Router /api/v1/staff/absence [post]
+func CreateAbsence(w http.ResponseWriter, r *http.Request) {
+	var absence models.Absence
+	if err := json.NewDecoder(r.Body).Decode(&absence); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	absence.ID = uuid.NewString()
+	if err := absence.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := getItem[models.StaffMember](r.Context(), "Staff", absence.StaffID); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Staff member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to save absence", http.StatusInternalServerError)
+		log.Printf("Error fetching staff member %s: %v", absence.StaffID, err)
+		return
+	}
+	absence.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putItem(r.Context(), "Absences", absence, true); err != nil {
+		http.Error(w, "Failed to save absence", http.StatusInternalServerError)
+		log.Printf("Error saving absence: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(absence)
+}
+
+// GetAbsences godoc
+// @Summary List staff absences
+// @Description List the absences overlapping a date range, optionally of a single staff member
+// @Tags shifts
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Param staffId query string false "Only absences of this staff member"
+// @Success 200 {array} models.Absence
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 500 {object} apierror.Response "Failed to retrieve absences"
+// @Router /api/v1/staff/absence [get]
+func GetAbsences(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absences, err := absencesInRange(r.Context(), from, to, query.Get("staffId"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve absences", http.StatusInternalServerError)
+		log.Printf("Error scanning absences: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(absences)
+}
+
+// DeleteAbsence godoc
+// @Summary Delete a staff absence
+// @Description Delete a staff absence by its ID
+// @Tags shifts
+// @Param id path string true "Absence ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Absence not found"
+// @Failure 500 {object} apierror.Response "Failed to delete absence"
+// @Router /api/v1/staff/absence/{id} [delete]
+func DeleteAbsence(w http.ResponseWriter, r *http.Request) {
+	if err := deleteItem(r.Context(), "Absences", mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Absence not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete absence", http.StatusInternalServerError)
+		log.Printf("Error deleting absence: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// absencesInRange returns the absences overlapping from..to (inclusive), ordered by start
+func absencesInRange(ctx context.Context, from, to, staffID string) ([]models.Absence, error) {
+	filter := "#from <= :to AND #to >= :from"
+	values := map[string]types.AttributeValue{
+		":from": &types.AttributeValueMemberS{Value: from},
+		":to":   &types.AttributeValueMemberS{Value: to},
+	}
+	if staffID != "" {
+		filter += " AND StaffID = :staffId"
+		values[":staffId"] = &types.AttributeValueMemberS{Value: staffID}
+	}
+
+	absences, err := paging.ScanAll[models.Absence](ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String("Absences"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  map[string]string{"#from": "From", "#to": "To"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if absences == nil {
+		absences = []models.Absence{}
+	}
+	sort.Slice(absences, func(i, j int) bool {
+		return absences[i].From < absences[j].From
+	})
+	return absences, nil
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	dentalmodels "dental-saas/modules/dental/models"
+	financialmodels "dental-saas/modules/financial/models"
+	"dental-saas/modules/financial/periods"
+	"dental-saas/modules/staff/models"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RunPayroll godoc
+// @Summary Run the monthly payroll
+// @Description Compute each staff member's pay for the month from their base salary, the hours of their recorded shifts (overtime beyond their monthly hours is paid with the PAYROLL_OVERTIME_PREMIUM) and the commission on paid revenues of their linked dentist, and record it as draft staff expenses. Running a month again replaces its drafts until it is approved.
+// @Tags payroll
+// @Produce json
+// @Param month path string true "Month (YYYY-MM)"
+// @Success 200 {object} models.PayrollRun
+// @Failure 400 {object} apierror.Response "Invalid month"
+// @Failure 409 {object} apierror.Response "Payroll already approved or financial period closed"
+// @Failure 500 {object} apierror.Response "Failed to run payroll"
+// @Router /api/v1/staff/payroll/{month}/run [post]
+func RunPayroll(w http.ResponseWriter, r *http.Request) {
+	month := mux.Vars(r)["month"]
+	if err := models.ValidateMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkPayrollPeriodOpen(w, r, month, "Failed to run payroll") {
+		return
+	}
+
+	previous, err := getPayrollRun(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to run payroll", http.StatusInternalServerError)
+		log.Printf("Error fetching payroll %s: %v", month, err)
+		return
+	}
+	if previous != nil && previous.Status == models.PayrollStatusApproved {
+		http.Error(w, "Payroll already approved", http.StatusConflict)
+		return
+	}
+
+	run, err := computePayroll(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to run payroll", http.StatusInternalServerError)
+		log.Printf("Error computing payroll %s: %v", month, err)
+		return
+	}
+
+	if previous != nil {
+		for _, id := range previous.ExpenseIDs() {
+			if err := deleteItem(r.Context(), "Expenses", id); err != nil && err != errNotFound {
+				http.Error(w, "Failed to run payroll", http.StatusInternalServerError)
+				log.Printf("Error removing draft payroll expense %s: %v", id, err)
+				return
+			}
+		}
+	}
+
+	lastDay := monthStart(month).AddDate(0, 1, -1)
+	now := time.Now().UTC()
+	for i := range run.Lines {
+		line := &run.Lines[i]
+		expense := financialmodels.Expense{
+			ID:          uuid.NewString(),
+			Description: fmt.Sprintf("Payroll %s - %s", month, line.StaffName),
+			Amount:      line.Total,
+			Category:    financialmodels.ExpenseCategoryStaff,
+			Date:        lastDay,
+			Status:      financialmodels.ExpenseStatusDraft,
+			StaffID:     line.StaffID,
+			PayrollRun:  month,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := putItem(r.Context(), "Expenses", expense, true); err != nil {
+			http.Error(w, "Failed to run payroll", http.StatusInternalServerError)
+			log.Printf("Error saving payroll expense: %v", err)
+			return
+		}
+		line.ExpenseID = expense.ID
+	}
+
+	if err := putPayrollRun(r.Context(), run); err != nil {
+		http.Error(w, "Failed to run payroll", http.StatusInternalServerError)
+		log.Printf("Error saving payroll %s: %v", month, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetPayroll godoc
+// @Summary Get a monthly payroll
+// @Description Get the payroll run of a month with the pay breakdown of each staff member
+// @Tags payroll
+// @Produce json
+// @Param month path string true "Month (YYYY-MM)"
+// @Success 200 {object} models.PayrollRun
+// @Failure 400 {object} apierror.Response "Invalid month"
+// @Failure 404 {object} apierror.Response "Payroll not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve payroll"
+// @Router /api/v1/staff/payroll/{month} [get]
+func GetPayroll(w http.ResponseWriter, r *http.Request) {
+	month := mux.Vars(r)["month"]
+	if err := models.ValidateMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	run, err := getPayrollRun(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to retrieve payroll", http.StatusInternalServerError)
+		log.Printf("Error fetching payroll %s: %v", month, err)
+		return
+	}
+	if run == nil {
+		http.Error(w, "Payroll not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// ApprovePayroll godoc
+// @Summary Approve a monthly payroll
+// @Description Approve the draft expenses of a payroll run. Approved runs can no longer be recomputed.
+// @Tags payroll
+// @Produce json
+// @Param month path string true "Month (YYYY-MM)"
+// @Success 200 {object} models.PayrollRun
+// @Failure 400 {object} apierror.Response "Invalid month"
+// @Failure 404 {object} apierror.Response "Payroll not found"
+// @Failure 409 {object} apierror.Response "Payroll already approved or financial period closed"
+// @Failure 500 {object} apierror.Response "Failed to approve payroll"
+// @Router /api/v1/staff/payroll/{month}/approve [post]
+func ApprovePayroll(w http.ResponseWriter, r *http.Request) {
+	month := mux.Vars(r)["month"]
+	if err := models.ValidateMonth(month); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkPayrollPeriodOpen(w, r, month, "Failed to approve payroll") {
+		return
+	}
+
+	run, err := getPayrollRun(r.Context(), month)
+	if err != nil {
+		http.Error(w, "Failed to approve payroll", http.StatusInternalServerError)
+		log.Printf("Error fetching payroll %s: %v", month, err)
+		return
+	}
+	if run == nil {
+		http.Error(w, "Payroll not found", http.StatusNotFound)
+		return
+	}
+	if run.Status == models.PayrollStatusApproved {
+		http.Error(w, "Payroll already approved", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, id := range run.ExpenseIDs() {
+		ctx, cancel := config.DBContext(r.Context())
+		_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String("Expenses"),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: id},
+			},
+			UpdateExpression: aws.String("SET #status = :approved, UpdatedAt = :now"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":approved": &types.AttributeValueMemberS{Value: string(financialmodels.ExpenseStatusApproved)},
+				":now":      &types.AttributeValueMemberS{Value: now.Format(time.RFC3339Nano)},
+			},
+		})
+		cancel()
+		if err != nil {
+			http.Error(w, "Failed to approve payroll", http.StatusInternalServerError)
+			log.Printf("Error approving payroll expense %s: %v", id, err)
+			return
+		}
+	}
+
+	run.Status = models.PayrollStatusApproved
+	run.ApprovedAt = now.Format(time.RFC3339)
+	if err := putPayrollRun(r.Context(), *run); err != nil {
+		http.Error(w, "Failed to approve payroll", http.StatusInternalServerError)
+		log.Printf("Error saving payroll %s: %v", month, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// computePayroll builds the pay lines of a month for active staff and anyone
+// who worked shifts in it
+func computePayroll(ctx context.Context, month string) (models.PayrollRun, error) {
+	start := monthStart(month)
+	end := start.AddDate(0, 1, -1)
+
+	members, err := paging.ScanAll[models.StaffMember](ctx, &dynamodb.ScanInput{
+		TableName: aws.String("Staff"),
+	})
+	if err != nil {
+		return models.PayrollRun{}, fmt.Errorf("scanning staff: %v", err)
+	}
+	shifts, err := shiftsInRange(ctx, start.Format(dateLayout), end.Format(dateLayout), "")
+	if err != nil {
+		return models.PayrollRun{}, fmt.Errorf("scanning shifts: %v", err)
+	}
+	hours := make(map[string]float64)
+	for _, shift := range shifts {
+		hours[shift.StaffID] += shift.Hours()
+	}
+	commissionBase, err := paidRevenueByDentist(ctx, start, end)
+	if err != nil {
+		return models.PayrollRun{}, err
+	}
+
+	premium := 1 + float64(config.EnvInt("PAYROLL_OVERTIME_PREMIUM", 50))/100
+
+	run := models.PayrollRun{
+		ClinicID:  config.ClinicID(ctx),
+		Month:     month,
+		Status:    models.PayrollStatusDraft,
+		Lines:     []models.PayrollLine{},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, member := range members {
+		if !member.Active && hours[member.ID] == 0 {
+			continue
+		}
+		line := models.PayrollLine{
+			StaffID:    member.ID,
+			StaffName:  member.Name,
+			BaseSalary: member.BaseSalary,
+			ShiftHours: round2(hours[member.ID]),
+		}
+
+		if member.BaseSalary > 0 {
+			// Salaried members are paid overtime for hours beyond their contract
+			if member.MonthlyHours > 0 && line.ShiftHours > member.MonthlyHours {
+				line.OvertimeHours = round2(line.ShiftHours - member.MonthlyHours)
+				rate := member.HourlyRate
+				if rate == 0 {
+					rate = member.BaseSalary / member.MonthlyHours
+				}
+				line.OvertimePay = round2(line.OvertimeHours * rate * premium)
+			}
+		} else {
+			line.RegularPay = round2(line.ShiftHours * member.HourlyRate)
+		}
+
+		if member.CommissionRate > 0 && member.DentistID != "" {
+			line.CommissionBase = round2(commissionBase[member.DentistID])
+			line.Commission = round2(line.CommissionBase * member.CommissionRate / 100)
+		}
+
+		line.Total = round2(line.BaseSalary + line.RegularPay + line.OvertimePay + line.Commission)
+		if line.Total <= 0 {
+			continue
+		}
+		run.Lines = append(run.Lines, line)
+		run.Total += line.Total
+	}
+	run.Total = round2(run.Total)
+
+	sort.Slice(run.Lines, func(i, j int) bool {
+		return run.Lines[i].StaffName < run.Lines[j].StaffName
+	})
+	return run, nil
+}
+
+// paidRevenueByDentist sums the revenues paid between start and end (inclusive
+// dates) per dentist of the appointment they were charged for
+func paidRevenueByDentist(ctx context.Context, start, end time.Time) (map[string]float64, error) {
+	revenues, err := paging.ScanAll[financialmodels.Revenue](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Revenues"),
+		FilterExpression: aws.String("PaymentStatus = :paid AND attribute_exists(AppointmentID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":paid": &types.AttributeValueMemberS{Value: string(financialmodels.PaymentStatusPaid)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning revenues: %v", err)
+	}
+
+	appointments, err := paging.ScanAll[dentalmodels.Appointment](ctx, &dynamodb.ScanInput{
+		TableName:            aws.String("Appointments"),
+		ProjectionExpression: aws.String("ID, DentistID"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning appointments: %v", err)
+	}
+	dentistOf := make(map[string]string, len(appointments))
+	for _, appointment := range appointments {
+		dentistOf[appointment.ID] = appointment.DentistID
+	}
+
+	until := end.AddDate(0, 0, 1)
+	totals := make(map[string]float64)
+	for _, revenue := range revenues {
+		if revenue.PaidDate == nil || revenue.PaidDate.Before(start) || !revenue.PaidDate.Before(until) {
+			continue
+		}
+		if dentistID := dentistOf[revenue.AppointmentID]; dentistID != "" {
+			totals[dentistID] += revenue.Amount
+		}
+	}
+	return totals, nil
+}
+
+func getPayrollRun(ctx context.Context, month string) (*models.PayrollRun, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("PayrollRuns"),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: config.ClinicID(ctx)},
+			"Month":    &types.AttributeValueMemberS{Value: month},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var run models.PayrollRun
+	if err := attributevalue.UnmarshalMap(result.Item, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func putPayrollRun(ctx context.Context, run models.PayrollRun) error {
+	item, err := attributevalue.MarshalMap(run)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("PayrollRuns"),
+		Item:      item,
+	})
+	return err
+}
+
+// monthStart returns the first day of a validated YYYY-MM month
+func monthStart(month string) time.Time {
+	start, _ := time.Parse("2006-01", month)
+	return start
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// checkPayrollPeriodOpen writes a 409 when the payroll month was closed by
+// the accountant, as its staff expenses are booked in that month
+func checkPayrollPeriodOpen(w http.ResponseWriter, r *http.Request, month, failure string) bool {
+	closed, err := periods.IsClosed(r.Context(), month)
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("Error checking financial period %s: %v", month, err)
+		return false
+	}
+	if closed {
+		http.Error(w, "Financial period "+month+" is closed", http.StatusConflict)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"context"
+	"dental-saas/modules/staff/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	errStaffNotFound = errors.New("staff member not found")
+	errStaffInactive = errors.New("staff member is not active")
+	errStaffAbsent   = errors.New("staff member is absent on the shift date")
+	errShiftOverlap  = errors.New("staff member already has an overlapping shift")
+)
+
+// CreateShift godoc
+// @Summary Create a shift
+// @Description Schedule a shift for a staff member. Shifts may not overlap another shift of the same member or fall on one of their absences.
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param shift body models.Shift true "Shift data"
+// @Success 201 {object} models.Shift
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 404 {object} apierror.Response "Staff member not found"
+// @Failure 409 {object} apierror.Response "Staff member is inactive, absent or already scheduled"
+// @Failure 500 {object} apierror.Response "Failed to save shift"
+// @Router /api/v1/staff/shift [post]
+func CreateShift(w http.ResponseWriter, r *http.Request) {
+	var shift models.Shift
+	if err := json.NewDecoder(r.Body).Decode(&shift); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	shift.ID = uuid.NewString()
+	shift.SwappedFrom = ""
+	if err := shift.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !shiftAllowed(w, r, shift) {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	shift.CreatedAt = now
+	shift.UpdatedAt = now
+
+	if err := putItem(r.Context(), "Shifts", shift, true); err != nil {
+		http.Error(w, "Failed to save shift", http.StatusInternalServerError)
+		log.Printf("Error saving shift: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shift)
+}
+
+// GetShifts godoc
+// @Summary List shifts
+// @Description List the shifts in a date range, optionally of a single staff member, with their hours. Used by the reception dashboard and payroll.
+// @Tags shifts
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD)"
+// @Param to query string true "End date (YYYY-MM-DD), inclusive"
+// @Param staffId query string false "Only shifts of this staff member"
+// @Success 200 {array} models.Shift
+// @Failure 400 {object} apierror.Response "Invalid date range"
+// @Failure 500 {object} apierror.Response "Failed to retrieve shifts"
+// @Router /api/v1/staff/shift [get]
+func GetShifts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	shifts, err := shiftsInRange(r.Context(), from, to, query.Get("staffId"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve shifts", http.StatusInternalServerError)
+		log.Printf("Error scanning shifts: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shifts)
+}
+
+// GetShiftByID godoc
+// @Summary Get a shift by ID
+// @Description Get a shift by its ID
+// @Tags shifts
+// @Produce json
+// @Param id path string true "Shift ID"
+// @Success 200 {object} models.Shift
+// @Failure 404 {object} apierror.Response "Shift not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve shift"
+// @Router /api/v1/staff/shift/{id} [get]
+func GetShiftByID(w http.ResponseWriter, r *http.Request) {
+	shift, ok := loadShift(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shift)
+}
+
+// UpdateShift godoc
+// @Summary Update a shift
+// @Description Change the date, times or notes of a shift. Use the swap endpoint to hand it to another staff member.
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param id path string true "Shift ID"
+// @Param If-Match header string false "Version of the shift being changed; required unless the body has it"
+// @Param shift body models.Shift true "Shift data"
+// @Success 200 {object} models.Shift
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Shift not found"
+// @Failure 409 {object} apierror.Response "Staff member is inactive, absent or already scheduled, or shift was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the shift is required"
+// @Failure 500 {object} apierror.Response "Failed to update shift"
+// @Router /api/v1/staff/shift/{id} [put]
+func UpdateShift(w http.ResponseWriter, r *http.Request) {
+	r, version, ok := versioning.Require(w, r, "Shifts", mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	current, ok := loadShift(w, r)
+	if !ok {
+		return
+	}
+
+	var updatedData models.Shift
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Date != "" {
+		current.Date = updatedData.Date
+	}
+	if updatedData.Start != "" {
+		current.Start = updatedData.Start
+	}
+	if updatedData.End != "" {
+		current.End = updatedData.End
+	}
+	if updatedData.Notes != "" {
+		current.Notes = updatedData.Notes
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !shiftAllowed(w, r, current) {
+		return
+	}
+
+	current.Version = version
+	saveShift(w, r, current)
+}
+
+// SwapShift godoc
+// @Summary Swap a shift to another staff member
+// @Description Hand a shift over to another staff member, keeping who was originally scheduled
+// @Tags shifts
+// @Accept json
+// @Produce json
+// @Param id path string true "Shift ID"
+// @Param swap body models.ShiftSwap true "Staff member taking the shift"
+// @Success 200 {object} models.Shift
+// @Failure 400 {object} apierror.Response "Invalid request body"
+// @Failure 404 {object} apierror.Response "Shift or staff member not found"
+// @Failure 409 {object} apierror.Response "Staff member is inactive, absent or already scheduled, or shift was changed concurrently"
+// @Failure 500 {object} apierror.Response "Failed to swap shift"
+// @Router /api/v1/staff/shift/{id}/swap [post]
+func SwapShift(w http.ResponseWriter, r *http.Request) {
+	current, ok := loadShift(w, r)
+	if !ok {
+		return
+	}
+
+	var swap models.ShiftSwap
+	if err := json.NewDecoder(r.Body).Decode(&swap); err != nil || swap.StaffID == "" {
+		http.Error(w, "Invalid request body: staff_id is required", http.StatusBadRequest)
+		return
+	}
+	if swap.StaffID == current.StaffID {
+		http.Error(w, "Shift is already assigned to this staff member", http.StatusBadRequest)
+		return
+	}
+
+	if current.SwappedFrom == "" {
+		current.SwappedFrom = current.StaffID
+	}
+	current.StaffID = swap.StaffID
+	if swap.Reason != "" {
+		current.Notes = swap.Reason
+	}
+	if !shiftAllowed(w, r, current) {
+		return
+	}
+
+	saveShift(w, r, current)
+}
+
+// DeleteShift godoc
+// @Summary Delete a shift
+// @Description Delete a shift by its ID
+// @Tags shifts
+// @Param id path string true "Shift ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Shift not found"
+// @Failure 500 {object} apierror.Response "Failed to delete shift"
+// @Router /api/v1/staff/shift/{id} [delete]
+func DeleteShift(w http.ResponseWriter, r *http.Request) {
+	if err := deleteItem(r.Context(), "Shifts", mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Shift not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete shift", http.StatusInternalServerError)
+		log.Printf("Error deleting shift: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRota godoc
+// @Summary Get the weekly staff rota
+// @Description Get the shifts and absences of the week (Monday to Sunday) containing the given date, flagging shifts whose staff member is absent, with the hours scheduled per member
+// @Tags shifts
+// @Produce json
+// @Param week query string false "Any date of the week (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} models.Rota
+// @Failure 400 {object} apierror.Response "Invalid date"
+// @Failure 500 {object} apierror.Response "Failed to build rota"
+// @Router /api/v1/staff/rota [get]
+func GetRota(w http.ResponseWriter, r *http.Request) {
+	day := time.Now().UTC()
+	if v := r.URL.Query().Get("week"); v != "" {
+		parsed, err := time.Parse(dateLayout, v)
+		if err != nil {
+			http.Error(w, "week must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		day = parsed
+	}
+	offset := (int(day.Weekday()) + 6) % 7
+	weekStart := day.AddDate(0, 0, -offset)
+	weekEnd := weekStart.AddDate(0, 0, 6)
+	from, to := weekStart.Format(dateLayout), weekEnd.Format(dateLayout)
+
+	shifts, err := shiftsInRange(r.Context(), from, to, "")
+	if err != nil {
+		http.Error(w, "Failed to build rota", http.StatusInternalServerError)
+		log.Printf("Error scanning shifts for rota: %v", err)
+		return
+	}
+	absences, err := absencesInRange(r.Context(), from, to, "")
+	if err != nil {
+		http.Error(w, "Failed to build rota", http.StatusInternalServerError)
+		log.Printf("Error scanning absences for rota: %v", err)
+		return
+	}
+	members, err := paging.ScanAll[models.StaffMember](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Staff"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to build rota", http.StatusInternalServerError)
+		log.Printf("Error scanning staff for rota: %v", err)
+		return
+	}
+	names := staffNames(members)
+
+	rota := models.Rota{WeekStart: from, WeekEnd: to, Hours: []models.StaffHours{}}
+	hours := make(map[string]float64)
+	for d := weekStart; !d.After(weekEnd); d = d.AddDate(0, 0, 1) {
+		date := d.Format(dateLayout)
+		rotaDay := models.RotaDay{Date: date, Shifts: []models.RotaShift{}, Absences: []models.Absence{}}
+		absent := make(map[string]bool)
+		for _, absence := range absences {
+			if absence.Covers(date) {
+				rotaDay.Absences = append(rotaDay.Absences, absence)
+				absent[absence.StaffID] = true
+			}
+		}
+		for _, shift := range shifts {
+			if shift.Date != date {
+				continue
+			}
+			rotaDay.Shifts = append(rotaDay.Shifts, models.RotaShift{
+				Shift:     shift,
+				StaffName: names[shift.StaffID],
+				Uncovered: absent[shift.StaffID],
+			})
+			hours[shift.StaffID] += shift.Hours()
+		}
+		rota.Days = append(rota.Days, rotaDay)
+	}
+	for staffID, h := range hours {
+		rota.Hours = append(rota.Hours, models.StaffHours{StaffID: staffID, StaffName: names[staffID], Hours: h})
+	}
+	sort.Slice(rota.Hours, func(i, j int) bool {
+		return rota.Hours[i].StaffName < rota.Hours[j].StaffName
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rota)
+}
+
+// shiftsInRange returns the shifts dated between from and to (inclusive), ordered by date and start
+func shiftsInRange(ctx context.Context, from, to, staffID string) ([]models.Shift, error) {
+	filter := "#date BETWEEN :from AND :to"
+	values := map[string]types.AttributeValue{
+		":from": &types.AttributeValueMemberS{Value: from},
+		":to":   &types.AttributeValueMemberS{Value: to},
+	}
+	if staffID != "" {
+		filter += " AND StaffID = :staffId"
+		values[":staffId"] = &types.AttributeValueMemberS{Value: staffID}
+	}
+
+	shifts, err := paging.ScanAll[models.Shift](ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String("Shifts"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  map[string]string{"#date": "Date"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shifts == nil {
+		shifts = []models.Shift{}
+	}
+	sort.Slice(shifts, func(i, j int) bool {
+		if shifts[i].Date != shifts[j].Date {
+			return shifts[i].Date < shifts[j].Date
+		}
+		return shifts[i].Start < shifts[j].Start
+	})
+	return shifts, nil
+}
+
+// checkShift verifies the staff member of a shift is active, not absent and
+// not already scheduled at an overlapping time
+func checkShift(ctx context.Context, shift models.Shift) error {
+	member, err := getItem[models.StaffMember](ctx, "Staff", shift.StaffID)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return errStaffNotFound
+		}
+		return err
+	}
+	if !member.Active {
+		return errStaffInactive
+	}
+
+	absences, err := absencesInRange(ctx, shift.Date, shift.Date, shift.StaffID)
+	if err != nil {
+		return err
+	}
+	if len(absences) > 0 {
+		return errStaffAbsent
+	}
+
+	// Overnight shifts can overlap shifts of the previous or next day
+	day, _ := time.Parse(dateLayout, shift.Date)
+	nearby, err := shiftsInRange(ctx, day.AddDate(0, 0, -1).Format(dateLayout), day.AddDate(0, 0, 1).Format(dateLayout), shift.StaffID)
+	if err != nil {
+		return err
+	}
+	for _, other := range nearby {
+		if other.ID != shift.ID && shift.Overlaps(other) {
+			return errShiftOverlap
+		}
+	}
+	return nil
+}
+
+// shiftAllowed runs checkShift, writing the error response when the shift is rejected
+func shiftAllowed(w http.ResponseWriter, r *http.Request, shift models.Shift) bool {
+	err := checkShift(r.Context(), shift)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errStaffNotFound):
+		http.Error(w, "Staff member not found", http.StatusNotFound)
+	case errors.Is(err, errStaffInactive), errors.Is(err, errStaffAbsent), errors.Is(err, errShiftOverlap):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to save shift", http.StatusInternalServerError)
+		log.Printf("Error checking shift: %v", err)
+	}
+	return false
+}
+
+// loadShift fetches the shift of the request path, writing the error response when it cannot be returned
+func loadShift(w http.ResponseWriter, r *http.Request) (models.Shift, bool) {
+	shift, err := getItem[models.Shift](r.Context(), "Shifts", mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Shift not found", http.StatusNotFound)
+			return models.Shift{}, false
+		}
+		http.Error(w, "Failed to retrieve shift", http.StatusInternalServerError)
+		log.Printf("Error fetching shift: %v", err)
+		return models.Shift{}, false
+	}
+	return shift, true
+}
+
+// saveShift writes an updated shift and the response. The shift must still
+// be at its Version, so a swap and an update made at once do not overwrite
+// each other.
+func saveShift(w http.ResponseWriter, r *http.Request, shift models.Shift) {
+	shift.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := putItem(r.Context(), "Shifts", shift, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Shift not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update shift", http.StatusInternalServerError)
+		log.Printf("Error updating shift: %v", err)
+		return
+	}
+	shift.Version++
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shift)
+}
+
+// parseDateRange validates from/to query parameters in YYYY-MM-DD format
+func parseDateRange(from, to string) (string, string, error) {
+	if from == "" || to == "" {
+		return "", "", fmt.Errorf("from and to are required")
+	}
+	fromDate, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return "", "", fmt.Errorf("from must be a date in YYYY-MM-DD format")
+	}
+	toDate, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return "", "", fmt.Errorf("to must be a date in YYYY-MM-DD format")
+	}
+	if toDate.Before(fromDate) {
+		return "", "", fmt.Errorf("to must not be before from")
+	}
+	return from, to, nil
+}
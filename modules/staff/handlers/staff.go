@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"dental-saas/modules/staff/models"
+	"dental-saas/shared/paging"
+	"dental-saas/shared/versioning"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreateStaffMember godoc
+// @Summary Create a staff member
+// @Description Register a member of the clinical or front-desk staff, with the pay data used by payroll
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param member body models.StaffMember true "Staff member data"
+// @Success 201 {object} models.StaffMember
+// @Failure 400 {object} apierror.Response "Invalid request body or missing required fields"
+// @Failure 500 {object} apierror.Response "Failed to save staff member"
+// @Router /api/v1/staff/member [post]
+func CreateStaffMember(w http.ResponseWriter, r *http.Request) {
+	var member models.StaffMember
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	member.ID = uuid.NewString()
+	member.Active = true
+	if err := member.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	member.CreatedAt = now
+	member.UpdatedAt = now
+
+	if err := putItem(r.Context(), "Staff", member, true); err != nil {
+		http.Error(w, "Failed to save staff member", http.StatusInternalServerError)
+		log.Printf("Error saving staff member: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+// GetAllStaff godoc
+// @Summary Get all staff members
+// @Description Get the staff members ordered by name, optionally only active ones or those with a role
+// @Tags staff
+// @Produce json
+// @Param active query bool false "Only active members"
+// @Param role query string false "Only members with this role"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Param pageToken query string false "Next page of a list truncated at LIST_MAX_ITEMS items, from the X-Next-Page-Token header"
+// @Success 200 {array} models.StaffMember
+// @Failure 500 {object} apierror.Response "Failed to retrieve staff"
+// @Router /api/v1/staff/member [get]
+func GetAllStaff(w http.ResponseWriter, r *http.Request) {
+	page := paging.Request(r)
+	members, next, err := paging.Scan[models.StaffMember](r.Context(), &dynamodb.ScanInput{
+		TableName: aws.String("Staff"),
+	}, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve staff", http.StatusInternalServerError)
+		log.Printf("Error scanning staff: %v", err)
+		return
+	}
+
+	query := r.URL.Query()
+	filtered := []models.StaffMember{}
+	for _, member := range members {
+		if query.Get("active") == "true" && !member.Active {
+			continue
+		}
+		if role := query.Get("role"); role != "" && member.Role != role {
+			continue
+		}
+		filtered = append(filtered, member)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Name < filtered[j].Name
+	})
+
+	paging.Write(w, page, filtered, next)
+}
+
+// GetStaffMemberByID godoc
+// @Summary Get a staff member by ID
+// @Description Get a staff member by their ID
+// @Tags staff
+// @Produce json
+// @Param id path string true "Staff member ID"
+// @Success 200 {object} models.StaffMember
+// @Failure 404 {object} apierror.Response "Staff member not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve staff member"
+// @Router /api/v1/staff/member/{id} [get]
+func GetStaffMemberByID(w http.ResponseWriter, r *http.Request) {
+	member, err := getItem[models.StaffMember](r.Context(), "Staff", mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Staff member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve staff member", http.StatusInternalServerError)
+		log.Printf("Error fetching staff member: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// UpdateStaffMember godoc
+// @Summary Update a staff member
+// @Description Update a staff member by their ID. Only the fields sent are changed; send active false when someone leaves the clinic.
+// @Tags staff
+// @Accept json
+// @Produce json
+// @Param id path string true "Staff member ID"
+// @Param If-Match header string false "Version of the staff member being changed; required unless the body has it"
+// @Param member body models.StaffMember true "Staff member data"
+// @Success 200 {object} models.StaffMember
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 404 {object} apierror.Response "Staff member not found"
+// @Failure 409 {object} apierror.Response "Staff member was changed since the version sent"
+// @Failure 428 {object} apierror.Response "Version of the staff member is required"
+// @Failure 500 {object} apierror.Response "Failed to update staff member"
+// @Router /api/v1/staff/member/{id} [put]
+func UpdateStaffMember(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	r, version, ok := versioning.Require(w, r, "Staff", id)
+	if !ok {
+		return
+	}
+	current, err := getItem[models.StaffMember](r.Context(), "Staff", id)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Staff member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve staff member", http.StatusInternalServerError)
+		log.Printf("Error fetching staff member: %v", err)
+		return
+	}
+
+	var updatedData struct {
+		models.StaffMember
+		Active *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if updatedData.Name != "" {
+		current.Name = updatedData.Name
+	}
+	if updatedData.Role != "" {
+		current.Role = updatedData.Role
+	}
+	if updatedData.Email != "" {
+		current.Email = updatedData.Email
+	}
+	if updatedData.Phone != "" {
+		current.Phone = updatedData.Phone
+	}
+	if updatedData.DentistID != "" {
+		current.DentistID = updatedData.DentistID
+	}
+	if updatedData.BaseSalary != 0 {
+		current.BaseSalary = updatedData.BaseSalary
+	}
+	if updatedData.HourlyRate != 0 {
+		current.HourlyRate = updatedData.HourlyRate
+	}
+	if updatedData.Active != nil {
+		current.Active = *updatedData.Active
+	}
+	if err := current.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := putItem(r.Context(), "Staff", current, false); err != nil {
+		if versioning.Conflict(w, r, err) {
+			return
+		}
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Staff member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update staff member", http.StatusInternalServerError)
+		log.Printf("Error updating staff member: %v", err)
+		return
+	}
+	current.Version = version + 1
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// DeleteStaffMember godoc
+// @Summary Delete a staff member
+// @Description Delete a staff member by their ID. Prefer deactivating members with recorded shifts so payroll history is kept.
+// @Tags staff
+// @Param id path string true "Staff member ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} apierror.Response "Staff member not found"
+// @Failure 500 {object} apierror.Response "Failed to delete staff member"
+// @Router /api/v1/staff/member/{id} [delete]
+func DeleteStaffMember(w http.ResponseWriter, r *http.Request) {
+	if err := deleteItem(r.Context(), "Staff", mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "Staff member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete staff member", http.StatusInternalServerError)
+		log.Printf("Error deleting staff member: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// staffNames maps staff IDs to names
+func staffNames(members []models.StaffMember) map[string]string {
+	names := make(map[string]string, len(members))
+	for _, member := range members {
+		names[member.ID] = member.Name
+	}
+	return names
+}
+
+// staffFilter builds a scan filter on StaffID, or no filter when staffID is empty
+func staffFilter(input *dynamodb.ScanInput, staffID string) *dynamodb.ScanInput {
+	if staffID == "" {
+		return input
+	}
+	input.FilterExpression = aws.String("StaffID = :staffId")
+	input.ExpressionAttributeValues = map[string]types.AttributeValue{
+		":staffId": &types.AttributeValueMemberS{Value: staffID},
+	}
+	return input
+}
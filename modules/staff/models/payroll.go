@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status de uma folha de pagamento mensal
+const (
+	PayrollStatusDraft    = "draft"
+	PayrollStatusApproved = "approved"
+)
+
+// PayrollLine representa o cálculo da folha de um membro da equipe
+type PayrollLine struct {
+	StaffID        string  `json:"staff_id"`
+	StaffName      string  `json:"staff_name"`
+	BaseSalary     float64 `json:"base_salary"`
+	ShiftHours     float64 `json:"shift_hours"`
+	RegularPay     float64 `json:"regular_pay"` // horas de turno pagas por hora (membros sem salário base)
+	OvertimeHours  float64 `json:"overtime_hours"`
+	OvertimePay    float64 `json:"overtime_pay"`
+	CommissionBase float64 `json:"commission_base"` // receitas pagas dos atendimentos do dentista vinculado
+	Commission     float64 `json:"commission"`
+	Total          float64 `json:"total"`
+	ExpenseID      string  `json:"expense_id,omitempty"`
+}
+
+// PayrollRun representa a folha de pagamento de um mês, gerada como gastos em rascunho
+type PayrollRun struct {
+	ClinicID   string        `json:"-"`
+	Month      string        `json:"month"` // YYYY-MM
+	Status     string        `json:"status"`
+	Lines      []PayrollLine `json:"lines"`
+	Total      float64       `json:"total"`
+	CreatedAt  string        `json:"created_at"`
+	ApprovedAt string        `json:"approved_at,omitempty"`
+}
+
+// ExpenseIDs retorna os gastos gerados pela folha
+func (p *PayrollRun) ExpenseIDs() []string {
+	var ids []string
+	for _, line := range p.Lines {
+		if line.ExpenseID != "" {
+			ids = append(ids, line.ExpenseID)
+		}
+	}
+	return ids
+}
+
+// ValidateMonth verifica se o mês está no formato YYYY-MM
+func ValidateMonth(month string) error {
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return fmt.Errorf("month must be in YYYY-MM format")
+	}
+	return nil
+}
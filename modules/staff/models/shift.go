@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tipos de ausência da equipe
+const (
+	AbsenceVacation = "vacation"
+	AbsenceSick     = "sick"
+	AbsenceLeave    = "leave"
+	AbsenceOther    = "other"
+)
+
+const (
+	dateLayout  = "2006-01-02"
+	clockLayout = "15:04"
+)
+
+// Shift representa um turno de trabalho de um membro da equipe
+type Shift struct {
+	ID          string `json:"id"`
+	StaffID     string `json:"staff_id"`
+	Date        string `json:"date"`  // YYYY-MM-DD
+	Start       string `json:"start"` // HH:MM
+	End         string `json:"end"`   // HH:MM, antes do início quando o turno passa da meia-noite
+	Notes       string `json:"notes,omitempty"`
+	SwappedFrom string `json:"swapped_from,omitempty"` // membro originalmente escalado, após uma troca
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	Version     int64  `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica se os campos obrigatórios do turno estão preenchidos
+func (s *Shift) IsValid() error {
+	if s.StaffID == "" {
+		return fmt.Errorf("staff ID is required")
+	}
+	if _, err := time.Parse(dateLayout, s.Date); err != nil {
+		return fmt.Errorf("date must be in YYYY-MM-DD format")
+	}
+	start, err := time.Parse(clockLayout, s.Start)
+	if err != nil {
+		return fmt.Errorf("start must be in HH:MM format")
+	}
+	end, err := time.Parse(clockLayout, s.End)
+	if err != nil {
+		return fmt.Errorf("end must be in HH:MM format")
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("end must differ from start")
+	}
+	return nil
+}
+
+// Interval retorna o início e o fim do turno
+func (s *Shift) Interval() (time.Time, time.Time, error) {
+	start, err := time.Parse(dateLayout+" "+clockLayout, s.Date+" "+s.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := time.Parse(dateLayout+" "+clockLayout, s.Date+" "+s.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// Hours retorna a duração do turno em horas
+func (s *Shift) Hours() float64 {
+	start, end, err := s.Interval()
+	if err != nil {
+		return 0
+	}
+	return end.Sub(start).Hours()
+}
+
+// Overlaps indica se dois turnos se sobrepõem
+func (s *Shift) Overlaps(other Shift) bool {
+	start, end, err := s.Interval()
+	if err != nil {
+		return false
+	}
+	otherStart, otherEnd, err := other.Interval()
+	if err != nil {
+		return false
+	}
+	return start.Before(otherEnd) && otherStart.Before(end)
+}
+
+// ShiftSwap representa a troca de um turno para outro membro da equipe
+type ShiftSwap struct {
+	StaffID string `json:"staff_id"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Absence representa um período de ausência de um membro da equipe (férias, atestado...)
+type Absence struct {
+	ID        string `json:"id"`
+	StaffID   string `json:"staff_id"`
+	From      string `json:"from"` // YYYY-MM-DD
+	To        string `json:"to"`   // YYYY-MM-DD, inclusive
+	Type      string `json:"type"`
+	Notes     string `json:"notes,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// IsValid verifica se os campos obrigatórios da ausência estão preenchidos
+func (a *Absence) IsValid() error {
+	if a.StaffID == "" {
+		return fmt.Errorf("staff ID is required")
+	}
+	from, err := time.Parse(dateLayout, a.From)
+	if err != nil {
+		return fmt.Errorf("from must be in YYYY-MM-DD format")
+	}
+	to, err := time.Parse(dateLayout, a.To)
+	if err != nil {
+		return fmt.Errorf("to must be in YYYY-MM-DD format")
+	}
+	if to.Before(from) {
+		return fmt.Errorf("to must not be before from")
+	}
+	switch a.Type {
+	case AbsenceVacation, AbsenceSick, AbsenceLeave, AbsenceOther:
+	default:
+		return fmt.Errorf("type must be one of vacation, sick, leave or other")
+	}
+	return nil
+}
+
+// Covers indica se a ausência inclui o dia informado (YYYY-MM-DD)
+func (a *Absence) Covers(day string) bool {
+	return a.From <= day && day <= a.To
+}
+
+// RotaShift representa um turno na escala, com o nome do membro e se ele está ausente
+type RotaShift struct {
+	Shift
+	StaffName string `json:"staff_name"`
+	Uncovered bool   `json:"uncovered"` // o membro escalado está ausente no dia
+}
+
+// RotaDay representa os turnos e ausências de um dia da escala
+type RotaDay struct {
+	Date     string      `json:"date"`
+	Shifts   []RotaShift `json:"shifts"`
+	Absences []Absence   `json:"absences"`
+}
+
+// StaffHours representa as horas escaladas de um membro na semana
+type StaffHours struct {
+	StaffID   string  `json:"staff_id"`
+	StaffName string  `json:"staff_name"`
+	Hours     float64 `json:"hours"`
+}
+
+// Rota representa a escala semanal da equipe
+type Rota struct {
+	WeekStart string       `json:"week_start"`
+	WeekEnd   string       `json:"week_end"`
+	Days      []RotaDay    `json:"days"`
+	Hours     []StaffHours `json:"hours"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "fmt"
+
+// Funções conhecidas da equipe clínica e administrativa
+const (
+	RoleAssistant    = "assistant"
+	RoleHygienist    = "hygienist"
+	RoleReceptionist = "receptionist"
+	RoleManager      = "manager"
+	RoleDentist      = "dentist"
+)
+
+// StaffMember representa um membro da equipe da clínica
+type StaffMember struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Role       string  `json:"role"`
+	Email      string  `json:"email,omitempty"`
+	Phone      string  `json:"phone,omitempty"`
+	DentistID  string  `json:"dentist_id,omitempty"`  // dentista correspondente, quando Role é dentist
+	BaseSalary float64 `json:"base_salary,omitempty"` // salário mensal fixo
+	HourlyRate float64 `json:"hourly_rate,omitempty"` // valor da hora trabalhada em turnos
+
+	// Horas mensais cobertas pelo salário base; as horas de turno acima disso são extras
+	MonthlyHours float64 `json:"monthly_hours,omitempty"`
+	// Percentual sobre as receitas pagas dos atendimentos do dentista vinculado
+	CommissionRate float64 `json:"commission_rate,omitempty"`
+
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	Version   int64  `json:"version"` // versão do registro, aumentada a cada alteração
+}
+
+// IsValid verifica se os campos obrigatórios do membro da equipe estão preenchidos
+func (s *StaffMember) IsValid() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch s.Role {
+	case RoleAssistant, RoleHygienist, RoleReceptionist, RoleManager, RoleDentist:
+	default:
+		return fmt.Errorf("role must be one of assistant, hygienist, receptionist, manager or dentist")
+	}
+	if s.BaseSalary < 0 || s.HourlyRate < 0 || s.MonthlyHours < 0 {
+		return fmt.Errorf("base salary, hourly rate and monthly hours must not be negative")
+	}
+	if s.CommissionRate < 0 || s.CommissionRate > 100 {
+		return fmt.Errorf("commission rate must be between 0 and 100")
+	}
+	if s.CommissionRate > 0 && s.DentistID == "" {
+		return fmt.Errorf("dentist ID is required to earn commission")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"dental-saas/modules/staff/handlers"
+	"dental-saas/modules/staff/models"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/budget"
+	"dental-saas/shared/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// NewStaffRouter creates and configures routes for the staff module
+func NewStaffRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Create a subrouter for staff module with /api/v1/staff prefix
+	staffRouter := r.PathPrefix("/api/v1/staff").Subrouter()
+
+	// Staff member routes, with the salaries only accountants and admins see
+	staffRouter.Handle("/member", auth.RequireFunc(handlers.CreateStaffMember, auth.RoleAccountant)).Methods("POST")
+	staffRouter.Handle("/member", budget.List(auth.RequireFunc(handlers.GetAllStaff, auth.RoleAccountant))).Methods("GET")
+	staffRouter.HandleFunc("/member/$schema", schema.Handler("StaffMember", models.StaffMember{}, "name", "role")).Methods("GET")
+	staffRouter.Handle("/member/{id}", auth.RequireFunc(handlers.GetStaffMemberByID, auth.RoleAccountant)).Methods("GET")
+	staffRouter.Handle("/member/{id}", auth.RequireFunc(handlers.UpdateStaffMember, auth.RoleAccountant)).Methods("PUT")
+	staffRouter.Handle("/member/{id}", auth.RequireFunc(handlers.DeleteStaffMember, auth.RoleAccountant)).Methods("DELETE")
+
+	// Shift routes
+	staffRouter.HandleFunc("/shift", handlers.CreateShift).Methods("POST")
+	staffRouter.HandleFunc("/shift", handlers.GetShifts).Methods("GET")
+	staffRouter.HandleFunc("/shift/$schema", schema.Handler("Shift", models.Shift{}, "staff_id", "date", "start", "end")).Methods("GET")
+	staffRouter.HandleFunc("/shift/{id}", handlers.GetShiftByID).Methods("GET")
+	staffRouter.HandleFunc("/shift/{id}", handlers.UpdateShift).Methods("PUT")
+	staffRouter.HandleFunc("/shift/{id}", handlers.DeleteShift).Methods("DELETE")
+	staffRouter.HandleFunc("/shift/{id}/swap", handlers.SwapShift).Methods("POST")
+	staffRouter.HandleFunc("/rota", handlers.GetRota).Methods("GET")
+
+	// Absence routes
+	staffRouter.HandleFunc("/absence", handlers.CreateAbsence).Methods("POST")
+	staffRouter.HandleFunc("/absence", handlers.GetAbsences).Methods("GET")
+	staffRouter.HandleFunc("/absence/$schema", schema.Handler("Absence", models.Absence{}, "staff_id", "from", "to", "type")).Methods("GET")
+	staffRouter.HandleFunc("/absence/{id}", handlers.DeleteAbsence).Methods("DELETE")
+
+	// Payroll routes, only for accountants and admins
+	staffRouter.Handle("/payroll/{month}", auth.RequireFunc(handlers.GetPayroll, auth.RoleAccountant)).Methods("GET")
+	staffRouter.Handle("/payroll/{month}/run", auth.RequireFunc(handlers.RunPayroll, auth.RoleAccountant)).Methods("POST")
+	staffRouter.Handle("/payroll/{month}/approve", auth.RequireFunc(handlers.ApprovePayroll, auth.RoleAccountant)).Methods("POST")
+
+	return r
+}
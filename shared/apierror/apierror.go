@@ -0,0 +1,199 @@
+// Package apierror gives every error response of the API the same JSON
+// shape, with a machine-readable code clients can branch on and the ID of
+// the request to quote when reporting a problem. Handlers either write
+// errors with Write, to pick a code or add details, or keep calling
+// http.Error: Middleware turns those plain-text errors into the same shape,
+// with the code of their status.
+package apierror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of each request. A client may send its own
+// ID to correlate the request with its logs; otherwise one is generated.
+// Every response carries it back.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs accepted from clients
+const maxRequestIDLength = 128
+
+// Codes of the errors of the API. Most follow from the status; the ones
+// below the blank line narrow down a status for clients that act on them.
+const (
+	CodeInvalidRequest       = "invalid_request"        // 400
+	CodeUnauthenticated      = "unauthenticated"        // 401
+	CodeForbidden            = "forbidden"              // 403
+	CodeNotFound             = "not_found"              // 404
+	CodeMethodNotAllowed     = "method_not_allowed"     // 405
+	CodeConflict             = "conflict"               // 409
+	CodeGone                 = "gone"                   // 410
+	CodePreconditionFailed   = "precondition_failed"    // 412
+	CodePreconditionRequired = "precondition_required"  // 428
+	CodePayloadTooLarge      = "payload_too_large"      // 413
+	CodeUnsupportedMediaType = "unsupported_media_type" // 415
+	CodeUnprocessable        = "unprocessable"          // 422
+	CodeLocked               = "locked"                 // 423
+	CodeRateLimited          = "rate_limited"           // 429
+	CodeInternal             = "internal_error"         // 500
+	CodeUnavailable          = "unavailable"            // 503
+	CodeTimeout              = "timeout"                // 504
+
+	CodeInsufficientRole  = "insufficient_role"   // 403, the user's role cannot perform the action
+	CodeNetworkNotAllowed = "network_not_allowed" // 403, the clinic's network policy blocks the client
+	CodePeriodClosed      = "period_closed"       // 409, the record is booked in a closed financial period
+	CodeVersionConflict   = "version_conflict"    // 409, the record was changed since the version the client sent
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalidRequest,
+	http.StatusUnauthorized:          CodeUnauthenticated,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusPreconditionRequired:  CodePreconditionRequired,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusLocked:                CodeLocked,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// Response is the body of every error response
+type Response struct {
+	Code      string      `json:"code" example:"not_found" enums:"invalid_request,unauthenticated,forbidden,not_found,method_not_allowed,conflict,gone,precondition_failed,precondition_required,payload_too_large,unsupported_media_type,unprocessable,locked,rate_limited,internal_error,unavailable,timeout,insufficient_role,network_not_allowed,period_closed,version_conflict"`
+	Message   string      `json:"message" example:"Patient not found"`
+	Details   interface{} `json:"details,omitempty" swaggertype:"object"`
+	RequestID string      `json:"request_id,omitempty" example:"5f0c6f0e-8f7e-4d38-9a4f-2b6f3c1d9e21"`
+}
+
+// CodeFor returns the code of the errors of a status that do not name one
+func CodeFor(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// Write writes an error response. An empty code is the code of the status;
+// details may be nil.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	if code == "" {
+		code = CodeFor(status)
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: RequestID(r.Context()),
+	})
+}
+
+type contextKey struct{}
+
+// RequestID returns the ID of the request of ctx
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware gives each request an ID and rewrites the plain-text errors
+// written with http.Error on API paths as a Response. Server errors are
+// logged with the request ID. It wraps the router, like StripTrailingSlash,
+// so unmatched routes get the same treatment.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, id))
+
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ew := &errorWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		if ew.status == 0 {
+			return
+		}
+		message := strings.TrimSpace(ew.body.String())
+		if ew.status >= http.StatusInternalServerError {
+			log.Printf("Request %s %s %s failed with %d: %s", id, r.Method, r.URL.Path, ew.status, message)
+		}
+		Write(w, r, ew.status, "", message, nil)
+	})
+}
+
+// validRequestID reports whether an ID sent by a client can be used as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// errorWriter holds back plain-text error responses so Middleware can
+// rewrite them. Every other response goes through untouched.
+type errorWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int // status of the plain-text error held back
+	body        bytes.Buffer
+}
+
+func (e *errorWriter) WriteHeader(status int) {
+	if !e.wroteHeader && status >= http.StatusBadRequest && strings.HasPrefix(e.Header().Get("Content-Type"), "text/plain") {
+		e.wroteHeader = true
+		e.status = status
+		return
+	}
+	e.wroteHeader = true
+	e.ResponseWriter.WriteHeader(status)
+}
+
+func (e *errorWriter) Write(b []byte) (int, error) {
+	if e.status != 0 {
+		return e.body.Write(b)
+	}
+	e.wroteHeader = true
+	return e.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the wrapper
+func (e *errorWriter) Flush() {
+	if e.status != 0 {
+		return
+	}
+	if f, ok := e.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"dental-saas/shared/paging"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ListHandler godoc
+// @Summary Get the audit log
+// @Description Get who created, changed, deleted or restored the records of the dental and financial modules, newest first, with the attributes each write changed, its time and the address it came from. Dates are YYYY-MM-DD or RFC 3339; a date bound includes the whole day.
+// @Tags audit
+// @Produce json
+// @Param entity_type query string false "Entity type (e.g. patients, appointments, invoices)"
+// @Param entity_id query string false "Entity ID; composite keys are joined with /"
+// @Param from query string false "Earliest write"
+// @Param to query string false "Latest write"
+// @Param impersonated query bool false "Only writes of operators impersonating a user"
+// @Param limit query int false "Most items per page, up to LIST_MAX_ITEMS; the response becomes {items, next_cursor}"
+// @Param cursor query string false "next_cursor of the previous page; the response becomes {items, next_cursor}"
+// @Success 200 {array} config.AuditEntry
+// @Failure 400 {object} apierror.Response "Invalid from, to or impersonated"
+// @Failure 403 {object} apierror.Response "Forbidden"
+// @Failure 500 {object} apierror.Response "Failed to retrieve audit log"
+// @Router /api/v1/audit [get]
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := Filter{
+		EntityType: query.Get("entity_type"),
+		EntityID:   query.Get("entity_id"),
+	}
+	var err error
+	if v := query.Get("impersonated"); v != "" {
+		if filter.Impersonated, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "impersonated must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	if filter.From, err = parseBound(query.Get("from"), false); err != nil {
+		http.Error(w, "from must be a date (YYYY-MM-DD) or an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseBound(query.Get("to"), true); err != nil {
+		http.Error(w, "to must be a date (YYYY-MM-DD) or an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	page := paging.Request(r)
+	entries, next, err := List(r.Context(), filter, page)
+	if errors.Is(err, paging.ErrInvalidPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit log", http.StatusInternalServerError)
+		log.Printf("Error querying audit log: %v", err)
+		return
+	}
+
+	paging.Write(w, page, entries, next)
+}
+
+// parseBound reads a date or time bound of the audit log. An upper date bound
+// is moved to the end of the day, so the day is included.
+func parseBound(v string, upper bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
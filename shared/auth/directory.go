@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account is a staff account as an identity system provisions it. Accounts
+// provisioned without a password log in through single sign-on.
+type Account struct {
+	Email      string
+	Name       string
+	Role       Role
+	ClinicID   string
+	ExternalID string
+	Disabled   bool
+	Password   string // changes the password when set
+}
+
+// IsValid checks the name, email, role and password length, normalizing the email
+func (a *Account) IsValid() error {
+	a.Name = strings.TrimSpace(a.Name)
+	if a.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	a.Email = normalizeEmail(a.Email)
+	if _, err := mail.ParseAddress(a.Email); err != nil || a.Email == "" {
+		return fmt.Errorf("a valid email is required")
+	}
+	if a.ClinicID == "" {
+		return fmt.Errorf("clinic is required")
+	}
+	if a.Password != "" && len(a.Password) < minPasswordLength {
+		return fmt.Errorf("password must have at least %d characters", minPasswordLength)
+	}
+	if len(a.Password) > maxPasswordLength {
+		return fmt.Errorf("password must have at most %d bytes", maxPasswordLength)
+	}
+	return a.Role.IsValid()
+}
+
+// apply sets the fields of a validated account on a user
+func (a Account) apply(user *User) error {
+	if a.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(a.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = string(hash)
+	}
+	user.Email = a.Email
+	user.Name = a.Name
+	user.Role = a.Role
+	user.ClinicID = a.ClinicID
+	user.ExternalID = a.ExternalID
+	user.Disabled = a.Disabled
+	user.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return nil
+}
+
+// CreateAccount creates the user of a validated account
+func CreateAccount(ctx context.Context, account Account) (User, error) {
+	user := User{ID: uuid.NewString()}
+	if err := account.apply(&user); err != nil {
+		return User{}, err
+	}
+	user.CreatedAt = user.UpdatedAt
+	return putNewUser(ctx, user)
+}
+
+// UpdateAccount replaces the fields of a user with those of a validated
+// account of the same email, keeping the password unless the account sets
+// one. It returns ErrUserNotFound when the user was removed meanwhile.
+func UpdateAccount(ctx context.Context, user User, account Account) (User, error) {
+	if account.Email != user.Email {
+		return User{}, fmt.Errorf("the email of an account cannot be changed")
+	}
+	if err := account.apply(&user); err != nil {
+		return User{}, err
+	}
+	item, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		return User{}, err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("ID = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: user.ID},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// DeleteAccount removes a user; its tokens are refused from its next refresh
+func DeleteAccount(ctx context.Context, user User) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"Email": &types.AttributeValueMemberS{Value: user.Email},
+		},
+		ConditionExpression: aws.String("ID = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: user.ID},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// UserByID returns the account with the given ID, or nil when there is none
+func UserByID(ctx context.Context, id string) (*User, error) {
+	users, err := scanUsers(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(TableName),
+		FilterExpression: aws.String("ID = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// ClinicUsers returns the accounts of the given clinics, sorted by email
+func ClinicUsers(ctx context.Context, clinicIDs []string) ([]User, error) {
+	if len(clinicIDs) == 0 {
+		return nil, nil
+	}
+	values := map[string]types.AttributeValue{}
+	placeholders := make([]string, len(clinicIDs))
+	var includesDefault bool
+	for i, id := range clinicIDs {
+		placeholders[i] = fmt.Sprintf(":clinic%d", i)
+		values[placeholders[i]] = &types.AttributeValueMemberS{Value: id}
+		includesDefault = includesDefault || id == config.DefaultClinicID
+	}
+	filter := "ClinicID IN (" + strings.Join(placeholders, ", ") + ")"
+	if includesDefault {
+		filter = "attribute_not_exists(ClinicID) OR " + filter
+	}
+
+	users, err := scanUsers(ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String(TableName),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+	return users, nil
+}
+
+func scanUsers(ctx context.Context, input *dynamodb.ScanInput) ([]User, error) {
+	var users []User
+	for {
+		pageCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(pageCtx, input)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, err
+		}
+		for i := range page {
+			withDefaults(&page[i])
+		}
+		users = append(users, page...)
+		if result.LastEvaluatedKey == nil {
+			return users, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterHandler godoc
+// @Summary Register a user
+// @Description Create a staff user account with a role (admin, dentist, receptionist or accountant). The first account can be created without logging in and is always an admin of the default clinic; after that, new accounts are created by an admin, in the admin's clinic.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "Bearer access token of an admin, required once the first user exists"
+// @Param registration body auth.Registration true "Name, email, password (at least 8 characters) and role"
+// @Success 201 {object} auth.User
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins can register users"
+// @Failure 409 {object} apierror.Response "A user with this email already exists"
+// @Failure 500 {object} apierror.Response "Failed to register user"
+// @Router /api/v1/auth/register [post]
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var reg Registration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := bearerClaims(r)
+	first := err != nil
+	if first {
+		exists, err := hasUsers(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to register user", http.StatusInternalServerError)
+			log.Printf("Error checking for users: %v", err)
+			return
+		}
+		if exists {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		// Someone has to be able to register the rest of the team
+		reg.Role = RoleAdmin
+		reg.ClinicID = config.DefaultClinicID
+	} else if !claims.Role.allowed(nil) {
+		http.Error(w, "Only admins can register users", http.StatusForbidden)
+		return
+	} else {
+		reg.ClinicID = claims.Clinic
+	}
+
+	if err := reg.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	register := Register
+	if first {
+		register = RegisterFirst
+	}
+	user, err := register(r.Context(), reg)
+	if errors.Is(err, ErrNotFirstUser) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		log.Printf("Error registering user: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// LoginHandler godoc
+// @Summary Log in
+// @Description Exchange a user's email and password for an access token, sent as "Authorization: Bearer <token>" to the dental and financial endpoints, and a refresh token to obtain new ones
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body auth.Credentials true "Email and password"
+// @Success 200 {object} auth.Tokens
+// @Failure 400 {object} apierror.Response "Invalid request body"
+// @Failure 401 {object} apierror.Response "Invalid email or password"
+// @Failure 403 {object} apierror.Response "This account is disabled"
+// @Failure 500 {object} apierror.Response "Failed to log in"
+// @Router /api/v1/auth/login [post]
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := Authenticate(r.Context(), creds)
+	if errors.Is(err, ErrInvalidCredentials) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, ErrAccountDisabled) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		log.Printf("Error authenticating user: %v", err)
+		return
+	}
+	writeTokens(w, user)
+}
+
+// RefreshRequest is the body of a refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshHandler godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access and refresh token. Tokens of deleted or disabled accounts are refused.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body auth.RefreshRequest true "Refresh token"
+// @Success 200 {object} auth.Tokens
+// @Failure 400 {object} apierror.Response "Invalid request body"
+// @Failure 401 {object} apierror.Response "Invalid or expired token"
+// @Failure 500 {object} apierror.Response "Failed to refresh tokens"
+// @Router /api/v1/auth/refresh [post]
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	claims, err := Parse(req.RefreshToken, tokenRefresh)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := GetUser(r.Context(), claims.Email)
+	if err != nil {
+		http.Error(w, "Failed to refresh tokens", http.StatusInternalServerError)
+		log.Printf("Error fetching user %s: %v", claims.Subject, err)
+		return
+	}
+	// The email may have been registered again by a different account
+	if user == nil || user.ID != claims.Subject || user.Disabled {
+		http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	writeTokens(w, *user)
+}
+
+// MeHandler godoc
+// @Summary Get the logged-in user
+// @Description Get the account of the user the access token was issued to
+// @Tags auth
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Success 200 {object} auth.User
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 500 {object} apierror.Response "Failed to retrieve user"
+// @Router /api/v1/auth/me [get]
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	user, err := GetUser(r.Context(), claims.Email)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		log.Printf("Error fetching user %s: %v", claims.Subject, err)
+		return
+	}
+	if user == nil || user.ID != claims.Subject {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetRoleHandler godoc
+// @Summary Change a user's role
+// @Description Change the role of the account of an email in the admin's clinic (admins only). The user gets the new role in the tokens issued from their next login or refresh. Admins cannot change their own role, so the clinic is never left without one, and group-level roles are changed through the organization.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin"
+// @Param email path string true "User email"
+// @Param role body auth.RoleChange true "New role"
+// @Success 200 {object} auth.User
+// @Failure 400 {object} apierror.Response "Invalid request body or role"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Your role is not allowed to perform this action"
+// @Failure 404 {object} apierror.Response "User not found"
+// @Failure 409 {object} apierror.Response "Admins cannot change their own role, or the user has a group-level role"
+// @Failure 500 {object} apierror.Response "Failed to update user"
+// @Router /api/v1/auth/users/{email}/role [put]
+func SetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var change RoleChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := change.Role.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := mux.Vars(r)["email"]
+	claims, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if normalizeEmail(claims.Email) == normalizeEmail(email) {
+		http.Error(w, "Admins cannot change their own role", http.StatusConflict)
+		return
+	}
+	current, err := GetUser(r.Context(), email)
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error fetching user %s: %v", email, err)
+		return
+	}
+	if current != nil && current.OrganizationID != "" {
+		http.Error(w, "The user has a group-level role, changed through its organization", http.StatusConflict)
+		return
+	}
+
+	// Admins with a group-level role work on the clinic they picked
+	user, err := SetRole(r.Context(), config.ClinicID(r.Context()), email, change.Role)
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error changing role of user %s: %v", email, err)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func writeTokens(w http.ResponseWriter, user User) {
+	tokens, err := Issue(user)
+	if err != nil {
+		http.Error(w, "Failed to issue tokens", http.StatusInternalServerError)
+		log.Printf("Error signing tokens of user %s: %v", user.ID, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokens)
+}
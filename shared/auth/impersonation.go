@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/notify"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Impersonation tokens last DefaultImpersonationTTL unless the operator asks
+// for less, and never longer than IMPERSONATION_MAX_TTL
+const (
+	DefaultImpersonationTTL = 30 * time.Minute
+	defaultMaxImpersonation = time.Hour
+	maxReasonLength         = 500
+)
+
+func init() {
+	notify.RegisterKind(notify.Kind{
+		Name:        "impersonation",
+		Description: "Notice to the clinic's admins that support is acting as one of its users",
+		Fields: map[string]string{
+			"operator":   "support@example.com",
+			"user_email": "reception@example.com",
+			"expires_at": "2024-03-11T10:30:00Z",
+			"reason":     "Ticket 1234: invoice totals",
+		},
+		Subject: "Support is acting as {{user_email}}",
+		Body:    "{{operator}} signed in as {{user_email}} until {{expires_at}}. Reason: {{reason}}. Every change they make is flagged in the audit log.",
+	})
+}
+
+// ErrImpersonationNotAllowed is returned when an operator asks to impersonate
+// themselves
+var ErrImpersonationNotAllowed = errors.New("operators cannot impersonate themselves")
+
+// ImpersonationRequest is the body of a request of an operator to act as a
+// clinic user for support. Reason is required and is shown in the audit log
+// and to the clinic's admins.
+type ImpersonationRequest struct {
+	Email   string `json:"email"`
+	Reason  string `json:"reason"`
+	Minutes int    `json:"minutes,omitempty"` // default 30
+}
+
+// IsValid checks the request names a user and a reason, and fits its
+// duration within the longest allowed
+func (req *ImpersonationRequest) IsValid() error {
+	req.Reason = strings.TrimSpace(req.Reason)
+	if strings.TrimSpace(req.Email) == "" {
+		return fmt.Errorf("email is required")
+	}
+	if req.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	if len(req.Reason) > maxReasonLength {
+		return fmt.Errorf("reason must be at most %d characters", maxReasonLength)
+	}
+	if req.Minutes < 0 {
+		return fmt.Errorf("minutes must be positive")
+	}
+	if max := maxImpersonation(); time.Duration(req.Minutes)*time.Minute > max {
+		return fmt.Errorf("minutes must be at most %d", int(max.Minutes()))
+	}
+	return nil
+}
+
+// TTL returns how long the impersonation token lasts
+func (req *ImpersonationRequest) TTL() time.Duration {
+	if req.Minutes == 0 {
+		return min(DefaultImpersonationTTL, maxImpersonation())
+	}
+	return time.Duration(req.Minutes) * time.Minute
+}
+
+func maxImpersonation() time.Duration {
+	return config.EnvDuration("IMPERSONATION_MAX_TTL", defaultMaxImpersonation)
+}
+
+// IssueImpersonation signs an access token acting as the user on behalf of
+// an operator. No refresh token is issued: once it expires, the operator has
+// to ask again.
+func IssueImpersonation(user User, operator, reason string, ttl time.Duration) (Tokens, error) {
+	now := time.Now()
+	claims := Claims{
+		Email:        user.Email,
+		Name:         user.Name,
+		Role:         user.Role,
+		Clinic:       user.ClinicID,
+		Type:         tokenAccess,
+		Organization: user.OrganizationID,
+		Impersonator: operator,
+		Reason:       reason,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret())
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+	}, nil
+}
+
+// Admins returns the admin accounts of a clinic
+func Admins(ctx context.Context, clinicID string) ([]User, error) {
+	filter := "#role = :admin AND ClinicID = :clinic"
+	if clinicID == config.DefaultClinicID {
+		filter = "(attribute_not_exists(#role) OR #role = :admin) AND (attribute_not_exists(ClinicID) OR ClinicID = :clinic)"
+	}
+	return scanUsers(ctx, &dynamodb.ScanInput{
+		TableName:                aws.String(TableName),
+		FilterExpression:         aws.String(filter),
+		ExpressionAttributeNames: map[string]string{"#role": "Role"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":admin":  &types.AttributeValueMemberS{Value: string(RoleAdmin)},
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+}
+
+// ImpersonateHandler godoc
+// @Summary Impersonate a clinic user
+// @Description Issue an operator (an admin of the default clinic) a short-lived access token acting as a clinic user, for support. A reason is required. Every write made with the token is flagged in the audit log with the operator and the reason, and the admins of the user's clinic are notified. No refresh token is issued; the token lasts 30 minutes unless fewer are asked for, at most IMPERSONATION_MAX_TTL.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param impersonation body auth.ImpersonationRequest true "User email, reason and duration in minutes"
+// @Success 200 {object} auth.Tokens
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only operators can impersonate users"
+// @Failure 404 {object} apierror.Response "User not found"
+// @Failure 409 {object} apierror.Response "User is disabled"
+// @Failure 500 {object} apierror.Response "Failed to impersonate user"
+// @Router /api/v1/auth/impersonate [post]
+func ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !claims.Operator() {
+		http.Error(w, "Only operators can impersonate users", http.StatusForbidden)
+		return
+	}
+	var req ImpersonationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if normalizeEmail(req.Email) == normalizeEmail(claims.Email) {
+		http.Error(w, ErrImpersonationNotAllowed.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := GetUser(r.Context(), req.Email)
+	if err != nil {
+		http.Error(w, "Failed to impersonate user", http.StatusInternalServerError)
+		log.Printf("Error fetching user %s: %v", req.Email, err)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.Disabled {
+		http.Error(w, "User is disabled", http.StatusConflict)
+		return
+	}
+
+	ttl := req.TTL()
+	tokens, err := IssueImpersonation(*user, claims.Email, req.Reason, ttl)
+	if err != nil {
+		http.Error(w, "Failed to impersonate user", http.StatusInternalServerError)
+		log.Printf("Error signing impersonation token of user %s: %v", user.ID, err)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(ttl).Format(time.RFC3339)
+	log.Printf("Operator %s impersonating %s until %s: %s", claims.Email, user.Email, expiresAt, req.Reason)
+
+	if err := config.RecordAuditEvent(r.Context(), user.ClinicID, "users", user.Email, config.AuditImpersonated, map[string]interface{}{
+		"reason":     req.Reason,
+		"expires_at": expiresAt,
+	}); err != nil {
+		log.Printf("Error recording impersonation of %s in the audit log: %v", user.Email, err)
+	}
+	notifyAdmins(r.Context(), *user, claims.Email, req.Reason, expiresAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// notifyAdmins tells the admins of the user's clinic an operator is acting as
+// the user. Failures are logged; support should not wait on them.
+func notifyAdmins(ctx context.Context, user User, operator, reason, expiresAt string) {
+	admins, err := Admins(ctx, user.ClinicID)
+	if err != nil {
+		log.Printf("Error listing admins of clinic %s to notify of an impersonation: %v", user.ClinicID, err)
+		return
+	}
+	for _, admin := range admins {
+		msg, err := notify.Compose(ctx, user.ClinicID, "impersonation", admin.Email, map[string]string{
+			"operator":   operator,
+			"user_email": user.Email,
+			"expires_at": expiresAt,
+			"reason":     reason,
+		})
+		if err == nil {
+			err = notify.Send(ctx, msg)
+		}
+		if err != nil {
+			log.Printf("Error notifying admin %s of an impersonation: %v", admin.Email, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Middleware requires a valid access token in the Authorization header on
+// every request for which protected returns true, and makes the token's
+// claims available through FromContext
+func Middleware(protected func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !protected(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims, err := bearerClaims(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas"`)
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+		})
+	}
+}
+
+// FromContext returns the claims of the authenticated user of a request
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// bearerClaims verifies the access token sent in the Authorization header.
+// Event streams may send it in the access_token query parameter instead,
+// since browsers cannot set headers on an EventSource.
+func bearerClaims(r *http.Request) (*Claims, error) {
+	if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" &&
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return Parse(token, tokenAccess)
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrInvalidToken
+	}
+	return Parse(strings.TrimSpace(token), tokenAccess)
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"dental-saas/shared/cache"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Identity providers publish their endpoints and signing keys; both are
+// cached, and the keys are fetched again when a token names an unknown one,
+// at most once per jwksRefetchInterval, since providers rotate them
+const (
+	discoveryTTL         = time.Hour
+	jwksRefetchInterval  = time.Minute
+	maxOIDCResponseBytes = 1 << 20
+)
+
+// ErrInvalidIDToken is returned for ID tokens that are malformed, expired,
+// not signed by the provider, issued to another client or for another login
+var ErrInvalidIDToken = errors.New("invalid identity token")
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcProvider is the OpenID configuration of an identity provider
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discover reads the OpenID configuration of an issuer, such as
+// https://accounts.google.com or https://login.microsoftonline.com/{tenant}/v2.0
+func discover(ctx context.Context, issuer string) (oidcProvider, error) {
+	key := "oidc:provider:" + issuer
+	if v, ok := cache.Default.Get(key); ok {
+		return v.(oidcProvider), nil
+	}
+
+	var provider oidcProvider
+	if err := getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &provider); err != nil {
+		return oidcProvider{}, fmt.Errorf("discovering %s: %v", issuer, err)
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return oidcProvider{}, fmt.Errorf("discovering %s: configuration is for issuer %q", issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return oidcProvider{}, fmt.Errorf("discovering %s: configuration lacks endpoints", issuer)
+	}
+	cache.Default.Set(key, provider, discoveryTTL)
+	return provider, nil
+}
+
+// authURL is where the user is sent to log in at the provider
+func (p oidcProvider) authURL(clientID, redirectURI, state, nonce string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {clientID},
+		"redirect_uri":  {redirectURI},
+		"scope":         {"openid email profile"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// exchange trades the authorization code of a login for its ID token
+func (p oidcProvider) exchange(ctx context.Context, clientID, clientSecret, redirectURI, code string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOIDCResponseBytes)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if body.Error != "" {
+		return "", fmt.Errorf("token endpoint refused the code: %s %s", body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("token endpoint returned %s without an ID token", resp.Status)
+	}
+	return body.IDToken, nil
+}
+
+// verify checks an ID token was signed by the provider for the client and
+// the login of nonce, and returns its claims
+func (p oidcProvider) verify(ctx context.Context, clientID, nonce, idToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce == "" || claimNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match the login", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// keySet is the signing keys of a provider by key ID
+type keySet struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+var keySetsMu sync.Mutex
+
+// signingKey returns the provider's RSA key with the given ID
+func (p oidcProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	keySetsMu.Lock()
+	defer keySetsMu.Unlock()
+
+	cacheKey := "oidc:jwks:" + p.JWKSURI
+	set, _ := cache.Default.Get(cacheKey)
+	keys, _ := set.(keySet)
+	if key := keys.lookup(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(keys.fetchedAt) < jwksRefetchInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := fetchKeys(ctx, p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	cache.Default.Set(cacheKey, keys, discoveryTTL)
+	if key := keys.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup returns the key with the given ID, or the only key of sets with a
+// single key when the token names none
+func (s keySet) lookup(kid string) *rsa.PublicKey {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return s.keys[kid]
+}
+
+func fetchKeys(ctx context.Context, jwksURI string) (keySet, error) {
+	var body struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &body); err != nil {
+		return keySet{}, fmt.Errorf("fetching signing keys: %v", err)
+	}
+
+	set := keySet{keys: map[string]*rsa.PublicKey{}, fetchedAt: time.Now()}
+	for _, k := range body.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		set.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return set, nil
+}
+
+func getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxOIDCResponseBytes)).Decode(out)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"dental-saas/shared/apierror"
+	"fmt"
+	"net/http"
+)
+
+// Role is what a staff user is allowed to do
+type Role string
+
+// Staff roles. Admins pass every role check.
+const (
+	RoleAdmin        Role = "admin"
+	RoleDentist      Role = "dentist"
+	RoleReceptionist Role = "receptionist"
+	RoleAccountant   Role = "accountant"
+)
+
+// Roles lists every valid role
+var Roles = []Role{RoleAdmin, RoleDentist, RoleReceptionist, RoleAccountant}
+
+// IsValid checks the role is one of Roles
+func (role Role) IsValid() error {
+	for _, r := range Roles {
+		if role == r {
+			return nil
+		}
+	}
+	return fmt.Errorf("role must be one of %v", Roles)
+}
+
+// Require lets a request through only when the logged-in user has one of the
+// roles or is an admin. Routers wrap the routes they restrict with it; the
+// route must also be protected by Middleware so the user's claims are known.
+func Require(roles ...Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := FromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas"`)
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !claims.Role.allowed(roles) {
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeInsufficientRole, "Your role is not allowed to perform this action", map[string]interface{}{
+					"role":    claims.Role,
+					"allowed": append([]Role{RoleAdmin}, roles...),
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireFunc is Require for a single handler function
+func RequireFunc(handler http.HandlerFunc, roles ...Role) http.Handler {
+	return Require(roles...)(handler)
+}
+
+func (role Role) allowed(roles []Role) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	for _, r := range roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
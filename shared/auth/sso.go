@@ -0,0 +1,551 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"dental-saas/shared/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OIDCTable holds the single sign-on settings of each clinic, keyed by ClinicID
+const OIDCTable = "OIDCSettings"
+
+// A login through the identity provider must come back within stateTTL.
+// The nonce cookie ties it to the browser that started it.
+const (
+	tokenOIDCState  = "oidc_state"
+	stateTTL        = 10 * time.Minute
+	nonceCookieName = "oidc_nonce"
+	nonceCookiePath = "/api/v1/auth/oidc"
+)
+
+var (
+	// ErrSSODisabled is returned when a clinic has not enabled single sign-on
+	ErrSSODisabled = errors.New("single sign-on is not enabled for this clinic")
+	// ErrSSODenied is returned when the identity provider's account may not
+	// log in to the clinic
+	ErrSSODenied = errors.New("account may not log in to this clinic")
+)
+
+// RoleRule maps the accounts whose ID token carries Value in Claim to Role.
+// Claims holding lists, such as groups or roles, match when they contain
+// Value, e.g. {"claim": "groups", "value": "dentists", "role": "dentist"}.
+type RoleRule struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	Role  Role   `json:"role"`
+}
+
+// OIDCSettings is a clinic's OpenID Connect single sign-on, an alternative
+// to passwords for its staff: Google Workspace, Azure AD or any other
+// provider publishing its configuration under Issuer. Accounts logging in
+// for the first time are created with the role of the first matching rule,
+// or DefaultRole; without either they are refused. Existing accounts get the
+// role of the first matching rule at each login.
+type OIDCSettings struct {
+	ClinicID     string `json:"clinic_id"`
+	Enabled      bool   `json:"enabled"`
+	Issuer       string `json:"issuer"` // e.g. https://accounts.google.com
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty" dynamodbav:",omitempty"` // never returned by the API
+	// ClientSecretSet tells whether a secret is stored, since it is not returned
+	ClientSecretSet bool `json:"client_secret_set" dynamodbav:"-"`
+	// AllowedDomains restricts logins to emails of these domains; any when empty
+	AllowedDomains []string   `json:"allowed_domains,omitempty" dynamodbav:",omitempty"`
+	RoleRules      []RoleRule `json:"role_rules,omitempty" dynamodbav:",omitempty"`
+	DefaultRole    Role       `json:"default_role,omitempty" dynamodbav:",omitempty"`
+	// ReturnURL receives the tokens in its fragment after the login, e.g.
+	// https://app.example.com/sso#access_token=...; without it the callback
+	// answers the tokens as JSON
+	ReturnURL string `json:"return_url,omitempty" dynamodbav:",omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// IsValid normalizes the settings and checks enabled ones can be used
+func (s *OIDCSettings) IsValid() error {
+	s.Issuer = strings.TrimSuffix(strings.TrimSpace(s.Issuer), "/")
+	s.ClientID = strings.TrimSpace(s.ClientID)
+	s.ReturnURL = strings.TrimSpace(s.ReturnURL)
+	for i, domain := range s.AllowedDomains {
+		s.AllowedDomains[i] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if s.AllowedDomains[i] == "" {
+			return fmt.Errorf("allowed_domains must not contain empty domains")
+		}
+	}
+	for i, rule := range s.RoleRules {
+		if strings.TrimSpace(rule.Claim) == "" || rule.Value == "" {
+			return fmt.Errorf("role_rules[%d]: claim and value are required", i)
+		}
+		if err := rule.Role.IsValid(); err != nil {
+			return fmt.Errorf("role_rules[%d]: %v", i, err)
+		}
+	}
+	if s.DefaultRole != "" {
+		if err := s.DefaultRole.IsValid(); err != nil {
+			return fmt.Errorf("default_role: %v", err)
+		}
+	}
+	if s.ReturnURL != "" {
+		if u, err := url.Parse(s.ReturnURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("return_url must be an http or https URL without a fragment")
+		}
+	}
+	if !s.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(s.Issuer); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("issuer must be an https URL")
+	}
+	if s.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if s.ClientSecret == "" {
+		return fmt.Errorf("client_secret is required")
+	}
+	return nil
+}
+
+// roleFor returns the role of the first rule the claims match
+func (s *OIDCSettings) roleFor(claims jwt.MapClaims) (Role, bool) {
+	for _, rule := range s.RoleRules {
+		for _, value := range claimValues(claims[rule.Claim]) {
+			if value == rule.Value {
+				return rule.Role, true
+			}
+		}
+	}
+	return "", false
+}
+
+// allows reports whether an email's domain may log in
+func (s *OIDCSettings) allows(email string) bool {
+	if len(s.AllowedDomains) == 0 {
+		return true
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	for _, allowed := range s.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// claimValues reads a claim as the strings a rule is compared to
+func claimValues(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, claimValues(item)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// GetOIDCSettings returns the single sign-on settings of a clinic, disabled
+// when none were saved
+func GetOIDCSettings(ctx context.Context, clinicID string) (OIDCSettings, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(OIDCTable),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	if err != nil {
+		return OIDCSettings{}, err
+	}
+	settings := OIDCSettings{ClinicID: clinicID}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &settings); err != nil {
+			return OIDCSettings{}, err
+		}
+	}
+	settings.ClientSecretSet = settings.ClientSecret != ""
+	return settings, nil
+}
+
+// SaveOIDCSettings stores the single sign-on settings of a clinic
+func SaveOIDCSettings(ctx context.Context, settings OIDCSettings) (OIDCSettings, error) {
+	if err := settings.IsValid(); err != nil {
+		return OIDCSettings{}, err
+	}
+	settings.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	settings.ClientSecretSet = settings.ClientSecret != ""
+
+	item, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		return OIDCSettings{}, err
+	}
+	putCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName: aws.String(OIDCTable),
+		Item:      item,
+	})
+	return settings, err
+}
+
+// redirectURL is the callback registered at the identity providers
+func redirectURL() string {
+	return config.EnvString("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback")
+}
+
+// oidcState is the state parameter of a login, signed like the tokens so
+// the callback knows the clinic and nonce of the login it completes
+type oidcState struct {
+	Clinic string `json:"clinic"`
+	Nonce  string `json:"nonce"`
+	Type   string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+func signState(clinicID, nonce string) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, oidcState{
+		Clinic: clinicID,
+		Nonce:  nonce,
+		Type:   tokenOIDCState,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(stateTTL)),
+		},
+	}).SignedString(secret())
+}
+
+func parseState(state string) (*oidcState, error) {
+	claims := &oidcState{}
+	_, err := jwt.ParseWithClaims(state, claims, func(*jwt.Token) (interface{}, error) {
+		return secret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil || claims.Type != tokenOIDCState || claims.Clinic == "" || claims.Nonce == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// ssoUser returns the account of the person an ID token identifies in a
+// clinic, creating it on their first login
+func ssoUser(ctx context.Context, settings OIDCSettings, claims jwt.MapClaims) (User, error) {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		// Azure AD sends the email as the user's sign-in name
+		email, _ = claims["preferred_username"].(string)
+	}
+	email = normalizeEmail(email)
+	if _, err := mail.ParseAddress(email); err != nil || email == "" {
+		return User{}, fmt.Errorf("%w: the identity token has no email", ErrSSODenied)
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return User{}, fmt.Errorf("%w: email %s is not verified", ErrSSODenied, email)
+	}
+	if !settings.allows(email) {
+		return User{}, fmt.Errorf("%w: domain of %s is not allowed", ErrSSODenied, email)
+	}
+	role, matched := settings.roleFor(claims)
+
+	existing, err := GetUser(ctx, email)
+	if err != nil {
+		return User{}, err
+	}
+	if existing != nil {
+		if existing.ClinicID != settings.ClinicID {
+			return User{}, fmt.Errorf("%w: %s belongs to another clinic", ErrSSODenied, email)
+		}
+		if existing.Disabled {
+			return User{}, fmt.Errorf("%w: %s is disabled", ErrSSODenied, email)
+		}
+		// Group-level roles are managed by the organization, not by the
+		// role rules of one of its clinics
+		if !matched || role == existing.Role || existing.OrganizationID != "" {
+			return *existing, nil
+		}
+		updated, err := SetRole(ctx, settings.ClinicID, email, role)
+		if err != nil || updated == nil {
+			return User{}, fmt.Errorf("updating role of %s: %v", email, err)
+		}
+		return *updated, nil
+	}
+
+	if !matched {
+		role = settings.DefaultRole
+	}
+	if role == "" {
+		return User{}, fmt.Errorf("%w: no role rule matches %s", ErrSSODenied, email)
+	}
+	name, _ := claims["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		name = email
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	user, err := putNewUser(ctx, User{
+		ID:               uuid.NewString(),
+		Email:            email,
+		Name:             strings.TrimSpace(name),
+		Role:             role,
+		ClinicID:         settings.ClinicID,
+		IdentityProvider: settings.Issuer,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	})
+	if errors.Is(err, ErrEmailTaken) {
+		// A concurrent first login created it
+		if existing, err := GetUser(ctx, email); err == nil && existing != nil && existing.ClinicID == settings.ClinicID {
+			return *existing, nil
+		}
+	}
+	if err != nil {
+		return User{}, err
+	}
+	log.Printf("Provisioned %s account %s of clinic %s through single sign-on", user.Role, user.Email, user.ClinicID)
+	return user, nil
+}
+
+// OIDCSettingsHandler godoc
+// @Summary Get the single sign-on settings
+// @Description Get the clinic's OpenID Connect single sign-on settings (admins only). The client secret is not returned; client_secret_set tells whether one is stored.
+// @Tags auth
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin"
+// @Success 200 {object} auth.OIDCSettings
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Insufficient role"
+// @Failure 500 {object} apierror.Response "Failed to retrieve single sign-on settings"
+// @Router /api/v1/auth/oidc [get]
+func OIDCSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := GetOIDCSettings(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve single sign-on settings", http.StatusInternalServerError)
+		log.Printf("Error fetching single sign-on settings: %v", err)
+		return
+	}
+	settings.ClientSecret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateOIDCSettingsHandler godoc
+// @Summary Update the single sign-on settings
+// @Description Replace the clinic's OpenID Connect single sign-on settings (admins only): the provider's issuer (e.g. https://accounts.google.com or https://login.microsoftonline.com/{tenant}/v2.0), the client registered there with OIDC_REDIRECT_URL as redirect URI, the allowed email domains, the rules mapping ID token claims to roles, the role of new accounts no rule matches, and the URL receiving the tokens. An empty client_secret keeps the stored one.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin"
+// @Param settings body auth.OIDCSettings true "Single sign-on settings"
+// @Success 200 {object} auth.OIDCSettings
+// @Failure 400 {object} apierror.Response "Invalid request body or settings"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Insufficient role"
+// @Failure 500 {object} apierror.Response "Failed to save single sign-on settings"
+// @Router /api/v1/auth/oidc [put]
+func UpdateOIDCSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings OIDCSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings.ClinicID = config.ClinicID(r.Context())
+	if settings.ClientSecret == "" {
+		stored, err := GetOIDCSettings(r.Context(), settings.ClinicID)
+		if err != nil {
+			http.Error(w, "Failed to save single sign-on settings", http.StatusInternalServerError)
+			log.Printf("Error fetching single sign-on settings: %v", err)
+			return
+		}
+		settings.ClientSecret = stored.ClientSecret
+	}
+	if err := settings.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := SaveOIDCSettings(r.Context(), settings)
+	if err != nil {
+		http.Error(w, "Failed to save single sign-on settings", http.StatusInternalServerError)
+		log.Printf("Error saving single sign-on settings: %v", err)
+		return
+	}
+	saved.ClientSecret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// OIDCLoginHandler godoc
+// @Summary Log in through single sign-on
+// @Description Start a login through the clinic's identity provider: the browser is redirected to the provider and, once the user logs in there, back to the callback
+// @Tags auth
+// @Param clinic query string false "Clinic ID, the default clinic when empty"
+// @Success 302
+// @Failure 404 {object} apierror.Response "Single sign-on is not enabled for this clinic"
+// @Failure 500 {object} apierror.Response "Failed to start single sign-on"
+// @Failure 503 {object} apierror.Response "Identity provider unavailable"
+// @Router /api/v1/auth/oidc/login [get]
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	clinicID := strings.TrimSpace(r.URL.Query().Get("clinic"))
+	if clinicID == "" {
+		clinicID = config.DefaultClinicID
+	}
+	settings, provider, ok := ssoProvider(w, r, clinicID)
+	if !ok {
+		return
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, "Failed to start single sign-on", http.StatusInternalServerError)
+		log.Printf("Error generating single sign-on nonce: %v", err)
+		return
+	}
+	nonceValue := base64.RawURLEncoding.EncodeToString(nonce)
+	state, err := signState(clinicID, nonceValue)
+	if err != nil {
+		http.Error(w, "Failed to start single sign-on", http.StatusInternalServerError)
+		log.Printf("Error signing single sign-on state: %v", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     nonceCookieName,
+		Value:    nonceValue,
+		Path:     nonceCookiePath,
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(redirectURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.authURL(settings.ClientID, redirectURL(), state, nonceValue), http.StatusFound)
+}
+
+// OIDCCallbackHandler godoc
+// @Summary Complete a single sign-on login
+// @Description The identity provider redirects here after the user logs in. The ID token is verified and the staff account found, or created with the role of the clinic's rules. The tokens are answered as in a password login, or passed to the clinic's return_url in its fragment.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login"
+// @Success 200 {object} auth.Tokens
+// @Success 302
+// @Failure 400 {object} apierror.Response "Invalid or expired login"
+// @Failure 401 {object} apierror.Response "The identity provider did not authenticate the user"
+// @Failure 403 {object} apierror.Response "Account may not log in to this clinic"
+// @Failure 404 {object} apierror.Response "Single sign-on is not enabled for this clinic"
+// @Failure 500 {object} apierror.Response "Failed to complete single sign-on"
+// @Failure 503 {object} apierror.Response "Identity provider unavailable"
+// @Router /api/v1/auth/oidc/callback [get]
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		http.Error(w, "The identity provider did not authenticate the user: "+e, http.StatusUnauthorized)
+		return
+	}
+	state, err := parseState(query.Get("state"))
+	if err != nil || query.Get("code") == "" {
+		http.Error(w, "Invalid or expired login, start again", http.StatusBadRequest)
+		return
+	}
+	cookie, err := r.Cookie(nonceCookieName)
+	if err != nil || cookie.Value != state.Nonce {
+		http.Error(w, "Invalid or expired login, start again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: nonceCookieName, Path: nonceCookiePath, MaxAge: -1})
+
+	settings, provider, ok := ssoProvider(w, r, state.Clinic)
+	if !ok {
+		return
+	}
+	idToken, err := provider.exchange(r.Context(), settings.ClientID, settings.ClientSecret, redirectURL(), query.Get("code"))
+	if err != nil {
+		http.Error(w, "The identity provider did not authenticate the user", http.StatusUnauthorized)
+		log.Printf("Error exchanging single sign-on code of clinic %s: %v", state.Clinic, err)
+		return
+	}
+	claims, err := provider.verify(r.Context(), settings.ClientID, state.Nonce, idToken)
+	if err != nil {
+		http.Error(w, "The identity provider did not authenticate the user", http.StatusUnauthorized)
+		log.Printf("Error verifying single sign-on of clinic %s: %v", state.Clinic, err)
+		return
+	}
+
+	user, err := ssoUser(r.Context(), settings, claims)
+	if errors.Is(err, ErrSSODenied) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to complete single sign-on", http.StatusInternalServerError)
+		log.Printf("Error completing single sign-on of clinic %s: %v", state.Clinic, err)
+		return
+	}
+
+	if settings.ReturnURL == "" {
+		writeTokens(w, user)
+		return
+	}
+	tokens, err := Issue(user)
+	if err != nil {
+		http.Error(w, "Failed to issue tokens", http.StatusInternalServerError)
+		log.Printf("Error signing tokens of user %s: %v", user.ID, err)
+		return
+	}
+	// The fragment keeps the tokens out of server logs and Referer headers
+	fragment := url.Values{
+		"access_token":  {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"token_type":    {tokens.TokenType},
+		"expires_in":    {strconv.Itoa(tokens.ExpiresIn)},
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, settings.ReturnURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// ssoProvider loads the enabled single sign-on of a clinic and its
+// provider's configuration, writing the error response when it cannot
+func ssoProvider(w http.ResponseWriter, r *http.Request, clinicID string) (OIDCSettings, oidcProvider, bool) {
+	settings, err := GetOIDCSettings(r.Context(), clinicID)
+	if err != nil {
+		http.Error(w, "Failed to start single sign-on", http.StatusInternalServerError)
+		log.Printf("Error fetching single sign-on settings of clinic %s: %v", clinicID, err)
+		return OIDCSettings{}, oidcProvider{}, false
+	}
+	if !settings.Enabled {
+		http.Error(w, ErrSSODisabled.Error(), http.StatusNotFound)
+		return OIDCSettings{}, oidcProvider{}, false
+	}
+	provider, err := discover(r.Context(), settings.Issuer)
+	if err != nil {
+		http.Error(w, "Identity provider unavailable", http.StatusServiceUnavailable)
+		log.Printf("Error discovering identity provider of clinic %s: %v", clinicID, err)
+		return OIDCSettings{}, oidcProvider{}, false
+	}
+	return settings, provider, true
+}
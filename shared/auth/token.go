@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"dental-saas/shared/config"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types, so a refresh token cannot be used to call the API
+const (
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+)
+
+const issuer = "dental-saas"
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, not
+// signed by this service or of the wrong type
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the claims of the tokens issued to a user; the subject is the user ID
+type Claims struct {
+	Email  string `json:"email"`
+	Name   string `json:"name,omitempty"`
+	Role   Role   `json:"role"`
+	Clinic string `json:"clinic,omitempty"`
+	Type   string `json:"typ"`
+
+	// Organization is set on users with a group-level role, who may act in
+	// any clinic of the organization
+	Organization string `json:"org,omitempty"`
+
+	// Impersonator is the operator a support token was issued to, acting as
+	// the user for Reason; empty on the user's own tokens
+	Impersonator string `json:"imp,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Operator reports whether the claims are of an admin of the default clinic,
+// who operates the deployment, acting as themselves
+func (c *Claims) Operator() bool {
+	return c.Role == RoleAdmin && c.Clinic == config.DefaultClinicID && c.Impersonator == ""
+}
+
+// Tokens is the response of a login or refresh
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"` // absent on impersonation tokens
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until the access token expires
+}
+
+// secret returns the key tokens are signed with (see config.EnvSecret)
+var secret = config.EnvSecret("JWT_SECRET", "issued tokens")
+
+// Issue signs a new access and refresh token for the user
+func Issue(user User) (Tokens, error) {
+	accessTTL := config.EnvDuration("JWT_ACCESS_TTL", 15*time.Minute)
+	access, err := sign(user, tokenAccess, accessTTL)
+	if err != nil {
+		return Tokens{}, err
+	}
+	refresh, err := sign(user, tokenRefresh, config.EnvDuration("JWT_REFRESH_TTL", 7*24*time.Hour))
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTTL.Seconds()),
+	}, nil
+}
+
+func sign(user User, typ string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Email:        user.Email,
+		Name:         user.Name,
+		Role:         user.Role,
+		Clinic:       user.ClinicID,
+		Type:         typ,
+		Organization: user.OrganizationID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret())
+}
+
+// Parse verifies a token of the given type and returns its claims
+func Parse(token, typ string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return secret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	// Every token issued names the role and clinic of its user; one without
+	// them is refused rather than given access it was never granted
+	if err != nil || claims.Type != typ || claims.Subject == "" || claims.Role.IsValid() != nil || claims.Clinic == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,380 @@
+// Package auth authenticates staff users: it stores their accounts with
+// bcrypt-hashed passwords and roles, issues JWT access and refresh tokens on
+// login and provides the middleware that requires an access token on staff
+// endpoints and the role checks routers put on restricted routes.
+package auth
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TableName holds the user accounts, keyed by their lower-cased Email
+const TableName = "Users"
+
+// minPasswordLength is the shortest password accepted; bcrypt ignores
+// anything past 72 bytes, so longer passwords are refused instead
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var (
+	// ErrEmailTaken is returned when registering an email that already has an account
+	ErrEmailTaken = errors.New("a user with this email already exists")
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrAccountDisabled is returned when a disabled account logs in
+	ErrAccountDisabled = errors.New("this account is disabled")
+	// ErrUserNotFound is returned when changing an account that no longer exists
+	ErrUserNotFound = errors.New("user not found")
+	// ErrNotFirstUser is returned when registering the first user after
+	// another registration already created it
+	ErrNotFirstUser = errors.New("the first user is already registered")
+)
+
+// firstUserMarker is the item the registration of the first user creates in
+// the Counters table, in the same transaction as the account, so concurrent
+// registrations without a token cannot both become admins
+const firstUserMarker = "auth#first-user"
+
+// User is a staff member's account
+type User struct {
+	ID           string `json:"id"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+	Role         Role   `json:"role"`
+	ClinicID     string `json:"clinic_id"`
+	PasswordHash string `json:"-"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+
+	// IdentityProvider is the issuer of the single sign-on that created the
+	// account; such accounts have no password and only log in through it
+	IdentityProvider string `json:"identity_provider,omitempty" dynamodbav:",omitempty"`
+
+	// Disabled accounts cannot log in or refresh their tokens; the access
+	// tokens already issued work until they expire
+	Disabled bool `json:"disabled,omitempty" dynamodbav:",omitempty"`
+	// ExternalID is the account's ID in the identity system provisioning it
+	ExternalID string `json:"external_id,omitempty" dynamodbav:",omitempty"`
+	// OrganizationID gives the account a group-level role: its role applies
+	// in every clinic of the organization, not only in its own
+	OrganizationID string `json:"organization_id,omitempty" dynamodbav:",omitempty"`
+}
+
+// Registration is the body of a sign-up request
+type Registration struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     Role   `json:"role"`
+
+	// ClinicID is the clinic the account belongs to, set by the server
+	ClinicID string `json:"-"`
+}
+
+// IsValid checks the name, email, password length and role, normalizing the email
+func (reg *Registration) IsValid() error {
+	reg.Name = strings.TrimSpace(reg.Name)
+	if reg.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	reg.Email = normalizeEmail(reg.Email)
+	if _, err := mail.ParseAddress(reg.Email); err != nil || reg.Email == "" {
+		return fmt.Errorf("a valid email is required")
+	}
+	if len(reg.Password) < minPasswordLength {
+		return fmt.Errorf("password must have at least %d characters", minPasswordLength)
+	}
+	if len(reg.Password) > maxPasswordLength {
+		return fmt.Errorf("password must have at most %d bytes", maxPasswordLength)
+	}
+	return reg.Role.IsValid()
+}
+
+// RoleChange is the body of a request changing a user's role
+type RoleChange struct {
+	Role Role `json:"role"`
+}
+
+// Credentials is the body of a login request
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Register creates the account of a validated registration
+func Register(ctx context.Context, reg Registration) (User, error) {
+	user, err := newUser(reg)
+	if err != nil {
+		return User{}, err
+	}
+	return putNewUser(ctx, user)
+}
+
+// RegisterFirst creates the account of the first user, failing with
+// ErrNotFirstUser when another registration created it first
+func RegisterFirst(ctx context.Context, reg Registration) (User, error) {
+	user, err := newUser(reg)
+	if err != nil {
+		return User{}, err
+	}
+	item, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		return User{}, err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName: aws.String("Counters"),
+				Item: map[string]types.AttributeValue{
+					"Name":      &types.AttributeValueMemberS{Value: firstUserMarker},
+					"Shard":     &types.AttributeValueMemberN{Value: "0"},
+					"CreatedAt": &types.AttributeValueMemberS{Value: user.CreatedAt},
+				},
+				ConditionExpression:      aws.String("attribute_not_exists(#name)"),
+				ExpressionAttributeNames: map[string]string{"#name": "Name"},
+			}},
+			{Put: &types.Put{
+				TableName:           aws.String(TableName),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(Email)"),
+			}},
+		},
+	})
+	var tce *types.TransactionCanceledException
+	if errors.As(err, &tce) {
+		if len(tce.CancellationReasons) == 2 && aws.ToString(tce.CancellationReasons[1].Code) == "ConditionalCheckFailed" &&
+			aws.ToString(tce.CancellationReasons[0].Code) != "ConditionalCheckFailed" {
+			return User{}, ErrEmailTaken
+		}
+		return User{}, ErrNotFirstUser
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// newUser builds the account of a validated registration, hashing its password
+func newUser(reg Registration) (User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(reg.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	return User{
+		ID:           uuid.NewString(),
+		Email:        normalizeEmail(reg.Email),
+		Name:         reg.Name,
+		Role:         reg.Role,
+		ClinicID:     reg.ClinicID,
+		PasswordHash: string(hash),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, nil
+}
+
+// putNewUser stores an account, refusing emails that already have one
+func putNewUser(ctx context.Context, user User) (User, error) {
+	item, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		return User{}, err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(Email)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return User{}, ErrEmailTaken
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// Authenticate returns the user with the given email and password
+func Authenticate(ctx context.Context, creds Credentials) (User, error) {
+	user, err := GetUser(ctx, creds.Email)
+	if err != nil {
+		return User{}, err
+	}
+	if user == nil || user.PasswordHash == "" {
+		// Hash anyway, so unknown emails and accounts that log in through
+		// single sign-on take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(creds.Password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(creds.Password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return User{}, ErrAccountDisabled
+	}
+	return *user, nil
+}
+
+// dummyHash is compared against when the email has no account
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// GetUser returns the account of an email, or nil when there is none
+func GetUser(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"Email": &types.AttributeValueMemberS{Value: normalizeEmail(email)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var user User
+	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+		return nil, err
+	}
+	withDefaults(&user)
+	return &user, nil
+}
+
+// withDefaults gives accounts created before roles and clinics existed the
+// full access they had, in the default clinic
+func withDefaults(user *User) {
+	if user.Role == "" {
+		user.Role = RoleAdmin
+	}
+	if user.ClinicID == "" {
+		user.ClinicID = config.DefaultClinicID
+	}
+}
+
+// SetRole changes the role of the account of an email in a clinic, returning
+// nil when the clinic has no such account. The new role is in the tokens
+// issued from the next login or refresh.
+func SetRole(ctx context.Context, clinicID, email string, role Role) (*User, error) {
+	condition := "attribute_exists(Email) AND ClinicID = :clinic"
+	if clinicID == config.DefaultClinicID {
+		condition = "attribute_exists(Email) AND (attribute_not_exists(ClinicID) OR ClinicID = :clinic)"
+	}
+
+	return updateUser(ctx, email, &dynamodb.UpdateItemInput{
+		UpdateExpression:    aws.String("SET #role = :role, UpdatedAt = :now"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#role": "Role",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":role":   &types.AttributeValueMemberS{Value: string(role)},
+			":now":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+}
+
+// SetGroupRole gives the account of an email the role in every clinic of an
+// organization, returning nil when there is no such account. The caller
+// checks the account's clinic belongs to the organization.
+func SetGroupRole(ctx context.Context, organizationID, email string, role Role) (*User, error) {
+	return updateUser(ctx, email, &dynamodb.UpdateItemInput{
+		UpdateExpression:    aws.String("SET #role = :role, OrganizationID = :org, UpdatedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(Email)"),
+		ExpressionAttributeNames: map[string]string{
+			"#role": "Role",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":role": &types.AttributeValueMemberS{Value: string(role)},
+			":org":  &types.AttributeValueMemberS{Value: organizationID},
+			":now":  &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+}
+
+// ClearGroupRole limits the account of an email with a group-level role in
+// an organization to its own clinic, keeping its role there. It returns nil
+// when the organization gave the account no role.
+func ClearGroupRole(ctx context.Context, organizationID, email string) (*User, error) {
+	return updateUser(ctx, email, &dynamodb.UpdateItemInput{
+		UpdateExpression:    aws.String("REMOVE OrganizationID SET UpdatedAt = :now"),
+		ConditionExpression: aws.String("OrganizationID = :org"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":org": &types.AttributeValueMemberS{Value: organizationID},
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+}
+
+// updateUser applies an update to the account of an email, returning nil
+// when its condition fails
+func updateUser(ctx context.Context, email string, input *dynamodb.UpdateItemInput) (*User, error) {
+	input.TableName = aws.String(TableName)
+	input.Key = map[string]types.AttributeValue{
+		"Email": &types.AttributeValueMemberS{Value: normalizeEmail(email)},
+	}
+	input.ReturnValues = types.ReturnValueAllNew
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.UpdateItem(ctx, input)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user User
+	if err := attributevalue.UnmarshalMap(result.Attributes, &user); err != nil {
+		return nil, err
+	}
+	withDefaults(&user)
+	return &user, nil
+}
+
+// hasUsers reports whether any account exists yet
+func hasUsers(ctx context.Context) (bool, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.Scan(ctx, &dynamodb.ScanInput{
+		TableName:            aws.String(TableName),
+		Limit:                aws.Int32(1),
+		ProjectionExpression: aws.String("Email"),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(result.Items) > 0, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,56 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrNotFound is returned when no object is stored under a key
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps files, such as patient attachments, outside the database.
+// Keys are slash separated paths chosen by the caller.
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStoreFromEnv returns the store selected by the BLOB_STORE environment
+// variable: "local" by default, files under BLOB_DIR for development, or
+// "s3", the bucket at BLOB_S3_BUCKET
+func NewStoreFromEnv() (Store, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return &LocalStore{Dir: dir}, nil
+	case "s3":
+		bucket := os.Getenv("BLOB_S3_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("BLOB_S3_BUCKET is required for the s3 store")
+		}
+		return NewS3Store(bucket, os.Getenv("BLOB_S3_REGION"), os.Getenv("BLOB_S3_ENDPOINT"))
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", os.Getenv("BLOB_STORE"))
+	}
+}
+
+var (
+	store     Store
+	storeErr  error
+	storeOnce sync.Once
+)
+
+// Default returns the store configured in the environment
+func Default() (Store, error) {
+	storeOnce.Do(func() {
+		store, storeErr = NewStoreFromEnv()
+	})
+	return store, storeErr
+}
@@ -0,0 +1,130 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// S3Store is an Amazon S3 bucket, reached through the S3 REST API with the
+// credentials of the default AWS chain (environment, shared config or
+// instance role). With an endpoint, buckets are addressed by path, which
+// LocalStack and other S3 compatible services expect.
+type S3Store struct {
+	Bucket      string
+	Region      string
+	Endpoint    string
+	Credentials aws.CredentialsProvider
+	Client      *http.Client
+	signer      *v4.Signer // signs the path as sent: S3 does not escape it twice
+}
+
+// NewS3Store returns the store for bucket. The region defaults to us-east-1
+// and the endpoint to the bucket's virtual host on AWS.
+func NewS3Store(bucket, region, endpoint string) (*S3Store, error) {
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration for S3: %v", err)
+	}
+	return &S3Store{
+		Bucket:      bucket,
+		Region:      region,
+		Endpoint:    strings.TrimSuffix(endpoint, "/"),
+		Credentials: cfg.Credentials,
+		Client:      &http.Client{Timeout: 60 * time.Second},
+		signer:      v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true }),
+	}, nil
+}
+
+// Put uploads the object, replacing the one under the same key
+func (s *S3Store) Put(ctx context.Context, key, contentType string, data []byte) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	_, err := s.call(ctx, http.MethodPut, key, header, data)
+	return err
+}
+
+// Get downloads the object
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.call(ctx, http.MethodGet, key, nil, nil)
+}
+
+// Delete removes the object; S3 does not fail for a missing object
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.call(ctx, http.MethodDelete, key, nil, nil)
+	return err
+}
+
+// objectURL returns the address of the object under key
+func (s *S3Store) objectURL(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	path := strings.Join(parts, "/")
+	if s.Endpoint != "" {
+		return s.Endpoint + "/" + url.PathEscape(s.Bucket) + "/" + path
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.Bucket, s.Region, path)
+}
+
+// call signs and sends a request for the object under key, returning the
+// body of the response
+func (s *S3Store) call(ctx context.Context, method, key string, header http.Header, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	creds, err := s.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving AWS credentials for S3: %v", err)
+	}
+	if err := s.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", s.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("S3 %s %s returned %s: %s", method, key, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
@@ -0,0 +1,292 @@
+// Package budget gives every API request a time budget: a deadline on its
+// context, so the DynamoDB calls made past it fail instead of keeping the
+// client waiting. Requests that fail once their budget ran out answer 504.
+// List endpoints, marked with List when their routes are registered, can
+// instead answer the items read so far, with the cursor to continue, when the
+// client accepts partial results (?partial=true).
+package budget
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// PartialHeader marks responses holding a partial list: the budget ran out
+// before the page was complete, and its cursor continues where it stopped
+const PartialHeader = "X-Partial-Results"
+
+// reserveFraction is the part of the budget lists leave for the work done
+// after they are read, such as expanding related records and encoding
+const reserveFraction = 5
+
+// Rule sets the budget of the routes matching Method (any when empty) and
+// Template, a route path template such as /api/v1/dental/patient/{id}. A
+// zero Budget leaves the route unbounded.
+type Rule struct {
+	Method   string
+	Template string
+	Budget   time.Duration
+}
+
+// Settings are the budgets of the routes: the rules of REQUEST_BUDGETS
+// first, then report endpoints (REQUEST_BUDGET_REPORT), the list endpoints
+// marked with List (REQUEST_BUDGET_LIST) and every other request
+// (REQUEST_BUDGET)
+type Settings struct {
+	Rules   []Rule
+	Report  time.Duration
+	List    time.Duration
+	Default time.Duration
+}
+
+var (
+	settings     Settings
+	settingsOnce sync.Once
+)
+
+// Load reads the settings from the environment. REQUEST_BUDGETS holds
+// comma-separated rules such as "GET /api/v1/dental/appointment/calendar=5s"
+// or "/api/v1/admin/export/{table}=0"; invalid rules are logged and skipped.
+func Load() Settings {
+	s := Settings{
+		Report:  config.EnvDuration("REQUEST_BUDGET_REPORT", 30*time.Second),
+		List:    config.EnvDuration("REQUEST_BUDGET_LIST", 2*time.Second),
+		Default: config.EnvDuration("REQUEST_BUDGET", 10*time.Second),
+	}
+	for _, spec := range strings.Split(config.EnvString("REQUEST_BUDGETS", ""), ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		rule, err := parseRule(spec)
+		if err != nil {
+			log.Printf("Ignoring request budget %q: %v", spec, err)
+			continue
+		}
+		s.Rules = append(s.Rules, rule)
+	}
+	// Configured rules take precedence over the built-in ones: streams and
+	// exports last as long as the data does
+	s.Rules = append(s.Rules,
+		Rule{Method: http.MethodGet, Template: "/api/v1/dental/stats/live"},
+		Rule{Method: http.MethodGet, Template: "/api/v1/dental/appointment/queue/live"},
+		Rule{Method: http.MethodGet, Template: "/api/v1/admin/export/{table}"},
+	)
+	return s
+}
+
+func parseRule(spec string) (Rule, error) {
+	route, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("expected [METHOD ]TEMPLATE=DURATION")
+	}
+	budget, err := time.ParseDuration(strings.TrimSpace(value))
+	if value == "0" {
+		budget, err = 0, nil
+	}
+	if err != nil || budget < 0 {
+		return Rule{}, fmt.Errorf("invalid duration %q", value)
+	}
+	var rule Rule
+	fields := strings.Fields(route)
+	switch len(fields) {
+	case 1:
+		rule = Rule{Template: fields[0], Budget: budget}
+	case 2:
+		rule = Rule{Method: strings.ToUpper(fields[0]), Template: fields[1], Budget: budget}
+	default:
+		return Rule{}, fmt.Errorf("expected [METHOD ]TEMPLATE=DURATION")
+	}
+	if !strings.HasPrefix(rule.Template, "/") {
+		return Rule{}, fmt.Errorf("template must start with /")
+	}
+	return rule, nil
+}
+
+func current() Settings {
+	settingsOnce.Do(func() {
+		settings = Load()
+	})
+	return settings
+}
+
+// For returns the budget of a route, list telling whether it is marked with
+// List; zero leaves it unbounded
+func (s Settings) For(method, template string, list bool) time.Duration {
+	for _, rule := range s.Rules {
+		if (rule.Method == "" || rule.Method == method) && rule.Template == template {
+			return rule.Budget
+		}
+	}
+	switch {
+	case isReport(template):
+		return s.Report
+	case list:
+		return s.List
+	}
+	return s.Default
+}
+
+// isReport reports whether a route builds a report or a document, which
+// read far more records than other endpoints
+func isReport(template string) bool {
+	if strings.Contains(template, "/reports/") {
+		return true
+	}
+	for _, suffix := range []string{"/report", "/statement", "/pdf", "/print"} {
+		if strings.HasSuffix(template, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// list is a handler marked with List
+type list struct {
+	http.Handler
+}
+
+// List marks handler as serving a list read through the paging package,
+// which stops early with the items read so far when the budget runs short,
+// so its route gets the list budget. It wraps the handler registered on the
+// route, outside any other wrapper; the other GET endpoints, which compute
+// their answer from everything they read, keep the default budget.
+func List(handler http.Handler) http.Handler {
+	return list{handler}
+}
+
+// ListFunc is List for a handler function
+func ListFunc(handler http.HandlerFunc) http.Handler {
+	return list{handler}
+}
+
+type contextKey struct{}
+
+// state is what a request's context carries about its budget
+type state struct {
+	budget   time.Duration
+	deadline time.Time
+	partial  bool // the client accepts partial results
+	cut      bool // a list stopped early
+}
+
+func fromContext(ctx context.Context) *state {
+	s, _ := ctx.Value(contextKey{}).(*state)
+	return s
+}
+
+// Middleware bounds each request by the budget of its route. It is used on
+// the routers owning the routes, where the matched route template is known;
+// the routes of the main router that hand requests to a module router are
+// left to that router.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil || streaming(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := route.GetHandler().(*mux.Router); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, isList := route.GetHandler().(list)
+		budget := current().For(r.Method, template, isList)
+		if budget <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+		s := &state{budget: budget, partial: r.URL.Query().Get("partial") == "true"}
+		s.deadline, _ = ctx.Deadline()
+		ctx = context.WithValue(ctx, contextKey{}, s)
+
+		bw := &budgetWriter{ResponseWriter: w, ctx: ctx, state: s, route: r.Method + " " + template}
+		next.ServeHTTP(bw, r.WithContext(ctx))
+	})
+}
+
+// streaming reports whether the client asked for a streamed response, which
+// lasts as long as the data does
+func streaming(r *http.Request) bool {
+	return r.URL.Query().Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// StopEarly reports whether a list being read should stop where it is and
+// answer the items read so far: the client accepts partial results and the
+// request used most of its budget, or all of it. The response is then
+// marked as partial.
+func StopEarly(ctx context.Context) bool {
+	s := fromContext(ctx)
+	if s == nil || !s.partial {
+		return false
+	}
+	if ctx.Err() == nil && time.Until(s.deadline) > s.budget/reserveFraction {
+		return false
+	}
+	s.cut = true
+	return true
+}
+
+// budgetWriter marks partial lists and turns the server errors of requests
+// that ran out of budget into 504 Gateway Timeout
+type budgetWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	state       *state
+	route       string
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (b *budgetWriter) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	if status >= http.StatusInternalServerError && b.ctx.Err() == context.DeadlineExceeded {
+		b.timedOut = true
+		log.Printf("Request %s exceeded its budget of %s", b.route, b.state.budget)
+		b.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		b.Header().Del("Content-Length")
+		b.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+		fmt.Fprintf(b.ResponseWriter, "Request did not complete within its time budget of %s", b.state.budget)
+		return
+	}
+	if b.state.cut {
+		b.Header().Set(PartialHeader, "true")
+	}
+	b.ResponseWriter.WriteHeader(status)
+}
+
+func (b *budgetWriter) Write(p []byte) (int, error) {
+	if !b.wroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.timedOut {
+		// The handler's own error message is replaced by the timeout's
+		return len(p), nil
+	}
+	return b.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses working through the wrapper
+func (b *budgetWriter) Flush() {
+	if f, ok := b.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
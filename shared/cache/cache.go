@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// Cache is an in-memory key/value store with per-entry expiration
+type Cache struct {
+	mu    sync.RWMutex
+	items map[string]entry
+}
+
+// New creates an empty cache
+func New() *Cache {
+	return &Cache{items: make(map[string]entry)}
+}
+
+// Default is the process-wide cache shared by the modules
+var Default = New()
+
+// Get returns the value stored under key if it has not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	e, ok := c.items[key]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key for ttl
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	c.items[key] = entry{value: value, expiresAt: time.Now().Add(ttl)}
+	c.mu.Unlock()
+}
+
+// Delete removes key from the cache
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
+
+// DeletePrefix removes every key starting with prefix
+func (c *Cache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	for key := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.items, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Purge drops expired entries
+func (c *Cache) Purge() {
+	now := time.Now()
+	c.mu.Lock()
+	for key, e := range c.items {
+		if now.After(e.expiresAt) {
+			delete(c.items, key)
+		}
+	}
+	c.mu.Unlock()
+}
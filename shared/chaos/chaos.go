@@ -0,0 +1,148 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Injectable error kinds
+const (
+	ErrorThrottle = "throttle"
+	ErrorInternal = "internal"
+	ErrorNetwork  = "network"
+)
+
+// Settings describes the failures injected into DynamoDB calls
+type Settings struct {
+	LatencyMs  int      `json:"latency_ms"`
+	ErrorRate  float64  `json:"error_rate"`
+	ErrorKind  string   `json:"error_kind"`
+	Operations []string `json:"operations,omitempty"`
+}
+
+// IsValid checks the settings before they are applied
+func (s *Settings) IsValid() error {
+	if s.LatencyMs < 0 {
+		return fmt.Errorf("latency_ms must not be negative")
+	}
+	if s.ErrorRate < 0 || s.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	switch s.ErrorKind {
+	case "":
+		s.ErrorKind = ErrorThrottle
+	case ErrorThrottle, ErrorInternal, ErrorNetwork:
+	default:
+		return fmt.Errorf("error_kind must be one of %s, %s, %s", ErrorThrottle, ErrorInternal, ErrorNetwork)
+	}
+	return nil
+}
+
+// applies reports whether the settings target a DynamoDB operation (e.g. "GetItem")
+func (s Settings) applies(operation string) bool {
+	if len(s.Operations) == 0 {
+		return true
+	}
+	for _, op := range s.Operations {
+		if strings.EqualFold(op, operation) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mu      sync.RWMutex
+	current Settings
+)
+
+// Get returns the active settings
+func Get() Settings {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Set replaces the active settings
+func Set(s Settings) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = s
+	log.Printf("Chaos settings updated: %+v", s)
+}
+
+// Reset stops injecting failures
+func Reset() {
+	Set(Settings{})
+}
+
+// HTTPClient is the transport used by the DynamoDB client
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type injector struct {
+	next HTTPClient
+}
+
+// WrapHTTPClient injects the configured latency and errors in front of every
+// DynamoDB request. Errors are returned as DynamoDB error responses so the
+// SDK retry logic handles them like real failures.
+func WrapHTTPClient(client HTTPClient) HTTPClient {
+	log.Println("WARNING: chaos failure injection is compiled in; do not run this build in production")
+	return &injector{next: client}
+}
+
+func (i *injector) Do(req *http.Request) (*http.Response, error) {
+	s := Get()
+	operation := strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+	if !s.applies(operation) {
+		return i.next.Do(req)
+	}
+
+	if s.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(s.LatencyMs) * time.Millisecond):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if s.ErrorRate > 0 && rand.Float64() < s.ErrorRate {
+		switch s.ErrorKind {
+		case ErrorNetwork:
+			return nil, errors.New("chaos: connection reset by peer")
+		case ErrorInternal:
+			return errorResponse(req, http.StatusInternalServerError, "InternalServerError"), nil
+		default:
+			return errorResponse(req, http.StatusBadRequest, "ProvisionedThroughputExceededException"), nil
+		}
+	}
+
+	return i.next.Do(req)
+}
+
+func errorResponse(req *http.Request, status int, errorType string) *http.Response {
+	body := fmt.Sprintf(`{"__type":"com.amazonaws.dynamodb.v20120810#%s","message":"injected by chaos"}`, errorType)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/x-amz-json-1.0"}},
+		Body:          io.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
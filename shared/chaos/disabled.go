@@ -0,0 +1,15 @@
+//go:build !chaos
+
+package chaos
+
+import "net/http"
+
+// HTTPClient is the transport used by the DynamoDB client
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// WrapHTTPClient returns the client untouched; build with -tags chaos to inject failures
+func WrapHTTPClient(client HTTPClient) HTTPClient {
+	return client
+}
@@ -0,0 +1,230 @@
+// Package clinics stores the clinics sharing a deployment and resolves the
+// clinic, or tenant, each request works on. The DynamoDB calls made with the
+// request context are then confined to that clinic's records.
+package clinics
+
+import (
+	"context"
+	"dental-saas/shared/cache"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// TableName holds the clinics, keyed by ID. The default clinic, which owns
+// the records created before clinics existed, is not stored.
+const TableName = "Clinics"
+
+// HeaderName selects the clinic of requests made to the public endpoints
+// without an access token, such as the online booking widget of a clinic's
+// website
+const HeaderName = "X-Clinic-ID"
+
+// SandboxHeader marks the responses of requests working on a sandbox clinic
+const SandboxHeader = "X-Sandbox"
+
+const cacheTTL = 10 * time.Minute
+
+// ErrNotFound is returned for a clinic that does not exist
+var ErrNotFound = errors.New("clinic not found")
+
+// Clinic is a clinic sharing the deployment. Region pins its data to the
+// tables of an AWS region enabled in DATA_RESIDENCY_REGIONS; it is set when
+// the clinic is created, since its records are not moved between regions.
+// A sandbox clinic, for demos and integration tests, works like any other
+// but sends nothing out: its notifications are recorded instead of delivered
+// and its documents are marked as having no fiscal value. A clinic of a
+// dental group belongs to the group's organization.
+type Clinic struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Region         string `json:"region,omitempty"`
+	Sandbox        bool   `json:"sandbox,omitempty"`
+	OrganizationID string `json:"organization_id,omitempty"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	UpdatedAt      string `json:"updated_at,omitempty"`
+}
+
+// IsValid checks the clinic has a name and its region is enabled
+func (c *Clinic) IsValid() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	c.Region = strings.TrimSpace(c.Region)
+	if c.Region == config.HomeRegion {
+		c.Region = ""
+	}
+	return config.ValidRegion(c.Region)
+}
+
+// Default returns the default clinic
+func Default() Clinic {
+	return Clinic{ID: config.DefaultClinicID, Name: config.EnvString("DEFAULT_CLINIC_NAME", "Default clinic")}
+}
+
+// Create stores a new clinic with a generated ID
+func Create(ctx context.Context, clinic Clinic) (Clinic, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	clinic.ID = uuid.NewString()
+	clinic.CreatedAt = now
+	clinic.UpdatedAt = now
+
+	item, err := attributevalue.MarshalMap(clinic)
+	if err != nil {
+		return Clinic{}, err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}); err != nil {
+		return Clinic{}, err
+	}
+	return clinic, nil
+}
+
+// Delete removes a clinic; it is only used to undo a creation that could not
+// be completed
+func Delete(ctx context.Context, id string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	cache.Default.Delete(cacheKey(id))
+	return err
+}
+
+// Get returns a clinic, caching it since every request without an access
+// token looks its clinic up
+func Get(ctx context.Context, id string) (Clinic, error) {
+	if id == config.DefaultClinicID {
+		return Default(), nil
+	}
+	if v, ok := cache.Default.Get(cacheKey(id)); ok {
+		return v.(Clinic), nil
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Clinic{}, err
+	}
+	if result.Item == nil {
+		return Clinic{}, ErrNotFound
+	}
+	var clinic Clinic
+	if err := attributevalue.UnmarshalMap(result.Item, &clinic); err != nil {
+		return Clinic{}, err
+	}
+	cache.Default.Set(cacheKey(id), clinic, cacheTTL)
+	return clinic, nil
+}
+
+// List returns every clinic, the default one first and the others by name
+func List(ctx context.Context) ([]Clinic, error) {
+	var clinics []Clinic
+	paginator := dynamodb.NewScanPaginator(config.DBClient, &dynamodb.ScanInput{
+		TableName: aws.String(TableName),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var pageItems []Clinic
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageItems); err != nil {
+			return nil, err
+		}
+		clinics = append(clinics, pageItems...)
+	}
+	sort.Slice(clinics, func(i, j int) bool {
+		return clinics[i].Name < clinics[j].Name
+	})
+	return append([]Clinic{Default()}, clinics...), nil
+}
+
+// IDs returns the ID of every clinic, for jobs that run once per clinic
+func IDs(ctx context.Context) ([]string, error) {
+	clinics, err := List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(clinics))
+	for i, clinic := range clinics {
+		ids[i] = clinic.ID
+	}
+	return ids, nil
+}
+
+// Each runs fn once per clinic with ctx scoped to it, for the jobs that serve
+// every clinic: unscoped, their calls would only reach the records kept in
+// the home region and miss the clinics pinned to another one. A clinic that
+// fails does not stop the others; their errors are returned together.
+func Each(ctx context.Context, fn func(ctx context.Context) error) error {
+	ids, err := IDs(ctx)
+	if err != nil {
+		return fmt.Errorf("listing clinics: %v", err)
+	}
+	var errs []error
+	for _, id := range ids {
+		if err := fn(config.WithClinic(ctx, id)); err != nil {
+			errs = append(errs, fmt.Errorf("clinic %s: %v", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// region looks up the region a clinic's data is pinned to, for the routing
+// of the DynamoDB client
+func region(ctx context.Context, id string) (string, error) {
+	clinic, err := Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return clinic.Region, nil
+}
+
+// sandbox looks up whether a clinic is a sandbox
+func sandbox(ctx context.Context, id string) (bool, error) {
+	clinic, err := Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return clinic.Sandbox, nil
+}
+
+func init() {
+	config.ClinicRegion = region
+	config.ClinicSandbox = sandbox
+}
+
+func cacheKey(id string) string {
+	return "clinics:" + id
+}
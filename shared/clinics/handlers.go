@@ -0,0 +1,525 @@
+package clinics
+
+import (
+	"dental-saas/shared/auth"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// NewClinic is the body of a request creating a clinic with its first admin
+type NewClinic struct {
+	Name    string            `json:"name"`
+	Region  string            `json:"region,omitempty"`
+	Sandbox bool              `json:"sandbox,omitempty"`
+	Admin   auth.Registration `json:"admin"`
+}
+
+// CreateHandler godoc
+// @Summary Create a clinic
+// @Description Create a clinic sharing this deployment, with the account of its first admin, who then registers the rest of its team. Only admins of the default clinic, who operate the deployment, can create clinics. A region among DATA_RESIDENCY_REGIONS keeps the clinic's records in that AWS region; it cannot be changed later. A sandbox clinic, for demos and integration tests, sends nothing out: its notifications are recorded (see /api/v1/admin/sandbox/notifications) and its documents are marked; responses for it carry X-Sandbox: true.
+// @Tags clinics
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param clinic body clinics.NewClinic true "Clinic name, optional data region, sandbox flag and its admin's name, email and password"
+// @Success 201 {object} clinics.Clinic
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage clinics"
+// @Failure 409 {object} apierror.Response "A user with this email already exists"
+// @Failure 500 {object} apierror.Response "Failed to create clinic"
+// @Router /api/v1/clinics [post]
+func CreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !operator(w, r) {
+		return
+	}
+	var req NewClinic
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	clinic := Clinic{Name: req.Name, Region: req.Region, Sandbox: req.Sandbox}
+	if err := clinic.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Admin.Role = auth.RoleAdmin
+	if err := req.Admin.IsValid(); err != nil {
+		http.Error(w, "admin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clinic, err := Create(r.Context(), clinic)
+	if err != nil {
+		http.Error(w, "Failed to create clinic", http.StatusInternalServerError)
+		log.Printf("Error creating clinic: %v", err)
+		return
+	}
+	req.Admin.ClinicID = clinic.ID
+	if _, err := auth.Register(r.Context(), req.Admin); err != nil {
+		// A clinic nobody can log in to is useless, so the creation is undone
+		if err := Delete(r.Context(), clinic.ID); err != nil {
+			log.Printf("Error removing clinic %s after failing to register its admin: %v", clinic.ID, err)
+		}
+		if errors.Is(err, auth.ErrEmailTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create clinic", http.StatusInternalServerError)
+		log.Printf("Error registering admin of clinic %s: %v", clinic.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clinic)
+}
+
+// ListHandler godoc
+// @Summary List clinics
+// @Description List the clinics sharing this deployment, the default one first (admins of the default clinic only)
+// @Tags clinics
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Success 200 {array} clinics.Clinic
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage clinics"
+// @Failure 500 {object} apierror.Response "Failed to retrieve clinics"
+// @Router /api/v1/clinics [get]
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	if !operator(w, r) {
+		return
+	}
+	clinics, err := List(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve clinics", http.StatusInternalServerError)
+		log.Printf("Error listing clinics: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clinics)
+}
+
+// CurrentHandler godoc
+// @Summary Get the current clinic
+// @Description Get the clinic the request works on: the clinic of the logged-in user
+// @Tags clinics
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Success 200 {object} clinics.Clinic
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 500 {object} apierror.Response "Failed to retrieve clinic"
+// @Router /api/v1/clinics/current [get]
+func CurrentHandler(w http.ResponseWriter, r *http.Request) {
+	clinic, err := Get(r.Context(), config.ClinicID(r.Context()))
+	if err != nil {
+		http.Error(w, "Failed to retrieve clinic", http.StatusInternalServerError)
+		log.Printf("Error loading clinic %s: %v", config.ClinicID(r.Context()), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clinic)
+}
+
+// operator checks the user is an admin of the default clinic, who manages
+// the clinics of the deployment
+func operator(w http.ResponseWriter, r *http.Request) bool {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if !claims.Operator() {
+		http.Error(w, "Only admins of the default clinic can manage clinics", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// groupAdmin checks the user is an operator or an admin with a group-level
+// role in the organization
+func groupAdmin(w http.ResponseWriter, r *http.Request, organizationID string) (*auth.Claims, bool) {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !claims.Operator() && (claims.Role != auth.RoleAdmin || claims.Organization != organizationID) {
+		http.Error(w, "Only operators and the organization's group admins can manage the organization", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+// CreateOrganizationHandler godoc
+// @Summary Create an organization
+// @Description Create the organization of a dental group, which owns several clinics under one subscription (operators only). Clinics are then added to it, and its users given group-level roles.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param organization body clinics.Organization true "Organization name and subscription ID"
+// @Success 201 {object} clinics.Organization
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage clinics"
+// @Failure 500 {object} apierror.Response "Failed to create organization"
+// @Router /api/v1/organizations [post]
+func CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	if !operator(w, r) {
+		return
+	}
+	var org Organization
+	if err := json.NewDecoder(r.Body).Decode(&org); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := org.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	org, err := CreateOrganization(r.Context(), org)
+	if err != nil {
+		http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+		log.Printf("Error creating organization: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// ListOrganizationsHandler godoc
+// @Summary List organizations
+// @Description List the organizations of the deployment by name (operators only)
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Success 200 {array} clinics.Organization
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage clinics"
+// @Failure 500 {object} apierror.Response "Failed to retrieve organizations"
+// @Router /api/v1/organizations [get]
+func ListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !operator(w, r) {
+		return
+	}
+	orgs, err := ListOrganizations(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve organizations", http.StatusInternalServerError)
+		log.Printf("Error listing organizations: %v", err)
+		return
+	}
+	if orgs == nil {
+		orgs = []Organization{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+// GetOrganizationHandler godoc
+// @Summary Get an organization
+// @Description Get an organization with its clinics, to operators and to the users with a group-level role in it, who pick the clinic they work on with X-Clinic-ID
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Param id path string true "Organization ID"
+// @Success 200 {object} clinics.OrganizationDetail
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 404 {object} apierror.Response "Organization not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve organization"
+// @Router /api/v1/organizations/{id} [get]
+func GetOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	// Users of other organizations are told it does not exist
+	if !claims.Operator() && claims.Organization != id {
+		http.Error(w, ErrOrganizationNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	org, err := GetOrganization(r.Context(), id)
+	if errors.Is(err, ErrOrganizationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve organization", http.StatusInternalServerError)
+		log.Printf("Error loading organization %s: %v", id, err)
+		return
+	}
+	clinics, err := OrganizationClinics(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve organization", http.StatusInternalServerError)
+		log.Printf("Error listing clinics of organization %s: %v", id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OrganizationDetail{Organization: org, Clinics: clinics})
+}
+
+// SetSharingPolicyHandler godoc
+// @Summary Set the patient sharing policy of an organization
+// @Description Decide whether the clinics of an organization see the records of each other's patients (operators and the organization's group admins): off, the default, keeps each clinic to its own; grant lets the patient's clinic share a record with another for up to share_max_days days (default 30); open lets every clinic see them all. Each record viewed by another clinic is recorded in the audit log of the patient's clinic.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an operator or group admin"
+// @Param id path string true "Organization ID"
+// @Param policy body clinics.SharingPolicy true "Patient sharing policy"
+// @Success 200 {object} clinics.Organization
+// @Failure 400 {object} apierror.Response "Invalid request body or policy"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only operators and the organization's group admins can manage the organization"
+// @Failure 404 {object} apierror.Response "Organization not found"
+// @Failure 500 {object} apierror.Response "Failed to update organization"
+// @Router /api/v1/organizations/{id}/sharing [put]
+func SetSharingPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := groupAdmin(w, r, id); !ok {
+		return
+	}
+	var policy SharingPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := policy.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	org, err := SetSharingPolicy(r.Context(), id, policy)
+	if errors.Is(err, ErrOrganizationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update organization", http.StatusInternalServerError)
+		log.Printf("Error setting sharing policy of organization %s: %v", id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(org)
+}
+
+// AddOrganizationClinicHandler godoc
+// @Summary Add a clinic to an organization
+// @Description Add a clinic to an organization, moving it from any other (operators only). The default clinic cannot join one.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param id path string true "Organization ID"
+// @Param clinicId path string true "Clinic ID"
+// @Success 200 {object} clinics.Clinic
+// @Failure 400 {object} apierror.Response "The default clinic cannot join an organization"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage clinics"
+// @Failure 404 {object} apierror.Response "Organization or clinic not found"
+// @Failure 500 {object} apierror.Response "Failed to update clinic"
+// @Router /api/v1/organizations/{id}/clinics/{clinicId} [put]
+func AddOrganizationClinicHandler(w http.ResponseWriter, r *http.Request) {
+	if !operator(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	if _, err := GetOrganization(r.Context(), vars["id"]); err != nil {
+		if errors.Is(err, ErrOrganizationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update clinic", http.StatusInternalServerError)
+		log.Printf("Error loading organization %s: %v", vars["id"], err)
+		return
+	}
+	setClinicOrganization(w, r, vars["clinicId"], vars["id"])
+}
+
+// RemoveOrganizationClinicHandler godoc
+// @Summary Remove a clinic from an organization
+// @Description Remove a clinic from its organization (operators only). Its users with a group-level role in the organization keep it in the other clinics.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param id path string true "Organization ID"
+// @Param clinicId path string true "Clinic ID"
+// @Success 200 {object} clinics.Clinic
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage clinics"
+// @Failure 404 {object} apierror.Response "Clinic not found in the organization"
+// @Failure 500 {object} apierror.Response "Failed to update clinic"
+// @Router /api/v1/organizations/{id}/clinics/{clinicId} [delete]
+func RemoveOrganizationClinicHandler(w http.ResponseWriter, r *http.Request) {
+	if !operator(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	member, err := InOrganization(r.Context(), vars["clinicId"], vars["id"])
+	if err != nil {
+		http.Error(w, "Failed to update clinic", http.StatusInternalServerError)
+		log.Printf("Error loading clinic %s: %v", vars["clinicId"], err)
+		return
+	}
+	if !member {
+		http.Error(w, "Clinic not found in the organization", http.StatusNotFound)
+		return
+	}
+	setClinicOrganization(w, r, vars["clinicId"], "")
+}
+
+func setClinicOrganization(w http.ResponseWriter, r *http.Request, clinicID, organizationID string) {
+	clinic, err := SetOrganization(r.Context(), clinicID, organizationID)
+	if errors.Is(err, ErrDefaultClinic) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Clinic not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update clinic", http.StatusInternalServerError)
+		log.Printf("Error setting organization of clinic %s: %v", clinicID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clinic)
+}
+
+// SetGroupRoleHandler godoc
+// @Summary Give a user a group-level role
+// @Description Give the account of an email, in one of the organization's clinics, a role in every clinic of the organization (operators and the organization's group admins). The user picks the clinic to work on with X-Clinic-ID, and gets the role in the tokens issued from their next login or refresh. Admins cannot change their own role.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an operator or group admin"
+// @Param id path string true "Organization ID"
+// @Param email path string true "User email"
+// @Param role body auth.RoleChange true "Role in the organization's clinics"
+// @Success 200 {object} auth.User
+// @Failure 400 {object} apierror.Response "Invalid request body or role"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only operators and the organization's group admins can manage the organization"
+// @Failure 404 {object} apierror.Response "User not found in the organization"
+// @Failure 409 {object} apierror.Response "Admins cannot change their own role"
+// @Failure 500 {object} apierror.Response "Failed to update user"
+// @Router /api/v1/organizations/{id}/users/{email} [put]
+func SetGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims, ok := groupAdmin(w, r, vars["id"])
+	if !ok {
+		return
+	}
+	var change auth.RoleChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := change.Role.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(claims.Email, strings.TrimSpace(vars["email"])) {
+		http.Error(w, "Admins cannot change their own role", http.StatusConflict)
+		return
+	}
+	if _, ok := organizationUser(w, r, vars["id"], vars["email"]); !ok {
+		return
+	}
+
+	user, err := auth.SetGroupRole(r.Context(), vars["id"], vars["email"], change.Role)
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error giving user %s a group-level role: %v", vars["email"], err)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found in the organization", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ClearGroupRoleHandler godoc
+// @Summary Remove a user's group-level role
+// @Description Limit a user with a group-level role in the organization to their own clinic, where they keep their role (operators and the organization's group admins). The change is in the tokens issued from their next login or refresh.
+// @Tags organizations
+// @Param Authorization header string true "Bearer access token of an operator or group admin"
+// @Param id path string true "Organization ID"
+// @Param email path string true "User email"
+// @Success 204 "Group-level role removed"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only operators and the organization's group admins can manage the organization"
+// @Failure 404 {object} apierror.Response "User has no group-level role in the organization"
+// @Failure 409 {object} apierror.Response "Admins cannot change their own role"
+// @Failure 500 {object} apierror.Response "Failed to update user"
+// @Router /api/v1/organizations/{id}/users/{email} [delete]
+func ClearGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims, ok := groupAdmin(w, r, vars["id"])
+	if !ok {
+		return
+	}
+	if strings.EqualFold(claims.Email, strings.TrimSpace(vars["email"])) {
+		http.Error(w, "Admins cannot change their own role", http.StatusConflict)
+		return
+	}
+
+	user, err := auth.ClearGroupRole(r.Context(), vars["id"], vars["email"])
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error removing group-level role of user %s: %v", vars["email"], err)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User has no group-level role in the organization", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// organizationUser fetches the account of an email whose clinic belongs to
+// the organization, writing the error response when there is none
+func organizationUser(w http.ResponseWriter, r *http.Request, organizationID, email string) (*auth.User, bool) {
+	user, err := auth.GetUser(r.Context(), email)
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error fetching user %s: %v", email, err)
+		return nil, false
+	}
+	if user == nil {
+		http.Error(w, "User not found in the organization", http.StatusNotFound)
+		return nil, false
+	}
+	member, err := InOrganization(r.Context(), user.ClinicID, organizationID)
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error loading clinic %s: %v", user.ClinicID, err)
+		return nil, false
+	}
+	if !member {
+		http.Error(w, "User not found in the organization", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
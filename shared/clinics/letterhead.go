@@ -0,0 +1,124 @@
+package clinics
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LetterheadTable holds the letterhead of each clinic, keyed by ClinicID
+const LetterheadTable = "Letterheads"
+
+// maxLetterheadField bounds each field so the letterhead fits a PDF line
+const maxLetterheadField = 90
+
+// Letterhead is printed at the top of the documents the clinic hands to
+// patients, such as invoices. Without one, documents carry the clinic's name.
+type Letterhead struct {
+	ClinicID  string `json:"clinic_id"`
+	Name      string `json:"name"`                 // trade name, the clinic's name by default
+	LegalName string `json:"legal_name,omitempty"` // razão social
+	TaxID     string `json:"tax_id,omitempty"`     // CNPJ or CPF
+	Address   string `json:"address,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Website   string `json:"website,omitempty"`
+	Footer    string `json:"footer,omitempty"` // closing note, e.g. payment instructions
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// IsValid trims the fields and checks each fits a line
+func (l *Letterhead) IsValid() error {
+	for name, field := range map[string]*string{
+		"name": &l.Name, "legal_name": &l.LegalName, "tax_id": &l.TaxID, "address": &l.Address,
+		"phone": &l.Phone, "email": &l.Email, "website": &l.Website, "footer": &l.Footer,
+	} {
+		*field = strings.TrimSpace(*field)
+		if len([]rune(*field)) > maxLetterheadField {
+			return fmt.Errorf("%s must not exceed %d characters", name, maxLetterheadField)
+		}
+	}
+	return nil
+}
+
+// Lines returns the letterhead as printed: the name, then the filled details
+func (l *Letterhead) Lines() []string {
+	lines := []string{l.Name}
+	if l.LegalName != "" {
+		lines = append(lines, l.LegalName)
+	}
+	if l.TaxID != "" {
+		lines = append(lines, "Tax ID: "+l.TaxID)
+	}
+	if l.Address != "" {
+		lines = append(lines, l.Address)
+	}
+	var contact []string
+	for _, field := range []string{l.Phone, l.Email, l.Website} {
+		if field != "" {
+			contact = append(contact, field)
+		}
+	}
+	if len(contact) > 0 {
+		lines = append(lines, strings.Join(contact, " | "))
+	}
+	return lines
+}
+
+// GetLetterhead returns the letterhead of a clinic, with the clinic's name
+// when none was configured or its name was left empty
+func GetLetterhead(ctx context.Context, clinicID string) (Letterhead, error) {
+	getCtx, cancel := config.DBContext(ctx)
+	result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+		TableName: aws.String(LetterheadTable),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	cancel()
+	if err != nil {
+		return Letterhead{}, err
+	}
+	letterhead := Letterhead{ClinicID: clinicID}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &letterhead); err != nil {
+			return Letterhead{}, err
+		}
+	}
+	if letterhead.Name == "" {
+		clinic, err := Get(ctx, clinicID)
+		if err != nil {
+			return Letterhead{}, err
+		}
+		letterhead.Name = clinic.Name
+	}
+	return letterhead, nil
+}
+
+// SaveLetterhead stores the letterhead of a clinic
+func SaveLetterhead(ctx context.Context, letterhead Letterhead) (Letterhead, error) {
+	if err := letterhead.IsValid(); err != nil {
+		return Letterhead{}, err
+	}
+	letterhead.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(letterhead)
+	if err != nil {
+		return Letterhead{}, err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(LetterheadTable),
+		Item:      item,
+	})
+	return letterhead, err
+}
@@ -0,0 +1,67 @@
+package clinics
+
+import (
+	"dental-saas/shared/auth"
+	"dental-saas/shared/config"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Middleware scopes each request to a clinic: the clinic of the logged-in
+// user's account or, for requests to the public endpoints, the one named in
+// the X-Clinic-ID header, falling back to the default clinic. Other requests
+// without an access token ignore the header. A user cannot pick another
+// clinic with the header, unless the user has a group-level role and picks
+// another clinic of the organization. Responses for sandbox clinics are
+// marked with X-Sandbox: true.
+func Middleware(public func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested := strings.TrimSpace(r.Header.Get(HeaderName))
+
+			clinicID := config.DefaultClinicID
+			if claims, ok := auth.FromContext(r.Context()); ok {
+				clinicID = claims.Clinic
+				if requested != "" && requested != clinicID {
+					member, err := InOrganization(r.Context(), requested, claims.Organization)
+					if err != nil {
+						http.Error(w, "Failed to resolve clinic", http.StatusInternalServerError)
+						log.Printf("Error loading clinic %s: %v", requested, err)
+						return
+					}
+					if !member {
+						http.Error(w, "Your account does not belong to this clinic", http.StatusForbidden)
+						return
+					}
+					clinicID = requested
+				}
+			} else if requested != "" && public(r) {
+				if _, err := Get(r.Context(), requested); err != nil {
+					if errors.Is(err, ErrNotFound) {
+						http.Error(w, "Unknown clinic", http.StatusBadRequest)
+						return
+					}
+					http.Error(w, "Failed to resolve clinic", http.StatusInternalServerError)
+					log.Printf("Error loading clinic %s: %v", requested, err)
+					return
+				}
+				clinicID = requested
+			}
+
+			ctx := config.WithClinic(r.Context(), clinicID)
+			sandbox, err := config.SandboxClinic(ctx, clinicID)
+			if err != nil {
+				http.Error(w, "Failed to resolve clinic", http.StatusInternalServerError)
+				log.Printf("Error loading clinic %s: %v", clinicID, err)
+				return
+			}
+			if sandbox {
+				w.Header().Set(SandboxHeader, "true")
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
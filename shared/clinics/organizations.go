@@ -0,0 +1,314 @@
+package clinics
+
+import (
+	"context"
+	"dental-saas/shared/cache"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// OrganizationsTable holds the organizations, keyed by ID
+const OrganizationsTable = "Organizations"
+
+var (
+	// ErrOrganizationNotFound is returned for an organization that does not exist
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrDefaultClinic is returned when adding the default clinic, which
+	// belongs to the operators of the deployment, to an organization
+	ErrDefaultClinic = errors.New("the default clinic cannot join an organization")
+)
+
+// Patient sharing policies of an organization, deciding whether its clinics
+// see the records of the patients of the others
+const (
+	SharingOff   = "off"   // each clinic sees only its own patients (default)
+	SharingGrant = "grant" // the patient's clinic grants another access for some days
+	SharingOpen  = "open"  // every clinic sees the patients of the others
+)
+
+// DefaultShareDays is how long a grant lasts at most when the organization
+// sets no limit
+const DefaultShareDays = 30
+
+// maxShareDays bounds the limit an organization can set
+const maxShareDays = 365
+
+// Organization is a dental group owning several clinics under one
+// subscription. Users with a group-level role act in any of its clinics, and
+// its financial reports consolidate theirs.
+type Organization struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	SubscriptionID string `json:"subscription_id,omitempty"` // the group's subscription in the billing system
+	SharingPolicy
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// SharingPolicy is how the clinics of an organization share patient records
+type SharingPolicy struct {
+	PatientSharing string `json:"patient_sharing,omitempty" dynamodbav:",omitempty"` // off, grant or open
+	ShareMaxDays   int    `json:"share_max_days,omitempty" dynamodbav:",omitempty"`  // longest grant, DefaultShareDays when 0
+}
+
+// IsValid checks the policy is known and the grant limit within bounds
+func (p *SharingPolicy) IsValid() error {
+	switch p.PatientSharing {
+	case "", SharingOff, SharingGrant, SharingOpen:
+	default:
+		return fmt.Errorf("patient_sharing must be off, grant or open")
+	}
+	if p.ShareMaxDays < 0 || p.ShareMaxDays > maxShareDays {
+		return fmt.Errorf("share_max_days must be between 0 (the default of %d) and %d", DefaultShareDays, maxShareDays)
+	}
+	return nil
+}
+
+// Sharing returns the patient sharing policy, SharingOff when unset
+func (p SharingPolicy) Sharing() string {
+	if p.PatientSharing == "" {
+		return SharingOff
+	}
+	return p.PatientSharing
+}
+
+// MaxShareDays returns how many days a grant lasts at most
+func (p SharingPolicy) MaxShareDays() int {
+	if p.ShareMaxDays == 0 {
+		return DefaultShareDays
+	}
+	return p.ShareMaxDays
+}
+
+// IsValid checks the organization has a name and a valid sharing policy
+func (o *Organization) IsValid() error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	o.SubscriptionID = strings.TrimSpace(o.SubscriptionID)
+	return o.SharingPolicy.IsValid()
+}
+
+// OrganizationDetail is an organization with its clinics
+type OrganizationDetail struct {
+	Organization
+	Clinics []Clinic `json:"clinics"`
+}
+
+// CreateOrganization stores a new organization with a generated ID
+func CreateOrganization(ctx context.Context, org Organization) (Organization, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	org.ID = uuid.NewString()
+	org.CreatedAt = now
+	org.UpdatedAt = now
+
+	item, err := attributevalue.MarshalMap(org)
+	if err != nil {
+		return Organization{}, err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(OrganizationsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}); err != nil {
+		return Organization{}, err
+	}
+	return org, nil
+}
+
+// GetOrganization returns an organization
+func GetOrganization(ctx context.Context, id string) (Organization, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(OrganizationsTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Organization{}, err
+	}
+	if result.Item == nil {
+		return Organization{}, ErrOrganizationNotFound
+	}
+	var org Organization
+	if err := attributevalue.UnmarshalMap(result.Item, &org); err != nil {
+		return Organization{}, err
+	}
+	return org, nil
+}
+
+// ListOrganizations returns every organization, by name
+func ListOrganizations(ctx context.Context) ([]Organization, error) {
+	var orgs []Organization
+	paginator := dynamodb.NewScanPaginator(config.DBClient, &dynamodb.ScanInput{
+		TableName: aws.String(OrganizationsTable),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var pageItems []Organization
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageItems); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, pageItems...)
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		return orgs[i].Name < orgs[j].Name
+	})
+	return orgs, nil
+}
+
+// OrganizationClinics returns the clinics of an organization, by name
+func OrganizationClinics(ctx context.Context, organizationID string) ([]Clinic, error) {
+	all, err := List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clinics := []Clinic{}
+	for _, clinic := range all {
+		if clinic.OrganizationID == organizationID {
+			clinics = append(clinics, clinic)
+		}
+	}
+	return clinics, nil
+}
+
+// SetOrganization adds a clinic to an organization, or removes it from its
+// organization when organizationID is empty. Other instances see the change
+// once their cached copy of the clinic expires.
+func SetOrganization(ctx context.Context, clinicID, organizationID string) (Clinic, error) {
+	if clinicID == config.DefaultClinicID {
+		return Clinic{}, ErrDefaultClinic
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+		UpdateExpression:    aws.String("SET OrganizationID = :org, UpdatedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":org": &types.AttributeValueMemberS{Value: organizationID},
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	}
+	if organizationID == "" {
+		input.UpdateExpression = aws.String("REMOVE OrganizationID SET UpdatedAt = :now")
+		delete(input.ExpressionAttributeValues, ":org")
+	}
+
+	updateCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+	result, err := config.DBClient.UpdateItem(updateCtx, input)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return Clinic{}, ErrNotFound
+	}
+	if err != nil {
+		return Clinic{}, err
+	}
+	var clinic Clinic
+	if err := attributevalue.UnmarshalMap(result.Attributes, &clinic); err != nil {
+		return Clinic{}, err
+	}
+	cache.Default.Delete(cacheKey(clinicID))
+	return clinic, nil
+}
+
+// InOrganization reports whether a clinic belongs to an organization
+func InOrganization(ctx context.Context, clinicID, organizationID string) (bool, error) {
+	if organizationID == "" {
+		return false, nil
+	}
+	clinic, err := Get(ctx, clinicID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return clinic.OrganizationID == organizationID, nil
+}
+
+// SetSharingPolicy replaces the patient sharing policy of an organization
+func SetSharingPolicy(ctx context.Context, organizationID string, policy SharingPolicy) (Organization, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(OrganizationsTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: organizationID},
+		},
+		UpdateExpression:    aws.String("SET PatientSharing = :sharing, ShareMaxDays = :days, UpdatedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sharing": &types.AttributeValueMemberS{Value: policy.Sharing()},
+			":days":    &types.AttributeValueMemberN{Value: strconv.Itoa(policy.ShareMaxDays)},
+			":now":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return Organization{}, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return Organization{}, err
+	}
+	var org Organization
+	if err := attributevalue.UnmarshalMap(result.Attributes, &org); err != nil {
+		return Organization{}, err
+	}
+	return org, nil
+}
+
+// SharedOrganization returns the organization two clinics both belong to, or
+// nil when they are not clinics of the same organization
+func SharedOrganization(ctx context.Context, clinicID, otherClinicID string) (*Organization, error) {
+	clinic, err := Get(ctx, clinicID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if clinic.OrganizationID == "" {
+		return nil, nil
+	}
+	member, err := InOrganization(ctx, otherClinicID, clinic.OrganizationID)
+	if err != nil || !member {
+		return nil, err
+	}
+	org, err := GetOrganization(ctx, clinic.OrganizationID)
+	if errors.Is(err, ErrOrganizationNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
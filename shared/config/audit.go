@@ -0,0 +1,406 @@
+package config
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/uuid"
+)
+
+// AuditLogTable holds who changed what in the audited tables, keyed by
+// ClinicID and Seq like the change log, so a date range is a key condition
+const AuditLogTable = "AuditLog"
+
+// AuditedTable is the entity type the writes to a table are audited under
+// and the attributes of its primary key, which make up the entity ID
+type AuditedTable struct {
+	Entity string
+	Keys   []string
+}
+
+// AuditedTables lists the tables of the dental and financial modules whose
+// writes are audited
+var AuditedTables = map[string]AuditedTable{
+	"Dentists":           {Entity: "dentists", Keys: []string{"ID"}},
+	"Patients":           {Entity: "patients", Keys: []string{"ID"}},
+	"Procedures":         {Entity: "procedures", Keys: []string{"ID"}},
+	"Appointments":       {Entity: "appointments", Keys: []string{"ID"}},
+	"DentistPrices":      {Entity: "dentist_prices", Keys: []string{"DentistID", "ProcedureID"}},
+	"Bundles":            {Entity: "bundles", Keys: []string{"ID"}},
+	"TreatmentPlans":     {Entity: "treatment_plans", Keys: []string{"ID"}},
+	"ProcedurePrices":    {Entity: "procedure_prices", Keys: []string{"ProcedureID", "EffectiveFrom"}},
+	"PriceAdjustments":   {Entity: "price_adjustments", Keys: []string{"ID"}},
+	"Tasks":              {Entity: "tasks", Keys: []string{"ID"}},
+	"PreAuths":           {Entity: "preauths", Keys: []string{"ID"}},
+	"Consents":           {Entity: "consents", Keys: []string{"PatientID", "ProcedureID"}},
+	"Medications":        {Entity: "medications", Keys: []string{"ID"}},
+	"Prescriptions":      {Entity: "prescriptions", Keys: []string{"ID"}},
+	"AnamnesisTemplates": {Entity: "anamnesis_templates", Keys: []string{"ID"}},
+	"Rooms":              {Entity: "rooms", Keys: []string{"ID"}},
+	"Waitlist":           {Entity: "waitlist", Keys: []string{"ID"}},
+	"Anamneses":          {Entity: "anamneses", Keys: []string{"PatientID", "Version"}},
+	"ClinicalNotes":      {Entity: "clinical_notes", Keys: []string{"PatientID", "ID"}},
+	"Attachments":        {Entity: "attachments", Keys: []string{"PatientID", "ID"}},
+	"ClinicalPhotos":     {Entity: "clinical_photos", Keys: []string{"PatientID", "ID"}},
+	"Odontograms":        {Entity: "odontograms", Keys: []string{"PatientID"}},
+	"Surveys":            {Entity: "surveys", Keys: []string{"AppointmentID"}},
+	"ProcedureOutcomes":  {Entity: "procedure_outcomes", Keys: []string{"AppointmentID"}},
+	"Unavailability":     {Entity: "unavailability", Keys: []string{"ID"}},
+	"DentistSchedules":   {Entity: "dentist_schedules", Keys: []string{"DentistID"}},
+	"CalendarSyncs":      {Entity: "calendar_syncs", Keys: []string{"DentistID"}},
+	"Expenses":           {Entity: "expenses", Keys: []string{"ID"}},
+	"Revenues":           {Entity: "revenues", Keys: []string{"ID"}},
+	"Invoices":           {Entity: "invoices", Keys: []string{"ID"}},
+	"CreditBalances":     {Entity: "credit_balances", Keys: []string{"PatientID"}},
+	"CreditLedger":       {Entity: "credit_ledger", Keys: []string{"PatientID", "EntryID"}},
+	"Vouchers":           {Entity: "vouchers", Keys: []string{"Code"}},
+	"Assets":             {Entity: "assets", Keys: []string{"ID"}},
+	"AssetMaintenance":   {Entity: "asset_maintenance", Keys: []string{"AssetID", "ID"}},
+	"FinancialPeriods":   {Entity: "financial_periods", Keys: []string{"ClinicID", "Month"}},
+}
+
+// Actions recorded in the audit log besides those of the change log
+const (
+	AuditRestored     = "restored"
+	AuditImpersonated = "impersonated"
+	AuditShared       = "shared"
+	AuditUnshared     = "unshared"
+	AuditViewed       = "viewed"
+)
+
+// SystemActor is the actor of writes made outside a request, by background jobs
+const SystemActor = "system"
+
+// Actor is who makes the writes of a request. Impersonator is the operator
+// acting as User for support, with the reason they gave.
+type Actor struct {
+	User         string
+	Role         string
+	IP           string
+	Impersonator string
+	Reason       string
+}
+
+type actorKey struct{}
+
+// WithActor attributes the writes made with ctx to an actor in the audit log
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of ctx, the system actor when there is none
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{User: SystemActor}
+}
+
+// AuditChange is the value of an attribute before and after a write
+type AuditChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// AuditEntry is a write to an audited table. Changes holds the attributes
+// the write changed; a creation lists every attribute, a deletion too.
+// Writes made by an operator impersonating the actor name the operator in
+// ImpersonatedBy.
+type AuditEntry struct {
+	ClinicID   string                 `json:"-"`
+	Seq        string                 `json:"id"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   string                 `json:"entity_id"`
+	Action     string                 `json:"action"`
+	Actor      string                 `json:"actor"`
+	Role       string                 `json:"role,omitempty" dynamodbav:",omitempty"`
+	IP         string                 `json:"ip,omitempty" dynamodbav:",omitempty"`
+	Changes    map[string]AuditChange `json:"changes"`
+	At         string                 `json:"at"`
+
+	ImpersonatedBy      string `json:"impersonated_by,omitempty" dynamodbav:",omitempty"`
+	ImpersonationReason string `json:"impersonation_reason,omitempty" dynamodbav:",omitempty"`
+}
+
+// auditedWrite is a write to an audited table with the item before and after it
+type auditedWrite struct {
+	table  string
+	key    map[string]types.AttributeValue
+	before map[string]types.AttributeValue
+	after  map[string]types.AttributeValue
+}
+
+// auditLog is a DynamoDB client middleware that records the successful writes
+// to the audited tables in the audit log, with the actor of the context. Puts
+// and deletes ask for the previous item; updates and transactions read the
+// item before the write and, unless it is returned, after it. An entry that
+// cannot be recorded is logged; the write itself has already succeeded.
+var auditLog = middleware.InitializeMiddlewareFunc("AuditLog", func(
+	ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	var writes []auditedWrite
+	forcedOld := false
+	switch params := in.Parameters.(type) {
+	case *dynamodb.PutItemInput:
+		if !audited(params.TableName) {
+			return next.HandleInitialize(ctx, in)
+		}
+		if params.ReturnValues != types.ReturnValueAllOld {
+			p := *params
+			p.ReturnValues = types.ReturnValueAllOld
+			in.Parameters = &p
+			forcedOld = true
+		}
+	case *dynamodb.UpdateItemInput:
+		if !audited(params.TableName) {
+			return next.HandleInitialize(ctx, in)
+		}
+		writes = append(writes, auditedWrite{
+			table:  *params.TableName,
+			key:    params.Key,
+			before: auditRead(ctx, *params.TableName, params.Key),
+		})
+	case *dynamodb.DeleteItemInput:
+		if !audited(params.TableName) {
+			return next.HandleInitialize(ctx, in)
+		}
+		if params.ReturnValues != types.ReturnValueAllOld {
+			p := *params
+			p.ReturnValues = types.ReturnValueAllOld
+			in.Parameters = &p
+			forcedOld = true
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		for _, item := range params.TransactItems {
+			var table *string
+			var key map[string]types.AttributeValue
+			switch {
+			case item.Put != nil && audited(item.Put.TableName):
+				table, key = item.Put.TableName, auditKey(*item.Put.TableName, item.Put.Item)
+			case item.Update != nil && audited(item.Update.TableName):
+				table, key = item.Update.TableName, item.Update.Key
+			case item.Delete != nil && audited(item.Delete.TableName):
+				table, key = item.Delete.TableName, item.Delete.Key
+			default:
+				continue
+			}
+			writes = append(writes, auditedWrite{table: *table, key: key, before: auditRead(ctx, *table, key)})
+		}
+		if len(writes) == 0 {
+			return next.HandleInitialize(ctx, in)
+		}
+	default:
+		return next.HandleInitialize(ctx, in)
+	}
+
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if err != nil {
+		return out, metadata, err
+	}
+
+	switch params := in.Parameters.(type) {
+	case *dynamodb.PutItemInput:
+		if result, ok := out.Result.(*dynamodb.PutItemOutput); ok {
+			writes = append(writes, auditedWrite{
+				table:  *params.TableName,
+				key:    auditKey(*params.TableName, params.Item),
+				before: result.Attributes,
+				after:  params.Item,
+			})
+			// The caller did not ask for the previous item
+			if forcedOld {
+				result.Attributes = nil
+			}
+		}
+	case *dynamodb.UpdateItemInput:
+		if result, ok := out.Result.(*dynamodb.UpdateItemOutput); ok {
+			if params.ReturnValues == types.ReturnValueAllNew {
+				writes[0].after = result.Attributes
+			} else {
+				writes[0].after = auditRead(ctx, *params.TableName, params.Key)
+			}
+		}
+	case *dynamodb.DeleteItemInput:
+		if result, ok := out.Result.(*dynamodb.DeleteItemOutput); ok {
+			writes = append(writes, auditedWrite{
+				table:  *params.TableName,
+				key:    params.Key,
+				before: result.Attributes,
+			})
+			if forcedOld {
+				result.Attributes = nil
+			}
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		for i := range writes {
+			writes[i].after = auditRead(ctx, writes[i].table, writes[i].key)
+		}
+	}
+
+	for _, write := range writes {
+		entry, changed := newAuditEntry(ctx, write)
+		if !changed {
+			continue
+		}
+		if err := recordAudit(ctx, entry); err != nil {
+			log.Printf("Error recording %s of %s %s in the audit log: %v", entry.Action, entry.EntityType, entry.EntityID, err)
+		}
+	}
+	return out, metadata, err
+})
+
+func audited(table *string) bool {
+	if table == nil {
+		return false
+	}
+	_, ok := AuditedTables[*table]
+	return ok
+}
+
+// auditKey picks the primary key of a table out of one of its items
+func auditKey(table string, item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := make(map[string]types.AttributeValue, len(AuditedTables[table].Keys))
+	for _, name := range AuditedTables[table].Keys {
+		if v, ok := item[name]; ok {
+			key[name] = v
+		}
+	}
+	return key
+}
+
+// auditRead reads an item as stored, deleted or not, for the audit log. A
+// failed read is logged and audits the write without that side of it.
+func auditRead(ctx context.Context, table string, key map[string]types.AttributeValue) map[string]types.AttributeValue {
+	ctx, cancel := DBContext(WithDeleted(ctx, true))
+	defer cancel()
+
+	result, err := DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		log.Printf("Error reading %s item for the audit log: %v", table, err)
+		return nil
+	}
+	return result.Item
+}
+
+// RecordAuditEvent records an action on a record of a clinic that is not a
+// write to an audited table, such as an operator starting to impersonate a
+// user, with details of it as the values after the action
+func RecordAuditEvent(ctx context.Context, clinicID, entityType, entityID, action string, details map[string]interface{}) error {
+	entry := newEntry(ctx, entityType, action)
+	entry.ClinicID = clinicID
+	entry.EntityID = entityID
+	for name, v := range details {
+		entry.Changes[name] = AuditChange{After: v}
+	}
+	return recordAudit(ctx, entry)
+}
+
+// newEntry starts an audit entry of an action of the actor of ctx
+func newEntry(ctx context.Context, entityType, action string) AuditEntry {
+	now := time.Now().UTC()
+	actor := ActorFrom(ctx)
+	return AuditEntry{
+		ClinicID:            ClinicID(ctx),
+		Seq:                 ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		EntityType:          entityType,
+		Action:              action,
+		Actor:               actor.User,
+		Role:                actor.Role,
+		IP:                  actor.IP,
+		Changes:             make(map[string]AuditChange),
+		At:                  now.Format(time.RFC3339),
+		ImpersonatedBy:      actor.Impersonator,
+		ImpersonationReason: actor.Reason,
+	}
+}
+
+// newAuditEntry builds the entry of a write, reporting false when the write
+// changed nothing. The clinic is taken from the item when known, or else
+// from the context.
+func newAuditEntry(ctx context.Context, write auditedWrite) (AuditEntry, bool) {
+	entry := newEntry(ctx, AuditedTables[write.table].Entity, ChangeUpdated)
+	entry.Changes = auditDiff(write.before, write.after)
+
+	var ids []string
+	for _, name := range AuditedTables[write.table].Keys {
+		switch v := write.key[name].(type) {
+		case *types.AttributeValueMemberS:
+			ids = append(ids, v.Value)
+		case *types.AttributeValueMemberN:
+			ids = append(ids, v.Value)
+		}
+	}
+	entry.EntityID = strings.Join(ids, "/")
+
+	for _, item := range []map[string]types.AttributeValue{write.after, write.before} {
+		if owner, ok := item["ClinicID"].(*types.AttributeValueMemberS); ok && owner.Value != "" {
+			entry.ClinicID = owner.Value
+			break
+		}
+	}
+
+	switch {
+	case write.before == nil && write.after == nil:
+		return entry, false
+	case write.before == nil:
+		entry.Action = ChangeCreated
+	case write.after == nil, !isDeleted(write.before) && isDeleted(write.after):
+		entry.Action = ChangeDeleted
+	case isDeleted(write.before) && !isDeleted(write.after):
+		entry.Action = AuditRestored
+	}
+	return entry, len(entry.Changes) > 0
+}
+
+// auditDiff returns the attributes whose value differs between two items
+func auditDiff(before, after map[string]types.AttributeValue) map[string]AuditChange {
+	var oldValues, newValues map[string]interface{}
+	if err := attributevalue.UnmarshalMap(before, &oldValues); err != nil {
+		log.Printf("Error reading item before a write for the audit log: %v", err)
+	}
+	if err := attributevalue.UnmarshalMap(after, &newValues); err != nil {
+		log.Printf("Error reading item after a write for the audit log: %v", err)
+	}
+
+	changes := make(map[string]AuditChange)
+	for name, v := range oldValues {
+		if w, ok := newValues[name]; !ok || !reflect.DeepEqual(v, w) {
+			changes[name] = AuditChange{Before: v, After: newValues[name]}
+		}
+	}
+	for name, w := range newValues {
+		if _, ok := oldValues[name]; !ok {
+			changes[name] = AuditChange{After: w}
+		}
+	}
+	return changes
+}
+
+// recordAudit writes an entry to the audit log, even when the request that
+// made the write is already done
+func recordAudit(ctx context.Context, entry AuditEntry) error {
+	ctx, cancel := DBContext(context.WithoutCancel(ctx))
+	defer cancel()
+
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return err
+	}
+	_, err = DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(AuditLogTable),
+		Item:      item,
+	})
+	return err
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/uuid"
+)
+
+// ChangeLogTable holds a log of the writes to the synced tables, keyed by
+// ClinicID and Seq, from which offline clients catch up
+const ChangeLogTable = "Changes"
+
+// SyncedTables maps the tables whose writes are logged to the entity type
+// the changes are reported under
+var SyncedTables = map[string]string{
+	"Dentists":     "dentists",
+	"Patients":     "patients",
+	"Procedures":   "procedures",
+	"Appointments": "appointments",
+}
+
+// Actions recorded in the change log
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change is a write to a synced table. Seq orders the changes of a clinic.
+type Change struct {
+	ClinicID string `json:"-"`
+	Seq      string `json:"seq"`
+	Entity   string `json:"entity"`
+	ID       string `json:"id"`
+	Action   string `json:"action"`
+	At       string `json:"at"`
+}
+
+// seqLayout keeps sequence numbers the same width, so they sort as strings
+const seqLayout = "20060102T150405.000000000Z"
+
+// ChangeSeq returns the sequence number a change made at t gets, before any
+// random suffix, so changes up to t sort before it
+func ChangeSeq(t time.Time) string {
+	return t.UTC().Format(seqLayout)
+}
+
+// ValidChangeSeq reports whether seq is a sequence number of the change log
+func ValidChangeSeq(seq string) bool {
+	if len(seq) < len(seqLayout) {
+		return false
+	}
+	_, err := time.Parse(seqLayout, seq[:len(seqLayout)])
+	return err == nil
+}
+
+// changeLog is a DynamoDB client middleware that records the successful
+// writes to the synced tables in the change log. The previous item is
+// requested when the caller did not ask for another return value, to tell
+// creations from updates and to find the clinic of writes made outside a
+// clinic scope. A change that cannot be recorded is logged; the write
+// itself has already succeeded.
+var changeLog = middleware.InitializeMiddlewareFunc("ChangeLog", func(
+	ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	var table *string
+	returnsOld := false
+	switch params := in.Parameters.(type) {
+	case *dynamodb.PutItemInput:
+		table = params.TableName
+		if synced(table) && (noReturnValues(params.ReturnValues) || params.ReturnValues == types.ReturnValueAllOld) {
+			p := *params
+			p.ReturnValues = types.ReturnValueAllOld
+			in.Parameters = &p
+			returnsOld = true
+		}
+	case *dynamodb.UpdateItemInput:
+		table = params.TableName
+		if synced(table) && (noReturnValues(params.ReturnValues) || params.ReturnValues == types.ReturnValueAllOld) {
+			p := *params
+			p.ReturnValues = types.ReturnValueAllOld
+			in.Parameters = &p
+			returnsOld = true
+		}
+	case *dynamodb.DeleteItemInput:
+		table = params.TableName
+		if synced(table) && (noReturnValues(params.ReturnValues) || params.ReturnValues == types.ReturnValueAllOld) {
+			p := *params
+			p.ReturnValues = types.ReturnValueAllOld
+			in.Parameters = &p
+			returnsOld = true
+		}
+	case *dynamodb.TransactWriteItemsInput:
+	default:
+		return next.HandleInitialize(ctx, in)
+	}
+
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if err != nil {
+		return out, metadata, err
+	}
+
+	var changes []Change
+	switch params := in.Parameters.(type) {
+	case *dynamodb.PutItemInput:
+		if result, ok := out.Result.(*dynamodb.PutItemOutput); ok && synced(table) {
+			action := ChangeUpdated
+			if returnsOld && result.Attributes == nil {
+				action = ChangeCreated
+			}
+			if isDeleted(params.Item) {
+				action = ChangeDeleted
+			}
+			changes = append(changes, newChange(ctx, *table, params.Item, params.Item, action))
+		}
+	case *dynamodb.UpdateItemInput:
+		if result, ok := out.Result.(*dynamodb.UpdateItemOutput); ok && synced(table) {
+			action := ChangeUpdated
+			if returnsOld && result.Attributes == nil {
+				action = ChangeCreated
+			}
+			// Soft deletes return the item as written
+			if params.ReturnValues == types.ReturnValueAllNew && isDeleted(result.Attributes) {
+				action = ChangeDeleted
+			}
+			changes = append(changes, newChange(ctx, *table, params.Key, result.Attributes, action))
+		}
+	case *dynamodb.DeleteItemInput:
+		if result, ok := out.Result.(*dynamodb.DeleteItemOutput); ok && synced(table) {
+			// Deleting an item that does not exist changes nothing
+			if !returnsOld || result.Attributes != nil {
+				changes = append(changes, newChange(ctx, *table, params.Key, result.Attributes, ChangeDeleted))
+			}
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		for _, item := range params.TransactItems {
+			switch {
+			case item.Put != nil && synced(item.Put.TableName):
+				// Without the previous item, a put that requires the item
+				// not to exist is the only one known to create it
+				action := ChangeUpdated
+				if item.Put.ConditionExpression != nil && strings.Contains(*item.Put.ConditionExpression, "attribute_not_exists(") {
+					action = ChangeCreated
+				}
+				changes = append(changes, newChange(ctx, *item.Put.TableName, item.Put.Item, item.Put.Item, action))
+			case item.Update != nil && synced(item.Update.TableName):
+				changes = append(changes, newChange(ctx, *item.Update.TableName, item.Update.Key, nil, ChangeUpdated))
+			case item.Delete != nil && synced(item.Delete.TableName):
+				changes = append(changes, newChange(ctx, *item.Delete.TableName, item.Delete.Key, nil, ChangeDeleted))
+			}
+		}
+	}
+	for _, change := range changes {
+		if err := recordChange(ctx, change); err != nil {
+			log.Printf("Error recording %s of %s %s in the change log: %v", change.Action, change.Entity, change.ID, err)
+		}
+	}
+	return out, metadata, err
+})
+
+func synced(table *string) bool {
+	if table == nil {
+		return false
+	}
+	_, ok := SyncedTables[*table]
+	return ok
+}
+
+func noReturnValues(v types.ReturnValue) bool {
+	return v == "" || v == types.ReturnValueNone
+}
+
+// newChange builds the change of the item with the given key; the clinic is
+// taken from the item when known, or else from the context
+func newChange(ctx context.Context, table string, key, item map[string]types.AttributeValue, action string) Change {
+	now := time.Now().UTC()
+	change := Change{
+		ClinicID: ClinicID(ctx),
+		Seq:      ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		Entity:   SyncedTables[table],
+		Action:   action,
+		At:       now.Format(time.RFC3339),
+	}
+	if id, ok := key["ID"].(*types.AttributeValueMemberS); ok {
+		change.ID = id.Value
+	}
+	if owner, ok := item["ClinicID"].(*types.AttributeValueMemberS); ok && owner.Value != "" {
+		change.ClinicID = owner.Value
+	}
+	return change
+}
+
+// recordChange writes a change to the log, even when the request that made
+// it is already done
+func recordChange(ctx context.Context, change Change) error {
+	ctx, cancel := DBContext(context.WithoutCancel(ctx))
+	defer cancel()
+
+	_, err := DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ChangeLogTable),
+		Item: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: change.ClinicID},
+			"Seq":      &types.AttributeValueMemberS{Value: change.Seq},
+			"Entity":   &types.AttributeValueMemberS{Value: change.Entity},
+			"ID":       &types.AttributeValueMemberS{Value: change.ID},
+			"Action":   &types.AttributeValueMemberS{Value: change.Action},
+			"At":       &types.AttributeValueMemberS{Value: change.At},
+		},
+	})
+	return err
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+type consistentReadKey struct{}
+
+// WithConsistentRead marks ctx so reads made with it are strongly consistent
+func WithConsistentRead(ctx context.Context, consistent bool) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, consistent)
+}
+
+// ConsistentRead returns the ConsistentRead setting for a read made with ctx:
+// true when the request asked for it, nil (eventually consistent) otherwise.
+// Queries on global secondary indexes must not use it; they are always
+// eventually consistent.
+func ConsistentRead(ctx context.Context) *bool {
+	if consistent, _ := ctx.Value(consistentReadKey{}).(bool); consistent {
+		return aws.Bool(true)
+	}
+	return nil
+}
+
+// ConsistentReads reads the ?consistent= query parameter into the request
+// context. Strongly consistent reads cost twice the read capacity, so they
+// are opt-in for reads that must see a write made just before, e.g. fetching
+// an appointment right after booking it.
+func ConsistentReads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("consistent")
+		if v == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		consistent, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "consistent must be true or false", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithConsistentRead(r.Context(), consistent)))
+	})
+}
@@ -2,39 +2,70 @@ package config
 
 import (
 	"context"
+	"dental-saas/shared/chaos"
 	"log"
-	"os"
+	"net"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
 )
 
-var DBClient *dynamodb.Client
+// DBClient is the DynamoDB client of every repository. It routes the calls
+// of clinics pinned to another region to that region's tables.
+var DBClient *RegionalClient
+
+// schemaClient is the client the tables are created with; InitDynamoDB
+// points it to each region in turn
+var schemaClient *dynamodb.Client
+
+// indexCreationTimeout bounds the wait for a table to be active before one of
+// its indexes is added
+const indexCreationTimeout = 2 * time.Minute
 
 func InitDynamoDB() {
-	dynamodbEndpoint := "http://localhost:8000"
-	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
-		dynamodbEndpoint = endpoint
-	}
+	DynamoDB = LoadDynamoDBSettings()
+	dynamodbEndpoint := DynamoDB.Endpoint
+	endpoints := regionEndpoints()
 
 	customResolver := aws.EndpointResolverWithOptionsFunc(
 		func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-			if service == dynamodb.ServiceID && region == "us-west-2" {
+			if service == dynamodb.ServiceID && region == HomeRegion {
 				return aws.Endpoint{
 					URL:           dynamodbEndpoint,
-					SigningRegion: "us-west-2",
+					SigningRegion: HomeRegion,
 				}, nil
 			}
+			if url, ok := endpoints[region]; ok && service == dynamodb.ServiceID {
+				return aws.Endpoint{URL: url, SigningRegion: region}, nil
+			}
 			return aws.Endpoint{}, &aws.EndpointNotFoundError{}
 		},
 	)
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion("us-west-2"),
+	// A single pooled HTTP client is shared by every request to DynamoDB
+	httpClient := awshttp.NewBuildableClient().
+		WithTimeout(DynamoDB.HTTPTimeout).
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = DynamoDB.DialTimeout
+		}).
+		WithTransportOptions(func(t *http.Transport) {
+			t.MaxConnsPerHost = DynamoDB.MaxConnsPerHost
+			t.MaxIdleConnsPerHost = DynamoDB.MaxIdleConnsPerHost
+			t.IdleConnTimeout = DynamoDB.IdleConnTimeout
+		})
+
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(HomeRegion),
 		config.WithEndpointResolverWithOptions(customResolver),
+		config.WithHTTPClient(chaos.WrapHTTPClient(httpClient)),
+		config.WithRetryMaxAttempts(DynamoDB.MaxRetries),
 		config.WithCredentialsProvider(credentials.StaticCredentialsProvider{
 			Value: aws.Credentials{
 				AccessKeyID:     "dummy",
@@ -47,20 +78,149 @@ func InitDynamoDB() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	DBClient = dynamodb.NewFromConfig(cfg)
+	clientOptions := func(o *dynamodb.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(clinicScope, middleware.Before)
+		})
+		// Runs before clinicScope, which rewrites the conditions it reads
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(versioning, middleware.Before)
+		})
+		// Runs after clinicScope, so the items it sees carry their clinic
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(changeLog, middleware.After)
+		})
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(softDelete, middleware.After)
+		})
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(auditLog, middleware.After)
+		})
+	}
+	DBClient = &RegionalClient{
+		Client:   dynamodb.NewFromConfig(cfg, clientOptions),
+		regional: map[string]*dynamodb.Client{},
+	}
 	log.Println("DynamoDB Local connected")
 
 	// Initialize tables for all modules
+	schemaClient = DBClient.Client
+	ensureTablesExist()
+
+	// Clinics pinned to another region keep their tables there
+	for _, region := range DataRegions() {
+		client := dynamodb.NewFromConfig(cfg, clientOptions, func(o *dynamodb.Options) {
+			o.Region = region
+		})
+		DBClient.regional[region] = client
+		log.Printf("Creating tables in data residency region %s", region)
+		schemaClient = client
+		ensureTablesExist()
+	}
+	schemaClient = DBClient.Client
+}
+
+// ensureTablesExist creates the tables of every module with schemaClient
+func ensureTablesExist() {
 	ensureDentalTablesExist()
 	ensureFinancialTablesExist()
+	ensureStaffTablesExist()
+	ensureComplianceTablesExist()
+	ensureSharedTablesExist()
 }
 
+// Global secondary indexes of the dental tables, queried for the records of
+// a patient or dentist instead of scanning the whole table
+const (
+	DentistsByCROIndex         = "CRO-index"
+	PatientsByEmailIndex       = "Email-index"
+	AppointmentsByPatientIndex = "PatientID-index"
+	AppointmentsByDentistIndex = "DentistID-index"
+
+	// AppointmentsByDentistTimeIndex sorts each dentist's appointments by
+	// DateTime, for the appointments of a date range
+	AppointmentsByDentistTimeIndex = "DentistID-DateTime-index"
+)
+
 // ensureDentalTablesExist creates tables for the dental module
 func ensureDentalTablesExist() {
 	ensureDentistTableExists()
+	ensureIndexesExist("Dentists",
+		tableIndex{Name: DentistsByCROIndex, Key: tableKey{Name: "CRO", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash}},
+	)
 	ensurePatientTableExists()
+	ensureIndexesExist("Patients",
+		tableIndex{Name: PatientsByEmailIndex, Key: tableKey{Name: "Email", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash}},
+	)
 	ensureProcedureTableExists()
 	ensureAppointmentTableExists()
+	ensureIndexesExist("Appointments",
+		tableIndex{Name: AppointmentsByPatientIndex, Key: tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash}},
+		tableIndex{Name: AppointmentsByDentistIndex, Key: tableKey{Name: "DentistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash}},
+		tableIndex{
+			Name:  AppointmentsByDentistTimeIndex,
+			Key:   tableKey{Name: "DentistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+			Range: &tableKey{Name: "DateTime", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+		},
+	)
+	ensureTableExists("DentistPrices",
+		tableKey{Name: "DentistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ProcedureID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Bundles")
+	ensureTableExists("ProcedurePrices",
+		tableKey{Name: "ProcedureID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "EffectiveFrom", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("PriceAdjustments")
+	ensureTableExists("Tasks")
+	ensureTableExists("TreatmentPlans")
+	ensureTableExists("PreAuths")
+	ensureTableExists("Medications")
+	ensureTableExists("Prescriptions")
+	ensureTableExists("AnamnesisTemplates")
+	ensureTableExists("Rooms")
+	ensureTableExists("Waitlist")
+	ensureTableExists("Anamneses",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Version", Type: types.ScalarAttributeTypeN, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Consents",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ProcedureID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("ClinicalNotes",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Attachments",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("ClinicalPhotos",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Odontograms",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("OdontogramSnapshots",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Version", Type: types.ScalarAttributeTypeN, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Surveys",
+		tableKey{Name: "AppointmentID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("ProcedureOutcomes",
+		tableKey{Name: "AppointmentID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("Unavailability")
+	ensureTableExists("DentistSchedules",
+		tableKey{Name: "DentistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("CalendarSyncs",
+		tableKey{Name: "DentistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
 }
 
 // ensureFinancialTablesExist creates tables for the financial module
@@ -68,16 +228,39 @@ func ensureFinancialTablesExist() {
 	ensureExpenseTableExists()
 	ensureRevenueTableExists()
 	ensureInvoiceTableExists()
+	ensureTableExists("CreditBalances",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("CreditLedger",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "EntryID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Vouchers",
+		tableKey{Name: "Code", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("Assets")
+	ensureTableExists("AssetMaintenance",
+		tableKey{Name: "AssetID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("FinancialPeriods",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Month", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
 }
 
 func ensureDentistTableExists() {
 	tableName := "Dentists"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -104,12 +287,16 @@ func ensureDentistTableExists() {
 
 func ensurePatientTableExists() {
 	tableName := "Patients"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -136,12 +323,16 @@ func ensurePatientTableExists() {
 
 func ensureProcedureTableExists() {
 	tableName := "Procedures"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -168,12 +359,16 @@ func ensureProcedureTableExists() {
 
 func ensureAppointmentTableExists() {
 	tableName := "Appointments"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -200,12 +395,16 @@ func ensureAppointmentTableExists() {
 
 func ensureExpenseTableExists() {
 	tableName := "Expenses"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -232,12 +431,16 @@ func ensureExpenseTableExists() {
 
 func ensureRevenueTableExists() {
 	tableName := "Revenues"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -264,12 +467,16 @@ func ensureRevenueTableExists() {
 
 func ensureInvoiceTableExists() {
 	tableName := "Invoices"
-	_, err := DBClient.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	})
 	if err != nil {
 		log.Printf("Table %s does not exist, creating...", tableName)
-		_, err = DBClient.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		_, err = schemaClient.CreateTable(ctx, &dynamodb.CreateTableInput{
 			TableName: aws.String(tableName),
 			KeySchema: []types.KeySchemaElement{
 				{
@@ -292,4 +499,222 @@ func ensureInvoiceTableExists() {
 	} else {
 		log.Printf("Table %s already exists", tableName)
 	}
-}
\ No newline at end of file
+}
+
+// ensureStaffTablesExist creates tables for the staff module
+func ensureStaffTablesExist() {
+	ensureTableExists("Staff")
+	ensureTableExists("Shifts")
+	ensureTableExists("Absences")
+	ensureTableExists("PayrollRuns",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Month", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+}
+
+// ensureComplianceTablesExist creates tables for the compliance module
+func ensureComplianceTablesExist() {
+	ensureTableExists("Credentials")
+	ensureTableExists("LegalHolds")
+	ensureTableExists("Checklists")
+	ensureTableExists("ChecklistRuns",
+		tableKey{Name: "Date", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ChecklistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+}
+
+// ensureSharedTablesExist creates tables used across modules
+func ensureSharedTablesExist() {
+	ensureTableExists("Counters",
+		tableKey{Name: "Name", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Shard", Type: types.ScalarAttributeTypeN, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Notifications",
+		tableKey{Name: "Recipient", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("NotificationDeadLetters")
+	ensureTableExists("NotificationOutbox",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("NotificationTemplates",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "TemplateKey", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("SandboxNotifications",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("RetentionPolicies",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("NetworkPolicies",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists(ChangeLogTable,
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Seq", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists(AuditLogTable,
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "Seq", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("Clinics")
+	ensureTableExists("Organizations")
+	ensureTableExists("PatientShares",
+		tableKey{Name: "PatientID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "TargetClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("DentistIdentities")
+	ensureTableExists("DentistLinks",
+		tableKey{Name: "DentistID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("Letterheads",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("ReminderSettings",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("BenchmarkSettings",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("ReminderLog",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("WebhookSubscriptions",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("WebhookDeliveries",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeRange},
+	)
+	ensureTableExists("OIDCSettings",
+		tableKey{Name: "ClinicID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("Users",
+		tableKey{Name: "Email", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+	ensureTableExists("ProvisioningClients",
+		tableKey{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash},
+	)
+}
+
+// tableKey describes one attribute of a table's primary key
+type tableKey struct {
+	Name    string
+	Type    types.ScalarAttributeType
+	KeyType types.KeyType
+}
+
+// ensureTableExists creates an on-demand table with the given primary key,
+// defaulting to a string "ID" hash key when no keys are provided. The table
+// must be classified in ClinicScopedTables or UnscopedTables.
+func ensureTableExists(tableName string, keys ...tableKey) {
+	mustBeClassified(tableName)
+	ctx, cancel := DBContext(context.Background())
+	defer cancel()
+
+	if len(keys) == 0 {
+		keys = []tableKey{{Name: "ID", Type: types.ScalarAttributeTypeS, KeyType: types.KeyTypeHash}}
+	}
+
+	_, err := schemaClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err == nil {
+		log.Printf("Table %s already exists", tableName)
+		return
+	}
+
+	log.Printf("Table %s does not exist, creating...", tableName)
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(tableName),
+		BillingMode: types.BillingModePayPerRequest,
+	}
+	for _, key := range keys {
+		input.KeySchema = append(input.KeySchema, types.KeySchemaElement{
+			AttributeName: aws.String(key.Name),
+			KeyType:       key.KeyType,
+		})
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String(key.Name),
+			AttributeType: key.Type,
+		})
+	}
+
+	if _, err = schemaClient.CreateTable(ctx, input); err != nil {
+		log.Fatalf("Failed to create table %s: %v", tableName, err)
+	}
+	log.Printf("Table %s created successfully", tableName)
+}
+
+// tableIndex describes a global secondary index projecting every attribute,
+// with an optional sort key
+type tableIndex struct {
+	Name  string
+	Key   tableKey
+	Range *tableKey
+}
+
+// ensureIndexesExist adds the global secondary indexes a table is missing,
+// so tables created before an index was introduced get it too. DynamoDB
+// creates one index per update, waiting for the table to be active.
+func ensureIndexesExist(tableName string, indexes ...tableIndex) {
+	ctx, cancel := context.WithTimeout(context.Background(), indexCreationTimeout)
+	defer cancel()
+
+	waiter := dynamodb.NewTableExistsWaiter(schemaClient)
+	for _, index := range indexes {
+		table, err := waiter.WaitForOutput(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		}, indexCreationTimeout)
+		if err != nil {
+			log.Fatalf("Failed to describe table %s: %v", tableName, err)
+		}
+		exists := false
+		for _, gsi := range table.Table.GlobalSecondaryIndexes {
+			if aws.ToString(gsi.IndexName) == index.Name {
+				exists = true
+			}
+		}
+		if exists {
+			continue
+		}
+
+		log.Printf("Index %s of table %s does not exist, creating...", index.Name, tableName)
+		keys := []tableKey{index.Key}
+		if index.Range != nil {
+			keys = append(keys, *index.Range)
+		}
+		var definitions []types.AttributeDefinition
+		var schema []types.KeySchemaElement
+		for _, key := range keys {
+			definitions = append(definitions, types.AttributeDefinition{
+				AttributeName: aws.String(key.Name),
+				AttributeType: key.Type,
+			})
+			schema = append(schema, types.KeySchemaElement{
+				AttributeName: aws.String(key.Name),
+				KeyType:       key.KeyType,
+			})
+		}
+		_, err = schemaClient.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:            aws.String(tableName),
+			AttributeDefinitions: definitions,
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  aws.String(index.Name),
+					KeySchema:  schema,
+					Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+				},
+			}},
+		})
+		if err != nil {
+			log.Fatalf("Failed to create index %s of table %s: %v", index.Name, tableName, err)
+		}
+		log.Printf("Index %s of table %s created", index.Name, tableName)
+	}
+}
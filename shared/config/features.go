@@ -0,0 +1,36 @@
+package config
+
+import "sort"
+
+// featureDefaults lists the environment switches that turn features on or
+// off, with their state when unset. Code reads them through Feature so the
+// admin UI can show every switch and whether it is on.
+var featureDefaults = map[string]bool{
+	"APPOINTMENT_EMAILS":             true,
+	"AUTO_REVENUE_FROM_APPOINTMENTS": false,
+	"CALDAV_ALLOW_PRIVATE_NETWORKS":  false,
+	"WEBHOOK_ALLOW_HTTP":             false,
+	"WEBHOOK_ALLOW_PRIVATE_NETWORKS": false,
+}
+
+// FeatureFlag is the state of a feature switch
+type FeatureFlag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Default bool   `json:"default"`
+}
+
+// Feature reports whether the feature switch name is on
+func Feature(name string) bool {
+	return EnvBool(name, featureDefaults[name])
+}
+
+// Features returns the state of every feature switch, sorted by name
+func Features() []FeatureFlag {
+	flags := make([]FeatureFlag, 0, len(featureDefaults))
+	for name, fallback := range featureDefaults {
+		flags = append(flags, FeatureFlag{Name: name, Enabled: Feature(name), Default: fallback})
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// HomeRegion is the region of the tables of clinics not pinned to another one
+const HomeRegion = "us-west-2"
+
+// HomeRegionTables are kept in the home region whatever the clinic of the
+// call: they hold the records shared by the clinics of the deployment, or
+// are read before the clinic of a request is known, such as its users and
+// sign-in settings. Every other table is kept in the region of the clinic.
+var HomeRegionTables = map[string]bool{
+	"Clinics":             true,
+	"Organizations":       true,
+	"PatientShares":       true,
+	"DentistIdentities":   true,
+	"DentistLinks":        true,
+	"Users":               true,
+	"OIDCSettings":        true,
+	"ProvisioningClients": true,
+}
+
+// ClinicRegion returns the region a clinic's data is pinned to, "" for the
+// home region. It is set by the clinics package, which stores the regions.
+var ClinicRegion func(ctx context.Context, clinicID string) (string, error)
+
+// DataRegions returns the regions besides the home one that clinics can be
+// pinned to, listed in DATA_RESIDENCY_REGIONS
+func DataRegions() []string {
+	var regions []string
+	for _, region := range strings.Split(os.Getenv("DATA_RESIDENCY_REGIONS"), ",") {
+		if region = strings.TrimSpace(region); region != "" && region != HomeRegion {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// ValidRegion checks a clinic can be pinned to region
+func ValidRegion(region string) error {
+	if region == "" || region == HomeRegion {
+		return nil
+	}
+	for _, r := range DataRegions() {
+		if r == region {
+			return nil
+		}
+	}
+	return fmt.Errorf("region %s is not enabled for data residency", region)
+}
+
+type regionKey struct{}
+
+// InRegion sends the calls of ctx made without a clinic to the tables of
+// region instead of the home region's
+func InRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionKey{}, region)
+}
+
+// EachRegion runs fn once per region holding clinic data, the home region
+// first, with ctx lifted from any clinic and sent to that region's tables.
+// It serves the queues that scan the records of every clinic at once, such
+// as the notification outbox; a region that fails does not stop the others.
+func EachRegion(ctx context.Context, fn func(ctx context.Context) error) error {
+	var errs []error
+	for _, region := range append([]string{HomeRegion}, DataRegions()...) {
+		if err := fn(InRegion(AllClinics(ctx), region)); err != nil {
+			errs = append(errs, fmt.Errorf("region %s: %v", region, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// regionEndpoints reads DYNAMODB_REGION_ENDPOINTS, "region=url" pairs
+// separated by commas that point a region to a DynamoDB other than AWS's,
+// such as a second DynamoDB Local in development
+func regionEndpoints() map[string]string {
+	endpoints := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("DYNAMODB_REGION_ENDPOINTS"), ",") {
+		region, url, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && region != "" && url != "" {
+			endpoints[strings.TrimSpace(region)] = strings.TrimSpace(url)
+		}
+	}
+	return endpoints
+}
+
+// RegionalClient is the DynamoDB client of the home region that sends the
+// item calls of a clinic pinned to another region to that region's tables.
+// The region is picked from the clinic of the call's context, so the
+// repositories keep calling a single client; calls on HomeRegionTables stay
+// in the home region, and calls without a clinic go to the region set by
+// InRegion, the home region by default.
+type RegionalClient struct {
+	*dynamodb.Client
+	regional map[string]*dynamodb.Client
+}
+
+// clientFor returns the client of the region holding table for the clinic
+// of ctx. A clinic whose region cannot be looked up fails the call rather
+// than having its data read or written in the wrong region.
+func (c *RegionalClient) clientFor(ctx context.Context, table *string) (*dynamodb.Client, error) {
+	if len(c.regional) == 0 || ClinicRegion == nil {
+		return c.Client, nil
+	}
+	if table != nil && HomeRegionTables[*table] {
+		return c.Client, nil
+	}
+	clinicID, ok := scopedClinic(ctx)
+	if !ok {
+		region, _ := ctx.Value(regionKey{}).(string)
+		return c.region(region)
+	}
+	if clinicID == DefaultClinicID {
+		return c.Client, nil
+	}
+	region, err := ClinicRegion(ctx, clinicID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up the region of clinic %s: %v", clinicID, err)
+	}
+	client, err := c.region(region)
+	if err != nil {
+		return nil, fmt.Errorf("clinic %s is pinned to region %s, which is not enabled", clinicID, region)
+	}
+	return client, nil
+}
+
+// region returns the client of a region, the home one for ""
+func (c *RegionalClient) region(region string) (*dynamodb.Client, error) {
+	if region == "" || region == HomeRegion {
+		return c.Client, nil
+	}
+	client, ok := c.regional[region]
+	if !ok {
+		return nil, fmt.Errorf("region %s is not enabled", region)
+	}
+	return client, nil
+}
+
+// GetItem reads an item from the region of the clinic
+func (c *RegionalClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	client, err := c.clientFor(ctx, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetItem(ctx, params, optFns...)
+}
+
+// PutItem writes an item to the region of the clinic
+func (c *RegionalClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	client, err := c.clientFor(ctx, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return client.PutItem(ctx, params, optFns...)
+}
+
+// UpdateItem updates an item in the region of the clinic
+func (c *RegionalClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	client, err := c.clientFor(ctx, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return client.UpdateItem(ctx, params, optFns...)
+}
+
+// DeleteItem deletes an item from the region of the clinic
+func (c *RegionalClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	client, err := c.clientFor(ctx, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return client.DeleteItem(ctx, params, optFns...)
+}
+
+// Query queries the table in the region of the clinic
+func (c *RegionalClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	client, err := c.clientFor(ctx, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return client.Query(ctx, params, optFns...)
+}
+
+// Scan scans the table in the region of the clinic
+func (c *RegionalClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	client, err := c.clientFor(ctx, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return client.Scan(ctx, params, optFns...)
+}
+
+// BatchGetItem reads items from the region of the clinic. Batches and
+// transactions are routed by the first table they touch, as they only span
+// tables of one region.
+func (c *RegionalClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	var table *string
+	for name := range params.RequestItems {
+		table = &name
+		break
+	}
+	client, err := c.clientFor(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return client.BatchGetItem(ctx, params, optFns...)
+}
+
+// BatchWriteItem writes items to the region of the clinic
+func (c *RegionalClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	var table *string
+	for name := range params.RequestItems {
+		table = &name
+		break
+	}
+	client, err := c.clientFor(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return client.BatchWriteItem(ctx, params, optFns...)
+}
+
+// TransactWriteItems runs a write transaction in the region of the clinic
+func (c *RegionalClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	var table *string
+	if len(params.TransactItems) > 0 {
+		table = transactTable(params.TransactItems[0])
+	}
+	client, err := c.clientFor(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return client.TransactWriteItems(ctx, params, optFns...)
+}
+
+// TransactGetItems runs a read transaction in the region of the clinic
+func (c *RegionalClient) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	var table *string
+	if len(params.TransactItems) > 0 && params.TransactItems[0].Get != nil {
+		table = params.TransactItems[0].Get.TableName
+	}
+	client, err := c.clientFor(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return client.TransactGetItems(ctx, params, optFns...)
+}
+
+// transactTable returns the table a transaction item acts on
+func transactTable(item types.TransactWriteItem) *string {
+	switch {
+	case item.Put != nil:
+		return item.Put.TableName
+	case item.Update != nil:
+		return item.Update.TableName
+	case item.Delete != nil:
+		return item.Delete.TableName
+	case item.ConditionCheck != nil:
+		return item.ConditionCheck.TableName
+	}
+	return nil
+}
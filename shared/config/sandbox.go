@@ -0,0 +1,24 @@
+package config
+
+import "context"
+
+// ClinicSandbox reports whether a clinic is a sandbox, whose outbound side
+// effects are stubbed. It is set by the clinics package, which stores the flag.
+var ClinicSandbox func(ctx context.Context, clinicID string) (bool, error)
+
+// Sandbox reports whether the clinic of ctx is a sandbox. Code sending
+// anything out of the deployment on a clinic's behalf (notifications,
+// payment charges, fiscal documents) checks it and records what it would
+// have sent instead.
+func Sandbox(ctx context.Context) (bool, error) {
+	return SandboxClinic(ctx, ClinicID(ctx))
+}
+
+// SandboxClinic reports whether a clinic is a sandbox; the default clinic
+// never is
+func SandboxClinic(ctx context.Context, clinicID string) (bool, error) {
+	if ClinicSandbox == nil || clinicID == "" || clinicID == DefaultClinicID {
+		return false, nil
+	}
+	return ClinicSandbox(ctx, clinicID)
+}
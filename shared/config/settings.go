@@ -0,0 +1,127 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultClinicID scopes per-clinic data until clinics exist as tenants
+const DefaultClinicID = "default"
+
+// DynamoDBSettings holds the connection, pooling and timeout settings of the DynamoDB client
+type DynamoDBSettings struct {
+	Endpoint            string
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	HTTPTimeout         time.Duration
+	OperationTimeout    time.Duration
+	MaxRetries          int
+}
+
+// DynamoDB holds the settings the client was created with
+var DynamoDB DynamoDBSettings
+
+// LoadDynamoDBSettings reads the DynamoDB settings from the environment, falling back to defaults
+func LoadDynamoDBSettings() DynamoDBSettings {
+	return DynamoDBSettings{
+		Endpoint:            EnvString("DYNAMODB_ENDPOINT", "http://localhost:8000"),
+		MaxConnsPerHost:     EnvInt("DYNAMODB_MAX_CONNS_PER_HOST", 100),
+		MaxIdleConnsPerHost: EnvInt("DYNAMODB_MAX_IDLE_CONNS_PER_HOST", 50),
+		IdleConnTimeout:     EnvDuration("DYNAMODB_IDLE_CONN_TIMEOUT", 90*time.Second),
+		DialTimeout:         EnvDuration("DYNAMODB_DIAL_TIMEOUT", 3*time.Second),
+		HTTPTimeout:         EnvDuration("DYNAMODB_HTTP_TIMEOUT", 10*time.Second),
+		OperationTimeout:    EnvDuration("DYNAMODB_OPERATION_TIMEOUT", 5*time.Second),
+		MaxRetries:          EnvInt("DYNAMODB_MAX_RETRIES", 3),
+	}
+}
+
+// DBContext derives a context bounded by the configured per-operation timeout
+func DBContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if DynamoDB.OperationTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, DynamoDB.OperationTimeout)
+}
+
+// EnvString reads a string environment variable with a fallback
+func EnvString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// EnvInt reads an integer environment variable, logging and falling back on invalid values
+func EnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using %d", v, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// EnvBool reads a boolean environment variable ("true", "false", "1", "0"...),
+// logging and falling back on invalid values
+func EnvBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using %t", v, key, fallback)
+		return fallback
+	}
+	return b
+}
+
+// EnvDuration reads a duration environment variable (e.g. "30s"), logging and falling back on invalid values
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using %s", v, key, fallback)
+		return fallback
+	}
+	return d
+}
+
+// EnvSecret returns a function reading the signing key in the environment
+// variable key on first use. Without it a random key is used, so whatever
+// was signed with it (what, for the log) stops working on restart and
+// instances behind a load balancer do not accept each other's.
+func EnvSecret(key, what string) func() []byte {
+	var (
+		once   sync.Once
+		secret []byte
+	)
+	return func() []byte {
+		once.Do(func() {
+			if s := EnvString(key, ""); s != "" {
+				secret = []byte(s)
+				return
+			}
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				log.Fatalf("Failed to generate a key for %s: %v", key, err)
+			}
+			log.Printf("%s is not set, %s will stop working on restart", key, what)
+		})
+		return secret
+	}
+}
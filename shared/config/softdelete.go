@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// SoftDeletedTables lists the tables whose records are soft deleted: deleting
+// one sets its DeletedAt, and reads skip it until it is restored
+var SoftDeletedTables = map[string]bool{
+	"Dentists":     true,
+	"Patients":     true,
+	"Procedures":   true,
+	"Appointments": true,
+}
+
+type includeDeletedKey struct{}
+
+// WithDeleted marks ctx so reads made with it also return soft-deleted records
+func WithDeleted(ctx context.Context, include bool) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, include)
+}
+
+// IncludesDeleted reports whether reads made with ctx return soft-deleted records
+func IncludesDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return include
+}
+
+// IncludeDeleted reads the ?include_deleted= query parameter of GET requests
+// into the request context, so lists and lookups also return soft-deleted
+// records. Other requests ignore it: changes never apply to deleted records.
+func IncludeDeleted(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("include_deleted")
+		if v == "" || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "include_deleted must be true or false", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithDeleted(r.Context(), include)))
+	})
+}
+
+// SoftDelete marks a record as deleted and returns it. A record that does not
+// exist or is already deleted fails with ConditionalCheckFailedException.
+func SoftDelete(ctx context.Context, table, id string) (map[string]types.AttributeValue, error) {
+	return setDeleted(ctx, table, id, true)
+}
+
+// Restore clears the deletion mark of a record and returns it. A record that
+// does not exist or is not deleted fails with ConditionalCheckFailedException.
+func Restore(ctx context.Context, table, id string) (map[string]types.AttributeValue, error) {
+	return setDeleted(ctx, table, id, false)
+}
+
+// setDeleted sets or clears DeletedAt. The record is returned as written, which
+// also tells the change log whether it was deleted.
+func setDeleted(ctx context.Context, table, id string, deleted bool) (map[string]types.AttributeValue, error) {
+	ctx, cancel := DBContext(ctx)
+	defer cancel()
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:         aws.String("REMOVE #deleted"),
+		ConditionExpression:      aws.String("attribute_exists(ID) AND attribute_exists(#deleted)"),
+		ExpressionAttributeNames: map[string]string{"#deleted": "DeletedAt"},
+		ReturnValues:             types.ReturnValueAllNew,
+	}
+	if deleted {
+		input.UpdateExpression = aws.String("SET #deleted = :now")
+		input.ConditionExpression = aws.String("attribute_exists(ID) AND attribute_not_exists(#deleted)")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		}
+	}
+	result, err := DBClient.UpdateItem(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return result.Attributes, nil
+}
+
+// softDelete is a DynamoDB client middleware that hides soft-deleted records
+// from every read of the soft deleted tables, unless the context includes
+// them: items are dropped from gets and filtered out of scans and queries.
+var softDelete = middleware.InitializeMiddlewareFunc("SoftDelete", func(
+	ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if IncludesDeleted(ctx) {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	switch params := in.Parameters.(type) {
+	case *dynamodb.GetItemInput:
+		if softDeleted(params.TableName) && params.ProjectionExpression != nil {
+			p := *params
+			p.ProjectionExpression, p.ExpressionAttributeNames = projectDeleted(p.ProjectionExpression, p.ExpressionAttributeNames)
+			in.Parameters = &p
+		}
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if result, ok := out.Result.(*dynamodb.GetItemOutput); ok && softDeleted(params.TableName) && isDeleted(result.Item) {
+			result.Item = nil
+		}
+		return out, metadata, err
+	case *dynamodb.BatchGetItemInput:
+		p := *params
+		p.RequestItems = make(map[string]types.KeysAndAttributes, len(params.RequestItems))
+		for table, keys := range params.RequestItems {
+			if SoftDeletedTables[table] && keys.ProjectionExpression != nil {
+				keys.ProjectionExpression, keys.ExpressionAttributeNames = projectDeleted(keys.ProjectionExpression, keys.ExpressionAttributeNames)
+			}
+			p.RequestItems[table] = keys
+		}
+		in.Parameters = &p
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if result, ok := out.Result.(*dynamodb.BatchGetItemOutput); ok {
+			for table, items := range result.Responses {
+				if !SoftDeletedTables[table] {
+					continue
+				}
+				kept := items[:0]
+				for _, item := range items {
+					if !isDeleted(item) {
+						kept = append(kept, item)
+					}
+				}
+				result.Responses[table] = kept
+			}
+		}
+		return out, metadata, err
+	case *dynamodb.ScanInput:
+		if softDeleted(params.TableName) {
+			p := *params
+			p.FilterExpression = and(p.FilterExpression, "attribute_not_exists(#deleted)")
+			p.ExpressionAttributeNames = withDeletedName(p.ExpressionAttributeNames)
+			in.Parameters = &p
+		}
+	case *dynamodb.QueryInput:
+		if softDeleted(params.TableName) {
+			p := *params
+			p.FilterExpression = and(p.FilterExpression, "attribute_not_exists(#deleted)")
+			p.ExpressionAttributeNames = withDeletedName(p.ExpressionAttributeNames)
+			in.Parameters = &p
+		}
+	}
+	return next.HandleInitialize(ctx, in)
+})
+
+func softDeleted(table *string) bool {
+	return table != nil && SoftDeletedTables[*table]
+}
+
+// isDeleted reports whether an item carries a deletion mark
+func isDeleted(item map[string]types.AttributeValue) bool {
+	deletedAt, ok := item["DeletedAt"].(*types.AttributeValueMemberS)
+	return ok && deletedAt.Value != ""
+}
+
+// projectDeleted adds DeletedAt to a projection so deleted items can be told apart
+func projectDeleted(projection *string, names map[string]string) (*string, map[string]string) {
+	projected := *projection + ", #deleted"
+	return &projected, withDeletedName(names)
+}
+
+// withDeletedName copies the expression names adding the DeletedAt placeholder
+func withDeletedName(names map[string]string) map[string]string {
+	copied := make(map[string]string, len(names)+1)
+	for k, v := range names {
+		copied[k] = v
+	}
+	copied["#deleted"] = "DeletedAt"
+	return copied
+}
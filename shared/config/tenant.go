@@ -0,0 +1,334 @@
+package config
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ClinicScopedTables maps the tables holding per-clinic records to their
+// partition key. Every record has a ClinicID attribute; records written
+// before clinics existed have none and belong to the default clinic.
+var ClinicScopedTables = map[string]string{
+	"Dentists":            "ID",
+	"Patients":            "ID",
+	"Procedures":          "ID",
+	"PriceAdjustments":    "ID",
+	"Appointments":        "ID",
+	"TreatmentPlans":      "ID",
+	"Medications":         "ID",
+	"Prescriptions":       "ID",
+	"AnamnesisTemplates":  "ID",
+	"Rooms":               "ID",
+	"Waitlist":            "ID",
+	"Bundles":             "ID",
+	"Tasks":               "ID",
+	"PreAuths":            "ID",
+	"Unavailability":      "ID",
+	"Expenses":            "ID",
+	"Revenues":            "ID",
+	"Invoices":            "ID",
+	"Assets":              "ID",
+	"Staff":               "ID",
+	"Shifts":              "ID",
+	"Absences":            "ID",
+	"Credentials":         "ID",
+	"LegalHolds":          "ID",
+	"Checklists":          "ID",
+	"ChecklistRuns":       "Date",
+	"Vouchers":            "Code",
+	"AssetMaintenance":    "AssetID",
+	"DentistPrices":       "DentistID",
+	"DentistSchedules":    "DentistID",
+	"CalendarSyncs":       "DentistID",
+	"ProcedurePrices":     "ProcedureID",
+	"Surveys":             "AppointmentID",
+	"ProcedureOutcomes":   "AppointmentID",
+	"ClinicalNotes":       "PatientID",
+	"Anamneses":           "PatientID",
+	"Attachments":         "PatientID",
+	"ClinicalPhotos":      "PatientID",
+	"Odontograms":         "PatientID",
+	"OdontogramSnapshots": "PatientID",
+	"Consents":            "PatientID",
+	"CreditBalances":      "PatientID",
+	"CreditLedger":        "PatientID",
+
+	// Stamped with the clinic of the failed message
+	"NotificationDeadLetters": "ID",
+}
+
+// UnscopedTables lists the tables clinicScope leaves alone: those keyed by
+// the clinic itself, those whose records belong to no single clinic and
+// those reached through keys naming the clinic. ensureTableExists refuses to
+// create a table listed neither here nor in ClinicScopedTables, so every new
+// table is classified when it is introduced.
+var UnscopedTables = map[string]bool{
+	// Keyed by ClinicID
+	"PayrollRuns":           true,
+	"FinancialPeriods":      true,
+	"NotificationOutbox":    true,
+	"NotificationTemplates": true,
+	"SandboxNotifications":  true,
+	"RetentionPolicies":     true,
+	"NetworkPolicies":       true,
+	ChangeLogTable:          true,
+	AuditLogTable:           true,
+	"Letterheads":           true,
+	"ReminderSettings":      true,
+	"ReminderLog":           true,
+	"BenchmarkSettings":     true,
+	"WebhookSubscriptions":  true,
+	"WebhookDeliveries":     true,
+	"OIDCSettings":          true,
+	// Shared by the clinics of the deployment
+	"Clinics":             true,
+	"Organizations":       true,
+	"PatientShares":       true,
+	"DentistIdentities":   true,
+	"DentistLinks":        true,
+	"Users":               true,
+	"ProvisioningClients": true,
+	"Notifications":       true, // keyed by the recipient user
+	"Counters":            true, // counter names include the clinic
+}
+
+// mustBeClassified stops the startup when a table is in neither
+// ClinicScopedTables nor UnscopedTables
+func mustBeClassified(tableName string) {
+	if _, scoped := ClinicScopedTables[tableName]; !scoped && !UnscopedTables[tableName] {
+		log.Fatalf("Table %s is not classified in ClinicScopedTables or UnscopedTables", tableName)
+	}
+}
+
+type clinicKey struct{}
+
+// WithClinic scopes the DynamoDB calls made with ctx to a clinic
+func WithClinic(ctx context.Context, clinicID string) context.Context {
+	return context.WithValue(ctx, clinicKey{}, clinicID)
+}
+
+// AllClinics lifts the clinic scope, for background jobs and for lookups by
+// a signed token that identifies the record on its own
+func AllClinics(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clinicKey{}, "")
+}
+
+// ClinicID returns the clinic ctx is scoped to, or the default clinic
+func ClinicID(ctx context.Context) string {
+	if id, _ := ctx.Value(clinicKey{}).(string); id != "" {
+		return id
+	}
+	return DefaultClinicID
+}
+
+func scopedClinic(ctx context.Context) (string, bool) {
+	id, _ := ctx.Value(clinicKey{}).(string)
+	return id, id != ""
+}
+
+// clinicScope is a DynamoDB client middleware that confines every call on a
+// clinic scoped table to the clinic of its context: reads only see the
+// clinic's records, writes stamp its ID and never touch another clinic's
+// records. Calls without a clinic in their context are left alone.
+var clinicScope = middleware.InitializeMiddlewareFunc("ClinicScope", func(
+	ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	clinicID, ok := scopedClinic(ctx)
+	if !ok {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	switch params := in.Parameters.(type) {
+	case *dynamodb.GetItemInput:
+		if scoped(params.TableName) && params.ProjectionExpression != nil {
+			p := *params
+			p.ProjectionExpression, p.ExpressionAttributeNames = projectClinic(p.ProjectionExpression, p.ExpressionAttributeNames)
+			in.Parameters = &p
+		}
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if result, ok := out.Result.(*dynamodb.GetItemOutput); ok && scoped(params.TableName) && !ownedBy(result.Item, clinicID) {
+			result.Item = nil
+		}
+		return out, metadata, err
+	case *dynamodb.BatchGetItemInput:
+		p := *params
+		p.RequestItems = make(map[string]types.KeysAndAttributes, len(params.RequestItems))
+		for table, keys := range params.RequestItems {
+			if _, scoped := ClinicScopedTables[table]; scoped && keys.ProjectionExpression != nil {
+				keys.ProjectionExpression, keys.ExpressionAttributeNames = projectClinic(keys.ProjectionExpression, keys.ExpressionAttributeNames)
+			}
+			p.RequestItems[table] = keys
+		}
+		in.Parameters = &p
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if result, ok := out.Result.(*dynamodb.BatchGetItemOutput); ok {
+			for table, items := range result.Responses {
+				if _, scoped := ClinicScopedTables[table]; !scoped {
+					continue
+				}
+				owned := items[:0]
+				for _, item := range items {
+					if ownedBy(item, clinicID) {
+						owned = append(owned, item)
+					}
+				}
+				result.Responses[table] = owned
+			}
+		}
+		return out, metadata, err
+	case *dynamodb.ScanInput:
+		if scoped(params.TableName) {
+			p := *params
+			p.FilterExpression = and(p.FilterExpression, clinicCondition(clinicID))
+			p.ExpressionAttributeNames, p.ExpressionAttributeValues = clinicExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, clinicID)
+			in.Parameters = &p
+		}
+	case *dynamodb.QueryInput:
+		if scoped(params.TableName) {
+			p := *params
+			p.FilterExpression = and(p.FilterExpression, clinicCondition(clinicID))
+			p.ExpressionAttributeNames, p.ExpressionAttributeValues = clinicExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, clinicID)
+			in.Parameters = &p
+		}
+	case *dynamodb.PutItemInput:
+		if scoped(params.TableName) {
+			p := *params
+			p.Item = stamp(p.Item, clinicID)
+			p.ConditionExpression = and(p.ConditionExpression, writeCondition(*p.TableName, clinicID))
+			p.ExpressionAttributeNames, p.ExpressionAttributeValues = clinicExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, clinicID)
+			in.Parameters = &p
+		}
+	case *dynamodb.UpdateItemInput:
+		if scoped(params.TableName) {
+			p := *params
+			p.ConditionExpression = and(p.ConditionExpression, writeCondition(*p.TableName, clinicID))
+			p.ExpressionAttributeNames, p.ExpressionAttributeValues = clinicExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, clinicID)
+			in.Parameters = &p
+		}
+	case *dynamodb.DeleteItemInput:
+		if scoped(params.TableName) {
+			p := *params
+			p.ConditionExpression = and(p.ConditionExpression, writeCondition(*p.TableName, clinicID))
+			p.ExpressionAttributeNames, p.ExpressionAttributeValues = clinicExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, clinicID)
+			in.Parameters = &p
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		p := *params
+		p.TransactItems = make([]types.TransactWriteItem, len(params.TransactItems))
+		for i, item := range params.TransactItems {
+			p.TransactItems[i] = scopeTransactItem(item, clinicID)
+		}
+		in.Parameters = &p
+	}
+	return next.HandleInitialize(ctx, in)
+})
+
+func scopeTransactItem(item types.TransactWriteItem, clinicID string) types.TransactWriteItem {
+	switch {
+	case item.Put != nil && scoped(item.Put.TableName):
+		put := *item.Put
+		put.Item = stamp(put.Item, clinicID)
+		put.ConditionExpression = and(put.ConditionExpression, writeCondition(*put.TableName, clinicID))
+		put.ExpressionAttributeNames, put.ExpressionAttributeValues = clinicExpression(put.ExpressionAttributeNames, put.ExpressionAttributeValues, clinicID)
+		item.Put = &put
+	case item.Update != nil && scoped(item.Update.TableName):
+		update := *item.Update
+		update.ConditionExpression = and(update.ConditionExpression, writeCondition(*update.TableName, clinicID))
+		update.ExpressionAttributeNames, update.ExpressionAttributeValues = clinicExpression(update.ExpressionAttributeNames, update.ExpressionAttributeValues, clinicID)
+		item.Update = &update
+	case item.Delete != nil && scoped(item.Delete.TableName):
+		del := *item.Delete
+		del.ConditionExpression = and(del.ConditionExpression, writeCondition(*del.TableName, clinicID))
+		del.ExpressionAttributeNames, del.ExpressionAttributeValues = clinicExpression(del.ExpressionAttributeNames, del.ExpressionAttributeValues, clinicID)
+		item.Delete = &del
+	case item.ConditionCheck != nil && scoped(item.ConditionCheck.TableName):
+		check := *item.ConditionCheck
+		check.ConditionExpression = and(check.ConditionExpression, clinicCondition(clinicID))
+		check.ExpressionAttributeNames, check.ExpressionAttributeValues = clinicExpression(check.ExpressionAttributeNames, check.ExpressionAttributeValues, clinicID)
+		item.ConditionCheck = &check
+	}
+	return item
+}
+
+func scoped(table *string) bool {
+	if table == nil {
+		return false
+	}
+	_, ok := ClinicScopedTables[*table]
+	return ok
+}
+
+// ownedBy reports whether an item belongs to the clinic
+func ownedBy(item map[string]types.AttributeValue, clinicID string) bool {
+	if item == nil {
+		return true
+	}
+	owner, ok := item["ClinicID"].(*types.AttributeValueMemberS)
+	if !ok || owner.Value == "" {
+		return clinicID == DefaultClinicID
+	}
+	return owner.Value == clinicID
+}
+
+// clinicCondition matches the clinic's records
+func clinicCondition(clinicID string) string {
+	if clinicID == DefaultClinicID {
+		return "(attribute_not_exists(#clinic) OR #clinic = :clinic)"
+	}
+	return "#clinic = :clinic"
+}
+
+// writeCondition lets a write create a record or change one of the clinic's
+func writeCondition(table, clinicID string) string {
+	return "(attribute_not_exists(" + ClinicScopedTables[table] + ") OR " + clinicCondition(clinicID) + ")"
+}
+
+// projectClinic adds ClinicID to a projection so ownership can be checked
+func projectClinic(projection *string, names map[string]string) (*string, map[string]string) {
+	projected := *projection + ", #clinic"
+	scopedNames := make(map[string]string, len(names)+1)
+	for k, v := range names {
+		scopedNames[k] = v
+	}
+	scopedNames["#clinic"] = "ClinicID"
+	return &projected, scopedNames
+}
+
+func and(expression *string, condition string) *string {
+	if expression == nil || strings.TrimSpace(*expression) == "" {
+		return &condition
+	}
+	combined := "(" + *expression + ") AND " + condition
+	return &combined
+}
+
+// clinicExpression copies the expression names and values adding the clinic
+// placeholders, so the caller's maps are left untouched
+func clinicExpression(names map[string]string, values map[string]types.AttributeValue, clinicID string) (map[string]string, map[string]types.AttributeValue) {
+	scopedNames := make(map[string]string, len(names)+1)
+	for k, v := range names {
+		scopedNames[k] = v
+	}
+	scopedNames["#clinic"] = "ClinicID"
+
+	scopedValues := make(map[string]types.AttributeValue, len(values)+1)
+	for k, v := range values {
+		scopedValues[k] = v
+	}
+	scopedValues[":clinic"] = &types.AttributeValueMemberS{Value: clinicID}
+	return scopedNames, scopedValues
+}
+
+func stamp(item map[string]types.AttributeValue, clinicID string) map[string]types.AttributeValue {
+	stamped := make(map[string]types.AttributeValue, len(item)+1)
+	for k, v := range item {
+		stamped[k] = v
+	}
+	stamped["ClinicID"] = &types.AttributeValueMemberS{Value: clinicID}
+	return stamped
+}
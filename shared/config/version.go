@@ -0,0 +1,225 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// VersionedTables lists the tables whose records carry a Version, raised by
+// every write, so that a change made from a stale read fails instead of
+// silently overwriting the changes made since. Their key is ID.
+var VersionedTables = map[string]bool{
+	"Dentists":           true,
+	"Patients":           true,
+	"Procedures":         true,
+	"Appointments":       true,
+	"Bundles":            true,
+	"TreatmentPlans":     true,
+	"Tasks":              true,
+	"PreAuths":           true,
+	"Prescriptions":      true,
+	"AnamnesisTemplates": true,
+	"Expenses":           true,
+	"Revenues":           true,
+	"Invoices":           true,
+	"Assets":             true,
+	"Credentials":        true,
+	"Checklists":         true,
+	"Staff":              true,
+	"Shifts":             true,
+}
+
+// ErrVersionConflict is returned by writes to a record that was changed
+// since the version they expect
+var ErrVersionConflict = errors.New("record was changed since it was read")
+
+type versionKey struct{}
+
+type expectedVersion struct {
+	table, id string
+	version   int64
+}
+
+// WithVersion marks ctx so writes made with it to the record fail with
+// ErrVersionConflict unless the record is still at version, the one the
+// client read
+func WithVersion(ctx context.Context, table, id string, version int64) context.Context {
+	return context.WithValue(ctx, versionKey{}, expectedVersion{table: table, id: id, version: version})
+}
+
+// expected returns the version ctx expects of a record
+func expected(ctx context.Context, table string, key map[string]types.AttributeValue) (int64, bool) {
+	v, ok := ctx.Value(versionKey{}).(expectedVersion)
+	if !ok || v.table != table {
+		return 0, false
+	}
+	id, _ := key["ID"].(*types.AttributeValueMemberS)
+	if id == nil || id.Value != v.id {
+		return 0, false
+	}
+	return v.version, true
+}
+
+// PutRecord writes the item of input, keyed by ID, adding its conditions: a
+// new record, whose ID must not be taken, when create, else a replacement of
+// an existing one. Replacements of the records of the versioned tables also
+// require the record to still be at the version ctx expects (WithVersion),
+// or else at the Version the item carries, the one it was read at, and write
+// the next version; a record changed since fails the put with
+// ErrVersionConflict. New records, and those written before versions
+// existed, are at version 0.
+func PutRecord(ctx context.Context, input *dynamodb.PutItemInput, create bool) error {
+	p := *input
+	switch {
+	case create:
+		p.ConditionExpression = and(p.ConditionExpression, "attribute_not_exists(ID)")
+	case !versioned(p.TableName):
+		p.ConditionExpression = and(p.ConditionExpression, "attribute_exists(ID)")
+	default:
+		return replaceVersioned(ctx, &p)
+	}
+	_, err := DBClient.PutItem(ctx, &p)
+	return err
+}
+
+// replaceVersioned writes input, a replacement of a record of a versioned
+// table, checking and raising its version
+func replaceVersioned(ctx context.Context, input *dynamodb.PutItemInput) error {
+	table := aws.ToString(input.TableName)
+	key := map[string]types.AttributeValue{"ID": input.Item["ID"]}
+	version := int64(0)
+	if current, ok := input.Item["Version"].(*types.AttributeValueMemberN); ok {
+		version, _ = strconv.ParseInt(current.Value, 10, 64)
+	}
+	if v, ok := expected(ctx, table, key); ok {
+		version = v
+	}
+
+	p := *input
+	p.Item = make(map[string]types.AttributeValue, len(input.Item))
+	for k, v := range input.Item {
+		p.Item[k] = v
+	}
+	p.Item["Version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)}
+	p.ConditionExpression = and(and(p.ConditionExpression, "attribute_exists(ID)"), versionCondition(version))
+	p.ExpressionAttributeNames, p.ExpressionAttributeValues = versionExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, map[string]int64{":version": version})
+
+	_, err := DBClient.PutItem(ctx, &p)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) && changedSince(ctx, table, key, version) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// versioning is a DynamoDB client middleware that raises the Version of the
+// records of the versioned tables on every update, requiring the version
+// the context expects (WithVersion) when it has one. An update failing on
+// the version returns ErrVersionConflict. Puts replacing records check the
+// version through PutRecord.
+var versioning = middleware.InitializeMiddlewareFunc("Versioning", func(
+	ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	params, ok := in.Parameters.(*dynamodb.UpdateItemInput)
+	if !ok || !versioned(params.TableName) {
+		return next.HandleInitialize(ctx, in)
+	}
+	table, key := *params.TableName, params.Key
+	version, checked := expected(ctx, table, key)
+
+	p := *params
+	p.UpdateExpression = raiseVersion(p.UpdateExpression)
+	placeholders := map[string]int64{":versionZero": 0, ":versionOne": 1}
+	if checked {
+		p.ConditionExpression = and(p.ConditionExpression, versionCondition(version))
+		placeholders[":version"] = version
+	}
+	p.ExpressionAttributeNames, p.ExpressionAttributeValues = versionExpression(p.ExpressionAttributeNames, p.ExpressionAttributeValues, placeholders)
+	in.Parameters = &p
+
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	var cfe *types.ConditionalCheckFailedException
+	if checked && errors.As(err, &cfe) && changedSince(ctx, table, key, version) {
+		return out, metadata, ErrVersionConflict
+	}
+	return out, metadata, err
+})
+
+func versioned(table *string) bool {
+	return table != nil && VersionedTables[*table]
+}
+
+// versionCondition matches a record at version
+func versionCondition(version int64) string {
+	if version == 0 {
+		return "(attribute_not_exists(#version) OR #version = :version)"
+	}
+	return "#version = :version"
+}
+
+// raiseVersion adds the increment of Version to the SET clause of an update
+// expression, adding the clause when there is none
+func raiseVersion(expression *string) *string {
+	const raise = "#version = if_not_exists(#version, :versionZero) + :versionOne"
+	if expression == nil || strings.TrimSpace(*expression) == "" {
+		return aws.String("SET " + raise)
+	}
+	upper := strings.ToUpper(*expression)
+	for i := strings.Index(upper, "SET "); i >= 0; {
+		if i == 0 || upper[i-1] == ' ' {
+			raised := (*expression)[:i+4] + raise + ", " + (*expression)[i+4:]
+			return &raised
+		}
+		next := strings.Index(upper[i+4:], "SET ")
+		if next < 0 {
+			break
+		}
+		i += 4 + next
+	}
+	return aws.String("SET " + raise + " " + *expression)
+}
+
+// versionExpression copies the expression names and values adding the
+// version placeholders, so the caller's maps are left untouched
+func versionExpression(names map[string]string, values map[string]types.AttributeValue, placeholders map[string]int64) (map[string]string, map[string]types.AttributeValue) {
+	versionNames := make(map[string]string, len(names)+1)
+	for k, v := range names {
+		versionNames[k] = v
+	}
+	versionNames["#version"] = "Version"
+
+	versionValues := make(map[string]types.AttributeValue, len(values)+len(placeholders))
+	for k, v := range values {
+		versionValues[k] = v
+	}
+	for k, v := range placeholders {
+		versionValues[k] = &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+	}
+	return versionNames, versionValues
+}
+
+// changedSince tells a write that failed because the record moved past
+// version from one that failed because the record is missing, deleted or
+// another clinic's, which the read with the same context does not return
+func changedSince(ctx context.Context, table string, key map[string]types.AttributeValue, version int64) bool {
+	result, err := DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return false
+	}
+	stored := int64(0)
+	if n, ok := result.Item["Version"].(*types.AttributeValueMemberN); ok {
+		stored, _ = strconv.ParseInt(n.Value, 10, 64)
+	}
+	return stored != version
+}
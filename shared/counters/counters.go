@@ -0,0 +1,110 @@
+package counters
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/live"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const tableName = "Counters"
+
+// Shards is the number of items each counter is spread over. Writes pick a
+// random shard so hot counters don't throttle on a single partition key.
+const Shards = 10
+
+// PatientsCounter names the counter of patients registered in a clinic
+func PatientsCounter(clinicID string) string {
+	return fmt.Sprintf("clinic#%s#patients", clinicID)
+}
+
+// AppointmentsPerDayCounter names the counter of appointments booked for a day (YYYY-MM-DD)
+func AppointmentsPerDayCounter(clinicID, day string) string {
+	return fmt.Sprintf("clinic#%s#appointments#%s", clinicID, day)
+}
+
+// Increment adds delta to a random shard of the counter
+func Increment(ctx context.Context, name string, delta int64) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"Name":  &types.AttributeValueMemberS{Value: name},
+			"Shard": &types.AttributeValueMemberN{Value: strconv.Itoa(rand.Intn(Shards))},
+		},
+		UpdateExpression: aws.String("ADD #count :delta"),
+		ExpressionAttributeNames: map[string]string{
+			"#count": "Count",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(delta, 10)},
+		},
+	})
+	return err
+}
+
+// IncrementAsync updates a counter without failing the caller; drift caused
+// by lost updates is corrected by the reconciliation job. Connected
+// dashboards are told the counters changed.
+func IncrementAsync(ctx context.Context, name string, delta int64) {
+	if err := Increment(context.WithoutCancel(ctx), name, delta); err != nil {
+		log.Printf("Error incrementing counter %s: %v", name, err)
+		return
+	}
+	live.Metrics.Touch()
+}
+
+// Get sums every shard of the counter
+func Get(ctx context.Context, name string) (int64, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("#name = :name"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":name": &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, item := range result.Items {
+		if count, ok := item["Count"].(*types.AttributeValueMemberN); ok {
+			n, err := strconv.ParseInt(count.Value, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid count in counter %s: %v", name, err)
+			}
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// Set moves the counter to value by adding the difference to one shard, so
+// increments racing with the correction are not lost
+func Set(ctx context.Context, name string, value int64) (int64, error) {
+	current, err := Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	drift := value - current
+	if drift == 0 {
+		return 0, nil
+	}
+	return drift, Increment(ctx, name, drift)
+}
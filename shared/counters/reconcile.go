@@ -0,0 +1,161 @@
+package counters
+
+import (
+	"context"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ReconcileResult reports the corrections made by a reconciliation run
+type ReconcileResult struct {
+	Checked    int              `json:"checked"`
+	Corrected  map[string]int64 `json:"corrected"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+}
+
+// Reconcile recounts the patients and appointments per day of every clinic
+// from the source tables and corrects any counter that drifted
+func Reconcile(ctx context.Context) (ReconcileResult, error) {
+	result := ReconcileResult{
+		Corrected: make(map[string]int64),
+		StartedAt: time.Now().UTC(),
+	}
+	err := clinics.Each(ctx, func(ctx context.Context) error {
+		return reconcileClinic(ctx, &result)
+	})
+	result.FinishedAt = time.Now().UTC()
+	return result, err
+}
+
+// reconcileClinic recounts the clinic of ctx, whose records and counters are
+// in the region the clinic is pinned to
+func reconcileClinic(ctx context.Context, result *ReconcileResult) error {
+	clinicID := config.ClinicID(ctx)
+	expected := make(map[string]int64)
+
+	expected[PatientsCounter(clinicID)] = 0
+	err := scanPages(ctx, &dynamodb.ScanInput{
+		TableName:            aws.String("Patients"),
+		ProjectionExpression: aws.String("ClinicID"),
+	}, func(page *dynamodb.ScanOutput) {
+		for _, item := range page.Items {
+			expected[PatientsCounter(clinicOf(item))]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = scanPages(ctx, &dynamodb.ScanInput{
+		TableName:            aws.String("Appointments"),
+		ProjectionExpression: aws.String("#dt, ClinicID"),
+		ExpressionAttributeNames: map[string]string{
+			"#dt": "DateTime",
+		},
+	}, func(page *dynamodb.ScanOutput) {
+		for _, item := range page.Items {
+			dt, ok := item["DateTime"].(*types.AttributeValueMemberS)
+			if !ok || len(dt.Value) < 10 {
+				continue
+			}
+			expected[AppointmentsPerDayCounter(clinicOf(item), dt.Value[:10])]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Days whose appointments were all deleted, or a clinic whose patients
+	// were, must go back to zero
+	prefix := "clinic#" + clinicID + "#"
+	err = scanPages(ctx, &dynamodb.ScanInput{
+		TableName:            aws.String(tableName),
+		ProjectionExpression: aws.String("#name"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+	}, func(page *dynamodb.ScanOutput) {
+		for _, item := range page.Items {
+			name, ok := item["Name"].(*types.AttributeValueMemberS)
+			if !ok || !strings.HasPrefix(name.Value, prefix) {
+				continue
+			}
+			if !strings.HasSuffix(name.Value, "#patients") && !strings.Contains(name.Value, "#appointments#") {
+				continue
+			}
+			if _, known := expected[name.Value]; !known {
+				expected[name.Value] = 0
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, value := range expected {
+		drift, err := Set(ctx, name, value)
+		if err != nil {
+			return err
+		}
+		result.Checked++
+		if drift != 0 {
+			result.Corrected[name] = drift
+		}
+	}
+	return nil
+}
+
+// StartReconciler runs Reconcile every interval until ctx is done
+func StartReconciler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := Reconcile(ctx)
+				if err != nil {
+					log.Printf("Error reconciling counters: %v", err)
+					continue
+				}
+				log.Printf("Reconciled %d counters, corrected %d", result.Checked, len(result.Corrected))
+			}
+		}
+	}()
+}
+
+// clinicOf returns the clinic of an item; items without one are older than
+// clinics and belong to the default clinic
+func clinicOf(item map[string]types.AttributeValue) string {
+	if clinic, ok := item["ClinicID"].(*types.AttributeValueMemberS); ok && clinic.Value != "" {
+		return clinic.Value
+	}
+	return config.DefaultClinicID
+}
+
+func scanPages(ctx context.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput)) error {
+	paginator := dynamodb.NewScanPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		fn(page)
+	}
+	return nil
+}
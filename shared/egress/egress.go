@@ -0,0 +1,92 @@
+// Package egress guards the requests the server makes to URLs its users
+// configure, such as webhook subscriptions and CalDAV calendars, so those
+// URLs cannot be used to probe the deployment's internal services or the
+// cloud metadata endpoint.
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// lookupTimeout bounds the resolution of a host when its URL is saved
+const lookupTimeout = 5 * time.Second
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private to
+// the provider's network like the RFC 1918 ranges
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP reports whether ip is an address on the internet, not loopback,
+// private, link-local (such as 169.254.169.254), multicast or unspecified
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip) || ip.Equal(net.IPv4bcast) || (ip.To4() != nil && ip.To4()[0] == 0))
+}
+
+// CheckHost resolves the host of a URL being saved, refusing hosts with an
+// address that is not public unless allowPrivate is set
+func CheckHost(host string, allowPrivate bool) error {
+	if allowPrivate {
+		return nil
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("url host %s cannot be resolved", host)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !PublicIP(ip) {
+			return fmt.Errorf("url host %s must resolve to a public address", host)
+		}
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client for user-configured URLs. It checks every
+// address it connects to, as the host may resolve differently than when the
+// URL was saved, unless allowPrivate reports true; it goes through no proxy
+// and follows no redirects, handing the redirect response to the caller.
+func NewClient(timeout time.Duration, allowPrivate func() bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by scan workers. Tokens are read
+// capacity units, so the bucket caps the RCUs an export may consume.
+type Limiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+// NewLimiter creates a limiter refilling rate tokens per second. A zero or
+// negative rate disables limiting.
+func NewLimiter(rate float64) *Limiter {
+	return &Limiter{
+		rate:     rate,
+		burst:    rate,
+		tokens:   rate,
+		lastFill: time.Now(),
+	}
+}
+
+// Wait blocks until cost tokens are available or ctx is done. Costs larger
+// than the burst are allowed and simply drive the bucket negative, making
+// later callers wait longer.
+func (l *Limiter) Wait(ctx context.Context, cost float64) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.lastFill).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastFill = now
+	l.tokens -= cost
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
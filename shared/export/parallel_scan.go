@@ -0,0 +1,118 @@
+package export
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MaxSegments caps the number of parallel scan workers
+const MaxSegments = 32
+
+// ScanOptions configures a parallel scan
+type ScanOptions struct {
+	// Segments is the number of workers, each scanning one table segment
+	Segments int
+	// ReadUnitsPerSecond caps consumed read capacity; zero means unlimited
+	ReadUnitsPerSecond float64
+	// PageSize limits items per Scan call; zero uses the DynamoDB default (1MB pages)
+	PageSize int32
+}
+
+// ParallelScan reads the whole table using TotalSegments workers and calls
+// handle for every item. handle is never called concurrently, so it may
+// write directly to a response. The first error cancels all workers.
+func ParallelScan(ctx context.Context, client dynamodb.ScanAPIClient, tableName string, opts ScanOptions, handle func(map[string]types.AttributeValue) error) error {
+	segments := opts.Segments
+	if segments <= 0 {
+		segments = 1
+	}
+	if segments > MaxSegments {
+		segments = MaxSegments
+	}
+	limiter := NewLimiter(opts.ReadUnitsPerSecond)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make(chan []map[string]types.AttributeValue, segments)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for segment := 0; segment < segments; segment++ {
+		wg.Add(1)
+		go func(segment int32) {
+			defer wg.Done()
+
+			input := &dynamodb.ScanInput{
+				TableName:              aws.String(tableName),
+				Segment:                aws.Int32(segment),
+				TotalSegments:          aws.Int32(int32(segments)),
+				ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+			}
+			if opts.PageSize > 0 {
+				input.Limit = aws.Int32(opts.PageSize)
+			}
+
+			paginator := dynamodb.NewScanPaginator(client, input)
+			for paginator.HasMorePages() {
+				pageCtx, pageCancel := config.DBContext(ctx)
+				page, err := paginator.NextPage(pageCtx)
+				pageCancel()
+				if err != nil {
+					fail(err)
+					return
+				}
+
+				select {
+				case pages <- page.Items:
+				case <-ctx.Done():
+					return
+				}
+
+				cost := 1.0
+				if page.ConsumedCapacity != nil && page.ConsumedCapacity.CapacityUnits != nil {
+					cost = *page.ConsumedCapacity.CapacityUnits
+				}
+				if err := limiter.Wait(ctx, cost); err != nil {
+					return
+				}
+			}
+		}(int32(segment))
+	}
+
+	go func() {
+		wg.Wait()
+		close(pages)
+	}()
+
+	for items := range pages {
+		if ctx.Err() != nil {
+			continue
+		}
+		for _, item := range items {
+			if err := handle(item); err != nil {
+				fail(err)
+				break
+			}
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errorWindow is how far back the error rate looks
+const errorWindow = 5 * time.Minute
+
+// bucket counts the requests served during one minute
+type bucket struct {
+	minute   int64
+	requests int
+	errors   int
+}
+
+// Recorder keeps per-minute request and server error counts over the error window
+type Recorder struct {
+	mu      sync.Mutex
+	buckets [int(errorWindow / time.Minute)]bucket
+}
+
+// Default is the recorder fed by Middleware and read by the score endpoint
+var Default = &Recorder{}
+
+// Record counts a finished request; only 5xx responses count as errors
+func (rec *Recorder) Record(status int, at time.Time) {
+	minute := at.Unix() / 60
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	b := &rec.buckets[minute%int64(len(rec.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.requests++
+	if status >= http.StatusInternalServerError {
+		b.errors++
+	}
+}
+
+// ErrorRate returns the share of requests that failed within the error window
+func (rec *Recorder) ErrorRate(now time.Time) (rate float64, requests int) {
+	oldest := now.Add(-errorWindow).Unix() / 60
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	errors := 0
+	for _, b := range rec.buckets {
+		if b.minute > oldest {
+			requests += b.requests
+			errors += b.errors
+		}
+	}
+	if requests == 0 {
+		return 0, 0
+	}
+	return float64(errors) / float64(requests), requests
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses working through the wrapper
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Middleware records the status of every request except the health checks themselves
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/health") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+		Default.Record(sr.status, time.Now())
+	})
+}
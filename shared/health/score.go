@@ -0,0 +1,210 @@
+package health
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Component weights, summing to 1
+const (
+	dbWeight      = 0.5
+	errorWeight   = 0.3
+	backlogWeight = 0.2
+)
+
+// DB latency at or below dbLatencyGood scores full marks, at or above dbLatencyBad scores zero
+const (
+	dbLatencyGood = 50 * time.Millisecond
+	dbLatencyBad  = time.Second
+)
+
+// dbProbeTTL is how long a DynamoDB probe is reused, so frequent health
+// checks from several load balancers do not each call DynamoDB
+const dbProbeTTL = 5 * time.Second
+
+// errorRateBad is the 5xx share at which the error component scores zero
+const errorRateBad = 0.25
+
+// minRequests is the sample size below which the error rate is not trusted
+const minRequests = 10
+
+// Component is the score of one health signal
+type Component struct {
+	Score  float64 `json:"score"`
+	Weight float64 `json:"weight"`
+	Detail string  `json:"detail"`
+}
+
+// Report is the weighted health of the instance
+type Report struct {
+	Score      int                  `json:"score"`
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+type backlog struct {
+	depth func() int
+	limit int
+}
+
+var (
+	backlogsMu sync.RWMutex
+	backlogs   = map[string]backlog{}
+)
+
+var (
+	dbProbeMu     sync.Mutex
+	dbProbe       Component
+	dbProbeExpiry time.Time
+)
+
+// RegisterBacklog adds a queue to the backlog component; depth reports the
+// pending items and limit is the depth at which the queue scores zero
+func RegisterBacklog(name string, depth func() int, limit int) {
+	backlogsMu.Lock()
+	defer backlogsMu.Unlock()
+	backlogs[name] = backlog{depth: depth, limit: limit}
+}
+
+// BacklogStatus is the current depth of a registered queue
+type BacklogStatus struct {
+	Name  string `json:"name"`
+	Depth int    `json:"depth"`
+	Limit int    `json:"limit"`
+}
+
+// Backlogs returns the depth of every registered queue, sorted by name
+func Backlogs() []BacklogStatus {
+	backlogsMu.RLock()
+	defer backlogsMu.RUnlock()
+
+	statuses := make([]BacklogStatus, 0, len(backlogs))
+	for name, b := range backlogs {
+		statuses = append(statuses, BacklogStatus{Name: name, Depth: b.depth(), Limit: b.limit})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Evaluate measures every signal and combines them into a 0-100 score
+func Evaluate(ctx context.Context) Report {
+	components := map[string]Component{
+		"dynamodb": dbComponent(ctx),
+		"errors":   errorComponent(),
+		"backlog":  backlogComponent(),
+	}
+
+	total := 0.0
+	for _, c := range components {
+		total += c.Score * c.Weight
+	}
+	score := int(total*100 + 0.5)
+
+	status := "healthy"
+	if score < config.EnvInt("HEALTH_DRAIN_SCORE", 50) {
+		status = "degraded"
+	}
+	return Report{Score: score, Status: status, Components: components}
+}
+
+// dbComponent returns the last DynamoDB probe while it is fresh, probing
+// again once it expires. Concurrent checks wait for the same probe.
+func dbComponent(ctx context.Context) Component {
+	dbProbeMu.Lock()
+	defer dbProbeMu.Unlock()
+	if time.Now().Before(dbProbeExpiry) {
+		return dbProbe
+	}
+	dbProbe = probeDB(ctx)
+	dbProbeExpiry = time.Now().Add(dbProbeTTL)
+	return dbProbe
+}
+
+// probeDB times a call to DynamoDB. The error is logged rather than put in
+// the detail, as the endpoint is public.
+func probeDB(ctx context.Context) Component {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	_, err := config.DBClient.ListTables(ctx, &dynamodb.ListTablesInput{Limit: aws.Int32(1)})
+	latency := time.Since(start)
+	if err != nil {
+		log.Printf("Health probe of DynamoDB failed: %v", err)
+		return Component{Score: 0, Weight: dbWeight, Detail: "unreachable"}
+	}
+	return Component{
+		Score:  linearScore(float64(latency), float64(dbLatencyGood), float64(dbLatencyBad)),
+		Weight: dbWeight,
+		Detail: "latency " + latency.Round(time.Millisecond).String(),
+	}
+}
+
+func errorComponent() Component {
+	rate, requests := Default.ErrorRate(time.Now())
+	detail := strconv.FormatFloat(rate*100, 'f', 1, 64) + "% of " + strconv.Itoa(requests) + " requests in the last 5m"
+	if requests < minRequests {
+		return Component{Score: 1, Weight: errorWeight, Detail: detail}
+	}
+	return Component{Score: linearScore(rate, 0, errorRateBad), Weight: errorWeight, Detail: detail}
+}
+
+// backlogComponent scores the fullest registered queue. The detail counts
+// the queues without naming them; admins see each queue in the admin module.
+func backlogComponent() Component {
+	statuses := Backlogs()
+	if len(statuses) == 0 {
+		return Component{Score: 1, Weight: backlogWeight, Detail: "no queues"}
+	}
+	score := 1.0
+	for _, b := range statuses {
+		if s := linearScore(float64(b.Depth), 0, float64(b.Limit)); s < score {
+			score = s
+		}
+	}
+	detail := strconv.Itoa(len(statuses)) + " queues, fullest at " + strconv.Itoa(int((1-score)*100+0.5)) + "%"
+	return Component{Score: score, Weight: backlogWeight, Detail: detail}
+}
+
+// linearScore maps value to 1 at or below good and 0 at or above bad
+func linearScore(value, good, bad float64) float64 {
+	switch {
+	case value <= good:
+		return 1
+	case value >= bad:
+		return 0
+	default:
+		return 1 - (value-good)/(bad-good)
+	}
+}
+
+// ScoreHandler godoc
+// @Summary Weighted health score
+// @Description Combine DynamoDB latency, the 5xx rate of the last 5 minutes and queue backlogs into a 0-100 score. Responds 503 once the score drops below HEALTH_DRAIN_SCORE so load balancers drain the instance before it fails hard. DynamoDB is probed at most every 5 seconds, and the details name no errors or queues, which are logged and shown in the admin module.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /health/score [get]
+func ScoreHandler(w http.ResponseWriter, r *http.Request) {
+	report := Evaluate(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Health-Score", strconv.Itoa(report.Score))
+	if report.Status != "healthy" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,83 @@
+package i18n
+
+import (
+	"dental-saas/shared/config"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Languages content can be translated to
+var Languages = []string{"pt-BR", "en", "es"}
+
+// Normalize maps a language tag to one of Languages, e.g. "pt" and "pt-pt"
+// to "pt-BR" and "en-US" to "en". It returns "" for unsupported languages.
+func Normalize(tag string) string {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	switch base {
+	case "pt":
+		return "pt-BR"
+	case "en", "es":
+		return base
+	}
+	return ""
+}
+
+// IsSupported reports whether tag is exactly one of Languages
+func IsSupported(tag string) bool {
+	for _, language := range Languages {
+		if language == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Default is the language of the clinic, in which untranslated content is
+// written, from CLINIC_LANGUAGE
+func Default() string {
+	if language := Normalize(config.EnvString("CLINIC_LANGUAGE", "pt-BR")); language != "" {
+		return language
+	}
+	return "pt-BR"
+}
+
+// Preferred returns the supported languages of the Accept-Language header in
+// order of preference, followed by the clinic default
+func Preferred(r *http.Request) []string {
+	type weighted struct {
+		language string
+		q        float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		language := Normalize(tag)
+		if language == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, weighted{language, q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+
+	languages := make([]string, 0, len(accepted)+1)
+	seen := map[string]bool{}
+	for _, a := range append(accepted, weighted{language: Default()}) {
+		if !seen[a.language] {
+			seen[a.language] = true
+			languages = append(languages, a.language)
+		}
+	}
+	return languages
+}
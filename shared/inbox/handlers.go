@@ -0,0 +1,108 @@
+package inbox
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultLimit = 50
+
+// ListHandler godoc
+// @Summary Get my notifications
+// @Description Get the in-app notifications (e.g. @mentions in notes, appointments and tasks) of the requesting staff member, newest first, with the unread count
+// @Tags notifications
+// @Produce json
+// @Param X-User-ID header string true "Requesting staff member"
+// @Param unread query bool false "Only unread notifications"
+// @Param limit query int false "Maximum notifications returned (default 50)"
+// @Success 200 {object} inbox.Inbox
+// @Failure 400 {object} apierror.Response "X-User-ID header is required"
+// @Failure 500 {object} apierror.Response "Failed to retrieve notifications"
+// @Router /api/v1/notifications [get]
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	user := User(r)
+	if user == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	inbox, err := List(r.Context(), user, r.URL.Query().Get("unread") == "true", limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve notifications", http.StatusInternalServerError)
+		log.Printf("Error listing notifications: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inbox)
+}
+
+// MarkReadHandler godoc
+// @Summary Mark a notification as read
+// @Description Mark one of the requesting staff member's notifications as read
+// @Tags notifications
+// @Param X-User-ID header string true "Requesting staff member"
+// @Param id path string true "Notification ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Response "X-User-ID header is required"
+// @Failure 404 {object} apierror.Response "Notification not found"
+// @Failure 500 {object} apierror.Response "Failed to update notification"
+// @Router /api/v1/notifications/{id}/read [post]
+func MarkReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := User(r)
+	if user == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := MarkRead(r.Context(), user, mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, ErrNotificationNotFound) {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update notification", http.StatusInternalServerError)
+		log.Printf("Error marking notification as read: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAllReadHandler godoc
+// @Summary Mark all notifications as read
+// @Description Mark every unread notification of the requesting staff member as read
+// @Tags notifications
+// @Produce json
+// @Param X-User-ID header string true "Requesting staff member"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} apierror.Response "X-User-ID header is required"
+// @Failure 500 {object} apierror.Response "Failed to update notifications"
+// @Router /api/v1/notifications/read-all [post]
+func MarkAllReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := User(r)
+	if user == "" {
+		http.Error(w, "X-User-ID header is required", http.StatusBadRequest)
+		return
+	}
+
+	n, err := MarkAllRead(r.Context(), user)
+	if err != nil {
+		http.Error(w, "Failed to update notifications", http.StatusInternalServerError)
+		log.Printf("Error marking notifications as read: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"marked": n})
+}
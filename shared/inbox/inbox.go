@@ -0,0 +1,233 @@
+package inbox
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// TableName holds in-app notifications, keyed by Recipient and ID. IDs start
+// with the creation time so a recipient's inbox is sorted newest last.
+const TableName = "Notifications"
+
+// UserHeader identifies the staff member making a request
+const UserHeader = "X-User-ID"
+
+// ErrNotificationNotFound is returned when marking an unknown notification
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// mentionPattern matches @handles of staff users, e.g. @ana.souza
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([A-Za-z0-9][A-Za-z0-9._-]*[A-Za-z0-9]|[A-Za-z0-9])`)
+
+// Notification is an in-app notification of a staff user
+type Notification struct {
+	Recipient  string `json:"recipient"`
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	SourceType string `json:"source_type"` // appointment, task, patient...
+	SourceID   string `json:"source_id"`
+	Author     string `json:"author,omitempty"`
+	Excerpt    string `json:"excerpt"`
+	Read       bool   `json:"read"`
+	CreatedAt  string `json:"created_at"`
+	ReadAt     string `json:"read_at,omitempty"`
+}
+
+// Inbox is a page of a user's notifications
+type Inbox struct {
+	Unread        int            `json:"unread"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// Source identifies the record a mention was written in
+type Source struct {
+	Type string
+	ID   string
+}
+
+// User returns the staff member making the request
+func User(r *http.Request) string {
+	return r.Header.Get(UserHeader)
+}
+
+// Mentions returns the distinct handles mentioned in text, in order
+func Mentions(text string) []string {
+	var handles []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		handle := strings.ToLower(match[1])
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// NotifyMentions notifies users mentioned in after who were not already
+// mentioned in before, so editing a text does not notify twice. Authors are
+// not notified of their own mentions. Failures are logged without failing the
+// caller's write.
+func NotifyMentions(ctx context.Context, source Source, author, before, after string) {
+	previous := make(map[string]bool)
+	for _, handle := range Mentions(before) {
+		previous[handle] = true
+	}
+
+	for _, handle := range Mentions(after) {
+		if previous[handle] || strings.EqualFold(handle, author) {
+			continue
+		}
+		if err := Notify(context.WithoutCancel(ctx), Notification{
+			Recipient:  handle,
+			Kind:       "mention",
+			SourceType: source.Type,
+			SourceID:   source.ID,
+			Author:     author,
+			Excerpt:    excerpt(after, handle),
+		}); err != nil {
+			log.Printf("Error notifying %s of mention in %s %s: %v", handle, source.Type, source.ID, err)
+		}
+	}
+}
+
+// Notify stores a notification in the recipient's inbox
+func Notify(ctx context.Context, notification Notification) error {
+	now := time.Now().UTC()
+	notification.ID = now.Format("20060102T150405.000000000") + "-" + uuid.NewString()[:8]
+	notification.CreatedAt = now.Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(TableName),
+		Item:      item,
+	})
+	return err
+}
+
+// excerpt returns the text around the first mention of handle
+func excerpt(text, handle string) string {
+	const radius = 80
+	runes := []rune(text)
+	i := strings.Index(strings.ToLower(text), "@"+handle)
+	if i < 0 {
+		i = 0
+	}
+	start := len([]rune(text[:i])) - radius
+	if start < 0 {
+		start = 0
+	}
+	end := start + 2*radius
+	if end > len(runes) {
+		end = len(runes)
+	}
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// List returns a user's notifications, newest first
+func List(ctx context.Context, recipient string, unreadOnly bool, limit int) (Inbox, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("Recipient = :recipient"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":recipient": &types.AttributeValueMemberS{Value: recipient},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	inbox := Inbox{Notifications: []Notification{}}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return Inbox{}, fmt.Errorf("querying notifications of %s: %v", recipient, err)
+		}
+		var notifications []Notification
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &notifications); err != nil {
+			return Inbox{}, fmt.Errorf("unmarshaling notifications: %v", err)
+		}
+		for _, notification := range notifications {
+			if !notification.Read {
+				inbox.Unread++
+			}
+			if (unreadOnly && notification.Read) || len(inbox.Notifications) >= limit {
+				continue
+			}
+			inbox.Notifications = append(inbox.Notifications, notification)
+		}
+	}
+	return inbox, nil
+}
+
+// MarkRead marks one of a user's notifications as read
+func MarkRead(ctx context.Context, recipient, id string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"Recipient": &types.AttributeValueMemberS{Value: recipient},
+			"ID":        &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET #read = :true, ReadAt = if_not_exists(ReadAt, :now)"),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		ExpressionAttributeNames: map[string]string{
+			"#read": "Read",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+			":now":  &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return ErrNotificationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of a user as read, returning how many changed
+func MarkAllRead(ctx context.Context, recipient string) (int, error) {
+	inbox, err := List(ctx, recipient, true, 1<<30)
+	if err != nil {
+		return 0, err
+	}
+	for _, notification := range inbox.Notifications {
+		if err := MarkRead(ctx, recipient, notification.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(inbox.Notifications), nil
+}
@@ -0,0 +1,278 @@
+package legalhold
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// TableName is the table holding legal holds, active and released
+const TableName = "LegalHolds"
+
+// Kinds of records a hold can name individually
+const (
+	RecordPatient     = "patient"
+	RecordAppointment = "appointment"
+	RecordTask        = "task"
+	RecordSurvey      = "survey"
+	RecordRevenue     = "revenue"
+	RecordInvoice     = "invoice"
+)
+
+// Kinds of records held only through their patient, named when checking
+// their deletes
+const (
+	RecordAttachment    = "attachment"
+	RecordClinicalPhoto = "clinical_photo"
+	RecordPrescription  = "prescription"
+	RecordTreatmentPlan = "treatment_plan"
+	RecordConsent       = "consent"
+)
+
+// Hold statuses
+const (
+	StatusActive   = "active"
+	StatusReleased = "released"
+)
+
+// Audit actions recorded in a hold's history
+const (
+	ActionPlaced   = "placed"
+	ActionReleased = "released"
+)
+
+var (
+	// ErrHeld is returned by Check when a record may not be deleted
+	ErrHeld = errors.New("record is under legal hold")
+	// ErrHoldNotFound is returned when a hold does not exist
+	ErrHoldNotFound = errors.New("legal hold not found")
+	// ErrAlreadyReleased is returned when releasing a hold that was already lifted
+	ErrAlreadyReleased = errors.New("legal hold already released")
+)
+
+// Record identifies a single held record
+type Record struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Event is an audit entry of a hold: who placed or lifted it, when and why
+type Event struct {
+	Action string `json:"action"`
+	By     string `json:"by"`
+	At     string `json:"at"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Hold keeps a patient, with every record linked to them, and/or a set of
+// individual records from being deleted, erased or purged until released
+type Hold struct {
+	ID         string   `json:"id"`
+	PatientID  string   `json:"patient_id,omitempty" dynamodbav:",omitempty"`
+	Records    []Record `json:"records,omitempty" dynamodbav:",omitempty"`
+	Reason     string   `json:"reason"`
+	Reference  string   `json:"reference,omitempty" dynamodbav:",omitempty"` // processo ou pedido que motivou o bloqueio
+	Status     string   `json:"status"`
+	PlacedBy   string   `json:"placed_by,omitempty"`
+	PlacedAt   string   `json:"placed_at"`
+	ReleasedBy string   `json:"released_by,omitempty" dynamodbav:",omitempty"`
+	ReleasedAt string   `json:"released_at,omitempty" dynamodbav:",omitempty"`
+	History    []Event  `json:"history"`
+}
+
+// IsValid checks that a hold names a reason and at least one patient or known record
+func (h *Hold) IsValid() error {
+	if h.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	if h.PatientID == "" && len(h.Records) == 0 {
+		return fmt.Errorf("patient ID or records are required")
+	}
+	for _, record := range h.Records {
+		switch record.Type {
+		case RecordPatient, RecordAppointment, RecordTask, RecordSurvey, RecordRevenue, RecordInvoice:
+		default:
+			return fmt.Errorf("record type must be one of patient, appointment, task, survey, revenue or invoice")
+		}
+		if record.ID == "" {
+			return fmt.Errorf("record ID is required")
+		}
+	}
+	return nil
+}
+
+// Set is a snapshot of the active holds, for checking many records at once
+type Set struct {
+	patients map[string]bool
+	records  map[Record]bool
+}
+
+// Covers reports whether a record, or the patient it belongs to, is held.
+// patientID may be empty for records not linked to a patient.
+func (s Set) Covers(recordType, id, patientID string) bool {
+	if s.records[Record{Type: recordType, ID: id}] {
+		return true
+	}
+	if recordType == RecordPatient && s.patients[id] {
+		return true
+	}
+	return patientID != "" && s.patients[patientID]
+}
+
+// Active loads the active holds
+func Active(ctx context.Context) (Set, error) {
+	holds, err := List(ctx, StatusActive)
+	if err != nil {
+		return Set{}, err
+	}
+	set := Set{patients: map[string]bool{}, records: map[Record]bool{}}
+	for _, hold := range holds {
+		if hold.PatientID != "" {
+			set.patients[hold.PatientID] = true
+		}
+		for _, record := range hold.Records {
+			set.records[record] = true
+		}
+	}
+	return set, nil
+}
+
+// Check returns ErrHeld when the record, or its patient, is under an active hold
+func Check(ctx context.Context, recordType, id, patientID string) error {
+	set, err := Active(ctx)
+	if err != nil {
+		return fmt.Errorf("loading legal holds: %v", err)
+	}
+	if set.Covers(recordType, id, patientID) {
+		return ErrHeld
+	}
+	return nil
+}
+
+// List returns the holds with the given status, or every hold when status is empty
+func List(ctx context.Context, status string) ([]Hold, error) {
+	input := &dynamodb.ScanInput{TableName: aws.String(TableName)}
+	if status != "" {
+		input.FilterExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		}
+	}
+
+	return paging.ScanAll[Hold](ctx, input)
+}
+
+// Get returns a hold by its ID
+func Get(ctx context.Context, id string) (Hold, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return Hold{}, err
+	}
+	if result.Item == nil {
+		return Hold{}, ErrHoldNotFound
+	}
+	var hold Hold
+	err = attributevalue.UnmarshalMap(result.Item, &hold)
+	return hold, err
+}
+
+// Place stores a new active hold placed by the given staff member
+func Place(ctx context.Context, hold Hold, by string) (Hold, error) {
+	if err := hold.IsValid(); err != nil {
+		return Hold{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	hold.ID = uuid.NewString()
+	hold.Status = StatusActive
+	hold.PlacedBy = by
+	hold.PlacedAt = now
+	hold.ReleasedBy = ""
+	hold.ReleasedAt = ""
+	hold.History = []Event{{Action: ActionPlaced, By: by, At: now, Reason: hold.Reason}}
+
+	item, err := attributevalue.MarshalMap(hold)
+	if err != nil {
+		return Hold{}, err
+	}
+
+	putCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}); err != nil {
+		return Hold{}, err
+	}
+	log.Printf("Legal hold %s placed by %q (patient %q, %d records): %s", hold.ID, by, hold.PatientID, len(hold.Records), hold.Reason)
+	return hold, nil
+}
+
+// Release lifts an active hold, recording who lifted it and why
+func Release(ctx context.Context, id, by, reason string) (Hold, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	event, err := attributevalue.Marshal([]Event{{Action: ActionReleased, By: by, At: now, Reason: reason}})
+	if err != nil {
+		return Hold{}, err
+	}
+
+	updateCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.UpdateItem(updateCtx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET #status = :released, ReleasedBy = :by, ReleasedAt = :now, History = list_append(History, :event)"),
+		ConditionExpression: aws.String("#status = :active"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":released": &types.AttributeValueMemberS{Value: StatusReleased},
+			":active":   &types.AttributeValueMemberS{Value: StatusActive},
+			":by":       &types.AttributeValueMemberS{Value: by},
+			":now":      &types.AttributeValueMemberS{Value: now},
+			":event":    event,
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			if _, getErr := Get(ctx, id); getErr != nil {
+				return Hold{}, getErr
+			}
+			return Hold{}, ErrAlreadyReleased
+		}
+		return Hold{}, err
+	}
+
+	var hold Hold
+	if err := attributevalue.UnmarshalMap(result.Attributes, &hold); err != nil {
+		return Hold{}, err
+	}
+	log.Printf("Legal hold %s released by %q: %s", id, by, reason)
+	return hold, nil
+}
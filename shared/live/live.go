@@ -0,0 +1,174 @@
+// Package live pushes server-sent events to connected clients, such as the
+// dashboard metrics shown on the clinic's wall-mounted displays.
+package live
+
+import (
+	"dental-saas/shared/config"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// heartbeat keeps idle connections from being closed by proxies
+const heartbeat = 25 * time.Second
+
+var (
+	// Metrics carries the live dashboard counters
+	Metrics = NewChannel("metrics")
+	// Queue carries the day's patient queue of the reception displays
+	Queue = NewChannel("queue")
+)
+
+// Channel is a kind of event, sent under its name, with a hub per clinic so
+// displays only receive the events of their own clinic
+type Channel struct {
+	name    string
+	mu      sync.Mutex
+	hubs    map[string]*Hub
+	changed chan struct{}
+}
+
+// NewChannel creates a channel whose events are sent under the given event name
+func NewChannel(name string) *Channel {
+	return &Channel{
+		name:    name,
+		hubs:    make(map[string]*Hub),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Hub returns the hub of a clinic
+func (c *Channel) Hub(clinicID string) *Hub {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hub, ok := c.hubs[clinicID]
+	if !ok {
+		hub = &Hub{subs: make(map[chan []byte]struct{})}
+		c.hubs[clinicID] = hub
+	}
+	return hub
+}
+
+// Watched returns the clinics with connected clients
+func (c *Channel) Watched() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var clinics []string
+	for clinicID, hub := range c.hubs {
+		if hub.Subscribers() > 0 {
+			clinics = append(clinics, clinicID)
+		}
+	}
+	return clinics
+}
+
+// Touch signals that the data behind the channel changed. It never blocks
+// and signals sent while a previous one is pending are merged.
+func (c *Channel) Touch() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Changed receives the signals sent by Touch
+func (c *Channel) Changed() <-chan struct{} {
+	return c.changed
+}
+
+// Hub fans the events of a clinic out to its subscribers and replays the
+// last event to clients that connect later
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+	last []byte
+}
+
+// Subscribe registers a client; the returned function unregisters it
+func (h *Hub) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, 1)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	if h.last != nil {
+		ch <- h.last
+	}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Subscribers returns how many clients are connected
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Publish sends v to every subscriber. A client that has not read the
+// previous event yet only gets the newest one, so a slow display never
+// holds the others back.
+func (h *Hub) Publish(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = data
+	for ch := range h.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- data
+	}
+	return nil
+}
+
+// ServeHTTP streams the events of the request's clinic to the client until
+// it disconnects
+func (c *Channel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := c.Hub(config.ClinicID(r.Context())).Subscribe()
+	defer unsubscribe()
+	// Whoever publishes may have stopped while nobody was watching
+	c.Touch()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-events:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", c.name, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
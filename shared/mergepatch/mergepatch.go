@@ -0,0 +1,86 @@
+// Package mergepatch applies JSON Merge Patch documents (RFC 7386) to the
+// records of the API: members of the patch replace those of the record,
+// objects are merged member by member and null removes a member, clearing
+// the field it holds.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// ContentType is the media type of JSON Merge Patch documents
+const ContentType = "application/merge-patch+json"
+
+// ErrInvalidPatch is returned for patches that are not a JSON object or that
+// give a field a value of the wrong type; the error message says why
+var ErrInvalidPatch = errors.New("invalid merge patch")
+
+// Accepts reports whether a request body is a merge patch: sent as
+// ContentType, as plain JSON or without a content type
+func Accepts(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == ContentType || mediaType == "application/json")
+}
+
+// Apply returns a copy of v with the patch applied. v goes through its JSON
+// representation, so only fields serialized to JSON can be patched.
+func Apply[T any](v T, patch []byte) (T, error) {
+	var zero T
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return zero, fmt.Errorf("%w: body is not valid JSON", ErrInvalidPatch)
+	}
+	if _, ok := changes.(map[string]interface{}); !ok {
+		return zero, fmt.Errorf("%w: body must be a JSON object", ErrInvalidPatch)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return zero, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return zero, err
+	}
+	if data, err = json.Marshal(merge(doc, changes)); err != nil {
+		return zero, err
+	}
+
+	var patched T
+	if err := json.Unmarshal(data, &patched); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return zero, fmt.Errorf("%w: %s must be of type %s", ErrInvalidPatch, typeErr.Field, typeErr.Type)
+		}
+		return zero, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return patched, nil
+}
+
+// merge is the MergePatch function of RFC 7386
+func merge(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = make(map[string]interface{})
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(doc, name)
+			continue
+		}
+		doc[name] = merge(doc[name], value)
+	}
+	return doc
+}
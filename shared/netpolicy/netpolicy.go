@@ -0,0 +1,224 @@
+package netpolicy
+
+import (
+	"context"
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/cache"
+	"dental-saas/shared/config"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableName is the table holding the network policy of each clinic
+const TableName = "NetworkPolicies"
+
+// cacheTTL bounds how long a policy change takes to reach every instance
+const cacheTTL = time.Minute
+
+// Policy restricts the staff endpoints of a clinic to some networks and,
+// optionally, countries. An empty AllowedCIDRs or AllowedCountries list does
+// not restrict on that criterion.
+type Policy struct {
+	ClinicID         string   `json:"clinic_id"`
+	Enabled          bool     `json:"enabled"`
+	AllowedCIDRs     []string `json:"allowed_cidrs"`
+	AllowedCountries []string `json:"allowed_countries"` // ISO 3166-1 alpha-2, e.g. BR
+	UpdatedAt        string   `json:"updated_at,omitempty"`
+}
+
+// IsValid checks the CIDRs and country codes of the policy, normalizing
+// single addresses to host networks and countries to upper case
+func (p *Policy) IsValid() error {
+	for i, cidr := range p.AllowedCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return fmt.Errorf("invalid network %q", cidr)
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid network %q", cidr)
+		}
+		p.AllowedCIDRs[i] = cidr
+	}
+	for i, country := range p.AllowedCountries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) != 2 {
+			return fmt.Errorf("invalid country code %q", country)
+		}
+		p.AllowedCountries[i] = country
+	}
+	if len(p.AllowedCountries) > 0 && countryHeader() == "" {
+		return fmt.Errorf("country restrictions require GEO_COUNTRY_HEADER to be configured")
+	}
+	if p.Enabled && len(p.AllowedCIDRs) == 0 && len(p.AllowedCountries) == 0 {
+		return fmt.Errorf("an enabled policy needs allowed networks or countries")
+	}
+	return nil
+}
+
+// Allows reports whether a request may reach the staff endpoints, with the
+// reason when it may not
+func (p *Policy) Allows(r *http.Request) (bool, string) {
+	if !p.Enabled {
+		return true, ""
+	}
+	if len(p.AllowedCIDRs) > 0 {
+		ip := net.ParseIP(ClientIP(r))
+		allowed := false
+		for _, cidr := range p.AllowedCIDRs {
+			if _, network, err := net.ParseCIDR(cidr); err == nil && ip != nil && network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, "network not allowed"
+		}
+	}
+	if len(p.AllowedCountries) > 0 {
+		country := strings.ToUpper(r.Header.Get(countryHeader()))
+		allowed := false
+		for _, c := range p.AllowedCountries {
+			if c == country {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, "country not allowed"
+		}
+	}
+	return true, ""
+}
+
+// ClientIP returns the address of the client. Behind a load balancer, set
+// TRUST_FORWARDED_FOR=true to use the last X-Forwarded-For entry, the one
+// appended by the balancer itself and therefore not forgeable by the client.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_FORWARDED_FOR") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// countryHeader is the header in which the CDN or load balancer reports the
+// client's country (e.g. CloudFront-Viewer-Country or CF-IPCountry)
+func countryHeader() string {
+	return os.Getenv("GEO_COUNTRY_HEADER")
+}
+
+// Get returns the network policy of a clinic, disabled when none was configured
+func Get(ctx context.Context, clinicID string) (Policy, error) {
+	key := cacheKey(clinicID)
+	if v, ok := cache.Default.Get(key); ok {
+		return v.(Policy), nil
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	if err != nil {
+		return Policy{}, err
+	}
+	policy := Policy{ClinicID: clinicID}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &policy); err != nil {
+			return Policy{}, err
+		}
+	}
+	if policy.AllowedCIDRs == nil {
+		policy.AllowedCIDRs = []string{}
+	}
+	if policy.AllowedCountries == nil {
+		policy.AllowedCountries = []string{}
+	}
+
+	cache.Default.Set(key, policy, cacheTTL)
+	return policy, nil
+}
+
+// Save stores the network policy of a clinic
+func Save(ctx context.Context, policy Policy) (Policy, error) {
+	if err := policy.IsValid(); err != nil {
+		return Policy{}, err
+	}
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(policy)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	putCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	if _, err := config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName: aws.String(TableName),
+		Item:      item,
+	}); err != nil {
+		return Policy{}, err
+	}
+	cache.Default.Delete(cacheKey(policy.ClinicID))
+	return policy, nil
+}
+
+// Middleware enforces the network policy of the request's clinic on every request except
+// those exempt reports as public (health checks, patient-facing links...)
+func Middleware(exempt func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			policy, err := Get(r.Context(), config.ClinicID(r.Context()))
+			if err != nil {
+				// Fail closed: an unknown policy may be restricting this client
+				http.Error(w, "Network policy unavailable", http.StatusServiceUnavailable)
+				log.Printf("Error loading network policy: %v", err)
+				return
+			}
+			if ok, reason := policy.Allows(r); !ok {
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeNetworkNotAllowed, "Access from this network is not allowed", nil)
+				log.Printf("Blocked %s %s from %s: %s", r.Method, r.URL.Path, ClientIP(r), reason)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func cacheKey(clinicID string) string {
+	return "netpolicy:" + clinicID
+}
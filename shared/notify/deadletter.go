@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DeadLetterTable holds the queued notifications that could not be delivered
+const DeadLetterTable = "NotificationDeadLetters"
+
+// ErrDeadLetterNotFound is returned for unknown dead letters
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a queued notification that ran out of delivery attempts,
+// with the error of the last one
+type DeadLetter struct {
+	ID       string  `json:"id"`
+	Message  Message `json:"message"`
+	Attempts int     `json:"attempts"`
+	Error    string  `json:"error"`
+	FailedAt string  `json:"failed_at"`
+}
+
+func saveDeadLetter(ctx context.Context, delivery Delivery, cause error) error {
+	item, err := attributevalue.MarshalMap(DeadLetter{
+		ID:       delivery.ID,
+		Message:  delivery.Message,
+		Attempts: delivery.Attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	// Each clinic's admins see the dead letters of their own messages
+	if delivery.Message.ClinicID != "" {
+		ctx = config.WithClinic(ctx, delivery.Message.ClinicID)
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(DeadLetterTable),
+		Item:      item,
+	})
+	return err
+}
+
+// DeadLetters reads a page of the dead letters of the clinic of ctx
+func DeadLetters(ctx context.Context, page paging.Page) ([]DeadLetter, string, error) {
+	return paging.Scan[DeadLetter](ctx, &dynamodb.ScanInput{
+		TableName: aws.String(DeadLetterTable),
+	}, page)
+}
+
+// RetryDeadLetter sends a dead letter again, through the queue when one is
+// configured, and removes it from the dead letters
+func RetryDeadLetter(ctx context.Context, id string) error {
+	getCtx, cancel := config.DBContext(ctx)
+	result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+		TableName:      aws.String(DeadLetterTable),
+		Key:            deadLetterKey(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+	if result.Item == nil {
+		return ErrDeadLetterNotFound
+	}
+	var letter DeadLetter
+	if err := attributevalue.UnmarshalMap(result.Item, &letter); err != nil {
+		return err
+	}
+
+	if err := Send(ctx, letter.Message); err != nil {
+		return err
+	}
+	return DeleteDeadLetter(ctx, id)
+}
+
+// DeleteDeadLetter discards a dead letter
+func DeleteDeadLetter(ctx context.Context, id string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(DeadLetterTable),
+		Key:                 deadLetterKey(id),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrDeadLetterNotFound
+	}
+	return err
+}
+
+func deadLetterKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ID": &types.AttributeValueMemberS{Value: id},
+	}
+}
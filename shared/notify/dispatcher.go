@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/health"
+	"log"
+	"time"
+)
+
+// dispatchBatch is how many messages the dispatcher receives at a time
+const dispatchBatch = 10
+
+// StartDispatcher delivers the messages of the queue configured in the
+// environment, if any, until ctx is done. A failed delivery is retried once
+// its visibility timeout (NOTIFY_VISIBILITY_TIMEOUT) expires, or, in the
+// outbox, after a wait that doubles with every failure; after
+// NOTIFY_MAX_ATTEMPTS it is moved to the dead letters.
+func StartDispatcher(ctx context.Context) {
+	queue, err := defaultQueue()
+	if err != nil {
+		log.Printf("Error configuring notification queue, notifications will fail: %v", err)
+		return
+	}
+	if queue == nil {
+		return
+	}
+	if _, err := NewNotifierFromEnv(); err != nil {
+		log.Printf("Error configuring notifier, queued notifications will be dead-lettered: %v", err)
+	}
+	if q, ok := queue.(*MemoryQueue); ok {
+		health.RegisterBacklog("notifications", q.Len, config.EnvInt("NOTIFY_BACKLOG_LIMIT", 1000))
+	}
+
+	visibility := config.EnvDuration("NOTIFY_VISIBILITY_TIMEOUT", 30*time.Second)
+	maxAttempts := config.EnvInt("NOTIFY_MAX_ATTEMPTS", 5)
+
+	if q, ok := queue.(*OutboxQueue); ok && q.Retention > 0 {
+		go pruneOutbox(ctx, q)
+	}
+
+	go func() {
+		for {
+			deliveries, err := queue.Receive(ctx, dispatchBatch, visibility)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving notifications: %v", err)
+			}
+			for _, delivery := range deliveries {
+				dispatch(ctx, queue, delivery, maxAttempts, visibility)
+			}
+			if len(deliveries) == 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}
+	}()
+}
+
+// dispatch delivers a message received from the queue. Delivered messages
+// are acknowledged; failed ones are left for the visibility timeout to
+// return them to the queue, until they run out of attempts and are
+// dead-lettered. Queues that record failures, such as the outbox, are told
+// of each one.
+func dispatch(ctx context.Context, queue Queue, delivery Delivery, maxAttempts int, visibility time.Duration) {
+	err := deliver(ctx, delivery.Message)
+	if err != nil {
+		recorder, records := queue.(recorder)
+		if delivery.Attempts < maxAttempts {
+			log.Printf("Error delivering notification %s (attempt %d of %d), retrying: %v", delivery.ID, delivery.Attempts, maxAttempts, err)
+			if records {
+				if err := recorder.Retry(ctx, delivery, err, time.Now().Add(retryDelay(visibility, delivery.Attempts))); err != nil {
+					log.Printf("Error recording failed attempt of notification %s: %v", delivery.ID, err)
+				}
+			}
+			return
+		}
+		if err := saveDeadLetter(ctx, delivery, err); err != nil {
+			log.Printf("Error dead-lettering notification %s: %v", delivery.ID, err)
+			return
+		}
+		log.Printf("Notification %s failed %d times and was dead-lettered: %v", delivery.ID, delivery.Attempts, err)
+		if records {
+			if err := recorder.Fail(ctx, delivery, err); err != nil {
+				log.Printf("Error marking notification %s as failed: %v", delivery.ID, err)
+			}
+			return
+		}
+	}
+	if err := queue.Ack(ctx, delivery); err != nil {
+		log.Printf("Error removing notification %s from the queue: %v", delivery.ID, err)
+	}
+}
+
+// pruneOutbox removes the outbox messages sent before its retention period,
+// once a day until ctx is done
+func pruneOutbox(ctx context.Context, q *OutboxQueue) {
+	for {
+		n, err := q.Prune(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Error pruning the notification outbox: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d sent notifications from the outbox", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(24 * time.Hour):
+		}
+	}
+}
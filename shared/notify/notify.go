@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a notification addressed to a patient or staff member
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Link    string `json:"link,omitempty"`
+	Kind    string `json:"kind"`
+	Channel string `json:"channel,omitempty"` // email, sms or whatsapp, the channel the text was written for
+	// ClinicID is the clinic sending the message, which decides whether it
+	// is delivered: the notifications of sandbox clinics are only recorded
+	ClinicID string `json:"clinic_id,omitempty"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewNotifierFromEnv returns the notifier selected by the NOTIFY_PROVIDER
+// environment variable: "log" by default, "webhook", which posts every
+// message as JSON to NOTIFY_WEBHOOK_URL, or "smtp" and "ses", which deliver
+// emails from NOTIFY_FROM through an SMTP server or Amazon SES
+func NewNotifierFromEnv() (Notifier, error) {
+	switch os.Getenv("NOTIFY_PROVIDER") {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "webhook":
+		url := os.Getenv("NOTIFY_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL is required for the webhook notifier")
+		}
+		return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "smtp":
+		return NewSMTPNotifier(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("NOTIFY_FROM"))
+	case "ses":
+		return NewSESNotifier(os.Getenv("NOTIFY_FROM"), os.Getenv("NOTIFY_SES_REGION"), os.Getenv("NOTIFY_SES_ENDPOINT"), os.Getenv("NOTIFY_SES_CONFIGURATION_SET"))
+	default:
+		return nil, fmt.Errorf("unknown notification provider %q", os.Getenv("NOTIFY_PROVIDER"))
+	}
+}
+
+// NewTextNotifierFromEnv returns the notifier selected by SMS_PROVIDER for
+// SMS and WhatsApp messages: "log", or "twilio", which sends them through the
+// Twilio account in TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN. Without
+// SMS_PROVIDER it returns nil and those messages go to NOTIFY_PROVIDER too.
+func NewTextNotifierFromEnv() (Notifier, error) {
+	switch os.Getenv("SMS_PROVIDER") {
+	case "":
+		return nil, nil
+	case "log":
+		return LogNotifier{}, nil
+	case "twilio":
+		return NewTwilioNotifier(os.Getenv("TWILIO_ACCOUNT_SID"), os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_FROM"), os.Getenv("TWILIO_WHATSAPP_FROM"))
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", os.Getenv("SMS_PROVIDER"))
+	}
+}
+
+var (
+	defaultNotifier     Notifier
+	defaultNotifierErr  error
+	defaultNotifierOnce sync.Once
+
+	textNotifier     Notifier
+	textNotifierErr  error
+	textNotifierOnce sync.Once
+)
+
+// Send delivers a message through the notifier configured in the
+// environment. With a queue configured (NOTIFY_QUEUE), the message is only
+// enqueued and the dispatcher delivers it, retrying failed deliveries.
+// Messages of sandbox clinics are recorded in SandboxTable instead.
+func Send(ctx context.Context, msg Message) error {
+	clinicID := msg.ClinicID
+	if clinicID == "" {
+		clinicID = config.ClinicID(ctx)
+	}
+	sandbox, err := config.SandboxClinic(ctx, clinicID)
+	if err != nil {
+		return err
+	}
+	if sandbox {
+		return recordSandbox(ctx, clinicID, msg)
+	}
+
+	queue, err := defaultQueue()
+	if err != nil {
+		return err
+	}
+	if queue != nil {
+		msg.ClinicID = clinicID
+		return queue.Enqueue(ctx, msg)
+	}
+	return deliver(ctx, msg)
+}
+
+// deliver sends a message through the notifier configured in the
+// environment: SMS_PROVIDER for SMS and WhatsApp when set, NOTIFY_PROVIDER
+// otherwise
+func deliver(ctx context.Context, msg Message) error {
+	if msg.Channel == ChannelSMS || msg.Channel == ChannelWhatsApp {
+		textNotifierOnce.Do(func() {
+			textNotifier, textNotifierErr = NewTextNotifierFromEnv()
+		})
+		if textNotifierErr != nil {
+			return textNotifierErr
+		}
+		if textNotifier != nil {
+			return textNotifier.Send(ctx, msg)
+		}
+	}
+	defaultNotifierOnce.Do(func() {
+		defaultNotifier, defaultNotifierErr = NewNotifierFromEnv()
+	})
+	if defaultNotifierErr != nil {
+		return defaultNotifierErr
+	}
+	return defaultNotifier.Send(ctx, msg)
+}
+
+// LogNotifier only logs messages, for development and clinics without a
+// delivery provider
+type LogNotifier struct{}
+
+// Send logs the message
+func (LogNotifier) Send(_ context.Context, msg Message) error {
+	log.Printf("Notification %s to %s: %s %s", msg.Kind, msg.To, msg.Subject, msg.Link)
+	return nil
+}
+
+// WebhookNotifier posts messages to an HTTP endpoint that handles delivery
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send posts the message as JSON
+func (n *WebhookNotifier) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// OutboxTable holds the notifications of the outbox queue with their
+// delivery status. It is keyed by ClinicID and a time-ordered ID, and kept in
+// the region of each clinic.
+const OutboxTable = "NotificationOutbox"
+
+// Delivery status of the outbox messages
+const (
+	OutboxPending = "pending" // waiting for its first or next attempt
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed" // ran out of attempts, also kept in the dead letters
+)
+
+// OutboxStatuses lists the delivery statuses
+var OutboxStatuses = []string{OutboxPending, OutboxSent, OutboxFailed}
+
+// maxRetryDelay bounds the wait before another attempt of an outbox message
+const maxRetryDelay = time.Hour
+
+// OutboxMessage is a notification of the outbox with its delivery status
+type OutboxMessage struct {
+	ClinicID  string  `json:"clinic_id"`
+	ID        string  `json:"id"`
+	Message   Message `json:"message"`
+	Status    string  `json:"status"`
+	Attempts  int     `json:"attempts"`
+	VisibleAt string  `json:"next_attempt_at,omitempty" dynamodbav:",omitempty"` // while pending
+	LastError string  `json:"last_error,omitempty" dynamodbav:",omitempty"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+	SentAt    string  `json:"sent_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// OutboxQueue is a queue kept in OutboxTable. Unlike the other queues it
+// keeps every message after delivery, with its status, attempts and the
+// error of the last failed one, and failed attempts wait longer before each
+// retry. Sent messages are removed after Retention.
+type OutboxQueue struct {
+	Retention time.Duration // sent messages are kept forever when zero
+}
+
+// recorder is implemented by queues that keep the outcome of failed
+// deliveries, which the dispatcher reports to them
+type recorder interface {
+	// Retry records a failed attempt, the message being retried at at
+	Retry(ctx context.Context, delivery Delivery, cause error, at time.Time) error
+	// Fail records the last failed attempt, in place of acknowledging it
+	Fail(ctx context.Context, delivery Delivery, cause error) error
+}
+
+// Enqueue stores a message as pending
+func (q *OutboxQueue) Enqueue(ctx context.Context, msg Message) error {
+	now := time.Now()
+	clinicID := msg.ClinicID
+	if clinicID == "" {
+		clinicID = config.DefaultClinicID
+	}
+	item, err := attributevalue.MarshalMap(OutboxMessage{
+		ClinicID:  clinicID,
+		ID:        config.ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		Message:   msg,
+		Status:    OutboxPending,
+		VisibleAt: now.UTC().Format(time.RFC3339),
+		CreatedAt: now.UTC().Format(time.RFC3339),
+		UpdatedAt: now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, clinicID))
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(OutboxTable),
+		Item:      item,
+	})
+	return err
+}
+
+// Receive claims up to max pending messages whose next attempt is due,
+// hiding them for visibility. A message claimed by another instance first is
+// skipped. The outbox of every region is read in turn.
+func (q *OutboxQueue) Receive(ctx context.Context, max int, visibility time.Duration) ([]Delivery, error) {
+	now := time.Now().UTC()
+	var deliveries []Delivery
+	err := config.EachRegion(ctx, func(ctx context.Context) error {
+		if len(deliveries) == max {
+			return nil
+		}
+		received, err := q.receive(ctx, max-len(deliveries), now, visibility)
+		deliveries = append(deliveries, received...)
+		return err
+	})
+	return deliveries, err
+}
+
+// receive claims the due messages of the region of ctx
+func (q *OutboxQueue) receive(ctx context.Context, max int, now time.Time, visibility time.Duration) ([]Delivery, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(OutboxTable),
+		FilterExpression:         aws.String("#status = :pending AND VisibleAt <= :now"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: OutboxPending},
+			":now":     &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		},
+	}
+
+	var deliveries []Delivery
+	for {
+		scanCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(scanCtx, input)
+		cancel()
+		if err != nil {
+			return deliveries, fmt.Errorf("scanning the notification outbox: %v", err)
+		}
+		var due []OutboxMessage
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &due); err != nil {
+			return deliveries, err
+		}
+		for _, m := range due {
+			if len(deliveries) == max {
+				return deliveries, nil
+			}
+			claimed, err := q.claim(ctx, m, now.Add(visibility))
+			if err != nil {
+				log.Printf("Error claiming outbox notification %s: %v", m.ID, err)
+				continue
+			}
+			if claimed != nil {
+				deliveries = append(deliveries, Delivery{ID: claimed.ID, Message: claimed.Message, Attempts: claimed.Attempts, receipt: claimed.ClinicID})
+			}
+		}
+		if result.LastEvaluatedKey == nil {
+			return deliveries, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// claim hides a due message until hiddenUntil and counts the attempt,
+// returning nil when another instance claimed it first
+func (q *OutboxQueue) claim(ctx context.Context, m OutboxMessage, hiddenUntil time.Time) (*OutboxMessage, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	result, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(OutboxTable),
+		Key:                      outboxKey(m.ClinicID, m.ID),
+		UpdateExpression:         aws.String("SET VisibleAt = :hidden, Attempts = Attempts + :one, UpdatedAt = :now"),
+		ConditionExpression:      aws.String("#status = :pending AND VisibleAt = :seen"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hidden":  &types.AttributeValueMemberS{Value: hiddenUntil.Format(time.RFC3339)},
+			":one":     &types.AttributeValueMemberN{Value: "1"},
+			":now":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":pending": &types.AttributeValueMemberS{Value: OutboxPending},
+			":seen":    &types.AttributeValueMemberS{Value: m.VisibleAt},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var claimed OutboxMessage
+	if err := attributevalue.UnmarshalMap(result.Attributes, &claimed); err != nil {
+		return nil, err
+	}
+	return &claimed, nil
+}
+
+// Ack marks a delivered message as sent
+func (q *OutboxQueue) Ack(ctx context.Context, delivery Delivery) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return q.settle(ctx, delivery, "SET #status = :status, SentAt = :now, UpdatedAt = :now REMOVE VisibleAt", map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: OutboxSent},
+		":now":    &types.AttributeValueMemberS{Value: now},
+	})
+}
+
+// Retry records a failed attempt and when the message is tried again
+func (q *OutboxQueue) Retry(ctx context.Context, delivery Delivery, cause error, at time.Time) error {
+	return q.settle(ctx, delivery, "SET VisibleAt = :at, LastError = :error, UpdatedAt = :now", map[string]types.AttributeValue{
+		":at":    &types.AttributeValueMemberS{Value: at.UTC().Format(time.RFC3339)},
+		":error": &types.AttributeValueMemberS{Value: cause.Error()},
+		":now":   &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	})
+}
+
+// Fail marks a message that ran out of attempts as failed
+func (q *OutboxQueue) Fail(ctx context.Context, delivery Delivery, cause error) error {
+	return q.settle(ctx, delivery, "SET #status = :status, LastError = :error, UpdatedAt = :now REMOVE VisibleAt", map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: OutboxFailed},
+		":error":  &types.AttributeValueMemberS{Value: cause.Error()},
+		":now":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	})
+}
+
+// settle updates a message still pending, in the region of its clinic. One
+// already settled, by an instance that claimed it again after its visibility
+// expired, is left as is.
+func (q *OutboxQueue) settle(ctx context.Context, delivery Delivery, update string, values map[string]types.AttributeValue) error {
+	values[":pending"] = &types.AttributeValueMemberS{Value: OutboxPending}
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, delivery.receipt))
+	defer cancel()
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(OutboxTable),
+		Key:                       outboxKey(delivery.receipt, delivery.ID),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("#status = :pending"),
+		ExpressionAttributeNames:  map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: values,
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return nil
+	}
+	return err
+}
+
+// Prune removes the messages sent before the retention period from the
+// outbox of every region, returning how many were removed
+func (q *OutboxQueue) Prune(ctx context.Context) (int, error) {
+	if q.Retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-q.Retention).UTC().Format(time.RFC3339)
+	removed := 0
+	err := config.EachRegion(ctx, func(ctx context.Context) error {
+		n, err := q.prune(ctx, cutoff)
+		removed += n
+		return err
+	})
+	return removed, err
+}
+
+// prune removes the messages of the region of ctx sent before cutoff
+func (q *OutboxQueue) prune(ctx context.Context, cutoff string) (int, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(OutboxTable),
+		FilterExpression:         aws.String("#status = :sent AND SentAt < :cutoff"),
+		ProjectionExpression:     aws.String("ClinicID, ID"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sent":   &types.AttributeValueMemberS{Value: OutboxSent},
+			":cutoff": &types.AttributeValueMemberS{Value: cutoff},
+		},
+	}
+
+	removed := 0
+	for {
+		scanCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(scanCtx, input)
+		cancel()
+		if err != nil {
+			return removed, fmt.Errorf("scanning sent outbox notifications: %v", err)
+		}
+		for _, item := range result.Items {
+			deleteCtx, cancel := config.DBContext(ctx)
+			_, err := config.DBClient.DeleteItem(deleteCtx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(OutboxTable),
+				Key:       map[string]types.AttributeValue{"ClinicID": item["ClinicID"], "ID": item["ID"]},
+			})
+			cancel()
+			if err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if result.LastEvaluatedKey == nil {
+			return removed, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// OutboxMessages reads a page of a clinic's outbox, the latest first,
+// optionally only the messages in status
+func OutboxMessages(ctx context.Context, clinicID, status string, page paging.Page) ([]OutboxMessage, string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(OutboxTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	if status != "" {
+		input.FilterExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+	return paging.Query[OutboxMessage](ctx, input, page)
+}
+
+// retryDelay is the wait before another attempt of a message that failed
+// attempts times: the visibility timeout, doubled after every failure, up
+// to maxRetryDelay
+func retryDelay(visibility time.Duration, attempts int) time.Duration {
+	delay := visibility
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func outboxKey(clinicID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		"ID":       &types.AttributeValueMemberS{Value: id},
+	}
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Queue holds notifications until the dispatcher delivers them. A message
+// received from the queue is hidden from other receivers for the visibility
+// timeout; unless it is acknowledged by then, it becomes visible again and
+// its delivery is retried.
+type Queue interface {
+	Enqueue(ctx context.Context, msg Message) error
+	Receive(ctx context.Context, max int, visibility time.Duration) ([]Delivery, error)
+	Ack(ctx context.Context, delivery Delivery) error
+}
+
+// Delivery is a message received from a queue. Attempts counts the times it
+// was received, this one included.
+type Delivery struct {
+	ID       string
+	Message  Message
+	Attempts int
+	receipt  string
+}
+
+// NewQueueFromEnv returns the queue selected by the NOTIFY_QUEUE environment
+// variable: none by default, so messages are delivered as they are sent,
+// "memory" for development, "sqs", the queue at NOTIFY_SQS_QUEUE_URL, or
+// "outbox", which keeps every message with its delivery status in OutboxTable
+func NewQueueFromEnv() (Queue, error) {
+	switch os.Getenv("NOTIFY_QUEUE") {
+	case "", "none":
+		return nil, nil
+	case "memory":
+		return &MemoryQueue{}, nil
+	case "sqs":
+		url := os.Getenv("NOTIFY_SQS_QUEUE_URL")
+		if url == "" {
+			return nil, fmt.Errorf("NOTIFY_SQS_QUEUE_URL is required for the sqs queue")
+		}
+		return NewSQSQueue(url, os.Getenv("NOTIFY_SQS_REGION"))
+	case "outbox":
+		return &OutboxQueue{Retention: config.EnvDuration("NOTIFY_OUTBOX_RETENTION", 30*24*time.Hour)}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification queue %q", os.Getenv("NOTIFY_QUEUE"))
+	}
+}
+
+var (
+	queue     Queue
+	queueErr  error
+	queueOnce sync.Once
+)
+
+// defaultQueue returns the queue configured in the environment, nil for none
+func defaultQueue() (Queue, error) {
+	queueOnce.Do(func() {
+		queue, queueErr = NewQueueFromEnv()
+	})
+	return queue, queueErr
+}
+
+// MemoryQueue is a queue held in the memory of the instance, for
+// development: its messages are lost on restart and are not shared between
+// instances
+type MemoryQueue struct {
+	mu       sync.Mutex
+	messages []*memoryMessage
+}
+
+type memoryMessage struct {
+	id        string
+	msg       Message
+	receives  int
+	visibleAt time.Time
+}
+
+// Enqueue adds a message to the queue
+func (q *MemoryQueue) Enqueue(_ context.Context, msg Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.messages = append(q.messages, &memoryMessage{id: uuid.NewString(), msg: msg})
+	return nil
+}
+
+// Receive returns up to max visible messages, hiding them for visibility
+func (q *MemoryQueue) Receive(_ context.Context, max int, visibility time.Duration) ([]Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var deliveries []Delivery
+	for _, m := range q.messages {
+		if len(deliveries) == max {
+			break
+		}
+		if m.visibleAt.After(now) {
+			continue
+		}
+		m.receives++
+		m.visibleAt = now.Add(visibility)
+		deliveries = append(deliveries, Delivery{ID: m.id, Message: m.msg, Attempts: m.receives, receipt: m.id})
+	}
+	return deliveries, nil
+}
+
+// Ack removes a delivered message from the queue
+func (q *MemoryQueue) Ack(_ context.Context, delivery Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, m := range q.messages {
+		if m.id == delivery.receipt {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Len returns how many messages are waiting, hidden ones included
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// SandboxTable holds the notifications of sandbox clinics, which are
+// recorded instead of delivered. It is keyed by ClinicID and a time-ordered ID.
+const SandboxTable = "SandboxNotifications"
+
+// sandboxMark prefixes the subject of recorded notifications, so they cannot
+// be mistaken for delivered ones when shown or forwarded
+const sandboxMark = "[SANDBOX] "
+
+// SandboxNotification is a notification a sandbox clinic would have sent
+type SandboxNotification struct {
+	ClinicID  string  `json:"clinic_id"`
+	ID        string  `json:"id"`
+	Message   Message `json:"message"`
+	Sandbox   bool    `json:"sandbox"` // always true, so stored copies carry the mark
+	CreatedAt string  `json:"created_at"`
+}
+
+// recordSandbox stores a sandbox clinic's message in place of delivering it
+func recordSandbox(ctx context.Context, clinicID string, msg Message) error {
+	now := time.Now()
+	msg.ClinicID = clinicID
+	msg.Subject = sandboxMark + msg.Subject
+	item, err := attributevalue.MarshalMap(SandboxNotification{
+		ClinicID:  clinicID,
+		ID:        config.ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		Message:   msg,
+		Sandbox:   true,
+		CreatedAt: now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	putCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+	if _, err := config.DBClient.PutItem(putCtx, &dynamodb.PutItemInput{
+		TableName: aws.String(SandboxTable),
+		Item:      item,
+	}); err != nil {
+		return err
+	}
+	log.Printf("Sandbox clinic %s: notification %s to %s recorded, not delivered", clinicID, msg.Kind, msg.To)
+	return nil
+}
+
+// SandboxNotifications reads a page of the notifications a sandbox clinic
+// would have sent, the latest first
+func SandboxNotifications(ctx context.Context, clinicID string, page paging.Page) ([]SandboxNotification, string, error) {
+	return paging.Query[SandboxNotification](ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(SandboxTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}, page)
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// SESNotifier delivers email messages through Amazon SES, with the SES v2
+// HTTP API and the credentials of the default AWS chain (environment,
+// shared config or instance role). It does not deliver SMS or WhatsApp.
+type SESNotifier struct {
+	From             string
+	Region           string
+	Endpoint         string
+	ConfigurationSet string // SES configuration set the emails are tracked in, if any
+	Credentials      aws.CredentialsProvider
+	Client           *http.Client
+	signer           *v4.Signer
+}
+
+// NewSESNotifier returns the notifier sending as from, a sender verified in
+// SES. The region defaults to us-east-1 and the endpoint to the SES
+// endpoint of the region.
+func NewSESNotifier(from, region, endpoint, configurationSet string) (*SESNotifier, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %v", from, err)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = "https://email." + region + ".amazonaws.com"
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SES endpoint %q", endpoint)
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration for SES: %v", err)
+	}
+	return &SESNotifier{
+		From:             from,
+		Region:           region,
+		Endpoint:         strings.TrimSuffix(endpoint, "/"),
+		ConfigurationSet: configurationSet,
+		Credentials:      cfg.Credentials,
+		Client:           &http.Client{Timeout: 30 * time.Second},
+		signer:           v4.NewSigner(),
+	}, nil
+}
+
+// Send delivers the message as a plain text email
+func (n *SESNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.Channel == ChannelSMS || msg.Channel == ChannelWhatsApp {
+		return fmt.Errorf("the ses notifier does not deliver %s messages", msg.Channel)
+	}
+	content := map[string]interface{}{
+		"Subject": map[string]string{"Data": msg.Subject, "Charset": "UTF-8"},
+		"Body": map[string]interface{}{
+			"Text": map[string]string{"Data": emailText(msg), "Charset": "UTF-8"},
+		},
+	}
+	input := map[string]interface{}{
+		"FromEmailAddress": n.From,
+		"Destination":      map[string][]string{"ToAddresses": {msg.To}},
+		"Content":          map[string]interface{}{"Simple": content},
+	}
+	if n.ConfigurationSet != "" {
+		input["ConfigurationSetName"] = n.ConfigurationSet
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	creds, err := n.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieving AWS credentials for SES: %v", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := n.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "ses", n.Region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("SES returned %s: %s", resp.Status, apiErr.Message)
+	}
+	return nil
+}
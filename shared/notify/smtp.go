@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPNotifier delivers email messages through an SMTP server, upgrading
+// the connection with STARTTLS when the server offers it, or over TLS from
+// the start on port 465. It does not deliver SMS or WhatsApp.
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string // no authentication when empty
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// NewSMTPNotifier returns the notifier for the server at host:port, sending
+// as from. The port defaults to 587.
+func NewSMTPNotifier(host, port, username, password, from string) (*SMTPNotifier, error) {
+	if host == "" {
+		return nil, fmt.Errorf("SMTP_HOST is required for the smtp notifier")
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %v", from, err)
+	}
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPNotifier{Host: host, Port: port, Username: username, Password: password, From: from, Timeout: 30 * time.Second}, nil
+}
+
+// Send delivers the message as a plain text email
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.Channel == ChannelSMS || msg.Channel == ChannelWhatsApp {
+		return fmt.Errorf("the smtp notifier does not deliver %s messages", msg.Channel)
+	}
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %v", n.From, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address %q: %v", msg.To, err)
+	}
+	data, err := emailMessage(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(n.Host, n.Port)
+	dialer := &net.Dialer{Timeout: n.Timeout}
+	var conn net.Conn
+	if n.Port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: n.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to SMTP server %s: %v", addr, err)
+	}
+	deadline := time.Now().Add(n.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("starting SMTP session with %s: %v", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return fmt.Errorf("starting TLS with %s: %v", addr, err)
+		}
+	}
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return fmt.Errorf("authenticating with %s: %v", addr, err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailText is the text of an email: the body, followed by the link when
+// the body does not already carry it
+func emailText(msg Message) string {
+	text := msg.Body
+	if msg.Link != "" && !strings.Contains(text, msg.Link) {
+		text += "\n\n" + msg.Link
+	}
+	return text
+}
+
+// emailMessage builds the MIME message of an email, its UTF-8 text encoded
+// as quoted-printable
+func emailMessage(from, to *mail.Address, msg Message) ([]byte, error) {
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(emailText(msg), "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "From: %s\r\n", from.String())
+	fmt.Fprintf(&data, "To: %s\r\n", to.String())
+	fmt.Fprintf(&data, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&data, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&data, "Message-ID: <%s@%s>\r\n", uuid.NewString(), domain)
+	data.WriteString("MIME-Version: 1.0\r\n")
+	data.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	data.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	data.Write(body.Bytes())
+	return data.Bytes(), nil
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// sqsWaitTime is how long a receive waits for messages (SQS long polling)
+const sqsWaitTime = 20 * time.Second
+
+// SQSQueue is an Amazon SQS queue, reached through the SQS JSON API with
+// the credentials of the default AWS chain (environment, shared config or
+// instance role). Queues of LocalStack work too.
+type SQSQueue struct {
+	URL         string
+	Region      string
+	Endpoint    string
+	Credentials aws.CredentialsProvider
+	Client      *http.Client
+	signer      *v4.Signer
+}
+
+// NewSQSQueue returns the queue at url. The region defaults to the one in
+// the queue's host name.
+func NewSQSQueue(queueURL, region string) (*SQSQueue, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q", queueURL)
+	}
+	if region == "" {
+		region = "us-east-1"
+		if parts := strings.Split(u.Host, "."); len(parts) > 2 && parts[0] == "sqs" {
+			region = parts[1]
+		}
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration for SQS: %v", err)
+	}
+	return &SQSQueue{
+		URL:         queueURL,
+		Region:      region,
+		Endpoint:    u.Scheme + "://" + u.Host + "/",
+		Credentials: cfg.Credentials,
+		Client:      &http.Client{Timeout: sqsWaitTime + 10*time.Second},
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// Enqueue sends a message to the queue
+func (q *SQSQueue) Enqueue(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return q.call(ctx, "SendMessage", map[string]interface{}{
+		"QueueUrl":    q.URL,
+		"MessageBody": string(body),
+	}, nil)
+}
+
+// Receive waits up to sqsWaitTime for messages and returns up to max of
+// them (at most 10), hidden for visibility
+func (q *SQSQueue) Receive(ctx context.Context, max int, visibility time.Duration) ([]Delivery, error) {
+	var result struct {
+		Messages []struct {
+			MessageId     string
+			ReceiptHandle string
+			Body          string
+			Attributes    map[string]string
+		}
+	}
+	err := q.call(ctx, "ReceiveMessage", map[string]interface{}{
+		"QueueUrl":                    q.URL,
+		"MaxNumberOfMessages":         min(max, 10),
+		"VisibilityTimeout":           int(visibility.Seconds()),
+		"WaitTimeSeconds":             int(sqsWaitTime.Seconds()),
+		"AttributeNames":              []string{"ApproximateReceiveCount"},
+		"MessageSystemAttributeNames": []string{"ApproximateReceiveCount"},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, 0, len(result.Messages))
+	for _, m := range result.Messages {
+		delivery := Delivery{ID: m.MessageId, receipt: m.ReceiptHandle, Attempts: 1}
+		if n, err := strconv.Atoi(m.Attributes["ApproximateReceiveCount"]); err == nil {
+			delivery.Attempts = n
+		}
+		if err := json.Unmarshal([]byte(m.Body), &delivery.Message); err != nil {
+			// Kept, so the dispatcher dead-letters it with the body it could read
+			delivery.Message = Message{Body: m.Body}
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// Ack deletes a delivered message from the queue
+func (q *SQSQueue) Ack(ctx context.Context, delivery Delivery) error {
+	return q.call(ctx, "DeleteMessage", map[string]interface{}{
+		"QueueUrl":      q.URL,
+		"ReceiptHandle": delivery.receipt,
+	}, nil)
+}
+
+// call signs and posts an action of the SQS JSON API, decoding its result
+// into out when given
+func (q *SQSQueue) call(ctx context.Context, action string, input interface{}, out interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+
+	creds, err := q.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieving AWS credentials for SQS: %v", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := q.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "sqs", q.Region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := q.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("SQS %s returned %s: %s %s", action, resp.Status, apiErr.Type, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,318 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/i18n"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TemplateTable holds the notification templates customized by each clinic
+const TemplateTable = "NotificationTemplates"
+
+// Channels a template is written for. A message goes out on the channel of
+// its recipient, sms for phone numbers and email otherwise, unless the
+// sender picks whatsapp.
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = "sms"
+	ChannelWhatsApp = "whatsapp"
+)
+
+// Channels lists the channels templates can be written for
+var Channels = []string{ChannelEmail, ChannelSMS, ChannelWhatsApp}
+
+// maxSMSBody bounds SMS and WhatsApp bodies to what carriers deliver as one
+// concatenated message
+const maxSMSBody = 1600
+
+// ErrUnknownKind is returned for notification kinds nothing registered
+var ErrUnknownKind = errors.New("unknown notification kind")
+
+// Kind is a notification the service sends, with the merge fields its
+// templates can use and the text sent when the clinic has not customized
+// it. Fields maps each merge field to the sample value previews use.
+type Kind struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Fields      map[string]string `json:"fields"`
+	Subject     string            `json:"default_subject"`
+	Body        string            `json:"default_body"`
+}
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = map[string]Kind{}
+)
+
+// RegisterKind makes a notification kind customizable; packages call it for
+// the notifications they send
+func RegisterKind(kind Kind) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	kinds[kind.Name] = kind
+}
+
+// Kinds returns the registered kinds sorted by name
+func Kinds() []Kind {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+
+	list := make([]Kind, 0, len(kinds))
+	for _, kind := range kinds {
+		list = append(list, kind)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// LookupKind returns a registered kind
+func LookupKind(name string) (Kind, error) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	kind, ok := kinds[name]
+	if !ok {
+		return Kind{}, fmt.Errorf("%w %q", ErrUnknownKind, name)
+	}
+	return kind, nil
+}
+
+// Template is the subject and body a clinic sends for a kind of
+// notification on a channel in a language. Merge fields are written as
+// {{field}}. The subject is optional for SMS, whose delivery drops it.
+type Template struct {
+	ClinicID    string `json:"clinic_id"`
+	TemplateKey string `json:"-"` // kind/channel/language, the sort key
+	Kind        string `json:"kind"`
+	Channel     string `json:"channel"`
+	Language    string `json:"language"`
+	Subject     string `json:"subject,omitempty"`
+	Body        string `json:"body"`
+	Custom      bool   `json:"custom" dynamodbav:"-"` // false for the built-in text
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// mergeField matches a merge field, e.g. {{patient_name}}
+var mergeField = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+
+// IsValid checks the kind, channel and language exist, the body is set and
+// only uses the kind's merge fields
+func (t *Template) IsValid() error {
+	kind, err := LookupKind(t.Kind)
+	if err != nil {
+		return err
+	}
+	if !validChannel(t.Channel) {
+		return fmt.Errorf("unknown channel %q, use one of %s", t.Channel, strings.Join(Channels, ", "))
+	}
+	if !i18n.IsSupported(t.Language) {
+		return fmt.Errorf("unsupported language %q, use one of %s", t.Language, strings.Join(i18n.Languages, ", "))
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return fmt.Errorf("body is required")
+	}
+	if t.Channel == ChannelEmail && strings.TrimSpace(t.Subject) == "" {
+		return fmt.Errorf("subject is required for email templates")
+	}
+	if t.Channel != ChannelEmail && len(t.Body) > maxSMSBody {
+		return fmt.Errorf("%s body must not exceed %d characters", t.Channel, maxSMSBody)
+	}
+	for _, text := range []string{t.Subject, t.Body} {
+		for _, match := range mergeField.FindAllStringSubmatch(text, -1) {
+			if _, ok := kind.Fields[match[1]]; !ok {
+				return fmt.Errorf("unknown merge field {{%s}} for %s, use %s", match[1], t.Kind, strings.Join(fieldNames(kind), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Render fills the merge fields of the template with data; fields missing
+// from data are left empty
+func (t *Template) Render(data map[string]string) (subject, body string) {
+	fill := func(text string) string {
+		return mergeField.ReplaceAllStringFunc(text, func(field string) string {
+			return data[mergeField.FindStringSubmatch(field)[1]]
+		})
+	}
+	return fill(t.Subject), fill(t.Body)
+}
+
+func validChannel(channel string) bool {
+	for _, c := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldNames(kind Kind) []string {
+	names := make([]string, 0, len(kind.Fields))
+	for name := range kind.Fields {
+		names = append(names, "{{"+name+"}}")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChannelFor returns the channel a message to a recipient goes out on by
+// default
+func ChannelFor(to string) string {
+	if to != "" && strings.Trim(to, "+0123456789 -()") == "" {
+		return ChannelSMS
+	}
+	return ChannelEmail
+}
+
+func templateKey(kind, channel, language string) string {
+	return kind + "/" + channel + "/" + language
+}
+
+// GetTemplate returns the template a clinic sends for a kind on a channel in
+// a language: the one it customized, or the built-in text
+func GetTemplate(ctx context.Context, clinicID, kind, channel, language string) (Template, error) {
+	registered, err := LookupKind(kind)
+	if err != nil {
+		return Template{}, err
+	}
+
+	getCtx, cancel := config.DBContext(ctx)
+	defer cancel()
+	result, err := config.DBClient.GetItem(getCtx, &dynamodb.GetItemInput{
+		TableName: aws.String(TemplateTable),
+		Key: map[string]types.AttributeValue{
+			"ClinicID":    &types.AttributeValueMemberS{Value: clinicID},
+			"TemplateKey": &types.AttributeValueMemberS{Value: templateKey(kind, channel, language)},
+		},
+	})
+	if err != nil {
+		return Template{}, err
+	}
+	if result.Item != nil {
+		var template Template
+		if err := attributevalue.UnmarshalMap(result.Item, &template); err != nil {
+			return Template{}, err
+		}
+		template.Custom = true
+		return template, nil
+	}
+
+	return Template{
+		ClinicID: clinicID,
+		Kind:     kind,
+		Channel:  channel,
+		Language: language,
+		Subject:  registered.Subject,
+		Body:     registered.Body,
+	}, nil
+}
+
+// ListTemplates returns the templates a clinic customized
+func ListTemplates(ctx context.Context, clinicID string) ([]Template, error) {
+	templates := []Template{}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, &dynamodb.QueryInput{
+		TableName:              aws.String(TemplateTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var items []Template
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, err
+		}
+		for i := range items {
+			items[i].Custom = true
+		}
+		templates = append(templates, items...)
+	}
+	return templates, nil
+}
+
+// SaveTemplate stores a clinic's template, replacing the built-in text
+func SaveTemplate(ctx context.Context, template Template) (Template, error) {
+	if err := template.IsValid(); err != nil {
+		return Template{}, err
+	}
+	template.TemplateKey = templateKey(template.Kind, template.Channel, template.Language)
+	template.Custom = true
+	template.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(template)
+	if err != nil {
+		return Template{}, err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(TemplateTable),
+		Item:      item,
+	})
+	return template, err
+}
+
+// DeleteTemplate removes a clinic's template, so the built-in text is sent again
+func DeleteTemplate(ctx context.Context, clinicID, kind, channel, language string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(TemplateTable),
+		Key: map[string]types.AttributeValue{
+			"ClinicID":    &types.AttributeValueMemberS{Value: clinicID},
+			"TemplateKey": &types.AttributeValueMemberS{Value: templateKey(kind, channel, language)},
+		},
+	})
+	return err
+}
+
+// Compose renders the message of a kind for a recipient from the template of
+// the clinic for the recipient's channel, in the clinic's language. When the
+// template cannot be read the built-in text is used, so a notification is
+// never lost to a failed lookup. Records without a clinic belong to the
+// default one.
+func Compose(ctx context.Context, clinicID, kind, to string, data map[string]string) (Message, error) {
+	return ComposeFor(ctx, clinicID, kind, ChannelFor(to), to, data)
+}
+
+// ComposeFor renders the message of a kind as Compose does, for a channel
+// chosen by the sender, such as whatsapp for a phone number
+func ComposeFor(ctx context.Context, clinicID, kind, channel, to string, data map[string]string) (Message, error) {
+	if clinicID == "" {
+		clinicID = config.DefaultClinicID
+	}
+	template, err := GetTemplate(ctx, clinicID, kind, channel, i18n.Default())
+	if errors.Is(err, ErrUnknownKind) {
+		return Message{}, err
+	}
+	if err != nil {
+		log.Printf("Error reading %s template of clinic %s, sending the default text: %v", kind, clinicID, err)
+		registered, _ := LookupKind(kind)
+		template = Template{Kind: kind, Channel: channel, Subject: registered.Subject, Body: registered.Body}
+	}
+
+	subject, body := template.Render(data)
+	return Message{To: to, Subject: subject, Body: body, Kind: kind, Channel: channel, ClinicID: clinicID}, nil
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TwilioNotifier delivers SMS and WhatsApp messages through the Twilio
+// Messages API. It does not deliver emails.
+type TwilioNotifier struct {
+	AccountSID   string
+	AuthToken    string
+	From         string // number SMS are sent from, in E.164 format
+	WhatsAppFrom string // WhatsApp sender number, in E.164 format
+	// CountryCode is dialed before phone numbers written without one
+	CountryCode string
+	BaseURL     string
+	Client      *http.Client
+}
+
+// NewTwilioNotifier returns the notifier of a Twilio account, sending SMS
+// from from and WhatsApp messages from whatsAppFrom; at least one is
+// required. TWILIO_API_URL overrides the API address and
+// SMS_DEFAULT_COUNTRY_CODE (default 55) completes local phone numbers.
+func NewTwilioNotifier(accountSID, authToken, from, whatsAppFrom string) (*TwilioNotifier, error) {
+	if accountSID == "" || authToken == "" {
+		return nil, fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required for the twilio notifier")
+	}
+	if from == "" && whatsAppFrom == "" {
+		return nil, fmt.Errorf("TWILIO_FROM or TWILIO_WHATSAPP_FROM is required for the twilio notifier")
+	}
+	countryCode := strings.TrimPrefix(config.EnvString("SMS_DEFAULT_COUNTRY_CODE", "55"), "+")
+	return &TwilioNotifier{
+		AccountSID:   accountSID,
+		AuthToken:    authToken,
+		From:         phoneNumber(from, countryCode),
+		WhatsAppFrom: phoneNumber(whatsAppFrom, countryCode),
+		CountryCode:  countryCode,
+		BaseURL:      strings.TrimSuffix(config.EnvString("TWILIO_API_URL", "https://api.twilio.com"), "/"),
+		Client:       &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Send delivers the message as an SMS, or on WhatsApp for the whatsapp
+// channel, with the link after the body when the body does not carry it
+func (n *TwilioNotifier) Send(ctx context.Context, msg Message) error {
+	to, from := phoneNumber(msg.To, n.CountryCode), n.From
+	switch msg.Channel {
+	case ChannelWhatsApp:
+		if n.WhatsAppFrom == "" {
+			return fmt.Errorf("TWILIO_WHATSAPP_FROM is required to send WhatsApp messages")
+		}
+		to, from = "whatsapp:"+to, "whatsapp:"+n.WhatsAppFrom
+	case ChannelSMS:
+		if n.From == "" {
+			return fmt.Errorf("TWILIO_FROM is required to send SMS")
+		}
+	default:
+		return fmt.Errorf("the twilio notifier does not deliver %s messages", msg.Channel)
+	}
+
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", from)
+	form.Set("Body", emailText(msg))
+	endpoint := n.BaseURL + "/2010-04-01/Accounts/" + url.PathEscape(n.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(n.AccountSID, n.AuthToken)
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("Twilio returned %s: %d %s", resp.Status, apiErr.Code, apiErr.Message)
+	}
+	return nil
+}
+
+// phoneNumber writes a phone number in E.164 format, dialing countryCode
+// before numbers without a leading + or 00
+func phoneNumber(phone, countryCode string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if digits == "" {
+		return ""
+	}
+	phone = strings.TrimSpace(phone)
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		return "+" + digits
+	case strings.HasPrefix(digits, "00"):
+		return "+" + digits[2:]
+	}
+	return "+" + countryCode + strings.TrimLeft(digits, "0")
+}
@@ -0,0 +1,288 @@
+package paging
+
+import (
+	"context"
+	"dental-saas/shared/budget"
+	"dental-saas/shared/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DefaultMaxItems caps list responses when LIST_MAX_ITEMS is not set
+const DefaultMaxItems = 500
+
+// NextPageHeader carries the token of the next page of a truncated list
+const NextPageHeader = "X-Next-Page-Token"
+
+// ErrInvalidPage is returned for list requests asking for a page that
+// cannot be served; the error message says why
+var ErrInvalidPage = errors.New("invalid page")
+
+// ErrInvalidToken is returned for cursors this service did not issue
+var ErrInvalidToken = fmt.Errorf("%w: unknown cursor", ErrInvalidPage)
+
+// MaxItems is the most items a list response holds. Longer lists are cut
+// and continue on the next page, so a single request scanning a whole table
+// cannot hold all of it in memory.
+func MaxItems() int {
+	if n := config.EnvInt("LIST_MAX_ITEMS", DefaultMaxItems); n > 0 {
+		return n
+	}
+	return DefaultMaxItems
+}
+
+// Page is the part of a list a request asks for
+type Page struct {
+	// Token is the cursor the page starts at, empty for the first page
+	Token string
+	// Limit is the most items returned, MaxItems when zero
+	Limit int
+	// Envelope answers with a List instead of a bare array
+	Envelope bool
+
+	err error
+}
+
+// Request reads the page a list request asks for from its cursor and limit
+// parameters. Requests using either get the List envelope; the pageToken
+// parameter of older clients is still read as the cursor.
+func Request(r *http.Request) Page {
+	query := r.URL.Query()
+	page := Page{
+		Token:    query.Get("cursor"),
+		Envelope: query.Has("cursor") || query.Has("limit"),
+	}
+	if page.Token == "" {
+		page.Token = query.Get("pageToken")
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			page.err = fmt.Errorf("%w: limit must be a positive number", ErrInvalidPage)
+		}
+		page.Limit = min(n, MaxItems())
+	}
+	return page
+}
+
+// Max returns the most items of the page
+func (p Page) Max() int {
+	if p.Limit > 0 {
+		return p.Limit
+	}
+	return MaxItems()
+}
+
+// Err returns why the page cannot be served, nil when it can
+func (p Page) Err() error {
+	return p.err
+}
+
+// List is the envelope of a page of a list. NextCursor, passed back as the
+// cursor parameter, continues the list and is absent on the last page.
+type List[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Scan reads at most the page's Max items of a scan, starting where its
+// cursor left off, and unmarshals them into T. next is the cursor of the
+// following page, empty when the scan is complete. A request running out of
+// its budget with partial results accepted ends early with the items read
+// so far (see budget.StopEarly).
+func Scan[T any](ctx context.Context, input *dynamodb.ScanInput, page Page) (items []T, next string, err error) {
+	if page.err != nil {
+		return nil, "", page.err
+	}
+	if page.Token != "" {
+		if input.ExclusiveStartKey, err = decodeToken(page.Token); err != nil {
+			return nil, "", err
+		}
+	}
+	if input.IndexName == nil && input.ConsistentRead == nil {
+		input.ConsistentRead = config.ConsistentRead(ctx)
+	}
+
+	max := page.Max()
+	for {
+		if len(items) > 0 && budget.StopEarly(ctx) {
+			return partial(items, input.ExclusiveStartKey)
+		}
+		input.Limit = aws.Int32(int32(max - len(items)))
+		pageCtx, cancel := config.DBContext(ctx)
+		output, err := config.DBClient.Scan(pageCtx, input)
+		cancel()
+		if err != nil {
+			if len(items) > 0 && budget.StopEarly(ctx) {
+				return partial(items, input.ExclusiveStartKey)
+			}
+			return nil, "", err
+		}
+		for _, item := range output.Items {
+			var v T
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				log.Printf("Error unmarshaling %s item: %v", *input.TableName, err)
+				continue
+			}
+			items = append(items, v)
+		}
+
+		if output.LastEvaluatedKey == nil {
+			return items, "", nil
+		}
+		if len(items) >= max {
+			next, err := encodeToken(output.LastEvaluatedKey)
+			return items, next, err
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// partial ends a list cut short by the request's budget, its cursor
+// continuing at the page that was not read
+func partial[T any](items []T, start map[string]types.AttributeValue) ([]T, string, error) {
+	next, err := encodeToken(start)
+	return items, next, err
+}
+
+// ScanAll reads every item of a scan, page after page, and unmarshals them
+// into T, skipping (and logging) items that fail to unmarshal. Each page
+// request gets its own operation timeout. It is meant for background jobs
+// and internal lookups; list responses go through Scan.
+func ScanAll[T any](ctx context.Context, input *dynamodb.ScanInput) ([]T, error) {
+	var items []T
+	if input.IndexName == nil && input.ConsistentRead == nil {
+		input.ConsistentRead = config.ConsistentRead(ctx)
+	}
+	paginator := dynamodb.NewScanPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var v T
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				log.Printf("Error unmarshaling %s item: %v", *input.TableName, err)
+				continue
+			}
+			items = append(items, v)
+		}
+	}
+	return items, nil
+}
+
+// Query reads at most the page's Max items of a query, starting where its
+// cursor left off, like Scan
+func Query[T any](ctx context.Context, input *dynamodb.QueryInput, page Page) (items []T, next string, err error) {
+	if page.err != nil {
+		return nil, "", page.err
+	}
+	if page.Token != "" {
+		if input.ExclusiveStartKey, err = decodeToken(page.Token); err != nil {
+			return nil, "", err
+		}
+	}
+	if input.IndexName == nil && input.ConsistentRead == nil {
+		input.ConsistentRead = config.ConsistentRead(ctx)
+	}
+
+	max := page.Max()
+	for {
+		if len(items) > 0 && budget.StopEarly(ctx) {
+			return partial(items, input.ExclusiveStartKey)
+		}
+		input.Limit = aws.Int32(int32(max - len(items)))
+		pageCtx, cancel := config.DBContext(ctx)
+		output, err := config.DBClient.Query(pageCtx, input)
+		cancel()
+		if err != nil {
+			if len(items) > 0 && budget.StopEarly(ctx) {
+				return partial(items, input.ExclusiveStartKey)
+			}
+			return nil, "", err
+		}
+		for _, item := range output.Items {
+			var v T
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				log.Printf("Error unmarshaling %s item: %v", *input.TableName, err)
+				continue
+			}
+			items = append(items, v)
+		}
+
+		if output.LastEvaluatedKey == nil {
+			return items, "", nil
+		}
+		if len(items) >= max {
+			next, err := encodeToken(output.LastEvaluatedKey)
+			return items, next, err
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// Write sends a page of a list: in a List when the request asked for the
+// envelope, otherwise as a bare array with SetNext
+func Write[T any](w http.ResponseWriter, page Page, items []T, next string) {
+	if items == nil {
+		items = []T{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if page.Envelope {
+		json.NewEncoder(w).Encode(List[T]{Items: items, NextCursor: next})
+		return
+	}
+	SetNext(w, next)
+	json.NewEncoder(w).Encode(items)
+}
+
+// SetNext marks a response as truncated, returning the next page token in
+// NextPageHeader with a Warning header for clients unaware of paging
+func SetNext(w http.ResponseWriter, next string) {
+	if next == "" {
+		return
+	}
+	w.Header().Set(NextPageHeader, next)
+	w.Header().Set("Warning", fmt.Sprintf(`299 - "List truncated at %d items, pass the %s header as pageToken for the next page"`, MaxItems(), NextPageHeader))
+}
+
+func encodeToken(key map[string]types.AttributeValue) (string, error) {
+	var plain map[string]interface{}
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeToken(token string) (map[string]types.AttributeValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal(data, &plain); err != nil || len(plain) == 0 {
+		return nil, ErrInvalidToken
+	}
+	key, err := attributevalue.MarshalMap(plain)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
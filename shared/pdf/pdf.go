@@ -0,0 +1,107 @@
+// Package pdf renders plain text documents (statements, reports) as PDF with
+// gofpdf. Text is set in DejaVu Sans Mono, embedded in the documents, so
+// columns line up and any script the font covers (accented Latin, Greek,
+// Cyrillic, currency signs...) prints as written.
+package pdf
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// A4 page in points, with the margins and line spacing used for the body
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	margin       = 50
+	fontSize     = 9
+	titleSize    = 14
+	lineHeight   = 12
+	linesPerPage = (pageHeight - 2*margin - 2*lineHeight) / lineHeight
+)
+
+// MaxColumns is how many body characters fit on a line
+const MaxColumns = (pageWidth - 2*margin) * 10 / (fontSize * 6)
+
+// font is the family the fonts below are registered as
+const font = "DejaVuSansMono"
+
+var (
+	//go:embed fonts/DejaVuSansMono.ttf
+	regular []byte
+	//go:embed fonts/DejaVuSansMono-Bold.ttf
+	bold []byte
+)
+
+// Document is a document to render. The letterhead, the issuer's name
+// followed by its details, is printed above the title of the first page.
+type Document struct {
+	Letterhead []string
+	Title      string
+	Lines      []string
+}
+
+// Render writes a document with a bold title and the given lines, breaking
+// pages as needed and numbering them
+func Render(w io.Writer, title string, lines []string) error {
+	return RenderDocument(w, Document{Title: title, Lines: lines})
+}
+
+// RenderDocument writes a document with its letterhead, if any, breaking
+// pages as needed and numbering them
+func RenderDocument(w io.Writer, doc Document) error {
+	letterhead := 0
+	if len(doc.Letterhead) > 0 {
+		letterhead = len(doc.Letterhead) + 1
+	}
+	lines := doc.Lines
+	var pages [][]string
+	for first := linesPerPage - letterhead; len(lines) > first; first = linesPerPage {
+		pages = append(pages, lines[:first])
+		lines = lines[first:]
+	}
+	pages = append(pages, lines)
+
+	f := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "pt",
+		Size:    gofpdf.SizeType{Wd: pageWidth, Ht: pageHeight},
+	})
+	f.SetAutoPageBreak(false, 0)
+	f.SetTitle(doc.Title, true)
+	f.AddUTF8FontFromBytes(font, "", regular)
+	f.AddUTF8FontFromBytes(font, "B", bold)
+
+	for i, page := range pages {
+		f.AddPage()
+		y := float64(margin)
+		if i == 0 {
+			for j, line := range doc.Letterhead {
+				style := ""
+				if j == 0 {
+					style = "B"
+				}
+				f.SetFont(font, style, fontSize)
+				f.Text(margin, y, line)
+				y += lineHeight
+			}
+			if letterhead > 0 {
+				f.Line(margin, y-lineHeight/2, pageWidth-margin, y-lineHeight/2)
+				y += lineHeight
+			}
+			f.SetFont(font, "B", titleSize)
+			f.Text(margin, y, doc.Title)
+			y += 2 * lineHeight
+		}
+		f.SetFont(font, "", fontSize)
+		for _, line := range page {
+			f.Text(margin, y, line)
+			y += lineHeight
+		}
+		footer := fmt.Sprintf("%d/%d", i+1, len(pages))
+		f.Text(pageWidth-margin-f.GetStringWidth(footer), pageHeight-margin/2, footer)
+	}
+	return f.Output(w)
+}
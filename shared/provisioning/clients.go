@@ -0,0 +1,360 @@
+// Package provisioning lets the identity system of a dental group create,
+// update, disable and remove the staff accounts of its clinics through a
+// SCIM 2.0 user endpoint. Operators register each identity system as a
+// client allowed to manage the accounts of a set of clinics, and hand it the
+// bearer token issued with it.
+package provisioning
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ClientsTable holds the provisioning clients, keyed by ID
+const ClientsTable = "ProvisioningClients"
+
+// ErrInvalidToken is returned for bearer tokens of no provisioning client
+var ErrInvalidToken = errors.New("invalid provisioning token")
+
+// Client is an identity system allowed to manage the accounts of ClinicIDs.
+// Accounts it creates without a role get DefaultRole, when set.
+type Client struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ClinicIDs   []string  `json:"clinic_ids"`
+	DefaultRole auth.Role `json:"default_role,omitempty"`
+	TokenHash   string    `json:"-"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   string    `json:"created_at"`
+}
+
+// NewClient is the body of a request registering a provisioning client
+type NewClient struct {
+	Name        string    `json:"name"`
+	ClinicIDs   []string  `json:"clinic_ids"`
+	DefaultRole auth.Role `json:"default_role,omitempty"`
+}
+
+// IsValid checks the request names the client and at least one clinic,
+// dropping repeated clinics
+func (c *NewClient) IsValid() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, id := range c.ClinicIDs {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("at least one clinic is required")
+	}
+	c.ClinicIDs = ids
+	if c.DefaultRole != "" {
+		return c.DefaultRole.IsValid()
+	}
+	return nil
+}
+
+// RegisteredClient is the response of registering a client. The token is
+// only ever shown here.
+type RegisteredClient struct {
+	Client
+	Token string `json:"token"`
+}
+
+// allows reports whether the client manages the accounts of a clinic
+func (c Client) allows(clinicID string) bool {
+	for _, id := range c.ClinicIDs {
+		if id == clinicID {
+			return true
+		}
+	}
+	return false
+}
+
+// newToken returns a token naming the client, so it is found without
+// scanning, followed by its secret
+func newToken(clientID string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return clientID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateClient registers a validated client, returning it with its token
+func CreateClient(ctx context.Context, req NewClient, createdBy string) (RegisteredClient, error) {
+	client := Client{
+		ID:          uuid.NewString(),
+		Name:        req.Name,
+		ClinicIDs:   req.ClinicIDs,
+		DefaultRole: req.DefaultRole,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	token, err := newToken(client.ID)
+	if err != nil {
+		return RegisteredClient{}, err
+	}
+	client.TokenHash = hashToken(token)
+
+	item, err := attributevalue.MarshalMap(client)
+	if err != nil {
+		return RegisteredClient{}, err
+	}
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ClientsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return RegisteredClient{}, err
+	}
+	return RegisteredClient{Client: client, Token: token}, nil
+}
+
+// getClient returns a client, or nil when there is none
+func getClient(ctx context.Context, id string) (*Client, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(ClientsTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+	var client Client
+	if err := attributevalue.UnmarshalMap(result.Item, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Verify returns the client a bearer token was issued to
+func Verify(ctx context.Context, token string) (Client, error) {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return Client{}, ErrInvalidToken
+	}
+	client, err := getClient(ctx, id)
+	if err != nil {
+		return Client{}, err
+	}
+	if client == nil || subtle.ConstantTimeCompare([]byte(client.TokenHash), []byte(hashToken(token))) != 1 {
+		return Client{}, ErrInvalidToken
+	}
+	return *client, nil
+}
+
+// ListClients returns every provisioning client, sorted by name
+func ListClients(ctx context.Context) ([]Client, error) {
+	var list []Client
+	paginator := dynamodb.NewScanPaginator(config.DBClient, &dynamodb.ScanInput{
+		TableName: aws.String(ClientsTable),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var pageItems []Client
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageItems); err != nil {
+			return nil, err
+		}
+		list = append(list, pageItems...)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// DeleteClient revokes a client, reporting false when there is none
+func DeleteClient(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(ClientsTable),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// operator checks the user is an admin of the default clinic, who registers
+// the identity systems of the deployment's dental groups
+func operator(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !claims.Operator() {
+		http.Error(w, "Only admins of the default clinic can manage provisioning clients", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+// CreateClientHandler godoc
+// @Summary Register a provisioning client
+// @Description Register the identity system of a dental group as a client allowed to create, update, disable and remove the staff accounts of the given clinics through the SCIM endpoint (/api/v1/provisioning/scim/v2/Users). The bearer token it uses is returned once and cannot be retrieved again. Only admins of the default clinic, who operate the deployment, can register clients.
+// @Tags provisioning
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param client body provisioning.NewClient true "Client name, clinics it manages and the role of accounts provisioned without one"
+// @Success 201 {object} provisioning.RegisteredClient
+// @Failure 400 {object} apierror.Response "Invalid request body, fields or unknown clinic"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage provisioning clients"
+// @Failure 500 {object} apierror.Response "Failed to register provisioning client"
+// @Router /api/v1/provisioning/clients [post]
+func CreateClientHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := operator(w, r)
+	if !ok {
+		return
+	}
+	var req NewClient
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.ClinicIDs {
+		if _, err := clinics.Get(r.Context(), id); err != nil {
+			if errors.Is(err, clinics.ErrNotFound) {
+				http.Error(w, "Unknown clinic "+id, http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Failed to register provisioning client", http.StatusInternalServerError)
+			log.Printf("Error loading clinic %s: %v", id, err)
+			return
+		}
+	}
+
+	client, err := CreateClient(r.Context(), req, claims.Email)
+	if err != nil {
+		http.Error(w, "Failed to register provisioning client", http.StatusInternalServerError)
+		log.Printf("Error registering provisioning client: %v", err)
+		return
+	}
+	log.Printf("Operator %s registered provisioning client %s for clinics %v", claims.Email, client.Name, client.ClinicIDs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(client)
+}
+
+// ListClientsHandler godoc
+// @Summary List provisioning clients
+// @Description List the identity systems allowed to provision staff accounts, with the clinics each manages (operators only). Tokens are never returned.
+// @Tags provisioning
+// @Produce json
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Success 200 {array} provisioning.Client
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage provisioning clients"
+// @Failure 500 {object} apierror.Response "Failed to list provisioning clients"
+// @Router /api/v1/provisioning/clients [get]
+func ListClientsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := operator(w, r); !ok {
+		return
+	}
+	list, err := ListClients(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list provisioning clients", http.StatusInternalServerError)
+		log.Printf("Error listing provisioning clients: %v", err)
+		return
+	}
+	if list == nil {
+		list = []Client{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// DeleteClientHandler godoc
+// @Summary Revoke a provisioning client
+// @Description Revoke a provisioning client; its token stops working at once. The accounts it provisioned are kept (operators only).
+// @Tags provisioning
+// @Param Authorization header string true "Bearer access token of an admin of the default clinic"
+// @Param id path string true "Client ID"
+// @Success 204 "Client revoked"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "Only admins of the default clinic can manage provisioning clients"
+// @Failure 404 {object} apierror.Response "Provisioning client not found"
+// @Failure 500 {object} apierror.Response "Failed to revoke provisioning client"
+// @Router /api/v1/provisioning/clients/{id} [delete]
+func DeleteClientHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := operator(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	deleted, err := DeleteClient(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to revoke provisioning client", http.StatusInternalServerError)
+		log.Printf("Error deleting provisioning client %s: %v", id, err)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Provisioning client not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Operator %s revoked provisioning client %s", claims.Email, id)
+	w.WriteHeader(http.StatusNoContent)
+}
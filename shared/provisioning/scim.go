@@ -0,0 +1,644 @@
+package provisioning
+
+import (
+	"context"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// SCIM schemas of the resources and messages of the endpoint. Staff accounts
+// extend the core user with their clinic and role.
+const (
+	UserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	StaffSchema        = "urn:dental-saas:params:scim:schemas:extension:staff:2.0:User"
+	listResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+)
+
+// BasePath is where the SCIM endpoint is served
+const BasePath = "/api/v1/provisioning/scim/v2"
+
+const scimContentType = "application/scim+json"
+
+// defaultPageSize is the page size of lists that do not ask for one
+const defaultPageSize = 100
+
+// errOutOfScope is returned for accounts of clinics the client does not manage
+var errOutOfScope = errors.New("the provisioning client does not manage this clinic")
+
+// UserResource is a staff account as a SCIM user. Only the attributes below
+// are kept; others sent by the identity system are ignored.
+type UserResource struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"` // the account's email
+	DisplayName string          `json:"displayName,omitempty"`
+	Name        *Name           `json:"name,omitempty"`
+	Emails      []Email         `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`   // false disables the account; default true
+	Password    string          `json:"password,omitempty"` // write-only; accounts without one log in through single sign-on
+	Staff       *StaffExtension `json:"urn:dental-saas:params:scim:schemas:extension:staff:2.0:User,omitempty"`
+	Meta        *Meta           `json:"meta,omitempty"`
+}
+
+// Name is the name of a SCIM user
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is an email of a SCIM user
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// StaffExtension is the clinic and role of a staff account. The clinic may
+// be left out by clients managing a single clinic, and the role by clients
+// with a default role.
+type StaffExtension struct {
+	ClinicID string    `json:"clinicId,omitempty"`
+	Role     auth.Role `json:"role,omitempty"`
+}
+
+// Meta describes a SCIM resource
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ListResponse is a page of SCIM users
+type ListResponse struct {
+	Schemas      []string       `json:"schemas"`
+	TotalResults int            `json:"totalResults"`
+	StartIndex   int            `json:"startIndex"`
+	ItemsPerPage int            `json:"itemsPerPage"`
+	Resources    []UserResource `json:"Resources"`
+}
+
+// PatchRequest is a SCIM PatchOp message
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation changes one attribute, or those of Value when there is no
+// Path. Only add and replace are supported.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+type clientKey struct{}
+
+// Authenticated requires the bearer token of a provisioning client on a
+// SCIM request. The client becomes the actor of the request in the audit log.
+func Authenticated(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas-provisioning"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		client, err := Verify(r.Context(), strings.TrimSpace(token))
+		if errors.Is(err, ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dental-saas-provisioning"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to authenticate provisioning client", http.StatusInternalServerError)
+			log.Printf("Error verifying provisioning token: %v", err)
+			return
+		}
+
+		actor := config.ActorFrom(r.Context())
+		actor.User = "provisioning:" + client.Name
+		actor.Role = "provisioning"
+		ctx := config.WithActor(r.Context(), actor)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, clientKey{}, client)))
+	})
+}
+
+func clientFrom(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// resource returns the SCIM user of an account
+func resource(user auth.User) UserResource {
+	active := !user.Disabled
+	return UserResource{
+		Schemas:     []string{UserSchema, StaffSchema},
+		ID:          user.ID,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		DisplayName: user.Name,
+		Name:        &Name{Formatted: user.Name},
+		Emails:      []Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Staff:       &StaffExtension{ClinicID: user.ClinicID, Role: user.Role},
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     BasePath + "/Users/" + user.ID,
+		},
+	}
+}
+
+// account returns the account a SCIM user describes for the client. The
+// clinic and role not sent are those of current, the account being
+// replaced, when there is one.
+func (res UserResource) account(client Client, current *auth.User) (auth.Account, error) {
+	account := auth.Account{
+		Email:      res.UserName,
+		ExternalID: res.ExternalID,
+		Password:   res.Password,
+	}
+	if account.Email == "" {
+		for _, email := range res.Emails {
+			if email.Primary || account.Email == "" {
+				account.Email = email.Value
+			}
+		}
+	}
+	switch {
+	case strings.TrimSpace(res.DisplayName) != "":
+		account.Name = res.DisplayName
+	case res.Name != nil && strings.TrimSpace(res.Name.Formatted) != "":
+		account.Name = res.Name.Formatted
+	case res.Name != nil:
+		account.Name = strings.TrimSpace(res.Name.GivenName + " " + res.Name.FamilyName)
+	}
+	if strings.TrimSpace(account.Name) == "" {
+		account.Name = account.Email
+	}
+	if res.Active != nil {
+		account.Disabled = !*res.Active
+	}
+
+	if res.Staff != nil {
+		account.ClinicID = strings.TrimSpace(res.Staff.ClinicID)
+		account.Role = res.Staff.Role
+	}
+	if account.ClinicID == "" && current != nil {
+		account.ClinicID = current.ClinicID
+	}
+	if account.ClinicID == "" && len(client.ClinicIDs) == 1 {
+		account.ClinicID = client.ClinicIDs[0]
+	}
+	if account.Role == "" && current != nil {
+		account.Role = current.Role
+	}
+	if account.Role == "" {
+		account.Role = client.DefaultRole
+	}
+	if account.ClinicID != "" && !client.allows(account.ClinicID) {
+		return auth.Account{}, errOutOfScope
+	}
+	if account.Role == "" {
+		return auth.Account{}, fmt.Errorf("role is required in the %s extension", StaffSchema)
+	}
+	if err := account.IsValid(); err != nil {
+		return auth.Account{}, err
+	}
+	return account, nil
+}
+
+// loadUser fetches the account named in the path, writing the error response
+// when it cannot be returned. Accounts of clinics the client does not manage
+// are not found.
+func loadUser(w http.ResponseWriter, r *http.Request, failure string) (auth.User, bool) {
+	id := mux.Vars(r)["id"]
+	user, err := auth.UserByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, failure, http.StatusInternalServerError)
+		log.Printf("Error fetching user %s: %v", id, err)
+		return auth.User{}, false
+	}
+	if user == nil || !clientFrom(r.Context()).allows(user.ClinicID) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return auth.User{}, false
+	}
+	return *user, true
+}
+
+// filterPattern matches the filters identity systems send to find an account
+// before creating it: userName eq "..." or externalId eq "..."
+var filterPattern = regexp.MustCompile(`^\s*(\w+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// ListUsersHandler godoc
+// @Summary List provisioned users
+// @Description List the staff accounts of the clinics the provisioning client manages as SCIM users, sorted by userName. The only filters supported are userName eq "..." and externalId eq "...".
+// @Tags provisioning
+// @Produce application/scim+json
+// @Param Authorization header string true "Bearer token of the provisioning client"
+// @Param filter query string false "userName eq \"...\" or externalId eq \"...\""
+// @Param startIndex query int false "1-based index of the first user (default 1)"
+// @Param count query int false "Most users in the page (default 100, up to LIST_MAX_ITEMS)"
+// @Success 200 {object} provisioning.ListResponse
+// @Failure 400 {object} apierror.Response "Invalid filter or paging"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 500 {object} apierror.Response "Failed to list users"
+// @Router /api/v1/provisioning/scim/v2/Users [get]
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	startIndex, count := 1, defaultPageSize
+	if v := query.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "startIndex must be a number", http.StatusBadRequest)
+			return
+		}
+		startIndex = max(n, 1)
+	}
+	if v := query.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "count must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+	count = min(count, paging.MaxItems())
+
+	var attribute, value string
+	if filter := query.Get("filter"); filter != "" {
+		match := filterPattern.FindStringSubmatch(filter)
+		if match == nil {
+			http.Error(w, `filter must be userName eq "..." or externalId eq "..."`, http.StatusBadRequest)
+			return
+		}
+		attribute, value = strings.ToLower(match[1]), strings.ReplaceAll(match[2], `\"`, `"`)
+		if attribute != "username" && attribute != "externalid" {
+			http.Error(w, `filter must be userName eq "..." or externalId eq "..."`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	users, err := auth.ClinicUsers(r.Context(), clientFrom(r.Context()).ClinicIDs)
+	if err != nil {
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		log.Printf("Error listing users for provisioning: %v", err)
+		return
+	}
+	var matched []auth.User
+	for _, user := range users {
+		switch {
+		case attribute == "username" && !strings.EqualFold(user.Email, value):
+		case attribute == "externalid" && user.ExternalID != value:
+		default:
+			matched = append(matched, user)
+		}
+	}
+
+	list := ListResponse{
+		Schemas:      []string{listResponseSchema},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		Resources:    []UserResource{},
+	}
+	if startIndex <= len(matched) {
+		for _, user := range matched[startIndex-1 : min(startIndex-1+count, len(matched))] {
+			list.Resources = append(list.Resources, resource(user))
+		}
+	}
+	list.ItemsPerPage = len(list.Resources)
+	writeSCIM(w, http.StatusOK, list)
+}
+
+// GetUserHandler godoc
+// @Summary Get a provisioned user
+// @Description Get a staff account of a clinic the provisioning client manages as a SCIM user
+// @Tags provisioning
+// @Produce application/scim+json
+// @Param Authorization header string true "Bearer token of the provisioning client"
+// @Param id path string true "User ID"
+// @Success 200 {object} provisioning.UserResource
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 404 {object} apierror.Response "User not found"
+// @Failure 500 {object} apierror.Response "Failed to retrieve user"
+// @Router /api/v1/provisioning/scim/v2/Users/{id} [get]
+func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUser(w, r, "Failed to retrieve user")
+	if !ok {
+		return
+	}
+	writeSCIM(w, http.StatusOK, resource(user))
+}
+
+// CreateUserHandler godoc
+// @Summary Provision a user
+// @Description Create the staff account of a SCIM user in one of the clinics the provisioning client manages. userName is the account's email; the clinic and role go in the staff extension, and may be left out when the client manages a single clinic or has a default role. Accounts created without a password log in through the clinic's single sign-on.
+// @Tags provisioning
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param Authorization header string true "Bearer token of the provisioning client"
+// @Param user body provisioning.UserResource true "SCIM user"
+// @Success 201 {object} provisioning.UserResource
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "The provisioning client does not manage this clinic"
+// @Failure 409 {object} apierror.Response "A user with this email already exists"
+// @Failure 500 {object} apierror.Response "Failed to create user"
+// @Router /api/v1/provisioning/scim/v2/Users [post]
+func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var res UserResource
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	account, ok := validAccount(w, res, clientFrom(r.Context()), nil)
+	if !ok {
+		return
+	}
+
+	user, err := auth.CreateAccount(r.Context(), account)
+	if errors.Is(err, auth.ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		log.Printf("Error provisioning user %s: %v", account.Email, err)
+		return
+	}
+	recordChange(r.Context(), user, config.ChangeCreated)
+
+	w.Header().Set("Location", BasePath+"/Users/"+user.ID)
+	writeSCIM(w, http.StatusCreated, resource(user))
+}
+
+// ReplaceUserHandler godoc
+// @Summary Replace a provisioned user
+// @Description Replace the name, external ID, active flag, clinic, role and, when sent, password of a staff account. The userName cannot change; the clinic and role not sent are kept. active=false disables the account: it can no longer log in or refresh its tokens.
+// @Tags provisioning
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param Authorization header string true "Bearer token of the provisioning client"
+// @Param id path string true "User ID"
+// @Param user body provisioning.UserResource true "SCIM user"
+// @Success 200 {object} provisioning.UserResource
+// @Failure 400 {object} apierror.Response "Invalid request body or fields"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "The provisioning client does not manage this clinic"
+// @Failure 404 {object} apierror.Response "User not found"
+// @Failure 500 {object} apierror.Response "Failed to update user"
+// @Router /api/v1/provisioning/scim/v2/Users/{id} [put]
+func ReplaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	var res UserResource
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	current, ok := loadUser(w, r, "Failed to update user")
+	if !ok {
+		return
+	}
+	if res.UserName == "" {
+		res.UserName = current.Email
+	}
+	updateUser(w, r, current, res)
+}
+
+// PatchUserHandler godoc
+// @Summary Patch a provisioned user
+// @Description Change attributes of a staff account with a SCIM PatchOp: add or replace of active, displayName, name, externalId, password and the clinicId and role of the staff extension. Identity systems disable accounts with {"op": "replace", "path": "active", "value": false}. Attributes that are not kept are ignored.
+// @Tags provisioning
+// @Accept application/scim+json
+// @Produce application/scim+json
+// @Param Authorization header string true "Bearer token of the provisioning client"
+// @Param id path string true "User ID"
+// @Param patch body provisioning.PatchRequest true "SCIM PatchOp"
+// @Success 200 {object} provisioning.UserResource
+// @Failure 400 {object} apierror.Response "Invalid request body or operation"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 403 {object} apierror.Response "The provisioning client does not manage this clinic"
+// @Failure 404 {object} apierror.Response "User not found"
+// @Failure 500 {object} apierror.Response "Failed to update user"
+// @Router /api/v1/provisioning/scim/v2/Users/{id} [patch]
+func PatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	var patch PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	current, ok := loadUser(w, r, "Failed to update user")
+	if !ok {
+		return
+	}
+
+	res := resource(current)
+	for _, op := range patch.Operations {
+		if err := res.apply(op); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	updateUser(w, r, current, res)
+}
+
+// DeleteUserHandler godoc
+// @Summary Deprovision a user
+// @Description Remove a staff account of a clinic the provisioning client manages. Its access tokens work until they expire; its refresh tokens are refused at once. To keep the account but stop it logging in, set active to false instead.
+// @Tags provisioning
+// @Param Authorization header string true "Bearer token of the provisioning client"
+// @Param id path string true "User ID"
+// @Success 204 "User removed"
+// @Failure 401 {object} apierror.Response "Authentication required"
+// @Failure 404 {object} apierror.Response "User not found"
+// @Failure 500 {object} apierror.Response "Failed to remove user"
+// @Router /api/v1/provisioning/scim/v2/Users/{id} [delete]
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUser(w, r, "Failed to remove user")
+	if !ok {
+		return
+	}
+	err := auth.DeleteAccount(r.Context(), user)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to remove user", http.StatusInternalServerError)
+		log.Printf("Error deprovisioning user %s: %v", user.Email, err)
+		return
+	}
+	recordChange(r.Context(), user, config.ChangeDeleted)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateUser stores the account a SCIM user describes over current
+func updateUser(w http.ResponseWriter, r *http.Request, current auth.User, res UserResource) {
+	if !strings.EqualFold(strings.TrimSpace(res.UserName), current.Email) {
+		http.Error(w, "userName cannot be changed; remove the user and provision it again", http.StatusBadRequest)
+		return
+	}
+	account, ok := validAccount(w, res, clientFrom(r.Context()), &current)
+	if !ok {
+		return
+	}
+
+	user, err := auth.UpdateAccount(r.Context(), current, account)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		log.Printf("Error updating provisioned user %s: %v", current.Email, err)
+		return
+	}
+	recordChange(r.Context(), user, config.ChangeUpdated)
+	writeSCIM(w, http.StatusOK, resource(user))
+}
+
+// validAccount returns the account of a SCIM user, writing the error
+// response when it is invalid or outside the client's clinics
+func validAccount(w http.ResponseWriter, res UserResource, client Client, current *auth.User) (auth.Account, bool) {
+	account, err := res.account(client, current)
+	if errors.Is(err, errOutOfScope) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return auth.Account{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return auth.Account{}, false
+	}
+	return account, true
+}
+
+// apply makes an add or replace operation of a PatchOp on the user
+func (res *UserResource) apply(op PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	default:
+		return fmt.Errorf("unsupported patch operation %q: only add and replace are supported", op.Op)
+	}
+	if op.Path != "" {
+		return res.set(op.Path, op.Value)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &values); err != nil {
+		return fmt.Errorf("the value of a patch operation without a path must be an object")
+	}
+	for path, value := range values {
+		if err := res.set(path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set changes the attribute at path. Attribute names are case-insensitive,
+// and attributes that are not kept are ignored.
+func (res *UserResource) set(path string, value json.RawMessage) error {
+	path = strings.ToLower(path)
+	if rest, ok := strings.CutPrefix(path, strings.ToLower(StaffSchema)); ok {
+		path = strings.TrimPrefix(rest, ":")
+		if path == "" {
+			path = "staff"
+		}
+	}
+	if res.Staff == nil {
+		res.Staff = &StaffExtension{}
+	}
+	if res.Name == nil {
+		res.Name = &Name{}
+	}
+
+	var err error
+	switch path {
+	case "active":
+		var active bool
+		if active, err = boolValue(value); err == nil {
+			res.Active = &active
+		}
+	case "username":
+		err = json.Unmarshal(value, &res.UserName)
+	case "displayname":
+		err = json.Unmarshal(value, &res.DisplayName)
+		res.Name.Formatted = ""
+	case "name":
+		var name Name
+		if err = json.Unmarshal(value, &name); err == nil {
+			res.Name, res.DisplayName = &name, ""
+		}
+	case "name.formatted":
+		err = json.Unmarshal(value, &res.Name.Formatted)
+		res.DisplayName = ""
+	case "name.givenname":
+		err = json.Unmarshal(value, &res.Name.GivenName)
+		res.DisplayName, res.Name.Formatted = "", ""
+	case "name.familyname":
+		err = json.Unmarshal(value, &res.Name.FamilyName)
+		res.DisplayName, res.Name.Formatted = "", ""
+	case "externalid":
+		err = json.Unmarshal(value, &res.ExternalID)
+	case "password":
+		err = json.Unmarshal(value, &res.Password)
+	case "staff":
+		err = json.Unmarshal(value, res.Staff)
+	case "clinicid":
+		err = json.Unmarshal(value, &res.Staff.ClinicID)
+	case "role":
+		err = json.Unmarshal(value, &res.Staff.Role)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s", path)
+	}
+	return nil
+}
+
+// boolValue reads a boolean sent as such or, as some identity systems do, as
+// the string "True" or "False"
+func boolValue(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(s)
+}
+
+// recordChange records a provisioning change of an account in the audit log
+// of its clinic
+func recordChange(ctx context.Context, user auth.User, action string) {
+	details := map[string]interface{}{
+		"role":     user.Role,
+		"disabled": user.Disabled,
+	}
+	if action == config.ChangeDeleted {
+		details = nil
+	}
+	if err := config.RecordAuditEvent(config.WithClinic(ctx, user.ClinicID), user.ClinicID, "users", user.Email, action, details); err != nil {
+		log.Printf("Error recording provisioning of %s in the audit log: %v", user.Email, err)
+	}
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
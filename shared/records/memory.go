@@ -0,0 +1,132 @@
+package records
+
+import (
+	"dental-saas/shared/paging"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory keeps records by ID with the semantics of the DynamoDB operations:
+// soft-deleted records are hidden from reads until restored, and lists are
+// paged with the ID of the last record as cursor. Records without a
+// deletion mark are removed for good by Delete.
+type Memory[T any] struct {
+	mu      sync.Mutex
+	records map[string]T
+	id      func(T) string
+	deleted func(*T) *string // the record's DeletedAt, nil when not soft deleted
+}
+
+// NewMemory returns a Memory holding records, keyed by id. deleted returns
+// the DeletedAt of a record of a soft-deleted entity, and is nil for the
+// entities removed for good.
+func NewMemory[T any](id func(T) string, deleted func(*T) *string, records []T) *Memory[T] {
+	m := &Memory[T]{records: make(map[string]T, len(records)), id: id, deleted: deleted}
+	for _, record := range records {
+		m.records[id(record)] = record
+	}
+	return m
+}
+
+func (m *Memory[T]) live(record T) bool {
+	return m.deleted == nil || *m.deleted(&record) == ""
+}
+
+// Get returns the record with the ID
+func (m *Memory[T]) Get(id string) (T, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[id]
+	if !ok || !m.live(record) {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return record, nil
+}
+
+// List returns a page of the records match accepts, every one when match is
+// nil, sorted by ID
+func (m *Memory[T]) List(page paging.Page, match func(T) bool) ([]T, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.records))
+	for id, record := range m.records {
+		if m.live(record) && id > page.Token && (match == nil || match(record)) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	next := ""
+	if len(ids) > page.Max() {
+		ids = ids[:page.Max()]
+		next = ids[len(ids)-1]
+	}
+	records := make([]T, len(ids))
+	for i, id := range ids {
+		records[i] = m.records[id]
+	}
+	return records, next, nil
+}
+
+// Find returns every record match accepts, sorted by ID
+func (m *Memory[T]) Find(match func(T) bool) []T {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []T
+	for _, record := range m.records {
+		if m.live(record) && match(record) {
+			found = append(found, record)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return m.id(found[i]) < m.id(found[j]) })
+	return found
+}
+
+// Put stores a new record (create), or replaces an existing one
+func (m *Memory[T]) Put(record T, create bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, exists := m.records[m.id(record)]
+	if create && exists {
+		return ErrAlreadyExists
+	}
+	if !create && (!exists || !m.live(stored)) {
+		return ErrNotFound
+	}
+	m.records[m.id(record)] = record
+	return nil
+}
+
+// Delete soft deletes the record with the ID, or removes it when the
+// entity is not soft deleted, and returns it
+func (m *Memory[T]) Delete(id string) (T, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[id]
+	if !ok || !m.live(record) {
+		var zero T
+		return zero, ErrNotFound
+	}
+	if m.deleted == nil {
+		delete(m.records, id)
+		return record, nil
+	}
+	*m.deleted(&record) = time.Now().UTC().Format(time.RFC3339)
+	m.records[id] = record
+	return record, nil
+}
+
+// Restore brings back the soft-deleted record with the ID
+func (m *Memory[T]) Restore(id string) (T, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[id]
+	if !ok || m.live(record) {
+		var zero T
+		return zero, ErrNotFound
+	}
+	*m.deleted(&record) = ""
+	m.records[id] = record
+	return record, nil
+}
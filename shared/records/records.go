@@ -0,0 +1,174 @@
+// Package records holds the reads and writes of records keyed by ID that the
+// repositories of the modules share: the DynamoDB operations, mapping their
+// conditional failures to ErrNotFound and ErrAlreadyExists, and Memory, which
+// keeps records with the same semantics for tests and other backends.
+package records
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/paging"
+	"errors"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// ErrNotFound is returned when the record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrAlreadyExists is returned when creating a record whose ID is taken
+	ErrAlreadyExists = errors.New("record already exists")
+)
+
+// ValidationError is returned when a record fails validation; its message is
+// safe to show to the client
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Get reads an item by ID into out, returning ErrNotFound when it does not
+// exist
+func Get(ctx context.Context, table, id string, out interface{}) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead: config.ConsistentRead(ctx),
+	})
+	if err != nil {
+		return err
+	}
+	if result.Item == nil {
+		return ErrNotFound
+	}
+	return attributevalue.UnmarshalMap(result.Item, out)
+}
+
+// Put writes an item, creating it (create) or replacing an existing one;
+// the condition maps to ErrAlreadyExists or ErrNotFound. Replacements of
+// versioned records fail with config.ErrVersionConflict when the record
+// changed since it was read.
+func Put(ctx context.Context, table string, item map[string]types.AttributeValue, create bool) error {
+	conflict := ErrNotFound
+	if create {
+		conflict = ErrAlreadyExists
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	err := config.PutRecord(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      item,
+	}, create)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return conflict
+	}
+	return err
+}
+
+// Delete soft deletes an item by ID and returns it into out, returning
+// ErrNotFound when it does not exist or is already deleted
+func Delete(ctx context.Context, table, id string, out interface{}) error {
+	item, err := config.SoftDelete(ctx, table, id)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+// Remove deletes an item by ID for good, for the tables that are not soft
+// deleted, returning ErrNotFound when it does not exist
+func Remove(ctx context.Context, table, id string) error {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Restore restores a soft-deleted item by ID into out, returning ErrNotFound
+// when there is no deleted item with the ID
+func Restore(ctx context.Context, table, id string, out interface{}) error {
+	item, err := config.Restore(ctx, table, id)
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalMap(item, out)
+}
+
+// Query runs a paginated query and unmarshals every item into T, with the
+// same error handling as paging.ScanAll
+func Query[T any](ctx context.Context, input *dynamodb.QueryInput) ([]T, error) {
+	var items []T
+	if input.IndexName == nil && input.ConsistentRead == nil {
+		input.ConsistentRead = config.ConsistentRead(ctx)
+	}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var v T
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				log.Printf("Error unmarshaling %s item: %v", *input.TableName, err)
+				continue
+			}
+			items = append(items, v)
+		}
+	}
+	return items, nil
+}
+
+// NameContains scans a table for items whose Name contains name
+func NameContains[T any](ctx context.Context, table, name string) ([]T, error) {
+	return paging.ScanAll[T](ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(table),
+		FilterExpression: aws.String("contains(#name, :name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":name": &types.AttributeValueMemberS{Value: name},
+		},
+	})
+}
@@ -0,0 +1,385 @@
+package retention
+
+import (
+	"context"
+	"dental-saas/shared/config"
+	"dental-saas/shared/legalhold"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableName is the table holding the retention policy of each clinic
+const TableName = "RetentionPolicies"
+
+// Target is a kind of record that can be purged once older than its retention
+// period. Filter selects the purgeable items and must compare the record's
+// age against :cutoff, a YYYY-MM-DD date; it is re-checked as the delete
+// condition so records that changed since the scan are kept. Records of a
+// RecordType, or linked to a patient through PatientAttribute, that are under
+// legal hold are never purged.
+type Target struct {
+	Name             string                          `json:"name"`
+	Description      string                          `json:"description"`
+	Table            string                          `json:"-"`
+	Keys             []string                        `json:"-"` // attributes of the primary key, the first one identifying the record
+	Filter           string                          `json:"-"`
+	Names            map[string]string               `json:"-"`
+	Values           map[string]types.AttributeValue `json:"-"`
+	RecordType       string                          `json:"-"`
+	PatientAttribute string                          `json:"-"`
+}
+
+var (
+	targetsMu sync.RWMutex
+	targets   = map[string]Target{}
+)
+
+// RegisterTarget makes a kind of record purgeable; modules call it for the records they own
+func RegisterTarget(target Target) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	targets[target.Name] = target
+}
+
+// Targets returns the registered targets sorted by name
+func Targets() []Target {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+
+	list := make([]Target, 0, len(targets))
+	for _, target := range targets {
+		list = append(list, target)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func init() {
+	RegisterTarget(Target{
+		Name:             "cancelled_appointments",
+		Description:      "Cancelled appointments, by appointment date",
+		Table:            "Appointments",
+		Keys:             []string{"ID"},
+		RecordType:       legalhold.RecordAppointment,
+		PatientAttribute: "PatientID",
+		Filter:           "(#status = :cancelled OR #status = :canceled) AND #dt < :cutoff",
+		Names:            map[string]string{"#status": "Status", "#dt": "DateTime"},
+		Values: map[string]types.AttributeValue{
+			":cancelled": &types.AttributeValueMemberS{Value: "cancelled"},
+			":canceled":  &types.AttributeValueMemberS{Value: "canceled"},
+		},
+	})
+	RegisterTarget(Target{
+		Name:             "closed_tasks",
+		Description:      "Done or cancelled staff tasks, by last update",
+		Table:            "Tasks",
+		Keys:             []string{"ID"},
+		RecordType:       legalhold.RecordTask,
+		PatientAttribute: "PatientID",
+		Filter:           "(#status = :done OR #status = :cancelled) AND UpdatedAt < :cutoff",
+		Names:            map[string]string{"#status": "Status"},
+		Values: map[string]types.AttributeValue{
+			":done":      &types.AttributeValueMemberS{Value: "done"},
+			":cancelled": &types.AttributeValueMemberS{Value: "cancelled"},
+		},
+	})
+	RegisterTarget(Target{
+		Name:        "read_notifications",
+		Description: "Read in-app notifications, by creation date",
+		Table:       "Notifications",
+		Keys:        []string{"Recipient", "ID"},
+		Filter:      "#read = :true AND CreatedAt < :cutoff",
+		Names:       map[string]string{"#read": "Read"},
+		Values: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	RegisterTarget(Target{
+		Name:             "surveys",
+		Description:      "Satisfaction surveys, by sending date",
+		Table:            "Surveys",
+		Keys:             []string{"AppointmentID"},
+		RecordType:       legalhold.RecordSurvey,
+		PatientAttribute: "PatientID",
+		Filter:           "SentAt < :cutoff",
+	})
+}
+
+// Policy is the retention configuration of a clinic: how many days each
+// target is kept. Targets missing from Rules, or set to 0, are kept forever.
+type Policy struct {
+	ClinicID  string         `json:"clinic_id"`
+	Rules     map[string]int `json:"rules"`
+	UpdatedAt string         `json:"updated_at,omitempty"`
+}
+
+// IsValid checks that every rule names a registered target and a non-negative period
+func (p *Policy) IsValid() error {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	for name, days := range p.Rules {
+		if _, ok := targets[name]; !ok {
+			return fmt.Errorf("unknown retention target %q", name)
+		}
+		if days < 0 {
+			return fmt.Errorf("retention of %s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// GetPolicy returns the retention policy of a clinic, empty when none was configured
+func GetPolicy(ctx context.Context, clinicID string) (Policy, error) {
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	})
+	if err != nil {
+		return Policy{}, err
+	}
+	policy := Policy{ClinicID: clinicID}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &policy); err != nil {
+			return Policy{}, err
+		}
+	}
+	if policy.Rules == nil {
+		policy.Rules = map[string]int{}
+	}
+	return policy, nil
+}
+
+// SavePolicy stores the retention policy of a clinic
+func SavePolicy(ctx context.Context, policy Policy) (Policy, error) {
+	if err := policy.IsValid(); err != nil {
+		return Policy{}, err
+	}
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	item, err := attributevalue.MarshalMap(policy)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	ctx, cancel := config.DBContext(ctx)
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(TableName),
+		Item:      item,
+	})
+	return policy, err
+}
+
+// TargetReport is what a purge found, and deleted, for one target; in a dry
+// run Purged counts what would be deleted
+type TargetReport struct {
+	Target     string `json:"target"`
+	RetainDays int    `json:"retain_days"`
+	Cutoff     string `json:"cutoff"`
+	Matched    int    `json:"matched"`
+	Held       int    `json:"held"` // kept because of a legal hold
+	Purged     int    `json:"purged"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a purge run; in a dry run nothing is deleted
+type Report struct {
+	ClinicID   string         `json:"clinic_id"`
+	DryRun     bool           `json:"dry_run"`
+	Targets    []TargetReport `json:"targets"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+}
+
+// Purge deletes the clinic's records of every target older than its
+// retention period. With dryRun it only counts what would be deleted.
+func Purge(ctx context.Context, clinicID string, dryRun bool) (Report, error) {
+	// Soft-deleted records expire like any other
+	ctx = config.WithDeleted(config.WithClinic(ctx, clinicID), true)
+	policy, err := GetPolicy(ctx, clinicID)
+	if err != nil {
+		return Report{}, fmt.Errorf("loading retention policy: %v", err)
+	}
+
+	holds, err := legalhold.Active(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("loading legal holds: %v", err)
+	}
+
+	report := Report{
+		ClinicID:  clinicID,
+		DryRun:    dryRun,
+		Targets:   []TargetReport{},
+		StartedAt: time.Now().UTC(),
+	}
+	for _, target := range Targets() {
+		// Records of tables not split by clinic follow the default clinic's policy
+		if _, scoped := config.ClinicScopedTables[target.Table]; !scoped && clinicID != config.DefaultClinicID {
+			continue
+		}
+		days := policy.Rules[target.Name]
+		if days <= 0 {
+			continue
+		}
+		cutoff := report.StartedAt.AddDate(0, 0, -days).Format("2006-01-02")
+		result := TargetReport{Target: target.Name, RetainDays: days, Cutoff: cutoff}
+		if err := purgeTarget(ctx, target, cutoff, dryRun, holds, &result); err != nil {
+			result.Error = err.Error()
+			log.Printf("Error purging %s: %v", target.Name, err)
+		}
+		report.Targets = append(report.Targets, result)
+	}
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+// purgeTarget scans the target's table for items past cutoff and deletes them
+// one by one, each guarded by the target filter
+func purgeTarget(ctx context.Context, target Target, cutoff string, dryRun bool, holds legalhold.Set, result *TargetReport) error {
+	names := map[string]string{}
+	for k, v := range target.Names {
+		names[k] = v
+	}
+	values := map[string]types.AttributeValue{
+		":cutoff": &types.AttributeValueMemberS{Value: cutoff},
+	}
+	for k, v := range target.Values {
+		values[k] = v
+	}
+
+	projection := ""
+	for i, key := range target.Keys {
+		placeholder := fmt.Sprintf("#key%d", i)
+		names[placeholder] = key
+		if i > 0 {
+			projection += ", "
+		}
+		projection += placeholder
+	}
+	if target.PatientAttribute != "" {
+		names["#patient"] = target.PatientAttribute
+		projection += ", #patient"
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(target.Table),
+		FilterExpression:          aws.String(target.Filter),
+		ProjectionExpression:      aws.String(projection),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+
+	// Delete conditions only reference the filter's own placeholders
+	conditionNames := map[string]string{}
+	for k, v := range target.Names {
+		conditionNames[k] = v
+	}
+	if len(conditionNames) == 0 {
+		conditionNames = nil
+	}
+
+	paginator := dynamodb.NewScanPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			result.Matched++
+			if target.RecordType != "" && holds.Covers(target.RecordType, stringAttribute(item, target.Keys[0]), stringAttribute(item, target.PatientAttribute)) {
+				result.Held++
+				continue
+			}
+			if dryRun {
+				result.Purged++
+				continue
+			}
+
+			key := map[string]types.AttributeValue{}
+			for _, name := range target.Keys {
+				key[name] = item[name]
+			}
+			deleteCtx, cancel := config.DBContext(ctx)
+			_, err := config.DBClient.DeleteItem(deleteCtx, &dynamodb.DeleteItemInput{
+				TableName:                 aws.String(target.Table),
+				Key:                       key,
+				ConditionExpression:       aws.String(target.Filter),
+				ExpressionAttributeNames:  conditionNames,
+				ExpressionAttributeValues: values,
+			})
+			cancel()
+			if err != nil {
+				var cfe *types.ConditionalCheckFailedException
+				if errors.As(err, &cfe) {
+					continue
+				}
+				return err
+			}
+			result.Purged++
+		}
+	}
+	return nil
+}
+
+// stringAttribute returns a string attribute of an item, empty when missing
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// StartPurger runs Purge for every clinic returned by clinicIDs every
+// interval until ctx is done
+func StartPurger(ctx context.Context, interval time.Duration, clinicIDs func(context.Context) ([]string, error)) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ids, err := clinicIDs(ctx)
+				if err != nil {
+					log.Printf("Error listing clinics for retention purge: %v", err)
+					continue
+				}
+				for _, clinicID := range ids {
+					report, err := Purge(ctx, clinicID, false)
+					if err != nil {
+						log.Printf("Error running retention purge of clinic %s: %v", clinicID, err)
+						continue
+					}
+					for _, target := range report.Targets {
+						if target.Purged > 0 {
+							log.Printf("Retention purge deleted %d %s of clinic %s older than %s", target.Purged, target.Target, clinicID, target.Cutoff)
+						}
+					}
+				}
+			}
+		}
+	}()
+}
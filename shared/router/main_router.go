@@ -1,8 +1,23 @@
 package router
 
 import (
+	admin_router "dental-saas/modules/admin/router"
+	"dental-saas/modules/admin/ui"
+	compliance_router "dental-saas/modules/compliance/router"
 	"dental-saas/modules/dental/router"
+	financial_router "dental-saas/modules/financial/router"
+	staff_router "dental-saas/modules/staff/router"
+	"dental-saas/shared/audit"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/budget"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"dental-saas/shared/health"
+	"dental-saas/shared/inbox"
+	"dental-saas/shared/netpolicy"
+	"dental-saas/shared/provisioning"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -10,6 +25,13 @@ import (
 // NewMainRouter creates the main router that orchestrates all module routers
 func NewMainRouter() *mux.Router {
 	mainRouter := mux.NewRouter()
+	mainRouter.Use(health.Middleware)
+	mainRouter.Use(auth.Middleware(protectedEndpoint))
+	mainRouter.Use(clinics.Middleware(publicEndpoint))
+	mainRouter.Use(audit.Middleware)
+	mainRouter.Use(netpolicy.Middleware(unrestrictedEndpoint))
+	mainRouter.Use(config.ConsistentReads)
+	mainRouter.Use(config.IncludeDeleted)
 
 	// Health check endpoint
 	mainRouter.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -18,22 +40,147 @@ func NewMainRouter() *mux.Router {
 		w.Write([]byte(`{"status":"healthy","service":"dental-saas"}`))
 	}).Methods("GET")
 
+	// Weighted health score used by load balancers to drain degraded instances
+	mainRouter.HandleFunc("/health/score", health.ScoreHandler).Methods("GET")
+
 	// API version info
 	mainRouter.HandleFunc("/api/v1", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"version":"1.0","modules":["dental","financial"]}`))
+		w.Write([]byte(`{"version":"1.0","modules":["dental","financial","staff","compliance"]}`))
 	}).Methods("GET")
 
+	// Staff authentication
+	mainRouter.HandleFunc("/api/v1/auth/register", auth.RegisterHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/auth/login", auth.LoginHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/auth/refresh", auth.RefreshHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/auth/me", auth.MeHandler).Methods("GET")
+	mainRouter.Handle("/api/v1/auth/users/{email}/role", auth.RequireFunc(auth.SetRoleHandler, auth.RoleAdmin)).Methods("PUT")
+	mainRouter.HandleFunc("/api/v1/auth/impersonate", auth.ImpersonateHandler).Methods("POST")
+	mainRouter.Handle("/api/v1/auth/oidc", auth.RequireFunc(auth.OIDCSettingsHandler, auth.RoleAdmin)).Methods("GET")
+	mainRouter.Handle("/api/v1/auth/oidc", auth.RequireFunc(auth.UpdateOIDCSettingsHandler, auth.RoleAdmin)).Methods("PUT")
+	mainRouter.HandleFunc("/api/v1/auth/oidc/login", auth.OIDCLoginHandler).Methods("GET")
+	mainRouter.HandleFunc("/api/v1/auth/oidc/callback", auth.OIDCCallbackHandler).Methods("GET")
+
+	// Provisioning of staff accounts by the identity systems of dental groups
+	mainRouter.HandleFunc("/api/v1/provisioning/clients", provisioning.CreateClientHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/provisioning/clients", provisioning.ListClientsHandler).Methods("GET")
+	mainRouter.HandleFunc("/api/v1/provisioning/clients/{id}", provisioning.DeleteClientHandler).Methods("DELETE")
+	mainRouter.Handle(provisioning.BasePath+"/Users", provisioning.Authenticated(provisioning.ListUsersHandler)).Methods("GET")
+	mainRouter.Handle(provisioning.BasePath+"/Users", provisioning.Authenticated(provisioning.CreateUserHandler)).Methods("POST")
+	mainRouter.Handle(provisioning.BasePath+"/Users/{id}", provisioning.Authenticated(provisioning.GetUserHandler)).Methods("GET")
+	mainRouter.Handle(provisioning.BasePath+"/Users/{id}", provisioning.Authenticated(provisioning.ReplaceUserHandler)).Methods("PUT")
+	mainRouter.Handle(provisioning.BasePath+"/Users/{id}", provisioning.Authenticated(provisioning.PatchUserHandler)).Methods("PATCH")
+	mainRouter.Handle(provisioning.BasePath+"/Users/{id}", provisioning.Authenticated(provisioning.DeleteUserHandler)).Methods("DELETE")
+
+	// Clinics sharing the deployment
+	mainRouter.HandleFunc("/api/v1/clinics", clinics.CreateHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/clinics", clinics.ListHandler).Methods("GET")
+	mainRouter.HandleFunc("/api/v1/clinics/current", clinics.CurrentHandler).Methods("GET")
+
+	// Organizations of dental groups owning several clinics
+	mainRouter.HandleFunc("/api/v1/organizations", clinics.CreateOrganizationHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/organizations", clinics.ListOrganizationsHandler).Methods("GET")
+	mainRouter.HandleFunc("/api/v1/organizations/{id}", clinics.GetOrganizationHandler).Methods("GET")
+	mainRouter.HandleFunc("/api/v1/organizations/{id}/sharing", clinics.SetSharingPolicyHandler).Methods("PUT")
+	mainRouter.HandleFunc("/api/v1/organizations/{id}/clinics/{clinicId}", clinics.AddOrganizationClinicHandler).Methods("PUT")
+	mainRouter.HandleFunc("/api/v1/organizations/{id}/clinics/{clinicId}", clinics.RemoveOrganizationClinicHandler).Methods("DELETE")
+	mainRouter.HandleFunc("/api/v1/organizations/{id}/users/{email}", clinics.SetGroupRoleHandler).Methods("PUT")
+	mainRouter.HandleFunc("/api/v1/organizations/{id}/users/{email}", clinics.ClearGroupRoleHandler).Methods("DELETE")
+
+	// In-app notifications of the requesting staff member
+	mainRouter.HandleFunc("/api/v1/notifications", inbox.ListHandler).Methods("GET")
+	mainRouter.HandleFunc("/api/v1/notifications/read-all", inbox.MarkAllReadHandler).Methods("POST")
+	mainRouter.HandleFunc("/api/v1/notifications/{id}/read", inbox.MarkReadHandler).Methods("POST")
+
+	// Audit log of the clinic's records
+	mainRouter.Handle("/api/v1/audit", budget.List(auth.RequireFunc(audit.ListHandler, auth.RoleAdmin))).Methods("GET")
+
 	// Register dental module routes
 	dentalRouter := router.NewDentalRouter()
 	mainRouter.PathPrefix("/api/v1/dental").Handler(dentalRouter)
 
-	// TODO: Register financial module routes when implemented
-	// financialRouter := financial_router.NewFinancialRouter()
-	// mainRouter.PathPrefix("/api/v1/financial").Handler(financialRouter)
+	// Register financial module routes
+	financialRouter := financial_router.NewFinancialRouter()
+	mainRouter.PathPrefix("/api/v1/financial").Handler(financialRouter)
+
+	// Register staff module routes
+	staffRouter := staff_router.NewStaffRouter()
+	mainRouter.PathPrefix("/api/v1/staff").Handler(staffRouter)
+
+	// Register compliance module routes
+	complianceRouter := compliance_router.NewComplianceRouter()
+	mainRouter.PathPrefix("/api/v1/compliance").Handler(complianceRouter)
+
+	// Register admin routes
+	adminRouter := admin_router.NewAdminRouter()
+	mainRouter.PathPrefix("/api/v1/admin").Handler(adminRouter)
+
+	// Embedded operator UI
+	mainRouter.Handle("/admin", http.RedirectHandler("/admin/", http.StatusMovedPermanently))
+	mainRouter.PathPrefix("/admin/").Handler(ui.Handler())
 
 	// TODO: Register other future modules here
 
+	// 405 responses list the methods the path accepts in the Allow header.
+	// Each router bounds its own routes by their time budget; the lists
+	// marked with budget.List where they are registered get the list budget.
+	for _, r := range []*mux.Router{mainRouter, dentalRouter, financialRouter, staffRouter, complianceRouter, adminRouter} {
+		r.MethodNotAllowedHandler = unmatched(r)
+		r.NotFoundHandler = unmatched(r)
+		r.Use(budget.Middleware)
+	}
+	mustNotConflict(mainRouter, dentalRouter, financialRouter, staffRouter, complianceRouter, adminRouter)
+
 	return mainRouter
-}
\ No newline at end of file
+}
+
+// publicEndpoint reports the endpoints reached by load balancers, patients
+// and identity systems, which the clinic's network policy never restricts
+func publicEndpoint(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case path == "/api/v1" || strings.HasPrefix(path, "/health") || strings.HasPrefix(path, "/swagger/"):
+		return true
+	case path == "/api/v1/dental/booking" || path == "/api/v1/dental/booking/slots":
+		return true
+	case strings.HasPrefix(path, "/api/v1/dental/survey/") && !strings.HasPrefix(path, "/api/v1/dental/survey/follow-ups"):
+		return true
+	case strings.HasPrefix(path, "/api/v1/dental/self-service/"):
+		return true
+	case strings.HasPrefix(path, "/api/v1/financial/shared/"):
+		return true
+	case strings.HasPrefix(path, provisioning.BasePath+"/"):
+		return true
+	}
+	return false
+}
+
+// loginEndpoint reports the endpoints that log users in, which check the
+// credentials they are sent themselves. Registering the first user needs no
+// token either; RegisterHandler requires one once any user exists.
+func loginEndpoint(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/v1/auth/register", "/api/v1/auth/login", "/api/v1/auth/refresh",
+		"/api/v1/auth/oidc/login", "/api/v1/auth/oidc/callback":
+		return true
+	}
+	return false
+}
+
+// unrestrictedEndpoint reports the endpoints the network policy never
+// restricts: the public ones and the logins, made before the user's clinic
+// is known. The clinic's policy applies from the first authenticated request.
+func unrestrictedEndpoint(r *http.Request) bool {
+	return publicEndpoint(r) || loginEndpoint(r)
+}
+
+// protectedEndpoint reports the endpoints that require a logged-in user:
+// every API endpoint except the public ones and the logins, so routes added
+// later are protected unless they are listed there, and the admin UI's API
+func protectedEndpoint(r *http.Request) bool {
+	if r.Method == http.MethodOptions || unrestrictedEndpoint(r) {
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/v1/") || strings.HasPrefix(r.URL.Path, "/admin/api/")
+}
@@ -0,0 +1,177 @@
+package router
+
+import (
+	"dental-saas/shared/apierror"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatched answers requests no route of r accepted. For a path with routes
+// it answers OPTIONS with the methods the path accepts and other methods with
+// 405, listing them in the Allow header; other paths get 404. mux's own
+// method mismatch detection cannot be relied on, as a later route sharing
+// the subrouter prefix clears it.
+func unmatched(r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		allowed := allowedMethods(r, req)
+		if len(allowed) == 0 {
+			apierror.Write(w, req, http.StatusNotFound, apierror.CodeNotFound, "No endpoint at this path", nil)
+			return
+		}
+		allowed = append(allowed, http.MethodOptions)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		if req.Method != http.MethodOptions {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(routeOptions{Path: req.URL.Path, Methods: allowed})
+	})
+}
+
+// routeOptions is the body of OPTIONS responses
+type routeOptions struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// allowedMethods returns, sorted, the methods r routes for the path of req
+func allowedMethods(r *mux.Router, req *http.Request) []string {
+	declared := map[string]bool{}
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			declared[method] = true
+		}
+		return nil
+	})
+
+	allowed := []string{}
+	for method := range declared {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if r.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// StripTrailingSlash serves API paths with a trailing slash as the path
+// without it, so /api/v1/dental/patient/ reaches the same route as
+// /api/v1/dental/patient. It wraps the router because mux middlewares only
+// run after a route matched.
+func StripTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if len(path) > 1 && strings.HasSuffix(path, "/") && (strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/health/")) {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = strings.TrimRight(path, "/")
+			r2.URL.RawPath = ""
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeInfo is a route as registered, in registration order
+type routeInfo struct {
+	template string
+	methods  []string
+}
+
+// CheckRouteConflicts reports routes that can never be reached because a
+// route registered before them in the same router matches all of their paths
+// for one of their methods, e.g. GET /patient/{id} registered before
+// GET /patient/batch-get
+func CheckRouteConflicts(routers ...*mux.Router) error {
+	var conflicts []string
+	for _, r := range routers {
+		var routes []routeInfo
+		r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			if route.GetHandler() == nil {
+				return nil
+			}
+			template, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, _ := route.GetMethods()
+			routes = append(routes, routeInfo{template: template, methods: methods})
+			return nil
+		})
+
+		for j, later := range routes {
+			for _, earlier := range routes[:j] {
+				if method, ok := sharedMethod(earlier.methods, later.methods); ok && shadows(earlier.template, later.template) {
+					conflicts = append(conflicts, fmt.Sprintf("%s %s is shadowed by %s", method, later.template, earlier.template))
+					break
+				}
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("route conflicts: %s", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// mustNotConflict stops the service at startup when routes conflict
+func mustNotConflict(routers ...*mux.Router) {
+	if err := CheckRouteConflicts(routers...); err != nil {
+		log.Fatalf("Invalid routes: %v", err)
+	}
+}
+
+// sharedMethod returns a method both routes accept; a route without methods
+// accepts all of them
+func sharedMethod(a, b []string) (string, bool) {
+	if len(a) == 0 && len(b) == 0 {
+		return "*", true
+	}
+	if len(a) == 0 {
+		return b[0], true
+	}
+	if len(b) == 0 {
+		return a[0], true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return x, true
+			}
+		}
+	}
+	return "", false
+}
+
+// shadows reports whether every path matched by the later template is also
+// matched by the earlier one. Variables are assumed to match any segment.
+func shadows(earlier, later string) bool {
+	e := strings.Split(earlier, "/")
+	l := strings.Split(later, "/")
+	if len(e) != len(l) {
+		return false
+	}
+	for i := range e {
+		switch {
+		case isVariable(e[i]):
+		case isVariable(l[i]) || e[i] != l[i]:
+			return false
+		}
+	}
+	return true
+}
+
+func isVariable(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
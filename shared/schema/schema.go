@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema describes the JSON representation of a resource, in the subset of
+// JSON Schema form builders need
+type Schema struct {
+	Title      string             `json:"title,omitempty"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format,omitempty"`
+	ReadOnly   bool               `json:"readOnly,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+}
+
+// serverFields are set by the service on every resource and never accepted
+// from clients
+var serverFields = map[string]bool{"id": true, "created_at": true, "updated_at": true}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Of describes the struct v. Fields not stored with the resource (expanded
+// relations) and the ID and timestamps are read-only. required lists the
+// JSON names of the fields the resource's IsValid demands.
+func Of(title string, v interface{}, required ...string) *Schema {
+	s := describe(reflect.TypeOf(v))
+	s.Title = title
+	s.Required = required
+	return s
+}
+
+// Handler serves the schema of a resource, e.g. at /patient/$schema
+func Handler(title string, v interface{}, required ...string) http.HandlerFunc {
+	s := Of(title, v, required...)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		json.NewEncoder(w).Encode(s)
+	}
+}
+
+func describe(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: describe(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object"}
+	case t.Kind() == reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(s, t)
+		return s
+	}
+	return &Schema{Type: "string"}
+}
+
+// addFields adds the exported fields of t to s, flattening embedded structs
+// as encoding/json does
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(s, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := describe(field.Type)
+		if serverFields[name] || field.Tag.Get("dynamodbav") == "-" {
+			property.ReadOnly = true
+		}
+		s.Properties[name] = property
+	}
+}
@@ -0,0 +1,85 @@
+// Package versioning implements the optimistic locking of updates: a client
+// sends back the version of the record it read, in the If-Match header or
+// the version field of the body, and the update fails with 409 Conflict when
+// the record was changed since, instead of overwriting that change.
+package versioning
+
+import (
+	"bytes"
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/config"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxBodySize bounds the bodies read for their version
+const maxBodySize = 1 << 20
+
+var (
+	// ErrMissing is returned for updates that do not say which version they change
+	ErrMissing = errors.New("send the version of the record being updated in the If-Match header or the version field of the body")
+	// ErrInvalid is returned for versions that are not a non-negative number
+	ErrInvalid = errors.New("the If-Match header must be the version of the record, such as \"3\"")
+)
+
+// Expected returns the version of the record an update was made from: the
+// If-Match header (3, "3" or W/"3") when sent, else the version field of the
+// body. The body is left for the handler to read.
+func Expected(r *http.Request) (int64, error) {
+	if header := strings.TrimSpace(r.Header.Get("If-Match")); header != "" {
+		tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+		version, err := strconv.ParseInt(tag, 10, 64)
+		if err != nil || version < 0 {
+			return 0, ErrInvalid
+		}
+		return version, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return 0, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var fields struct {
+		Version *int64 `json:"version"`
+	}
+	if json.Unmarshal(body, &fields) != nil || fields.Version == nil {
+		return 0, ErrMissing
+	}
+	if *fields.Version < 0 {
+		return 0, ErrInvalid
+	}
+	return *fields.Version, nil
+}
+
+// Require reads the version an update of the record of table with the ID
+// was made from, returning the request with a context that expects it
+// (config.WithVersion). Without a version it writes 428 Precondition
+// Required and returns false.
+func Require(w http.ResponseWriter, r *http.Request, table, id string) (*http.Request, int64, bool) {
+	version, err := Expected(r)
+	switch {
+	case errors.Is(err, ErrMissing):
+		apierror.Write(w, r, http.StatusPreconditionRequired, apierror.CodePreconditionRequired, err.Error(), nil)
+		return r, 0, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return r, 0, false
+	}
+	return r.WithContext(config.WithVersion(r.Context(), table, id, version)), version, true
+}
+
+// Conflict writes 409 Conflict when err is a write that found the record
+// changed since the version it expected, reporting whether it did
+func Conflict(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, config.ErrVersionConflict) {
+		return false
+	}
+	apierror.Write(w, r, http.StatusConflict, apierror.CodeVersionConflict,
+		"The record was changed by someone else since it was read; load it again and reapply the changes", nil)
+	return true
+}
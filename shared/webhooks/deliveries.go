@@ -0,0 +1,633 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"dental-saas/shared/config"
+	"dental-saas/shared/egress"
+	"dental-saas/shared/health"
+	"dental-saas/shared/paging"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// DeliveriesTable holds the deliveries of events to the subscriptions with
+// their attempts. It is keyed by ClinicID and a time-ordered ID.
+const DeliveriesTable = "WebhookDeliveries"
+
+// SignatureHeader carries the signature of the payload: t=<unix time>,v1=<hex
+// HMAC-SHA256 of "<unix time>.<body>" with the subscription's secret>
+const SignatureHeader = "X-Webhook-Signature"
+
+// Delivery status of the events
+const (
+	DeliveryPending   = "pending" // waiting for its first or next attempt
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // ran out of attempts or the subscription was removed
+)
+
+// DeliveryStatuses lists the delivery statuses
+var DeliveryStatuses = []string{DeliveryPending, DeliveryDelivered, DeliveryFailed}
+
+// ErrDeliveryNotFound is returned for deliveries the clinic does not have
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// maxRetryDelay bounds the wait before another attempt of a delivery
+const maxRetryDelay = 6 * time.Hour
+
+// dispatchBatch is how many due deliveries the dispatcher claims at a time
+const dispatchBatch = 10
+
+// pending is the count of pending deliveries last taken by the dispatcher
+var pending atomic.Int64
+
+// Attempt is one try to post an event
+type Attempt struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"status_code,omitempty"` // response status, absent when the request failed
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Delivery is an event sent to one subscription, with its status and attempts
+type Delivery struct {
+	ClinicID       string    `json:"clinic_id"`
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        string    `json:"event_id"`
+	Event          string    `json:"event"`
+	URL            string    `json:"url"`
+	Payload        string    `json:"payload"` // the JSON body posted
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	NextAttemptAt  string    `json:"next_attempt_at,omitempty" dynamodbav:",omitempty"` // while pending
+	History        []Attempt `json:"history,omitempty" dynamodbav:",omitempty"`
+	CreatedAt      string    `json:"created_at"`
+	UpdatedAt      string    `json:"updated_at"`
+	DeliveredAt    string    `json:"delivered_at,omitempty" dynamodbav:",omitempty"`
+}
+
+// enqueue records a pending delivery of an event payload to a subscription
+func enqueue(ctx context.Context, subscription Subscription, event Event, payload []byte, now time.Time) error {
+	item, err := attributevalue.MarshalMap(Delivery{
+		ClinicID:       subscription.ClinicID,
+		ID:             config.ChangeSeq(now) + "-" + uuid.NewString()[:8],
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		Event:          event.Type,
+		URL:            subscription.URL,
+		Payload:        string(payload),
+		Status:         DeliveryPending,
+		NextAttemptAt:  now.UTC().Format(time.RFC3339),
+		CreatedAt:      now.UTC().Format(time.RFC3339),
+		UpdatedAt:      now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, subscription.ClinicID))
+	defer cancel()
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(DeliveriesTable),
+		Item:      item,
+	})
+	return err
+}
+
+// Deliveries reads a page of the clinic's deliveries, the latest first,
+// optionally only those of a subscription or in a status
+func Deliveries(ctx context.Context, clinicID, subscriptionID, status string, page paging.Page) ([]Delivery, string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(DeliveriesTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	var filters []string
+	if subscriptionID != "" {
+		filters = append(filters, "SubscriptionID = :subscription")
+		input.ExpressionAttributeValues[":subscription"] = &types.AttributeValueMemberS{Value: subscriptionID}
+	}
+	if status != "" {
+		filters = append(filters, "#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	return paging.Query[Delivery](config.WithClinic(ctx, clinicID), input, page)
+}
+
+// DeliveryOverview is the state of the deliveries of every clinic, shown to
+// operators in the admin UI
+type DeliveryOverview struct {
+	Pending int        `json:"pending"`
+	Failed  int        `json:"failed"`
+	Recent  []Delivery `json:"recent"` // the latest deliveries, without their payloads and attempts
+}
+
+// recentDeliveries is how many deliveries the overview lists
+const recentDeliveries = 20
+
+// Overview counts the pending and failed deliveries of every clinic, in
+// every region, and lists the latest ones
+func Overview(ctx context.Context) (DeliveryOverview, error) {
+	var deliveries []Delivery
+	err := config.EachRegion(ctx, func(ctx context.Context) error {
+		found, err := paging.ScanAll[Delivery](ctx, &dynamodb.ScanInput{
+			TableName: aws.String(DeliveriesTable),
+		})
+		deliveries = append(deliveries, found...)
+		return err
+	})
+	if err != nil {
+		return DeliveryOverview{}, err
+	}
+
+	overview := DeliveryOverview{Recent: []Delivery{}}
+	for _, delivery := range deliveries {
+		switch delivery.Status {
+		case DeliveryPending:
+			overview.Pending++
+		case DeliveryFailed:
+			overview.Failed++
+		}
+	}
+	// IDs start with the time of the event, so they order deliveries across
+	// clinics too
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > recentDeliveries {
+		deliveries = deliveries[:recentDeliveries]
+	}
+	for _, delivery := range deliveries {
+		delivery.Payload = ""
+		delivery.History = nil
+		overview.Recent = append(overview.Recent, delivery)
+	}
+	return overview, nil
+}
+
+// GetDelivery returns one of the clinic's deliveries
+func GetDelivery(ctx context.Context, clinicID, id string) (Delivery, error) {
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, clinicID))
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(DeliveriesTable),
+		Key:            deliveryKey(clinicID, id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Delivery{}, fmt.Errorf("fetching webhook delivery %s: %v", id, err)
+	}
+	if result.Item == nil {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	var delivery Delivery
+	if err := attributevalue.UnmarshalMap(result.Item, &delivery); err != nil {
+		return Delivery{}, err
+	}
+	return delivery, nil
+}
+
+// Redeliver sends a delivery again, with a fresh count of attempts. Pending
+// deliveries are only moved to the front.
+func Redeliver(ctx context.Context, clinicID, id string) (Delivery, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	opCtx, cancel := config.DBContext(config.WithClinic(ctx, clinicID))
+	result, err := config.DBClient.UpdateItem(opCtx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(DeliveriesTable),
+		Key:                      deliveryKey(clinicID, id),
+		UpdateExpression:         aws.String("SET #status = :pending, NextAttemptAt = :now, Attempts = :zero, UpdatedAt = :now"),
+		ConditionExpression:      aws.String("attribute_exists(ID)"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: DeliveryPending},
+			":now":     &types.AttributeValueMemberS{Value: now},
+			":zero":    &types.AttributeValueMemberN{Value: "0"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	cancel()
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+	var delivery Delivery
+	if err := attributevalue.UnmarshalMap(result.Attributes, &delivery); err != nil {
+		return Delivery{}, err
+	}
+	wake()
+	return delivery, nil
+}
+
+// wakeup tells the dispatcher new deliveries are due
+var wakeup = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// StartDispatcher posts the due deliveries of every clinic until ctx is
+// done, checking every interval and right after events are published. A
+// failed attempt is retried after WEBHOOK_RETRY_DELAY, doubled after every
+// failure up to 6 hours; after WEBHOOK_MAX_ATTEMPTS the delivery fails.
+// Delivered ones are removed after WEBHOOK_DELIVERY_RETENTION. The pending
+// deliveries, counted whenever the dispatcher catches up, are reported to
+// the health score as the "webhooks" backlog, full at WEBHOOK_BACKLOG_LIMIT.
+func StartDispatcher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	client := egress.NewClient(config.EnvDuration("WEBHOOK_TIMEOUT", 10*time.Second), allowPrivate)
+	retryDelay := config.EnvDuration("WEBHOOK_RETRY_DELAY", 30*time.Second)
+	maxAttempts := config.EnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	retention := config.EnvDuration("WEBHOOK_DELIVERY_RETENTION", 30*24*time.Hour)
+
+	health.RegisterBacklog("webhooks", func() int { return int(pending.Load()) }, config.EnvInt("WEBHOOK_BACKLOG_LIMIT", 1000))
+
+	if retention > 0 {
+		go prune(ctx, retention)
+	}
+
+	go func() {
+		for {
+			deliveries, err := receive(ctx, dispatchBatch, 2*client.Timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Error receiving webhook deliveries: %v", err)
+			}
+			for _, delivery := range deliveries {
+				dispatch(ctx, client, delivery, maxAttempts, retryDelay)
+			}
+			if len(deliveries) < dispatchBatch {
+				if n, err := countPending(ctx); err != nil {
+					log.Printf("Error counting pending webhook deliveries: %v", err)
+				} else {
+					pending.Store(int64(n))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-wakeup:
+				case <-time.After(interval):
+				}
+			}
+		}
+	}()
+}
+
+// receive claims up to max pending deliveries whose next attempt is due,
+// hiding them for visibility. A delivery claimed by another instance first
+// is skipped. The deliveries of every region are read in turn.
+func receive(ctx context.Context, max int, visibility time.Duration) ([]Delivery, error) {
+	now := time.Now().UTC()
+	var claimed []Delivery
+	err := config.EachRegion(ctx, func(ctx context.Context) error {
+		if len(claimed) == max {
+			return nil
+		}
+		received, err := receiveRegion(ctx, max-len(claimed), now, visibility)
+		claimed = append(claimed, received...)
+		return err
+	})
+	return claimed, err
+}
+
+// receiveRegion claims the due deliveries of the region of ctx
+func receiveRegion(ctx context.Context, max int, now time.Time, visibility time.Duration) ([]Delivery, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(DeliveriesTable),
+		FilterExpression:         aws.String("#status = :pending AND NextAttemptAt <= :now"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: DeliveryPending},
+			":now":     &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		},
+	}
+
+	var claimed []Delivery
+	for {
+		scanCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(scanCtx, input)
+		cancel()
+		if err != nil {
+			return claimed, fmt.Errorf("scanning webhook deliveries: %v", err)
+		}
+		var due []Delivery
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &due); err != nil {
+			return claimed, err
+		}
+		for _, delivery := range due {
+			if len(claimed) == max {
+				return claimed, nil
+			}
+			ok, err := claim(ctx, &delivery, now.Add(visibility))
+			if err != nil {
+				log.Printf("Error claiming webhook delivery %s: %v", delivery.ID, err)
+				continue
+			}
+			if ok {
+				claimed = append(claimed, delivery)
+			}
+		}
+		if result.LastEvaluatedKey == nil {
+			return claimed, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// claim hides a due delivery until hiddenUntil and counts the attempt,
+// returning false when another instance claimed it first
+func claim(ctx context.Context, delivery *Delivery, hiddenUntil time.Time) (bool, error) {
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, delivery.ClinicID))
+	defer cancel()
+	_, err := config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(DeliveriesTable),
+		Key:                      deliveryKey(delivery.ClinicID, delivery.ID),
+		UpdateExpression:         aws.String("SET NextAttemptAt = :hidden, Attempts = Attempts + :one"),
+		ConditionExpression:      aws.String("#status = :pending AND NextAttemptAt = :seen"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hidden":  &types.AttributeValueMemberS{Value: hiddenUntil.Format(time.RFC3339)},
+			":one":     &types.AttributeValueMemberN{Value: "1"},
+			":pending": &types.AttributeValueMemberS{Value: DeliveryPending},
+			":seen":    &types.AttributeValueMemberS{Value: delivery.NextAttemptAt},
+		},
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	delivery.Attempts++
+	delivery.NextAttemptAt = hiddenUntil.Format(time.RFC3339)
+	return true, nil
+}
+
+// dispatch posts a claimed delivery and records the attempt: delivered on a
+// 2xx response, otherwise retried after the backoff or, out of attempts,
+// failed. Deliveries of removed subscriptions fail at once.
+func dispatch(ctx context.Context, client *http.Client, delivery Delivery, maxAttempts int, retryDelay time.Duration) {
+	started := time.Now()
+	attempt := Attempt{At: started.UTC().Format(time.RFC3339)}
+
+	subscription, err := GetSubscription(ctx, delivery.ClinicID, delivery.SubscriptionID)
+	final := false
+	switch {
+	case errors.Is(err, ErrSubscriptionNotFound):
+		attempt.Error, final = "subscription was removed", true
+	case err != nil:
+		attempt.Error = err.Error()
+	default:
+		attempt.StatusCode, err = post(ctx, client, delivery, subscription.Secret, started)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+	attempt.DurationMS = time.Since(started).Milliseconds()
+
+	status, next := DeliveryDelivered, ""
+	if attempt.Error != "" {
+		if final || delivery.Attempts >= maxAttempts {
+			status = DeliveryFailed
+			log.Printf("Webhook delivery %s failed after %d attempts: %s", delivery.ID, delivery.Attempts, attempt.Error)
+		} else {
+			status = DeliveryPending
+			next = time.Now().Add(backoff(retryDelay, delivery.Attempts)).UTC().Format(time.RFC3339)
+		}
+	}
+	if err := settle(ctx, delivery, attempt, status, next); err != nil {
+		log.Printf("Error recording attempt of webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// post sends the payload signed with secret, returning the response status
+func post(ctx context.Context, client *http.Client, delivery Delivery, secret string, at time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dental-saas-webhooks")
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set(SignatureHeader, Sign(secret, at, []byte(delivery.Payload)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a payload sent at at
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// settle records an attempt and the resulting status of a delivery. A
+// delivery settled by an instance that claimed it again after its
+// visibility expired, or sent again meanwhile, is left as is.
+func settle(ctx context.Context, delivery Delivery, attempt Attempt, status, next string) error {
+	recorded, err := attributevalue.MarshalList([]Attempt{attempt})
+	if err != nil {
+		return err
+	}
+	update := "SET #status = :status, UpdatedAt = :now, History = list_append(if_not_exists(History, :empty), :attempt)"
+	values := map[string]types.AttributeValue{
+		":status":  &types.AttributeValueMemberS{Value: status},
+		":now":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		":empty":   &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+		":attempt": &types.AttributeValueMemberL{Value: recorded},
+		":pending": &types.AttributeValueMemberS{Value: DeliveryPending},
+		":claimed": &types.AttributeValueMemberS{Value: delivery.NextAttemptAt},
+	}
+	switch {
+	case next != "":
+		update += ", NextAttemptAt = :next"
+		values[":next"] = &types.AttributeValueMemberS{Value: next}
+	case status == DeliveryDelivered:
+		update += ", DeliveredAt = :now REMOVE NextAttemptAt"
+	default:
+		update += " REMOVE NextAttemptAt"
+	}
+
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, delivery.ClinicID))
+	defer cancel()
+	_, err = config.DBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(DeliveriesTable),
+		Key:                       deliveryKey(delivery.ClinicID, delivery.ID),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("#status = :pending AND NextAttemptAt = :claimed"),
+		ExpressionAttributeNames:  map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: values,
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return nil
+	}
+	return err
+}
+
+// backoff is the wait before another attempt of a delivery that failed
+// attempts times: delay, doubled after every failure, up to maxRetryDelay
+func backoff(delay time.Duration, attempts int) time.Duration {
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// prune removes the deliveries delivered before the retention period, once
+// a day until ctx is done
+func prune(ctx context.Context, retention time.Duration) {
+	for {
+		n, err := pruneDelivered(ctx, time.Now().Add(-retention))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Error pruning webhook deliveries: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d delivered webhook events", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(24 * time.Hour):
+		}
+	}
+}
+
+// pruneDelivered removes the deliveries of every region delivered before
+// before, returning how many were removed
+func pruneDelivered(ctx context.Context, before time.Time) (int, error) {
+	removed := 0
+	err := config.EachRegion(ctx, func(ctx context.Context) error {
+		n, err := pruneRegion(ctx, before)
+		removed += n
+		return err
+	})
+	return removed, err
+}
+
+// pruneRegion removes the deliveries of the region of ctx delivered before
+// before
+func pruneRegion(ctx context.Context, before time.Time) (int, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(DeliveriesTable),
+		FilterExpression:         aws.String("#status = :delivered AND DeliveredAt < :cutoff"),
+		ProjectionExpression:     aws.String("ClinicID, ID"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delivered": &types.AttributeValueMemberS{Value: DeliveryDelivered},
+			":cutoff":    &types.AttributeValueMemberS{Value: before.UTC().Format(time.RFC3339)},
+		},
+	}
+
+	removed := 0
+	for {
+		scanCtx, cancel := config.DBContext(ctx)
+		result, err := config.DBClient.Scan(scanCtx, input)
+		cancel()
+		if err != nil {
+			return removed, fmt.Errorf("scanning delivered webhook events: %v", err)
+		}
+		for _, item := range result.Items {
+			deleteCtx, cancel := config.DBContext(ctx)
+			_, err := config.DBClient.DeleteItem(deleteCtx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(DeliveriesTable),
+				Key:       map[string]types.AttributeValue{"ClinicID": item["ClinicID"], "ID": item["ID"]},
+			})
+			cancel()
+			if err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if result.LastEvaluatedKey == nil {
+			return removed, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// countPending counts the pending deliveries of every region, due or
+// waiting for a retry
+func countPending(ctx context.Context) (int, error) {
+	count := 0
+	err := config.EachRegion(ctx, func(ctx context.Context) error {
+		input := &dynamodb.ScanInput{
+			TableName:                aws.String(DeliveriesTable),
+			FilterExpression:         aws.String("#status = :pending"),
+			ExpressionAttributeNames: map[string]string{"#status": "Status"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pending": &types.AttributeValueMemberS{Value: DeliveryPending},
+			},
+			Select: types.SelectCount,
+		}
+		for {
+			scanCtx, cancel := config.DBContext(ctx)
+			result, err := config.DBClient.Scan(scanCtx, input)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("counting pending webhook deliveries: %v", err)
+			}
+			count += int(result.Count)
+			if result.LastEvaluatedKey == nil {
+				return nil
+			}
+			input.ExclusiveStartKey = result.LastEvaluatedKey
+		}
+	})
+	return count, err
+}
+
+func deliveryKey(clinicID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		"ID":       &types.AttributeValueMemberS{Value: id},
+	}
+}
@@ -0,0 +1,11 @@
+package webhooks
+
+import "dental-saas/shared/config"
+
+// allowPrivate lets subscriptions reach loopback and private networks, to
+// receive events on a development machine. Off in production, where such
+// URLs would let a clinic probe the deployment's internal services and the
+// cloud metadata endpoint (see the egress package).
+func allowPrivate() bool {
+	return config.Feature("WEBHOOK_ALLOW_PRIVATE_NETWORKS")
+}
@@ -0,0 +1,264 @@
+// Package webhooks publishes changes to the clinic's records to the URLs the
+// clinic subscribed. Every event is delivered as a signed JSON payload to
+// each subscription, retried with exponential backoff, and every delivery is
+// kept with its attempts for the clinic to inspect.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"dental-saas/shared/config"
+	"dental-saas/shared/egress"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// SubscriptionsTable holds the webhook subscriptions, keyed by ClinicID and ID
+const SubscriptionsTable = "WebhookSubscriptions"
+
+// Events published to the subscriptions
+const (
+	EventAppointmentCreated = "appointment.created"
+	EventPatientUpdated     = "patient.updated"
+	EventInvoiceIssued      = "invoice.issued"
+	EventRevenuePaid        = "revenue.paid"
+)
+
+// Events lists the events a subscription can receive
+var Events = []string{EventAppointmentCreated, EventPatientUpdated, EventInvoiceIssued, EventRevenuePaid}
+
+// ErrSubscriptionNotFound is returned for subscriptions the clinic does not have
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+// Subscription is a URL that receives the clinic's events. The secret signs
+// the payloads; it is only shown when the subscription is created and when
+// it is rotated.
+type Subscription struct {
+	ClinicID    string   `json:"clinic_id"`
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty" dynamodbav:",omitempty"`
+	Disabled    bool     `json:"disabled,omitempty"` // kept, but receives no events
+	Secret      string   `json:"secret,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+// IsValid checks the URL and the events, dropping repeated events. Plain
+// http URLs are only accepted with WEBHOOK_ALLOW_HTTP. The host is resolved
+// and must only have public addresses, unless WEBHOOK_ALLOW_PRIVATE_NETWORKS
+// is set.
+func (s *Subscription) IsValid() error {
+	target, err := url.Parse(s.URL)
+	if err != nil || target.Host == "" || (target.Scheme != "https" && target.Scheme != "http") {
+		return fmt.Errorf("url must be an absolute https URL")
+	}
+	if target.Scheme == "http" && !config.Feature("WEBHOOK_ALLOW_HTTP") {
+		return fmt.Errorf("url must use https")
+	}
+	if len(s.Events) == 0 {
+		return fmt.Errorf("events is required")
+	}
+	var events []string
+	for _, event := range s.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	s.Events = events
+	if len(s.Description) > 200 {
+		return fmt.Errorf("description must have at most 200 characters")
+	}
+	return egress.CheckHost(target.Hostname(), allowPrivate())
+}
+
+// Receives reports whether the subscription is enabled and subscribed to event
+func (s Subscription) Receives(event string) bool {
+	return !s.Disabled && slices.Contains(s.Events, event)
+}
+
+// Event is the JSON payload posted to the subscriptions
+type Event struct {
+	ID        string          `json:"id"` // the same in every delivery and attempt of the event
+	Type      string          `json:"type"`
+	ClinicID  string          `json:"clinic_id"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Publish records a delivery of the event, with data as its payload, for
+// each subscription of the clinic in ctx that receives it, and wakes the
+// dispatcher. The change is already saved, so failures are only logged.
+func Publish(ctx context.Context, event string, data any) {
+	clinicID := config.ClinicID(ctx)
+	subscriptions, err := Subscriptions(ctx, clinicID)
+	if err != nil {
+		log.Printf("Error reading webhook subscriptions of clinic %s: %v", clinicID, err)
+		return
+	}
+	var receivers []Subscription
+	for _, subscription := range subscriptions {
+		if subscription.Receives(event) {
+			receivers = append(receivers, subscription)
+		}
+	}
+	if len(receivers) == 0 {
+		return
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error marshaling %s webhook payload: %v", event, err)
+		return
+	}
+	now := time.Now()
+	envelope := Event{
+		ID:        "evt_" + uuid.NewString(),
+		Type:      event,
+		ClinicID:  clinicID,
+		CreatedAt: now.UTC().Format(time.RFC3339),
+		Data:      raw,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Error marshaling %s webhook event: %v", event, err)
+		return
+	}
+	for _, subscription := range receivers {
+		if err := enqueue(ctx, subscription, envelope, payload, now); err != nil {
+			log.Printf("Error recording %s webhook delivery to subscription %s: %v", event, subscription.ID, err)
+		}
+	}
+	wake()
+}
+
+// Subscriptions returns the clinic's subscriptions, without their secrets
+func Subscriptions(ctx context.Context, clinicID string) ([]Subscription, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(SubscriptionsTable),
+		KeyConditionExpression: aws.String("ClinicID = :clinic"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clinic": &types.AttributeValueMemberS{Value: clinicID},
+		},
+	}
+
+	subscriptions := []Subscription{}
+	paginator := dynamodb.NewQueryPaginator(config.DBClient, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := config.DBContext(config.WithClinic(ctx, clinicID))
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("querying webhook subscriptions: %v", err)
+		}
+		var found []Subscription
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &found); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, found...)
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns one of the clinic's subscriptions with its secret
+func GetSubscription(ctx context.Context, clinicID, id string) (Subscription, error) {
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, clinicID))
+	defer cancel()
+
+	result, err := config.DBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(SubscriptionsTable),
+		Key:            subscriptionKey(clinicID, id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Subscription{}, fmt.Errorf("fetching webhook subscription %s: %v", id, err)
+	}
+	if result.Item == nil {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	var subscription Subscription
+	if err := attributevalue.UnmarshalMap(result.Item, &subscription); err != nil {
+		return Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// SaveSubscription writes a subscription, which must not exist yet when
+// created is set and must exist otherwise
+func SaveSubscription(ctx context.Context, subscription Subscription, created bool) error {
+	item, err := attributevalue.MarshalMap(subscription)
+	if err != nil {
+		return err
+	}
+	condition := "attribute_exists(ID)"
+	if created {
+		condition = "attribute_not_exists(ID)"
+	}
+
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, subscription.ClinicID))
+	defer cancel()
+
+	_, err = config.DBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(SubscriptionsTable),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) && !created {
+		return ErrSubscriptionNotFound
+	}
+	return err
+}
+
+// DeleteSubscription removes a subscription. Its pending deliveries fail on
+// their next attempt; past deliveries stay in the log.
+func DeleteSubscription(ctx context.Context, clinicID, id string) error {
+	ctx, cancel := config.DBContext(config.WithClinic(ctx, clinicID))
+	defer cancel()
+
+	_, err := config.DBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(SubscriptionsTable),
+		Key:                 subscriptionKey(clinicID, id),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+	})
+	var cfe *types.ConditionalCheckFailedException
+	if errors.As(err, &cfe) {
+		return ErrSubscriptionNotFound
+	}
+	return err
+}
+
+func subscriptionKey(clinicID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ClinicID": &types.AttributeValueMemberS{Value: clinicID},
+		"ID":       &types.AttributeValueMemberS{Value: id},
+	}
+}
@@ -0,0 +1,236 @@
+package snapshot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Cases are the requests whose responses are kept beyond those RouteCases
+// derives from the routes: reads with query parameters worth pinning, the
+// reads defaulting to the current date, pinned to the fixtures' week so
+// their responses do not drift from day to day, and the error responses of
+// the common failures, whose shape clients rely on as much as the records'
+var Cases = []Case{
+	{Name: "api_info", Method: "GET", Path: "/api/v1"},
+
+	{Name: "dentist_list", Method: "GET", Path: "/api/v1/dental/dentist"},
+	{Name: "dentist_get", Method: "GET", Path: "/api/v1/dental/dentist/" + DentistID},
+	{Name: "dentist_not_found", Method: "GET", Path: "/api/v1/dental/dentist/missing"},
+	{Name: "patient_list", Method: "GET", Path: "/api/v1/dental/patient"},
+	{Name: "patient_get", Method: "GET", Path: "/api/v1/dental/patient/" + PatientID},
+	{Name: "patient_history", Method: "GET", Path: "/api/v1/dental/patient/" + PatientID + "/history"},
+	{Name: "patient_invalid", Method: "POST", Path: "/api/v1/dental/patient", Body: `{"name": ""}`},
+	{Name: "procedure_list", Method: "GET", Path: "/api/v1/dental/procedure"},
+	{Name: "procedure_get", Method: "GET", Path: "/api/v1/dental/procedure/" + ProcedureID},
+	{Name: "appointment_list", Method: "GET", Path: "/api/v1/dental/appointment"},
+	{Name: "appointment_get", Method: "GET", Path: "/api/v1/dental/appointment/" + AppointmentID},
+	{Name: "appointment_expanded", Method: "GET", Path: "/api/v1/dental/appointment/" + AppointmentID + "?expand=patient,dentist,procedure"},
+	{Name: "appointment_calendar", Method: "GET", Path: "/api/v1/dental/appointment/calendar?from=2024-03-10&to=2024-03-12"},
+	{Name: "appointments_calendar", Method: "GET", Path: "/api/v1/dental/appointments/calendar?from=2024-03-10&to=2024-03-12"},
+	{Name: "appointment_update_without_version", Method: "PUT", Path: "/api/v1/dental/appointment/" + AppointmentID, Body: `{"status": "confirmed"}`},
+	{Name: "appointment_queue_live", Method: "GET", Path: "/api/v1/dental/appointment/queue/live", Stream: true},
+	{Name: "appointment_queue", Method: "GET", Path: "/api/v1/dental/appointment/queue?date=2024-03-11"},
+	{Name: "appointment_suggest", Method: "GET", Path: "/api/v1/dental/appointment/suggest?patientId=" + PatientID + "&procedureId=" + ProcedureID + "&from=2024-03-11&days=2"},
+	{Name: "agenda_day", Method: "GET", Path: "/api/v1/dental/agenda?date=2024-03-11"},
+	{Name: "agenda_print", Method: "GET", Path: "/api/v1/dental/agenda/print?date=2024-03-11"},
+	{Name: "booking_slots", Method: "GET", Path: "/api/v1/dental/booking/slots?procedureId=" + ProcedureID + "&from=2024-03-11&days=2"},
+	{Name: "dentist_agenda", Method: "GET", Path: "/api/v1/dental/dentist/" + DentistID + "/agenda?from=2024-03-11&days=2"},
+	{Name: "dentist_availability", Method: "GET", Path: "/api/v1/dental/dentist/" + DentistID + "/availability?date=2024-03-11"},
+	{Name: "procedure_price_at", Method: "GET", Path: "/api/v1/dental/procedure/" + ProcedureID + "/price?at=2024-03-11"},
+	{Name: "procedure_durations", Method: "GET", Path: "/api/v1/dental/procedure/durations?from=2023-09-01&to=2024-03-31"},
+	{Name: "stats_week", Method: "GET", Path: "/api/v1/dental/stats?from=2024-03-10&to=2024-03-16"},
+	{Name: "capacity_week", Method: "GET", Path: "/api/v1/dental/reports/capacity?from=2024-03-11&to=2024-03-15"},
+	{Name: "benchmark_march", Method: "GET", Path: "/api/v1/dental/reports/benchmark?from=2024-03-01&to=2024-03-31"},
+	{Name: "stats_live", Method: "GET", Path: "/api/v1/dental/stats/live", Stream: true},
+	{Name: "task_list_open", Method: "GET", Path: "/api/v1/dental/task?status=open"},
+	{Name: "waitlist_list_waiting", Method: "GET", Path: "/api/v1/dental/waitlist?status=waiting"},
+
+	{Name: "expense_list", Method: "GET", Path: "/api/v1/financial/expense"},
+	{Name: "expense_get", Method: "GET", Path: "/api/v1/financial/expense/" + ExpenseID},
+	{Name: "revenue_list", Method: "GET", Path: "/api/v1/financial/revenue"},
+	{Name: "revenue_get", Method: "GET", Path: "/api/v1/financial/revenue/" + RevenueID},
+	{Name: "revenue_not_found", Method: "GET", Path: "/api/v1/financial/revenue/missing"},
+	{Name: "invoice_list_march", Method: "GET", Path: "/api/v1/financial/invoice?from=2024-03-01&to=2024-03-31"},
+	{Name: "forecast_march", Method: "GET", Path: "/api/v1/financial/reports/forecast?from=2024-03-01&to=2024-03-31"},
+	{Name: "consolidated_march", Method: "GET", Path: "/api/v1/financial/reports/consolidated?from=2024-03&to=2024-03"},
+	{Name: "top_patients_march", Method: "GET", Path: "/api/v1/financial/reports/top-patients?from=2024-03-01&to=2024-03-31"},
+	{Name: "period_march", Method: "GET", Path: "/api/v1/financial/period/2024-03"},
+
+	{Name: "staff_list", Method: "GET", Path: "/api/v1/staff/member"},
+	{Name: "staff_get", Method: "GET", Path: "/api/v1/staff/member/" + StaffID},
+
+	{Name: "credential_list", Method: "GET", Path: "/api/v1/compliance/credential"},
+	{Name: "credential_get", Method: "GET", Path: "/api/v1/compliance/credential/" + CredentialID},
+	{Name: "checklist_report_day", Method: "GET", Path: "/api/v1/compliance/checklist/report?date=2024-03-11"},
+	{Name: "staff_rota_week", Method: "GET", Path: "/api/v1/staff/rota?week=2024-03-11"},
+
+	{Name: "auth_login_invalid", Method: "POST", Path: "/api/v1/auth/login", Body: `{"email": "snapshot@example.com", "password": "wrong"}`},
+	{Name: "admin_export_dentists", Method: "GET", Path: "/api/v1/admin/export/Dentists"},
+
+	{Name: "method_not_allowed", Method: "PATCH", Path: "/api/v1/dental/dentist", Unrouted: true},
+	{Name: "route_not_found", Method: "GET", Path: "/api/v1/dental/unknown", Unrouted: true},
+}
+
+// fixtureIDs are the fixtures read by the {id} of the collections holding
+// them, named by the path segment before the ID
+var fixtureIDs = map[string]string{
+	"dentist":        DentistID,
+	"patient":        PatientID,
+	"procedure":      ProcedureID,
+	"appointment":    AppointmentID,
+	"expense":        ExpenseID,
+	"revenue":        RevenueID,
+	"invoice":        InvoiceID,
+	"member":         StaffID,
+	"credential":     CredentialID,
+	"task":           TaskID,
+	"treatment-plan": TreatmentPlanID,
+	"prescription":   PrescriptionID,
+	"bundle":         BundleID,
+	"room":           RoomID,
+	"waitlist":       WaitlistID,
+}
+
+// fixtureVars are the values of the other path variables of the reads
+var fixtureVars = map[string]string{
+	"patientId":     PatientID,
+	"dentistId":     DentistID,
+	"procedureId":   ProcedureID,
+	"appointmentId": AppointmentID,
+	"clinicId":      ClinicID,
+	"month":         "2024-03",
+	"table":         "Dentists",
+}
+
+// unknown is the value of the path variables naming no fixture, and of
+// every variable of the writes, so they never change the fixtures
+const unknown = "missing"
+
+// malformed is the body of the writes RouteCases derives: the handlers
+// reading a body refuse it before writing anything, so the error
+// responses of every write are kept without the fixtures changing from
+// one run to the next
+const malformed = `{"snapshot": `
+
+// probes are the routes left out of the snapshots: the health checks
+// report the live state of the process, not a contract over the fixtures
+var probes = map[string]bool{
+	"GET /health":       true,
+	"GET /health/score": true,
+}
+
+var variable = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// RouteCases returns a case for every route of router no case of curated
+// already requests, so a new endpoint is snapshotted, and fails the check
+// until its golden file is recorded, without anyone remembering to add it.
+// Reads get the fixtures named by their path; writes get unknown IDs and a
+// malformed body. Reads come first, so the writes cannot affect them, and
+// routes without methods, such as the static files of the admin UI, are
+// left out.
+func RouteCases(router *mux.Router, curated []Case) []Case {
+	covered := map[string]bool{}
+	for route := range probes {
+		covered[route] = true
+	}
+	for _, c := range curated {
+		if route, ok := Route(router, c); ok {
+			covered[route] = true
+		}
+	}
+
+	var reads, writes []Case
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		// Walk also visits the module routers mounted as handlers
+		template, err := route.GetPathTemplate()
+		if _, mounted := route.GetHandler().(*mux.Router); err != nil || mounted || route.GetHandler() == nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method == http.MethodHead || method == http.MethodOptions || covered[method+" "+template] {
+				continue
+			}
+			c := Case{Name: caseName(method, template), Method: method}
+			if method == http.MethodGet {
+				c.Path = readPath(template)
+				reads = append(reads, c)
+				continue
+			}
+			c.Path = variable.ReplaceAllString(template, unknown)
+			c.Body = malformed
+			writes = append(writes, c)
+		}
+		return nil
+	})
+	sort.Slice(reads, func(i, j int) bool { return reads[i].Name < reads[j].Name })
+	sort.Slice(writes, func(i, j int) bool { return writes[i].Name < writes[j].Name })
+	return append(reads, writes...)
+}
+
+// Route returns the method and path template of the route router serves
+// the request of c with, following the module routers mounted on it, false
+// when no route matches it
+func Route(router *mux.Router, c Case) (string, bool) {
+	req := httptest.NewRequest(c.Method, c.Path, nil)
+	for {
+		var match mux.RouteMatch
+		if !router.Match(req, &match) || match.MatchErr != nil || match.Route == nil {
+			return "", false
+		}
+		if mounted, ok := match.Route.GetHandler().(*mux.Router); ok {
+			router = mounted
+			continue
+		}
+		template, err := match.Route.GetPathTemplate()
+		if err != nil {
+			return "", false
+		}
+		return c.Method + " " + template, true
+	}
+}
+
+// readPath fills the variables of a read's template with the fixtures
+func readPath(template string) string {
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		name := variable.FindStringSubmatch(segment)
+		if name == nil {
+			continue
+		}
+		value, ok := fixtureVars[name[1]]
+		if name[1] == "id" && i > 0 {
+			value, ok = fixtureIDs[segments[i-1]]
+		}
+		if !ok {
+			value = unknown
+		}
+		segments[i] = value
+	}
+	return strings.Join(segments, "/")
+}
+
+// caseName names the golden file of a route, such as
+// route_get_dental_dentist_id for GET /api/v1/dental/dentist/{id}
+func caseName(method, template string) string {
+	path := strings.TrimPrefix(template, "/api/v1")
+	path = variable.ReplaceAllString(path, "$1")
+	var name strings.Builder
+	name.WriteString("route_" + strings.ToLower(method))
+	for _, r := range strings.ToLower(path) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			name.WriteRune(r)
+			continue
+		}
+		name.WriteRune('_')
+	}
+	return regexp.MustCompile(`_+`).ReplaceAllString(strings.TrimRight(name.String(), "_"), "_")
+}
@@ -0,0 +1,147 @@
+package snapshot
+
+import (
+	"context"
+	compliance "dental-saas/modules/compliance/models"
+	dental "dental-saas/modules/dental/models"
+	financial "dental-saas/modules/financial/models"
+	staff "dental-saas/modules/staff/models"
+	"dental-saas/shared/clinics"
+	"dental-saas/shared/config"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// ClinicID is the clinic the fixtures are seeded in, kept apart from the
+// clinics of a DynamoDB Local used for development
+const ClinicID = "snapshot-clinic"
+
+// IDs of the fixtures, used by the cases
+const (
+	DentistID     = "snapshot-dentist"
+	PatientID     = "snapshot-patient"
+	ProcedureID   = "snapshot-procedure"
+	AppointmentID = "snapshot-appointment"
+	ExpenseID     = "snapshot-expense"
+	RevenueID     = "snapshot-revenue"
+	StaffID       = "snapshot-staff"
+	CredentialID  = "snapshot-credential"
+
+	InvoiceID       = "snapshot-invoice"
+	TaskID          = "snapshot-task"
+	TreatmentPlanID = "snapshot-treatment-plan"
+	PrescriptionID  = "snapshot-prescription"
+	BundleID        = "snapshot-bundle"
+	RoomID          = "snapshot-room"
+	WaitlistID      = "snapshot-waitlist"
+)
+
+// seededAt is the creation and update time of every fixture, fixed so the
+// responses do not change from one run to the next
+var seededAt = time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+
+type fixture struct {
+	table  string
+	record interface{}
+}
+
+func fixtures() []fixture {
+	stamp := seededAt.Format(time.RFC3339)
+	return []fixture{
+		{clinics.TableName, clinics.Clinic{ID: ClinicID, Name: "Clínica Snapshot", CreatedAt: stamp, UpdatedAt: stamp}},
+		{"Dentists", dental.Dentist{
+			ID: DentistID, Name: "Ana Souza", Email: "ana@example.com", Phone: "11999990000",
+			CRO: "SP-12345", Country: "BR", Specialty: "Ortodontia", CreatedAt: seededAt, UpdatedAt: seededAt,
+		}},
+		{"Patients", dental.Patient{
+			ID: PatientID, Name: "Bruno Lima", Email: "bruno@example.com", Phone: "11988880000",
+			DateOfBirth: "1990-05-20", MedicalNotes: "Alergia a penicilina", CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Procedures", dental.Procedure{
+			ID: ProcedureID, Name: "Limpeza", Description: "Profilaxia completa", Price: "150.00",
+			Duration: "30", CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Appointments", dental.Appointment{
+			ID: AppointmentID, DentistID: DentistID, PatientID: PatientID, ProcedureID: ProcedureID,
+			DateTime: "2024-03-11T14:00:00Z", Duration: "30", Status: "scheduled", CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Expenses", financial.Expense{
+			ID: ExpenseID, Description: "Aluguel de março", Amount: 3500, Category: financial.ExpenseCategoryRent,
+			Date: seededAt, Status: financial.ExpenseStatusApproved, CreatedAt: seededAt, UpdatedAt: seededAt,
+		}},
+		{"Revenues", financial.Revenue{
+			ID: RevenueID, Description: "Limpeza", Amount: 150, PatientID: PatientID, ProcedureID: ProcedureID,
+			AppointmentID: AppointmentID, PaymentMethod: financial.PaymentMethodPix, PaymentStatus: financial.PaymentStatusPending,
+			DueDate: seededAt.AddDate(0, 0, 7), CreatedAt: seededAt, UpdatedAt: seededAt,
+		}},
+		{"Staff", staff.StaffMember{
+			ID: StaffID, Name: "Carla Dias", Role: staff.RoleReceptionist, Email: "carla@example.com",
+			BaseSalary: 2800, Active: true, CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Credentials", compliance.Credential{
+			ID: CredentialID, HolderType: compliance.HolderClinic, Type: compliance.CredentialSanitaryLicense,
+			Number: "VS-2024-001", Issuer: "Vigilância Sanitária", IssuedAt: "2024-01-10", ExpiresAt: "2099-01-10",
+			CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Invoices", financial.Invoice{
+			ID: InvoiceID, Number: "NF-2024-0001", Type: financial.InvoiceTypeService, Status: financial.InvoiceStatusIssued,
+			PatientID: PatientID, PatientName: "Bruno Lima", PatientEmail: "bruno@example.com",
+			Items:    []financial.InvoiceItem{{Description: "Limpeza", Quantity: 1, UnitPrice: 150, TotalPrice: 150}},
+			Subtotal: 150, TotalAmount: 150, IssueDate: seededAt, DueDate: seededAt.AddDate(0, 0, 7),
+			CreatedAt: seededAt, UpdatedAt: seededAt,
+		}},
+		{"Tasks", dental.Task{
+			ID: TaskID, Title: "Confirmar retorno", Assignee: "carla@example.com", PatientID: PatientID,
+			DueDate: "2024-03-08", Status: dental.TaskStatusOpen, CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"TreatmentPlans", dental.TreatmentPlan{
+			ID: TreatmentPlanID, PatientID: PatientID, DentistID: DentistID, Title: "Manutenção",
+			Status: dental.TreatmentPlanProposed, EstimatedTotal: "150.00",
+			Items: []dental.TreatmentPlanItem{{
+				ID: "snapshot-treatment-item", ProcedureID: ProcedureID, EstimatedCost: "150.00",
+				Priority: dental.TreatmentPriorityMedium, Status: dental.TreatmentItemPlanned,
+			}},
+			CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Prescriptions", dental.Prescription{
+			ID: PrescriptionID, PatientID: PatientID, DentistID: DentistID, AppointmentID: AppointmentID, IssueDate: "2024-03-11",
+			Items:     []dental.PrescriptionItem{{Name: "Ibuprofeno", Strength: "400 mg", Dosage: "1 comprimido", Frequency: "a cada 8 horas", Duration: "por 3 dias"}},
+			CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Bundles", dental.Bundle{
+			ID: BundleID, Name: "Manutenção semestral", Description: "Duas limpezas", Price: "270.00",
+			Items: []dental.BundleItem{{ProcedureID: ProcedureID, Quantity: 2}}, CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"Rooms", dental.Room{ID: RoomID, Name: "Consultório 1", Features: []string{"raio-x"}, Active: true, CreatedAt: stamp, UpdatedAt: stamp}},
+		{"Waitlist", dental.WaitlistEntry{
+			ID: WaitlistID, PatientID: PatientID, ProcedureID: ProcedureID, DentistID: DentistID,
+			EarliestDate: "2024-03-11", LatestDate: "2024-03-29", Status: dental.WaitlistWaiting, CreatedAt: stamp, UpdatedAt: stamp,
+		}},
+		{"BenchmarkSettings", dental.BenchmarkSettings{ClinicID: ClinicID, OptIn: true, UpdatedAt: stamp}},
+	}
+}
+
+// Seed writes the fixtures to ClinicID, replacing those of earlier runs
+func Seed(ctx context.Context) error {
+	ctx = config.WithClinic(ctx, ClinicID)
+	for _, f := range fixtures() {
+		item, err := attributevalue.MarshalMap(f.record)
+		if err != nil {
+			return fmt.Errorf("marshaling %s fixture: %v", f.table, err)
+		}
+		dbCtx, cancel := config.DBContext(ctx)
+		_, err = config.DBClient.PutItem(dbCtx, &dynamodb.PutItemInput{
+			TableName: aws.String(f.table),
+			Item:      item,
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("seeding %s fixture: %v", f.table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package snapshot keeps the JSON responses of the API to a set of seeded
+// fixtures as golden files, and reports the responses that drift from them,
+// so an unintended change to the contract of a handler is caught before it
+// ships. The check is TestSnapshots, run against DynamoDB Local; every route
+// gets a case, so an endpoint added without its golden file fails it.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Case is a request whose response is kept as a golden file
+type Case struct {
+	Name   string // name of the golden file, without the extension
+	Method string
+	Path   string
+	Body   string
+	// Stream marks a response kept open until the client leaves, such as
+	// server-sent events; the request is dropped after streamFor
+	Stream bool
+	// Unrouted marks a request that matches no route on purpose, to keep
+	// the responses of the router itself
+	Unrouted bool
+}
+
+// Snapshot is the part of a response kept in a golden file. Bodies that are
+// not JSON, such as PDFs, CSV exports and event streams, are left out; their
+// status and content type are the contract kept.
+type Snapshot struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// volatile are the fields that change on every request or with the current
+// date, masked so they do not count as drift
+var volatile = map[string]bool{
+	"request_id":        true,
+	"days_until_expiry": true,
+	"days_overdue":      true,
+}
+
+// streamFor is how long a stream is read before the request is dropped
+const streamFor = 200 * time.Millisecond
+
+// masked replaces the value of the volatile fields
+const masked = "MASKED"
+
+// Take sends the request of c to handler as the user of token and returns
+// its snapshot
+func Take(handler http.Handler, token string, c Case) (Snapshot, error) {
+	req := httptest.NewRequest(c.Method, c.Path, strings.NewReader(c.Body))
+	if c.Stream {
+		ctx, cancel := context.WithTimeout(req.Context(), streamFor)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	if c.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	snapshot := Snapshot{Status: rec.Code, ContentType: rec.Header().Get("Content-Type")}
+	if rec.Body.Len() > 0 && strings.Contains(snapshot.ContentType, "json") {
+		canonical, err := Canonical(rec.Body.Bytes())
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("%s: response is not JSON: %v", c.Name, err)
+		}
+		snapshot.Body = canonical
+	}
+	return snapshot, nil
+}
+
+// Canonical rewrites a JSON document with its object keys sorted, numbers
+// kept as written and the volatile fields masked, so equal responses are
+// equal byte for byte
+func Canonical(document []byte) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(mask(value), "", "  ")
+}
+
+func mask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if volatile[key] {
+				v[key] = masked
+				continue
+			}
+			v[key] = mask(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = mask(v[i])
+		}
+	}
+	return value
+}
+
+// Compare checks got against the golden file of c in dir, reporting the
+// first difference. With update the golden file is written instead.
+func Compare(dir string, c Case, got Snapshot, update bool) (string, error) {
+	encoded, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	encoded = append(encoded, '\n')
+	path := filepath.Join(dir, c.Name+".json")
+
+	if update {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		return "", os.WriteFile(path, encoded, 0o644)
+	}
+
+	golden, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "no golden file, record it with -update", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return difference(golden, encoded), nil
+}
+
+// difference describes the first line where got departs from golden, ""
+// when they are equal
+func difference(golden, got []byte) string {
+	if bytes.Equal(golden, got) {
+		return ""
+	}
+	goldenLines := strings.Split(string(golden), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(goldenLines) || i < len(gotLines); i++ {
+		var want, have string
+		if i < len(goldenLines) {
+			want = goldenLines[i]
+		}
+		if i < len(gotLines) {
+			have = gotLines[i]
+		}
+		if want != have {
+			return fmt.Sprintf("line %d: want %q, got %q", i+1, strings.TrimSpace(want), strings.TrimSpace(have))
+		}
+	}
+	return "responses differ"
+}
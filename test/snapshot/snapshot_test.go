@@ -0,0 +1,78 @@
+package snapshot
+
+import (
+	"context"
+	"flag"
+	"os"
+	"testing"
+
+	"dental-saas/shared/apierror"
+	"dental-saas/shared/auth"
+	"dental-saas/shared/config"
+	"dental-saas/shared/router"
+)
+
+var update = flag.Bool("update", false, "record the golden files instead of checking them")
+
+// TestSnapshots checks the responses to the seeded fixtures against their
+// golden files in testdata, for the curated cases and one for every other
+// route. It needs DynamoDB Local and is skipped unless DYNAMODB_ENDPOINT
+// points to one; with -update the golden files are recorded again instead.
+func TestSnapshots(t *testing.T) {
+	if os.Getenv("DYNAMODB_ENDPOINT") == "" {
+		t.Skip("DYNAMODB_ENDPOINT is not set, start DynamoDB Local to check the snapshots")
+	}
+
+	config.InitDynamoDB()
+	if err := Seed(context.Background()); err != nil {
+		t.Fatalf("seeding fixtures: %v", err)
+	}
+
+	// Requests are made as an admin of the fixtures' clinic
+	tokens, err := auth.Issue(auth.User{
+		ID:       "snapshot-admin",
+		Email:    "snapshot@example.com",
+		Name:     "Snapshot",
+		Role:     auth.RoleAdmin,
+		ClinicID: ClinicID,
+	})
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+
+	mainRouter := router.NewMainRouter()
+	handler := apierror.Middleware(router.StripTrailingSlash(mainRouter))
+	for _, c := range append(Cases, RouteCases(mainRouter, Cases)...) {
+		t.Run(c.Name, func(t *testing.T) {
+			got, err := Take(handler, tokens.AccessToken, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drift, err := Compare("testdata", c, got, *update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if drift != "" {
+				t.Errorf("response drifted from its golden file, %s", drift)
+			}
+		})
+	}
+}
+
+// TestCasesMatchRoutes checks, without DynamoDB, that every curated case
+// requests the route it was written for, so a renamed or removed route does
+// not leave a case quietly snapshotting a 404, and that no two cases share
+// a golden file
+func TestCasesMatchRoutes(t *testing.T) {
+	mainRouter := router.NewMainRouter()
+	names := map[string]bool{}
+	for _, c := range append(Cases, RouteCases(mainRouter, Cases)...) {
+		if names[c.Name] {
+			t.Errorf("%s: more than one case keeps this golden file", c.Name)
+		}
+		names[c.Name] = true
+		if _, ok := Route(mainRouter, c); ok == c.Unrouted {
+			t.Errorf("%s: %s %s matches a route = %t, want %t", c.Name, c.Method, c.Path, ok, !c.Unrouted)
+		}
+	}
+}